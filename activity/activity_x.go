@@ -4,15 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
 	"naevis/middleware"
 	"naevis/models"
 	"naevis/rdx"
 	"net/http"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -22,24 +21,21 @@ import (
 func LogActivities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	tokenString := r.Header.Get("Authorization")
 	if len(tokenString) < 8 {
-		SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		log.Println("Authorization token is missing or invalid.")
 		return
 	}
 
-	claims := &middleware.Claims{}
-	_, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-		return globals.JwtSecret, nil
-	})
+	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid token")
 		log.Println("Invalid token:", err)
 		return
 	}
 
 	var activities []models.Activity
 	if err := json.NewDecoder(r.Body).Decode(&activities); err != nil {
-		SendErrorResponse(w, http.StatusBadRequest, "Invalid input")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
 		log.Println("Failed to decode activities:", err)
 		return
 	}
@@ -58,7 +54,7 @@ func LogActivities(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	_, err = db.ActivitiesCollection.InsertMany(context.TODO(), docs)
 	if err != nil {
-		SendErrorResponse(w, http.StatusInternalServerError, "Failed to log activities")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to log activities")
 		log.Println("Failed to insert activities into database:", err)
 		return
 	}
@@ -83,29 +79,26 @@ func LogActivities(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 func GetActivityFeed(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	tokenString := r.Header.Get("Authorization")
 	if len(tokenString) < 8 {
-		SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	claims := &middleware.Claims{}
-	_, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-		return globals.JwtSecret, nil
-	})
+	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 
 	cursor, err := db.ActivitiesCollection.Find(context.TODO(), bson.M{"userid": claims.UserID})
 	if err != nil {
-		SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch activities")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch activities")
 		return
 	}
 	defer cursor.Close(context.TODO())
 
 	var activities []models.Activity
 	if err := cursor.All(context.TODO(), &activities); err != nil {
-		SendErrorResponse(w, http.StatusInternalServerError, "Failed to decode activities")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode activities")
 		return
 	}
 
@@ -122,14 +115,14 @@ func GetTrendingActivities(w http.ResponseWriter, r *http.Request, _ httprouter.
 
 	cursor, err := db.ActivitiesCollection.Find(context.TODO(), bson.M{}, opts)
 	if err != nil {
-		SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch trending activities")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch trending activities")
 		return
 	}
 	defer cursor.Close(context.TODO())
 
 	var activities []models.Activity
 	if err := cursor.All(context.TODO(), &activities); err != nil {
-		SendErrorResponse(w, http.StatusInternalServerError, "Failed to decode trending activities")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode trending activities")
 		return
 	}
 
@@ -138,13 +131,6 @@ func GetTrendingActivities(w http.ResponseWriter, r *http.Request, _ httprouter.
 	log.Println("Fetched trending activities:", activities)
 }
 
-// Utility function for sending error responses
-func SendErrorResponse(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
-
 // Redis subscriber for real-time recommendations
 func SubscribeToActivityEvents() {
 	pubsub := rdx.Conn.Subscribe(context.TODO(), "activity_events")
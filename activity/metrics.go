@@ -2,6 +2,7 @@ package activity
 
 import (
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"net/http"
@@ -17,7 +18,7 @@ func HandleAnalyticsEvent(w http.ResponseWriter, r *http.Request, _ httprouter.P
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 
@@ -59,7 +60,7 @@ func HandleAnalyticsEvent(w http.ResponseWriter, r *http.Request, _ httprouter.P
 
 	_, err := db.AnalyticsCollection.InsertMany(globals.Ctx, docs)
 	if err != nil {
-		http.Error(w, "failed to save events", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "failed to save events")
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"net/http"
 	"time"
@@ -17,7 +18,7 @@ func HandleTelemetry(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	var data map[string]interface{}
 
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
@@ -33,7 +34,7 @@ func HandleTelemetry(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 
 	if _, err := db.AnalyticsCollection.InsertOne(ctx, bson.M(data)); err != nil {
 		log.Println("Failed to insert telemetry:", err)
-		http.Error(w, "DB insert error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "DB insert error")
 		return
 	}
 
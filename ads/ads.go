@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -64,6 +66,6 @@ func GetAds(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(filteredAds); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -82,7 +84,7 @@ func GetEntityAnalytics(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	case "product":
 		analytics = getProductAnalytics(entityID)
 	default:
-		http.Error(w, "Invalid entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid entity type")
 		return
 	}
 
@@ -0,0 +1,189 @@
+// Package apierr defines the single error shape returned by the API. Every
+// failed request is answered with an RFC 9457 application/problem+json body
+// carrying a machine-readable code, so clients can branch on the code and
+// show the detail without special-casing individual endpoints.
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ContentType is the media type of every error body.
+const ContentType = "application/problem+json"
+
+// Code is a stable, machine-readable error identifier.
+type Code string
+
+const (
+	CodeBadRequest        Code = "bad_request"
+	CodeValidation        Code = "validation_failed"
+	CodeUnauthorized      Code = "unauthorized"
+	CodePaymentRequired   Code = "payment_required"
+	CodeForbidden         Code = "forbidden"
+	CodeNotFound          Code = "not_found"
+	CodeMethodNotAllowed  Code = "method_not_allowed"
+	CodeConflict          Code = "conflict"
+	CodeGone              Code = "gone"
+	CodeTooLarge          Code = "payload_too_large"
+	CodeUnsupportedMedia  Code = "unsupported_media_type"
+	CodeUnprocessable     Code = "unprocessable"
+	CodeRateLimited       Code = "rate_limited"
+	CodeInternal          Code = "internal"
+	CodeNotImplemented    Code = "not_implemented"
+	CodeBadGateway        Code = "bad_gateway"
+	CodeUnavailable       Code = "unavailable"
+	CodeTimeout           Code = "timeout"
+	CodeInsufficientFunds Code = "insufficient_funds"
+	CodeEmailUnverified   Code = "email_unverified"
+	CodeMFARequired       Code = "mfa_required"
+)
+
+// codeForStatus is the default code for each status when none is given.
+var codeForStatus = map[int]Code{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusPaymentRequired:       CodePaymentRequired,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotImplemented,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// CodeFor returns the default code for an HTTP status.
+func CodeFor(status int) Code {
+	if c, ok := codeForStatus[status]; ok {
+		return c
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// FieldError describes one invalid input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an API error. Status and Code are rendered; Err is an internal
+// cause kept for logging and errors.Is/As and is never sent to clients.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error with an explicit status and code.
+func New(status int, code Code, msg string) *Error {
+	return &Error{Status: status, Code: code, Message: msg}
+}
+
+// Wrap attaches an internal cause to e.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// WithField adds a field-level validation detail.
+func (e *Error) WithField(field, msg string) *Error {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: msg})
+	return e
+}
+
+// Convenience constructors for the common cases.
+
+func BadRequest(msg string) *Error   { return New(http.StatusBadRequest, CodeBadRequest, msg) }
+func Unauthorized(msg string) *Error { return New(http.StatusUnauthorized, CodeUnauthorized, msg) }
+func Forbidden(msg string) *Error    { return New(http.StatusForbidden, CodeForbidden, msg) }
+func NotFound(msg string) *Error     { return New(http.StatusNotFound, CodeNotFound, msg) }
+func Conflict(msg string) *Error     { return New(http.StatusConflict, CodeConflict, msg) }
+
+// Internal hides err from the client behind a generic message.
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error").Wrap(err)
+}
+
+// Validation returns a 422 listing every invalid field.
+func Validation(fields ...FieldError) *Error {
+	return &Error{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidation,
+		Message: "Request validation failed",
+		Fields:  fields,
+	}
+}
+
+// problem is the wire format.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      Code         `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// requestIDHeader matches middleware.RequestIDHeader; the middleware sets
+// it on the response before any handler runs.
+const requestIDHeader = "X-Request-ID"
+
+// Write renders err as problem+json. Errors that are not *Error become a
+// 500 with a generic detail.
+func Write(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal(err)
+	}
+	status := e.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	code := e.Code
+	if code == "" {
+		code = CodeFor(status)
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Message,
+		Code:      code,
+		Errors:    e.Fields,
+		RequestID: w.Header().Get(requestIDHeader),
+	})
+}
+
+// Respond writes an error with the default code for status. It is the
+// drop-in replacement for http.Error.
+func Respond(w http.ResponseWriter, status int, msg string) {
+	Write(w, New(status, CodeFor(status), msg))
+}
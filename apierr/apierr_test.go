@@ -0,0 +1,61 @@
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	Write(rec, Validation(FieldError{Field: "password", Message: "is required"}))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != CodeValidation || p.Status != 422 || p.RequestID != "req-1" {
+		t.Errorf("problem = %+v", p)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "password" {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
+
+func TestWriteHidesInternalCause(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, errors.New("mongo: connection refused"))
+
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusInternalServerError || p.Code != CodeInternal {
+		t.Errorf("status = %d, code = %s", rec.Code, p.Code)
+	}
+	if p.Detail != "Internal server error" {
+		t.Errorf("detail leaked cause: %q", p.Detail)
+	}
+}
+
+func TestRespondDefaultsCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Respond(rec, http.StatusNotFound, "Farm not found")
+
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != CodeNotFound || p.Detail != "Farm not found" || p.Title != "Not Found" {
+		t.Errorf("problem = %+v", p)
+	}
+}
@@ -3,6 +3,7 @@ package artists
 import (
 	"context"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -21,7 +22,7 @@ func GetArtistEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	filter := bson.M{"artistid": ps.ByName("id")}
 	artistevents, err := utils.FindAndDecode[models.ArtistEvent](ctx, db.ArtistEventsCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch artist events")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch artist events")
 		return
 	}
 
@@ -40,13 +41,13 @@ func GetAllArtists(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	var artists []models.Artist
 	cursor, err := db.ArtistsCollection.Find(ctx, bson.M{})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching artists")
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching artists")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	if err := cursor.All(ctx, &artists); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error decoding artists")
+		apierr.Respond(w, http.StatusInternalServerError, "Error decoding artists")
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func CreateArtistEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -23,7 +25,7 @@ func CreateArtistEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	var artistevent models.ArtistEvent
 	if err := json.NewDecoder(r.Body).Decode(&artistevent); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
@@ -33,21 +35,25 @@ func CreateArtistEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	artistevent.CreatorID = claims.UserID
 	artistevent.EventID = utils.GenerateRandomString(14)
 
-	insertResult, err := db.ArtistEventsCollection.InsertOne(ctx, artistevent)
+	// The artist event, its event and the event's index entry commit together
+	var insertResult *mongo.InsertOneResult
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if insertResult, err = db.ArtistEventsCollection.InsertOne(ctx, artistevent); err != nil {
+			return err
+		}
+		_, err = addEventToDB(ctx, artistevent)
+		return err
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
-		return
-	}
-
-	if _, err := addEventToDB(ctx, artistevent); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to add event")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to add event")
 		return
 	}
 
@@ -63,13 +69,13 @@ func UpdateArtistEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	var updateData bson.M
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
 	result, err := db.ArtistEventsCollection.UpdateOne(context.TODO(), bson.M{"eventid": artisteventID}, bson.M{"$set": updateData})
 	if err != nil || result.ModifiedCount == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "ArtistEvent not found or update failed")
+		apierr.Respond(w, http.StatusNotFound, "ArtistEvent not found or update failed")
 		return
 	}
 
@@ -82,7 +88,7 @@ func DeleteArtistEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	result, err := db.ArtistEventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": artisteventID})
 	if err != nil || result.DeletedCount == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "ArtistEvent not found or deletion failed")
+		apierr.Respond(w, http.StatusNotFound, "ArtistEvent not found or deletion failed")
 		return
 	}
 
@@ -116,14 +122,14 @@ func addEventToDB(ctx context.Context, artistEvent models.ArtistEvent) (string,
 		return "", err
 	}
 
-	userdata.SetUserData("event", event.EventID, artistEvent.ArtistID, "", "")
+	if err := userdata.SetUserDataTx(ctx, "event", event.EventID, artistEvent.ArtistID, "", ""); err != nil {
+		return "", err
+	}
 
 	// Pass ctx to Emit
-	go mq.Emit(ctx, "event-created", models.Index{
+	return "", mq.Emit(ctx, "event-created", models.Index{
 		EntityType: "event", EntityId: event.EventID, Method: "POST",
 	})
-
-	return "", err
 }
 
 func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -134,7 +140,7 @@ func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 
 	var payload RequestPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
@@ -145,7 +151,7 @@ func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	var event models.Event
 	err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": payload.EventID}).Decode(&event)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Event not found")
+		apierr.Respond(w, http.StatusNotFound, "Event not found")
 		return
 	}
 
@@ -153,11 +159,11 @@ func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	filter := bson.M{"eventid": payload.EventID, "artistid": payload.ArtistID}
 	count, err := db.ArtistEventsCollection.CountDocuments(context.TODO(), filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking for existing artist event")
+		apierr.Respond(w, http.StatusInternalServerError, "Error checking for existing artist event")
 		return
 	}
 	if count > 0 {
-		utils.RespondWithError(w, http.StatusConflict, "Artist already added to this event")
+		apierr.Respond(w, http.StatusConflict, "Artist already added to this event")
 		return
 	}
 
@@ -177,7 +183,7 @@ func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	// Insert into ArtistEventsCollection
 	_, err = db.ArtistEventsCollection.InsertOne(context.TODO(), artistEvent)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to add artist to artist events")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to add artist to artist events")
 		return
 	}
 
@@ -187,7 +193,7 @@ func AddArtistToEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	}
 	_, err = db.EventsCollection.UpdateOne(context.TODO(), bson.M{"eventid": payload.EventID}, update)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update event with artist")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update event with artist")
 		return
 	}
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/mq"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -33,12 +35,12 @@ func PostNewSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
 	if payload.Title == "" || payload.Genre == "" || payload.Duration == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing required fields: title, genre, duration")
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields: title, genre, duration")
 		return
 	}
 
@@ -65,14 +67,18 @@ func PostNewSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 	opts := options.Update().SetUpsert(true)
 
-	if _, err := db.SongsCollection.UpdateOne(ctx, filter, update, opts); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to add song to artist")
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.SongsCollection.UpdateOne(ctx, filter, update, opts); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "song-created", models.Index{
+			EntityType: "song", EntityId: newSong.SongID, Method: "POST",
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to add song to artist")
 		return
 	}
-
-	go mq.Emit(ctx, "song-created", models.Index{
-		EntityType: "song", EntityId: newSong.SongID, Method: "POST",
-	})
 	utils.RespondWithJSON(w, http.StatusCreated, newSong)
 }
 
@@ -82,7 +88,7 @@ func EditSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	songID := ps.ByName("songId")
 
 	if songID == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "songId is required")
+		apierr.Respond(w, http.StatusBadRequest, "songId is required")
 		return
 	}
 
@@ -98,7 +104,7 @@ func EditSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
@@ -129,22 +135,29 @@ func EditSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if len(updateFields) == 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "No fields to update")
+		apierr.Respond(w, http.StatusBadRequest, "No fields to update")
 		return
 	}
 
 	filter := bson.M{"artistid": artistID, "songs.songid": songID}
 	update := bson.M{"$set": updateFields}
 
-	res, err := db.SongsCollection.UpdateOne(ctx, filter, update)
-	if err != nil || res.MatchedCount == 0 {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update song")
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		res, err := db.SongsCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "song-updated", models.Index{
+			EntityType: "song", EntityId: songID, Method: "PUT",
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update song")
 		return
 	}
-
-	go mq.Emit(ctx, "song-updated", models.Index{
-		EntityType: "song", EntityId: songID, Method: "PUT",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, bson.M{"message": "Song updated successfully"})
 }
 
@@ -156,22 +169,25 @@ func DeleteSong(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	songID := ps.ByName("songId")
 
 	if songID == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "songId is required")
+		apierr.Respond(w, http.StatusBadRequest, "songId is required")
 		return
 	}
 
 	filter := bson.M{"artistid": artistID}
 	update := bson.M{"$pull": bson.M{"songs": bson.M{"songid": songID}}}
 
-	_, err := db.SongsCollection.UpdateOne(context.TODO(), filter, update)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.SongsCollection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+		// ✅ Emit event for messaging queue
+		return mq.Emit(ctx, "song-deleted", models.Index{
+			EntityType: "song", EntityId: songID, Method: "DELETE",
+		})
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete song")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete song")
 		return
 	}
-
-	// ✅ Emit event for messaging queue (if needed)
-	go mq.Emit(ctx, "song-deleted", models.Index{
-		EntityType: "song", EntityId: songID, Method: "DELETE",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, bson.M{"message": "Song deleted successfully"})
 }
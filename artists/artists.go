@@ -1,6 +1,7 @@
 package artists
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/models"
@@ -26,7 +28,7 @@ func GetArtistByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	// Fetch artist info
 	if err := db.ArtistsCollection.FindOne(ctx, bson.M{"artistid": artistId}).Decode(&artist); err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Artist not found")
+		apierr.Respond(w, http.StatusNotFound, "Artist not found")
 		return
 	}
 
@@ -79,14 +81,14 @@ func GetArtistsByEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	cursor, err := db.ArtistsCollection.Find(ctx, bson.M{"events": eventID})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching artists")
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching artists")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var artists []models.Artist
 	if err := cursor.All(ctx, &artists); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error decoding artists")
+		apierr.Respond(w, http.StatusInternalServerError, "Error decoding artists")
 		return
 	}
 
@@ -209,28 +211,32 @@ func parseArtistFormData(r *http.Request, existing *models.Artist) (models.Artis
 func CreateArtist(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse form data")
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form data")
 		return
 	}
 
 	artist, _, _, err := parseArtistFormData(r, nil)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	artist.ArtistID = utils.GenerateRandomString(12)
 	artist.EventIDs = []string{}
 
-	if _, err := db.ArtistsCollection.InsertOne(ctx, artist); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create artist")
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ArtistsCollection.InsertOne(ctx, artist); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "artist-created", models.Index{
+			EntityType: "artist", EntityId: artist.ArtistID, Method: "POST",
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create artist")
 		return
 	}
 
-	go mq.Emit(ctx, "artist-created", models.Index{
-		EntityType: "artist", EntityId: artist.ArtistID, Method: "POST",
-	})
-
 	utils.RespondWithJSON(w, http.StatusCreated, artist)
 }
 
@@ -239,19 +245,19 @@ func UpdateArtist(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	idParam := ps.ByName("id")
 
 	if err := r.ParseMultipartForm(20 << 20); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Failed to parse form data")
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form data")
 		return
 	}
 
 	var existing models.Artist
 	if err := db.ArtistsCollection.FindOne(ctx, bson.M{"artistid": idParam}).Decode(&existing); err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Artist not found")
+		apierr.Respond(w, http.StatusNotFound, "Artist not found")
 		return
 	}
 
 	updated, updateData, filesToDelete, err := parseArtistFormData(r, &existing)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	_ = updated
@@ -260,9 +266,16 @@ func UpdateArtist(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
-	_, err = db.ArtistsCollection.UpdateOne(ctx, bson.M{"artistid": idParam}, bson.M{"$set": updateData})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ArtistsCollection.UpdateOne(ctx, bson.M{"artistid": idParam}, bson.M{"$set": updateData}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "artist-updated", models.Index{
+			EntityType: "artist", EntityId: idParam, Method: "PUT",
+		})
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update artist")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update artist")
 		return
 	}
 
@@ -271,10 +284,6 @@ func UpdateArtist(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		_ = os.Remove(path)
 	}
 
-	go mq.Emit(ctx, "artist-updated", models.Index{
-		EntityType: "artist", EntityId: idParam, Method: "PUT",
-	})
-
 	utils.RespondWithJSON(w, http.StatusOK, bson.M{"message": "Artist updated"})
 }
 
@@ -283,23 +292,26 @@ func DeleteArtistByID(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	artistID := ps.ByName("id")
 
 	if artistID == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "artistID is required")
+		apierr.Respond(w, http.StatusBadRequest, "artistID is required")
 		return
 	}
 
 	filter := bson.M{"artistid": artistID}
 	update := bson.M{"$set": bson.M{"deleted": true}}
 
-	_, err := db.ArtistsCollection.UpdateOne(ctx, filter, update)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ArtistsCollection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "artist-deleted", models.Index{
+			EntityType: "artist", EntityId: artistID, Method: "DELETE",
+		})
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete artist")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete artist")
 		return
 	}
 
-	go mq.Emit(ctx, "artist-deleted", models.Index{
-		EntityType: "artist", EntityId: artistID, Method: "DELETE",
-	})
-
 	utils.RespondWithJSON(w, http.StatusOK, bson.M{"message": "Artist deleted successfully"})
 }
 
@@ -3,6 +3,9 @@ package auth
 import (
 	"net/http"
 
+	"naevis/jwtkeys"
+	"naevis/utils"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -18,3 +21,9 @@ func LogoutUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func RefreshToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	refreshTokenHandler(w, r)
 }
+
+// JWKS publishes the public keys that verify access tokens.
+func JWKS(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.RespondWithJSON(w, http.StatusOK, jwtkeys.JWKS())
+}
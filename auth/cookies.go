@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"naevis/config"
+)
+
+// The refresh token cookie is only sent to the auth endpoints.
+const (
+	refreshCookie     = "refresh_token"
+	refreshCookiePath = "/api/v1/auth"
+)
+
+// cookieConfig holds the cookie settings; set by Configure.
+var cookieConfig = config.Cookie{Secure: true, SameSite: "strict"}
+
+func sameSite() http.SameSite {
+	switch cookieConfig.SameSite {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteStrictMode
+}
+
+// setRefreshCookie hands the refresh token to the client as an HttpOnly
+// cookie that expires with its session.
+func setRefreshCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    token,
+		Path:     refreshCookiePath,
+		Domain:   cookieConfig.Domain,
+		HttpOnly: true,
+		Secure:   cookieConfig.Secure,
+		SameSite: sameSite(),
+		Expires:  expires,
+	})
+}
+
+// clearRefreshCookie tells the client to drop its refresh token.
+func clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    "",
+		Path:     refreshCookiePath,
+		Domain:   cookieConfig.Domain,
+		HttpOnly: true,
+		Secure:   cookieConfig.Secure,
+		SameSite: sameSite(),
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+	})
+}
@@ -2,21 +2,26 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
+	"naevis/apierr"
+	"naevis/config"
 	"naevis/db"
 	"naevis/globals"
+	"naevis/jwtkeys"
 	"naevis/middleware"
 	"naevis/models"
 	"naevis/mq"
 	"naevis/rdx"
+	"naevis/sessions"
 	"naevis/utils"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -27,121 +32,156 @@ import (
 
 const (
 	RefreshTokenTTL = 7 * 24 * time.Hour // 7 days
-	AccessTokenTTL  = 24 * time.Hour     // 15 minutes
+	AccessTokenTTL  = 15 * time.Minute   // 15 minutes
 )
 
+// tokenConfig names the issuer and audience of access tokens; set by
+// Configure.
+var tokenConfig = config.JWT{Issuer: "http://localhost:4000", Audience: "naevis"}
+
+// credentials carries the password of a login or registration request;
+// models.User hides its password from JSON, so it cannot be decoded there.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 // ===== LOGIN =====
 func loginHandler(w http.ResponseWriter, r *http.Request) {
-	var user models.User
+	var user credentials
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
 	var storedUser models.User
 	err := db.UserCollection.FindOne(context.TODO(), bson.M{"username": user.Username}).Decode(&storedUser)
 	if err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid username or password")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password)); err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid username or password")
 		return
 	}
 
-	// Generate access token
-	claims := &middleware.Claims{
-		Username: storedUser.Username,
-		UserID:   storedUser.UserID,
-		Role:     storedUser.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	access := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := access.SignedString(globals.JwtSecret)
+	beginLogin(w, r, storedUser)
+}
+
+// beginLogin logs in u, who has passed the first factor. With a second
+// factor that only earns a challenge; the tokens come from completing it.
+func beginLogin(w http.ResponseWriter, r *http.Request, u models.User) {
+	mfa, err := loadMFA(r.Context(), u.UserID)
 	if err != nil {
-		log.Printf("login: failed to sign access token: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "login mfa lookup failed", "user_id", u.UserID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start session")
 		return
 	}
+	if mfa.Enabled || mfaRequired(u) {
+		challenge, err := newChallenge(r.Context(), u.UserID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "login mfa challenge failed", "user_id", u.UserID, "error", err)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to start session")
+			return
+		}
+		utils.SendResponse(w, http.StatusOK, map[string]any{
+			"mfa_required": true,
+			"challenge":    challenge,
+			"enroll":       !mfa.Enabled,
+		}, "Second factor required", nil)
+		return
+	}
+
+	finishLogin(w, r, u, false, nil)
+}
 
-	// Generate refresh token (raw), store only hash in DB
-	refreshToken, err := generateRefreshToken()
+// finishLogin starts a session for u and answers with its access token
+// and any extra fields.
+func finishLogin(w http.ResponseWriter, r *http.Request, u models.User, mfa bool, extra map[string]any) {
+	accessToken, err := startSession(w, r, u, mfa)
 	if err != nil {
-		log.Printf("login: failed to generate refresh token: %v", err)
-		http.Error(w, "Error generating refresh token", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "login failed", "user_id", u.UserID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start session")
 		return
 	}
-	hashedRefresh := hashToken(refreshToken)
 
 	_, err = db.UserCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"userid": storedUser.UserID},
-		bson.M{"$set": bson.M{
-			"refresh_token":  hashedRefresh,
-			"refresh_expiry": time.Now().Add(RefreshTokenTTL),
-			"last_login":     time.Now(),
-		}},
+		r.Context(),
+		bson.M{"userid": u.UserID},
+		bson.M{"$set": bson.M{"last_login": time.Now()}},
 	)
 	if err != nil {
-		log.Printf("login: failed to store refresh token in DB for user %s: %v", storedUser.UserID, err)
-		http.Error(w, "Failed to store refresh token", http.StatusInternalServerError)
-		return
+		slog.WarnContext(r.Context(), "recording last login failed", "user_id", u.UserID, "error", err)
 	}
 
-	// Set refresh token as a secure, HttpOnly cookie. Path is "/" so refresh endpoint receives it.
-	// Secure: true for production (HTTPS). If testing locally over HTTP, set Secure false temporarily.
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/", // cookie available across your API; restrict if you need more granularity
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Expires:  time.Now().Add(RefreshTokenTTL),
-	})
-
 	// Return access token and user id; refresh token is kept in cookie only
-	utils.SendResponse(w, http.StatusOK, map[string]string{
+	data := map[string]any{
 		"token":  accessToken,
-		"userid": storedUser.UserID,
-	}, "Login successful", nil)
+		"userid": u.UserID,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.SendResponse(w, http.StatusOK, data, "Login successful", nil)
 }
 
 // ===== REGISTER =====
 func registerHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
 	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	var creds credentials
+	if json.Unmarshal(body, &user) != nil || json.Unmarshal(body, &creds) != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	user.Password = creds.Password
+	if err := validateRegistration(user); err != nil {
+		apierr.Write(w, err)
 		return
 	}
 
+	user.Email = strings.TrimSpace(user.Email)
+
 	log.Printf("Registering user: %s", user.Username)
 
 	// Check if user already exists
 	var existingUser models.User
-	err := db.UserCollection.FindOne(context.TODO(), bson.M{"username": user.Username}).Decode(&existingUser)
+	err = db.UserCollection.FindOne(context.TODO(), bson.M{"username": user.Username}).Decode(&existingUser)
 	if err == nil {
-		http.Error(w, "User already exists", http.StatusConflict)
+		apierr.Respond(w, http.StatusConflict, "User already exists")
 		return
 	} else if err != mongo.ErrNoDocuments {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
+	// Verification codes are addressed by email, so an address may only
+	// belong to one account.
+	if user.Email != "" {
+		err = db.UserCollection.FindOne(r.Context(), bson.M{"email": user.Email}).Err()
+		if err == nil {
+			apierr.Respond(w, http.StatusConflict, "Email already registered")
+			return
+		} else if err != mongo.ErrNoDocuments {
+			apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Failed to hash password: %v", err)
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to hash password")
 		return
 	}
 	user.Password = string(hashedPassword)
 	user.UserID = "u" + utils.GenerateRandomString(10)
-	user.EmailVerified = true
+	user.EmailVerified = false
 	user.Role = []string{"user"}
 
 	err = rdx.RdxSet(fmt.Sprintf("users:%s", user.UserID), user.Username)
@@ -152,10 +192,21 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = db.UserCollection.InsertOne(context.TODO(), user)
 	if err != nil {
 		log.Printf("register: failed to insert user %s: %v", user.Username, err)
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to register user")
 		return
 	}
 
+	// Accounts start unverified; send the first code right away.
+	if user.Email != "" {
+		ok, err := claimCooldown(r.Context(), cooldownPrefix+user.Email)
+		if err == nil && ok {
+			err = issueOTP(r.Context(), user.Email)
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "register verification code not sent", "user_id", user.UserID, "error", err)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{
 		"status":  http.StatusCreated,
@@ -163,157 +214,100 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ===== LOGOUT =====
-func logoutUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Missing token", http.StatusUnauthorized)
-		return
+// validateRegistration reports every invalid field at once.
+func validateRegistration(u models.User) *apierr.Error {
+	var fields []apierr.FieldError
+	if strings.TrimSpace(u.Username) == "" {
+		fields = append(fields, apierr.FieldError{Field: "username", Message: "is required"})
 	}
-
-	if len(tokenString) < 7 || tokenString[:7] != "Bearer " {
-		http.Error(w, "Invalid token format", http.StatusUnauthorized)
-		return
+	if msg := passwordProblem(u.Password, u); msg != "" {
+		fields = append(fields, apierr.FieldError{Field: "password", Message: msg})
 	}
-
-	claims := &middleware.Claims{}
-	_, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-		return globals.JwtSecret, nil
-	})
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
+	if u.Email != "" && !strings.Contains(u.Email, "@") {
+		fields = append(fields, apierr.FieldError{Field: "email", Message: "is not a valid address"})
 	}
+	if len(fields) > 0 {
+		return apierr.Validation(fields...)
+	}
+	return nil
+}
 
-	// Clear refresh token in DB
-	_, err = db.UserCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"userid": claims.UserID},
-		bson.M{"$unset": bson.M{
-			"refresh_token":  "",
-			"refresh_expiry": "",
-		}},
-	)
+// ===== LOGOUT =====
+// Ends the caller's current session and its refresh tokens.
+func logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	sessionID, _ := ctx.Value(globals.SessionIDKey).(string)
+
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := sessions.Revoke(ctx, userID, sessionID); err != nil && !errors.Is(err, sessions.ErrNotFound) {
+			return err
+		}
+		return mq.Emit(ctx, "user-loggedout", models.Index{})
+	})
 	if err != nil {
-		log.Printf("logout: failed to clear refresh token for user %s: %v", claims.UserID, err)
-		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "logout revoke failed", "user_id", userID, "session_id", sessionID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to log out")
 		return
 	}
 
-	// Remove any cached access token from Redis (optional)
-	_, _ = rdx.RdxHdel("tokki", claims.UserID)
-
-	// Clear refresh token cookie client-side by setting an expired cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-	})
-
-	m := models.Index{}
-	mq.Emit(ctx, "user-loggedout", m)
+	// Revoking the session also ends its refresh token family; drop the
+	// cookie client-side too.
+	clearRefreshCookie(w)
 
 	utils.SendResponse(w, http.StatusOK, nil, "User logged out successfully", nil)
 }
 
 // ===== REFRESH TOKEN =====
-// This endpoint reads the refresh token from the HttpOnly cookie, verifies it (by comparing hashed value in DB),
-// rotates the refresh token and sets the new cookie, and returns a new short-lived access token.
+// Exchanges the refresh token cookie for a new access token and the next
+// refresh token of the same session. Presenting a token that was already
+// rotated revokes the session, since one of the two holders stole it.
 func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh_token")
-	if err != nil {
-		http.Error(w, "Missing refresh token", http.StatusUnauthorized)
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil || cookie.Value == "" {
+		apierr.Respond(w, http.StatusUnauthorized, "Missing refresh token")
 		return
 	}
-	refreshToken := cookie.Value
 
-	if refreshToken == "" {
-		http.Error(w, "Missing refresh token", http.StatusUnauthorized)
+	sess, refreshToken, err := sessions.Rotate(r.Context(), cookie.Value, RefreshTokenTTL)
+	switch {
+	case errors.Is(err, sessions.ErrRefreshReused):
+		clearRefreshCookie(w)
+		apierr.Respond(w, http.StatusUnauthorized, "Refresh token reuse detected; please log in again")
 		return
-	}
-
-	// Find user by hashed refresh token
-	hashed := hashToken(refreshToken)
-	var storedUser models.User
-	err = db.UserCollection.FindOne(
-		context.TODO(),
-		bson.M{"refresh_token": hashed},
-	).Decode(&storedUser)
-	if err != nil {
-		// Do not reveal whether token missing or DB error
-		log.Printf("refresh: refresh token lookup failed: %v", err)
-		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+	case errors.Is(err, sessions.ErrRefreshInvalid):
+		clearRefreshCookie(w)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
-	}
-
-	// Check expiry
-	if time.Now().After(storedUser.RefreshExpiry) {
-		// Clear DB stale refresh token
-		_, _ = db.UserCollection.UpdateOne(context.TODO(), bson.M{"userid": storedUser.UserID}, bson.M{"$unset": bson.M{
-			"refresh_token":  "",
-			"refresh_expiry": "",
-		}})
-		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+	case err != nil:
+		slog.ErrorContext(r.Context(), "refresh rotation failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to refresh token")
 		return
 	}
 
-	// New access token
-	claims := &middleware.Claims{
-		Username: storedUser.Username,
-		UserID:   storedUser.UserID,
-		Role:     storedUser.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	newAccess := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := newAccess.SignedString(globals.JwtSecret)
-	if err != nil {
-		log.Printf("refresh: failed to sign new access token for user %s: %v", storedUser.UserID, err)
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+	var storedUser models.User
+	if err := db.UserCollection.FindOne(r.Context(), bson.M{"userid": sess.UserID}).Decode(&storedUser); err != nil {
+		slog.ErrorContext(r.Context(), "refresh user lookup failed", "user_id", sess.UserID, "error", err)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
 	}
-
-	// Rotate refresh token (single-use)
-	newRefresh, err := generateRefreshToken()
-	if err != nil {
-		log.Printf("refresh: failed to generate new refresh token for user %s: %v", storedUser.UserID, err)
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+	// A role that now requires MFA ends sessions that logged in without.
+	if !sess.MFA && mfaRequired(storedUser) {
+		if err := sessions.Revoke(r.Context(), sess.UserID, sess.ID); err != nil {
+			slog.ErrorContext(r.Context(), "refresh revoke without mfa failed", "session_id", sess.ID, "error", err)
+		}
+		clearRefreshCookie(w)
+		apierr.Write(w, apierr.New(http.StatusUnauthorized, apierr.CodeMFARequired, "Two-factor authentication is required; please log in again"))
 		return
 	}
-	hashedNewRefresh := hashToken(newRefresh)
-
-	_, err = db.UserCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"userid": storedUser.UserID},
-		bson.M{"$set": bson.M{
-			"refresh_token":  hashedNewRefresh,
-			"refresh_expiry": time.Now().Add(RefreshTokenTTL),
-		}},
-	)
+	accessToken, err := issueAccessToken(storedUser, sess)
 	if err != nil {
-		log.Printf("refresh: failed to update refresh token in DB for user %s: %v", storedUser.UserID, err)
-		http.Error(w, "Failed to update refresh token", http.StatusInternalServerError)
+		log.Printf("refresh: failed to sign new access token for user %s: %v", storedUser.UserID, err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to generate access token")
 		return
 	}
 
-	// Set rotated refresh token cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    newRefresh,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Expires:  time.Now().Add(RefreshTokenTTL),
-	})
+	setRefreshCookie(w, refreshToken, sess.ExpiresAt)
 
 	utils.SendResponse(w, http.StatusOK, map[string]string{
 		"token":  accessToken,
@@ -322,17 +316,44 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // ===== HELPERS =====
-func generateRefreshToken() (string, error) {
-	tokenBytes := make([]byte, 32)
-	_, err := rand.Read(tokenBytes)
+
+// startSession begins a new session for u: it sets the refresh token
+// cookie and returns the access token. Each login is its own session
+// with its own refresh token family; mfa records a passed second factor.
+func startSession(w http.ResponseWriter, r *http.Request, u models.User, mfa bool) (string, error) {
+	sess, err := sessions.Start(r.Context(), u.UserID, r, RefreshTokenTTL, mfa)
+	if err != nil {
+		return "", fmt.Errorf("start session: %w", err)
+	}
+	accessToken, err := issueAccessToken(u, sess)
+	if err != nil {
+		return "", fmt.Errorf("sign access token: %w", err)
+	}
+	refreshToken, err := sessions.IssueRefresh(r.Context(), sess)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("issue refresh token: %w", err)
 	}
-	return hex.EncodeToString(tokenBytes), nil
+	setRefreshCookie(w, refreshToken, sess.ExpiresAt)
+	return accessToken, nil
 }
 
-func hashToken(token string) string {
-	hash := sha256.New()
-	hash.Write([]byte(token))
-	return hex.EncodeToString(hash.Sum(nil))
+// issueAccessToken signs an access token for u in session s.
+func issueAccessToken(u models.User, s *sessions.Session) (string, error) {
+	now := time.Now()
+	claims := &middleware.Claims{
+		Username:      u.Username,
+		UserID:        u.UserID,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerified,
+		MFA:           s.MFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        s.ID,
+			Subject:   u.UserID,
+			Issuer:    tokenConfig.Issuer,
+			Audience:  jwt.ClaimStrings{tokenConfig.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return jwtkeys.Sign(claims)
 }
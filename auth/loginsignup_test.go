@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/globals"
+	"naevis/jwtkeys"
+	"naevis/middleware"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useMemStores points db and rdx at fresh in-memory backends.
+func useMemStores(t *testing.T) {
+	t.Helper()
+	db.Use(memdb.NewStore())
+	client := memredis.NewClient()
+	rdx.Use(client)
+	t.Cleanup(func() { client.Close() })
+	globals.JwtSecret = []byte("test-secret")
+	keys, err := jwtkeys.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtkeys.Use(keys)
+}
+
+func post(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	useMemStores(t)
+
+	creds := `{"username":"ann","password":"correct horse","email":"ann@example.com"}`
+	if rec := post(registerHandler, creds); rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	if rec := post(registerHandler, creds); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate register = %d, want 409", rec.Code)
+	}
+
+	if rec := post(loginHandler, `{"username":"ann","password":"wrong password"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with wrong password = %d, want 401", rec.Code)
+	}
+	rec := post(loginHandler, creds)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login = %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Data["token"] == "" {
+		t.Fatalf("login response = %+v, %v", resp, err)
+	}
+	if len(rec.Result().Cookies()) == 0 {
+		t.Error("login set no refresh cookie")
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	useMemStores(t)
+
+	rec := post(registerHandler, `{"username":"","password":"short"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid register = %d, want 422", rec.Code)
+	}
+}
+
+func TestAccessTokenChecks(t *testing.T) {
+	useMemStores(t)
+	token := login(t, "ann")
+	if _, err := middleware.ValidateJWT("Bearer " + token); err != nil {
+		t.Fatalf("issued token refused: %v", err)
+	}
+
+	var claims middleware.Claims
+	if _, err := jwt.ParseWithClaims(token, &claims, jwtkeys.Keyfunc); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != tokenConfig.Issuer || len(claims.Audience) != 1 || claims.Audience[0] != tokenConfig.Audience {
+		t.Errorf("iss = %q, aud = %v", claims.Issuer, claims.Audience)
+	}
+
+	resign := func(edit func(c *middleware.Claims)) string {
+		c := claims
+		edit(&c)
+		s, err := jwtkeys.Sign(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims).SignedString(globals.JwtSecret)
+	for name, bad := range map[string]string{
+		"other audience": resign(func(c *middleware.Claims) { c.Audience = jwt.ClaimStrings{"elsewhere"} }),
+		"other issuer":   resign(func(c *middleware.Claims) { c.Issuer = "https://evil.example" }),
+		"no expiry":      resign(func(c *middleware.Claims) { c.ExpiresAt = nil }),
+		"HS256":          hs256,
+	} {
+		if _, err := middleware.ValidateJWT("Bearer " + bad); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
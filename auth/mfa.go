@@ -0,0 +1,529 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/config"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/models"
+	"naevis/rdx"
+	"naevis/totp"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/redis/go-redis/v9"
+	"github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mfaRecord is a user's second factor. It lives apart from the user
+// document so the secret never travels with profile reads.
+type mfaRecord struct {
+	UserID    string     `bson:"_id"`
+	Enabled   bool       `bson:"enabled"`
+	Secret    string     `bson:"secret,omitempty"`
+	Pending   string     `bson:"pending,omitempty"`  // secret awaiting its first code
+	LastStep  int64      `bson:"last_step"`          // newest TOTP step used, against replays
+	Recovery  []string   `bson:"recovery,omitempty"` // hashes of unused recovery codes
+	EnabledAt *time.Time `bson:"enabled_at,omitempty"`
+}
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts codes one step either side for clock drift.
+	totpSkew = 1
+
+	challengePrefix   = "mfa:challenge:"
+	challengeTTL      = 5 * time.Minute
+	challengeAttempts = 5
+)
+
+// mfaConfig holds the MFA settings; set by Configure.
+var mfaConfig = config.MFA{Issuer: "Naevis", RequiredRoles: []string{"admin", "moderator"}}
+
+// mfaRequired reports whether a role of u must log in with MFA.
+func mfaRequired(u models.User) bool {
+	for _, role := range u.Role {
+		for _, required := range mfaConfig.RequiredRoles {
+			if role == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadMFA returns the MFA record of userID, empty if there is none.
+func loadMFA(ctx context.Context, userID string) (*mfaRecord, error) {
+	rec := &mfaRecord{UserID: userID}
+	err := db.MFACollection.FindOne(ctx, bson.M{"_id": userID}).Decode(rec)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ===== LOGIN CHALLENGE =====
+
+// newChallenge records that userID passed the password step and returns
+// the token that the second step presents.
+func newChallenge(ctx context.Context, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	key := challengePrefix + hashToken(token)
+	pipe := rdx.Conn.TxPipeline()
+	pipe.HSet(ctx, key, "userid", userID, "attempts", 0)
+	pipe.Expire(ctx, key, challengeTTL)
+	_, err := pipe.Exec(ctx)
+	return token, err
+}
+
+// EnrollChallengeHandler starts TOTP enrollment during login for a user
+// whose role requires MFA but who has none yet. The secret stays with
+// the challenge until a code from it completes the login.
+func EnrollChallengeHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	key := challengePrefix + hashToken(input.Challenge)
+	userID, err := rdx.Conn.HGet(ctx, key, "userid").Result()
+	if errors.Is(err, redis.Nil) {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa enroll challenge read failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	u, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	if rec.Enabled {
+		apierr.Respond(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err == nil {
+		err = rdx.Conn.HSet(ctx, key, "pending", secret).Err()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa enroll failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+	respondProvisioning(w, r, u, secret)
+}
+
+// VerifyChallengeHandler completes a login with a TOTP code or a
+// recovery code. During enrollment the code must come from the secret
+// handed out by EnrollChallengeHandler, and the response carries the new
+// recovery codes.
+func VerifyChallengeHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	key := challengePrefix + hashToken(input.Challenge)
+
+	// Count the attempt first, as VerifyOTPHandler does.
+	attempts, err := rdx.Conn.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa verify attempt count failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	fields, err := rdx.Conn.HGetAll(ctx, key).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa verify challenge read failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	userID := fields["userid"]
+	if userID == "" || attempts > challengeAttempts {
+		rdx.Conn.Del(ctx, key)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired challenge; please log in again")
+		return
+	}
+
+	u, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	var extra map[string]any
+	if rec.Enabled {
+		ok, err = checkSecondFactor(ctx, rec, input.Code, input.RecoveryCode)
+	} else {
+		var codes []string
+		codes, ok, err = enableTOTP(ctx, userID, fields["pending"], input.Code)
+		extra = map[string]any{"recovery_codes": codes}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa verify failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if !ok {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	// Only the request that deletes the challenge may use it.
+	if n, err := rdx.Conn.Del(ctx, key).Result(); err != nil || n == 0 {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired challenge; please log in again")
+		return
+	}
+	finishLogin(w, r, u, true, extra)
+}
+
+// ===== MANAGEMENT =====
+
+// MFAStatus reports the caller's MFA state.
+func MFAStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	u, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"enabled":             rec.Enabled,
+		"required":            mfaRequired(u),
+		"recovery_codes_left": len(rec.Recovery),
+	})
+}
+
+// SetupTOTP issues a new TOTP secret for the caller. It takes effect once
+// EnableTOTP sees a code from it.
+func SetupTOTP(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	u, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	if rec.Enabled {
+		apierr.Respond(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err == nil {
+		_, err = db.MFACollection.UpdateOne(ctx,
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"pending": secret, "enabled": false}},
+			options.Update().SetUpsert(true),
+		)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa setup failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start setup")
+		return
+	}
+	respondProvisioning(w, r, u, secret)
+}
+
+// EnableTOTP turns MFA on with a code from the secret of SetupTOTP and
+// returns the recovery codes, which are never shown again.
+func EnableTOTP(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	_, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	if rec.Enabled {
+		apierr.Respond(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if rec.Pending == "" {
+		apierr.Respond(w, http.StatusConflict, "Start setup first")
+		return
+	}
+
+	codes, ok, err := enableTOTP(ctx, userID, rec.Pending, input.Code)
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa enable failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+	if !ok {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "code", Message: "is incorrect"}))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+// DisableMFA turns MFA off after checking the password and a second
+// factor. Users whose role requires MFA cannot turn it off.
+func DisableMFA(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	u, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	if !rec.Enabled {
+		apierr.Respond(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	if mfaRequired(u) {
+		apierr.Respond(w, http.StatusForbidden, "Your role requires two-factor authentication")
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.Password)) != nil {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "password", Message: "is incorrect"}))
+		return
+	}
+	if !verifySecondFactor(w, r, rec, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	if _, err := db.MFACollection.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		slog.ErrorContext(ctx, "mfa disable failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after
+// checking a second factor.
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	_, rec, ok := loadUserMFA(w, r, userID)
+	if !ok {
+		return
+	}
+	if !rec.Enabled {
+		apierr.Respond(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	if !verifySecondFactor(w, r, rec, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		_, err = db.MFACollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"recovery": hashes}})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mfa recovery codes failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create recovery codes")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+// ===== HELPERS =====
+
+// loadUserMFA loads userID and its MFA record, answering the request
+// itself when that fails.
+func loadUserMFA(w http.ResponseWriter, r *http.Request, userID string) (models.User, *mfaRecord, bool) {
+	var u models.User
+	err := db.UserCollection.FindOne(r.Context(), bson.M{"userid": userID}).Decode(&u)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusUnauthorized, "Unknown user")
+		return u, nil, false
+	}
+	var rec *mfaRecord
+	if err == nil {
+		rec, err = loadMFA(r.Context(), userID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "mfa user lookup failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
+		return u, nil, false
+	}
+	return u, rec, true
+}
+
+// verifySecondFactor is checkSecondFactor for the management endpoints:
+// it answers the request itself unless the factor is good.
+func verifySecondFactor(w http.ResponseWriter, r *http.Request, rec *mfaRecord, code, recovery string) bool {
+	ok, err := checkSecondFactor(r.Context(), rec, code, recovery)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "second factor check failed", "user_id", rec.UserID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return false
+	}
+	if !ok {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "code", Message: "is incorrect"}))
+	}
+	return ok
+}
+
+// checkSecondFactor accepts a current TOTP code that is newer than the
+// last one used, or spends an unused recovery code.
+func checkSecondFactor(ctx context.Context, rec *mfaRecord, code, recovery string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(rec.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+		res, err := db.MFACollection.UpdateOne(ctx,
+			bson.M{"_id": rec.UserID, "last_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"last_step": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.MatchedCount == 1, nil
+	}
+	if recovery == "" {
+		return false, nil
+	}
+
+	hash := hashRecoveryCode(recovery)
+	res, err := db.MFACollection.UpdateOne(ctx,
+		bson.M{"_id": rec.UserID, "recovery": hash},
+		bson.M{"$pull": bson.M{"recovery": hash}},
+	)
+	if err != nil || res.MatchedCount == 0 {
+		return false, err
+	}
+	if left := len(rec.Recovery) - 1; left <= 2 {
+		slog.InfoContext(ctx, "recovery codes running low", "user_id", rec.UserID, "codes_left", left)
+	}
+	return true, nil
+}
+
+// enableTOTP turns MFA on for userID with secret if code matches it, and
+// returns fresh recovery codes.
+func enableTOTP(ctx context.Context, userID, secret, code string) ([]string, bool, error) {
+	if secret == "" {
+		return nil, false, nil
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, false, nil
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now().UTC()
+	_, err = db.MFACollection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{
+				"enabled":    true,
+				"secret":     secret,
+				"last_step":  step,
+				"recovery":   hashes,
+				"enabled_at": now,
+			},
+			"$unset": bson.M{"pending": ""},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// recoveryEncoding spells recovery codes without padding, in lower case
+// when shown.
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns recovery codes like "abcde-fghij" and the
+// hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, which people add or
+// drop when typing codes back in.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// respondProvisioning sends secret as a provisioning URI and its QR code.
+func respondProvisioning(w http.ResponseWriter, r *http.Request, u models.User, secret string) {
+	account := u.Email
+	if account == "" {
+		account = u.Username
+	}
+	uri := totp.URI(mfaConfig.Issuer, account, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rendering mfa qr code failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to render QR code")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"secret": secret,
+		"uri":    uri,
+		"qr":     fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(png)),
+	})
+}
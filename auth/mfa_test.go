@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"naevis/db"
+	"naevis/middleware"
+	"naevis/models"
+	"naevis/sessions"
+	"naevis/totp"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// decodeData returns the body of rec, unwrapping the "data" envelope of
+// utils.SendResponse when there is one.
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if data, ok := body["data"].(map[string]any); ok {
+		return data
+	}
+	return body
+}
+
+func callBody(h httprouter.Handle, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	middleware.Authenticate(h)(rec, req, nil)
+	return rec
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPEnrollmentAndLogin(t *testing.T) {
+	useMemStores(t)
+	token := login(t, "ann")
+
+	setup := decodeData(t, callBody(SetupTOTP, token, ""))
+	secret, _ := setup["secret"].(string)
+	if secret == "" || !strings.HasPrefix(setup["qr"].(string), "data:image/png;base64,") {
+		t.Fatalf("setup = %v", setup)
+	}
+	if rec := callBody(EnableTOTP, token, `{"code":"abcdef"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("enable with wrong code = %d, want 422", rec.Code)
+	}
+	rec := callBody(EnableTOTP, token, `{"code":"`+currentCode(t, secret, 0)+`"}`)
+	codes, _ := decodeData(t, rec)["recovery_codes"].([]any)
+	if rec.Code != http.StatusOK || len(codes) != recoveryCodeCount {
+		t.Fatalf("enable = %d %s", rec.Code, rec.Body)
+	}
+
+	challenge := func() string {
+		rec := post(loginHandler, `{"username":"ann","password":"correct horse"}`)
+		data := decodeData(t, rec)
+		if data["mfa_required"] != true || data["token"] != nil {
+			t.Fatalf("login with MFA = %d %v", rec.Code, data)
+		}
+		return data["challenge"].(string)
+	}
+
+	// The code that enabled MFA cannot be replayed to log in.
+	c := challenge()
+	if rec := postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","code":"`+currentCode(t, secret, 0)+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code = %d, want 401", rec.Code)
+	}
+	if rec := postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","code":"`+currentCode(t, secret, 1)+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("next code = %d %s", rec.Code, rec.Body)
+	}
+	if rec := postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","code":"`+currentCode(t, secret, 1)+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("spent challenge = %d, want 401", rec.Code)
+	}
+
+	recovery := strings.ToUpper(codes[0].(string))
+	rec = postParams(VerifyChallengeHandler, `{"challenge":"`+challenge()+`","recovery_code":"`+recovery+`"}`)
+	if rec.Code != http.StatusOK || decodeData(t, rec)["token"] == nil {
+		t.Fatalf("recovery code = %d %s", rec.Code, rec.Body)
+	}
+	if rec := postParams(VerifyChallengeHandler, `{"challenge":"`+challenge()+`","recovery_code":"`+recovery+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("spent recovery code = %d, want 401", rec.Code)
+	}
+
+	// Guessing burns the challenge.
+	c = challenge()
+	for i := 0; i < challengeAttempts; i++ {
+		postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","code":"12345"}`)
+	}
+	if rec := postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","recovery_code":"`+codes[1].(string)+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("challenge after too many guesses = %d, want 401", rec.Code)
+	}
+}
+
+func TestMFARequiredForRole(t *testing.T) {
+	useMemStores(t)
+	post(registerHandler, `{"username":"root","password":"correct horse"}`)
+	if _, err := db.UserCollection.UpdateOne(context.Background(),
+		bson.M{"username": "root"}, bson.M{"$set": bson.M{"role": []string{"user", "admin"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	adminOnly := middleware.RequireRoles("admin")(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	var u models.User
+	db.UserCollection.FindOne(context.Background(), bson.M{"username": "root"}).Decode(&u)
+	noMFA, _ := issueAccessToken(u, &sessions.Session{ID: "s-no-mfa"})
+	if rec := call(adminOnly, http.MethodGet, noMFA, nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "mfa_required") {
+		t.Errorf("admin without MFA = %d %s", rec.Code, rec.Body)
+	}
+
+	// The admin has no second factor yet, so login makes them enroll.
+	data := decodeData(t, post(loginHandler, `{"username":"root","password":"correct horse"}`))
+	if data["mfa_required"] != true || data["enroll"] != true {
+		t.Fatalf("admin login = %v", data)
+	}
+	c := data["challenge"].(string)
+	setup := decodeData(t, postParams(EnrollChallengeHandler, `{"challenge":"`+c+`"}`))
+	secret, _ := setup["secret"].(string)
+	rec := postParams(VerifyChallengeHandler, `{"challenge":"`+c+`","code":"`+currentCode(t, secret, 0)+`"}`)
+	data = decodeData(t, rec)
+	if rec.Code != http.StatusOK || len(data["recovery_codes"].([]any)) != recoveryCodeCount {
+		t.Fatalf("enroll at login = %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(adminOnly, http.MethodGet, data["token"].(string), nil); rec.Code != http.StatusNoContent {
+		t.Errorf("admin with MFA = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := callBody(DisableMFA, data["token"].(string), `{"password":"correct horse","code":"`+currentCode(t, secret, 1)+`"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("disable for admin = %d, want 403", rec.Code)
+	}
+}
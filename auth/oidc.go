@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/config"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/models"
+	"naevis/oidc"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// identity links a user to their account at an OpenID provider.
+type identity struct {
+	ID        string    `json:"-" bson:"_id"` // provider:subject
+	Provider  string    `json:"provider" bson:"provider"`
+	Subject   string    `json:"-" bson:"subject"`
+	UserID    string    `json:"-" bson:"userid"`
+	Email     string    `json:"email,omitempty" bson:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// oidcState is what a login remembers between sending the user to the
+// provider and the callback. The state value itself is the Redis key
+// and is also bound to the browser by a cookie.
+type oidcState struct {
+	Provider   string `json:"provider"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserID string `json:"link_userid,omitempty"` // set when linking, not logging in
+}
+
+const (
+	oidcStatePrefix = "oidc:state:"
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+)
+
+var (
+	// oidcProviders are the configured providers by name; set by
+	// Configure.
+	oidcProviders = map[string]*oidc.Provider{}
+
+	errEmailTaken    = errors.New("email belongs to another account")
+	errAlreadyLinked = errors.New("identity already linked")
+)
+
+func configureOIDC(cfg *config.Config) {
+	oidcProviders = map[string]*oidc.Provider{}
+	for name, p := range cfg.OIDC {
+		oidcProviders[name] = oidc.New(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil)
+	}
+}
+
+// OIDCStart begins a login through the provider named in the path. It
+// answers with the URL to send the browser to.
+func OIDCStart(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	startOIDC(w, r, ps.ByName("provider"), "")
+}
+
+// OIDCLinkStart is OIDCStart for linking the provider account to the
+// caller's account instead of logging in.
+func OIDCLinkStart(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	startOIDC(w, r, ps.ByName("provider"), userID)
+}
+
+func startOIDC(w http.ResponseWriter, r *http.Request, name, linkUserID string) {
+	p, ok := oidcProviders[name]
+	if !ok {
+		apierr.Respond(w, http.StatusNotFound, "Unknown provider")
+		return
+	}
+	ctx := r.Context()
+
+	var st oidcState
+	state, err := oidc.RandomString()
+	if err == nil {
+		st.Nonce, err = oidc.RandomString()
+	}
+	if err == nil {
+		st.Verifier, err = oidc.RandomString()
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	st.Provider = name
+	st.LinkUserID = linkUserID
+
+	authURL, err := p.AuthCodeURL(ctx, state, st.Nonce, st.Verifier)
+	if err != nil {
+		slog.ErrorContext(ctx, "oidc provider unavailable", "provider", name, "error", err)
+		apierr.Respond(w, http.StatusBadGateway, "Provider unavailable")
+		return
+	}
+	data, _ := json.Marshal(st)
+	if err := rdx.Conn.Set(ctx, oidcStatePrefix+state, data, oidcStateTTL).Err(); err != nil {
+		slog.ErrorContext(ctx, "oidc state store failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		Domain:   cookieConfig.Domain,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cookieConfig.Secure,
+		SameSite: sameSite(),
+	})
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"url": authURL})
+}
+
+// OIDCCallback finishes a login or link with the code and state the
+// provider sent the browser back with. A login answers like the
+// password login, including any MFA challenge.
+func OIDCCallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" || input.State == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	ctx := r.Context()
+	name := ps.ByName("provider")
+
+	// The state must be the one this browser started, and is spent here.
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value != input.State {
+		apierr.Respond(w, http.StatusUnauthorized, "Login state does not match; please start again")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, Domain: cookieConfig.Domain, MaxAge: -1})
+	st, err := takeOIDCState(ctx, input.State)
+	if err != nil || st.Provider != name {
+		apierr.Respond(w, http.StatusUnauthorized, "Login expired; please start again")
+		return
+	}
+
+	id, err := oidcProviders[name].Exchange(ctx, input.Code, st.Verifier, st.Nonce)
+	if err != nil {
+		slog.WarnContext(ctx, "oidc login failed", "provider", name, "error", err)
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			apierr.Respond(w, http.StatusUnauthorized, "The provider's answer could not be verified")
+			return
+		}
+		apierr.Respond(w, http.StatusBadGateway, "Provider login failed")
+		return
+	}
+
+	if st.LinkUserID != "" {
+		err := linkIdentity(ctx, name, id, st.LinkUserID)
+		if errors.Is(err, errAlreadyLinked) {
+			apierr.Respond(w, http.StatusConflict, "This account is already linked")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "oidc identity link failed", "provider", name, "user_id", st.LinkUserID, "error", err)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to link account")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]string{"linked": name})
+		return
+	}
+
+	u, err := oidcUser(ctx, name, id)
+	if errors.Is(err, errEmailTaken) {
+		apierr.Respond(w, http.StatusConflict, "An account with this email exists; log in to it and link this provider from your settings")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "oidc identity resolve failed", "provider", name, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	beginLogin(w, r, u)
+}
+
+// takeOIDCState returns and deletes the login state saved under state.
+// Only the caller that deletes it may use it.
+func takeOIDCState(ctx context.Context, state string) (*oidcState, error) {
+	key := oidcStatePrefix + state
+	data, err := rdx.Conn.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if n, err := rdx.Conn.Del(ctx, key).Result(); err != nil || n == 0 {
+		return nil, redis.Nil
+	}
+	var st oidcState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// oidcUser returns the user behind a provider identity. Known identities
+// map to their user. A new one is linked to the account with the same
+// email only if both the provider and this server have verified that
+// address; otherwise a new account is created.
+func oidcUser(ctx context.Context, provider string, id *oidc.Identity) (models.User, error) {
+	var u models.User
+	var link identity
+	err := db.IdentitiesCollection.FindOne(ctx, bson.M{"_id": provider + ":" + id.Subject}).Decode(&link)
+	if err == nil {
+		err = db.UserCollection.FindOne(ctx, bson.M{"userid": link.UserID}).Decode(&u)
+		return u, err
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return u, err
+	}
+
+	if id.Email != "" {
+		err := db.UserCollection.FindOne(ctx, bson.M{"email": id.Email}).Decode(&u)
+		if err == nil {
+			if !id.EmailVerified || !u.EmailVerified {
+				return u, errEmailTaken
+			}
+			return u, linkIdentity(ctx, provider, id, u.UserID)
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return u, err
+		}
+	}
+
+	username, err := uniqueUsername(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	now := time.Now().UTC()
+	u = models.User{
+		UserID:        "u" + utils.GenerateRandomString(10),
+		Username:      username,
+		Email:         id.Email,
+		Name:          id.Name,
+		EmailVerified: id.EmailVerified && id.Email != "",
+		Role:          []string{"user"},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := db.UserCollection.InsertOne(ctx, u); err != nil {
+		return u, err
+	}
+	if err := rdx.RdxSet("users:"+u.UserID, u.Username); err != nil {
+		slog.WarnContext(ctx, "caching username failed", "user_id", u.UserID, "error", err)
+	}
+	if err := linkIdentity(ctx, provider, id, u.UserID); err != nil {
+		// A concurrent callback for the same identity won; use its user.
+		db.UserCollection.DeleteOne(ctx, bson.M{"userid": u.UserID})
+		if errors.Is(err, errAlreadyLinked) {
+			return oidcUser(ctx, provider, id)
+		}
+		return u, err
+	}
+	slog.InfoContext(ctx, "oidc user created", "user_id", u.UserID, "provider", provider)
+	return u, nil
+}
+
+// linkIdentity links id at provider to userID. A user links at most one
+// account per provider, and an account links to one user.
+func linkIdentity(ctx context.Context, provider string, id *oidc.Identity, userID string) error {
+	_, err := db.IdentitiesCollection.InsertOne(ctx, identity{
+		ID:        provider + ":" + id.Subject,
+		Provider:  provider,
+		Subject:   id.Subject,
+		UserID:    userID,
+		Email:     id.Email,
+		CreatedAt: time.Now().UTC(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return errAlreadyLinked
+	}
+	return err
+}
+
+// uniqueUsername derives a free username from what the provider knows,
+// adding digits when the plain form is taken.
+func uniqueUsername(ctx context.Context, id *oidc.Identity) (string, error) {
+	local, _, _ := strings.Cut(id.Email, "@")
+	base := "user"
+	for _, c := range []string{id.PreferredUsername, local, id.Name} {
+		if s := usernameFrom(c); len(s) >= 3 {
+			base = s
+			break
+		}
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		err := db.UserCollection.FindOne(ctx, bson.M{"username": candidate}).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = base + utils.GenerateRandomString(4)
+	}
+	return base + utils.GenerateRandomString(10), nil
+}
+
+// usernameFrom keeps the lower-cased letters, digits, dots and
+// underscores of s, up to 20 of them.
+func usernameFrom(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if b.Len() == 20 {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.':
+			b.WriteRune(r)
+		case r == ' ' || r == '-':
+			b.WriteByte('_')
+		}
+	}
+	return strings.Trim(b.String(), "._")
+}
+
+// ListIdentities lists the provider accounts linked to the caller.
+func ListIdentities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	cur, err := db.IdentitiesCollection.Find(ctx, bson.M{"userid": userID})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to list identities")
+		return
+	}
+	list := []identity{}
+	if err := cur.All(ctx, &list); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to list identities")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"identities": list})
+}
+
+// UnlinkIdentity removes the caller's link to a provider, unless it is
+// their only way to log in.
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	provider := ps.ByName("provider")
+
+	var u models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&u); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to unlink")
+		return
+	}
+	others, err := db.IdentitiesCollection.CountDocuments(ctx, bson.M{"userid": userID, "provider": bson.M{"$ne": provider}})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to unlink")
+		return
+	}
+	if u.Password == "" && others == 0 {
+		apierr.Respond(w, http.StatusConflict, "Set a password before unlinking your only way to log in")
+		return
+	}
+
+	res, err := db.IdentitiesCollection.DeleteOne(ctx, bson.M{"userid": userID, "provider": provider})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to unlink")
+		return
+	}
+	if res.DeletedCount == 0 {
+		apierr.Respond(w, http.StatusNotFound, "No linked account for this provider")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"naevis/middleware"
+	"naevis/oidc"
+	"naevis/oidc/oidctest"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// useOIDCProvider registers a test provider as "test" and returns it.
+func useOIDCProvider(t *testing.T) *oidctest.Server {
+	t.Helper()
+	srv := oidctest.NewServer("naevis", "s3cret")
+	t.Cleanup(srv.Close)
+	old := oidcProviders
+	oidcProviders = map[string]*oidc.Provider{"test": oidc.New(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     "naevis",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://app.test/auth/callback/test",
+	}, srv.Client())}
+	t.Cleanup(func() { oidcProviders = old })
+	return srv
+}
+
+// oidcLogin runs the browser's part of a provider login as u: start,
+// sign in at the provider, then the callback. token links instead of
+// logging in when set.
+func oidcLogin(t *testing.T, srv *oidctest.Server, u oidctest.User, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	ps := httprouter.Params{{Key: "provider", Value: "test"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	rec := httptest.NewRecorder()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		middleware.Authenticate(OIDCLinkStart)(rec, req, ps)
+	} else {
+		OIDCStart(rec, req, ps)
+	}
+	authURL, _ := decodeData(t, rec)["url"].(string)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("start = %d %s", rec.Code, rec.Body)
+	}
+
+	code, state, err := srv.Authorize(authURL, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"code":"`+code+`","state":"`+state+`"}`))
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	OIDCCallback(rec, req, ps)
+	return rec
+}
+
+func TestOIDCLogin(t *testing.T) {
+	useMemStores(t)
+	srv := useOIDCProvider(t)
+	alice := oidctest.User{Subject: "1001", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "Alice"}
+
+	rec := oidcLogin(t, srv, alice, "")
+	first := decodeData(t, rec)
+	if rec.Code != http.StatusOK || first["token"] == nil || first["userid"] == nil {
+		t.Fatalf("first login = %d %s", rec.Code, rec.Body)
+	}
+
+	// The same identity logs in to the same account.
+	rec = oidcLogin(t, srv, alice, "")
+	if again := decodeData(t, rec); again["userid"] != first["userid"] {
+		t.Errorf("second login = %d %v, want user %v", rec.Code, again, first["userid"])
+	}
+
+	// The account's only way in cannot be unlinked.
+	token := first["token"].(string)
+	ps := httprouter.Params{{Key: "provider", Value: "test"}}
+	if rec := call(UnlinkIdentity, http.MethodDelete, token, ps); rec.Code != http.StatusConflict {
+		t.Errorf("unlink only identity = %d, want 409", rec.Code)
+	}
+}
+
+func TestOIDCRejectsReplayedState(t *testing.T) {
+	useMemStores(t)
+	srv := useOIDCProvider(t)
+	ps := httprouter.Params{{Key: "provider", Value: "test"}}
+
+	rec := httptest.NewRecorder()
+	OIDCStart(rec, httptest.NewRequest(http.MethodPost, "/", nil), ps)
+	cookie := rec.Result().Cookies()[0]
+	code, state, err := srv.Authorize(decodeData(t, rec)["url"].(string), oidctest.User{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"code":"`+code+`","state":"`+state+`"}`))
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		OIDCCallback(rec, req, ps)
+		return rec.Code
+	}
+	if got := callback(&http.Cookie{Name: oidcStateCookie, Value: "other"}); got != http.StatusUnauthorized {
+		t.Errorf("callback from another browser = %d, want 401", got)
+	}
+	if got := callback(cookie); got != http.StatusOK {
+		t.Fatalf("callback = %d", got)
+	}
+	if got := callback(cookie); got != http.StatusUnauthorized {
+		t.Errorf("replayed callback = %d, want 401", got)
+	}
+}
+
+func TestOIDCEmailCollisionAndLinking(t *testing.T) {
+	useMemStores(t)
+	srv := useOIDCProvider(t)
+	token := login(t, "ann")
+
+	// Ann's email is not verified here, so a provider account with the
+	// same address is not trusted to be hers.
+	post(registerHandler, `{"username":"bob","password":"correct horse","email":"bob@example.com"}`)
+	bob := oidctest.User{Subject: "2002", Email: "bob@example.com", EmailVerified: true}
+	if rec := oidcLogin(t, srv, bob, ""); rec.Code != http.StatusConflict {
+		t.Errorf("login with taken email = %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	// Signed in, Ann can link any provider account explicitly.
+	ann := oidctest.User{Subject: "3003", Email: "ann@elsewhere.example"}
+	if rec := oidcLogin(t, srv, ann, token); rec.Code != http.StatusOK {
+		t.Fatalf("link = %d %s", rec.Code, rec.Body)
+	}
+	list := decodeData(t, call(ListIdentities, http.MethodGet, token, nil))
+	if ids, _ := list["identities"].([]any); len(ids) != 1 {
+		t.Fatalf("identities = %v", list)
+	}
+	rec := oidcLogin(t, srv, ann, "")
+	again, _ := decodeData(t, rec)["token"].(string)
+	list = decodeData(t, call(ListIdentities, http.MethodGet, again, nil))
+	if ids, _ := list["identities"].([]any); len(ids) != 1 {
+		t.Errorf("login via linked identity reached another account: %v", list)
+	}
+
+	// An account already linked elsewhere cannot be linked again.
+	other := login(t, "carol")
+	if rec := oidcLogin(t, srv, ann, other); rec.Code != http.StatusConflict {
+		t.Errorf("link of taken identity = %d, want 409", rec.Code)
+	}
+
+	// With a password set, the link may go.
+	ps := httprouter.Params{{Key: "provider", Value: "test"}}
+	if rec := call(UnlinkIdentity, http.MethodDelete, token, ps); rec.Code != http.StatusNoContent {
+		t.Errorf("unlink = %d %s", rec.Code, rec.Body)
+	}
+}
@@ -2,64 +2,249 @@ package auth
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"math/rand"
-	"naevis/db"
-	"naevis/rdx"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
 	"net/http"
-	"net/smtp"
+	"strconv"
 	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/config"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mail"
+	"naevis/models"
+	"naevis/rdx"
+	"naevis/utils"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func GenerateOTP(length int) string {
-	digits := "0123456789"
+// Email verification codes live in Redis under otpPrefix+email as an
+// HMAC of the address and code, next to a count of guesses, and expire
+// with the key. A key under cooldownPrefix spaces out codes sent to one
+// address.
+
+// otpLength is the number of digits in a verification code.
+const otpLength = 6
+
+const (
+	otpPrefix      = "otp:code:"
+	cooldownPrefix = "otp:resend:"
+)
+
+// verifyConfig holds the verification settings; set by Configure.
+var verifyConfig = config.Verify{
+	Required:       true,
+	CodeTTL:        10 * time.Minute,
+	MaxAttempts:    5,
+	ResendCooldown: time.Minute,
+}
+
+// sendOTP delivers a code; tests replace it to read the code back.
+var sendOTP = SendEmailOTP
+
+// GenerateOTP returns a random numeric code of length digits.
+func GenerateOTP(length int) (string, error) {
 	var otp strings.Builder
+	ten := big.NewInt(10)
 	for i := 0; i < length; i++ {
-		otp.WriteByte(digits[rand.Intn(len(digits))])
+		d, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		otp.WriteByte(byte('0' + d.Int64()))
 	}
-	return otp.String()
+	return otp.String(), nil
 }
 
-func SendEmailOTP(toEmail, otp string) error {
-	from := "youremail@example.com"
-	pass := "your-app-password"
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
+// Configure applies the loaded configuration to the auth package.
+func Configure(cfg *config.Config) {
+	cookieConfig = cfg.Cookie
+	tokenConfig = cfg.JWT
+	verifyConfig = cfg.Verify
+	mfaConfig = cfg.MFA
+	configurePasswords(cfg)
+	configureOIDC(cfg)
+}
 
-	msg := []byte("Subject: Email Verification\n\nYour OTP is: " + otp)
+// SendEmailOTP queues the verification code otp for toEmail; ttl is how
+// long the code stays valid.
+func SendEmailOTP(ctx context.Context, toEmail, otp string, ttl time.Duration) error {
+	return mail.Queue(ctx, toEmail, "otp", map[string]any{
+		"Code":      otp,
+		"ExpiresIn": fmt.Sprintf("%d minutes", int(ttl.Minutes())),
+	})
+}
 
-	auth := smtp.PlainAuth("", from, pass, smtpHost)
-	return smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{toEmail}, msg)
+// claimCooldown starts the resend cooldown under key, such as
+// cooldownPrefix+email. It reports false while a previous one is running.
+func claimCooldown(ctx context.Context, key string) (bool, error) {
+	if verifyConfig.ResendCooldown <= 0 {
+		return true, nil
+	}
+	return rdx.Conn.SetNX(ctx, key, 1, verifyConfig.ResendCooldown).Result()
 }
 
+// respondCooldown answers a request refused by claimCooldown.
+func respondCooldown(w http.ResponseWriter, r *http.Request, key string) {
+	retry := rdx.Conn.PTTL(r.Context(), key).Val()
+	w.Header().Set("Retry-After", strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+	apierr.Respond(w, http.StatusTooManyRequests, "An email was sent recently. Please wait before requesting another.")
+}
+
+// issueOTP replaces any pending code for email with a new one and mails
+// it. The caller claims the cooldown first; it is released again if the
+// code cannot be sent, so the user may ask again at once.
+func issueOTP(ctx context.Context, email string) error {
+	code, err := GenerateOTP(otpLength)
+	if err == nil {
+		key := otpPrefix + email
+		pipe := rdx.Conn.TxPipeline()
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "hash", hashOTP(email, code), "attempts", 0)
+		pipe.Expire(ctx, key, verifyConfig.CodeTTL)
+		_, err = pipe.Exec(ctx)
+	}
+	if err == nil {
+		err = sendOTP(ctx, email, code, verifyConfig.CodeTTL)
+	}
+	if err != nil {
+		rdx.Conn.Del(ctx, cooldownPrefix+email)
+	}
+	return err
+}
+
+// hashOTP keys the hash with the server secret: a six-digit code is
+// found from a plain hash in a million tries.
+func hashOTP(email, code string) string {
+	mac := hmac.New(sha256.New, globals.JwtSecret)
+	mac.Write([]byte(email + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequestOTPHandler sends a verification code to an unverified account's
+// email. It answers the same whether or not the address is registered,
+// and the resend cooldown applies to every address, so it cannot be used
+// to probe for accounts.
+func RequestOTPHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	email := strings.TrimSpace(input.Email)
+	if !strings.Contains(email, "@") {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "email", Message: "is not a valid address"}))
+		return
+	}
+
+	ctx := r.Context()
+	ok, err := claimCooldown(ctx, cooldownPrefix+email)
+	if err != nil {
+		slog.ErrorContext(ctx, "otp cooldown claim failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	}
+	if !ok {
+		respondCooldown(w, r, cooldownPrefix+email)
+		return
+	}
+
+	var u models.User
+	err = db.UserCollection.FindOne(ctx, bson.M{"email": email},
+		options.FindOne().SetProjection(bson.M{"email_verified": 1})).Decode(&u)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+	case err != nil:
+		slog.ErrorContext(ctx, "otp user lookup failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	case !u.EmailVerified:
+		if err := issueOTP(ctx, email); err != nil {
+			slog.ErrorContext(ctx, "otp issue failed", "error", err)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to send code")
+			return
+		}
+	}
+
+	utils.SendResponse(w, http.StatusAccepted, nil, "If the address belongs to an unverified account, a code is on its way", nil)
+}
+
+// VerifyOTPHandler marks the account of an email verified when given the
+// code sent to it. A code survives a limited number of wrong guesses.
 func VerifyOTPHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var input struct {
 		Email string `json:"email"`
 		OTP   string `json:"otp"`
 	}
-	json.NewDecoder(r.Body).Decode(&input)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	email := strings.TrimSpace(input.Email)
+	ctx := r.Context()
+	key := otpPrefix + email
+
+	// Count the guess before looking: concurrent guesses cannot slip past
+	// the limit. Counting on an expired code recreates the key without a
+	// TTL, so that case deletes it again.
+	attempts, err := rdx.Conn.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "otp attempt count failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	stored, err := rdx.Conn.HGet(ctx, key, "hash").Result()
+	if errors.Is(err, redis.Nil) {
+		rdx.Conn.Del(ctx, key)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired code")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "otp code read failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
 
-	storedOTP, err := rdx.RdxGet("otp:" + input.Email)
-	if err != nil || storedOTP != input.OTP {
-		http.Error(w, "Invalid or expired OTP", http.StatusUnauthorized)
+	if !hmac.Equal([]byte(stored), []byte(hashOTP(email, input.OTP))) {
+		if attempts >= int64(verifyConfig.MaxAttempts) {
+			rdx.Conn.Del(ctx, key)
+			apierr.Respond(w, http.StatusUnauthorized, "Too many wrong codes; request a new one")
+			return
+		}
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired code")
 		return
 	}
+	rdx.Conn.Del(ctx, key)
 
-	// Mark user as verified
-	_, err = db.UserCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"email": input.Email},
+	res, err := db.UserCollection.UpdateOne(ctx,
+		bson.M{"email": email},
 		bson.M{"$set": bson.M{"email_verified": true}},
 	)
 	if err != nil {
-		http.Error(w, "Failed to verify user", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "marking email verified failed", "email", email, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to verify user")
+		return
+	}
+	if res.MatchedCount == 0 {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired code")
 		return
 	}
 
-	rdx.RdxDel("otp:" + input.Email) // Clean up OTP
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User verified successfully"})
+	utils.SendResponse(w, http.StatusOK, nil, "Email verified successfully", nil)
 }
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"naevis/middleware"
+	"naevis/rdx"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// captureOTPs records the codes sent instead of mailing them.
+func captureOTPs(t *testing.T) map[string]string {
+	t.Helper()
+	sent := map[string]string{}
+	sendOTP = func(_ context.Context, email, otp string, _ time.Duration) error {
+		sent[email] = otp
+		return nil
+	}
+	t.Cleanup(func() { sendOTP = SendEmailOTP })
+	return sent
+}
+
+func postParams(h httprouter.Handle, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), nil)
+	return rec
+}
+
+func TestEmailVerification(t *testing.T) {
+	useMemStores(t)
+	sent := captureOTPs(t)
+
+	rec := post(registerHandler, `{"username":"ann","password":"correct horse","email":"ann@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	code := sent["ann@example.com"]
+	if len(code) != otpLength {
+		t.Fatalf("registration sent code %q", code)
+	}
+	if rec := post(registerHandler, `{"username":"bob","password":"correct horse","email":"ann@example.com"}`); rec.Code != http.StatusConflict {
+		t.Errorf("register with taken email = %d, want 409", rec.Code)
+	}
+
+	token := login(t, "ann")
+	guarded := middleware.RequireVerified(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if rec := call(guarded, http.MethodPost, token, nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "email_unverified") {
+		t.Fatalf("unverified = %d %s, want 403 email_unverified", rec.Code, rec.Body)
+	}
+
+	if rec := postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"x"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code = %d, want 401", rec.Code)
+	}
+	if rec := postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"`+code+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify = %d %s", rec.Code, rec.Body)
+	}
+	if rec := postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused code = %d, want 401", rec.Code)
+	}
+
+	// The token predates verification; the database decides.
+	if rec := call(guarded, http.MethodPost, token, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("verified = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOTPAttemptsAndCooldown(t *testing.T) {
+	useMemStores(t)
+	sent := captureOTPs(t)
+	post(registerHandler, `{"username":"ann","password":"correct horse","email":"ann@example.com"}`)
+
+	// Registration started the cooldown; unknown addresses get one too.
+	for _, email := range []string{"ann@example.com", "nobody@example.com"} {
+		body := `{"email":"` + email + `"}`
+		if email == "nobody@example.com" {
+			if rec := postParams(RequestOTPHandler, body); rec.Code != http.StatusAccepted {
+				t.Fatalf("first request for %s = %d", email, rec.Code)
+			}
+		}
+		rec := postParams(RequestOTPHandler, body)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("request within cooldown for %s = %d", email, rec.Code)
+		}
+	}
+	if _, ok := sent["nobody@example.com"]; ok {
+		t.Error("code sent to an unregistered address")
+	}
+
+	rdx.Conn.Del(context.Background(), cooldownPrefix+"ann@example.com")
+	first := sent["ann@example.com"]
+	if rec := postParams(RequestOTPHandler, `{"email":"ann@example.com"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("resend = %d %s", rec.Code, rec.Body)
+	}
+	code := sent["ann@example.com"]
+	if rec := postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"`+first+`"}`); first != code && rec.Code != http.StatusUnauthorized {
+		t.Errorf("superseded code = %d, want 401", rec.Code)
+	}
+
+	for i := 1; i < verifyConfig.MaxAttempts; i++ {
+		postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"wrong"}`)
+	}
+	if rec := postParams(VerifyOTPHandler, `{"email":"ann@example.com","otp":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("code after too many guesses = %d, want 401", rec.Code)
+	}
+}
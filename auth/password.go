@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/config"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mail"
+	"naevis/models"
+	"naevis/rdx"
+	"naevis/sessions"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password policy.
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72 // bcrypt ignores anything longer
+)
+
+// passwordProblem returns why pw is not acceptable for u, or "".
+func passwordProblem(pw string, u models.User) string {
+	switch {
+	case len(pw) < minPasswordLen:
+		return fmt.Sprintf("must be at least %d characters", minPasswordLen)
+	case len(pw) > maxPasswordLen:
+		return fmt.Sprintf("must be at most %d bytes", maxPasswordLen)
+	case strings.EqualFold(pw, u.Username) || (u.Email != "" && strings.EqualFold(pw, u.Email)):
+		return "must not be your username or email"
+	}
+	return ""
+}
+
+// Reset tokens are single-use and stored by hash: resetPrefix+hash names
+// the user, and resetUserPrefix+userID the user's one pending token, so a
+// new request or a password change cancels the previous token.
+const (
+	resetPrefix         = "pwreset:"
+	resetUserPrefix     = "pwreset:user:"
+	resetCooldownPrefix = "pwreset:resend:"
+	resetTokenTTL       = 30 * time.Minute
+)
+
+// appURL is the web app that serves the reset page; set by Configure.
+var appURL = "http://localhost:5173"
+
+// sendResetLink mails a reset link; tests replace it to read the token.
+var sendResetLink = func(ctx context.Context, u models.User, token string) error {
+	return mail.Queue(ctx, u.Email, "password-reset", map[string]any{
+		"Username":  u.Username,
+		"Link":      appURL + "/reset-password?token=" + url.QueryEscape(token),
+		"ExpiresIn": fmt.Sprintf("%d minutes", int(resetTokenTTL.Minutes())),
+	})
+}
+
+func configurePasswords(cfg *config.Config) {
+	appURL = cfg.Public.AppURL
+}
+
+// ForgotPasswordHandler mails a password reset link to the account with
+// the given email. Like RequestOTPHandler it answers the same for unknown
+// addresses.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	email := strings.TrimSpace(input.Email)
+	if !strings.Contains(email, "@") {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "email", Message: "is not a valid address"}))
+		return
+	}
+
+	ctx := r.Context()
+	ok, err := claimCooldown(ctx, resetCooldownPrefix+email)
+	if err != nil {
+		slog.ErrorContext(ctx, "forgot password cooldown claim failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to send reset link")
+		return
+	}
+	if !ok {
+		respondCooldown(w, r, resetCooldownPrefix+email)
+		return
+	}
+
+	var u models.User
+	err = db.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&u)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+	case err != nil:
+		slog.ErrorContext(ctx, "forgot password user lookup failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to send reset link")
+		return
+	default:
+		if err := issueReset(ctx, u); err != nil {
+			rdx.Conn.Del(ctx, resetCooldownPrefix+email)
+			slog.ErrorContext(ctx, "forgot password reset issue failed", "user_id", u.UserID, "error", err)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to send reset link")
+			return
+		}
+	}
+
+	utils.SendResponse(w, http.StatusAccepted, nil, "If the address belongs to an account, a reset link is on its way", nil)
+}
+
+// issueReset replaces any pending reset token of u and mails the new one.
+func issueReset(ctx context.Context, u models.User) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+	hash := hashToken(token)
+
+	if err := cancelReset(ctx, u.UserID); err != nil {
+		return err
+	}
+	pipe := rdx.Conn.TxPipeline()
+	pipe.Set(ctx, resetPrefix+hash, u.UserID, resetTokenTTL)
+	pipe.Set(ctx, resetUserPrefix+u.UserID, hash, resetTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return sendResetLink(ctx, u, token)
+}
+
+// cancelReset invalidates the pending reset token of userID, if any.
+func cancelReset(ctx context.Context, userID string) error {
+	old, err := rdx.Conn.Get(ctx, resetUserPrefix+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return rdx.Conn.Del(ctx, resetPrefix+old, resetUserPrefix+userID).Err()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResetPasswordHandler sets a new password with a token from
+// ForgotPasswordHandler and ends every session of the account.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	ctx := r.Context()
+	key := resetPrefix + hashToken(input.Token)
+	userID, err := rdx.Conn.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "reset password token read failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	var u models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&u); err != nil {
+		slog.ErrorContext(ctx, "reset password user lookup failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+
+	// Check the password before spending the token, so a rejected one
+	// can be retried with the same link.
+	if msg := passwordProblem(input.Password, u); msg != "" {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "password", Message: msg}))
+		return
+	}
+	// Only the request that deletes the token may use it.
+	if n, err := rdx.Conn.Del(ctx, key).Result(); err != nil || n == 0 {
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+
+	// The link reached the inbox, which proves the address too.
+	if err := setPassword(ctx, u, input.Password, bson.M{"email_verified": true}); err != nil {
+		slog.ErrorContext(ctx, "reset password failed", "user_id", u.UserID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	clearRefreshCookie(w)
+	utils.SendResponse(w, http.StatusOK, nil, "Password reset; please log in again", nil)
+}
+
+// ChangePasswordHandler replaces the caller's password after checking
+// the current one. Every session ends, including the caller's, which is
+// replaced by a new one in the response.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	var u models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&u); err != nil {
+		slog.ErrorContext(ctx, "change password user lookup failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.CurrentPassword)) != nil {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "current_password", Message: "is incorrect"}))
+		return
+	}
+	msg := passwordProblem(input.NewPassword, u)
+	if msg == "" && input.NewPassword == input.CurrentPassword {
+		msg = "must differ from the current password"
+	}
+	if msg != "" {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "new_password", Message: msg}))
+		return
+	}
+
+	if err := setPassword(ctx, u, input.NewPassword, nil); err != nil {
+		slog.ErrorContext(ctx, "change password failed", "user_id", u.UserID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+	mfa, _ := ctx.Value(globals.MFAKey).(bool)
+	accessToken, err := startSession(w, r, u, mfa)
+	if err != nil {
+		// The password did change; the client just has to log in.
+		slog.ErrorContext(ctx, "change password failed", "user_id", u.UserID, "error", err)
+		clearRefreshCookie(w)
+		utils.SendResponse(w, http.StatusOK, nil, "Password changed; please log in again", nil)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, map[string]string{
+		"token":  accessToken,
+		"userid": u.UserID,
+	}, "Password changed", nil)
+}
+
+// setPassword stores pw for u along with any extra fields, then ends all
+// of u's sessions and pending resets and tells u by email.
+func setPassword(ctx context.Context, u models.User, pw string, extra bson.M) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	set := bson.M{"password": string(hashed), "updated_at": time.Now().UTC()}
+	for k, v := range extra {
+		set[k] = v
+	}
+	if _, err := db.UserCollection.UpdateOne(ctx, bson.M{"userid": u.UserID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("store password: %w", err)
+	}
+
+	if _, err := sessions.RevokeAll(ctx, u.UserID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	if err := cancelReset(ctx, u.UserID); err != nil {
+		slog.WarnContext(ctx, "cancelling pending reset failed", "user_id", u.UserID, "error", err)
+	}
+	if u.Email != "" {
+		if err := mail.Queue(ctx, u.Email, "password-changed", map[string]any{"Username": u.Username}); err != nil {
+			slog.WarnContext(ctx, "queueing password notice failed", "user_id", u.UserID, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"naevis/middleware"
+	"naevis/models"
+)
+
+func TestPasswordReset(t *testing.T) {
+	useMemStores(t)
+	captureOTPs(t)
+	tokens := map[string]string{}
+	orig := sendResetLink
+	t.Cleanup(func() { sendResetLink = orig })
+	sendResetLink = func(_ context.Context, u models.User, token string) error {
+		tokens[u.Email] = token
+		return nil
+	}
+
+	post(registerHandler, `{"username":"ann","password":"correct horse","email":"ann@example.com"}`)
+	session := login(t, "ann")
+
+	if rec := postParams(ForgotPasswordHandler, `{"email":"ann@example.com"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot = %d %s", rec.Code, rec.Body)
+	}
+	token := tokens["ann@example.com"]
+	if token == "" {
+		t.Fatal("no reset token sent")
+	}
+
+	if rec := postParams(ResetPasswordHandler, `{"token":"`+token+`","password":"short"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("weak password = %d, want 422", rec.Code)
+	}
+	if rec := postParams(ResetPasswordHandler, `{"token":"`+token+`","password":"battery staple"}`); rec.Code != http.StatusOK {
+		t.Fatalf("reset = %d %s", rec.Code, rec.Body)
+	}
+	if rec := postParams(ResetPasswordHandler, `{"token":"`+token+`","password":"another staple"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused token = %d, want 401", rec.Code)
+	}
+
+	if rec := call(ListSessions, http.MethodGet, session, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("session after reset = %d, want 401", rec.Code)
+	}
+	if rec := post(loginHandler, `{"username":"ann","password":"correct horse"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("old password = %d, want 401", rec.Code)
+	}
+	if rec := post(loginHandler, `{"username":"ann","password":"battery staple"}`); rec.Code != http.StatusOK {
+		t.Errorf("new password = %d", rec.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	useMemStores(t)
+	phone := login(t, "ann")
+	laptop := login(t, "ann")
+
+	change := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		middleware.Authenticate(ChangePasswordHandler)(rec, req, nil)
+		return rec
+	}
+
+	if rec := change(phone, `{"current_password":"wrong","new_password":"battery staple"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong current password = %d, want 422", rec.Code)
+	}
+	if rec := change(phone, `{"current_password":"correct horse","new_password":"correct horse"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unchanged password = %d, want 422", rec.Code)
+	}
+	rec := change(phone, `{"current_password":"correct horse","new_password":"battery staple"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"token"`) {
+		t.Fatalf("change = %d %s", rec.Code, rec.Body)
+	}
+
+	for name, token := range map[string]string{"phone": phone, "laptop": laptop} {
+		if rec := call(ListSessions, http.MethodGet, token, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s session after change = %d, want 401", name, rec.Code)
+		}
+	}
+	if rec := post(loginHandler, `{"username":"ann","password":"battery staple"}`); rec.Code != http.StatusOK {
+		t.Errorf("new password = %d", rec.Code)
+	}
+}
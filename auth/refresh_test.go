@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// loginDevice logs ann in and returns the access token and refresh cookie.
+func loginDevice(t *testing.T) (string, string) {
+	t.Helper()
+	creds := `{"username":"ann","password":"correct horse"}`
+	post(registerHandler, creds)
+	return tokens(t, post(loginHandler, creds))
+}
+
+func tokens(t *testing.T, rec *httptest.ResponseRecorder) (access, refresh string) {
+	t.Helper()
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Data["token"] == "" {
+		t.Fatalf("response = %d %+v, %v", rec.Code, resp, err)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == refreshCookie && c.Path == refreshCookiePath {
+			refresh = c.Value
+		}
+	}
+	if refresh == "" {
+		t.Fatal("no refresh cookie set")
+	}
+	return resp.Data["token"], refresh
+}
+
+func refresh(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(""))
+	req.AddCookie(&http.Cookie{Name: refreshCookie, Value: token})
+	rec := httptest.NewRecorder()
+	refreshTokenHandler(rec, req)
+	return rec
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+	useMemStores(t)
+	_, first := loginDevice(t)
+	otherAccess, otherRefresh := loginDevice(t)
+	if first == otherRefresh {
+		t.Fatal("two devices share a refresh token")
+	}
+
+	rec := refresh(first)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh = %d %s", rec.Code, rec.Body)
+	}
+	access, second := tokens(t, rec)
+	if second == first {
+		t.Fatal("refresh did not rotate the token")
+	}
+
+	// An immediate repeat, as from a second tab, is refused but harmless.
+	if rec := refresh(first); rec.Code != http.StatusUnauthorized {
+		t.Errorf("repeat within grace = %d, want 401", rec.Code)
+	}
+	if rec := call(ListSessions, http.MethodGet, access, nil); rec.Code != http.StatusOK {
+		t.Fatalf("session after benign repeat = %d, want 200", rec.Code)
+	}
+
+	// Later reuse of the rotated token revokes the whole family.
+	_, err := db.RefreshTokensCollection.UpdateMany(context.Background(),
+		bson.M{"used_at": bson.M{"$exists": true}},
+		bson.M{"$set": bson.M{"used_at": time.Now().Add(-time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := refresh(first); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reuse = %d, want 401", rec.Code)
+	}
+	if rec := call(ListSessions, http.MethodGet, access, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token of reused family = %d, want 401", rec.Code)
+	}
+	if rec := refresh(second); rec.Code != http.StatusUnauthorized {
+		t.Errorf("successor of reused token = %d, want 401", rec.Code)
+	}
+
+	// The other device keeps its own family.
+	if rec := call(ListSessions, http.MethodGet, otherAccess, nil); rec.Code != http.StatusOK {
+		t.Errorf("other device access = %d, want 200", rec.Code)
+	}
+	if rec := refresh(otherRefresh); rec.Code != http.StatusOK {
+		t.Errorf("other device refresh = %d, want 200", rec.Code)
+	}
+}
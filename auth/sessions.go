@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"naevis/apierr"
+	"naevis/globals"
+	"naevis/sessions"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ListSessions returns the caller's active sessions; the one making the
+// request is marked current.
+// GET /api/v1/auth/sessions
+func ListSessions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+	current, _ := ctx.Value(globals.SessionIDKey).(string)
+
+	list, err := sessions.List(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing sessions failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+	for i := range list {
+		list[i].Current = list[i].ID == current
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"sessions": list})
+}
+
+// RevokeSession signs out one of the caller's sessions.
+// DELETE /api/v1/auth/sessions/:id
+func RevokeSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+
+	err := sessions.Revoke(ctx, userID, ps.ByName("id"))
+	if errors.Is(err, sessions.ErrNotFound) {
+		apierr.Respond(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "revoking session failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs the caller out everywhere, including the
+// session making the request, and so ends all of their refresh tokens.
+// DELETE /api/v1/auth/sessions
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(globals.UserIDKey).(string)
+
+	n, err := sessions.RevokeAll(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "revoking sessions failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"revoked": n})
+}
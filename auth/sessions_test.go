@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"naevis/middleware"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// login registers name if needed and returns a fresh access token.
+func login(t *testing.T, name string) string {
+	t.Helper()
+	creds := `{"username":"` + name + `","password":"correct horse"}`
+	post(registerHandler, creds)
+	rec := post(loginHandler, creds)
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Data["token"] == "" {
+		t.Fatalf("login %s = %d %s", name, rec.Code, rec.Body)
+	}
+	return resp.Data["token"]
+}
+
+// call runs h behind Authenticate with token and returns the recorder.
+func call(h httprouter.Handle, method, token string, ps httprouter.Params) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	middleware.Authenticate(h)(rec, req, ps)
+	return rec
+}
+
+func TestSessionRevocation(t *testing.T) {
+	useMemStores(t)
+	phone := login(t, "ann")
+	laptop := login(t, "ann")
+	other := login(t, "bob")
+
+	rec := call(ListSessions, http.MethodGet, phone, nil)
+	var list struct {
+		Sessions []struct {
+			ID      string `json:"id"`
+			Current bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Sessions) != 2 {
+		t.Fatalf("ListSessions = %d %+v, %v", rec.Code, list, err)
+	}
+	var laptopID string
+	for _, s := range list.Sessions {
+		if !s.Current {
+			laptopID = s.ID
+		}
+	}
+
+	// Another user cannot revoke ann's session.
+	ps := httprouter.Params{{Key: "id", Value: laptopID}}
+	if rec := call(RevokeSession, http.MethodDelete, other, ps); rec.Code != http.StatusNotFound {
+		t.Errorf("foreign RevokeSession = %d, want 404", rec.Code)
+	}
+	if rec := call(RevokeSession, http.MethodDelete, phone, ps); rec.Code != http.StatusNoContent {
+		t.Fatalf("RevokeSession = %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(ListSessions, http.MethodGet, laptop, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token = %d, want 401", rec.Code)
+	}
+	if rec := call(ListSessions, http.MethodGet, phone, nil); rec.Code != http.StatusOK {
+		t.Errorf("remaining token = %d, want 200", rec.Code)
+	}
+
+	// Logging out everywhere ends the caller's own session too.
+	if rec := call(RevokeAllSessions, http.MethodDelete, phone, nil); rec.Code != http.StatusOK {
+		t.Fatalf("RevokeAllSessions = %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(ListSessions, http.MethodGet, phone, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token after logout everywhere = %d, want 401", rec.Code)
+	}
+	if rec := call(ListSessions, http.MethodGet, other, nil); rec.Code != http.StatusOK {
+		t.Errorf("other user's token = %d, want 200", rec.Code)
+	}
+}
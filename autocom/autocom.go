@@ -4,36 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 
-	"github.com/joho/godotenv"
+	"naevis/rdx"
+
 	"github.com/redis/go-redis/v9"
 )
 
-// Load environment variables and initialize Redis connection
-func InitRedis() *redis.Client {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: No .env file found, using system environment variables")
-	}
-
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		log.Fatal("REDIS_URL is not set")
-	}
-
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisURL,
-		Password: os.Getenv("REDIS_PASSWORD"), // Empty if no password
-		DB:       0,                           // Default DB
-	})
-
-	return client
-}
-
 // Get a Redis client instance
 func GetRedisClient() *redis.Client {
-	return InitRedis()
+	return rdx.Conn
 }
 
 // Add an event for autocorrect suggestions
@@ -3,6 +3,7 @@ package baito
 import (
 	"context"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -41,7 +42,7 @@ func GetWorkers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	workers, err := utils.FindAndDecode[models.BaitoWorkersResponse](ctx, db.BaitoWorkerCollection, filter, opts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch workers")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch workers")
 		return
 	}
 
@@ -60,10 +61,10 @@ func GetLatestBaitos(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	ctx := r.Context()
 	opts := db.OptionsFindLatest(20).SetSort(bson.M{"createdAt": -1})
 
-	cursor, err := db.BaitoCollection.Find(ctx, bson.M{}, opts)
+	cursor, err := db.BaitoCollection.Find(ctx, openBaitos(bson.M{}), opts)
 	if err != nil {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -88,10 +89,10 @@ func GetRelatedBaitos(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 
 	opts := db.OptionsFindLatest(10).SetSort(bson.M{"createdAt": -1})
 
-	cursor, err := db.BaitoCollection.Find(ctx, filter, opts)
+	cursor, err := db.BaitoCollection.Find(ctx, openBaitos(filter), opts)
 	if err != nil {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 	defer cursor.Close(ctx)
@@ -100,7 +101,7 @@ func GetRelatedBaitos(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	var baitos []bson.M
 	if err := cursor.All(ctx, &baitos); err != nil {
 		log.Printf("Cursor decode error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -115,10 +116,10 @@ func GetRelatedBaitos(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		fallbackFilter["baitoid"] = bson.M{"$ne": exclude}
 	}
 
-	cursor2, err := db.BaitoCollection.Find(ctx, fallbackFilter, opts)
+	cursor2, err := db.BaitoCollection.Find(ctx, openBaitos(fallbackFilter), opts)
 	if err != nil {
 		log.Printf("DB error (fallback): %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 	findAndRespondBaitos(ctx, w, cursor2)
@@ -130,7 +131,7 @@ func findAndRespondBaitos(ctx context.Context, w http.ResponseWriter, cursor *mo
 	var results []models.BaitosResponse
 	if err := cursor.All(ctx, &results); err != nil {
 		log.Printf("Cursor decode error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to parse results")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to parse results")
 		return
 	}
 
@@ -152,11 +153,11 @@ func DeleteBaito(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	res, err := db.BaitoCollection.DeleteOne(ctx, filter)
 	if err != nil {
-		http.Error(w, "Failed to delete baito", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete baito")
 		return
 	}
 	if res.DeletedCount == 0 {
-		http.Error(w, "Baito not found or unauthorized", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Baito not found or unauthorized")
 		return
 	}
 
@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -25,10 +26,10 @@ func GetBaitoByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var b models.Baito
 	if err := db.BaitoCollection.FindOne(ctx, bson.M{"baitoid": id}).Decode(&b); err != nil {
 		if err == mongo.ErrNoDocuments {
-			utils.RespondWithError(w, http.StatusNotFound, "Not found")
+			apierr.Respond(w, http.StatusNotFound, "Not found")
 		} else {
 			log.Printf("DB error: %v", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+			apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		}
 		return
 	}
@@ -39,19 +40,35 @@ func GetBaitoByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func ApplyToBaito(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(5 << 20); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 	defer r.MultipartForm.RemoveAll()
 
 	pitch := strings.TrimSpace(r.FormValue("pitch"))
 	if pitch == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Pitch message required")
+		apierr.Respond(w, http.StatusBadRequest, "Pitch message required")
+		return
+	}
+
+	baitoID := ps.ByName("baitoid")
+	var b models.Baito
+	if err := db.BaitoCollection.FindOne(ctx, bson.M{"baitoid": baitoID}).Decode(&b); err != nil {
+		if err == mongo.ErrNoDocuments {
+			apierr.Respond(w, http.StatusNotFound, "Not found")
+		} else {
+			log.Printf("DB error: %v", err)
+			apierr.Respond(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+	if !acceptingApplications(b, time.Now()) {
+		apierr.Respond(w, http.StatusGone, "Applications for this job are closed")
 		return
 	}
 
 	app := models.BaitoApplication{
-		BaitoID:     ps.ByName("baitoid"),
+		BaitoID:     baitoID,
 		UserID:      utils.GetUserIDFromRequest(r),
 		Username:    utils.GetUsernameFromRequest(r),
 		Pitch:       pitch,
@@ -60,7 +77,7 @@ func ApplyToBaito(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	if _, err := db.BaitoApplicationsCollection.InsertOne(ctx, app); err != nil {
 		log.Printf("Insert error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save application")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save application")
 		return
 	}
 
@@ -77,7 +94,7 @@ func GetMyBaitos(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	cursor, err := db.BaitoCollection.Find(ctx, bson.M{"ownerId": userID}, options.Find().SetSort(bson.M{"createdAt": -1}))
 	if err != nil {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -89,7 +106,7 @@ func GetBaitoApplicants(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	cursor, err := db.BaitoApplicationsCollection.Find(ctx, bson.M{"baitoid": ps.ByName("baitoid")})
 	if err != nil {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -123,7 +140,7 @@ func GetMyApplications(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	cursor, err := db.BaitoApplicationsCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		log.Printf("Aggregate error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch applications")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch applications")
 		return
 	}
 
@@ -0,0 +1,51 @@
+package baito
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"naevis/db"
+	"naevis/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// JobCloseExpired is the scheduler job that closes postings past their
+// last application date.
+const JobCloseExpired = "baito.close-expired"
+
+// openBaitos restricts a listing filter to postings that are still open.
+func openBaitos(filter bson.M) bson.M {
+	filter["closedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// acceptingApplications reports whether b still takes applications. The
+// date check covers the gap before the close job next runs.
+func acceptingApplications(b models.Baito, now time.Time) bool {
+	if b.ClosedAt != nil {
+		return false
+	}
+	return b.LastDateToApply.IsZero() || now.Before(b.LastDateToApply)
+}
+
+// CloseExpired is the JobCloseExpired job.
+func CloseExpired(ctx context.Context, _ json.RawMessage) error {
+	now := time.Now().UTC()
+	res, err := db.BaitoCollection.UpdateMany(ctx,
+		bson.M{
+			"closedAt": bson.M{"$exists": false},
+			"lastdate": bson.M{"$lte": now, "$gt": time.Time{}},
+		},
+		bson.M{"$set": bson.M{"closedAt": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("[Baito] closed %d postings past their last date", res.ModifiedCount)
+	}
+	return nil
+}
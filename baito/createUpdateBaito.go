@@ -1,7 +1,10 @@
 package baito
 
 import (
+	"context"
+	"errors"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/models"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func parseBaitoForm(r *http.Request, isUpdate bool) (models.Baito, bson.M, error) {
@@ -107,25 +111,29 @@ func CreateBaito(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	b, _, err := parseBaitoForm(r, false)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
 	if b.Title == "" || b.Description == "" || b.Category == "" || b.SubCategory == "" ||
 		b.Location == "" || b.Wage == "" || b.Phone == "" || b.Requirements == "" || b.WorkHours == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing required fields")
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
-	if _, err := db.BaitoCollection.InsertOne(ctx, b); err != nil {
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.BaitoCollection.InsertOne(ctx, b); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "baito-created", models.Index{
+			EntityType: "baito", EntityId: b.BaitoId, Method: "POST",
+		})
+	})
+	if err != nil {
 		log.Printf("Insert error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save baito")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save baito")
 		return
 	}
-
-	go mq.Emit(ctx, "baito-created", models.Index{
-		EntityType: "baito", EntityId: b.BaitoId, Method: "POST",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"baitoid": b.BaitoId})
 }
 
@@ -133,7 +141,7 @@ func UpdateBaito(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	_, update, err := parseBaitoForm(r, true)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -142,20 +150,27 @@ func UpdateBaito(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		"ownerId": utils.GetUserIDFromRequest(r),
 	}
 
-	result, err := db.BaitoCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Printf("Update error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update baito")
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		result, err := db.BaitoCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "baito-updated", models.Index{
+			EntityType: "baito", EntityId: ps.ByName("baitoid"), Method: "PUT",
+		})
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Baito not found or unauthorized")
 		return
 	}
-	if result.MatchedCount == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "Baito not found or unauthorized")
+	if err != nil {
+		log.Printf("Update error: %v", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update baito")
 		return
 	}
-
-	go mq.Emit(ctx, "baito-updated", models.Index{
-		EntityType: "baito", EntityId: ps.ByName("baitoid"), Method: "PUT",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
 		"message": "Baito updated",
 		"baitoid": ps.ByName("baitoid"),
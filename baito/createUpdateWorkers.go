@@ -1,7 +1,10 @@
 package baito
 
 import (
+	"context"
+	"errors"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/models"
@@ -99,34 +102,44 @@ func CreateWorkerProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	var existingWorker models.BaitoWorker
 	err := db.BaitoWorkerCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&existingWorker)
 	if err == nil {
-		utils.RespondWithError(w, http.StatusConflict, "Worker profile already exists")
+		apierr.Respond(w, http.StatusConflict, "Worker profile already exists")
 		return
 	} else if err != mongo.ErrNoDocuments {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
 	// Parse form data
 	worker, _, err := parseWorkerForm(r, false)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
 	// Validate required fields
 	if worker.Name == "" || worker.Age < 16 || worker.Phone == "" || worker.Location == "" || len(worker.Preferred) == 0 || worker.Bio == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing required fields")
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
 	// Set user ID explicitly in worker object
 	worker.BaitoUserID = userID
 
-	// Insert new worker profile
-	if _, err := db.BaitoWorkerCollection.InsertOne(ctx, worker); err != nil {
+	// Insert new worker profile together with its event
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.BaitoWorkerCollection.InsertOne(ctx, worker); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "worker-created", models.Index{
+			EntityType: "worker",
+			EntityId:   worker.BaitoUserID,
+			Method:     "POST",
+		})
+	})
+	if err != nil {
 		log.Printf("Insert error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save worker profile")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save worker profile")
 		return
 	}
 
@@ -143,13 +156,6 @@ func CreateWorkerProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		// Not fatal, so we continue
 	}
 
-	// Emit event asynchronously
-	go mq.Emit(ctx, "worker-created", models.Index{
-		EntityType: "worker",
-		EntityId:   worker.BaitoUserID,
-		Method:     "POST",
-	})
-
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Worker profile created successfully"})
 }
 
@@ -161,26 +167,32 @@ func UpdateWorkerProfile(w http.ResponseWriter, r *http.Request, ps httprouter.P
 
 	_, update, err := parseWorkerForm(r, true)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
 	filter := bson.M{"baitouserid": workerID, "userid": userID}
-	result, err := db.BaitoWorkerCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Printf("Update error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update worker profile")
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		result, err := db.BaitoWorkerCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "worker-updated", models.Index{
+			EntityType: "worker", EntityId: workerID, Method: "PUT",
+		})
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Worker profile not found or unauthorized")
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "Worker profile not found or unauthorized")
+	if err != nil {
+		log.Printf("Update error: %v", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update worker profile")
 		return
 	}
-
-	go mq.Emit(ctx, "worker-updated", models.Index{
-		EntityType: "worker", EntityId: workerID, Method: "PUT",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
 		"message":  "Worker profile updated successfully",
 		"workerId": workerID,
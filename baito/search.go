@@ -3,6 +3,7 @@ package baito
 import (
 	"context"
 	"log"
+	"naevis/apierr"
 	"naevis/models"
 	"naevis/utils"
 	"net/http"
@@ -17,7 +18,7 @@ func findAndRespondApplications(ctx context.Context, w http.ResponseWriter, curs
 	var results []models.BaitoApplication
 	if err := cursor.All(ctx, &results); err != nil {
 		log.Printf("Cursor decode error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to parse results")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to parse results")
 		return
 	}
 	if len(results) == 0 {
@@ -33,7 +34,7 @@ func findAndRespondBson(ctx context.Context, w http.ResponseWriter, cursor *mong
 	var results []bson.M
 	if err := cursor.All(ctx, &results); err != nil {
 		log.Printf("Cursor decode error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to parse results")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to parse results")
 		return
 	}
 	if len(results) == 0 {
@@ -3,6 +3,7 @@ package baito
 import (
 	"context"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -24,10 +25,10 @@ func GetWorkerById(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	err := db.BaitoWorkerCollection.FindOne(ctx, bson.M{"baito_user_id": ps.ByName("workerId")}).Decode(&worker)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			utils.RespondWithError(w, http.StatusNotFound, "Worker not found")
+			apierr.Respond(w, http.StatusNotFound, "Worker not found")
 		} else {
 			log.Printf("DB error: %v", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch worker")
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch worker")
 		}
 		return
 	}
@@ -42,7 +43,7 @@ func GetWorkerSkills(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	values, err := db.BaitoWorkerCollection.Distinct(ctx, "preferred_roles", bson.M{})
 	if err != nil {
 		log.Printf("DB error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch skills")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch skills")
 		return
 	}
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/middleware"
@@ -22,7 +23,7 @@ import (
 func GetFollowing(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	claims, ok := r.Context().Value(globals.UserIDKey).(*middleware.Claims)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	userID := claims.UserID
@@ -30,7 +31,7 @@ func GetFollowing(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var userFollow models.UserFollow
 	err := db.FollowingsCollection.FindOne(context.TODO(), bson.M{"userid": userID}).Decode(&userFollow)
 	if err != nil && err != mongo.ErrNoDocuments {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -54,7 +55,7 @@ func HandleFollowAction(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 
 	if err := UpdateFollowRelationship(ctx, currentUserID, targetUserID, action); err != nil {
 		log.Printf("Error updating follow relationship: %v", err)
-		http.Error(w, "Failed to update follow relationship", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update follow relationship")
 		return
 	}
 
@@ -80,7 +81,7 @@ func GetFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	userID := claims.UserID
@@ -88,7 +89,7 @@ func GetFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var userFollow models.UserFollow
 	err = db.FollowingsCollection.FindOne(context.TODO(), bson.M{"userid": userID}).Decode(&userFollow)
 	if err != nil && err != mongo.ErrNoDocuments {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -100,14 +101,14 @@ func GetFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	cursor, err := db.FollowingsCollection.Find(context.TODO(), bson.M{"userid": bson.M{"$in": userFollow.Followers}})
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	defer cursor.Close(context.TODO())
 
 	followers := []models.User{}
 	if err = cursor.All(context.TODO(), &followers); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -118,7 +119,7 @@ func DoesFollow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -126,7 +127,7 @@ func DoesFollow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	followedUserID := ps.ByName("id")
 
 	if followedUserID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "User ID is required")
 		return
 	}
 
@@ -138,7 +139,7 @@ func DoesFollow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		},
 	})
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -161,16 +162,6 @@ func UpdateFollowRelationship(ctx context.Context, currentUserID, targetUserID,
 			"$pull": bson.M{"follows": targetUserID},
 		}
 	}
-	_, err := db.FollowingsCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"userid": currentUserID},
-		currentUserUpdate,
-		options.Update().SetUpsert(true),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update current user's follows: %w", err)
-	}
-
 	// Update target user's followers list
 	targetUserUpdate := bson.M{
 		"$addToSet": bson.M{"followers": currentUserID},
@@ -180,27 +171,35 @@ func UpdateFollowRelationship(ctx context.Context, currentUserID, targetUserID,
 			"$pull": bson.M{"followers": currentUserID},
 		}
 	}
-	_, err = db.FollowingsCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"userid": targetUserID},
-		targetUserUpdate,
-		options.Update().SetUpsert(true),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update target user's followers: %w", err)
-	}
-
-	if action == "unfollow" {
-		m := models.Index{EntityType: "follow", EntityId: currentUserID, Method: "DELETE", ItemId: targetUserID}
-		go mq.Emit(ctx, "unfllowed", m)
 
-	} else {
-		m := models.Index{EntityType: "follow", EntityId: currentUserID, Method: "PUT", ItemId: targetUserID}
-		go mq.Emit(ctx, "followed", m)
+	return db.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := db.FollowingsCollection.UpdateOne(
+			ctx,
+			bson.M{"userid": currentUserID},
+			currentUserUpdate,
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update current user's follows: %w", err)
+		}
 
-	}
+		_, err = db.FollowingsCollection.UpdateOne(
+			ctx,
+			bson.M{"userid": targetUserID},
+			targetUserUpdate,
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update target user's followers: %w", err)
+		}
 
-	return nil
+		if action == "unfollow" {
+			m := models.Index{EntityType: "follow", EntityId: currentUserID, Method: "DELETE", ItemId: targetUserID}
+			return mq.Emit(ctx, "unfllowed", m)
+		}
+		m := models.Index{EntityType: "follow", EntityId: currentUserID, Method: "PUT", ItemId: targetUserID}
+		return mq.Emit(ctx, "followed", m)
+	})
 }
 
 func CreateFollowEntry(userid string) {
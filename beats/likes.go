@@ -13,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/rdx"
@@ -35,7 +36,7 @@ func ToggleLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	userid := utils.GetUserIDFromRequest(r)
 	if userid == "" {
-		http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized: user not found")
 		return
 	}
 
@@ -59,7 +60,7 @@ func ToggleLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	like := models.Like{UserID: userid, EntityType: entityType, EntityID: entityID, CreatedAt: time.Now()}
 	_, err = db.LikesCollection.InsertOne(ctx, like)
 	if err != nil {
-		http.Error(w, "Failed to like", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to like")
 		return
 	}
 	count := incrementRedisOrMongo(ctx, redisKey, entityType, entityID)
@@ -87,7 +88,7 @@ func incrementRedisOrMongo(ctx context.Context, redisKey, entityType, entityID s
 func BatchUserLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized: user not found")
 		return
 	}
 
@@ -95,7 +96,7 @@ func BatchUserLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		EntityIDs []string `json:"entity_ids"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Bad Request")
 		return
 	}
 
@@ -114,7 +115,7 @@ func BatchUserLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		"entity_id": bson.M{"$in": req.EntityIDs},
 	})
 	if err != nil {
-		http.Error(w, "Failed to query likes", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to query likes")
 		return
 	}
 	defer cursor.Close(ctx)
@@ -140,7 +141,7 @@ func BatchUserLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 func GetLikers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userid := utils.GetUserIDFromRequest(r)
 	if userid == "" {
-		http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized: user not found")
 		return
 	}
 
@@ -150,7 +151,7 @@ func GetLikers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	entityType := ps.ByName("entitytype")
 	entityID := ps.ByName("entityid")
 	if entityType == "" || entityID == "" {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Bad Request")
 		return
 	}
 
@@ -159,7 +160,7 @@ func GetLikers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		"entity_id":   entityID,
 	})
 	if err != nil {
-		http.Error(w, "Failed to fetch likers", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch likers")
 		return
 	}
 	defer cursor.Close(ctx)
@@ -198,7 +199,7 @@ func GetLikers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func GetLikeCount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userid := utils.GetUserIDFromRequest(r)
 	if userid == "" {
-		http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized: user not found")
 		return
 	}
 
@@ -223,7 +224,7 @@ func GetLikeCount(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	filter := bson.M{"entity_type": entityType, "entity_id": entityID}
 	count, err := db.LikesCollection.CountDocuments(ctx, filter)
 	if err != nil {
-		http.Error(w, "Count failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Count failed")
 		return
 	}
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/mq"
@@ -23,19 +24,19 @@ func HandleEntitySubscription(w http.ResponseWriter, r *http.Request, ps httprou
 	ctx := r.Context()
 	currentUserID := utils.GetUserIDFromRequest(r)
 	if currentUserID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	entityID := ps.ByName("id")
 	if entityID == "" {
-		http.Error(w, "Entity ID required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Entity ID required")
 		return
 	}
 
 	if err := UpdateEntitySubscription(ctx, currentUserID, entityType, entityID, action); err != nil {
 		log.Printf("Failed to update %s subscription: %v", entityType, err)
-		http.Error(w, "Failed to update subscription", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update subscription")
 		return
 	}
 
@@ -65,13 +66,13 @@ func UnsubscribeEntity(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 func DoesSubscribeEntity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	currentUserID := utils.GetUserIDFromRequest(r)
 	if currentUserID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	entityID := ps.ByName("id")
 	if entityID == "" {
-		http.Error(w, "Entity ID required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Entity ID required")
 		return
 	}
 
@@ -88,13 +89,13 @@ func DoesSubscribeEntity(w http.ResponseWriter, r *http.Request, ps httprouter.P
 			},
 		}
 	default:
-		http.Error(w, "Invalid entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid entity type")
 		return
 	}
 
 	count, err := db.SubscribersCollection.CountDocuments(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -122,23 +123,23 @@ func UpdateEntitySubscription(ctx context.Context, userID, entityType, entityID,
 		event = "unsubscribed"
 	}
 
-	// Update user subscription list
-	_, err := db.SubscribersCollection.UpdateOne(ctx, bson.M{"userid": userID}, opCurrent, options.Update().SetUpsert(true))
-	if err != nil {
-		return fmt.Errorf("failed to update user's subscriptions: %w", err)
-	}
-
-	// Update target entity's subscribers list
-	_, err = db.SubscribersCollection.UpdateOne(ctx, bson.M{"userid": entityID}, opTarget, options.Update().SetUpsert(true))
-	if err != nil {
-		return fmt.Errorf("failed to update entity's subscribers: %w", err)
-	}
+	return db.RunInTransaction(ctx, func(ctx context.Context) error {
+		// Update user subscription list
+		_, err := db.SubscribersCollection.UpdateOne(ctx, bson.M{"userid": userID}, opCurrent, options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("failed to update user's subscriptions: %w", err)
+		}
 
-	// Emit MQ event
-	m := models.Index{EntityType: entityType, EntityId: userID, Method: method, ItemId: entityID}
-	go mq.Emit(ctx, event, m)
+		// Update target entity's subscribers list
+		_, err = db.SubscribersCollection.UpdateOne(ctx, bson.M{"userid": entityID}, opTarget, options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("failed to update entity's subscribers: %w", err)
+		}
 
-	return nil
+		// Emit MQ event
+		m := models.Index{EntityType: entityType, EntityId: userID, Method: method, ItemId: entityID}
+		return mq.Emit(ctx, event, m)
+	})
 }
 
 // Helper: ensure entry exists in collection
@@ -154,14 +155,14 @@ func EnsureSubscriptionEntry(userID string) {
 func GetSubscribers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	targetUserID := ps.ByName("id")
 	if targetUserID == "" {
-		http.Error(w, "Target user ID required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Target user ID required")
 		return
 	}
 
 	var sub models.UserSubscribe
 	err := db.SubscribersCollection.FindOne(r.Context(), bson.M{"userid": targetUserID}).Decode(&sub)
 	if err != nil && err != mongo.ErrNoDocuments {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -173,14 +174,14 @@ func GetSubscribers(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	cursor, err := db.SubscribersCollection.Find(r.Context(), bson.M{"userid": bson.M{"$in": sub.Subscribers}})
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	defer cursor.Close(r.Context())
 
 	var subscribers []models.User
 	if err := cursor.All(r.Context(), &subscribers); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
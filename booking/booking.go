@@ -3,6 +3,7 @@ package booking
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/utils"
 	"net/http"
@@ -85,7 +86,7 @@ func ListTiers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer cancel()
 	cur, err := db.TiersCollection.Find(ctx, filter)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	defer cur.Close(ctx)
@@ -102,13 +103,13 @@ func ListTiers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func CreateTier(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var tier Tier
 	if err := json.NewDecoder(r.Body).Decode(&tier); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
 
 	// basic validation
 	if tier.ID == "" || tier.EntityType == "" || tier.EntityId == "" || tier.Name == "" {
-		http.Error(w, "missing required fields", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing required fields")
 		return
 	}
 
@@ -116,7 +117,7 @@ func CreateTier(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	// insert into Mongo
 	if _, err := db.TiersCollection.InsertOne(r.Context(), tier); err != nil {
-		http.Error(w, "db insert failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db insert failed")
 		return
 	}
 
@@ -126,14 +127,14 @@ func CreateTier(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func DeleteTier(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	tierId := ps.ByName("id")
 	if tierId == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing id")
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_, err := db.TiersCollection.DeleteOne(ctx, bson.M{"id": tierId})
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	// Note: we do not automatically delete slots/bookings tied to this tier here.
@@ -145,7 +146,7 @@ func DeleteTier(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func GenerateSlotsFromTier(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	tierId := ps.ByName("id")
 	if tierId == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing id")
 		return
 	}
 
@@ -154,11 +155,11 @@ func GenerateSlotsFromTier(w http.ResponseWriter, r *http.Request, ps httprouter
 		EndDate   string `json:"endDate"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 	if body.StartDate == "" || body.EndDate == "" {
-		http.Error(w, "missing date range", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing date range")
 		return
 	}
 
@@ -167,14 +168,14 @@ func GenerateSlotsFromTier(w http.ResponseWriter, r *http.Request, ps httprouter
 
 	var tier Tier
 	if err := db.TiersCollection.FindOne(ctx, bson.M{"id": tierId}).Decode(&tier); err != nil {
-		http.Error(w, "tier not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "tier not found")
 		return
 	}
 
 	startDate, err1 := time.Parse("2006-01-02", body.StartDate)
 	endDate, err2 := time.Parse("2006-01-02", body.EndDate)
 	if err1 != nil || err2 != nil || startDate.After(endDate) {
-		http.Error(w, "invalid date range", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid date range")
 		return
 	}
 
@@ -223,7 +224,7 @@ func GenerateSlotsFromTier(w http.ResponseWriter, r *http.Request, ps httprouter
 		}
 		_, err := db.SlotCollection.InsertMany(ctx, docs)
 		if err != nil {
-			http.Error(w, "db error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "db error")
 			return
 		}
 	}
@@ -247,7 +248,7 @@ func ListSlots(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer cancel()
 	cur, err := db.SlotCollection.Find(ctx, filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cur.Close(ctx)
@@ -263,11 +264,11 @@ func ListSlots(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func CreateSlot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var s Slot
 	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 	if s.EntityType == "" || s.EntityId == "" || s.Date == "" || s.Start == "" || s.Capacity <= 0 {
-		http.Error(w, "missing required fields", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing required fields")
 		return
 	}
 
@@ -287,7 +288,7 @@ func CreateSlot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer cancel()
 	_, err := db.SlotCollection.InsertOne(ctx, s)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"slot": s})
@@ -296,14 +297,14 @@ func CreateSlot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func DeleteSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	slotId := ps.ByName("id")
 	if slotId == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing id")
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_, err := db.SlotCollection.DeleteOne(ctx, bson.M{"id": slotId})
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	_, _ = db.BookingsCollection.DeleteMany(ctx, bson.M{"slotId": slotId})
@@ -331,7 +332,7 @@ func ListBookings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer cancel()
 	cur, err := db.BookingsCollection.Find(ctx, filter)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	defer cur.Close(ctx)
@@ -347,11 +348,11 @@ func ListBookings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var p Booking
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 	if p.UserId == "" || p.EntityType == "" || p.EntityId == "" || p.Date == "" || p.Start == "" {
-		http.Error(w, "missing fields", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing fields")
 		return
 	}
 
@@ -364,7 +365,7 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		"userId": p.UserId, "date": p.Date, "status": bson.M{"$ne": "cancelled"},
 	})
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	if count > 0 {
@@ -386,7 +387,7 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 			"slotId": p.SlotId, "status": bson.M{"$ne": "cancelled"},
 		})
 		if err != nil {
-			http.Error(w, "db error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "db error")
 			return
 		}
 		if int(slotCount) >= slot.Capacity {
@@ -413,7 +414,7 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 			"tierId": p.TierId, "date": p.Date, "status": bson.M{"$ne": "cancelled"},
 		})
 		if err != nil {
-			http.Error(w, "db error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "db error")
 			return
 		}
 		if int(tCount) >= tier.Capacity {
@@ -438,7 +439,7 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 				"entityType": p.EntityType, "entityId": p.EntityId, "date": p.Date, "status": bson.M{"$ne": "cancelled"},
 			})
 			if err != nil {
-				http.Error(w, "db error", http.StatusInternalServerError)
+				apierr.Respond(w, http.StatusInternalServerError, "db error")
 				return
 			}
 			if int(totalCount) >= dc.Capacity {
@@ -454,7 +455,7 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	_, err = db.BookingsCollection.InsertOne(ctx, p)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "booking": p})
@@ -464,18 +465,18 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 func UpdateBookingStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	bookingId := ps.ByName("id")
 	if bookingId == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing id")
 		return
 	}
 	var body struct {
 		Status string `json:"status"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 	if body.Status != "pending" && body.Status != "confirmed" && body.Status != "cancelled" {
-		http.Error(w, "invalid status", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid status")
 		return
 	}
 
@@ -489,7 +490,7 @@ func UpdateBookingStatus(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	)
 	var updated Booking
 	if err := res.Decode(&updated); err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "not found")
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "booking": updated})
@@ -499,7 +500,7 @@ func UpdateBookingStatus(w http.ResponseWriter, r *http.Request, ps httprouter.P
 func CancelBooking(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	bookingId := ps.ByName("id")
 	if bookingId == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing id")
 		return
 	}
 
@@ -514,7 +515,7 @@ func CancelBooking(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	var updated Booking
 	if err := res.Decode(&updated); err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "not found")
 		return
 	}
 
@@ -530,7 +531,7 @@ func GetDateCapacity(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	entityId := r.URL.Query().Get("entityId")
 	date := r.URL.Query().Get("date")
 	if entityType == "" || entityId == "" || date == "" {
-		http.Error(w, "missing params", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing params")
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -549,11 +550,11 @@ func GetDateCapacity(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 func SetDateCapacity(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var p DateCap
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 	if p.EntityType == "" || p.EntityId == "" || p.Date == "" || p.Capacity <= 0 {
-		http.Error(w, "missing fields", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing fields")
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -564,7 +565,7 @@ func SetDateCapacity(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 		options.Update().SetUpsert(true),
 	)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "db error")
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
+	"naevis/mail"
 	"naevis/models"
+	"naevis/money"
 	"naevis/utils"
 
 	"github.com/julienschmidt/httprouter"
@@ -26,19 +30,19 @@ func AddToCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var item models.CartItem
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
 		log.Println("AddToCart decode error:", err)
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	item.UserID = userID
 
-	if item.ItemId == "" || item.ItemName == "" || item.Category == "" || item.Quantity <= 0 || item.Price <= 0 {
-		http.Error(w, "Missing or invalid fields", http.StatusBadRequest)
+	if item.ItemId == "" || item.ItemName == "" || item.Category == "" || item.Quantity <= 0 || !item.Price.IsPositive() {
+		apierr.Respond(w, http.StatusBadRequest, "Missing or invalid fields")
 		return
 	}
 
@@ -64,13 +68,13 @@ func AddToCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	if _, err := db.CartCollection.UpdateOne(ctx, filter, update, opts); err != nil {
 		log.Println("AddToCart UpdateOne error:", err)
-		http.Error(w, "Failed to add to cart", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to add to cart")
 		return
 	}
 
 	groupedCart, err := getGroupedCart(ctx, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch updated cart", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch updated cart")
 		return
 	}
 
@@ -89,17 +93,17 @@ func UpdateCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Println("UpdateCart decode error:", err)
-		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON request")
 		return
 	}
 	if payload.Category == "" {
-		http.Error(w, "Category is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Category is required")
 		return
 	}
 
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -109,7 +113,7 @@ func UpdateCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		"category": payload.Category,
 	}); err != nil {
 		log.Println("UpdateCart DeleteMany error:", err)
-		http.Error(w, "Failed to clear existing cart items", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to clear existing cart items")
 		return
 	}
 
@@ -125,14 +129,14 @@ func UpdateCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		}
 		if _, err := db.CartCollection.InsertMany(ctx, docs); err != nil {
 			log.Println("UpdateCart InsertMany error:", err)
-			http.Error(w, "Failed to update cart", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to update cart")
 			return
 		}
 	}
 
 	groupedCart, err := getGroupedCart(ctx, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch updated cart", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch updated cart")
 		return
 	}
 
@@ -147,13 +151,13 @@ func GetCart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	groupedCart, err := getGroupedCart(ctx, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch cart")
 		return
 	}
 
@@ -173,13 +177,13 @@ func CreateCheckoutSession(w http.ResponseWriter, r *http.Request, _ httprouter.
 	var session models.CheckoutSession
 	if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
 		log.Println("CreateCheckoutSession decode error:", err)
-		http.Error(w, "Invalid session data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid session data")
 		return
 	}
 
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -198,13 +202,13 @@ func PlaceOrder(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var order models.Order
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
 		log.Println("PlaceOrder decode error:", err)
-		http.Error(w, "Invalid order payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid order payload")
 		return
 	}
 
 	userID := utils.GetUserIDFromRequest(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	order.UserID = userID
@@ -221,14 +225,19 @@ func PlaceOrder(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// Fetch the latest cart and store it in the order
 	cartItems, err := getGroupedCart(ctx, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch cart for order", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch cart for order")
 		return
 	}
 	order.Items = cartItems
+	// The total is what the cart adds up to, whatever the client sent.
+	if order.Total, err = cartTotal(cartItems); err != nil {
+		apierr.Respond(w, http.StatusUnprocessableEntity, "Cart items must all be priced in one currency")
+		return
+	}
 
 	if _, err := db.OrderCollection.InsertOne(ctx, order); err != nil {
 		log.Println("PlaceOrder InsertOne error:", err)
-		http.Error(w, "Order creation failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Order creation failed")
 		return
 	}
 
@@ -237,9 +246,30 @@ func PlaceOrder(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		log.Println("PlaceOrder Cart cleanup error:", err)
 	}
 
+	if err := mail.QueueToUser(ctx, userID, "order-confirmation", order); err != nil {
+		slog.WarnContext(ctx, "order confirmation email not queued", "user_id", userID, "error", err)
+	}
+
 	utils.RespondWithJSON(w, http.StatusCreated, order)
 }
 
+// cartTotal adds up the price of every item in a grouped cart.
+func cartTotal(grouped map[string][]models.CartItem) (money.Money, error) {
+	var total money.Money
+	for _, items := range grouped {
+		for _, item := range items {
+			line, err := item.Price.Mul(int64(item.Quantity))
+			if err != nil {
+				return money.Money{}, err
+			}
+			if total, err = total.Add(line); err != nil {
+				return money.Money{}, err
+			}
+		}
+	}
+	return total, nil
+}
+
 // getGroupedCart fetches all cart items for a user and groups them by category
 func getGroupedCart(ctx context.Context, userID string) (map[string][]models.CartItem, error) {
 	filter := bson.M{"userId": userID}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 
 	"github.com/julienschmidt/httprouter"
@@ -36,7 +37,7 @@ type CouponResponse struct {
 func ValidateCouponHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var req CouponRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
 		return
 	}
 
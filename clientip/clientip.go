@@ -0,0 +1,64 @@
+// Package clientip resolves the address of the client that made a
+// request when the server sits behind reverse proxies.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver resolves the client address of a request, believing
+// X-Forwarded-For only when it was appended by a known proxy.
+type Resolver struct {
+	prefixes []netip.Prefix
+}
+
+// New returns a Resolver that trusts proxies in prefixes. With none it
+// always uses the connection address.
+func New(prefixes []netip.Prefix) *Resolver {
+	return &Resolver{prefixes: prefixes}
+}
+
+func (t *Resolver) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range t.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IP returns the connection address unless it belongs to a trusted
+// proxy. In that case X-Forwarded-For is walked from the right, skipping
+// further trusted hops, and the first untrusted address is the client.
+// Entries left of it were supplied by the client and are ignored.
+func (t *Resolver) IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !t.contains(remote) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !t.contains(client) {
+			break
+		}
+	}
+	return client.String()
+}
@@ -0,0 +1,34 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	tp := New([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+	})
+
+	cases := []struct {
+		name, remote, xff, want string
+	}{
+		{"direct client ignores header", "203.0.113.9:5000", "1.2.3.4", "203.0.113.9"},
+		{"trusted proxy", "10.0.0.2:80", "198.51.100.7", "198.51.100.7"},
+		{"spoofed left entries skipped", "10.0.0.2:80", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"chained trusted proxies", "10.0.0.2:80", "198.51.100.7, 10.1.1.1", "198.51.100.7"},
+		{"trusted proxy without header", "10.0.0.2:80", "", "10.0.0.2"},
+		{"garbage header", "10.0.0.2:80", "not-an-ip", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.xff != "" {
+			r.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := tp.IP(r); got != c.want {
+			t.Errorf("%s: IP = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -2,19 +2,28 @@ package comments
 
 import (
 	"context"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/pagination"
 	"naevis/utils"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GetComments returns paginated and sorted comments for an entity
+// commentSorts maps ?sort= to a keyset ordering; _id breaks ties. Comments
+// carry no like count, so "likes" falls back to newest first.
+var commentSorts = map[string]pagination.Sort{
+	"new": {Field: "created_at", IDField: "_id", Desc: true},
+	"old": {Field: "created_at", IDField: "_id"},
+}
+
+// GetComments returns one page of comments for an entity, sorted by
+// ?sort= (new or old).
 func GetComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -22,44 +31,37 @@ func GetComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	entityType := ps.ByName("entitytype")
 	entityId := ps.ByName("entityid")
 
-	// Pagination
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	sortBy := r.URL.Query().Get("sort") // "new", "old", "likes"
-
-	page := 1
-	limit := 10
-	if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-		page = p
+	page, err := pagination.Parse(r, 10, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
 	}
-	if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-		limit = l
+	order, ok := commentSorts[r.URL.Query().Get("sort")]
+	if !ok {
+		order = commentSorts["new"]
 	}
 
-	filter := bson.M{
+	filter := order.Filter(bson.M{
 		"entity_type": entityType,
 		"entity_id":   entityId,
-	}
+	}, page.After)
 
-	// Sorting
-	findOptions := options.Find()
-	findOptions.SetSkip(int64((page - 1) * limit))
-	findOptions.SetLimit(int64(limit))
-
-	switch sortBy {
-	case "old":
-		findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
-	case "likes":
-		findOptions.SetSort(bson.D{{Key: "likes", Value: -1}})
-	default: // "new"
-		findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
-	}
-
-	comments, err := utils.FindAndDecode[models.Comment](ctx, db.CommentsCollection, filter, findOptions)
+	comments, err := utils.FindAndDecode[models.Comment](ctx, db.CommentsCollection, filter, order.FindOptions(page.Limit))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch comments")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch comments")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, comments)
+	comments, next := pagination.Trim(comments, page.Limit, commentCursor)
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(comments, next))
+}
+
+// commentCursor uses the stored ObjectID, not its hex form, so the cursor
+// compares correctly against _id.
+func commentCursor(c models.Comment) pagination.Cursor {
+	var id any = c.ID
+	if oid, err := primitive.ObjectIDFromHex(c.ID); err == nil {
+		id = oid
+	}
+	return pagination.Cursor{Key: c.CreatedAt, ID: id}
 }
@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -29,19 +30,19 @@ func CreateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	if strings.TrimSpace(body.Content) == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Comment cannot be empty")
+		apierr.Respond(w, http.StatusBadRequest, "Comment cannot be empty")
 		return
 	}
 
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -56,7 +57,7 @@ func CreateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	res, err := db.CommentsCollection.InsertOne(ctx, comment)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "DB insert failed")
+		apierr.Respond(w, http.StatusInternalServerError, "DB insert failed")
 		return
 	}
 	comment.ID = res.InsertedID.(primitive.ObjectID).Hex()
@@ -72,14 +73,14 @@ func GetComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	commentID := ps.ByName("commentid") // Correctly get the comment ID
 	objID, err := primitive.ObjectIDFromHex(commentID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid ID")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	var comment models.Comment
 	err = db.CommentsCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&comment)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Comment not found")
+		apierr.Respond(w, http.StatusNotFound, "Comment not found")
 		return
 	}
 
@@ -94,7 +95,7 @@ func UpdateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	commentID := ps.ByName("commentid")
 	objID, err := primitive.ObjectIDFromHex(commentID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid ID")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
@@ -102,14 +103,14 @@ func UpdateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -117,11 +118,11 @@ func UpdateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var existing models.Comment
 	err = db.CommentsCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&existing)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Comment not found")
+		apierr.Respond(w, http.StatusNotFound, "Comment not found")
 		return
 	}
 	if existing.CreatedBy != claims.UserID {
-		utils.RespondWithError(w, http.StatusForbidden, "Forbidden")
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
@@ -134,14 +135,14 @@ func UpdateComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	_, err = db.CommentsCollection.UpdateByID(ctx, objID, update)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "DB update failed")
+		apierr.Respond(w, http.StatusInternalServerError, "DB update failed")
 		return
 	}
 
 	// Return updated comment
 	err = db.CommentsCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&existing)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Fetch failed")
+		apierr.Respond(w, http.StatusInternalServerError, "Fetch failed")
 		return
 	}
 
@@ -156,32 +157,32 @@ func DeleteComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	commentID := ps.ByName("commentid")
 	objID, err := primitive.ObjectIDFromHex(commentID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid ID")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	var existing models.Comment
 	err = db.CommentsCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&existing)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Comment not found")
+		apierr.Respond(w, http.StatusNotFound, "Comment not found")
 		return
 	}
 
 	if existing.CreatedBy != claims.UserID {
-		utils.RespondWithError(w, http.StatusForbidden, "Forbidden")
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	_, err = db.CommentsCollection.DeleteOne(ctx, bson.M{"_id": objID})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Delete failed")
+		apierr.Respond(w, http.StatusInternalServerError, "Delete failed")
 		return
 	}
 
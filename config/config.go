@@ -0,0 +1,545 @@
+// Package config loads and validates the server configuration once at
+// startup. Values come from the process environment, a .env file in the
+// working directory and an optional file named by CONFIG_FILE, in that
+// order of precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Environments. Anything other than EnvDev is treated as production-like
+// and must not run with the built-in default secrets.
+const (
+	EnvDev        = "dev"
+	EnvTest       = "test"
+	EnvProduction = "production"
+)
+
+// Storage backends. StorageMemory replaces MongoDB and Redis with
+// in-process stand-ins whose data is lost on exit.
+const (
+	StorageExternal = "external"
+	StorageMemory   = "memory"
+)
+
+// Built-in placeholders; Validate rejects them outside dev.
+const (
+	DefaultJWTSecret        = "your_secret_key"
+	DefaultTicketHMACSecret = "your-very-secret-key"
+)
+
+// Config is the typed server configuration.
+type Config struct {
+	Env            string
+	Port           string
+	AllowedOrigins []string
+	Storage        string
+
+	JWTSecret        string
+	TicketHMACSecret string
+
+	JWT       JWT
+	Mongo     Mongo
+	Redis     Redis
+	SMTP      SMTP
+	Mail      Mail
+	Public    Public
+	Log       Log
+	RateLimit RateLimit
+	Cookie    Cookie
+	Verify    Verify
+	MFA       MFA
+	OIDC      map[string]OIDCProvider // by provider name
+	Payments  Payments
+}
+
+// JWT configures access token signing.
+type JWT struct {
+	Issuer   string // iss of issued tokens; other issuers are refused
+	Audience string // aud of issued tokens; tokens for others are refused
+	// KeysDir holds the Ed25519 signing keys as <kid>.pem. Without it,
+	// dev signs with a temporary key.
+	KeysDir   string
+	ActiveKey string // kid of the signing key; optional with one private key
+}
+
+// Mongo configures the MongoDB client.
+type Mongo struct {
+	URI         string
+	Database    string
+	AuxDatabase string
+	MaxPoolSize uint64
+	MinPoolSize uint64
+	// AllowStandalone lets writes that need a transaction run without one
+	// on a standalone mongod. Only dev allows it; elsewhere the server
+	// refuses to start without a replica set.
+	AllowStandalone bool
+}
+
+// Redis configures the shared Redis client.
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// SMTP configures the smtp mail driver.
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// Mail drivers.
+const (
+	MailSMTP    = "smtp"    // deliver through the SMTP server
+	MailLog     = "log"     // log a summary of each message and drop it
+	MailMaildir = "maildir" // write each message to a maildir on disk
+)
+
+// Mail configures outgoing mail.
+type Mail struct {
+	Driver string
+	From   string
+	Dir    string // maildir root for the maildir driver
+}
+
+// Verify configures email verification codes.
+type Verify struct {
+	// Required makes endpoints wrapped in RequireVerified refuse users
+	// whose email is not verified.
+	Required       bool
+	CodeTTL        time.Duration // how long a code stays valid
+	MaxAttempts    int           // wrong guesses before a code is burned
+	ResendCooldown time.Duration // minimum time between codes to one address
+}
+
+// MFA configures two-factor authentication.
+type MFA struct {
+	Issuer string // shown next to the code in authenticator apps
+	// RequiredRoles must log in with a second factor; users holding
+	// them are made to enroll at their next login.
+	RequiredRoles []string
+}
+
+// OIDCProvider configures login through one OpenID Connect provider.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // the app page the provider sends users back to
+	Scopes       []string
+}
+
+// Payment providers.
+const (
+	PaymentsNone = "none" // card checkouts are refused
+	PaymentsFake = "fake" // the in-process fake provider; not for production
+)
+
+// Payments configures the card payment provider.
+type Payments struct {
+	Provider string
+	// WebhookSecret signs and verifies the provider's webhooks. The fake
+	// provider makes up one per process when it is empty.
+	WebhookSecret string
+}
+
+// Public controls how local file paths are turned into public URLs and
+// where links in emails point.
+type Public struct {
+	BaseURL     string
+	StripPrefix string
+	AppURL      string // the web app, for links such as password resets
+}
+
+// Log configures structured logging.
+type Log struct {
+	Level  string // debug, info, warn, error
+	Format string // json or text
+}
+
+// Cookie configures the cookies the server sets, such as the refresh
+// token.
+type Cookie struct {
+	// Secure restricts cookies to HTTPS. It defaults to off in dev so
+	// the API can be used over plain HTTP locally.
+	Secure   bool
+	SameSite string // strict, lax or none
+	Domain   string // empty: the request host only
+}
+
+// RateLimit configures the request rate limiter.
+type RateLimit struct {
+	// TrustedProxies are the networks whose X-Forwarded-For is believed,
+	// both for rate limiting and for the address recorded on sessions.
+	// Requests from anywhere else are keyed on the connection address.
+	TrustedProxies []netip.Prefix
+	// Policies override the built-in per-route policies by name.
+	Policies map[string]RatePolicy
+}
+
+// RatePolicy allows Limit requests per sliding Window.
+type RatePolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// IsDev reports whether the server runs in development mode.
+func (c *Config) IsDev() bool { return c.Env == EnvDev }
+
+// Load reads the configuration from the environment, .env and CONFIG_FILE,
+// then validates it.
+func Load() (*Config, error) {
+	vars := map[string]string{}
+
+	// .env is optional; it has the lowest precedence.
+	if dotenv, err := godotenv.Read(); err == nil {
+		merge(vars, dotenv)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file %s: %w", path, err)
+		}
+		merge(vars, file)
+	}
+
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+
+	return FromMap(vars)
+}
+
+// FromMap builds and validates a Config from key/value pairs using the same
+// keys as the environment. Tests use it to construct a config without
+// touching the process environment.
+func FromMap(vars map[string]string) (*Config, error) {
+	get := func(key, def string) string {
+		if v := strings.TrimSpace(vars[key]); v != "" {
+			return v
+		}
+		return def
+	}
+
+	cfg := &Config{
+		Env:              strings.ToLower(get("APP_ENV", EnvProduction)),
+		Port:             normalizePort(get("PORT", "4000")),
+		AllowedOrigins:   parseList(get("ALLOWED_ORIGINS", "http://localhost:5173,https://indium.netlify.app")),
+		Storage:          strings.ToLower(get("STORAGE", StorageExternal)),
+		JWTSecret:        get("JWT_SECRET", DefaultJWTSecret),
+		TicketHMACSecret: get("TICKET_HMAC_SECRET", DefaultTicketHMACSecret),
+		Mongo: Mongo{
+			URI:         get("MONGODB_URI", ""),
+			Database:    get("MONGODB_DATABASE", "eventdb"),
+			AuxDatabase: get("MONGODB_AUX_DATABASE", "naevis"),
+		},
+		Redis: Redis{
+			Addr:     get("REDIS_URL", ""),
+			Password: get("REDIS_PASSWORD", ""),
+		},
+		SMTP: SMTP{
+			Host:     get("SMTP_HOST", "smtp.gmail.com"),
+			Port:     get("SMTP_PORT", "587"),
+			Username: get("SMTP_USERNAME", ""),
+			Password: get("SMTP_PASSWORD", ""),
+		},
+		Public: Public{
+			BaseURL:     get("PUBLIC_BASE_URL", "http://localhost:4000"),
+			StripPrefix: get("PUBLIC_STRIP_PREFIX", ""),
+			AppURL:      strings.TrimRight(get("APP_URL", "http://localhost:5173"), "/"),
+		},
+	}
+	cfg.JWT = JWT{
+		Issuer:    get("JWT_ISSUER", cfg.Public.BaseURL),
+		Audience:  get("JWT_AUDIENCE", "naevis"),
+		KeysDir:   get("JWT_KEYS_DIR", ""),
+		ActiveKey: get("JWT_ACTIVE_KEY", ""),
+	}
+	defaultMailer := MailLog
+	if cfg.SMTP.Username != "" {
+		defaultMailer = MailSMTP
+	}
+	cfg.Mail = Mail{
+		Driver: strings.ToLower(get("MAIL_DRIVER", defaultMailer)),
+		From:   get("MAIL_FROM", get("SMTP_FROM", get("SMTP_USERNAME", "naevis@localhost"))),
+		Dir:    get("MAIL_DIR", "maildir"),
+	}
+	cfg.MFA = MFA{
+		Issuer:        get("MFA_ISSUER", "Naevis"),
+		RequiredRoles: parseList(get("MFA_REQUIRED_ROLES", "admin,moderator")),
+	}
+	cfg.OIDC = map[string]OIDCProvider{}
+	for _, name := range parseList(strings.ToLower(get("OIDC_PROVIDERS", ""))) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg.OIDC[name] = OIDCProvider{
+			Issuer:       strings.TrimRight(get(prefix+"ISSUER", ""), "/"),
+			ClientID:     get(prefix+"CLIENT_ID", ""),
+			ClientSecret: get(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  get(prefix+"REDIRECT_URL", cfg.Public.AppURL+"/auth/callback/"+name),
+			Scopes:       parseList(strings.ReplaceAll(get(prefix+"SCOPES", ""), " ", ",")),
+		}
+	}
+	defaultPayments := PaymentsFake
+	if cfg.Env == EnvProduction {
+		defaultPayments = PaymentsNone
+	}
+	cfg.Payments = Payments{
+		Provider:      strings.ToLower(get("PAYMENTS_PROVIDER", defaultPayments)),
+		WebhookSecret: get("PAYMENTS_WEBHOOK_SECRET", ""),
+	}
+	cfg.Cookie = Cookie{
+		SameSite: strings.ToLower(get("COOKIE_SAMESITE", "strict")),
+		Domain:   get("COOKIE_DOMAIN", ""),
+	}
+
+	defaultFormat := "json"
+	if cfg.IsDev() {
+		defaultFormat = "text"
+	}
+	cfg.Log = Log{
+		Level:  strings.ToLower(get("LOG_LEVEL", "info")),
+		Format: strings.ToLower(get("LOG_FORMAT", defaultFormat)),
+	}
+
+	cfg.Mongo.AllowStandalone = cfg.IsDev()
+
+	var errs []error
+	var err error
+	if cfg.Mongo.MaxPoolSize, err = parseUint(get("MONGODB_MAX_POOL", "100")); err != nil {
+		errs = append(errs, fmt.Errorf("MONGODB_MAX_POOL: %w", err))
+	}
+	if cfg.Mongo.MinPoolSize, err = parseUint(get("MONGODB_MIN_POOL", "10")); err != nil {
+		errs = append(errs, fmt.Errorf("MONGODB_MIN_POOL: %w", err))
+	}
+	if cfg.Redis.DB, err = strconv.Atoi(get("REDIS_DB", "0")); err != nil {
+		errs = append(errs, fmt.Errorf("REDIS_DB: %w", err))
+	}
+	if cfg.Cookie.Secure, err = strconv.ParseBool(get("COOKIE_SECURE", strconv.FormatBool(!cfg.IsDev()))); err != nil {
+		errs = append(errs, fmt.Errorf("COOKIE_SECURE: %w", err))
+	}
+	if cfg.Verify.Required, err = strconv.ParseBool(get("REQUIRE_EMAIL_VERIFICATION", "true")); err != nil {
+		errs = append(errs, fmt.Errorf("REQUIRE_EMAIL_VERIFICATION: %w", err))
+	}
+	if cfg.Verify.CodeTTL, err = time.ParseDuration(get("OTP_TTL", "10m")); err != nil {
+		errs = append(errs, fmt.Errorf("OTP_TTL: %w", err))
+	}
+	if cfg.Verify.MaxAttempts, err = strconv.Atoi(get("OTP_MAX_ATTEMPTS", "5")); err != nil {
+		errs = append(errs, fmt.Errorf("OTP_MAX_ATTEMPTS: %w", err))
+	}
+	if cfg.Verify.ResendCooldown, err = time.ParseDuration(get("OTP_RESEND_COOLDOWN", "1m")); err != nil {
+		errs = append(errs, fmt.Errorf("OTP_RESEND_COOLDOWN: %w", err))
+	}
+	if cfg.RateLimit.TrustedProxies, err = parsePrefixes(get("TRUSTED_PROXIES", "")); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+	if cfg.RateLimit.Policies, err = parsePolicies(get("RATE_LIMITS", "")); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMITS: %w", err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks required settings and refuses the built-in default
+// secrets outside dev.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Env {
+	case EnvDev, EnvTest, EnvProduction:
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV %q is not one of dev, test, production", c.Env))
+	}
+
+	switch c.Storage {
+	case StorageExternal:
+		if c.Mongo.URI == "" {
+			errs = append(errs, errors.New("MONGODB_URI is required"))
+		}
+		if c.Redis.Addr == "" {
+			errs = append(errs, errors.New("REDIS_URL is required"))
+		}
+	case StorageMemory:
+		if c.Env == EnvProduction {
+			errs = append(errs, errors.New("STORAGE=memory is not allowed in production"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE %q is not external or memory", c.Storage))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q is not json or text", c.Log.Format))
+	}
+	switch c.Cookie.SameSite {
+	case "strict", "lax":
+	case "none":
+		if !c.Cookie.Secure {
+			errs = append(errs, errors.New("COOKIE_SAMESITE=none requires COOKIE_SECURE"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("COOKIE_SAMESITE %q is not strict, lax or none", c.Cookie.SameSite))
+	}
+	if c.Verify.CodeTTL < time.Minute {
+		errs = append(errs, errors.New("OTP_TTL must be at least 1m"))
+	}
+	if c.Verify.MaxAttempts < 1 {
+		errs = append(errs, errors.New("OTP_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.Verify.ResendCooldown < 0 || c.Verify.ResendCooldown >= c.Verify.CodeTTL {
+		errs = append(errs, errors.New("OTP_RESEND_COOLDOWN must be between 0 and OTP_TTL"))
+	}
+	for name, p := range c.OIDC {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		if strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			errs = append(errs, fmt.Errorf("OIDC provider name %q may only use a-z and 0-9", name))
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix))
+		} else if !strings.HasPrefix(p.Issuer, "https://") && !c.IsDev() {
+			errs = append(errs, fmt.Errorf("%sISSUER must use https outside dev", prefix))
+		}
+	}
+	if c.Mongo.MinPoolSize > c.Mongo.MaxPoolSize {
+		errs = append(errs, errors.New("MONGODB_MIN_POOL must not exceed MONGODB_MAX_POOL"))
+	}
+
+	if !c.IsDev() {
+		if c.JWTSecret == DefaultJWTSecret {
+			errs = append(errs, errors.New("JWT_SECRET must be set outside dev"))
+		}
+		if c.TicketHMACSecret == DefaultTicketHMACSecret {
+			errs = append(errs, errors.New("TICKET_HMAC_SECRET must be set outside dev"))
+		}
+		if len(c.JWTSecret) < 32 {
+			errs = append(errs, errors.New("JWT_SECRET must be at least 32 bytes outside dev"))
+		}
+		if c.JWT.KeysDir == "" {
+			errs = append(errs, errors.New("JWT_KEYS_DIR must be set outside dev"))
+		}
+		if !c.Cookie.Secure {
+			errs = append(errs, errors.New("COOKIE_SECURE must be on outside dev"))
+		}
+	}
+	if c.SMTP.Username != "" && c.SMTP.Password == "" {
+		errs = append(errs, errors.New("SMTP_PASSWORD is required when SMTP_USERNAME is set"))
+	}
+	switch c.Mail.Driver {
+	case MailSMTP:
+		if c.SMTP.Host == "" {
+			errs = append(errs, errors.New("SMTP_HOST is required for MAIL_DRIVER=smtp"))
+		}
+	case MailLog, MailMaildir:
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER %q is not smtp, log or maildir", c.Mail.Driver))
+	}
+	switch c.Payments.Provider {
+	case PaymentsNone:
+	case PaymentsFake:
+		if c.Env == EnvProduction {
+			errs = append(errs, errors.New("PAYMENTS_PROVIDER=fake is not allowed in production"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PAYMENTS_PROVIDER %q is not none or fake", c.Payments.Provider))
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("MAIL_FROM %q: %w", c.Mail.From, err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func merge(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+func normalizePort(p string) string {
+	if p[0] != ':' {
+		return ":" + p
+	}
+	return p
+}
+
+func parseList(s string) []string {
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func parseUint(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parsePrefixes parses a comma-separated list of CIDRs. A bare address is
+// taken as a single-host prefix.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, p := range parseList(s) {
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+// parsePolicies parses "name=limit/window" pairs, e.g. "auth=10/1m,default=120/1m".
+func parsePolicies(s string) (map[string]RatePolicy, error) {
+	out := map[string]RatePolicy{}
+	for _, p := range parseList(s) {
+		name, spec, ok := strings.Cut(p, "=")
+		limit, window, ok2 := strings.Cut(spec, "/")
+		if !ok || !ok2 || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%q is not name=limit/window", p)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q: limit must be a positive integer", p)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("%q: window must be a duration of at least 1s", p)
+		}
+		out[strings.TrimSpace(name)] = RatePolicy{Limit: n, Window: d}
+	}
+	return out, nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func baseVars() map[string]string {
+	return map[string]string{
+		"MONGODB_URI": "mongodb://localhost:27017",
+		"REDIS_URL":   "localhost:6379",
+	}
+}
+
+func TestDefaultSecretsAllowedInDev(t *testing.T) {
+	vars := baseVars()
+	vars["APP_ENV"] = "dev"
+
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if cfg.JWTSecret != DefaultJWTSecret {
+		t.Errorf("JWTSecret = %q, want default", cfg.JWTSecret)
+	}
+	if cfg.Port != ":4000" {
+		t.Errorf("Port = %q, want :4000", cfg.Port)
+	}
+	if !cfg.Mongo.AllowStandalone {
+		t.Error("dev does not allow a standalone MongoDB")
+	}
+}
+
+func TestDefaultSecretsRejectedOutsideDev(t *testing.T) {
+	_, err := FromMap(baseVars())
+	if err == nil {
+		t.Fatal("expected production config with default secrets to fail")
+	}
+	for _, want := range []string{"JWT_SECRET", "TICKET_HMAC_SECRET", "JWT_KEYS_DIR"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestProductionConfig(t *testing.T) {
+	vars := baseVars()
+	vars["JWT_SECRET"] = strings.Repeat("s", 32)
+	vars["TICKET_HMAC_SECRET"] = "ticket-secret"
+	vars["JWT_KEYS_DIR"] = "/run/secrets/jwt"
+	vars["PORT"] = "8080"
+	vars["ALLOWED_ORIGINS"] = " https://a.example , ,https://b.example"
+
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if cfg.Port != ":8080" {
+		t.Errorf("Port = %q, want :8080", cfg.Port)
+	}
+	if cfg.Mongo.AllowStandalone {
+		t.Error("production allows a standalone MongoDB")
+	}
+	if len(cfg.AllowedOrigins) != 2 || cfg.AllowedOrigins[1] != "https://b.example" {
+		t.Errorf("AllowedOrigins = %v", cfg.AllowedOrigins)
+	}
+}
+
+func TestMissingConnections(t *testing.T) {
+	_, err := FromMap(map[string]string{"APP_ENV": "dev"})
+	if err == nil || !strings.Contains(err.Error(), "MONGODB_URI") || !strings.Contains(err.Error(), "REDIS_URL") {
+		t.Fatalf("expected missing MONGODB_URI and REDIS_URL, got %v", err)
+	}
+}
+
+func TestRateLimitSettings(t *testing.T) {
+	vars := baseVars()
+	vars["APP_ENV"] = "dev"
+	vars["TRUSTED_PROXIES"] = "10.0.0.0/8, 192.168.1.7"
+	vars["RATE_LIMITS"] = "auth=5/30s,default=200/1m"
+
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if got := len(cfg.RateLimit.TrustedProxies); got != 2 {
+		t.Fatalf("TrustedProxies = %v", cfg.RateLimit.TrustedProxies)
+	}
+	if p := cfg.RateLimit.TrustedProxies[1]; p.String() != "192.168.1.7/32" {
+		t.Errorf("bare address parsed as %s", p)
+	}
+	if p := cfg.RateLimit.Policies["auth"]; p.Limit != 5 || p.Window.Seconds() != 30 {
+		t.Errorf("auth policy = %+v", p)
+	}
+
+	vars["RATE_LIMITS"] = "auth=0/1m"
+	if _, err := FromMap(vars); err == nil || !strings.Contains(err.Error(), "RATE_LIMITS") {
+		t.Errorf("expected RATE_LIMITS error, got %v", err)
+	}
+}
+
+func TestMemoryStorageNeedsNoBackends(t *testing.T) {
+	cfg, err := FromMap(map[string]string{"APP_ENV": "dev", "STORAGE": "memory"})
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if cfg.Storage != StorageMemory {
+		t.Errorf("Storage = %q, want memory", cfg.Storage)
+	}
+
+	_, err = FromMap(map[string]string{"STORAGE": "memory",
+		"JWT_SECRET": strings.Repeat("s", 32), "TICKET_HMAC_SECRET": "t"})
+	if err == nil || !strings.Contains(err.Error(), "STORAGE") {
+		t.Errorf("memory storage in production: err = %v", err)
+	}
+}
+
+func TestCookieSettings(t *testing.T) {
+	vars := baseVars()
+	vars["APP_ENV"] = "dev"
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if cfg.Cookie.Secure || cfg.Cookie.SameSite != "strict" {
+		t.Errorf("dev cookie = %+v, want insecure strict", cfg.Cookie)
+	}
+
+	vars["COOKIE_SAMESITE"] = "none"
+	if _, err := FromMap(vars); err == nil || !strings.Contains(err.Error(), "COOKIE_SECURE") {
+		t.Errorf("SameSite=none without Secure: err = %v", err)
+	}
+
+	vars = baseVars()
+	vars["JWT_SECRET"] = strings.Repeat("s", 32)
+	vars["TICKET_HMAC_SECRET"] = "t"
+	vars["COOKIE_SECURE"] = "false"
+	if _, err := FromMap(vars); err == nil || !strings.Contains(err.Error(), "COOKIE_SECURE") {
+		t.Errorf("insecure cookies in production: err = %v", err)
+	}
+}
+
+func TestOIDCProviders(t *testing.T) {
+	vars := baseVars()
+	vars["APP_ENV"] = "dev"
+	vars["APP_URL"] = "https://app.example.com/"
+	vars["OIDC_PROVIDERS"] = "Google, local"
+	vars["OIDC_GOOGLE_ISSUER"] = "https://accounts.google.com/"
+	vars["OIDC_GOOGLE_CLIENT_ID"] = "g-client"
+	vars["OIDC_LOCAL_ISSUER"] = "http://localhost:9000"
+	vars["OIDC_LOCAL_CLIENT_ID"] = "naevis"
+	vars["OIDC_LOCAL_SCOPES"] = "openid email"
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	g := cfg.OIDC["google"]
+	if g.Issuer != "https://accounts.google.com" || g.RedirectURL != "https://app.example.com/auth/callback/google" {
+		t.Errorf("google = %+v", g)
+	}
+	if s := cfg.OIDC["local"].Scopes; len(s) != 2 {
+		t.Errorf("local scopes = %v", s)
+	}
+
+	vars["APP_ENV"] = "production"
+	vars["JWT_SECRET"] = strings.Repeat("s", 32)
+	vars["TICKET_HMAC_SECRET"] = "t"
+	delete(vars, "OIDC_GOOGLE_CLIENT_ID")
+	_, err = FromMap(vars)
+	if err == nil || !strings.Contains(err.Error(), "OIDC_GOOGLE_ISSUER and OIDC_GOOGLE_CLIENT_ID") || !strings.Contains(err.Error(), "OIDC_LOCAL_ISSUER must use https") {
+		t.Errorf("invalid providers: err = %v", err)
+	}
+}
+
+func TestPaymentsProvider(t *testing.T) {
+	vars := baseVars()
+	vars["APP_ENV"] = "dev"
+	cfg, err := FromMap(vars)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if cfg.Payments.Provider != PaymentsFake {
+		t.Errorf("dev provider = %q, want fake", cfg.Payments.Provider)
+	}
+
+	vars = baseVars()
+	vars["JWT_SECRET"] = strings.Repeat("s", 32)
+	vars["TICKET_HMAC_SECRET"] = "ticket-secret"
+	vars["JWT_KEYS_DIR"] = "/run/secrets/jwt"
+	vars["PAYMENTS_PROVIDER"] = "fake"
+	if _, err := FromMap(vars); err == nil || !strings.Contains(err.Error(), "PAYMENTS_PROVIDER") {
+		t.Errorf("fake provider in production: err = %v", err)
+	}
+}
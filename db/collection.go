@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection is the subset of *mongo.Collection the handlers use. The
+// package globals have this type so a Store can be backed by something
+// other than a live cluster.
+type Collection interface {
+	Name() string
+
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateByID(ctx context.Context, id, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+}
+
+var _ Collection = (*mongo.Collection)(nil)
+
+// indexer is implemented by collections that support index management.
+type indexer interface {
+	Indexes() mongo.IndexView
+}
+
+// modelIndexer is implemented by stand-ins that interpret index models
+// themselves, such as the in-memory collections enforcing unique keys.
+type modelIndexer interface {
+	CreateIndexModels(ctx context.Context, models []mongo.IndexModel) error
+}
+
+// CreateIndexes creates the given indexes on coll. Collections that
+// manage neither kind of index are skipped.
+func CreateIndexes(ctx context.Context, coll Collection, models ...mongo.IndexModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+	switch ix := coll.(type) {
+	case indexer:
+		_, err := ix.Indexes().CreateMany(ctx, models)
+		return err
+	case modelIndexer:
+		return ix.CreateIndexModels(ctx, models)
+	}
+	return nil
+}
+
+// DropIndex drops the named index from coll. A missing index, or a
+// collection that does not manage indexes, is not an error.
+func DropIndex(ctx context.Context, coll Collection, name string) error {
+	ix, ok := coll.(indexer)
+	if !ok {
+		return nil
+	}
+	_, err := ix.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFound || cmdErr.Code == namespaceNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Server error codes DropIndex tolerates.
+const (
+	namespaceNotFound = 26
+	indexNotFound     = 27
+)
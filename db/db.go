@@ -2,190 +2,437 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os"
-	"os/signal"
+	"log/slog"
 	"runtime"
 	"time"
 
-	"github.com/joho/godotenv"
+	"naevis/config"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// The package globals are bound from a Store by Use. Handlers keep using
+// them directly; tests and tools bind a different Store.
 var (
 	Client *mongo.Client
 	// Your collections:
-	AnalyticsCollection         *mongo.Collection
-	AccountsCollection          *mongo.Collection
-	AppealsCollection           *mongo.Collection
-	MapsCollection              *mongo.Collection
-	CartCollection              *mongo.Collection
-	OrderCollection             *mongo.Collection
-	CatalogueCollection         *mongo.Collection
-	FarmsCollection             *mongo.Collection
-	FarmOrdersCollection        *mongo.Collection
-	CropsCollection             *mongo.Collection
-	CommentsCollection          *mongo.Collection
-	HashtagCollection           *mongo.Collection
-	UserCollection              *mongo.Collection
-	TransactionCollection       *mongo.Collection
-	LikesCollection             *mongo.Collection
-	ProductCollection           *mongo.Collection
-	IdempotencyCollection       *mongo.Collection
-	ItineraryCollection         *mongo.Collection
-	JournalCollection           *mongo.Collection
-	UserDataCollection          *mongo.Collection
-	TicketsCollection           *mongo.Collection
-	BehindTheScenesCollection   *mongo.Collection
-	PurchasedTicketsCollection  *mongo.Collection
-	ReviewsCollection           *mongo.Collection
-	SettingsCollection          *mongo.Collection
-	FollowingsCollection        *mongo.Collection
-	PlacesCollection            *mongo.Collection
-	SlotCollection              *mongo.Collection
-	DateCapsCollection          *mongo.Collection
-	BookingsCollection          *mongo.Collection
-	PostsCollection             *mongo.Collection
-	ZzonesCollection            *mongo.Collection
-	BlogPostsCollection         *mongo.Collection
-	FilesCollection             *mongo.Collection
-	MerchCollection             *mongo.Collection
-	MenuCollection              *mongo.Collection
-	ActivitiesCollection        *mongo.Collection
-	EventsCollection            *mongo.Collection
-	ArtistEventsCollection      *mongo.Collection
-	SongsCollection             *mongo.Collection
-	CouponCollection            *mongo.Collection
-	MediaCollection             *mongo.Collection
-	ArtistsCollection           *mongo.Collection
-	ChatsCollection             *mongo.Collection
-	MessagesCollection          *mongo.Collection
-	ReportsCollection           *mongo.Collection
-	RecipeCollection            *mongo.Collection
-	BaitoCollection             *mongo.Collection
-	ModeratorApplications       *mongo.Collection
-	BaitoApplicationsCollection *mongo.Collection
-	BaitoWorkerCollection       *mongo.Collection
-	TiersCollection             *mongo.Collection
-	SearchCollection            *mongo.Collection
-	ServiceCollection           *mongo.Collection
-	SubscribersCollection       *mongo.Collection
+	AnalyticsCollection         Collection
+	AccountsCollection          Collection
+	AppealsCollection           Collection
+	MapsCollection              Collection
+	CartCollection              Collection
+	OrderCollection             Collection
+	OutboxCollection            Collection
+	CatalogueCollection         Collection
+	FarmsCollection             Collection
+	FarmOrdersCollection        Collection
+	CropsCollection             Collection
+	CommentsCollection          Collection
+	HashtagCollection           Collection
+	UserCollection              Collection
+	TransactionCollection       Collection
+	LikesCollection             Collection
+	ProductCollection           Collection
+	IdempotencyCollection       Collection
+	ItineraryCollection         Collection
+	JournalCollection           Collection
+	UserDataCollection          Collection
+	TicketsCollection           Collection
+	BehindTheScenesCollection   Collection
+	PurchasedTicketsCollection  Collection
+	ReviewsCollection           Collection
+	SettingsCollection          Collection
+	FollowingsCollection        Collection
+	PlacesCollection            Collection
+	SlotCollection              Collection
+	DateCapsCollection          Collection
+	BookingsCollection          Collection
+	PostsCollection             Collection
+	ZzonesCollection            Collection
+	BlogPostsCollection         Collection
+	FilesCollection             Collection
+	MerchCollection             Collection
+	MenuCollection              Collection
+	ActivitiesCollection        Collection
+	EventsCollection            Collection
+	ArtistEventsCollection      Collection
+	SongsCollection             Collection
+	CouponCollection            Collection
+	MediaCollection             Collection
+	ArtistsCollection           Collection
+	ChatsCollection             Collection
+	MessagesCollection          Collection
+	MigrationsCollection        Collection
+	JobRunsCollection           Collection
+	SessionsCollection          Collection
+	RefreshTokensCollection     Collection
+	MFACollection               Collection
+	IdentitiesCollection        Collection
+	ReconciliationsCollection   Collection
+	LedgerAuditCollection       Collection
+	CheckoutsCollection         Collection
+	ExchangeRatesCollection     Collection
+	ReportsCollection           Collection
+	RecipeCollection            Collection
+	BaitoCollection             Collection
+	ModeratorApplications       Collection
+	BaitoApplicationsCollection Collection
+	BaitoWorkerCollection       Collection
+	TiersCollection             Collection
+	SearchCollection            Collection
+	ServiceCollection           Collection
+	SubscribersCollection       Collection
+	SearchIndexCollection       Collection
 )
 
+// current is the Store bound by Use.
+var current *Store
+
 // limiter chan to cap concurrent Mongo ops
 var mongoLimiter = make(chan struct{}, 100) // allow up to 100 concurrent ops
 
-func init() {
-	_ = godotenv.Load()
+// Opener returns the collection name in database.
+type Opener func(database, name string) Collection
 
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		log.Fatal("❌ MONGODB_URI environment variable not set")
-	}
+// Store holds the Mongo client and every collection the server uses.
+type Store struct {
+	Client *mongo.Client
+	// standalone is set when Client talks to a standalone mongod, which
+	// cannot run transactions. Connect allows it only when told to.
+	standalone bool
+
+	AnalyticsCollection         Collection
+	AccountsCollection          Collection
+	AppealsCollection           Collection
+	MapsCollection              Collection
+	CartCollection              Collection
+	OrderCollection             Collection
+	OutboxCollection            Collection
+	CatalogueCollection         Collection
+	FarmsCollection             Collection
+	FarmOrdersCollection        Collection
+	CropsCollection             Collection
+	CommentsCollection          Collection
+	HashtagCollection           Collection
+	UserCollection              Collection
+	TransactionCollection       Collection
+	LikesCollection             Collection
+	ProductCollection           Collection
+	IdempotencyCollection       Collection
+	ItineraryCollection         Collection
+	JournalCollection           Collection
+	UserDataCollection          Collection
+	TicketsCollection           Collection
+	BehindTheScenesCollection   Collection
+	PurchasedTicketsCollection  Collection
+	ReviewsCollection           Collection
+	SettingsCollection          Collection
+	FollowingsCollection        Collection
+	PlacesCollection            Collection
+	SlotCollection              Collection
+	DateCapsCollection          Collection
+	BookingsCollection          Collection
+	PostsCollection             Collection
+	ZzonesCollection            Collection
+	BlogPostsCollection         Collection
+	FilesCollection             Collection
+	MerchCollection             Collection
+	MenuCollection              Collection
+	ActivitiesCollection        Collection
+	EventsCollection            Collection
+	ArtistEventsCollection      Collection
+	SongsCollection             Collection
+	CouponCollection            Collection
+	MediaCollection             Collection
+	ArtistsCollection           Collection
+	ChatsCollection             Collection
+	MessagesCollection          Collection
+	MigrationsCollection        Collection
+	JobRunsCollection           Collection
+	SessionsCollection          Collection
+	RefreshTokensCollection     Collection
+	MFACollection               Collection
+	IdentitiesCollection        Collection
+	ReconciliationsCollection   Collection
+	LedgerAuditCollection       Collection
+	CheckoutsCollection         Collection
+	ExchangeRatesCollection     Collection
+	ReportsCollection           Collection
+	RecipeCollection            Collection
+	BaitoCollection             Collection
+	ModeratorApplications       Collection
+	BaitoApplicationsCollection Collection
+	BaitoWorkerCollection       Collection
+	TiersCollection             Collection
+	SearchCollection            Collection
+	ServiceCollection           Collection
+	SubscribersCollection       Collection
+	SearchIndexCollection       Collection
+
+	open   Opener
+	mainDB string
+	stop   chan struct{}
+}
+
+// NewStore builds a Store whose collections come from open. mainDB holds
+// the application collections; auxDB holds the search collections.
+func NewStore(mainDB, auxDB string, open Opener) *Store {
+	s := &Store{open: open, mainDB: mainDB, stop: make(chan struct{})}
+	s.AccountsCollection = open(mainDB, "accounts")
+	s.ActivitiesCollection = open(mainDB, "activities")
+	s.AnalyticsCollection = open(mainDB, "analytics")
+	s.AppealsCollection = open(mainDB, "appeals")
+	s.ArtistEventsCollection = open(mainDB, "artistevents")
+	s.ArtistsCollection = open(mainDB, "artists")
+	s.BaitoApplicationsCollection = open(mainDB, "baitoapply")
+	s.BaitoCollection = open(mainDB, "baitos")
+	s.BaitoWorkerCollection = open(mainDB, "baitoworkers")
+	s.BlogPostsCollection = open(mainDB, "blogposts")
+	s.BookingsCollection = open(mainDB, "bookings")
+	s.BehindTheScenesCollection = open(mainDB, "bts")
+	s.CartCollection = open(mainDB, "cart")
+	s.CatalogueCollection = open(mainDB, "catalogue")
+	s.ChatsCollection = open(mainDB, "chats")
+	s.CommentsCollection = open(mainDB, "comments")
+	s.CouponCollection = open(mainDB, "coupons")
+	s.CropsCollection = open(mainDB, "crops")
+	s.DateCapsCollection = open(mainDB, "date_caps")
+	s.EventsCollection = open(mainDB, "events")
+	s.FarmsCollection = open(mainDB, "farms")
+	s.PostsCollection = open(mainDB, "feedposts")
+	s.FilesCollection = open(mainDB, "files")
+	s.FollowingsCollection = open(mainDB, "followings")
+	s.FarmOrdersCollection = open(mainDB, "forders")
+	s.HashtagCollection = open(mainDB, "hashtags")
+	s.IdempotencyCollection = open(mainDB, "idempotency")
+	s.ItineraryCollection = open(mainDB, "itinerary")
+	s.JournalCollection = open(mainDB, "journals")
+	s.LikesCollection = open(mainDB, "likes")
+	s.MapsCollection = open(mainDB, "maps")
+	s.MediaCollection = open(mainDB, "media")
+	s.MenuCollection = open(mainDB, "menu")
+	s.MerchCollection = open(mainDB, "merch")
+	s.MessagesCollection = open(mainDB, "messages")
+	s.MigrationsCollection = open(mainDB, "migrations")
+	s.JobRunsCollection = open(mainDB, "job_runs")
+	s.MFACollection = open(mainDB, "mfa")
+	s.IdentitiesCollection = open(mainDB, "identities")
+	s.ReconciliationsCollection = open(mainDB, "reconciliations")
+	s.LedgerAuditCollection = open(mainDB, "ledger_audit")
+	s.CheckoutsCollection = open(mainDB, "checkouts")
+	s.ExchangeRatesCollection = open(mainDB, "exchange_rates")
+	s.ModeratorApplications = open(mainDB, "modapps")
+	s.OrderCollection = open(mainDB, "orders")
+	s.OutboxCollection = open(mainDB, "outbox")
+	s.PlacesCollection = open(mainDB, "places")
+	s.ProductCollection = open(mainDB, "products")
+	s.PurchasedTicketsCollection = open(mainDB, "purticks")
+	s.RecipeCollection = open(mainDB, "recipes")
+	s.RefreshTokensCollection = open(mainDB, "refresh_tokens")
+	s.ReportsCollection = open(mainDB, "reports")
+	s.ReviewsCollection = open(mainDB, "reviews")
+	s.ServiceCollection = open(mainDB, "service")
+	s.SessionsCollection = open(mainDB, "sessions")
+	s.SettingsCollection = open(mainDB, "settings")
+	s.SlotCollection = open(mainDB, "slots")
+	s.SongsCollection = open(mainDB, "songs")
+	s.SubscribersCollection = open(mainDB, "subscribers")
+	s.TicketsCollection = open(mainDB, "ticks")
+	s.TiersCollection = open(mainDB, "tiers")
+	s.TransactionCollection = open(mainDB, "transactions")
+	s.UserDataCollection = open(mainDB, "userdata")
+	s.UserCollection = open(mainDB, "users")
+	s.ZzonesCollection = open(mainDB, "zzones")
+	s.SearchIndexCollection = open(auxDB, "search")
+	s.SearchCollection = open(auxDB, "users")
+	return s
+}
 
+// Connect dials MongoDB, verifies the connection and returns a Store for
+// the configured databases. Call Close during shutdown.
+func Connect(ctx context.Context, cfg config.Mongo) (*Store, error) {
 	clientOpts := options.Client().
-		ApplyURI(uri).
-		SetMaxPoolSize(100).
-		SetMinPoolSize(10).
+		ApplyURI(cfg.URI).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
 		SetRetryWrites(true)
 
-	var err error
-	Client, err = mongo.Connect(context.Background(), clientOpts)
+	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
 	}
-	if err := Client.Ping(context.Background(), nil); err != nil {
-		log.Fatalf("❌ Mongo ping failed: %v", err)
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongo ping: %w", err)
 	}
 
-	log.Printf("✅ MongoDB connected (%s) maxPool=%d minPool=%d; Goroutines at start: %d",
-		uri, *clientOpts.MaxPoolSize, *clientOpts.MinPoolSize, runtime.NumGoroutine(),
+	log.Printf("✅ MongoDB connected maxPool=%d minPool=%d; Goroutines at start: %d",
+		*clientOpts.MaxPoolSize, *clientOpts.MinPoolSize, runtime.NumGoroutine(),
 	)
 
-	// Graceful shutdown hook
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-		log.Println("🛑 Disconnecting from MongoDB...")
-		_ = Client.Disconnect(context.Background())
-		os.Exit(0)
-	}()
+	standalone, err := isStandalone(ctx, client)
+	if err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongo hello: %w", err)
+	}
+	if standalone && !cfg.AllowStandalone {
+		_ = client.Disconnect(context.Background())
+		return nil, errors.New("MongoDB is a standalone server, which cannot run transactions; " +
+			"use a replica set (a single-node one will do)")
+	}
+	if standalone {
+		slog.WarnContext(ctx, "mongodb is standalone; running writes without transactions (dev only)")
+	}
+
+	s := NewStore(cfg.Database, cfg.AuxDatabase, func(database, name string) Collection {
+		return client.Database(database).Collection(name)
+	})
+	s.Client = client
+	s.standalone = standalone
 
 	// Optional: log connection stats periodically
-	go logPoolStats()
-
-	// Initialize your collections
-	db := Client.Database("eventdb")
-	dbx := Client.Database("naevis")
-	AccountsCollection = db.Collection("accounts")
-	ActivitiesCollection = db.Collection("activities")
-	AnalyticsCollection = db.Collection("analytics")
-	AppealsCollection = db.Collection("appeals")
-	ArtistEventsCollection = db.Collection("artistevents")
-	ArtistsCollection = db.Collection("artists")
-	BaitoApplicationsCollection = db.Collection("baitoapply")
-	BaitoCollection = db.Collection("baitos")
-	BaitoWorkerCollection = db.Collection("baitoworkers")
-	BlogPostsCollection = db.Collection("blogposts")
-	BookingsCollection = db.Collection("bookings")
-	BehindTheScenesCollection = db.Collection("bts")
-	CartCollection = db.Collection("cart")
-	CatalogueCollection = db.Collection("catalogue")
-	ChatsCollection = db.Collection("chats")
-	CommentsCollection = db.Collection("comments")
-	CouponCollection = db.Collection("coupons")
-	CropsCollection = db.Collection("crops")
-	DateCapsCollection = db.Collection("date_caps")
-	EventsCollection = db.Collection("events")
-	FarmsCollection = db.Collection("farms")
-	PostsCollection = db.Collection("feedposts")
-	FilesCollection = db.Collection("files")
-	FollowingsCollection = db.Collection("followings")
-	FarmOrdersCollection = db.Collection("forders")
-	HashtagCollection = db.Collection("hashtags")
-	IdempotencyCollection = db.Collection("idempotency")
-	ItineraryCollection = db.Collection("itinerary")
-	JournalCollection = db.Collection("journals")
-	LikesCollection = db.Collection("likes")
-	MapsCollection = db.Collection("maps")
-	MediaCollection = db.Collection("media")
-	MenuCollection = db.Collection("menu")
-	MerchCollection = db.Collection("merch")
-	MessagesCollection = db.Collection("messages")
-	ModeratorApplications = db.Collection("modapps")
-	OrderCollection = db.Collection("orders")
-	PlacesCollection = db.Collection("places")
-	ProductCollection = db.Collection("products")
-	PurchasedTicketsCollection = db.Collection("purticks")
-	RecipeCollection = db.Collection("recipes")
-	ReportsCollection = db.Collection("reports")
-	ReviewsCollection = db.Collection("reviews")
-	ServiceCollection = db.Collection("service")
-	SettingsCollection = db.Collection("settings")
-	SlotCollection = db.Collection("slots")
-	SongsCollection = db.Collection("songs")
-	SubscribersCollection = db.Collection("subscribers")
-	TicketsCollection = db.Collection("ticks")
-	TiersCollection = db.Collection("tiers")
-	TransactionCollection = db.Collection("transactions")
-	UserDataCollection = db.Collection("userdata")
-	UserCollection = db.Collection("users")
-	ZzonesCollection = db.Collection("zzones")
-	SearchCollection = dbx.Collection("users")
+	go logPoolStats(s.stop)
+
+	return s, nil
+}
+
+// isStandalone reports whether client is connected to a single mongod
+// rather than a replica set or a sharded cluster.
+func isStandalone(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, err
+	}
+	return hello.SetName == "" && hello.Msg != "isdbgrid", nil
+}
+
+// Close stops background work and disconnects the client, if any.
+func (s *Store) Close(ctx context.Context) error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	if s.Client == nil {
+		return nil
+	}
+	log.Println("🛑 Disconnecting from MongoDB...")
+	return s.Client.Disconnect(ctx)
+}
+
+// Collection returns a collection of the main database by name.
+func (s *Store) Collection(name string) Collection {
+	return s.open(s.mainDB, name)
+}
+
+// Use binds the package globals to s.
+func Use(s *Store) {
+	current = s
+	Client = s.Client
+	txnUnsupported.Store(s.standalone)
+	AnalyticsCollection = s.AnalyticsCollection
+	AccountsCollection = s.AccountsCollection
+	AppealsCollection = s.AppealsCollection
+	MapsCollection = s.MapsCollection
+	CartCollection = s.CartCollection
+	OrderCollection = s.OrderCollection
+	OutboxCollection = s.OutboxCollection
+	CatalogueCollection = s.CatalogueCollection
+	FarmsCollection = s.FarmsCollection
+	FarmOrdersCollection = s.FarmOrdersCollection
+	CropsCollection = s.CropsCollection
+	CommentsCollection = s.CommentsCollection
+	HashtagCollection = s.HashtagCollection
+	UserCollection = s.UserCollection
+	TransactionCollection = s.TransactionCollection
+	LikesCollection = s.LikesCollection
+	ProductCollection = s.ProductCollection
+	IdempotencyCollection = s.IdempotencyCollection
+	ItineraryCollection = s.ItineraryCollection
+	JournalCollection = s.JournalCollection
+	UserDataCollection = s.UserDataCollection
+	TicketsCollection = s.TicketsCollection
+	BehindTheScenesCollection = s.BehindTheScenesCollection
+	PurchasedTicketsCollection = s.PurchasedTicketsCollection
+	ReviewsCollection = s.ReviewsCollection
+	SettingsCollection = s.SettingsCollection
+	FollowingsCollection = s.FollowingsCollection
+	PlacesCollection = s.PlacesCollection
+	SlotCollection = s.SlotCollection
+	DateCapsCollection = s.DateCapsCollection
+	BookingsCollection = s.BookingsCollection
+	PostsCollection = s.PostsCollection
+	ZzonesCollection = s.ZzonesCollection
+	BlogPostsCollection = s.BlogPostsCollection
+	FilesCollection = s.FilesCollection
+	MerchCollection = s.MerchCollection
+	MenuCollection = s.MenuCollection
+	ActivitiesCollection = s.ActivitiesCollection
+	EventsCollection = s.EventsCollection
+	ArtistEventsCollection = s.ArtistEventsCollection
+	SongsCollection = s.SongsCollection
+	CouponCollection = s.CouponCollection
+	MediaCollection = s.MediaCollection
+	ArtistsCollection = s.ArtistsCollection
+	ChatsCollection = s.ChatsCollection
+	MessagesCollection = s.MessagesCollection
+	MigrationsCollection = s.MigrationsCollection
+	JobRunsCollection = s.JobRunsCollection
+	SessionsCollection = s.SessionsCollection
+	RefreshTokensCollection = s.RefreshTokensCollection
+	MFACollection = s.MFACollection
+	IdentitiesCollection = s.IdentitiesCollection
+	ReconciliationsCollection = s.ReconciliationsCollection
+	LedgerAuditCollection = s.LedgerAuditCollection
+	CheckoutsCollection = s.CheckoutsCollection
+	ExchangeRatesCollection = s.ExchangeRatesCollection
+	ReportsCollection = s.ReportsCollection
+	RecipeCollection = s.RecipeCollection
+	BaitoCollection = s.BaitoCollection
+	ModeratorApplications = s.ModeratorApplications
+	BaitoApplicationsCollection = s.BaitoApplicationsCollection
+	BaitoWorkerCollection = s.BaitoWorkerCollection
+	TiersCollection = s.TiersCollection
+	SearchCollection = s.SearchCollection
+	ServiceCollection = s.ServiceCollection
+	SubscribersCollection = s.SubscribersCollection
+	SearchIndexCollection = s.SearchIndexCollection
+}
+
+// CollectionByName returns a collection of the main database of the bound
+// Store by name.
+func CollectionByName(name string) Collection {
+	return current.Collection(name)
 }
 
 // logPoolStats logs basic goroutine and pool stats every 60s (optional)
-func logPoolStats() {
+func logPoolStats(stop <-chan struct{}) {
+	t := time.NewTicker(60 * time.Second)
+	defer t.Stop()
 	for {
-		time.Sleep(60 * time.Second)
-		log.Printf("📊 Mongo Stats: Goroutines=%d | MongoOpsRunning=%d", runtime.NumGoroutine(), len(mongoLimiter))
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			log.Printf("📊 Mongo Stats: Goroutines=%d | MongoOpsRunning=%d", runtime.NumGoroutine(), len(mongoLimiter))
+		}
 	}
 }
 
 // PingMongo can be used in your /health endpoint
 func PingMongo() error {
+	if Client == nil {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	return Client.Ping(ctx, nil)
@@ -196,6 +443,7 @@ func WithMongo(op func(ctx context.Context) error) error {
 	mongoLimiter <- struct{}{}        // acquire slot
 	defer func() { <-mongoLimiter }() // release slot
 
+	start := time.Now()
 	var err error
 	for i := 0; i < 2; i++ { // 1 retry max
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -203,11 +451,14 @@ func WithMongo(op func(ctx context.Context) error) error {
 
 		err = op(ctx)
 		if err == nil {
+			mongoOpDuration.ObserveSince(start, "ok")
 			return nil
 		}
 		log.Printf("⚠️ Mongo op failed: %v (retry %d)", err, i+1)
+		mongoOpRetries.Inc()
 		time.Sleep(200 * time.Millisecond)
 	}
+	mongoOpDuration.ObserveSince(start, "error")
 	return err
 }
 
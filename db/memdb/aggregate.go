@@ -0,0 +1,755 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toPipeline converts any pipeline value (mongo.Pipeline, []bson.M,
+// bson.A, ...) to stages.
+func toPipeline(p interface{}) ([]bson.D, error) {
+	d, err := toDoc(bson.D{{Key: "p", Value: p}})
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := d[0].Value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("memdb: pipeline must be an array")
+	}
+	stages := make([]bson.D, 0, len(arr))
+	for _, s := range arr {
+		st, ok := s.(bson.D)
+		if !ok || len(st) != 1 {
+			return nil, fmt.Errorf("memdb: each pipeline stage needs exactly one operator")
+		}
+		stages = append(stages, st)
+	}
+	return stages, nil
+}
+
+// aggregate runs stages over docs. The caller holds the server lock;
+// $lookup reads other collections of db directly.
+func (d *database) aggregate(docs []bson.D, stages []bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	for _, st := range stages {
+		op, arg := st[0].Key, st[0].Value
+		var err error
+		switch op {
+		case "$match":
+			cond, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: $match needs a document")
+			}
+			docs, err = filterDocs(docs, cond, vars)
+		case "$sort":
+			spec, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: $sort needs a document")
+			}
+			sortDocs(docs, spec)
+		case "$skip":
+			n, _ := toFloat(arg)
+			if int(n) >= len(docs) {
+				docs = nil
+			} else if n > 0 {
+				docs = docs[int(n):]
+			}
+		case "$limit":
+			n, _ := toFloat(arg)
+			if int(n) < len(docs) {
+				docs = docs[:int(n)]
+			}
+		case "$project":
+			spec, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: $project needs a document")
+			}
+			docs, err = projectDocs(docs, spec, vars)
+		case "$addFields", "$set":
+			spec, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: %s needs a document", op)
+			}
+			docs, err = addFields(docs, spec, vars)
+		case "$unset":
+			var fields bson.A
+			switch t := arg.(type) {
+			case string:
+				fields = bson.A{t}
+			case bson.A:
+				fields = t
+			}
+			spec := bson.D{}
+			for _, f := range fields {
+				spec = append(spec, bson.E{Key: str(f), Value: int32(0)})
+			}
+			docs, err = projectDocs(docs, spec, vars)
+		case "$unwind":
+			docs, err = unwind(docs, arg)
+		case "$group":
+			spec, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: $group needs a document")
+			}
+			docs, err = group(docs, spec, vars)
+		case "$lookup":
+			spec, ok := arg.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memdb: $lookup needs a document")
+			}
+			docs, err = d.lookup(docs, spec, vars)
+		case "$count":
+			docs = []bson.D{{{Key: str(arg), Value: int32(len(docs))}}}
+		case "$replaceRoot", "$replaceWith":
+			expr := arg
+			if spec, ok := arg.(bson.D); ok && op == "$replaceRoot" {
+				expr, _ = get(spec, "newRoot")
+			}
+			out := make([]bson.D, 0, len(docs))
+			for _, doc := range docs {
+				v, err := evalExpr(expr, doc, vars)
+				if err != nil {
+					return nil, err
+				}
+				nd, ok := v.(bson.D)
+				if !ok {
+					return nil, fmt.Errorf("memdb: %s must produce a document", op)
+				}
+				out = append(out, nd)
+			}
+			docs = out
+		default:
+			return nil, fmt.Errorf("memdb: unsupported pipeline stage %s", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func filterDocs(docs []bson.D, cond bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	m := matcher{vars: vars}
+	out := docs[:0:0]
+	for _, doc := range docs {
+		ok, err := m.match(doc, cond)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+// sortDocs orders docs by spec ({field: 1|-1, ...}); missing fields sort as
+// null. The sort is stable so equal keys keep insertion order.
+func sortDocs(docs []bson.D, spec bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range spec {
+			a, _ := lookupOne(docs[i], k.Key)
+			b, _ := lookupOne(docs[j], k.Key)
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if dir, _ := toFloat(k.Value); dir < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// projectDocs applies an inclusion or exclusion projection. Values other
+// than 0/1/true/false are expressions computed into the output.
+func projectDocs(docs []bson.D, spec bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	exclude := false
+	keepID := true
+	for _, e := range spec {
+		isFlag := isNumber(e.Value) || isBool(e.Value)
+		if e.Key == "_id" {
+			if isFlag && !truthy(e.Value) {
+				keepID = false
+			}
+			continue
+		}
+		if isFlag && !truthy(e.Value) {
+			exclude = true
+		}
+	}
+
+	out := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		if exclude {
+			nd := cloneDoc(doc)
+			for _, e := range spec {
+				if e.Key == "_id" && keepID {
+					continue
+				}
+				nd, _ = (&updater{}).applyOp(nd, "$unset", e.Key, "")
+			}
+			out = append(out, nd)
+			continue
+		}
+
+		nd := bson.D{}
+		if id, ok := get(doc, "_id"); ok && keepID {
+			nd = append(nd, bson.E{Key: "_id", Value: id})
+		}
+		for _, e := range spec {
+			if e.Key == "_id" && (isNumber(e.Value) || isBool(e.Value)) {
+				continue
+			}
+			var v interface{}
+			var found bool
+			if isNumber(e.Value) || isBool(e.Value) {
+				v, found = lookupOne(doc, e.Key)
+			} else {
+				var err error
+				v, err = evalExpr(e.Value, doc, vars)
+				if err != nil {
+					return nil, err
+				}
+				found = true
+			}
+			if !found {
+				continue
+			}
+			var err error
+			nd, err = (&updater{}).applyOp(nd, "$set", e.Key, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, nd)
+	}
+	return out, nil
+}
+
+func addFields(docs []bson.D, spec bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	out := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		nd := cloneDoc(doc)
+		for _, e := range spec {
+			v, err := evalExpr(e.Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			if nd, err = (&updater{}).applyOp(nd, "$set", e.Key, v); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, nd)
+	}
+	return out, nil
+}
+
+func unwind(docs []bson.D, arg interface{}) ([]bson.D, error) {
+	path, preserve, indexField := "", false, ""
+	switch t := arg.(type) {
+	case string:
+		path = t
+	case bson.D:
+		p, _ := get(t, "path")
+		path = str(p)
+		if v, ok := get(t, "preserveNullAndEmptyArrays"); ok {
+			preserve = truthy(v)
+		}
+		if v, ok := get(t, "includeArrayIndex"); ok {
+			indexField = str(v)
+		}
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("memdb: $unwind path must start with $")
+	}
+	field := path[1:]
+
+	var out []bson.D
+	for _, doc := range docs {
+		v, found := lookupOne(doc, field)
+		arr, isArr := v.(bson.A)
+		switch {
+		case isArr && len(arr) > 0:
+			for i, el := range arr {
+				nd, err := (&updater{}).applyOp(cloneDoc(doc), "$set", field, el)
+				if err != nil {
+					return nil, err
+				}
+				if indexField != "" {
+					nd = set(nd, indexField, int64(i))
+				}
+				out = append(out, nd)
+			}
+		case !isArr && found && v != nil:
+			out = append(out, doc)
+		case preserve:
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+// group implements $group with the common accumulators.
+func group(docs []bson.D, spec bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	idExpr, _ := get(spec, "_id")
+	type bucket struct {
+		id   interface{}
+		acc  map[string]interface{}
+		seen map[string]int // per-field counts for $avg
+	}
+	var order []*bucket
+
+	for _, doc := range docs {
+		id, err := evalExpr(idExpr, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		var b *bucket
+		for _, o := range order {
+			if equal(o.id, id) {
+				b = o
+				break
+			}
+		}
+		if b == nil {
+			b = &bucket{id: id, acc: map[string]interface{}{}, seen: map[string]int{}}
+			order = append(order, b)
+		}
+
+		for _, f := range spec {
+			if f.Key == "_id" {
+				continue
+			}
+			accDoc, ok := f.Value.(bson.D)
+			if !ok || len(accDoc) != 1 {
+				return nil, fmt.Errorf("memdb: $group field %s needs one accumulator", f.Key)
+			}
+			op := accDoc[0].Key
+			v, err := evalExpr(accDoc[0].Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			cur, has := b.acc[f.Key]
+			switch op {
+			case "$sum", "$avg":
+				if !isNumber(v) {
+					if !has {
+						b.acc[f.Key] = int32(0)
+					}
+					continue
+				}
+				if !has {
+					cur = int32(0)
+				}
+				b.acc[f.Key] = arith("$inc", cur, v)
+				b.seen[f.Key]++
+			case "$count":
+				if !has {
+					cur = int32(0)
+				}
+				b.acc[f.Key] = arith("$inc", cur, int32(1))
+			case "$min", "$max":
+				if v == nil {
+					continue
+				}
+				c := compare(v, cur)
+				if !has || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+					b.acc[f.Key] = v
+				}
+			case "$first":
+				if !has {
+					b.acc[f.Key] = v
+				}
+			case "$last":
+				b.acc[f.Key] = v
+			case "$push", "$addToSet":
+				arr, _ := cur.(bson.A)
+				if op == "$addToSet" && containsValue(arr, v) {
+					b.acc[f.Key] = arr
+					continue
+				}
+				b.acc[f.Key] = append(arr, v)
+			default:
+				return nil, fmt.Errorf("memdb: unsupported accumulator %s", op)
+			}
+		}
+	}
+
+	out := make([]bson.D, 0, len(order))
+	for _, b := range order {
+		nd := bson.D{{Key: "_id", Value: b.id}}
+		for _, f := range spec {
+			if f.Key == "_id" {
+				continue
+			}
+			v := b.acc[f.Key]
+			if acc := f.Value.(bson.D); acc[0].Key == "$avg" {
+				if n := b.seen[f.Key]; n > 0 {
+					sum, _ := toFloat(v)
+					v = sum / float64(n)
+				} else {
+					v = nil
+				}
+			}
+			if acc := f.Value.(bson.D); (acc[0].Key == "$push" || acc[0].Key == "$addToSet") && v == nil {
+				v = bson.A{}
+			}
+			nd = append(nd, bson.E{Key: f.Key, Value: v})
+		}
+		out = append(out, nd)
+	}
+	return out, nil
+}
+
+// lookup implements both forms of $lookup: localField/foreignField and
+// let/pipeline.
+func (d *database) lookup(docs []bson.D, spec bson.D, vars map[string]interface{}) ([]bson.D, error) {
+	fromV, _ := get(spec, "from")
+	asV, _ := get(spec, "as")
+	from, as := str(fromV), str(asV)
+	foreign := d.coll(from).snapshot()
+
+	out := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		var joined []bson.D
+		var err error
+		if lf, ok := get(spec, "localField"); ok {
+			ff, _ := get(spec, "foreignField")
+			locals := resolve(doc, str(lf))
+			var flat bson.A
+			for _, l := range locals {
+				if a, ok := l.(bson.A); ok {
+					flat = append(flat, a...)
+				} else {
+					flat = append(flat, l)
+				}
+			}
+			if len(flat) == 0 {
+				flat = bson.A{nil}
+			}
+			joined, err = filterDocs(foreign, bson.D{{Key: str(ff), Value: bson.D{{Key: "$in", Value: flat}}}}, nil)
+		} else {
+			inner := map[string]interface{}{}
+			for k, v := range vars {
+				inner[k] = v
+			}
+			if let, ok := get(spec, "let"); ok {
+				letDoc, _ := let.(bson.D)
+				for _, e := range letDoc {
+					v, err := evalExpr(e.Value, doc, vars)
+					if err != nil {
+						return nil, err
+					}
+					inner[e.Key] = v
+				}
+			}
+			var stages []bson.D
+			if p, ok := get(spec, "pipeline"); ok {
+				if stages, err = toPipeline(p); err != nil {
+					return nil, err
+				}
+			}
+			joined, err = d.aggregate(foreign, stages, inner)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		arr := make(bson.A, 0, len(joined))
+		for _, j := range joined {
+			arr = append(arr, cloneDoc(j))
+		}
+		nd, err := (&updater{}).applyOp(cloneDoc(doc), "$set", as, arr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, nd)
+	}
+	return out, nil
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+// evalExpr evaluates an aggregation expression against doc.
+func evalExpr(expr interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	switch t := expr.(type) {
+	case string:
+		if strings.HasPrefix(t, "$$") {
+			name, path, _ := strings.Cut(t[2:], ".")
+			var v interface{}
+			switch name {
+			case "ROOT", "CURRENT":
+				v = doc
+			default:
+				var ok bool
+				if v, ok = vars[name]; !ok {
+					return nil, fmt.Errorf("memdb: undefined variable $$%s", name)
+				}
+			}
+			if path == "" {
+				return v, nil
+			}
+			r, _ := lookupOne(v, path)
+			return r, nil
+		}
+		if strings.HasPrefix(t, "$") {
+			v, _ := lookupOne(doc, t[1:])
+			return v, nil
+		}
+		return t, nil
+	case bson.A:
+		out := make(bson.A, len(t))
+		for i, e := range t {
+			v, err := evalExpr(e, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case bson.D:
+		if len(t) == 1 && strings.HasPrefix(t[0].Key, "$") {
+			return evalOp(t[0].Key, t[0].Value, doc, vars)
+		}
+		out := bson.D{}
+		for _, e := range t {
+			v, err := evalExpr(e.Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.E{Key: e.Key, Value: v})
+		}
+		return out, nil
+	}
+	return expr, nil
+}
+
+func evalArgs(arg interface{}, doc bson.D, vars map[string]interface{}) (bson.A, error) {
+	if a, ok := arg.(bson.A); ok {
+		v, err := evalExpr(a, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		return v.(bson.A), nil
+	}
+	v, err := evalExpr(arg, doc, vars)
+	return bson.A{v}, err
+}
+
+func evalOp(op string, arg interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	if op == "$literal" {
+		return arg, nil
+	}
+	if op == "$cond" {
+		var ifE, thenE, elseE interface{}
+		switch t := arg.(type) {
+		case bson.A:
+			if len(t) != 3 {
+				return nil, fmt.Errorf("memdb: $cond needs 3 arguments")
+			}
+			ifE, thenE, elseE = t[0], t[1], t[2]
+		case bson.D:
+			ifE, _ = get(t, "if")
+			thenE, _ = get(t, "then")
+			elseE, _ = get(t, "else")
+		}
+		c, err := evalExpr(ifE, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(c) {
+			return evalExpr(thenE, doc, vars)
+		}
+		return evalExpr(elseE, doc, vars)
+	}
+
+	args, err := evalArgs(arg, doc, vars)
+	if err != nil {
+		return nil, err
+	}
+	need := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("memdb: %s needs %d arguments", op, n)
+		}
+		return nil
+	}
+
+	switch op {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$cmp":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		c := compare(args[0], args[1])
+		switch op {
+		case "$eq":
+			return c == 0 && typeOrder(args[0]) == typeOrder(args[1]), nil
+		case "$ne":
+			return c != 0 || typeOrder(args[0]) != typeOrder(args[1]), nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		case "$lte":
+			return c <= 0, nil
+		}
+		return int32(c), nil
+	case "$and":
+		for _, a := range args {
+			if !truthy(a) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$or":
+		for _, a := range args {
+			if truthy(a) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$not":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		return !truthy(args[0]), nil
+	case "$ifNull":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "$in":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		arr, _ := args[1].(bson.A)
+		return containsValue(arr, args[0]), nil
+	case "$size":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		arr, ok := args[0].(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("memdb: $size needs an array")
+		}
+		return int32(len(arr)), nil
+	case "$arrayElemAt":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		arr, _ := args[0].(bson.A)
+		f, _ := toFloat(args[1])
+		i := int(f)
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil, nil
+		}
+		return arr[i], nil
+	case "$first", "$last":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		arr, _ := args[0].(bson.A)
+		if len(arr) == 0 {
+			return nil, nil
+		}
+		if op == "$first" {
+			return arr[0], nil
+		}
+		return arr[len(arr)-1], nil
+	case "$add", "$sum", "$multiply":
+		// $sum of a single array argument sums its elements.
+		if op == "$sum" && len(args) == 1 {
+			if arr, ok := args[0].(bson.A); ok {
+				args = arr
+			}
+		}
+		var acc interface{} = int32(0)
+		if op == "$multiply" {
+			acc = int32(1)
+		}
+		for _, a := range args {
+			if !isNumber(a) {
+				if op == "$sum" {
+					continue
+				}
+				return nil, nil
+			}
+			if op == "$multiply" {
+				acc = arith("$mul", acc, a)
+			} else {
+				acc = arith("$inc", acc, a)
+			}
+		}
+		return acc, nil
+	case "$subtract", "$divide":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		x, ok1 := toFloat(args[0])
+		y, ok2 := toFloat(args[1])
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		if op == "$divide" {
+			if y == 0 {
+				return nil, fmt.Errorf("memdb: $divide by zero")
+			}
+			return x / y, nil
+		}
+		return arith("$inc", args[0], arith("$mul", args[1], int32(-1))), nil
+	case "$concat":
+		var b strings.Builder
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			b.WriteString(str(a))
+		}
+		return b.String(), nil
+	case "$toString":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case primitive.ObjectID:
+			return v.Hex(), nil
+		case nil:
+			return nil, nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	case "$min", "$max":
+		if len(args) == 1 {
+			if arr, ok := args[0].(bson.A); ok {
+				args = arr
+			}
+		}
+		var best interface{}
+		for _, a := range args {
+			if a == nil {
+				continue
+			}
+			c := compare(a, best)
+			if best == nil || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+				best = a
+			}
+		}
+		return best, nil
+	}
+	return nil, fmt.Errorf("memdb: unsupported expression operator %s", op)
+}
@@ -0,0 +1,602 @@
+// Package memdb is an in-memory implementation of db.Collection. It
+// understands the query, update and aggregation operators the handlers
+// use, so the server and its handler tests run without a Mongo cluster.
+//
+// Documents are kept in insertion order. There are no transactions: a
+// Store from NewStore has a nil Client, and db.RunInTransaction runs its
+// callback directly.
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Server holds every database and collection. One lock guards all of
+// them, which keeps $lookup and multi-collection reads consistent.
+type Server struct {
+	mu  sync.RWMutex
+	dbs map[string]*database
+}
+
+type database struct {
+	srv   *Server
+	colls map[string]*collection
+}
+
+type collection struct {
+	db      *database
+	name    string
+	docs    []bson.D
+	uniques []uniqueIndex
+}
+
+// uniqueIndex is a unique index: no two documents matching partial may
+// share values for keys.
+type uniqueIndex struct {
+	name    string
+	keys    []string
+	partial bson.D
+}
+
+// NewServer returns an empty server.
+func NewServer() *Server {
+	return &Server{dbs: map[string]*database{}}
+}
+
+// NewStore returns a db.Store backed by a fresh in-memory server.
+func NewStore() *db.Store {
+	return NewServer().Store()
+}
+
+// Store returns a db.Store whose collections live on s.
+func (s *Server) Store() *db.Store {
+	return db.NewStore("naevis", "naevis_search", s.Collection)
+}
+
+// Collection returns the named collection, creating it on first use.
+func (s *Server) Collection(dbName, name string) db.Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dbs[dbName]
+	if !ok {
+		d = &database{srv: s, colls: map[string]*collection{}}
+		s.dbs[dbName] = d
+	}
+	c, ok := d.colls[name]
+	if !ok {
+		c = &collection{db: d, name: name}
+		d.colls[name] = c
+	}
+	return c
+}
+
+// coll returns the named collection of d, or nil if it was never opened.
+func (d *database) coll(name string) *collection {
+	return d.colls[name]
+}
+
+// snapshot returns the stored documents; a nil collection has none.
+// Callers must not modify them.
+func (c *collection) snapshot() []bson.D {
+	if c == nil {
+		return nil
+	}
+	return append([]bson.D(nil), c.docs...)
+}
+
+func (c *collection) Name() string { return c.name }
+
+// CreateIndexModels records unique indexes; other index kinds only matter
+// for performance and are ignored.
+func (c *collection) CreateIndexModels(_ context.Context, models []mongo.IndexModel) error {
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+	for _, m := range models {
+		if m.Options == nil || m.Options.Unique == nil || !*m.Options.Unique {
+			continue
+		}
+		keys, err := toDoc(m.Keys)
+		if err != nil {
+			return err
+		}
+		ix := uniqueIndex{}
+		for _, k := range keys {
+			ix.keys = append(ix.keys, k.Key)
+		}
+		ix.name = strings.Join(ix.keys, "_")
+		if m.Options.Name != nil {
+			ix.name = *m.Options.Name
+		}
+		if m.Options.PartialFilterExpression != nil {
+			if ix.partial, err = toDoc(m.Options.PartialFilterExpression); err != nil {
+				return err
+			}
+		}
+		c.uniques = append(c.uniques, ix)
+	}
+	return nil
+}
+
+// filterDoc normalizes a filter; nil matches everything.
+func filterDoc(filter interface{}) (bson.D, error) {
+	f, err := toDoc(filter)
+	if err != nil {
+		return nil, fmt.Errorf("memdb: bad filter: %w", err)
+	}
+	return f, nil
+}
+
+// matching returns the indexes of the stored documents that match filter.
+func (c *collection) matching(filter bson.D) ([]int, error) {
+	var out []int
+	for i, d := range c.docs {
+		ok, err := (matcher{}).match(d, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// query runs a read: filter, sort, skip, limit and projection.
+func (c *collection) query(filter interface{}, sortSpec interface{}, skip, limit *int64, projection interface{}) ([]bson.D, error) {
+	f, err := filterDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := c.matching(f)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]bson.D, len(idx))
+	for i, j := range idx {
+		docs[i] = c.docs[j]
+	}
+	if sortSpec != nil {
+		spec, err := toDoc(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		sortDocs(docs, spec)
+	}
+	if skip != nil && *skip > 0 {
+		if int(*skip) >= len(docs) {
+			docs = nil
+		} else {
+			docs = docs[*skip:]
+		}
+	}
+	// A negative limit means a single batch of that size.
+	if limit != nil && *limit != 0 {
+		n := *limit
+		if n < 0 {
+			n = -n
+		}
+		if int(n) < len(docs) {
+			docs = docs[:n]
+		}
+	}
+	if projection != nil {
+		spec, err := toDoc(projection)
+		if err != nil {
+			return nil, err
+		}
+		if len(spec) > 0 {
+			return projectDocs(docs, spec, nil)
+		}
+	}
+	return docs, nil
+}
+
+func cursor(docs []bson.D) (*mongo.Cursor, error) {
+	items := make([]interface{}, len(docs))
+	for i, d := range docs {
+		items[i] = d
+	}
+	return mongo.NewCursorFromDocuments(items, nil, nil)
+}
+
+func single(doc bson.D, err error) *mongo.SingleResult {
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (c *collection) Find(_ context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	o := options.MergeFindOptions(opts...)
+	c.db.srv.mu.RLock()
+	docs, err := c.query(filter, o.Sort, o.Skip, o.Limit, o.Projection)
+	c.db.srv.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return cursor(docs)
+}
+
+func (c *collection) FindOne(_ context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	o := options.MergeFindOneOptions(opts...)
+	one := int64(1)
+	c.db.srv.mu.RLock()
+	docs, err := c.query(filter, o.Sort, o.Skip, &one, o.Projection)
+	c.db.srv.mu.RUnlock()
+	if err != nil || len(docs) == 0 {
+		return single(nil, err)
+	}
+	return single(docs[0], nil)
+}
+
+func (c *collection) FindOneAndUpdate(_ context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	o := options.MergeFindOneAndUpdateOptions(opts...)
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+
+	f, err := filterDoc(filter)
+	if err != nil {
+		return single(nil, err)
+	}
+	idx, err := c.matching(f)
+	if err != nil {
+		return single(nil, err)
+	}
+	if o.Sort != nil && len(idx) > 1 {
+		spec, err := toDoc(o.Sort)
+		if err != nil {
+			return single(nil, err)
+		}
+		docs := make([]bson.D, len(idx))
+		for i, j := range idx {
+			docs[i] = c.docs[j]
+		}
+		sortDocs(docs, spec)
+		idx = []int{c.indexOf(docs[0])}
+	}
+
+	var arrayFilters []interface{}
+	if o.ArrayFilters != nil {
+		arrayFilters = o.ArrayFilters.Filters
+	}
+	var before, after bson.D
+	if len(idx) > 0 {
+		before = c.docs[idx[0]]
+		if after, err = c.updateAt(idx[0], f, update, arrayFilters); err != nil {
+			return single(nil, err)
+		}
+	} else if o.Upsert != nil && *o.Upsert {
+		if after, _, err = c.upsert(f, update, arrayFilters); err != nil {
+			return single(nil, err)
+		}
+	} else {
+		return single(nil, nil)
+	}
+
+	out := before
+	if o.ReturnDocument != nil && *o.ReturnDocument == options.After {
+		out = after
+	}
+	if out != nil && o.Projection != nil {
+		spec, err := toDoc(o.Projection)
+		if err != nil {
+			return single(nil, err)
+		}
+		docs, err := projectDocs([]bson.D{out}, spec, nil)
+		if err != nil {
+			return single(nil, err)
+		}
+		out = docs[0]
+	}
+	return single(out, nil)
+}
+
+// indexOf finds a stored document by its _id.
+func (c *collection) indexOf(doc bson.D) int {
+	id, _ := get(doc, "_id")
+	for i, d := range c.docs {
+		if other, _ := get(d, "_id"); equal(id, other) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *collection) CountDocuments(_ context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	o := options.MergeCountOptions(opts...)
+	c.db.srv.mu.RLock()
+	docs, err := c.query(filter, nil, o.Skip, o.Limit, nil)
+	c.db.srv.mu.RUnlock()
+	return int64(len(docs)), err
+}
+
+func (c *collection) Distinct(_ context.Context, fieldName string, filter interface{}, _ ...*options.DistinctOptions) ([]interface{}, error) {
+	c.db.srv.mu.RLock()
+	docs, err := c.query(filter, nil, nil, nil, nil)
+	c.db.srv.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	add := func(v interface{}) {
+		for _, seen := range out {
+			if equal(seen, v) {
+				return
+			}
+		}
+		out = append(out, clone(v))
+	}
+	for _, d := range docs {
+		for _, v := range resolve(d, fieldName) {
+			if arr, ok := v.(bson.A); ok {
+				for _, el := range arr {
+					add(el)
+				}
+				continue
+			}
+			add(v)
+		}
+	}
+	return out, nil
+}
+
+func (c *collection) Aggregate(_ context.Context, pipeline interface{}, _ ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	stages, err := toPipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	c.db.srv.mu.RLock()
+	docs, err := c.db.aggregate(c.snapshot(), stages, nil)
+	c.db.srv.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return cursor(docs)
+}
+
+func (c *collection) InsertOne(_ context.Context, document interface{}, _ ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+	id, err := c.insert(document)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+// InsertMany is ordered: it stops at the first failing document.
+func (c *collection) InsertMany(_ context.Context, documents []interface{}, _ ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+	res := &mongo.InsertManyResult{}
+	for _, d := range documents {
+		id, err := c.insert(d)
+		if err != nil {
+			return res, err
+		}
+		res.InsertedIDs = append(res.InsertedIDs, id)
+	}
+	return res, nil
+}
+
+// insert stores a copy of document, assigning an ObjectID _id if it has
+// none.
+func (c *collection) insert(document interface{}) (interface{}, error) {
+	doc, err := toDoc(document)
+	if err != nil {
+		return nil, err
+	}
+	doc = cloneDoc(doc)
+	id, ok := get(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	if err := c.checkUnique(doc, -1); err != nil {
+		return nil, err
+	}
+	c.docs = append(c.docs, doc)
+	return id, nil
+}
+
+// checkUnique reports a duplicate key error if doc collides with a stored
+// document other than the one at skip.
+func (c *collection) checkUnique(doc bson.D, skip int) error {
+	indexes := append([]uniqueIndex{{name: "_id_", keys: []string{"_id"}}}, c.uniques...)
+	for _, ix := range indexes {
+		if ix.partial != nil {
+			if ok, _ := (matcher{}).match(doc, ix.partial); !ok {
+				continue
+			}
+		}
+		key := indexKey(doc, ix.keys)
+		for i, other := range c.docs {
+			if i == skip {
+				continue
+			}
+			if ix.partial != nil {
+				if ok, _ := (matcher{}).match(other, ix.partial); !ok {
+					continue
+				}
+			}
+			if equal(key, indexKey(other, ix.keys)) {
+				return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+					Code:    11000,
+					Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s", c.name, ix.name),
+				}}}
+			}
+		}
+	}
+	return nil
+}
+
+func indexKey(doc bson.D, keys []string) bson.A {
+	out := make(bson.A, len(keys))
+	for i, k := range keys {
+		out[i], _ = lookupOne(doc, k)
+	}
+	return out
+}
+
+// updateAt applies update to the document at i and returns the new
+// document.
+func (c *collection) updateAt(i int, filter bson.D, update interface{}, arrayFilters []interface{}) (bson.D, error) {
+	u, err := newUpdater(filter, arrayFilters, false)
+	if err != nil {
+		return nil, err
+	}
+	upd, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := u.apply(c.docs[i], upd)
+	if err != nil {
+		return nil, err
+	}
+	oldID, _ := get(c.docs[i], "_id")
+	if newID, _ := get(doc, "_id"); !equal(oldID, newID) {
+		return nil, fmt.Errorf("memdb: the _id field cannot be changed")
+	}
+	if err := c.checkUnique(doc, i); err != nil {
+		return nil, err
+	}
+	c.docs[i] = doc
+	return doc, nil
+}
+
+// upsert inserts the document built from the filter's equality fields and
+// update, and returns it with its _id.
+func (c *collection) upsert(filter bson.D, update interface{}, arrayFilters []interface{}) (bson.D, interface{}, error) {
+	base, err := upsertBase(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := newUpdater(filter, arrayFilters, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	upd, err := toDoc(update)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := u.apply(base, upd)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := c.insert(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.docs[len(c.docs)-1], id, nil
+}
+
+func (c *collection) update(filter, update interface{}, many bool, opts []*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	o := options.MergeUpdateOptions(opts...)
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+
+	f, err := filterDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := c.matching(f)
+	if err != nil {
+		return nil, err
+	}
+	if !many && len(idx) > 1 {
+		idx = idx[:1]
+	}
+	var arrayFilters []interface{}
+	if o.ArrayFilters != nil {
+		arrayFilters = o.ArrayFilters.Filters
+	}
+
+	res := &mongo.UpdateResult{}
+	if len(idx) == 0 {
+		if o.Upsert == nil || !*o.Upsert {
+			return res, nil
+		}
+		_, id, err := c.upsert(f, update, arrayFilters)
+		if err != nil {
+			return nil, err
+		}
+		res.UpsertedCount = 1
+		res.UpsertedID = id
+		return res, nil
+	}
+	for _, i := range idx {
+		before := c.docs[i]
+		after, err := c.updateAt(i, f, update, arrayFilters)
+		if err != nil {
+			return nil, err
+		}
+		res.MatchedCount++
+		if compare(before, after) != 0 {
+			res.ModifiedCount++
+		}
+	}
+	return res, nil
+}
+
+func (c *collection) UpdateOne(_ context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(filter, update, false, opts)
+}
+
+func (c *collection) UpdateMany(_ context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(filter, update, true, opts)
+}
+
+func (c *collection) UpdateByID(_ context.Context, id, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(bson.D{{Key: "_id", Value: id}}, update, false, opts)
+}
+
+func (c *collection) delete(filter interface{}, many bool) (*mongo.DeleteResult, error) {
+	c.db.srv.mu.Lock()
+	defer c.db.srv.mu.Unlock()
+	f, err := filterDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := c.matching(f)
+	if err != nil {
+		return nil, err
+	}
+	if !many && len(idx) > 1 {
+		idx = idx[:1]
+	}
+	drop := map[int]bool{}
+	for _, i := range idx {
+		drop[i] = true
+	}
+	kept := c.docs[:0:0]
+	for i, d := range c.docs {
+		if !drop[i] {
+			kept = append(kept, d)
+		}
+	}
+	c.docs = kept
+	return &mongo.DeleteResult{DeletedCount: int64(len(idx))}, nil
+}
+
+func (c *collection) DeleteOne(_ context.Context, filter interface{}, _ ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(filter, false)
+}
+
+func (c *collection) DeleteMany(_ context.Context, filter interface{}, _ ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(filter, true)
+}
+
+var _ db.Collection = (*collection)(nil)
@@ -0,0 +1,193 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type post struct {
+	ID        string    `bson:"postid"`
+	User      string    `bson:"userid"`
+	Tags      []string  `bson:"tags"`
+	Likes     int       `bson:"likes"`
+	CreatedAt time.Time `bson:"timestamp"`
+}
+
+func seed(t *testing.T) *collection {
+	t.Helper()
+	c := NewServer().Collection("test", "posts").(*collection)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	docs := []interface{}{
+		post{"p1", "alice", []string{"go", "db"}, 3, base},
+		post{"p2", "bob", []string{"go"}, 7, base.Add(time.Hour)},
+		post{"p3", "alice", nil, 0, base.Add(2 * time.Hour)},
+	}
+	if _, err := c.InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func ids(t *testing.T, cur *mongo.Cursor) []string {
+	t.Helper()
+	var out []post
+	if err := cur.All(context.Background(), &out); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range out {
+		got = append(got, p.ID)
+	}
+	return got
+}
+
+func TestFind(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+	tests := []struct {
+		filter interface{}
+		opts   *options.FindOptions
+		want   []string
+	}{
+		{bson.M{"userid": "alice"}, nil, []string{"p1", "p3"}},
+		{bson.M{"tags": "go"}, options.Find().SetSort(bson.D{{Key: "likes", Value: -1}}), []string{"p2", "p1"}},
+		{bson.M{"likes": bson.M{"$gte": 3}, "tags": bson.M{"$all": bson.A{"go", "db"}}}, nil, []string{"p1"}},
+		{bson.M{"$or": bson.A{bson.M{"likes": 0}, bson.M{"userid": "bob"}}}, nil, []string{"p2", "p3"}},
+		{bson.M{"timestamp": bson.M{"$lt": time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)}}, nil, []string{"p1", "p2"}},
+		{bson.M{"userid": bson.M{"$regex": "^AL", "$options": "i"}}, options.Find().SetSkip(1), []string{"p3"}},
+		{bson.M{}, options.Find().SetSort(bson.M{"timestamp": -1}).SetLimit(2), []string{"p3", "p2"}},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		if opts == nil {
+			opts = options.Find()
+		}
+		cur, err := c.Find(ctx, tt.filter, opts)
+		if err != nil {
+			t.Fatalf("Find(%v): %v", tt.filter, err)
+		}
+		got := ids(t, cur)
+		if len(got) != len(tt.want) {
+			t.Errorf("Find(%v) = %v, want %v", tt.filter, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Find(%v) = %v, want %v", tt.filter, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+
+	res, err := c.UpdateOne(ctx, bson.M{"postid": "p1"}, bson.M{
+		"$inc":      bson.M{"likes": 2},
+		"$addToSet": bson.M{"tags": "go"},
+		"$push":     bson.M{"tags": "new"},
+	})
+	if err != nil || res.ModifiedCount != 1 {
+		t.Fatalf("UpdateOne = %+v, %v", res, err)
+	}
+	var p post
+	if err := c.FindOne(ctx, bson.M{"postid": "p1"}).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Likes != 5 || len(p.Tags) != 3 || p.Tags[2] != "new" {
+		t.Errorf("after update: %+v", p)
+	}
+
+	res, err = c.UpdateOne(ctx, bson.M{"postid": "p9"}, bson.M{"$set": bson.M{"likes": 1}}, options.Update().SetUpsert(true))
+	if err != nil || res.UpsertedCount != 1 {
+		t.Fatalf("upsert = %+v, %v", res, err)
+	}
+	if err := c.FindOne(ctx, bson.M{"postid": "p9"}).Decode(&p); err != nil || p.Likes != 1 {
+		t.Errorf("upserted %+v, %v", p, err)
+	}
+
+	if err := c.FindOne(ctx, bson.M{"postid": "nope"}).Err(); err != mongo.ErrNoDocuments {
+		t.Errorf("FindOne missing = %v, want ErrNoDocuments", err)
+	}
+
+	after := c.FindOneAndUpdate(ctx, bson.M{"postid": "p2"}, bson.M{"$set": bson.M{"likes": 0}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err := after.Decode(&p); err != nil || p.Likes != 0 {
+		t.Errorf("FindOneAndUpdate = %+v, %v", p, err)
+	}
+}
+
+func TestArrayFilters(t *testing.T) {
+	c := NewServer().Collection("test", "ticks").(*collection)
+	ctx := context.Background()
+	_, _ = c.InsertOne(ctx, bson.M{"_id": "t1", "seats": bson.A{
+		bson.M{"seat_id": "A1", "status": "available"},
+		bson.M{"seat_id": "A2", "status": "available"},
+	}})
+	_, err := c.UpdateOne(ctx, bson.M{"_id": "t1"},
+		bson.M{"$set": bson.M{"seats.$[s].status": "locked"}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"s.seat_id": bson.M{"$in": bson.A{"A2"}}},
+		}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := c.CountDocuments(ctx, bson.M{"seats": bson.M{"$elemMatch": bson.M{"seat_id": "A2", "status": "locked"}}})
+	m, _ := c.CountDocuments(ctx, bson.M{"seats": bson.M{"$elemMatch": bson.M{"seat_id": "A1", "status": "locked"}}})
+	if n != 1 || m != 0 {
+		t.Errorf("locked A2=%d A1=%d, want 1 and 0", n, m)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	c := NewServer().Collection("test", "users").(*collection)
+	ctx := context.Background()
+	err := c.CreateIndexModels(ctx, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertOne(ctx, bson.M{"username": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertOne(ctx, bson.M{"username": "ann"}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("second insert = %v, want duplicate key error", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+	cur, err := c.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "likes", Value: bson.D{{Key: "$sum", Value: "$likes"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []struct {
+		Tag   string `bson:"_id"`
+		Count int    `bson:"count"`
+		Likes int    `bson:"likes"`
+	}
+	if err := cur.All(ctx, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Tag != "go" || out[0].Count != 2 || out[0].Likes != 10 {
+		t.Errorf("aggregate = %+v", out)
+	}
+}
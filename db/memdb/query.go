@@ -0,0 +1,360 @@
+package memdb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matcher evaluates query filters. vars holds $lookup "let" variables for
+// $expr.
+type matcher struct {
+	vars map[string]interface{}
+}
+
+// match reports whether doc satisfies filter.
+func (m matcher) match(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := m.matchElem(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m matcher) matchElem(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := e.Value.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memdb: %s needs an array", e.Key)
+		}
+		for _, c := range clauses {
+			sub, ok := c.(bson.D)
+			if !ok {
+				return false, fmt.Errorf("memdb: %s entries must be documents", e.Key)
+			}
+			hit, err := m.match(doc, sub)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !hit:
+				return false, nil
+			case e.Key == "$or" && hit:
+				return true, nil
+			case e.Key == "$nor" && hit:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	case "$expr":
+		v, err := evalExpr(e.Value, doc, m.vars)
+		return truthy(v), err
+	case "$comment":
+		return true, nil
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("memdb: unsupported query operator %s", e.Key)
+	}
+	return m.matchValues(resolve(doc, e.Key), e.Value)
+}
+
+// isOperatorDoc reports whether v is a document of query operators such as
+// {"$gt": 1} rather than a literal document to compare against.
+func isOperatorDoc(v interface{}) (bson.D, bool) {
+	d, ok := v.(bson.D)
+	if !ok || len(d) == 0 {
+		return nil, false
+	}
+	for _, e := range d {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, false
+		}
+	}
+	return d, true
+}
+
+// matchValues applies cond to the values found at a path.
+func (m matcher) matchValues(vals []interface{}, cond interface{}) (bool, error) {
+	ops, isOps := isOperatorDoc(cond)
+	if !isOps {
+		return eqAny(vals, cond), nil
+	}
+
+	var regexOpts string
+	if o, ok := get(ops, "$options"); ok {
+		regexOpts = str(o)
+	}
+	for _, op := range ops {
+		ok, err := m.matchOp(vals, op.Key, op.Value, regexOpts)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m matcher) matchOp(vals []interface{}, op string, arg interface{}, regexOpts string) (bool, error) {
+	switch op {
+	case "$eq":
+		return eqAny(vals, arg), nil
+	case "$ne":
+		return !eqAny(vals, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return anyScalar(vals, func(v interface{}) bool {
+			if typeOrder(v) != typeOrder(arg) {
+				return false
+			}
+			c := compare(v, arg)
+			switch op {
+			case "$gt":
+				return c > 0
+			case "$gte":
+				return c >= 0
+			case "$lt":
+				return c < 0
+			}
+			return c <= 0
+		}), nil
+	case "$in", "$nin":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memdb: %s needs an array", op)
+		}
+		hit := false
+		for _, want := range list {
+			if eqAny(vals, want) {
+				hit = true
+				break
+			}
+		}
+		return hit == (op == "$in"), nil
+	case "$exists":
+		return (len(vals) > 0) == truthy(arg), nil
+	case "$regex":
+		re, err := compileRegex(arg, regexOpts)
+		if err != nil {
+			return false, err
+		}
+		return anyScalar(vals, func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && re.MatchString(s)
+		}), nil
+	case "$options":
+		return true, nil
+	case "$not":
+		ok, err := m.matchValues(vals, arg)
+		return !ok, err
+	case "$size":
+		n, _ := toFloat(arg)
+		for _, v := range vals {
+			if a, ok := v.(bson.A); ok && float64(len(a)) == n {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memdb: $all needs an array")
+		}
+		for _, want := range list {
+			var hit bool
+			var err error
+			if sub, ok := isOperatorDoc(want); ok && len(sub) == 1 && sub[0].Key == "$elemMatch" {
+				hit, err = m.matchOp(vals, "$elemMatch", sub[0].Value, "")
+			} else {
+				hit = eqAny(vals, want)
+			}
+			if err != nil || !hit {
+				return false, err
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		cond, ok := arg.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("memdb: $elemMatch needs a document")
+		}
+		for _, v := range vals {
+			arr, ok := v.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, el := range arr {
+				hit, err := m.elemMatches(el, cond)
+				if err != nil {
+					return false, err
+				}
+				if hit {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$type":
+		return anyValue(vals, func(v interface{}) bool { return hasType(v, arg) }), nil
+	}
+	return false, fmt.Errorf("memdb: unsupported query operator %s", op)
+}
+
+// elemMatches applies an $elemMatch condition to one array element: value
+// operators apply to the element itself, anything else is a filter on it
+// as a document.
+func (m matcher) elemMatches(el interface{}, cond bson.D) (bool, error) {
+	if ops, ok := isOperatorDoc(cond); ok && !isLogical(ops) {
+		return m.matchValues([]interface{}{el}, ops)
+	}
+	d, ok := el.(bson.D)
+	if !ok {
+		return false, nil
+	}
+	return m.match(d, cond)
+}
+
+func isLogical(d bson.D) bool {
+	for _, e := range d {
+		switch e.Key {
+		case "$and", "$or", "$nor", "$expr":
+			return true
+		}
+	}
+	return false
+}
+
+// eqAny is query equality: a value matches if it equals want, or if it is
+// an array containing want. A missing field equals null.
+func eqAny(vals []interface{}, want interface{}) bool {
+	if len(vals) == 0 {
+		return want == nil
+	}
+	if re, ok := want.(primitive.Regex); ok {
+		compiled, err := compileRegex(re.Pattern, re.Options)
+		if err != nil {
+			return false
+		}
+		return anyScalar(vals, func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && compiled.MatchString(s)
+		})
+	}
+	return anyValue(vals, func(v interface{}) bool { return equal(v, want) })
+}
+
+// anyValue tests each value and, for arrays, each element.
+func anyValue(vals []interface{}, fn func(interface{}) bool) bool {
+	for _, v := range vals {
+		if fn(v) {
+			return true
+		}
+		if a, ok := v.(bson.A); ok {
+			for _, el := range a {
+				if fn(el) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anyScalar is anyValue without testing arrays as a whole.
+func anyScalar(vals []interface{}, fn func(interface{}) bool) bool {
+	return anyValue(vals, func(v interface{}) bool {
+		if _, isArr := v.(bson.A); isArr {
+			return false
+		}
+		return fn(v)
+	})
+}
+
+func hasType(v, want interface{}) bool {
+	name := str(want)
+	if n, ok := toFloat(want); ok {
+		name = map[float64]string{1: "double", 2: "string", 3: "object", 4: "array", 7: "objectId",
+			8: "bool", 9: "date", 10: "null", 16: "int", 18: "long"}[n]
+	}
+	switch name {
+	case "number":
+		return isNumber(v)
+	case "double":
+		_, ok := v.(float64)
+		return ok
+	case "int":
+		_, ok := v.(int32)
+		return ok
+	case "long":
+		_, ok := v.(int64)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(bson.D)
+		return ok
+	case "array":
+		_, ok := v.(bson.A)
+		return ok
+	case "objectId":
+		_, ok := v.(primitive.ObjectID)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "date":
+		_, ok := v.(primitive.DateTime)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+var (
+	regexMu    sync.Mutex
+	regexCache = map[string]*regexp.Regexp{}
+)
+
+// compileRegex turns a $regex argument and its options into a Go regexp.
+func compileRegex(pattern interface{}, opts string) (*regexp.Regexp, error) {
+	var p string
+	switch t := pattern.(type) {
+	case string:
+		p = t
+	case primitive.Regex:
+		p = t.Pattern
+		if opts == "" {
+			opts = t.Options
+		}
+	default:
+		return nil, fmt.Errorf("memdb: $regex needs a string")
+	}
+	flags := ""
+	for _, o := range opts {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		}
+	}
+	if flags != "" {
+		p = "(?" + flags + ")" + p
+	}
+
+	regexMu.Lock()
+	defer regexMu.Unlock()
+	if re, ok := regexCache[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("memdb: bad regex %q: %w", p, err)
+	}
+	regexCache[p] = re
+	return re, nil
+}
@@ -0,0 +1,432 @@
+package memdb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// updater applies one update document to one stored document.
+type updater struct {
+	filter       bson.D            // the query, for the positional $ operator
+	arrayFilters map[string]bson.D // identifier -> filter on {identifier: element}
+	inserting    bool              // $setOnInsert applies
+}
+
+func newUpdater(filter bson.D, arrayFilters []interface{}, inserting bool) (*updater, error) {
+	u := &updater{filter: filter, arrayFilters: map[string]bson.D{}, inserting: inserting}
+	for _, af := range arrayFilters {
+		d, err := toDoc(af)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range d {
+			id := e.Key
+			if !strings.HasPrefix(id, "$") {
+				id, _, _ = strings.Cut(id, ".")
+			} else if sub, ok := e.Value.(bson.A); ok && len(sub) > 0 {
+				// {$or: [{"s.a": ...}, ...]}: take the identifier from the first clause.
+				if first, ok := sub[0].(bson.D); ok && len(first) > 0 {
+					id, _, _ = strings.Cut(first[0].Key, ".")
+				}
+			}
+			u.arrayFilters[id] = append(u.arrayFilters[id], e)
+		}
+	}
+	return u, nil
+}
+
+// apply runs the update operators of update against doc and returns the
+// new document.
+func (u *updater) apply(doc bson.D, update bson.D) (bson.D, error) {
+	if len(update) == 0 {
+		return nil, fmt.Errorf("memdb: empty update document")
+	}
+	if !strings.HasPrefix(update[0].Key, "$") {
+		return nil, fmt.Errorf("memdb: update document must contain only operators")
+	}
+	out := cloneDoc(doc)
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memdb: %s needs a document", op.Key)
+		}
+		for _, f := range fields {
+			var err error
+			out, err = u.applyOp(out, op.Key, f.Key, f.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func (u *updater) applyOp(doc bson.D, op, path string, arg interface{}) (bson.D, error) {
+	var leaf func(cur interface{}, exists bool) (interface{}, bool, error)
+	create := true
+
+	switch op {
+	case "$set":
+		leaf = func(interface{}, bool) (interface{}, bool, error) { return clone(arg), false, nil }
+	case "$setOnInsert":
+		if !u.inserting {
+			return doc, nil
+		}
+		leaf = func(interface{}, bool) (interface{}, bool, error) { return clone(arg), false, nil }
+	case "$unset":
+		create = false
+		leaf = func(interface{}, bool) (interface{}, bool, error) { return nil, true, nil }
+	case "$inc", "$mul":
+		leaf = func(cur interface{}, exists bool) (interface{}, bool, error) {
+			if !exists || cur == nil {
+				if op == "$mul" {
+					return zeroLike(arg), false, nil
+				}
+				return arg, false, nil
+			}
+			if !isNumber(cur) || !isNumber(arg) {
+				return nil, false, fmt.Errorf("memdb: %s on non-numeric field %s", op, path)
+			}
+			return arith(op, cur, arg), false, nil
+		}
+	case "$min", "$max":
+		leaf = func(cur interface{}, exists bool) (interface{}, bool, error) {
+			c := compare(arg, cur)
+			if !exists || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+				return clone(arg), false, nil
+			}
+			return cur, false, nil
+		}
+	case "$currentDate":
+		leaf = func(interface{}, bool) (interface{}, bool, error) {
+			return primitive.NewDateTimeFromTime(time.Now()), false, nil
+		}
+	case "$push", "$addToSet":
+		items := bson.A{arg}
+		var slice *int
+		if d, ok := arg.(bson.D); ok {
+			if each, ok := get(d, "$each"); ok {
+				items, _ = each.(bson.A)
+				if s, ok := get(d, "$slice"); ok {
+					n, _ := toFloat(s)
+					k := int(n)
+					slice = &k
+				}
+			}
+		}
+		leaf = func(cur interface{}, exists bool) (interface{}, bool, error) {
+			arr, ok := cur.(bson.A)
+			if exists && cur != nil && !ok {
+				return nil, false, fmt.Errorf("memdb: %s on non-array field %s", op, path)
+			}
+			arr = append(bson.A(nil), arr...)
+			for _, it := range items {
+				if op == "$addToSet" && containsValue(arr, it) {
+					continue
+				}
+				arr = append(arr, clone(it))
+			}
+			if slice != nil {
+				arr = sliceArray(arr, *slice)
+			}
+			return arr, false, nil
+		}
+	case "$pull", "$pullAll":
+		create = false
+		leaf = func(cur interface{}, exists bool) (interface{}, bool, error) {
+			arr, ok := cur.(bson.A)
+			if !ok {
+				return cur, false, nil
+			}
+			out := bson.A{}
+			for _, el := range arr {
+				drop, err := pullMatches(op, el, arg)
+				if err != nil {
+					return nil, false, err
+				}
+				if !drop {
+					out = append(out, el)
+				}
+			}
+			return out, false, nil
+		}
+	case "$rename":
+		to := str(arg)
+		vals, found := lookupOne(doc, path)
+		if !found {
+			return doc, nil
+		}
+		doc, err := u.applyOp(doc, "$unset", path, "")
+		if err != nil {
+			return nil, err
+		}
+		return u.applyOp(doc, "$set", to, vals)
+	default:
+		return nil, fmt.Errorf("memdb: unsupported update operator %s", op)
+	}
+
+	parts := strings.Split(path, ".")
+	v, err := u.walk(doc, doc, parts, parts, create, leaf)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return bson.D{}, nil
+	}
+	return v.(bson.D), nil
+}
+
+// walk descends parts from v, creating missing documents when create is
+// set, and calls leaf at the target. It returns the updated v.
+func (u *updater) walk(root bson.D, v interface{}, parts, full []string, create bool,
+	leaf func(interface{}, bool) (interface{}, bool, error)) (interface{}, error) {
+
+	head, rest := parts[0], parts[1:]
+	switch t := v.(type) {
+	case nil:
+		if !create {
+			return nil, nil
+		}
+		return u.walk(root, bson.D{}, parts, full, create, leaf)
+
+	case bson.D:
+		cur, exists := get(t, head)
+		if len(rest) == 0 {
+			nv, remove, err := leaf(cur, exists)
+			if err != nil {
+				return nil, err
+			}
+			if remove {
+				return del(t, head), nil
+			}
+			return set(t, head, nv), nil
+		}
+		if !exists && !create {
+			return t, nil
+		}
+		child, err := u.walk(root, cur, rest, full, create, leaf)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil && !exists {
+			return t, nil
+		}
+		return set(t, head, child), nil
+
+	case bson.A:
+		var idxs []int
+		switch {
+		case head == "$[]":
+			for i := range t {
+				idxs = append(idxs, i)
+			}
+		case strings.HasPrefix(head, "$[") && strings.HasSuffix(head, "]"):
+			id := head[2 : len(head)-1]
+			cond, ok := u.arrayFilters[id]
+			if !ok {
+				return nil, fmt.Errorf("memdb: no array filter for identifier %q", id)
+			}
+			for i, el := range t {
+				hit, err := matcher{}.match(bson.D{{Key: id, Value: el}}, cond)
+				if err != nil {
+					return nil, err
+				}
+				if hit {
+					idxs = append(idxs, i)
+				}
+			}
+		case head == "$":
+			prefix := strings.Join(full[:len(full)-len(parts)], ".")
+			i, err := u.positional(root, prefix, t)
+			if err != nil {
+				return nil, err
+			}
+			idxs = []int{i}
+		default:
+			i, err := strconv.Atoi(head)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("memdb: cannot use %q to index an array", head)
+			}
+			for create && len(t) <= i {
+				t = append(t, nil)
+			}
+			if i < len(t) {
+				idxs = []int{i}
+			}
+		}
+
+		t = append(bson.A(nil), t...)
+		for _, i := range idxs {
+			if len(rest) == 0 {
+				nv, remove, err := leaf(t[i], true)
+				if err != nil {
+					return nil, err
+				}
+				if remove {
+					nv = nil
+				}
+				t[i] = nv
+				continue
+			}
+			child, err := u.walk(root, t[i], rest, full, create, leaf)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = child
+		}
+		return t, nil
+	}
+
+	if !create {
+		return v, nil
+	}
+	return nil, fmt.Errorf("memdb: cannot create field %q in a %T", head, v)
+}
+
+// positional finds the array element the query matched, for "$" paths:
+// the first element for which the query's conditions on that array hold.
+func (u *updater) positional(root bson.D, prefix string, arr bson.A) (int, error) {
+	var cond bson.D
+	for _, e := range u.filter {
+		if e.Key == prefix || strings.HasPrefix(e.Key, prefix+".") {
+			cond = append(cond, e)
+		}
+	}
+	if len(cond) == 0 {
+		return 0, fmt.Errorf("memdb: positional $ on %s needs a query on the array", prefix)
+	}
+	for i, el := range arr {
+		probe := cloneDoc(root)
+		probe, _ = (&updater{}).applyOp(probe, "$set", prefix, bson.A{el})
+		hit, err := matcher{}.match(probe, cond)
+		if err != nil {
+			return 0, err
+		}
+		if hit {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("memdb: positional $ on %s matched no element", prefix)
+}
+
+func pullMatches(op string, el, arg interface{}) (bool, error) {
+	if op == "$pullAll" {
+		list, _ := arg.(bson.A)
+		return containsValue(list, el), nil
+	}
+	cond, isDoc := arg.(bson.D)
+	if !isDoc {
+		return equal(el, arg), nil
+	}
+	if ops, ok := isOperatorDoc(cond); ok {
+		return matcher{}.matchValues([]interface{}{el}, ops)
+	}
+	d, ok := el.(bson.D)
+	if !ok {
+		return false, nil
+	}
+	return matcher{}.match(d, cond)
+}
+
+func containsValue(arr bson.A, v interface{}) bool {
+	for _, el := range arr {
+		if equal(el, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sliceArray(arr bson.A, n int) bson.A {
+	switch {
+	case n >= 0 && n < len(arr):
+		return arr[:n]
+	case n < 0 && -n < len(arr):
+		return arr[len(arr)+n:]
+	}
+	return arr
+}
+
+// arith adds or multiplies keeping integer types where Mongo would.
+func arith(op string, a, b interface{}) interface{} {
+	_, af := a.(float64)
+	_, bf := b.(float64)
+	if af || bf {
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		if op == "$mul" {
+			return x * y
+		}
+		return x + y
+	}
+	x, _ := toFloat(a)
+	y, _ := toFloat(b)
+	r := x + y
+	if op == "$mul" {
+		r = x * y
+	}
+	_, a32 := a.(int32)
+	_, b32 := b.(int32)
+	if a32 && b32 && r >= math.MinInt32 && r <= math.MaxInt32 {
+		return int32(r)
+	}
+	return int64(r)
+}
+
+func zeroLike(v interface{}) interface{} {
+	switch v.(type) {
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	}
+	return float64(0)
+}
+
+// upsertBase builds the document an upsert starts from: the equality
+// conditions of the filter.
+func upsertBase(filter bson.D) (bson.D, error) {
+	doc := bson.D{}
+	u := &updater{}
+	for _, e := range filter {
+		if strings.HasPrefix(e.Key, "$") {
+			if e.Key == "$and" {
+				clauses, _ := e.Value.(bson.A)
+				for _, c := range clauses {
+					sub, ok := c.(bson.D)
+					if !ok {
+						continue
+					}
+					part, err := upsertBase(sub)
+					if err != nil {
+						return nil, err
+					}
+					for _, pe := range part {
+						doc = set(doc, pe.Key, pe.Value)
+					}
+				}
+			}
+			continue
+		}
+		val := e.Value
+		if ops, ok := isOperatorDoc(val); ok {
+			eq, ok := get(ops, "$eq")
+			if !ok {
+				continue
+			}
+			val = eq
+		}
+		var err error
+		doc, err = u.applyOp(doc, "$set", e.Key, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
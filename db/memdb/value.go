@@ -0,0 +1,375 @@
+package memdb
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Documents are kept in the shape bson.Unmarshal produces for a bson.D
+// target: nested documents are bson.D, arrays bson.A, dates
+// primitive.DateTime and numbers int32, int64 or float64.
+
+// toDoc converts any marshallable document (struct, bson.M, bson.D, map)
+// to the stored shape. nil becomes an empty document.
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	if d, ok := v.(bson.D); ok && isNormal(d) {
+		return d, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// toValue converts a single value to the stored shape by wrapping it in a
+// document for the round trip.
+func toValue(v interface{}) (interface{}, error) {
+	d, err := toDoc(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	return d[0].Value, nil
+}
+
+// isNormal reports whether d already has the stored shape, so callers'
+// own documents (as the stored ones handed around internally) skip the
+// marshal round trip.
+func isNormal(d bson.D) bool {
+	for _, e := range d {
+		if !normalValue(e.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalValue(v interface{}) bool {
+	switch t := v.(type) {
+	case nil, string, int32, int64, float64, bool, primitive.DateTime, primitive.ObjectID,
+		primitive.Binary, primitive.Regex, primitive.Timestamp, primitive.Decimal128,
+		primitive.Null, primitive.MinKey, primitive.MaxKey:
+		return true
+	case bson.D:
+		return isNormal(t)
+	case bson.A:
+		for _, e := range t {
+			if !normalValue(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// clone deep-copies a stored value so callers cannot alias stored state.
+func clone(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		out := make(bson.D, len(t))
+		for i, e := range t {
+			out[i] = bson.E{Key: e.Key, Value: clone(e.Value)}
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(t))
+		for i, e := range t {
+			out[i] = clone(e)
+		}
+		return out
+	}
+	return v
+}
+
+func cloneDoc(d bson.D) bson.D { return clone(d).(bson.D) }
+
+// get returns the value of key in d.
+func get(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces or appends key in d.
+func set(d bson.D, key string, v interface{}) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			d[i].Value = v
+			return d
+		}
+	}
+	return append(d, bson.E{Key: key, Value: v})
+}
+
+// del removes key from d.
+func del(d bson.D, key string) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			return append(d[:i:i], d[i+1:]...)
+		}
+	}
+	return d
+}
+
+// resolve collects the values at a dotted path the way queries see them:
+// arrays along the way are traversed element by element, and numeric
+// parts may index into arrays.
+func resolve(v interface{}, path string) []interface{} {
+	var out []interface{}
+	walk(v, strings.Split(path, "."), &out)
+	return out
+}
+
+func walk(v interface{}, parts []string, out *[]interface{}) {
+	if len(parts) == 0 {
+		*out = append(*out, v)
+		return
+	}
+	switch t := v.(type) {
+	case bson.D:
+		if fv, ok := get(t, parts[0]); ok {
+			walk(fv, parts[1:], out)
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(parts[0]); err == nil {
+			if i >= 0 && i < len(t) {
+				walk(t[i], parts[1:], out)
+			}
+			return
+		}
+		for _, e := range t {
+			if d, ok := e.(bson.D); ok {
+				walk(d, parts, out)
+			}
+		}
+	}
+}
+
+// lookupOne returns the value at a dotted path for expressions: arrays of
+// documents map to the array of the field's values.
+func lookupOne(v interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case bson.D:
+			fv, ok := get(t, part)
+			if !ok {
+				return nil, false
+			}
+			v = fv
+		case bson.A:
+			var vals bson.A
+			for _, e := range t {
+				if fv, ok := lookupOne(e, part); ok {
+					vals = append(vals, fv)
+				}
+			}
+			v = vals
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Canonical type order used when comparing values of different types.
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case primitive.MinKey:
+		return 0
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, float64, int, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime, time.Time:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	case primitive.MaxKey:
+		return 12
+	}
+	return 13
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isNumber(v interface{}) bool {
+	_, ok := toFloat(v)
+	return ok
+}
+
+// compare orders two values: first by type class, then by value.
+func compare(a, b interface{}) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		return cmpInt(ta, tb)
+	}
+	switch x := a.(type) {
+	case int32, int64, float64, int, primitive.Decimal128:
+		fa, _ := toFloat(x)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		case math.IsNaN(fa) || math.IsNaN(fb):
+			return cmpInt(btoi(!math.IsNaN(fa)), btoi(!math.IsNaN(fb)))
+		}
+		return 0
+	case string:
+		return strings.Compare(x, str(b))
+	case primitive.Symbol:
+		return strings.Compare(string(x), str(b))
+	case bson.D:
+		y := b.(bson.D)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := strings.Compare(x[i].Key, y[i].Key); c != 0 {
+				return c
+			}
+			if c := compare(x[i].Value, y[i].Value); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(len(x), len(y))
+	case bson.A:
+		y := b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(len(x), len(y))
+	case primitive.Binary:
+		y := b.(primitive.Binary)
+		if len(x.Data) != len(y.Data) {
+			return cmpInt(len(x.Data), len(y.Data))
+		}
+		return bytes.Compare(x.Data, y.Data)
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case bool:
+		return cmpInt(btoi(x), btoi(b.(bool)))
+	case primitive.DateTime, time.Time:
+		return cmpInt64(millis(a), millis(b))
+	case primitive.Timestamp:
+		y := b.(primitive.Timestamp)
+		return primitive.CompareTimestamp(x, y)
+	case primitive.Regex:
+		y := b.(primitive.Regex)
+		return strings.Compare(x.Pattern+"/"+x.Options, y.Pattern+"/"+y.Options)
+	}
+	return 0
+}
+
+func equal(a, b interface{}) bool {
+	return typeOrder(a) == typeOrder(b) && compare(a, b) == 0
+}
+
+func str(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case primitive.Symbol:
+		return string(s)
+	}
+	return ""
+}
+
+func millis(v interface{}) int64 {
+	switch t := v.(type) {
+	case primitive.DateTime:
+		return int64(t)
+	case time.Time:
+		return t.UnixMilli()
+	}
+	return 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// truthy follows aggregation semantics: false, null, missing and zero are
+// false; everything else is true.
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return false
+	case bool:
+		return t
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
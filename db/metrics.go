@@ -0,0 +1,18 @@
+package db
+
+import (
+	"naevis/metrics"
+)
+
+var (
+	mongoOpDuration = metrics.NewHistogramVec("naevis_mongo_op_duration_seconds",
+		"Duration of Mongo operations run through WithMongo, including retries.", nil, "result")
+	mongoOpRetries = metrics.NewCounterVec("naevis_mongo_op_retries_total",
+		"Mongo operations retried by WithMongo.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("naevis_mongo_ops_in_flight",
+		"Mongo operations currently holding a WithMongo slot.",
+		func() float64 { return float64(len(mongoLimiter)) })
+}
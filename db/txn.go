@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// txnUnsupported is set by Use when the bound server is a standalone
+// mongod that Connect was allowed to accept (local dev only).
+var txnUnsupported atomic.Bool
+
+// RunInTransaction runs fn inside a multi-document transaction. Every
+// collection call inside fn must use the ctx it is given. Transient
+// transaction errors and unknown commit results are retried by the driver.
+//
+// fn runs without a transaction only with the in-memory store, or on a
+// standalone server in dev. Anywhere else a server that cannot run
+// transactions is an error, never a silent downgrade.
+func RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if txnUnsupported.Load() || Client == nil {
+		return fn(ctx)
+	}
+
+	session, err := Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	if err != nil && isTxnUnsupported(err) {
+		return fmt.Errorf("db: MongoDB cannot run transactions here: %w", err)
+	}
+	return err
+}
+
+// isTxnUnsupported reports whether err means the deployment is not a
+// replica set or sharded cluster.
+func isTxnUnsupported(err error) bool {
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Code == 20 {
+		return true
+	}
+	return strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
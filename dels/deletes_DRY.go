@@ -2,7 +2,9 @@ package dels
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/middleware"
@@ -19,17 +21,22 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type permissionFn func(ctx context.Context, r *http.Request, entityID string) error
-type afterDeleteFn func(ctx context.Context, entityID, userID string)
+
+// afterDeleteFn runs inside the delete transaction; Mongo writes must use
+// the ctx it receives so they commit together with the delete.
+type afterDeleteFn func(ctx context.Context, entityID, userID string) error
+
+// errNothingDeleted aborts the delete transaction when no document matched.
+var errNothingDeleted = errors.New("nothing deleted")
 
 // ---- Core Helper ----
 
 func deleteByField(
 	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
-	collection *mongo.Collection, paramKey, fieldKey, entityType, mqTopic string,
+	collection db.Collection, paramKey, fieldKey, entityType, mqTopic string,
 	perm permissionFn, after afterDeleteFn,
 ) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -37,7 +44,7 @@ func deleteByField(
 
 	entityID := ps.ByName(paramKey)
 	if entityID == "" {
-		http.Error(w, "Missing ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing ID")
 		return
 	}
 
@@ -45,23 +52,31 @@ func deleteByField(
 
 	if perm != nil {
 		if err := perm(ctx, r, entityID); err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
+			apierr.Respond(w, http.StatusForbidden, err.Error())
 			return
 		}
 	}
 
-	res, err := collection.DeleteOne(ctx, bson.M{fieldKey: entityID})
-	if err != nil || res.DeletedCount == 0 {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		res, err := collection.DeleteOne(ctx, bson.M{fieldKey: entityID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return errNothingDeleted
+		}
+		if after != nil {
+			if err := after(ctx, entityID, userID); err != nil {
+				return err
+			}
+		}
+		return mq.Emit(ctx, mqTopic, models.Index{EntityType: entityType, EntityId: entityID, Method: "DELETE"})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Delete failed")
 		return
 	}
 
-	if after != nil {
-		after(ctx, entityID, userID)
-	}
-
-	go mq.Emit(ctx, mqTopic, models.Index{EntityType: entityType, EntityId: entityID, Method: "DELETE"})
-
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true})
 }
 
@@ -69,7 +84,7 @@ func deleteByField(
 
 func softDeleteByField(
 	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
-	collection *mongo.Collection, paramKey, fieldKey, entityType, mqTopic string,
+	collection db.Collection, paramKey, fieldKey, entityType, mqTopic string,
 	update bson.M, perm permissionFn, after afterDeleteFn,
 ) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -77,7 +92,7 @@ func softDeleteByField(
 
 	entityID := ps.ByName(paramKey)
 	if entityID == "" {
-		http.Error(w, "Missing ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing ID")
 		return
 	}
 
@@ -85,23 +100,27 @@ func softDeleteByField(
 
 	if perm != nil {
 		if err := perm(ctx, r, entityID); err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
+			apierr.Respond(w, http.StatusForbidden, err.Error())
 			return
 		}
 	}
 
-	_, err := collection.UpdateOne(ctx, bson.M{fieldKey: entityID}, update)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := collection.UpdateOne(ctx, bson.M{fieldKey: entityID}, update); err != nil {
+			return err
+		}
+		if after != nil {
+			if err := after(ctx, entityID, userID); err != nil {
+				return err
+			}
+		}
+		return mq.Emit(ctx, mqTopic, models.Index{EntityType: entityType, EntityId: entityID, Method: "DELETE"})
+	})
 	if err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Delete failed")
 		return
 	}
 
-	if after != nil {
-		after(ctx, entityID, userID)
-	}
-
-	go mq.Emit(ctx, mqTopic, models.Index{EntityType: entityType, EntityId: entityID, Method: "DELETE"})
-
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true})
 }
 
@@ -169,22 +188,25 @@ func DeleteEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			}
 			return nil
 		},
-		func(ctx context.Context, entityID, userID string) {
-			deleteRelatedData(entityID)
-			userdata.DelUserData("event", entityID, userID)
+		func(ctx context.Context, entityID, userID string) error {
+			if err := deleteRelatedData(ctx, entityID); err != nil {
+				return err
+			}
+			return userdata.DelUserDataTx(ctx, "event", entityID, userID)
 		},
 	)
 }
 
 func DeleteFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	deleteByField(w, r, ps, db.FarmsCollection, "id", "farmid", "farm", "farm-deleted", nil,
-		func(ctx context.Context, entityID, userID string) {
+		func(ctx context.Context, entityID, userID string) error {
 			var farm models.Farm
 			if err := db.FarmsCollection.FindOne(ctx, bson.M{"farmid": entityID}).Decode(&farm); err == nil {
 				if farm.Banner != "" {
 					_ = os.Remove("." + farm.Banner)
 				}
 			}
+			return nil
 		},
 	)
 }
@@ -203,8 +225,9 @@ func DeleteTool(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 func DeleteMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	deleteByField(w, r, ps, db.MerchCollection, "merchid", "merchid", "merch", "merch-deleted", nil,
-		func(ctx context.Context, entityID, userID string) {
+		func(ctx context.Context, entityID, userID string) error {
 			rdx.RdxDel("merch:" + entityID)
+			return nil
 		},
 	)
 }
@@ -226,16 +249,16 @@ func DeleteReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 			}
 			return nil
 		},
-		func(ctx context.Context, entityID, userID string) {
-			userdata.DelUserData("review", entityID, userID)
+		func(ctx context.Context, entityID, userID string) error {
+			return userdata.DelUserDataTx(ctx, "review", entityID, userID)
 		},
 	)
 }
 
 func DeleteMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	deleteByField(w, r, ps, db.MediaCollection, "id", "mediaid", "media", "media-deleted", nil,
-		func(ctx context.Context, entityID, userID string) {
-			userdata.DelUserData("media", entityID, userID)
+		func(ctx context.Context, entityID, userID string) error {
+			return userdata.DelUserDataTx(ctx, "media", entityID, userID)
 		},
 	)
 }
@@ -253,17 +276,18 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			}
 			return nil
 		},
-		func(ctx context.Context, entityID, userID string) {
+		func(ctx context.Context, entityID, userID string) error {
 			rdx.RdxDel("place:" + entityID)
-			userdata.DelUserData("place", entityID, userID)
+			return userdata.DelUserDataTx(ctx, "place", entityID, userID)
 		},
 	)
 }
 
 func DeleteMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	deleteByField(w, r, ps, db.MenuCollection, "menuid", "menuid", "menu", "menu-deleted", nil,
-		func(ctx context.Context, entityID, userID string) {
+		func(ctx context.Context, entityID, userID string) error {
 			rdx.RdxDel("menu:" + entityID)
+			return nil
 		},
 	)
 }
@@ -280,8 +304,9 @@ func DeleteProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 			}
 			return nil
 		},
-		func(ctx context.Context, entityID, userID string) {
+		func(ctx context.Context, entityID, userID string) error {
 			InvalidateCachedProfile(userID)
+			return nil
 		},
 	)
 }
@@ -313,31 +338,31 @@ func DeleteItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 
 func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	deleteByField(w, r, ps, db.PostsCollection, "postid", "postid", "feedpost", "post-deleted", nil,
-		func(ctx context.Context, postID, userID string) {
+		func(ctx context.Context, postID, userID string) error {
 			var existingFile models.FileMetadata
-			db.FilesCollection.FindOne(context.TODO(), bson.M{"postid": postID}).Decode(&existingFile)
+			db.FilesCollection.FindOne(ctx, bson.M{"postid": postID}).Decode(&existingFile)
 			RemoveUserFile(userID, postID, existingFile.Hash)
-			userdata.DelUserData("feedpost", postID, userID)
+			return userdata.DelUserDataTx(ctx, "feedpost", postID, userID)
 		},
 	)
 }
 
 // ---- Helpers ----
 
-func deleteRelatedData(eventID string) error {
-	_, err := db.TicketsCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+func deleteRelatedData(ctx context.Context, eventID string) error {
+	_, err := db.TicketsCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return err
 	}
-	_, err = db.MediaCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.MediaCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return err
 	}
-	_, err = db.MerchCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.MerchCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return err
 	}
-	_, err = db.ArtistEventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.ArtistEventsCollection.DeleteOne(ctx, bson.M{"eventid": eventID})
 	return err
 }
 
@@ -8,8 +8,10 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
+	"naevis/pagination"
 	"naevis/utils"
 
 	"github.com/julienschmidt/httprouter"
@@ -27,12 +29,12 @@ func UploadAttachment(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	chatIDHex := ps.ByName("chatid")
 	chatID, err := primitive.ObjectIDFromHex(chatIDHex)
 	if err != nil {
-		writeErr(w, "invalid chatid", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid chatid")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		writeErr(w, "invalid form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid form")
 		return
 	}
 
@@ -44,7 +46,7 @@ func UploadAttachment(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		}
 	}
 	if header == nil {
-		writeErr(w, "no file provided", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "no file provided")
 		return
 	}
 
@@ -60,21 +62,21 @@ func UploadAttachment(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	case strings.HasPrefix(contentType, "application/"):
 		picType = filemgr.PicFile
 	default:
-		writeErr(w, "unsupported file type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "unsupported file type")
 		return
 	}
 
 	// Save file via filemgr
 	savedName, err := filemgr.SaveFormFile(r.MultipartForm, "file", filemgr.EntityChat, picType, false)
 	if err != nil {
-		writeErr(w, "cannot save file", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "cannot save file")
 		return
 	}
 
 	// Persist media message
 	msg, err := persistMediaMessage(ctx, chatID, user, savedName, contentType)
 	if err != nil {
-		writeErr(w, "failed to persist message", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "failed to persist message")
 		return
 	}
 
@@ -87,14 +89,14 @@ func GetUserChats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	user := utils.GetUserIDFromRequest(r)
 	cursor, err := db.ChatsCollection.Find(ctx, bson.M{"participants": user})
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var chats []Chat
 	if err := cursor.All(ctx, &chats); err != nil {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
 	// ensure non-nil slice
@@ -116,7 +118,7 @@ func StartNewChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid body", 400)
+		apierr.Respond(w, 400, "invalid body")
 		return
 	}
 
@@ -128,7 +130,7 @@ func StartNewChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		}
 	}
 	if !found {
-		http.Error(w, "must include yourself", 400)
+		apierr.Respond(w, 400, "must include yourself")
 		return
 	}
 
@@ -146,7 +148,7 @@ func StartNewChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 	if err != mongo.ErrNoDocuments {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
 
@@ -160,7 +162,7 @@ func StartNewChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 	res, err := db.ChatsCollection.InsertOne(ctx, chat)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
 	chat.ID = res.InsertedID.(primitive.ObjectID)
@@ -173,58 +175,53 @@ func GetChatByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	chatID, err := primitive.ObjectIDFromHex(ps.ByName("chatid"))
 	if err != nil {
-		http.Error(w, "invalid chatid", 400)
+		apierr.Respond(w, 400, "invalid chatid")
 		return
 	}
 	var chat Chat
 	if err := db.ChatsCollection.FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat); err != nil {
-		http.Error(w, "not found", 404)
+		apierr.Respond(w, 404, "not found")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(chat)
 }
 
+// messageSort lists a chat oldest first; _id breaks ties.
+var messageSort = pagination.Sort{Field: "createdAt", IDField: "_id"}
+
+// GetChatMessages returns one page of a chat's messages in the order they
+// were sent. Pass next_cursor back as ?cursor= for the following page.
 func GetChatMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
-	chatID, err := primitive.ObjectIDFromHex(ps.ByName("chatid"))
+	chatID, err := primitive.ObjectIDFromHex(ps.ByName("chatId"))
 	if err != nil {
-		http.Error(w, "invalid chatid", 400)
+		apierr.Respond(w, 400, "invalid chatid")
 		return
 	}
-	// pagination
-	limit := int64(50)
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if v, err := parseInt64(l); err == nil {
-			limit = v
-		}
-	}
-	skip := int64(0)
-	if s := r.URL.Query().Get("skip"); s != "" {
-		if v, err := parseInt64(s); err == nil {
-			skip = v
-		}
+	page, err := pagination.Parse(r, 50, 200)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
 	}
 
-	opts := options.Find().SetSort(bson.M{"createdAt": 1}).SetLimit(limit).SetSkip(skip)
-	cursor, err := db.MessagesCollection.Find(ctx, bson.M{"chatid": chatID}, opts)
+	filter := messageSort.Filter(bson.M{"chatId": chatID}, page.After)
+	cursor, err := db.MessagesCollection.Find(ctx, filter, messageSort.FindOptions(page.Limit))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var msgs []Message
 	if err := cursor.All(ctx, &msgs); err != nil {
-		http.Error(w, err.Error(), 500)
+		apierr.Respond(w, 500, err.Error())
 		return
 	}
-	// ensure non-nil slice
-	if msgs == nil {
-		msgs = make([]Message, 0)
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(msgs)
+	msgs, next := pagination.Trim(msgs, page.Limit, func(m Message) pagination.Cursor {
+		return pagination.Cursor{Key: m.CreatedAt, ID: m.ID}
+	})
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(msgs, next))
 }
 
 // SendMessageREST (updated)
@@ -234,7 +231,7 @@ func SendMessageREST(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	ctx := r.Context()
 	chatID, err := primitive.ObjectIDFromHex(ps.ByName("chatid"))
 	if err != nil {
-		writeErr(w, "invalid chatid", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid chatid")
 		return
 	}
 
@@ -243,14 +240,14 @@ func SendMessageREST(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		ClientID string `json:"clientId,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeErr(w, "invalid body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid body")
 		return
 	}
 
 	sender := utils.GetUserIDFromRequest(r)
 	msg, err := persistMessage(ctx, chatID, sender, body.Content, "", "")
 	if err != nil {
-		writeErr(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -274,12 +271,12 @@ func EditMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	msgID, err := primitive.ObjectIDFromHex(ps.ByName("messageId"))
 	if err != nil {
-		http.Error(w, "invalid messageId", 400)
+		apierr.Respond(w, 400, "invalid messageId")
 		return
 	}
 	var body struct{ Content string }
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid body", 400)
+		apierr.Respond(w, 400, "invalid body")
 		return
 	}
 	now := time.Now()
@@ -288,7 +285,7 @@ func EditMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		bson.M{"$set": bson.M{"content": body.Content, "editedAt": now}},
 	)
 	if err != nil || res.MatchedCount == 0 {
-		http.Error(w, "not found or no permission", 404)
+		apierr.Respond(w, 404, "not found or no permission")
 		return
 	}
 	w.WriteHeader(204)
@@ -298,7 +295,7 @@ func DeleteMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	ctx := r.Context()
 	msgID, err := primitive.ObjectIDFromHex(ps.ByName("messageId"))
 	if err != nil {
-		http.Error(w, "invalid messageId", 400)
+		apierr.Respond(w, 400, "invalid messageId")
 		return
 	}
 	res, err := db.MessagesCollection.UpdateOne(ctx,
@@ -306,7 +303,7 @@ func DeleteMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		bson.M{"$set": bson.M{"deleted": true}},
 	)
 	if err != nil || res.MatchedCount == 0 {
-		http.Error(w, "not found or no permission", 404)
+		apierr.Respond(w, 404, "not found or no permission")
 		return
 	}
 	w.WriteHeader(204)
@@ -316,7 +313,7 @@ func SearchMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	ctx := r.Context()
 	chatID, err := primitive.ObjectIDFromHex(ps.ByName("chatid"))
 	if err != nil {
-		http.Error(w, "invalid chatid", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid chatid")
 		return
 	}
 	term := r.URL.Query().Get("term")
@@ -347,14 +344,14 @@ func SearchMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	cursor, err := db.MessagesCollection.Find(ctx, filter, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var msgs []Message
 	if err := cursor.All(ctx, &msgs); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	if msgs == nil {
@@ -374,7 +371,7 @@ func GetUnreadCount(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	// First, find all chats the user participates in
 	cursor, err := db.ChatsCollection.Find(ctx, bson.M{"participants": user})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(ctx)
@@ -413,7 +410,7 @@ func MarkAsRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	msgID, err := primitive.ObjectIDFromHex(ps.ByName("messageId"))
 	if err != nil {
-		http.Error(w, "invalid messageId", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid messageId")
 		return
 	}
 	user := utils.GetUserIDFromRequest(r)
@@ -423,11 +420,11 @@ func MarkAsRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		bson.M{"$addToSet": bson.M{"readBy": user}},
 	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	if res.MatchedCount == 0 {
-		http.Error(w, "message not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "message not found")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -9,7 +9,9 @@ import (
 	"sync"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
+	"naevis/metrics"
 	"naevis/middleware"
 
 	"github.com/gorilla/websocket"
@@ -29,6 +31,16 @@ var (
 	}
 )
 
+func init() {
+	metrics.NewGaugeFunc("naevis_discord_websocket_connections",
+		"Open discord websocket connections.",
+		func() float64 {
+			clients.RLock()
+			defer clients.RUnlock()
+			return float64(len(clients.m))
+		})
+}
+
 // HandleWebSocket manages connections & messages
 func HandleWebSocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
@@ -38,7 +50,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	claims, err := middleware.ValidateJWT(token)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	userID := claims.UserID
@@ -247,7 +259,3 @@ func parseInt64(s string) (int64, error) {
 	}
 	return v, nil
 }
-
-func writeErr(w http.ResponseWriter, msg string, code int) {
-	http.Error(w, msg, code)
-}
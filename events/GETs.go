@@ -3,6 +3,7 @@ package events
 import (
 	"context"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -31,14 +32,14 @@ func GetEvents(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	totalCount, err := db.EventsCollection.CountDocuments(ctx, filter)
 	if err != nil {
 		log.Println("CountDocuments error:", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch event count")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch event count")
 		return
 	}
 
 	opts := options.Find().SetSkip(skip).SetLimit(limit).SetSort(bson.D{{Key: "created_at", Value: -1}})
 	rawEvents, err := utils.FindAndDecode[models.Event](ctx, db.EventsCollection, filter, opts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch events")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch events")
 		return
 	}
 
@@ -7,8 +7,10 @@ import (
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/money"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
@@ -67,20 +69,20 @@ func GetEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	cur, err := db.EventsCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		log.Println("Aggregate error:", err)
-		http.Error(w, "Failed to fetch event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch event")
 		return
 	}
 	defer cur.Close(ctx)
 
 	if !cur.Next(ctx) {
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Event not found")
 		return
 	}
 
 	var rawEvent models.Event
 	if err := cur.Decode(&rawEvent); err != nil {
 		log.Println("Decode error:", err)
-		http.Error(w, "Failed to decode event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode event")
 		return
 	}
 
@@ -121,17 +123,17 @@ func toSafeEvent(e models.Event) models.Event {
 	}
 
 	// compute prices & currency
-	var prices []float64
+	var prices []money.Money
 	var currency string
 	if len(e.Tickets) > 0 {
 		for _, t := range e.Tickets {
 			prices = append(prices, t.Price)
-			if currency == "" && t.Currency != "" {
-				currency = t.Currency
+			if currency == "" && t.Price.Currency != "" {
+				currency = t.Price.Currency
 			}
 		}
 	} else {
-		prices = []float64{0}
+		prices = []money.Money{{Currency: money.Default}}
 	}
 	e.Prices = prices
 	e.Currency = currency
@@ -143,7 +145,7 @@ func AddFAQs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	eventID := ps.ByName("eventid")
 	if eventID == "" {
 		log.Println("Missing event ID in request")
-		http.Error(w, "Missing event ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing event ID")
 		return
 	}
 
@@ -152,13 +154,13 @@ func AddFAQs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := json.NewDecoder(r.Body).Decode(&newFAQ)
 	if err != nil {
 		log.Printf("Invalid request payload: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
 	// Validate the input
 	if newFAQ.Title == "" || newFAQ.Content == "" {
-		http.Error(w, "Title and content are required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Title and content are required")
 		return
 	}
 
@@ -170,13 +172,13 @@ func AddFAQs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	)
 	if err != nil {
 		log.Printf("Error updating event %s: %v", eventID, err)
-		http.Error(w, "Error updating event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error updating event")
 		return
 	}
 
 	if result.MatchedCount == 0 {
 		log.Printf("Event with ID %s not found", eventID)
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Event not found")
 		return
 	}
 
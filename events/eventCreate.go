@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -24,26 +25,26 @@ import (
 func CreateEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
 	event, err := parseEventData(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
 	prepareEventDefaults(&event, requestingUserID)
 
 	if err := parseArtistData(r, &event); err != nil {
-		http.Error(w, "Invalid artists data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid artists data")
 		return
 	}
 
@@ -51,7 +52,7 @@ func CreateEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	if name, err := processEventImageUpload(r, "banner", filemgr.EntityEvent, filemgr.PicBanner, event.EventID, true); err == nil && name != "" {
 		event.Banner = name
 	} else if err != nil {
-		http.Error(w, "Banner upload failed: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Banner upload failed: "+err.Error())
 		return
 	}
 
@@ -59,25 +60,30 @@ func CreateEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	if name, err := processEventImageUpload(r, "event-seating", filemgr.EntityEvent, filemgr.PicSeating, event.EventID, false); err == nil && name != "" {
 		event.SeatingPlanImage = name
 	} else if err != nil {
-		http.Error(w, "Seating plan upload failed: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Seating plan upload failed: "+err.Error())
 		return
 	}
 
 	// Insert to DB
-	result, err := db.EventsCollection.InsertOne(context.TODO(), event)
-	if err != nil || result.InsertedID == nil {
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.EventsCollection.InsertOne(ctx, event); err != nil {
+			return err
+		}
+		if err := userdata.SetUserDataTx(ctx, "event", event.EventID, requestingUserID, "", ""); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "event-created", models.Index{EntityType: "event", EntityId: event.EventID, Method: "POST"})
+	})
+	if err != nil {
 		log.Printf("DB insert error: %v", err)
-		http.Error(w, "Error saving event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error saving event")
 		return
 	}
 
-	userdata.SetUserData("event", event.EventID, requestingUserID, "", "")
-	go mq.Emit(ctx, "event-created", models.Index{EntityType: "event", EntityId: event.EventID, Method: "POST"})
-
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(event); err != nil {
 		log.Printf("Encoding response error: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
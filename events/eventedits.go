@@ -2,7 +2,10 @@ package events
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -15,33 +18,34 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	eventID := ps.ByName("eventid")
 	if eventID == "" {
-		http.Error(w, "Missing event ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing event ID")
 		return
 	}
 
 	updateFields, err := updateEventFields(r)
 	if err != nil {
 		log.Printf("Invalid update fields for event %s: %v", eventID, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if err := validateUpdateFields(updateFields); err != nil {
 		log.Printf("Validation failed for event %s: %v", eventID, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Banner image
 	bannerName, err := processEventImageUpload(r, "event-banner", filemgr.EntityEvent, filemgr.PicBanner, eventID, true)
 	if err != nil {
-		http.Error(w, "Banner upload failed: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Banner upload failed: "+err.Error())
 		return
 	}
 	if bannerName != "" {
@@ -51,7 +55,7 @@ func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Seating plan image
 	seatingName, err := processEventImageUpload(r, "event-seating", filemgr.EntityEvent, filemgr.PicSeating, eventID, false)
 	if err != nil {
-		http.Error(w, "Seating plan upload failed: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Seating plan upload failed: "+err.Error())
 		return
 	}
 	if seatingName != "" {
@@ -61,30 +65,37 @@ func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	updateFields["updated_at"] = time.Now()
 
 	// Update in DB
-	result, err := db.EventsCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"eventid": eventID},
-		bson.M{"$set": updateFields},
-	)
-	if err != nil {
-		log.Printf("Error updating event %s: %v", eventID, err)
-		http.Error(w, "Error updating event", http.StatusInternalServerError)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		result, err := db.EventsCollection.UpdateOne(
+			ctx,
+			bson.M{"eventid": eventID},
+			bson.M{"$set": updateFields},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "event-updated", models.Index{EntityType: "event", EntityId: eventID, Method: "PUT"})
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Event not found")
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		http.Error(w, "Event not found", http.StatusNotFound)
+	if err != nil {
+		log.Printf("Error updating event %s: %v", eventID, err)
+		apierr.Respond(w, http.StatusInternalServerError, "Error updating event")
 		return
 	}
 
 	// Fetch updated event
 	var updatedEvent models.Event
 	if err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&updatedEvent); err != nil {
-		http.Error(w, "Error retrieving updated event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error retrieving updated event")
 		return
 	}
 
-	go mq.Emit(ctx, "event-updated", models.Index{EntityType: "event", EntityId: eventID, Method: "PUT"})
 	utils.RespondWithJSON(w, http.StatusOK, updatedEvent)
 }
 
@@ -96,7 +107,7 @@ func DeleteEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Get the ID of the requesting user from the context
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
@@ -105,35 +116,37 @@ func DeleteEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var event models.Event
 	err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&event)
 	if err != nil {
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Event not found")
 		return
 	}
 
 	// Check if the requesting user is the creator of the event
 	if event.CreatorID != requestingUserID {
 		log.Printf("User %s attempted to delete an event they did not create. models.EventID: %s", requestingUserID, eventID)
-		http.Error(w, "Unauthorized to delete this event", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Unauthorized to delete this event")
 		return
 	}
 
-	// Delete the event from MongoDB
-	_, err = db.EventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID})
+	// Delete the event, its related data (tickets, media, merch) and
+	// its user data from MongoDB together with the index event
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.EventsCollection.DeleteOne(ctx, bson.M{"eventid": eventID}); err != nil {
+			return fmt.Errorf("error deleting event")
+		}
+		if err := deleteRelatedData(ctx, eventID); err != nil {
+			return err
+		}
+		if err := userdata.DelUserDataTx(ctx, "event", event.EventID, requestingUserID); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "event", EntityId: eventID, Method: "DELETE"}
+		return mq.Emit(ctx, "event-deleted", m)
+	})
 	if err != nil {
-		http.Error(w, "error deleting event", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Delete related data (tickets, media, merch)
-	if err := deleteRelatedData(eventID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	userdata.DelUserData("event", event.EventID, requestingUserID)
-
-	m := models.Index{EntityType: "event", EntityId: eventID, Method: "DELETE"}
-	go mq.Emit(ctx, "event-deleted", m)
-
 	// Send success response
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Event deleted successfully"})
 }
@@ -81,24 +81,24 @@ func validateUpdateFields(updateFields bson.M) error {
 }
 
 // Delete related data (tickets, media, merch) from collections
-func deleteRelatedData(eventID string) error {
+func deleteRelatedData(ctx context.Context, eventID string) error {
 	// Delete related data from collections
-	_, err := db.TicketsCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	_, err := db.TicketsCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return fmt.Errorf("error deleting related tickets")
 	}
 
-	_, err = db.MediaCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.MediaCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return fmt.Errorf("error deleting related media")
 	}
 
-	_, err = db.MerchCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.MerchCollection.DeleteMany(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return fmt.Errorf("error deleting related merch")
 	}
 
-	_, err = db.ArtistEventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID})
+	_, err = db.ArtistEventsCollection.DeleteOne(ctx, bson.M{"eventid": eventID})
 	if err != nil {
 		return fmt.Errorf("error deleting related artistevent")
 	}
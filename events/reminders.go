@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"time"
+
+	"naevis/db"
+	"naevis/mail"
+	"naevis/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobSendReminders is the scheduler job that reminds ticket holders of
+// upcoming events.
+const JobSendReminders = "events.send-reminders"
+
+// reminderLead is how far ahead of the start ticket holders are reminded.
+const reminderLead = 24 * time.Hour
+
+// SendReminders is the JobSendReminders job. Each event is claimed by
+// setting reminder_sent_at before anyone is notified, so an event is never
+// reminded twice even if runs overlap.
+func SendReminders(ctx context.Context, _ json.RawMessage) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"start_date_time":  bson.M{"$gt": now, "$lte": now.Add(reminderLead)},
+		"reminder_sent_at": bson.M{"$exists": false},
+	}
+	cur, err := db.EventsCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{
+		"eventid": 1, "title": 1, "placename": 1, "location": 1, "start_date_time": 1,
+	}))
+	if err != nil {
+		return err
+	}
+	var due []models.Event
+	if err := cur.All(ctx, &due); err != nil {
+		return err
+	}
+
+	for _, ev := range due {
+		claim, err := db.EventsCollection.UpdateOne(ctx,
+			bson.M{"eventid": ev.EventID, "reminder_sent_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"reminder_sent_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+		if claim.ModifiedCount == 0 {
+			continue
+		}
+
+		holders, err := db.PurchasedTicketsCollection.Distinct(ctx, "userid", bson.M{"eventid": ev.EventID})
+		if err != nil {
+			log.Printf("[Reminders] ticket holders of %s: %v", ev.EventID, err)
+			continue
+		}
+		venue := ev.PlaceName
+		if venue == "" {
+			venue = ev.Location
+		}
+		for _, h := range holders {
+			userID, _ := h.(string)
+			if userID == "" {
+				continue
+			}
+			err := mail.QueueToUser(ctx, userID, "event-reminder", map[string]any{
+				"EventTitle": ev.Title,
+				"StartsAt":   ev.StartDateTime,
+				"Venue":      venue,
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "reminder email not queued", "user_id", userID, "event_id", ev.EventID, "error", err)
+			}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package fanmade
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -33,10 +34,10 @@ func GetMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}).Decode(&media)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Media not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Media not found")
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -53,7 +54,7 @@ func DeleteMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok || requestingUserID == "" {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -65,21 +66,35 @@ func DeleteMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}).Decode(&media)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Media not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Media not found")
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
 	if media.CreatorID != requestingUserID {
-		http.Error(w, "Not authorized to delete this media", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Not authorized to delete this media")
 		return
 	}
 
-	_, err = db.MediaCollection.DeleteOne(ctx, bson.M{"mediaid": mediaID})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.MediaCollection.DeleteOne(ctx, bson.M{"mediaid": mediaID}); err != nil {
+			return err
+		}
+		if err := userdata.DelUserDataTx(ctx, "media", mediaID, requestingUserID); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "media-deleted", models.Index{
+			EntityType: "media",
+			EntityId:   mediaID,
+			Method:     "DELETE",
+			ItemType:   entityType,
+			ItemId:     entityID,
+		})
+	})
 	if err != nil {
-		http.Error(w, "Failed to delete media", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete media")
 		return
 	}
 
@@ -91,16 +106,6 @@ func DeleteMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	thumbPath := filepath.Join(filemgr.ResolvePath(filemgr.EntityMedia, filemgr.PicThumb), media.MediaID+".jpg")
 	_ = os.Remove(thumbPath)
 
-	userdata.DelUserData("media", mediaID, requestingUserID)
-
-	go mq.Emit(ctx, "media-deleted", models.Index{
-		EntityType: "media",
-		EntityId:   mediaID,
-		Method:     "DELETE",
-		ItemType:   entityType,
-		ItemId:     entityID,
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "Media deleted successfully"})
@@ -114,7 +119,7 @@ func GetMedias(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	filter := bson.M{"entityid": ps.ByName("entityid"), "entitytype": ps.ByName("entitytype")}
 	medias, err := utils.FindAndDecode[models.Media](ctx, db.MediaCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve media")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to retrieve media")
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, medias)
@@ -132,7 +137,7 @@ func GetMediaGroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	cur, err := db.MediaCollection.Find(ctx, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve media")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to retrieve media")
 		return
 	}
 	defer cur.Close(ctx)
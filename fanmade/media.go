@@ -1,8 +1,10 @@
 package fanmade
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -22,13 +24,13 @@ func AddMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	entityID := ps.ByName("entityid")
 
 	if entityID == "" {
-		http.Error(w, "Entity ID is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Entity ID is required")
 		return
 	}
 
 	requestingUserID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok || requestingUserID == "" {
-		http.Error(w, "Invalid or missing user ID", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid or missing user ID")
 		return
 	}
 
@@ -37,11 +39,11 @@ func AddMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		Files   []map[string]interface{} `json:"files"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
 		return
 	}
 	if len(payload.Files) == 0 {
-		http.Error(w, "No files provided", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "No files provided")
 		return
 	}
 
@@ -84,22 +86,32 @@ func AddMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			Extn:         extn,
 		}
 
-		if _, err := db.MediaCollection.InsertOne(ctx, media); err != nil {
-			log.Printf("Failed to insert media %s: %v", filename, err)
-			continue
-		}
-
-		userdata.SetUserData("media", media.MediaID, requestingUserID, entityType, entityID)
 		insertedMedia = append(insertedMedia, media)
 	}
 
-	go mq.Emit(ctx, "media-created", models.Index{
-		EntityType: "media",
-		EntityId:   mediaGroupID,
-		Method:     "POST",
-		ItemType:   entityType,
-		ItemId:     entityID,
+	// The whole group and its event commit together
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, media := range insertedMedia {
+			if _, err := db.MediaCollection.InsertOne(ctx, media); err != nil {
+				return err
+			}
+			if err := userdata.SetUserDataTx(ctx, "media", media.MediaID, requestingUserID, entityType, entityID); err != nil {
+				return err
+			}
+		}
+		return mq.Emit(ctx, "media-created", models.Index{
+			EntityType: "media",
+			EntityId:   mediaGroupID,
+			Method:     "POST",
+			ItemType:   entityType,
+			ItemId:     entityID,
+		})
 	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "inserting media group failed", "media_group_id", mediaGroupID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save media")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(insertedMedia)
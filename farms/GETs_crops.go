@@ -5,8 +5,10 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"io"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/money"
 	"naevis/rdx"
 	"naevis/utils"
 	"net/http"
@@ -38,20 +40,28 @@ func GetFilteredCrops(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		filter["quantity"] = bson.M{"$gt": 0}
 	}
 
+	// Price bounds are in the currency parameter, rupees by default, and
+	// only match crops priced in it.
+	currency := params.Get("currency")
+	if currency == "" {
+		currency = money.Default
+	}
 	price := bson.M{}
-	if min := utils.ParseFloat(params.Get("minPrice")); min > 0 {
-		price["$gte"] = min
+	if min, err := money.Parse(params.Get("minPrice"), currency); err == nil && min.IsPositive() {
+		price["$gte"] = min.Minor
+		filter["price.currency"] = min.Currency
 	}
-	if max := utils.ParseFloat(params.Get("maxPrice")); max > 0 {
-		price["$lte"] = max
+	if max, err := money.Parse(params.Get("maxPrice"), currency); err == nil && max.IsPositive() {
+		price["$lte"] = max.Minor
+		filter["price.currency"] = max.Currency
 	}
 	if len(price) > 0 {
-		filter["price"] = price
+		filter["price.amount"] = price
 	}
 
 	crops, err := utils.FindAndDecode[models.Crop](ctx, db.CropsCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch crops")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch crops")
 		return
 	}
 
@@ -85,7 +95,7 @@ func GetPreCropCatalogue(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 
 	file, err := os.Open("data/pre_crop_catalogue.csv")
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to retrieve catalogue"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to retrieve catalogue")
 		return
 	}
 	defer file.Close()
@@ -93,7 +103,7 @@ func GetPreCropCatalogue(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	reader := csv.NewReader(file)
 	headers, err := reader.Read()
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Invalid CSV"})
+		apierr.Respond(w, http.StatusInternalServerError, "Invalid CSV")
 		return
 	}
 
@@ -146,14 +156,14 @@ func GetCropCatalogue(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 
 	cursor, err := db.CropsCollection.Find(ctx, bson.M{})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to fetch crop catalogue"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch crop catalogue")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var allCrops []models.Crop
 	if err := cursor.All(ctx, &allCrops); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to decode crops"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode crops")
 		return
 	}
 
@@ -175,9 +185,9 @@ func GetCropTypes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	pipeline := mongo.Pipeline{
 		{{Key: "$group", Value: bson.M{
-			"_id":      "$name", // group by crop name
-			"minPrice": bson.M{"$min": "$price"},
-			"maxPrice": bson.M{"$max": "$price"},
+			"_id":      bson.M{"name": "$name", "currency": "$price.currency"}, // group by crop name and currency
+			"minPrice": bson.M{"$min": "$price.amount"},
+			"maxPrice": bson.M{"$max": "$price.amount"},
 			"availableCount": bson.M{
 				"$sum": bson.M{
 					"$cond": []interface{}{
@@ -189,7 +199,8 @@ func GetCropTypes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 			"unit":   bson.M{"$first": "$unit"},
 		}}},
 		{{Key: "$project", Value: bson.M{
-			"name":           "$_id",
+			"name":           "$_id.name",
+			"currency":       "$_id.currency",
 			"minPrice":       1,
 			"maxPrice":       1,
 			"availableCount": 1,
@@ -202,17 +213,33 @@ func GetCropTypes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	cursor, err := db.CropsCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "error": err.Error()})
+		apierr.Write(w, apierr.Internal(err))
 		return
 	}
-	var cropTypes []bson.M
-	if err := cursor.All(ctx, &cropTypes); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "error": err.Error()})
+	var rows []struct {
+		Name           string `bson:"name"`
+		Currency       string `bson:"currency"`
+		MinPrice       int64  `bson:"minPrice"`
+		MaxPrice       int64  `bson:"maxPrice"`
+		AvailableCount int    `bson:"availableCount"`
+		Banner         string `bson:"banner"`
+		Unit           string `bson:"unit"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		apierr.Write(w, apierr.Internal(err))
 		return
 	}
 
-	if len(cropTypes) == 0 {
-		cropTypes = []bson.M{}
+	cropTypes := make([]utils.M, 0, len(rows))
+	for _, row := range rows {
+		cropTypes = append(cropTypes, utils.M{
+			"name":           row.Name,
+			"minPrice":       money.Money{Minor: row.MinPrice, Currency: row.Currency},
+			"maxPrice":       money.Money{Minor: row.MaxPrice, Currency: row.Currency},
+			"availableCount": row.AvailableCount,
+			"banner":         row.Banner,
+			"unit":           row.Unit,
+		})
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true, "cropTypes": cropTypes})
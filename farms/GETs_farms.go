@@ -2,8 +2,10 @@ package farms
 
 import (
 	"context"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/money"
 	"naevis/utils"
 	"net/http"
 	"regexp"
@@ -16,6 +18,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// priceLess orders prices by currency, then amount.
+func priceLess(a, b money.Money) bool {
+	if a.Currency != b.Currency {
+		return a.Currency < b.Currency
+	}
+	return a.Minor < b.Minor
+}
+
 func GetCropFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -28,7 +38,7 @@ func GetCropFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	crops, err := utils.FindAndDecode[models.Crop](ctx, db.CropsCollection, bson.M{"cropid": cropID})
 	if err != nil || len(crops) == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "Crop not found")
+		apierr.Respond(w, http.StatusNotFound, "Crop not found")
 		return
 	}
 
@@ -41,7 +51,7 @@ func GetCropFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	}
 	farms, err := utils.FindAndDecode[models.Farm](ctx, db.FarmsCollection, bson.M{"farmid": bson.M{"$in": farmIDs}})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch farms")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch farms")
 		return
 	}
 
@@ -78,9 +88,9 @@ func GetCropFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	case "price":
 		sort.Slice(listings, func(i, j int) bool {
 			if sortOrder == "desc" {
-				return listings[i].PricePerKg > listings[j].PricePerKg
+				return priceLess(listings[j].PricePerKg, listings[i].PricePerKg)
 			}
-			return listings[i].PricePerKg < listings[j].PricePerKg
+			return priceLess(listings[i].PricePerKg, listings[j].PricePerKg)
 		})
 	case "breed":
 		sort.Slice(listings, func(i, j int) bool {
@@ -117,7 +127,7 @@ func GetCropTypeFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 
 	cropName := ps.ByName("cropname")
 	if cropName == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing crop name parameter")
+		apierr.Respond(w, http.StatusBadRequest, "Missing crop name parameter")
 		return
 	}
 
@@ -129,7 +139,7 @@ func GetCropTypeFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(cropName) + "$", "$options": "i"}}
 	crops, err := utils.FindAndDecode[models.Crop](ctx, db.CropsCollection, filter)
 	if err != nil || len(crops) == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "Crop type not found")
+		apierr.Respond(w, http.StatusNotFound, "Crop type not found")
 		return
 	}
 
@@ -141,7 +151,7 @@ func GetCropTypeFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 
 	farms, err := utils.FindAndDecode[models.Farm](ctx, db.FarmsCollection, bson.M{"farmid": bson.M{"$in": farmIDs}})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch farms")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch farms")
 		return
 	}
 
@@ -179,9 +189,9 @@ func GetCropTypeFarms(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	case "price":
 		sort.Slice(listings, func(i, j int) bool {
 			if sortOrder == "desc" {
-				return listings[i].PricePerKg > listings[j].PricePerKg
+				return priceLess(listings[j].PricePerKg, listings[i].PricePerKg)
 			}
-			return listings[i].PricePerKg < listings[j].PricePerKg
+			return priceLess(listings[i].PricePerKg, listings[j].PricePerKg)
 		})
 	case "breed":
 		sort.Slice(listings, func(i, j int) bool {
@@ -248,14 +258,14 @@ func GetPaginatedFarms(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 
 	cursor, err := db.FarmsCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching farms")
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching farms")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var farms []models.Farm
 	if err := cursor.All(ctx, &farms); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error decoding farms")
+		apierr.Respond(w, http.StatusInternalServerError, "Error decoding farms")
 		return
 	}
 
@@ -3,6 +3,7 @@ package farms
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -41,13 +42,13 @@ func GetItems(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	opts := options.Find().SetSort(sort).SetSkip(skip).SetLimit(limit)
 	items, err := utils.FindAndDecode[models.Product](ctx, db.ProductCollection, filter, opts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch items")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch items")
 		return
 	}
 
 	total, err := db.ProductCollection.CountDocuments(ctx, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to count items")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to count items")
 		return
 	}
 
@@ -89,6 +90,6 @@ func GetItemCategories(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(categories); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
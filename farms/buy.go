@@ -6,6 +6,7 @@ import (
 	"time"
 
 	// "naevis/db"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -19,20 +20,20 @@ import (
 func BuyCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	farmID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid farm ID"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid farm ID")
 		return
 	}
 
 	cropID, err := primitive.ObjectIDFromHex(ps.ByName("cropid"))
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid crop ID"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid crop ID")
 		return
 	}
 
 	// Retrieve user ID
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 	_ = requestingUserID
@@ -52,7 +53,7 @@ func BuyCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	result, err := db.FarmsCollection.UpdateOne(context.Background(), filter, update)
 	if err != nil || result.ModifiedCount == 0 {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Crop not available or already out of stock"})
+		apierr.Respond(w, http.StatusBadRequest, "Crop not available or already out of stock")
 		return
 	}
 
@@ -83,20 +84,20 @@ func BuyCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func GetMyFarmOrders(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		utils.RespondWithJSON(w, http.StatusUnauthorized, utils.M{"success": false, "message": "Invalid user"})
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
 	cursor, err := db.FarmOrdersCollection.Find(context.Background(), bson.M{"userId": userID})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to fetch orders"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch orders")
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var orders []models.FarmOrder
 	if err := cursor.All(context.Background(), &orders); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to decode orders"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode orders")
 		return
 	}
 
@@ -111,21 +112,21 @@ func GetMyFarmOrders(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 func GetIncomingFarmOrders(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		utils.RespondWithJSON(w, http.StatusUnauthorized, utils.M{"success": false, "message": "Invalid user"})
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
 	// Fetch farms owned by the user
 	cursor, err := db.FarmsCollection.Find(context.Background(), bson.M{"owner": userID})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to fetch farms"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch farms")
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var farms []bson.M
 	if err := cursor.All(context.Background(), &farms); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to decode farms"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode farms")
 		return
 	}
 
@@ -143,14 +144,14 @@ func GetIncomingFarmOrders(w http.ResponseWriter, r *http.Request, ps httprouter
 
 	cursor, err = db.FarmOrdersCollection.Find(context.Background(), bson.M{"farmId": bson.M{"$in": farmIDs}})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to fetch orders"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch orders")
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var orders []models.FarmOrder
 	if err := cursor.All(context.Background(), &orders); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to decode orders"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode orders")
 		return
 	}
 
@@ -164,7 +165,7 @@ func GetIncomingFarmOrders(w http.ResponseWriter, r *http.Request, ps httprouter
 func updateOrderStatus(w http.ResponseWriter, orderID string, newStatus string) {
 	objID, err := primitive.ObjectIDFromHex(orderID)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid order ID"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid order ID")
 		return
 	}
 
@@ -174,7 +175,7 @@ func updateOrderStatus(w http.ResponseWriter, orderID string, newStatus string)
 	)
 
 	if err != nil || res.ModifiedCount == 0 {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Order not found or already updated"})
+		apierr.Respond(w, http.StatusBadRequest, "Order not found or already updated")
 		return
 	}
 
@@ -202,14 +203,14 @@ func DownloadReceipt(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	orderID := ps.ByName("id")
 	objID, err := primitive.ObjectIDFromHex(orderID)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid order ID"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid order ID")
 		return
 	}
 
 	var order models.FarmOrder
 	err = db.FarmOrdersCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&order)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusNotFound, utils.M{"success": false, "message": "Order not found"})
+		apierr.Respond(w, http.StatusNotFound, "Order not found")
 		return
 	}
 
@@ -1,19 +1,23 @@
 package farms
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
 	"naevis/models"
+	"naevis/money"
 	"naevis/mq"
 	"naevis/utils"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func getUserIDFromContext(r *http.Request) (string, bool) {
@@ -26,27 +30,34 @@ func AddCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	farmID := ps.ByName("id")
 	userid := utils.GetUserIDFromRequest(r)
 	if farmID == "" {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid farm ID"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid farm ID")
 		return
 	}
 
 	if _, ok := getUserIDFromContext(r); !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid form"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form")
 		return
 	}
 
 	name := r.FormValue("name")
 	if name == "" {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Name is required"})
+		apierr.Respond(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	price, err := formPrice(r)
+	if err != nil || !price.IsPositive() {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid price")
 		return
 	}
 
 	crop := parseCropForm(r)
+	crop.Price = price
 	crop.FarmID = farmID
 	crop.CreatedBy = userid
 
@@ -55,15 +66,18 @@ func AddCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		crop.Banner = filename
 	}
 
-	_, err = db.CropsCollection.InsertOne(ctx, crop)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.CropsCollection.InsertOne(ctx, crop); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "crop-created", models.Index{
+			EntityType: "crop", EntityId: crop.CropId, Method: "POST",
+		})
+	})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Insert failed"})
+		apierr.Respond(w, http.StatusInternalServerError, "Insert failed")
 		return
 	}
-
-	go mq.Emit(ctx, "crop-created", models.Index{
-		EntityType: "crop", EntityId: crop.CropId, Method: "POST",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true, "cropId": crop.CropId})
 }
 
@@ -72,12 +86,12 @@ func EditCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	cropID := ps.ByName("cropid")
 
 	if _, ok := getUserIDFromContext(r); !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid form"})
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form")
 		return
 	}
 
@@ -89,8 +103,13 @@ func EditCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	if v := r.FormValue("unit"); v != "" {
 		update["unit"] = v
 	}
-	if v := r.FormValue("price"); v != "" {
-		update["price"] = utils.ParseFloat(v)
+	if r.FormValue("price") != "" {
+		price, err := formPrice(r)
+		if err != nil || !price.IsPositive() {
+			apierr.Respond(w, http.StatusBadRequest, "Invalid price")
+			return
+		}
+		update["price"] = price
 	}
 	if v := r.FormValue("quantity"); v != "" {
 		update["quantity"] = utils.ParseInt(v)
@@ -120,19 +139,22 @@ func EditCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if len(update) <= 1 { // only updatedAt present
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "No valid fields to update"})
+		apierr.Respond(w, http.StatusBadRequest, "No valid fields to update")
 		return
 	}
 
-	_, err := db.CropsCollection.UpdateOne(ctx, bson.M{"cropid": cropID}, bson.M{"$set": update})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.CropsCollection.UpdateOne(ctx, bson.M{"cropid": cropID}, bson.M{"$set": update}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "crop-updated", models.Index{
+			EntityType: "crop", EntityId: cropID, Method: "PUT",
+		})
+	})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update crop")
 		return
 	}
-
-	go mq.Emit(ctx, "crop-updated", models.Index{
-		EntityType: "crop", EntityId: cropID, Method: "PUT",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true})
 }
 
@@ -141,7 +163,6 @@ func parseCropForm(r *http.Request) models.Crop {
 	formatted := strings.ToLower(strings.ReplaceAll(cropName, " ", "_"))
 	crop := models.Crop{
 		Name:        r.FormValue("name"),
-		Price:       utils.ParseFloat(r.FormValue("price")),
 		Quantity:    utils.ParseInt(r.FormValue("quantity")),
 		Unit:        r.FormValue("unit"),
 		Notes:       r.FormValue("notes"),
@@ -163,23 +184,40 @@ func parseCropForm(r *http.Request) models.Crop {
 	return crop
 }
 
+// formPrice reads the price form field in the currency form field, which
+// defaults to rupees.
+func formPrice(r *http.Request) (money.Money, error) {
+	currency := r.FormValue("currency")
+	if currency == "" {
+		currency = money.Default
+	}
+	return money.Parse(r.FormValue("price"), currency)
+}
+
 func DeleteCrop(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	cropID := ps.ByName("cropid")
 
 	if _, ok := getUserIDFromContext(r); !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
-	res, err := db.CropsCollection.DeleteOne(ctx, bson.M{"cropid": cropID})
-	if err != nil || res.DeletedCount == 0 {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to delete crop"})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		res, err := db.CropsCollection.DeleteOne(ctx, bson.M{"cropid": cropID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "crop-deleted", models.Index{
+			EntityType: "crop", EntityId: cropID, Method: "DELETE",
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete crop")
 		return
 	}
-
-	go mq.Emit(ctx, "crop-deleted", models.Index{
-		EntityType: "crop", EntityId: cropID, Method: "DELETE",
-	})
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true})
 }
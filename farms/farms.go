@@ -1,12 +1,14 @@
 package farms
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -24,20 +26,20 @@ func GetFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	var farm models.Farm
 	if err := db.FarmsCollection.FindOne(ctx, bson.M{"farmid": id}).Decode(&farm); err != nil {
-		utils.RespondWithJSON(w, http.StatusNotFound, utils.M{"success": false, "message": "Farm not found"})
+		apierr.Respond(w, http.StatusNotFound, "Farm not found")
 		return
 	}
 
 	cursor, err := db.CropsCollection.Find(ctx, bson.M{"farmId": id})
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to load crops"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to load crops")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var crops []models.Crop
 	if err := cursor.All(ctx, &crops); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to decode crops"})
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode crops")
 		return
 	}
 
@@ -52,13 +54,13 @@ func GetFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func CreateFarm(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Failed to parse form"})
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
 	requestingUserID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
@@ -79,7 +81,7 @@ func CreateFarm(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	if farm.Name == "" || farm.Location == "" || farm.Owner == "" || farm.Contact == "" {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Missing required fields"})
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
@@ -88,13 +90,17 @@ func CreateFarm(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		farm.Banner = fileName
 	}
 
-	if _, err := db.FarmsCollection.InsertOne(ctx, farm); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Failed to insert farm"})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.FarmsCollection.InsertOne(ctx, farm); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farm-created", models.Index{EntityType: "farm", EntityId: farm.FarmID, Method: "POST"})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to insert farm")
 		return
 	}
 
-	go mq.Emit(ctx, "farm-created", models.Index{EntityType: "farm", EntityId: farm.FarmID, Method: "POST"})
-
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true, "id": farm.FarmID})
 }
 
@@ -104,7 +110,7 @@ func EditFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	requestingUserID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 	_ = requestingUserID
@@ -116,7 +122,7 @@ func EditFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Malformed multipart data"})
+			apierr.Respond(w, http.StatusBadRequest, "Malformed multipart data")
 			return
 		}
 
@@ -133,7 +139,7 @@ func EditFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		}
 	} else {
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-			utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "Invalid JSON body"})
+			apierr.Respond(w, http.StatusBadRequest, "Invalid JSON body")
 			return
 		}
 	}
@@ -158,19 +164,23 @@ func EditFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if len(updateFields) == 0 {
-		utils.RespondWithJSON(w, http.StatusBadRequest, utils.M{"success": false, "message": "No fields to update"})
+		apierr.Respond(w, http.StatusBadRequest, "No fields to update")
 		return
 	}
 
 	updateFields["updatedAt"] = time.Now()
 
-	if _, err := db.FarmsCollection.UpdateOne(ctx, bson.M{"farmid": farmID}, bson.M{"$set": updateFields}); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false, "message": "Database error"})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.FarmsCollection.UpdateOne(ctx, bson.M{"farmid": farmID}, bson.M{"$set": updateFields}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farm-updated", models.Index{EntityType: "farm", EntityId: farmID, Method: "PUT"})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
-	go mq.Emit(ctx, "farm-updated", models.Index{EntityType: "farm", EntityId: farmID, Method: "PUT"})
-
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true, "message": "Farm updated"})
 }
 
@@ -180,19 +190,25 @@ func DeleteFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	requestingUserID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 	_ = requestingUserID
 
 	var farm models.Farm
 	if err := db.FarmsCollection.FindOne(ctx, bson.M{"farmid": farmID}).Decode(&farm); err != nil {
-		utils.RespondWithJSON(w, http.StatusNotFound, utils.M{"success": false, "message": "Not found"})
+		apierr.Respond(w, http.StatusNotFound, "Not found")
 		return
 	}
 
-	if _, err := db.FarmsCollection.DeleteOne(ctx, bson.M{"farmid": farmID}); err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, utils.M{"success": false})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.FarmsCollection.DeleteOne(ctx, bson.M{"farmid": farmID}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farm-deleted", models.Index{EntityType: "farm", EntityId: farmID, Method: "DELETE"})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete farm")
 		return
 	}
 
@@ -202,6 +218,5 @@ func DeleteFarm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		}
 	}
 
-	go mq.Emit(ctx, "farm-deleted", models.Index{EntityType: "farm", EntityId: farmID, Method: "DELETE"})
 	utils.RespondWithJSON(w, http.StatusOK, utils.M{"success": true})
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/mq"
@@ -27,7 +28,7 @@ func createItem(w http.ResponseWriter, r *http.Request, itemType string) {
 	// item, err := parseProductForm(r, itemType)
 	item, err := parseProductJSON(r, itemType)
 	if err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
 	}
 
@@ -35,31 +36,34 @@ func createItem(w http.ResponseWriter, r *http.Request, itemType string) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err = db.ProductCollection.InsertOne(ctx, item)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ProductCollection.InsertOne(ctx, item); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farmitem-created", models.Index{EntityType: "product", EntityId: item.ProductID, Method: "POST"})
+	})
 	if err != nil {
-		http.Error(w, "Failed to insert item", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to insert item")
 		return
 	}
 
-	go mq.Emit(ctx, "farmitem-created", models.Index{EntityType: "product", EntityId: item.ProductID, Method: "POST"})
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(item); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
 func updateItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params, itemType string) {
 	idParam := ps.ByName("id")
 	if idParam == "" {
-		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing id parameter")
 		return
 	}
 
 	// item, err := parseProductForm(r, itemType)
 	item, err := parseProductJSON(r, itemType)
 	if err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
 	}
 
@@ -67,17 +71,20 @@ func updateItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params, it
 	defer cancel()
 
 	update := bson.M{"$set": item}
-	_, err = db.ProductCollection.UpdateOne(ctx, bson.M{"productid": idParam}, update)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ProductCollection.UpdateOne(ctx, bson.M{"productid": idParam}, update); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farmitem-updated", models.Index{EntityType: "product", EntityId: idParam, Method: "PUT"})
+	})
 	if err != nil {
-		http.Error(w, "Failed to update item", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update item")
 		return
 	}
 
-	go mq.Emit(ctx, "farmitem-updated", models.Index{EntityType: "product", EntityId: idParam, Method: "PUT"})
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "updated"}); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
@@ -100,24 +107,27 @@ func DeleteTool(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func deleteItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	idParam := ps.ByName("id")
 	if idParam == "" {
-		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing id parameter")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.ProductCollection.DeleteOne(ctx, bson.M{"productid": idParam})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ProductCollection.DeleteOne(ctx, bson.M{"productid": idParam}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "farmitem-deleted", models.Index{EntityType: "product", EntityId: idParam, Method: "DELETE"})
+	})
 	if err != nil {
-		http.Error(w, "Failed to delete item", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete item")
 		return
 	}
 
-	go mq.Emit(ctx, "farmitem-deleted", models.Index{EntityType: "product", EntityId: idParam, Method: "DELETE"})
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "deleted"}); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
@@ -70,24 +70,26 @@ func editExistingPost(ctx context.Context, claims *middleware.Claims, payload Po
 	}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
-	res := db.PostsCollection.FindOneAndUpdate(ctx,
-		bson.M{"postid": payload.PostID, "userid": claims.UserID},
-		bson.M{"$set": update},
-		opts,
-	)
-	if res.Err() != nil {
-		return post, res.Err()
-	}
-	if err := res.Decode(&post); err != nil {
-		log.Printf("decode updated post: %v", err)
-	}
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		res := db.PostsCollection.FindOneAndUpdate(ctx,
+			bson.M{"postid": payload.PostID, "userid": claims.UserID},
+			bson.M{"$set": update},
+			opts,
+		)
+		if res.Err() != nil {
+			return res.Err()
+		}
+		if err := res.Decode(&post); err != nil {
+			log.Printf("decode updated post: %v", err)
+		}
 
-	go mq.Emit(ctx, "post-edited", models.Index{
-		EntityType: "feedpost",
-		EntityId:   payload.PostID,
-		Method:     "PUT",
+		return mq.Emit(ctx, "post-edited", models.Index{
+			EntityType: "feedpost",
+			EntityId:   payload.PostID,
+			Method:     "PUT",
+		})
 	})
-	return post, nil
+	return post, err
 }
 
 func CreateOrEditPost(ctx context.Context, claims *middleware.Claims, payload PostPayload, action PostAction) (models.FeedPost, error) {
@@ -158,19 +160,23 @@ func insertNewPost(ctx context.Context, claims *middleware.Claims, payload PostP
 		return post, errors.New("unsupported post type")
 	}
 
-	if _, err := db.PostsCollection.InsertOne(ctx, post); err != nil {
-		return post, err
-	}
-
-	userdata.SetUserData("feedpost", post.PostID, claims.UserID, "", "")
-	go mq.EmitHashtagEvent("feedpost", post.PostID, post.Tags)
-	go mq.Emit(ctx, "post-created", models.Index{
-		EntityType: "feedpost",
-		EntityId:   post.PostID,
-		Method:     "POST",
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PostsCollection.InsertOne(ctx, post); err != nil {
+			return err
+		}
+		if err := userdata.SetUserDataTx(ctx, "feedpost", post.PostID, claims.UserID, "", ""); err != nil {
+			return err
+		}
+		if err := mq.EmitHashtagEvent(ctx, "feedpost", post.PostID, post.Tags); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "post-created", models.Index{
+			EntityType: "feedpost",
+			EntityId:   post.PostID,
+			Method:     "POST",
+		})
 	})
-
-	return post, nil
+	return post, err
 }
 
 func preparePostPayload(payload PostPayload) (PostPayload, error) {
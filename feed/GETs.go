@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/pagination"
 	"naevis/rdx"
 	"net/http"
 	"time"
@@ -13,23 +15,34 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// feedSort orders posts newest first. timestamp is RFC 3339, so it sorts
+// chronologically as a string; postid breaks ties.
+var feedSort = pagination.Sort{Field: "timestamp", IDField: "postid", Desc: true}
+
+func feedCursor(p models.FeedPost) pagination.Cursor {
+	return pagination.Cursor{Key: p.Timestamp, ID: p.PostID}
+}
+
+// GetPosts returns one page of the feed, newest first. Pass next_cursor
+// back as ?cursor= to get the following page.
 func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var posts []models.FeedPost
 
-	filter := bson.M{}
-	sortOrder := bson.D{{Key: "timestamp", Value: -1}}
+	page, err := pagination.Parse(r, 20, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	filter := feedSort.Filter(bson.M{}, page.After)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := db.PostsCollection.Find(ctx, filter, &options.FindOptions{
-		Sort: sortOrder,
-	})
+	cursor, err := db.PostsCollection.Find(ctx, filter, feedSort.FindOptions(page.Limit))
 	if err != nil {
-		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch posts")
 		return
 	}
 	defer cursor.Close(ctx)
@@ -38,7 +51,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	for cursor.Next(ctx) {
 		var post models.FeedPost
 		if err := cursor.Decode(&post); err != nil {
-			http.Error(w, "Failed to decode post", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to decode post")
 			return
 		}
 		posts = append(posts, post)
@@ -46,10 +59,11 @@ func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	if err := cursor.Err(); err != nil {
-		http.Error(w, "Cursor error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Cursor error")
 		return
 	}
 
+	posts, next := pagination.Trim(posts, page.Limit, feedCursor)
 	if len(posts) == 0 {
 		posts = []models.FeedPost{}
 	}
@@ -69,7 +83,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		}
 		_, err := pipe.Exec(ctx)
 		if err != nil && !errors.Is(err, redis.Nil) {
-			http.Error(w, "Failed to fetch usernames", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch usernames")
 			return
 		}
 		for i, cmd := range cmds {
@@ -94,7 +108,8 @@ func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]any{
-		"ok":   true,
-		"data": posts,
+		"ok":          true,
+		"data":        posts,
+		"next_cursor": next,
 	})
 }
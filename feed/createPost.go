@@ -2,6 +2,7 @@ package feed
 
 import (
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/middleware"
 	"net/http"
 
@@ -14,19 +15,19 @@ func CreateFeedPost(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	token := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(token)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	var payload PostPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	post, err := CreateOrEditPost(ctx, claims, payload, ActionCreate)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -43,20 +44,20 @@ func EditPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	token := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(token)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	var payload PostPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 	payload.PostID = ps.ByName("postid")
 
 	post, err := CreateOrEditPost(ctx, claims, payload, ActionEdit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filedrop"
 	"naevis/globals"
@@ -31,9 +32,9 @@ func GetPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := db.PostsCollection.FindOne(ctx, bson.M{"postid": id}).Decode(&post)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Post not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Post not found")
 		} else {
-			http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch post")
 		}
 		return
 	}
@@ -74,7 +75,7 @@ func GetPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Step 4: Return enriched post
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(post); err != nil {
-		http.Error(w, "Failed to encode post data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode post data")
 	}
 }
 
@@ -84,14 +85,14 @@ func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	postID := ps.ByName("postid")
 
 	if postID == "" {
-		http.Error(w, "Post ID is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Post ID is required")
 		return
 	}
 
 	// Retrieve the ID of the requesting user from the context
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 
@@ -102,29 +103,38 @@ func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// 	return
 	// }
 
-	// Delete the post from MongoDB
-	// db.FeedPostsCollection := client.Database("eventdb").Collection("posts")
-	result, err := db.PostsCollection.DeleteOne(context.TODO(), bson.M{"postid": postID})
+	// Look up the attached file before the post goes away
+	var existingFile models.FileMetadata
+	db.FilesCollection.FindOne(ctx, bson.M{"postid": postID}).Decode(&existingFile)
+
+	// Delete the post, its user data and the index event together
+	var deleted int64
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		result, err := db.PostsCollection.DeleteOne(ctx, bson.M{"postid": postID})
+		if err != nil {
+			return err
+		}
+		deleted = result.DeletedCount
+		if deleted == 0 {
+			return nil
+		}
+		if err := userdata.DelUserDataTx(ctx, "feedpost", postID, requestingUserID); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "feedpost", EntityId: postID, Method: "DELETE"}
+		return mq.Emit(ctx, "post-deleted", m)
+	})
 	if err != nil {
-		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete post")
 		return
 	}
 
-	// Check if the file exists
-	var existingFile models.FileMetadata
-	db.FilesCollection.FindOne(context.TODO(), bson.M{"postid": postID}).Decode(&existingFile)
-
-	filedrop.RemoveUserFile(requestingUserID, postID, existingFile.Hash)
-
-	if result.DeletedCount == 0 {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	if deleted == 0 {
+		apierr.Respond(w, http.StatusNotFound, "Post not found")
 		return
 	}
 
-	userdata.DelUserData("feedpost", postID, requestingUserID)
-
-	m := models.Index{EntityType: "feedpost", EntityId: postID, Method: "DELETE"}
-	go mq.Emit(ctx, "post-deleted", m)
+	filedrop.RemoveUserFile(requestingUserID, postID, existingFile.Hash)
 
 	// Respond with a success message
 	w.Header().Set("Content-Type", "application/json")
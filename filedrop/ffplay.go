@@ -14,6 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"naevis/metrics"
 )
 
 const (
@@ -28,6 +30,11 @@ type Runner interface {
 	Run(timeout time.Duration, name string, args ...string) (stdout string, stderr string, err error)
 }
 
+// commandDuration covers ffprobe runs and multi-minute transcodes.
+var commandDuration = metrics.NewHistogramVec("naevis_media_command_duration_seconds",
+	"Duration of ffmpeg/ffprobe invocations by binary and result.",
+	[]float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}, "binary", "result")
+
 type realRunner struct{}
 
 func (realRunner) Run(timeout time.Duration, name string, args ...string) (string, string, error) {
@@ -39,10 +46,17 @@ func (realRunner) Run(timeout time.Duration, name string, args ...string) (strin
 	cmd.Stdout = &out
 	cmd.Stderr = &errb
 
+	start := time.Now()
 	err := cmd.Run()
 	if ctx.Err() == context.DeadlineExceeded {
+		commandDuration.ObserveSince(start, filepath.Base(name), "timeout")
 		return out.String(), errb.String(), fmt.Errorf("%s timed out after %s", name, timeout)
 	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	commandDuration.ObserveSince(start, filepath.Base(name), result)
 	return out.String(), errb.String(), err
 }
 
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"mime/multipart"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -117,7 +118,7 @@ func CheckUserInFile(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
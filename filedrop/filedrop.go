@@ -1,6 +1,7 @@
 package filedrop
 
 import (
+	"naevis/apierr"
 	"naevis/filemgr"
 	"naevis/utils"
 	"net/http"
@@ -12,12 +13,12 @@ import (
 func FileDropHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	paths, names, resolutions, err := HandleMediaUpload(r, "video", filemgr.EntityLoops)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "could not upload video: "+err.Error())
+		apierr.Respond(w, http.StatusBadRequest, "could not upload video: "+err.Error())
 		return
 	}
 
 	if len(names) == 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "no video uploaded")
+		apierr.Respond(w, http.StatusBadRequest, "no video uploaded")
 		return
 	}
 
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -143,19 +144,19 @@ func parseTimestamp(ts string) (int, error) {
 func SaveUploadedVTT(w http.ResponseWriter, r *http.Request, uniqueID, lang string) (string, error) {
 	// Parse multipart form (limit to ~5MB for subtitle files)
 	if err := r.ParseMultipartForm(5 << 20); err != nil {
-		http.Error(w, "could not parse multipart form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "could not parse multipart form")
 		return "", err
 	}
 
 	file, header, err := r.FormFile("subtitle")
 	if err != nil {
-		http.Error(w, "subtitle file is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "subtitle file is required")
 		return "", err
 	}
 	defer file.Close()
 
 	if !strings.HasSuffix(strings.ToLower(header.Filename), ".vtt") {
-		http.Error(w, "only .vtt files are supported", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "only .vtt files are supported")
 		return "", fmt.Errorf("invalid file type: %s", header.Filename)
 	}
 
@@ -253,27 +254,27 @@ func UploadSubtitle(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	token := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(token)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	postID := ps.ByName("postid")
 	lang := ps.ByName("lang") // now comes from URL
 	if lang == "" {
-		http.Error(w, "language code is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "language code is required")
 		return
 	}
 
 	// Get the post from DB
 	var post models.FeedPost
 	if err := db.PostsCollection.FindOne(ctx, bson.M{"postid": postID}).Decode(&post); err != nil {
-		http.Error(w, "post not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "post not found")
 		return
 	}
 
 	// Only author can upload subtitles
 	if post.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "forbidden")
 		return
 	}
 
@@ -281,7 +282,7 @@ func UploadSubtitle(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	path, err := SaveUploadedVTT(w, r, postID, lang)
 	if err != nil {
 		log.Printf("subtitle upload failed: %v", err)
-		http.Error(w, fmt.Sprintf("failed to save subtitle: %v", err), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("failed to save subtitle: %v", err))
 		return
 	}
 
@@ -289,7 +290,7 @@ func UploadSubtitle(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	update := bson.M{"$set": bson.M{fmt.Sprintf("subtitles.%s", lang): path}}
 	_, err = db.PostsCollection.UpdateOne(ctx, bson.M{"postid": postID}, update)
 	if err != nil {
-		http.Error(w, "failed to update subtitles", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "failed to update subtitles")
 		return
 	}
 
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"mime/multipart"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/utils"
@@ -30,7 +31,7 @@ var (
 
 // --- Entity metadata ---
 type entityMeta struct {
-	collection  *mongo.Collection
+	collection  db.Collection
 	keyField    string
 	cachePrefix string
 	ownerField  string
@@ -89,12 +90,12 @@ func authorizeUserForEntity(ctx context.Context, entityType, entityID, userID st
 func updateEntityBannerInDB(ctx context.Context, w http.ResponseWriter, entityType, entityID string, updateFields bson.M) error {
 	meta, ok := getEntityMeta(entityType)
 	if !ok {
-		http.Error(w, "Unsupported entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unsupported entity type")
 		return ErrUnsupportedEntity
 	}
 
 	if _, err := meta.collection.UpdateOne(ctx, bson.M{meta.keyField: entityID}, bson.M{"$set": updateFields}); err != nil {
-		http.Error(w, fmt.Sprintf("Error updating %s", entityType), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Error updating %s", entityType))
 		return err
 	}
 
@@ -110,11 +111,11 @@ func updateEntityBannerInDB(ctx context.Context, w http.ResponseWriter, entityTy
 func handleAuthError(w http.ResponseWriter, err error, entityType string) {
 	switch {
 	case errors.Is(err, ErrNotFound):
-		http.Error(w, fmt.Sprintf("%s not found", entityType), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("%s not found", entityType))
 	case errors.Is(err, ErrUnauthorized):
-		http.Error(w, "You are not authorized to edit this "+entityType, http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "You are not authorized to edit this "+entityType)
 	default:
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal error")
 	}
 }
 
@@ -132,14 +133,14 @@ func EditBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// --- Entity Validation ---
 	meta, ok := getEntityMeta(entityTypeStr)
 	if !ok || meta.collection == nil {
-		http.Error(w, "Unsupported entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unsupported entity type")
 		return
 	}
 
 	// --- User Validation ---
 	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
 	if requestingUserID == "" {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -152,7 +153,7 @@ func EditBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// --- Extract Banner ---
 	field, fileName, err := extractBannerData(r, entityTypeStr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -164,7 +165,7 @@ func EditBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	if err := updateEntityBannerInDB(r.Context(), w, entityTypeStr, entityID, updateFields); err != nil {
 		log.Printf("DB update failed for %s:%s: %v", entityTypeStr, entityID, err)
-		http.Error(w, "Failed to update banner", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update banner")
 		return
 	}
 
@@ -0,0 +1,343 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/models"
+	"naevis/money"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Checkout kinds.
+const (
+	KindTicket = "ticket"
+	KindSeat   = "seat" // reserved seats, listed in the checkout's Seats
+	KindMerch  = "merch"
+	KindMenu   = "menu"
+)
+
+// Checkout states.
+const (
+	StatePending   = "pending"   // waiting for the customer to pay
+	StatePaid      = "paid"      // captured, not yet fulfilled
+	StateFulfilled = "fulfilled" // paid and handed out
+	StateFailed    = "failed"    // cancelled, declined, expired or mismatched
+	StateRefunded  = "refunded"  // paid but could not be handed out
+)
+
+const (
+	checkoutLockPrefix = "checkout_lock:"
+	checkoutLockTTL    = time.Minute
+	maxWebhookBody     = 64 << 10
+)
+
+var (
+	// ErrUnavailable is returned, wrapped, by a Fulfiller when what was
+	// paid for can no longer be handed out, e.g. because it sold out
+	// while the customer was paying. The payment is refunded.
+	ErrUnavailable = errors.New("gateway: item no longer available")
+
+	// ErrInvalidAmount is returned by Start for items without a price.
+	ErrInvalidAmount = errors.New("gateway: checkout amount must be positive")
+
+	// errBusy means another delivery of the same webhook is being
+	// handled; the provider retries later.
+	errBusy = errors.New("gateway: checkout is being processed")
+)
+
+// Item is what a checkout sells. Amount is the total for Quantity.
+type Item struct {
+	Kind        string
+	EntityType  string // event or place
+	EntityID    string
+	ItemID      string
+	Quantity    int
+	Amount      money.Money
+	Description string
+	Seats       []string // for KindSeat
+}
+
+// Fulfiller hands out a paid checkout. It makes its writes and calls
+// done with what the buyer should see, such as ticket codes, inside one
+// db.RunInTransaction, so the checkout is marked fulfilled in the same
+// commit that hands it out and a redelivered webhook finds it done. Work
+// outside the database, such as emails, goes after the commit. After an
+// error other than ErrUnavailable it is called again on the provider's
+// next delivery of the webhook.
+type Fulfiller func(ctx context.Context, c *models.Checkout, done func(ctx context.Context, result models.Meta) error) error
+
+var fulfillers = struct {
+	sync.RWMutex
+	byKind map[string]Fulfiller
+}{byKind: map[string]Fulfiller{}}
+
+// RegisterFulfiller sets the Fulfiller for checkouts of kind.
+func RegisterFulfiller(kind string, f Fulfiller) {
+	fulfillers.Lock()
+	defer fulfillers.Unlock()
+	fulfillers.byKind[kind] = f
+}
+
+func fulfillerFor(kind string) (Fulfiller, error) {
+	fulfillers.RLock()
+	defer fulfillers.RUnlock()
+	f, ok := fulfillers.byKind[kind]
+	if !ok {
+		return nil, fmt.Errorf("gateway: no fulfiller for %q", kind)
+	}
+	return f, nil
+}
+
+// Start records a checkout of item for userID and opens its session with
+// the provider. Send the customer to the session URL.
+func Start(ctx context.Context, userID string, item Item) (*models.Checkout, *Session, error) {
+	if provider == nil {
+		return nil, nil, ErrNotConfigured
+	}
+	if !item.Amount.IsPositive() || item.Quantity < 1 {
+		return nil, nil, fmt.Errorf("%w: %v for %d items", ErrInvalidAmount, item.Amount, item.Quantity)
+	}
+	id := utils.GetUUID()
+	session, err := provider.CreateCheckout(ctx, CheckoutRequest{
+		Reference:   id,
+		Description: item.Description,
+		Amount:      item.Amount,
+		SuccessURL:  returnURL + id + "?status=success",
+		CancelURL:   returnURL + id + "?status=cancelled",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	c := &models.Checkout{
+		ID:         id,
+		UserID:     userID,
+		Kind:       item.Kind,
+		EntityType: item.EntityType,
+		EntityID:   item.EntityID,
+		ItemID:     item.ItemID,
+		Quantity:   item.Quantity,
+		Seats:      item.Seats,
+		Amount:     item.Amount,
+		Provider:   provider.Name(),
+		SessionID:  session.ID,
+		State:      StatePending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if _, err := db.CheckoutsCollection.InsertOne(ctx, c); err != nil {
+		return nil, nil, err
+	}
+	return c, session, nil
+}
+
+// RespondStartError answers a failed Start.
+func RespondStartError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotConfigured):
+		apierr.Respond(w, http.StatusServiceUnavailable, "Card payments are not available")
+		return
+	case errors.Is(err, ErrInvalidAmount):
+		apierr.Respond(w, http.StatusUnprocessableEntity, "This item has no price to pay")
+		return
+	}
+	slog.ErrorContext(r.Context(), "start checkout failed", "error", err)
+	apierr.Respond(w, http.StatusInternalServerError, "Failed to create payment session")
+}
+
+// Webhook receives the payment provider's event callbacks at
+// POST /api/v1/payments/webhook/:provider. Only events whose signature
+// verifies are acted on; repeated deliveries are harmless.
+func Webhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if provider == nil || provider.Name() != ps.ByName("provider") {
+		apierr.Respond(w, http.StatusNotFound, "Unknown payment provider")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid webhook body")
+		return
+	}
+	evt, err := provider.VerifyWebhook(r.Header, body)
+	if err != nil {
+		slog.WarnContext(r.Context(), "rejected webhook", "provider", provider.Name(), "error", err)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid webhook signature")
+		return
+	}
+
+	switch err := handleEvent(r.Context(), evt); {
+	case errors.Is(err, errBusy):
+		apierr.Respond(w, http.StatusConflict, "Event is being processed")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "webhook event failed", "event_id", evt.ID, "session_id", evt.SessionID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to process event")
+	default:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]any{"received": true})
+	}
+}
+
+// handleEvent applies a verified event to its checkout. It moves the
+// checkout forward one state at a time, so a delivery that fails part way
+// resumes where the previous one stopped.
+func handleEvent(ctx context.Context, evt *Event) error {
+	lock := checkoutLockPrefix + provider.Name() + ":" + evt.SessionID
+	ok, err := rdx.Conn.SetNX(ctx, lock, "1", checkoutLockTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errBusy
+	}
+	defer rdx.Conn.Del(context.WithoutCancel(ctx), lock)
+
+	var c models.Checkout
+	err = db.CheckoutsCollection.FindOne(ctx, bson.M{"provider": provider.Name(), "session_id": evt.SessionID}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		slog.WarnContext(ctx, "webhook event for unknown session ignored", "event_id", evt.ID, "session_id", evt.SessionID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch evt.Type {
+	case EventCheckoutFailed:
+		if c.State == StatePending {
+			return setState(ctx, &c, StateFailed, nil)
+		}
+		return nil
+	case EventCheckoutCompleted:
+	default:
+		return nil
+	}
+
+	if c.State == StatePending {
+		if evt.Amount != c.Amount {
+			slog.WarnContext(ctx, "checkout paid the wrong amount; not captured",
+				"checkout_id", c.ID, "paid", evt.Amount.String(), "expected", c.Amount.String())
+			return setState(ctx, &c, StateFailed, nil)
+		}
+		if err := provider.Capture(ctx, evt.PaymentID, c.Amount); err != nil {
+			return fmt.Errorf("capture: %w", err)
+		}
+		if err := setState(ctx, &c, StatePaid, bson.M{"payment_id": evt.PaymentID}); err != nil {
+			return err
+		}
+		c.PaymentID = evt.PaymentID
+	}
+	if c.State != StatePaid {
+		return nil
+	}
+
+	fulfil, err := fulfillerFor(c.Kind)
+	if err != nil {
+		return err
+	}
+	recorded := false
+	err = fulfil(ctx, &c, func(ctx context.Context, result models.Meta) error {
+		// Work on a copy: the transaction may run this more than once.
+		paid := c
+		if err := setState(ctx, &paid, StateFulfilled, bson.M{"result": result}); err != nil {
+			return err
+		}
+		recorded = true
+		return nil
+	})
+	if errors.Is(err, ErrUnavailable) {
+		refundID, rerr := provider.Refund(ctx, c.PaymentID, c.Amount)
+		if rerr != nil {
+			return fmt.Errorf("refund unfulfillable checkout: %w", rerr)
+		}
+		slog.WarnContext(ctx, "unfulfillable checkout refunded", "checkout_id", c.ID, "refund_id", refundID, "error", err)
+		return setState(ctx, &c, StateRefunded, bson.M{"result": models.Meta{"refund_id": refundID}})
+	}
+	if err != nil {
+		return fmt.Errorf("fulfil: %w", err)
+	}
+	if !recorded {
+		return fmt.Errorf("fulfil: %s fulfiller did not record checkout %s", c.Kind, c.ID)
+	}
+	return nil
+}
+
+// setState moves c from its current state to state, setting the extra
+// fields in set.
+func setState(ctx context.Context, c *models.Checkout, state string, set bson.M) error {
+	fields := bson.M{"state": state, "updated_at": time.Now()}
+	for k, v := range set {
+		fields[k] = v
+	}
+	res, err := db.CheckoutsCollection.UpdateOne(ctx,
+		bson.M{"_id": c.ID, "state": c.State},
+		bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("checkout %s is no longer %s", c.ID, c.State)
+	}
+	c.State = state
+	return nil
+}
+
+// findCheckout returns the checkout id of userID.
+func findCheckout(ctx context.Context, userID, id string) (*models.Checkout, error) {
+	var c models.Checkout
+	if err := db.CheckoutsCollection.FindOne(ctx, bson.M{"_id": id, "userid": userID}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCheckout returns one of the caller's checkouts.
+func GetCheckout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, err := findCheckout(r.Context(), utils.GetUserIDFromRequest(r), ps.ByName("id"))
+	if err != nil {
+		apierr.Respond(w, http.StatusNotFound, "Checkout not found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, c)
+}
+
+// Confirm answers a client asking whether the checkout id of kind has
+// gone through. It only reports what the webhook recorded: 200 once the
+// purchase is fulfilled, 202 while the payment is still outstanding and
+// 409 if it failed or was refunded.
+func Confirm(w http.ResponseWriter, r *http.Request, kind, id string) {
+	c, err := findCheckout(r.Context(), utils.GetUserIDFromRequest(r), id)
+	if err != nil || c.Kind != kind {
+		apierr.Respond(w, http.StatusNotFound, "Checkout not found")
+		return
+	}
+	switch c.State {
+	case StateFulfilled:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]any{
+			"success":  true,
+			"message":  "Payment confirmed. Purchase complete.",
+			"checkout": c,
+		})
+	case StatePending, StatePaid:
+		utils.RespondWithJSON(w, http.StatusAccepted, map[string]any{
+			"success":  false,
+			"message":  "Payment not confirmed yet",
+			"checkout": c,
+		})
+	default:
+		apierr.Respond(w, http.StatusConflict, "Payment was not completed")
+	}
+}
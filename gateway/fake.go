@@ -0,0 +1,325 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"naevis/apierr"
+	"naevis/money"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// FakeName is the name of the fake provider.
+const FakeName = "fake"
+
+// FakeSignatureHeader carries the signature of the fake provider's
+// webhooks as "t=<unix time>,v1=<hex HMAC-SHA256 of t.body>".
+const FakeSignatureHeader = "Fake-Signature"
+
+const (
+	fakeSessionTTL       = 30 * time.Minute
+	fakeWebhookTolerance = 5 * time.Minute
+)
+
+// Fake is a payment provider that runs inside the server, for development
+// and tests. Its hosted checkout page lets whoever opens it pay or cancel
+// without a card, and the outcome is posted to the webhook URL signed
+// with the shared secret, the way a real provider calls back. Sessions
+// and payments live in memory and are lost on restart.
+type Fake struct {
+	secret     []byte
+	pageURL    string // hosted checkout pages, followed by the session ID
+	webhookURL string
+	client     *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+	payments map[string]*fakePayment
+}
+
+type fakeSession struct {
+	req       CheckoutRequest
+	expiresAt time.Time
+	state     string // open, paid, cancelled
+	paymentID string
+}
+
+type fakePayment struct {
+	authorized money.Money
+	captured   money.Money
+	refunded   money.Money
+}
+
+// NewFake returns a fake provider that signs webhooks with secret and
+// posts them to webhookURL.
+func NewFake(secret, pageURL, webhookURL string) *Fake {
+	return &Fake{
+		secret:     []byte(secret),
+		pageURL:    pageURL,
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		sessions:   map[string]*fakeSession{},
+		payments:   map[string]*fakePayment{},
+	}
+}
+
+func (f *Fake) Name() string { return FakeName }
+
+func (f *Fake) CreateCheckout(_ context.Context, req CheckoutRequest) (*Session, error) {
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("fake: invalid amount %v", req.Amount)
+	}
+	id := randomID("cs_")
+	s := &fakeSession{req: req, expiresAt: time.Now().Add(fakeSessionTTL), state: "open"}
+	f.mu.Lock()
+	f.sessions[id] = s
+	f.mu.Unlock()
+	return &Session{ID: id, URL: f.pageURL + id, ExpiresAt: s.expiresAt}, nil
+}
+
+func (f *Fake) Capture(_ context.Context, paymentID string, amount money.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return fmt.Errorf("fake: no payment %s", paymentID)
+	}
+	if p.captured == amount {
+		return nil // already captured
+	}
+	if cmp, err := amount.Cmp(p.authorized); err != nil || cmp > 0 || !p.captured.IsZero() {
+		return fmt.Errorf("fake: cannot capture %v of payment %s", amount, paymentID)
+	}
+	p.captured = amount
+	return nil
+}
+
+func (f *Fake) Refund(_ context.Context, paymentID string, amount money.Money) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return "", fmt.Errorf("fake: no payment %s", paymentID)
+	}
+	refunded, err := p.refunded.Add(amount)
+	if err != nil || !amount.IsPositive() {
+		return "", fmt.Errorf("fake: cannot refund %v of payment %s", amount, paymentID)
+	}
+	if cmp, err := refunded.Cmp(p.captured); err != nil || cmp > 0 {
+		return "", fmt.Errorf("fake: cannot refund %v of payment %s", amount, paymentID)
+	}
+	p.refunded = refunded
+	return randomID("re_"), nil
+}
+
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (*Event, error) {
+	var ts, sig string
+	for _, part := range strings.Split(header.Get(FakeSignatureHeader), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return nil, ErrBadSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > fakeWebhookTolerance || age < -fakeWebhookTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside tolerance", ErrBadSignature)
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, f.sign(ts, body)) {
+		return nil, ErrBadSignature
+	}
+
+	var evt Event
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return nil, fmt.Errorf("fake: decode event: %w", err)
+	}
+	return &evt, nil
+}
+
+// Sign returns the signature header value for body sent at t.
+func (f *Fake) Sign(t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(f.sign(ts, body))
+}
+
+func (f *Fake) sign(ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// send posts a signed event for session id to the webhook URL.
+func (f *Fake) send(ctx context.Context, typ, id string, s *fakeSession) error {
+	body, err := json.Marshal(Event{
+		ID:        randomID("evt_"),
+		Type:      typ,
+		SessionID: id,
+		PaymentID: s.paymentID,
+		Reference: s.req.Reference,
+		Amount:    s.req.Amount,
+		Created:   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, f.Sign(time.Now(), body))
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// session returns the unexpired session id.
+func (f *Fake) session(id string) (*fakeSession, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok || time.Now().After(s.expiresAt) {
+		return nil, false
+	}
+	return s, true
+}
+
+var fakePage = template.Must(template.New("checkout").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Test checkout</title></head>
+<body style="font-family: sans-serif; max-width: 28em; margin: 4em auto">
+<h1>Test checkout</h1>
+<p>{{.Description}}</p>
+<p><strong>{{.Amount}}</strong></p>
+<p>This is the fake payment provider. No card is charged.</p>
+<form method="post" action="{{.Action}}/pay"><button>Pay</button></form>
+<form method="post" action="{{.Action}}/cancel"><button>Cancel</button></form>
+</body></html>`))
+
+// fakeHandler returns the active fake provider or answers 404.
+func fakeHandler(w http.ResponseWriter) (*Fake, bool) {
+	f, ok := provider.(*Fake)
+	if !ok {
+		apierr.Respond(w, http.StatusNotFound, "The fake payment provider is not enabled")
+	}
+	return f, ok
+}
+
+// FakeCheckoutPage serves the fake provider's hosted checkout page.
+func FakeCheckoutPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	f, ok := fakeHandler(w)
+	if !ok {
+		return
+	}
+	id := ps.ByName("session")
+	s, ok := f.session(id)
+	if !ok {
+		apierr.Respond(w, http.StatusNotFound, "Checkout session not found or expired")
+		return
+	}
+	// The forms redirect on to the app, which the default policy's
+	// form-action 'self' would block.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; "+
+		"frame-ancestors 'none'; form-action 'self' "+origin(s.req.SuccessURL)+" "+origin(s.req.CancelURL))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fakePage.Execute(w, map[string]any{
+		"Description": s.req.Description,
+		"Amount":      s.req.Amount,
+		"Action":      f.pageURL + id,
+	})
+}
+
+// origin returns the scheme and host of rawURL.
+func origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// FakePay authorizes the payment of a fake checkout session, reports it
+// through the webhook and sends the customer to the success URL. Paying
+// again re-sends the webhook.
+func FakePay(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	finishFake(w, r, ps.ByName("session"), true)
+}
+
+// FakeCancel abandons a fake checkout session, reports it through the
+// webhook and sends the customer to the cancel URL.
+func FakeCancel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	finishFake(w, r, ps.ByName("session"), false)
+}
+
+var errSessionClosed = errors.New("checkout session already closed")
+
+func finishFake(w http.ResponseWriter, r *http.Request, id string, pay bool) {
+	f, ok := fakeHandler(w)
+	if !ok {
+		return
+	}
+	s, ok := f.session(id)
+	if !ok {
+		apierr.Respond(w, http.StatusNotFound, "Checkout session not found or expired")
+		return
+	}
+
+	typ, redirect := EventCheckoutFailed, s.req.CancelURL
+	if pay {
+		typ, redirect = EventCheckoutCompleted, s.req.SuccessURL
+	}
+	f.mu.Lock()
+	var err error
+	switch {
+	case pay && s.state == "open":
+		s.state = "paid"
+		s.paymentID = randomID("pi_")
+		f.payments[s.paymentID] = &fakePayment{authorized: s.req.Amount}
+	case pay && s.state == "paid", !pay && s.state == "cancelled":
+		// repeated click; send the webhook again
+	case !pay && s.state == "open":
+		s.state = "cancelled"
+	default:
+		err = errSessionClosed
+	}
+	snapshot := *s
+	f.mu.Unlock()
+	if err != nil {
+		apierr.Respond(w, http.StatusConflict, "Checkout session already closed")
+		return
+	}
+
+	if err := f.send(r.Context(), typ, id, &snapshot); err != nil {
+		slog.ErrorContext(r.Context(), "fake webhook failed", "session_id", id, "error", err)
+		apierr.Respond(w, http.StatusBadGateway, "Payment recorded but the shop was not notified; try again")
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
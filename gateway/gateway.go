@@ -0,0 +1,118 @@
+// Package gateway takes card payments through an external payment
+// provider.
+//
+// A purchase starts as a checkout: Start records what is being bought and
+// opens a session on the provider's hosted checkout page. Nothing is
+// handed out until the provider reports the payment through a webhook
+// whose signature verifies; Webhook then captures the payment and calls
+// the Fulfiller registered for the checkout's kind. A client returning
+// from the checkout page only ever reads the outcome.
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"naevis/config"
+	"naevis/money"
+)
+
+// PaymentProvider is a card payment provider with hosted checkout pages.
+type PaymentProvider interface {
+	// Name identifies the provider in webhook URLs and checkout records.
+	Name() string
+	// CreateCheckout opens a checkout session for req. The customer pays
+	// on the page at the session URL; the payment is only authorized
+	// until it is captured.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Session, error)
+	// Capture collects amount of an authorized payment.
+	Capture(ctx context.Context, paymentID string, amount money.Money) error
+	// Refund returns amount of a captured payment to the customer and
+	// returns the provider's refund ID.
+	Refund(ctx context.Context, paymentID string, amount money.Money) (string, error)
+	// VerifyWebhook checks the signature of a webhook request and decodes
+	// its event. It returns ErrBadSignature for anything not sent by the
+	// provider.
+	VerifyWebhook(header http.Header, body []byte) (*Event, error)
+}
+
+// CheckoutRequest describes a checkout session to open.
+type CheckoutRequest struct {
+	Reference   string // our checkout ID
+	Description string
+	Amount      money.Money
+	SuccessURL  string // where the customer is sent after paying
+	CancelURL   string // where the customer is sent after giving up
+}
+
+// Session is an open checkout session.
+type Session struct {
+	ID        string
+	URL       string // the hosted checkout page
+	ExpiresAt time.Time
+}
+
+// Webhook event types.
+const (
+	EventCheckoutCompleted = "checkout.completed" // the payment was authorized
+	EventCheckoutFailed    = "checkout.failed"    // cancelled, declined or expired
+)
+
+// Event is a verified webhook event.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	SessionID string      `json:"session_id"`
+	PaymentID string      `json:"payment_id,omitempty"`
+	Reference string      `json:"reference"`
+	Amount    money.Money `json:"amount"`
+	Created   int64       `json:"created"`
+}
+
+var (
+	// ErrBadSignature is returned for webhooks whose signature does not
+	// verify.
+	ErrBadSignature = errors.New("gateway: invalid webhook signature")
+	// ErrNotConfigured is returned when no payment provider is set up.
+	ErrNotConfigured = errors.New("gateway: payments are not configured")
+)
+
+// Settings; set by Configure.
+var (
+	provider PaymentProvider
+	// returnURL is the app page customers come back to, followed by the
+	// checkout ID.
+	returnURL = "http://localhost:5173/checkout/"
+)
+
+// Configure selects the payment provider from the loaded configuration.
+func Configure(cfg *config.Config) {
+	returnURL = cfg.Public.AppURL + "/checkout/"
+	switch cfg.Payments.Provider {
+	case config.PaymentsFake:
+		secret := cfg.Payments.WebhookSecret
+		if secret == "" {
+			secret = randomID("")
+		}
+		base := cfg.Public.BaseURL + "/api/v1/payments"
+		provider = NewFake(secret, base+"/fake/checkout/", base+"/webhook/"+FakeName)
+	default:
+		provider = nil
+	}
+}
+
+// Use replaces the payment provider, e.g. with a fake in tests.
+func Use(p PaymentProvider) {
+	provider = p
+}
+
+// randomID returns prefix followed by 32 random hex digits.
+func randomID(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
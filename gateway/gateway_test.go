@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/models"
+	"naevis/money"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// newTestShop serves the webhook and the fake provider's pages on a test
+// server and sells "thing" checkouts while stock lasts.
+func newTestShop(t *testing.T, stock int) (*Fake, *httptest.Server, *int) {
+	t.Helper()
+	db.Use(memdb.NewStore())
+	client := memredis.NewClient()
+	rdx.Use(client)
+	t.Cleanup(func() { client.Close() })
+
+	router := httprouter.New()
+	router.POST("/webhook/:provider", Webhook)
+	router.GET("/pay/:session", FakeCheckoutPage)
+	router.POST("/pay/:session/pay", FakePay)
+	router.POST("/pay/:session/cancel", FakeCancel)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	fake := NewFake("test-secret", srv.URL+"/pay/", srv.URL+"/webhook/"+FakeName)
+	Use(fake)
+	t.Cleanup(func() { Use(nil) })
+
+	fulfilled := new(int)
+	RegisterFulfiller("thing", func(ctx context.Context, c *models.Checkout, done func(context.Context, models.Meta) error) error {
+		return db.RunInTransaction(ctx, func(ctx context.Context) error {
+			if stock < c.Quantity {
+				return fmt.Errorf("%w: sold out", ErrUnavailable)
+			}
+			stock -= c.Quantity
+			*fulfilled++
+			return done(ctx, models.Meta{"left": stock})
+		})
+	})
+	return fake, srv, fulfilled
+}
+
+func inr(minor int64) money.Money { return money.Money{Minor: minor, Currency: "INR"} }
+
+func start(t *testing.T, amount money.Money) (*models.Checkout, *Session) {
+	t.Helper()
+	c, s, err := Start(context.Background(), "ann", Item{Kind: "thing", Quantity: 2, Amount: amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func state(t *testing.T, id string) models.Checkout {
+	t.Helper()
+	var c models.Checkout
+	if err := db.CheckoutsCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// click submits a button on the hosted page and returns the response
+// without following its redirect.
+func click(t *testing.T, url string) *http.Response {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Post(url, "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestCheckoutFulfilledOnlyAfterSignedWebhook(t *testing.T) {
+	fake, srv, fulfilled := newTestShop(t, 5)
+	c, session := start(t, inr(3000))
+
+	resp, err := http.Get(session.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "30.00 INR") {
+		t.Errorf("checkout page does not show the amount:\n%s", page)
+	}
+
+	// A completion the provider did not sign is refused.
+	forged, _ := json.Marshal(Event{ID: "evt_x", Type: EventCheckoutCompleted, SessionID: session.ID, Amount: inr(3000)})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/webhook/fake", bytes.NewReader(forged))
+	req.Header.Set(FakeSignatureHeader, NewFake("wrong", "", "").Sign(time.Now(), forged))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("forged webhook = %v, %v", resp, err)
+	}
+	// So is a correctly signed but stale one.
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/webhook/fake", bytes.NewReader(forged))
+	req.Header.Set(FakeSignatureHeader, fake.Sign(time.Now().Add(-time.Hour), forged))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("stale webhook = %v, %v", resp, err)
+	}
+	if got := state(t, c.ID); got.State != StatePending || *fulfilled != 0 {
+		t.Fatalf("after unsigned webhooks: state %s, fulfilled %d", got.State, *fulfilled)
+	}
+
+	resp = click(t, session.URL+"/pay")
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), c.ID+"?status=success") {
+		t.Fatalf("pay = %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	got := state(t, c.ID)
+	if got.State != StateFulfilled || got.PaymentID == "" || got.Result["left"] != int32(3) {
+		t.Fatalf("after payment: %+v", got)
+	}
+	if p := fake.payments[got.PaymentID]; p.captured != inr(3000) {
+		t.Errorf("captured %v, want 30", p.captured)
+	}
+
+	// The provider delivering the event again changes nothing.
+	if resp := click(t, session.URL+"/pay"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("repeated pay = %d", resp.StatusCode)
+	}
+	if *fulfilled != 1 {
+		t.Errorf("fulfilled %d times, want 1", *fulfilled)
+	}
+}
+
+func TestCheckoutRefundedWhenSoldOut(t *testing.T) {
+	fake, _, _ := newTestShop(t, 1)
+	c, session := start(t, inr(3000))
+
+	click(t, session.URL+"/pay")
+	got := state(t, c.ID)
+	if got.State != StateRefunded {
+		t.Fatalf("state = %s, want refunded", got.State)
+	}
+	if p := fake.payments[got.PaymentID]; p.refunded != inr(3000) {
+		t.Errorf("refunded %v, want 30", p.refunded)
+	}
+}
+
+func TestCheckoutCancelledOrUnderpaid(t *testing.T) {
+	fake, srv, fulfilled := newTestShop(t, 5)
+
+	c, session := start(t, inr(3000))
+	if resp := click(t, session.URL+"/cancel"); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("cancel = %d", resp.StatusCode)
+	}
+	if got := state(t, c.ID); got.State != StateFailed {
+		t.Errorf("cancelled checkout state = %s", got.State)
+	}
+	if resp := click(t, session.URL+"/pay"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("paying a cancelled session = %d, want 409", resp.StatusCode)
+	}
+
+	// A signed event for less than the checkout's amount is not captured.
+	c, session = start(t, inr(3000))
+	body, _ := json.Marshal(Event{ID: "evt_y", Type: EventCheckoutCompleted, SessionID: session.ID, PaymentID: "pi_y", Amount: inr(100)})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/webhook/fake", bytes.NewReader(body))
+	req.Header.Set(FakeSignatureHeader, fake.Sign(time.Now(), body))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("underpaid webhook = %v, %v", resp, err)
+	}
+	if got := state(t, c.ID); got.State != StateFailed || *fulfilled != 0 {
+		t.Errorf("underpaid checkout: state %s, fulfilled %d", got.State, *fulfilled)
+	}
+}
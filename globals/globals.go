@@ -2,17 +2,29 @@ package globals
 
 import (
 	"context"
+
+	"naevis/config"
 )
 
 var (
-	// tokenSigningAlgo = jwt.SigningMethodHS256
-	JwtSecret = []byte("your_secret_key") // Replace with a secure secret key
+	// JwtSecret keys server-side HMACs such as verification code hashes;
+	// access tokens are signed by jwtkeys. Set from config.JWTSecret by
+	// Configure.
+	JwtSecret []byte
 )
 
+// Configure applies the loaded configuration to the shared globals.
+func Configure(cfg *config.Config) {
+	JwtSecret = []byte(cfg.JWTSecret)
+}
+
 // Context keys
 type ContextKey string
 
 const RoleKey ContextKey = "role"
 const UserIDKey ContextKey = "userId"
+const SessionIDKey ContextKey = "sessionId"
+const EmailVerifiedKey ContextKey = "emailVerified"
+const MFAKey ContextKey = "mfa"
 
 var Ctx = context.Background()
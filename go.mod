@@ -16,7 +16,6 @@ require (
 	go.mongodb.org/mongo-driver v1.17.4
 	golang.org/x/crypto v0.41.0
 	golang.org/x/image v0.30.0 // indirect
-	golang.org/x/time v0.12.0
 )
 
 require (
@@ -1,14 +1,20 @@
 package hashtags
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
 
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/models"
+	"naevis/pagination"
 	"naevis/utils"
 
 	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // HashtagPost is the shape we return to the frontend grid
@@ -68,74 +74,88 @@ func paginate[T any](items []T, page, limit int) []T {
 	return items[start:end]
 }
 
-// GetHashtagPosts returns dummy posts for a hashtag (all types)
-func GetHashtagPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	tag := ps.ByName("tag")
-	if tag == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing tag parameter")
-		return
-	}
-
-	page, limit := parsePagination(r)
-
-	now := time.Now()
-	posts := []HashtagPost{
-		{
-			PostID:      "p1",
-			MediaURL:    []string{"/static/dummy1.jpg"},
-			Type:        "image",
-			Title:       "Sunny day",
-			Description: "A beautiful sunny day!",
-			Tags:        []string{tag, "nature"},
-			UserID:      "u1",
-			Timestamp:   now.Add(-time.Hour),
-		},
-		{
-			PostID:      "p2",
-			MediaURL:    []string{"/static/dummy2.mp4"},
-			Type:        "video",
-			Title:       "Skating",
-			Description: "Check out my new trick",
-			Tags:        []string{tag, "sports"},
-			UserID:      "u2",
-			Timestamp:   now.Add(-2 * time.Hour),
-			Resolution:  "1080p",
-		},
-		{
-			PostID:      "p3",
-			MediaURL:    []string{"/static/dummy3.jpg"},
-			Type:        "image",
-			Title:       "Coffee time",
-			Description: "Morning ritual ☕",
-			Tags:        []string{tag, "coffee"},
-			UserID:      "u3",
-			Timestamp:   now.Add(-3 * time.Hour),
-		},
-	}
-
-	results := paginate(posts, page, limit)
+// postOrder is a keyset ordering of posts and how to read its sort key.
+type postOrder struct {
+	sort pagination.Sort
+	key  func(models.FeedPost) any
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(results); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to encode response")
+// Orderings for hashtag post lists; postid breaks ties. timestamp is
+// RFC 3339 and sorts chronologically as a string.
+var (
+	latestPosts = postOrder{
+		sort: pagination.Sort{Field: "timestamp", IDField: "postid", Desc: true},
+		key:  func(p models.FeedPost) any { return p.Timestamp },
+	}
+	topPosts = postOrder{
+		sort: pagination.Sort{Field: "likes", IDField: "postid", Desc: true},
+		key:  func(p models.FeedPost) any { return p.Likes },
 	}
+)
+
+// GetHashtagPosts returns the latest feed posts tagged with :tag.
+func GetHashtagPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	listHashtagPosts(w, r, ps.ByName("tag"), latestPosts)
 }
 
-// GetTopHashtagPosts returns dummy "top" posts (sorted by engagement in real app)
+// GetTopHashtagPosts returns posts tagged with :tag, most liked first.
 func GetTopHashtagPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	GetHashtagPosts(w, r, ps)
+	listHashtagPosts(w, r, ps.ByName("tag"), topPosts)
 }
 
-// GetLatestHashtagPosts returns dummy "latest" posts (sorted by timestamp in real app)
+// GetLatestHashtagPosts returns posts tagged with :tag, newest first.
 func GetLatestHashtagPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	GetHashtagPosts(w, r, ps)
+	listHashtagPosts(w, r, ps.ByName("tag"), latestPosts)
+}
+
+func listHashtagPosts(w http.ResponseWriter, r *http.Request, tag string, order postOrder) {
+	if tag == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Missing tag parameter")
+		return
+	}
+	page, err := pagination.Parse(r, 30, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	filter := order.sort.Filter(bson.M{"tags": tag}, page.After)
+	posts, err := utils.FindAndDecode[models.FeedPost](ctx, db.PostsCollection, filter, order.sort.FindOptions(page.Limit))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch posts")
+		return
+	}
+
+	posts, next := pagination.Trim(posts, page.Limit, func(p models.FeedPost) pagination.Cursor {
+		return pagination.Cursor{Key: order.key(p), ID: p.PostID}
+	})
+
+	results := make([]HashtagPost, len(posts))
+	for i, p := range posts {
+		ts, _ := time.Parse(time.RFC3339, p.Timestamp)
+		results[i] = HashtagPost{
+			PostID:      p.PostID,
+			MediaURL:    p.MediaURL,
+			Type:        p.Type,
+			Title:       p.Title,
+			Description: p.Description,
+			Tags:        p.Tags,
+			UserID:      p.UserID,
+			Timestamp:   ts,
+			Resolution:  p.Resolutions,
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(results, next))
 }
 
 // GetHashtagPeople returns dummy people who used the hashtag
 func GetHashtagPeople(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	tag := ps.ByName("tag")
 	if tag == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing tag parameter")
+		apierr.Respond(w, http.StatusBadRequest, "Missing tag parameter")
 		return
 	}
 
@@ -153,7 +173,7 @@ func GetHashtagPeople(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(results); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to encode response")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
@@ -180,6 +200,6 @@ func GetTrendingHashtags(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(all); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to encode response")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"naevis/db"
+	"naevis/mail"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/scheduler"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// backgroundWorkers run for the life of the process; main starts them and
+// Ready expects each to keep beating.
+var backgroundWorkers = []func(context.Context){
+	mq.StartIndexingWorker,
+	mq.StartHashtagWorker,
+	mq.StartOutboxRelay,
+	mail.StartWorker,
+	scheduler.Run,
+}
+
+// workerMaxAge is how long a worker may go without a heartbeat before the
+// instance reports not ready. Consumers block for at most a few seconds
+// per read, so a minute means stuck rather than idle.
+const workerMaxAge = time.Minute
+
+type readyCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Ready is the readiness probe: Mongo and Redis must answer and every
+// background worker must have made progress recently. It returns 503 with
+// the failing checks so an orchestrator stops routing traffic here.
+func Ready(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	checks := map[string]readyCheck{
+		"mongo": check(db.PingMongo()),
+		"redis": check(pingRedis(r.Context())),
+	}
+
+	workers := mq.Workers(workerMaxAge)
+	alive := 0
+	for _, ws := range workers {
+		if ws.Alive {
+			alive++
+		}
+	}
+	workersCheck := readyCheck{OK: alive >= len(backgroundWorkers)}
+	if !workersCheck.OK {
+		workersCheck.Error = "background workers not running"
+	}
+	checks["workers"] = workersCheck
+
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	utils.RespondWithJSON(w, status, map[string]any{
+		"ready":   status == http.StatusOK,
+		"checks":  checks,
+		"workers": workers,
+	})
+}
+
+func check(err error) readyCheck {
+	if err != nil {
+		return readyCheck{Error: err.Error()}
+	}
+	return readyCheck{OK: true}
+}
+
+func pingRedis(ctx context.Context) error {
+	if rdx.Conn == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return rdx.Conn.Ping(ctx).Err()
+}
@@ -14,6 +14,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/utils"
 )
@@ -28,7 +29,7 @@ type HomeCard struct {
 
 // Ensure indexes once during startup
 func EnsureHomeCardsIndexes(ctx context.Context) error {
-	collections := []*mongo.Collection{
+	collections := []db.Collection{
 		db.PlacesCollection,
 		db.EventsCollection,
 		db.BaitoCollection,
@@ -40,7 +41,7 @@ func EnsureHomeCardsIndexes(ctx context.Context) error {
 		if c == nil {
 			continue
 		}
-		if _, err := c.Indexes().CreateOne(ctx, model); err != nil {
+		if err := db.CreateIndexes(ctx, c, model); err != nil {
 			return err
 		}
 	}
@@ -48,7 +49,7 @@ func EnsureHomeCardsIndexes(ctx context.Context) error {
 }
 
 // categoryProjection returns collection and projection function
-func categoryProjection(category string) (*mongo.Collection, func(bson.M) HomeCard) {
+func categoryProjection(category string) (db.Collection, func(bson.M) HomeCard) {
 	switch category {
 	case "Places":
 		return db.PlacesCollection, func(doc bson.M) HomeCard {
@@ -181,7 +182,7 @@ func HomeCardsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	if err != nil {
 		log.Println("Find error:", err, "req_id:", reqID)
 		w.Header().Set("X-Error-Request-Id", reqID)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch home cards")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch home cards")
 		return
 	}
 	defer cur.Close(ctx)
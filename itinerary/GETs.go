@@ -2,6 +2,7 @@ package itinerary
 
 import (
 	"context"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -20,7 +21,7 @@ func GetItineraries(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	filter := bson.M{"deleted": bson.M{"$ne": true}}
 	itineraries, err := utils.FindAndDecode[models.Itinerary](ctx, db.ItineraryCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error fetching itineraries")
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching itineraries")
 		return
 	}
 
@@ -63,7 +64,7 @@ func SearchItineraries(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 
 	cursor, err := db.ItineraryCollection.Find(ctx, filter)
 	if err != nil {
-		http.Error(w, "Error fetching itineraries", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching itineraries")
 		return
 	}
 	defer cursor.Close(ctx)
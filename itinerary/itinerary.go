@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -31,13 +32,13 @@ func GetRequestingUserID(w http.ResponseWriter, r *http.Request) (string, error)
 func CreateItinerary(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var itinerary models.Itinerary
 	if err := json.NewDecoder(r.Body).Decode(&itinerary); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
 	userID, err := GetRequestingUserID(w, r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -63,7 +64,7 @@ func CreateItinerary(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 
 	result, err := db.ItineraryCollection.InsertOne(ctx, itinerary)
 	if err != nil {
-		http.Error(w, "Error inserting itinerary", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error inserting itinerary")
 		return
 	}
 
@@ -83,7 +84,7 @@ func GetItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var itinerary models.Itinerary
 	err := db.ItineraryCollection.FindOne(ctx, filter).Decode(&itinerary)
 	if err != nil {
-		http.Error(w, "Itinerary not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Itinerary not found")
 		return
 	}
 
@@ -105,7 +106,7 @@ func GetItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func UpdateItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, err := GetRequestingUserID(w, r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -115,18 +116,18 @@ func UpdateItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 
 	var existing models.Itinerary
 	if err := db.ItineraryCollection.FindOne(ctx, bson.M{"itineraryid": itineraryID}).Decode(&existing); err != nil {
-		http.Error(w, "Itinerary not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Itinerary not found")
 		return
 	}
 
 	if existing.UserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	var updated models.Itinerary
 	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -152,7 +153,7 @@ func UpdateItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}}
 
 	if _, err := db.ItineraryCollection.UpdateOne(ctx, bson.M{"itineraryid": itineraryID}, update); err != nil {
-		http.Error(w, "Error updating itinerary", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error updating itinerary")
 		return
 	}
 
@@ -163,7 +164,7 @@ func UpdateItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 func DeleteItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, err := GetRequestingUserID(w, r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -173,18 +174,18 @@ func DeleteItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 
 	var itinerary models.Itinerary
 	if err := db.ItineraryCollection.FindOne(ctx, bson.M{"itineraryid": itineraryID}).Decode(&itinerary); err != nil {
-		http.Error(w, "Itinerary not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Itinerary not found")
 		return
 	}
 
 	if itinerary.UserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	_, err = db.ItineraryCollection.UpdateOne(ctx, bson.M{"itineraryid": itineraryID}, bson.M{"$set": bson.M{"deleted": true}})
 	if err != nil {
-		http.Error(w, "Error deleting itinerary", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error deleting itinerary")
 		return
 	}
 
@@ -195,7 +196,7 @@ func DeleteItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 func ForkItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, err := GetRequestingUserID(w, r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -205,7 +206,7 @@ func ForkItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	var original models.Itinerary
 	if err := db.ItineraryCollection.FindOne(ctx, bson.M{"itineraryid": originalID}).Decode(&original); err != nil {
-		http.Error(w, "Original itinerary not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Original itinerary not found")
 		return
 	}
 
@@ -234,7 +235,7 @@ func ForkItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	result, err := db.ItineraryCollection.InsertOne(ctx, newItinerary)
 	if err != nil {
-		http.Error(w, "Error forking itinerary", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error forking itinerary")
 		return
 	}
 
@@ -245,7 +246,7 @@ func ForkItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func PublishItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID, err := GetRequestingUserID(w, r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -258,7 +259,7 @@ func PublishItinerary(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 
 	result, err := db.ItineraryCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		http.Error(w, "Error publishing itinerary", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error publishing itinerary")
 		return
 	}
 
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"naevis/baito"
+	"naevis/events"
+	"naevis/pay"
+	"naevis/rdx"
+	"naevis/scheduler"
+	"naevis/tickets"
+)
+
+// registerJobs tells the scheduler about every background job. It runs
+// before the scheduler starts; the scheduler decides per activation which
+// instance executes it.
+func registerJobs() {
+	scheduler.Register(scheduler.Job{
+		Name:     "chat.flush-messages",
+		Schedule: "@every 30s",
+		Timeout:  time.Minute,
+		Run:      ignorePayload(rdx.FlushRedisMessages),
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     "likes.flush-counters",
+		Schedule: "@every 30s",
+		Timeout:  time.Minute,
+		Run:      ignorePayload(rdx.FlushRedisLikes),
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     tickets.JobExpireLocks,
+		Schedule: "* * * * *",
+		Timeout:  time.Minute,
+		Run:      tickets.ExpireSeatLocks,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:       tickets.JobReleaseSeats,
+		Timeout:    30 * time.Second,
+		Concurrent: true,
+		Run:        tickets.ReleaseSeats,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     baito.JobCloseExpired,
+		Schedule: "*/15 * * * *",
+		Run:      baito.CloseExpired,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     pay.JobReconcile,
+		Schedule: "30 3 * * *",
+		Timeout:  30 * time.Minute,
+		Run:      pay.ReconcileJob,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     events.JobSendReminders,
+		Schedule: "*/10 * * * *",
+		Run:      events.SendReminders,
+	})
+}
+
+func ignorePayload(fn func(context.Context) error) scheduler.Func {
+	return func(ctx context.Context, _ json.RawMessage) error { return fn(ctx) }
+}
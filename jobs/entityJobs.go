@@ -1,11 +1,13 @@
 package jobs
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/mq"
@@ -26,14 +28,14 @@ func CreateBaitoForEntity(w http.ResponseWriter, r *http.Request, ps httprouter.
 
 	var baito models.Baito
 	if err := json.NewDecoder(r.Body).Decode(&baito); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate required fields
 	if baito.Title == "" || baito.Description == "" || baito.Category == "" ||
 		baito.Location == "" || baito.Wage == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing required fields")
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
@@ -53,20 +55,23 @@ func CreateBaitoForEntity(w http.ResponseWriter, r *http.Request, ps httprouter.
 	baito.LastDateToApply = time.Now().AddDate(0, 1, 0) // default 1 month
 	baito.ApplicationCount = 0
 
-	_, err := db.BaitoCollection.InsertOne(ctx, baito)
+	// Save the baito and publish it to MQ together
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.BaitoCollection.InsertOne(ctx, baito); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "baito-created", models.Index{
+			EntityType: baito.EntityType,
+			EntityId:   baito.BaitoId,
+			Method:     "POST",
+		})
+	})
 	if err != nil {
 		log.Printf("Insert error: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save baito")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save baito")
 		return
 	}
 
-	// Publish to MQ
-	go mq.Emit(ctx, "baito-created", models.Index{
-		EntityType: baito.EntityType,
-		EntityId:   baito.BaitoId,
-		Method:     "POST",
-	})
-
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"baitoid": baito.BaitoId})
 }
 
@@ -81,14 +86,14 @@ func GetJobsRelatedTOEntity(w http.ResponseWriter, r *http.Request, ps httproute
 		"entityId":   entityID,
 	})
 	if err != nil {
-		http.Error(w, "Failed to fetch jobs", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch jobs")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var jobs []models.BaitosResponse
 	if err := cursor.All(ctx, &jobs); err != nil {
-		http.Error(w, "Failed to decode jobs", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode jobs")
 		return
 	}
 
@@ -0,0 +1,237 @@
+// Package jwtkeys holds the Ed25519 keys that sign and verify access
+// tokens, and publishes the public halves as a JWKS so other services
+// can verify tokens without a shared secret.
+//
+// Keys are PEM files named <kid>.pem in one directory: PKCS#8 private
+// keys ("openssl genpkey -algorithm ed25519") or PKIX public keys. The
+// active key signs; every key verifies. To rotate without logging anyone
+// out:
+//
+//  1. add the new key and restart, so every instance and JWKS consumer
+//     knows it before it is used;
+//  2. make it active and restart;
+//  3. once tokens signed by the old key have expired, delete it.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"naevis/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithm is the only signing algorithm issued or accepted.
+const Algorithm = "EdDSA"
+
+// ErrUnknownKey is returned for tokens whose kid is not in the keyring.
+var ErrUnknownKey = errors.New("jwtkeys: unknown signing key")
+
+// Keyring is a set of verification keys, one of which also signs.
+type Keyring struct {
+	active string
+	signer ed25519.PrivateKey
+	keys   map[string]ed25519.PublicKey
+}
+
+// Load reads the keys in dir. active names the signing key; it may be
+// empty when dir holds exactly one private key.
+func Load(dir, active string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{keys: map[string]ed25519.PublicKey{}}
+	private := map[string]ed25519.PrivateKey{}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pub, priv, err := parsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwtkeys: %s: %w", path, err)
+		}
+		k.keys[kid] = pub
+		if priv != nil {
+			private[kid] = priv
+		}
+	}
+	if len(k.keys) == 0 {
+		return nil, fmt.Errorf("jwtkeys: no keys in %s", dir)
+	}
+
+	if active == "" {
+		if len(private) != 1 {
+			return nil, fmt.Errorf("jwtkeys: %s has %d private keys; choose the active one", dir, len(private))
+		}
+		for kid := range private {
+			active = kid
+		}
+	}
+	if private[active] == nil {
+		return nil, fmt.Errorf("jwtkeys: no private key %q in %s", active, dir)
+	}
+	k.active, k.signer = active, private[active]
+	return k, nil
+}
+
+// Generate returns a keyring with one new random key, for tests and
+// development.
+func Generate() (*Keyring, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid := fmt.Sprintf("%x", pub[:8])
+	return &Keyring{active: kid, signer: priv, keys: map[string]ed25519.PublicKey{kid: pub}}, nil
+}
+
+func parsePEM(data []byte) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("not PEM")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%T is not an Ed25519 key", key)
+		}
+		return priv.Public().(ed25519.PublicKey), priv, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%T is not an Ed25519 key", key)
+		}
+		return pub, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+}
+
+// Sign signs claims with the active key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["kid"] = k.active
+	return tok.SignedString(k.signer)
+}
+
+// Keyfunc returns the key for a token by its kid header. Pass it to the
+// jwt parser together with jwt.WithValidMethods([]string{Algorithm}).
+func (k *Keyring) Keyfunc(t *jwt.Token) (any, error) {
+	if t.Method.Alg() != Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+	}
+	kid, _ := t.Header["kid"].(string)
+	pub, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return pub, nil
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	X   string `json:"x"`
+}
+
+// JWKS returns the public keys as a JSON Web Key Set, ordered by kid.
+func (k *Keyring) JWKS() map[string][]JWK {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := make([]JWK, len(kids))
+	for i, kid := range kids {
+		set[i] = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Kid: kid,
+			Use: "sig",
+			Alg: Algorithm,
+			X:   base64.RawURLEncoding.EncodeToString(k.keys[kid]),
+		}
+	}
+	return map[string][]JWK{"keys": set}
+}
+
+// current is the server's keyring; set by Configure or Use.
+var current *Keyring
+
+// Configure loads the keyring from the configuration. Without a key
+// directory, dev runs with a throwaway key; its tokens stop working when
+// the server restarts.
+func Configure(cfg *config.Config) error {
+	if cfg.JWT.KeysDir == "" {
+		slog.Warn("JWT_KEYS_DIR is not set; signing with a temporary key")
+		k, err := Generate()
+		if err != nil {
+			return err
+		}
+		Use(k)
+		return nil
+	}
+	k, err := Load(cfg.JWT.KeysDir, cfg.JWT.ActiveKey)
+	if err != nil {
+		return err
+	}
+	slog.Info("jwt keyring loaded", "active_key", k.active, "keys", len(k.keys))
+	Use(k)
+	return nil
+}
+
+// Use replaces the keyring, e.g. with a generated one in tests.
+func Use(k *Keyring) {
+	current = k
+}
+
+// Sign signs claims with the server's active key.
+func Sign(claims jwt.Claims) (string, error) {
+	if current == nil {
+		return "", errors.New("jwtkeys: not configured")
+	}
+	return current.Sign(claims)
+}
+
+// Keyfunc looks up the server's key for t.
+func Keyfunc(t *jwt.Token) (any, error) {
+	if current == nil {
+		return nil, errors.New("jwtkeys: not configured")
+	}
+	return current.Keyfunc(t)
+}
+
+// JWKS returns the server's public keys.
+func JWKS() map[string][]JWK {
+	if current == nil {
+		return map[string][]JWK{"keys": {}}
+	}
+	return current.JWKS()
+}
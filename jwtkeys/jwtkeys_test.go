@@ -0,0 +1,118 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey writes a new key to dir as kid.pem, private or public only.
+func writeKey(t *testing.T, dir, kid string, private bool) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PUBLIC KEY"}
+	if private {
+		block.Type = "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(priv)
+	} else {
+		block.Bytes, err = x509.MarshalPKIXPublicKey(pub)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func parse(k *Keyring, raw string) error {
+	_, err := jwt.Parse(raw, k.Keyfunc, jwt.WithValidMethods([]string{Algorithm}))
+	return err
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeKey(t, dir, "2026-01", true)
+	if _, err := Load(dir, ""); err != nil {
+		t.Fatalf("Load with one key: %v", err)
+	}
+
+	// Adding the next key makes the choice of signer explicit.
+	writeKey(t, dir, "2026-02", true)
+	if _, err := Load(dir, ""); err == nil {
+		t.Fatal("Load with two private keys and no active one succeeded")
+	}
+	k, err := Load(dir, "2026-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := k.Sign(jwt.MapClaims{"sub": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(k, signed); err != nil {
+		t.Errorf("token from active key: %v", err)
+	}
+
+	// Tokens signed before the switch still verify.
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "u1"})
+	tok.Header["kid"] = "2026-01"
+	earlier, _ := tok.SignedString(oldKey)
+	if err := parse(k, earlier); err != nil {
+		t.Errorf("token from previous key: %v", err)
+	}
+	tok.Header["kid"] = "2025-12"
+	retired, _ := tok.SignedString(oldKey)
+	if err := parse(k, retired); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token from unknown key: err = %v", err)
+	}
+
+	if set := k.JWKS()["keys"]; len(set) != 2 || set[0].Kid != "2026-01" || set[1].X == "" {
+		t.Errorf("JWKS = %+v", set)
+	}
+}
+
+func TestPublicOnlyKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "other-service", false)
+	if _, err := Load(dir, "other-service"); err == nil {
+		t.Error("a public key was accepted as the signer")
+	}
+	writeKey(t, dir, "ours", true)
+	k, err := Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.JWKS()["keys"]) != 2 {
+		t.Errorf("JWKS = %+v", k.JWKS())
+	}
+}
+
+func TestRejectsOtherAlgorithms(t *testing.T) {
+	k, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An HMAC token keyed with the public key is the classic confusion.
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1"})
+	tok.Header["kid"] = k.active
+	forged, _ := tok.SignedString([]byte(k.keys[k.active]))
+	if err := parse(k, forged); err == nil {
+		t.Error("HS256 token accepted")
+	}
+	if _, err := k.Keyfunc(tok); err == nil {
+		t.Error("Keyfunc returned a key for HS256")
+	}
+}
@@ -0,0 +1,153 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"naevis/config"
+)
+
+// smtpMailer delivers through an SMTP server, upgrading to TLS when the
+// server offers STARTTLS. It authenticates only when a username is set.
+// The whole exchange is bounded by the context of Send, so a server that
+// stalls cannot hold up the mail worker.
+type smtpMailer struct {
+	cfg config.SMTP
+}
+
+func (m smtpMailer) Send(ctx context.Context, from string, msg *Message) error {
+	rcpt, data, err := encode(from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, _ := mail.ParseAddress(from) // validated by encode
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, m.cfg.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Cancellation without a deadline unblocks any pending read or write.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	err = m.deliver(conn, sender.Address, rcpt, data)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("smtp %s: %w", m.cfg.Host, ctx.Err())
+	}
+	return err
+}
+
+// deliver runs one SMTP transaction over conn.
+func (m smtpMailer) deliver(conn net.Conn, from string, rcpt []string, data []byte) error {
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range rcpt {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// logMailer logs a one-line summary of each message and discards it.
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, from string, msg *Message) error {
+	if _, _, err := encode(from, msg, time.Now()); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "mail not sent by the log driver", "to", strings.Join(msg.To, ","),
+		"subject", msg.Subject, "attachments", len(msg.Attachments))
+	return nil
+}
+
+// maildirMailer delivers into a maildir: each message is written to tmp/
+// and renamed into new/, so readers never see a partial file. Any mail
+// client or `cat` can read the result.
+type maildirMailer struct {
+	dir string
+}
+
+func (m maildirMailer) Send(_ context.Context, from string, msg *Message) error {
+	_, data, err := encode(from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	name, err := maildirName()
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("deliver to maildir: %w", err)
+	}
+	return nil
+}
+
+// maildirName returns a unique file name in the usual
+// time.pid_random.host form.
+func maildirName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "_", ":", "_").Replace(host)
+	if host == "" {
+		host = "localhost"
+	}
+	return strconv.FormatInt(time.Now().Unix(), 10) + "." + strconv.Itoa(os.Getpid()) + "_" + hex.EncodeToString(b) + "." + host, nil
+}
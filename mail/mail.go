@@ -0,0 +1,141 @@
+// Package mail sends transactional email.
+//
+// Messages are rendered from the templates in templates/ and queued
+// through the outbox onto the mail stream, so a message queued inside a
+// transaction is only sent if the transaction commits. StartWorker
+// delivers queued messages through the configured Mailer; failed sends are
+// retried with backoff and dead-lettered by the mq consumer.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/textproto"
+
+	"naevis/config"
+	"naevis/db"
+	"naevis/models"
+	"naevis/mq"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Attachment is a file sent along with a message.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// Message is one email. Text is required; HTML, when set, is offered as
+// the preferred alternative.
+type Message struct {
+	To          []string     `json:"to"`
+	Subject     string       `json:"subject"`
+	Text        string       `json:"text"`
+	HTML        string       `json:"html,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// ErrInvalid is returned for messages that can never be sent, such as
+// ones with a malformed address.
+var ErrInvalid = errors.New("mail: invalid message")
+
+// Mailer delivers a message immediately.
+type Mailer interface {
+	Send(ctx context.Context, from string, msg *Message) error
+}
+
+// Delivery settings; set by Configure.
+var (
+	mailer Mailer = logMailer{}
+	from          = "naevis@localhost"
+)
+
+// Configure selects the mail driver from the loaded configuration.
+func Configure(cfg *config.Config) {
+	from = cfg.Mail.From
+	switch cfg.Mail.Driver {
+	case config.MailSMTP:
+		mailer = smtpMailer{cfg: cfg.SMTP}
+	case config.MailMaildir:
+		mailer = maildirMailer{dir: cfg.Mail.Dir}
+	default:
+		mailer = logMailer{}
+	}
+}
+
+// Use replaces the mailer, e.g. with a recorder in tests.
+func Use(m Mailer) {
+	mailer = m
+}
+
+// event is the mq event name of a queued message.
+const event = "send"
+
+// Queue renders template name with data and queues the result for to.
+// Pass the ctx of a running transaction to send only if it commits.
+func Queue(ctx context.Context, to, name string, data any, attachments ...Attachment) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+	msg.Attachments = attachments
+	return Enqueue(ctx, msg)
+}
+
+// QueueToUser is Queue addressed to the email of userID. Users without an
+// address are skipped.
+func QueueToUser(ctx context.Context, userID, name string, data any, attachments ...Attachment) error {
+	var u models.User
+	err := db.UserCollection.FindOne(ctx, bson.M{"userid": userID},
+		options.FindOne().SetProjection(bson.M{"email": 1})).Decode(&u)
+	if err != nil {
+		return fmt.Errorf("look up email of %s: %w", userID, err)
+	}
+	if u.Email == "" {
+		slog.WarnContext(ctx, "mail not sent; user has no email", "user_id", userID, "template", name)
+		return nil
+	}
+	return Queue(ctx, u.Email, name, data, attachments...)
+}
+
+// Enqueue queues msg for delivery.
+func Enqueue(ctx context.Context, msg *Message) error {
+	if len(msg.To) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrInvalid)
+	}
+	return mq.Enqueue(ctx, mq.StreamMail, event, msg)
+}
+
+// StartWorker delivers queued messages until ctx is cancelled.
+func StartWorker(ctx context.Context) {
+	c := mq.NewConsumer(mq.StreamMail, "mailer", func(ctx context.Context, m mq.Message) error {
+		var msg Message
+		if err := m.Decode(&msg); err != nil {
+			return mq.Permanent(fmt.Errorf("decode mail: %w", err))
+		}
+		err := mailer.Send(ctx, from, &msg)
+		if permanent(err) {
+			return mq.Permanent(err)
+		}
+		return err
+	})
+	if err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "mail worker stopped", "error", err)
+	}
+}
+
+// permanent reports whether retrying the send cannot help: the message
+// is malformed or the server rejected it outright.
+func permanent(err error) bool {
+	var tp *textproto.Error
+	if errors.As(err, &tp) {
+		return tp.Code >= 500
+	}
+	return errors.Is(err, ErrInvalid)
+}
@@ -0,0 +1,211 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"naevis/config"
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/models"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+)
+
+func TestTemplatesRender(t *testing.T) {
+	data := map[string]any{
+		"Code": "123456", "ExpiresIn": "10 minutes",
+		"EventTitle": "Rock <Night>", "Codes": []string{"a", "b"},
+		"StartsAt": time.Date(2026, 5, 1, 20, 0, 0, 0, time.UTC), "Venue": "Hall",
+		"OrderID": "ORD1", "Items": map[string][]models.CartItem{"merch": {{ItemName: "Shirt", Quantity: 2}}},
+	}
+	for name := range templates {
+		msg, err := Render(name, data)
+		if err != nil {
+			t.Errorf("Render(%s): %v", name, err)
+			continue
+		}
+		if msg.Subject == "" || strings.TrimSpace(msg.Text) == "" {
+			t.Errorf("Render(%s) = %+v, want subject and text", name, msg)
+		}
+		if strings.Contains(msg.HTML, "<Night>") {
+			t.Errorf("Render(%s) did not escape HTML", name)
+		}
+	}
+	if _, err := Render("nope", nil); err == nil {
+		t.Error("Render of an unknown template succeeded")
+	}
+}
+
+func TestEncodeWithAttachment(t *testing.T) {
+	msg := &Message{
+		To:          []string{"Ann <ann@example.com>"},
+		Subject:     "Tickets für dich",
+		Text:        "plain",
+		HTML:        "<p>rich</p>",
+		Attachments: []Attachment{{Filename: "t.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte{1}, 200)}},
+	}
+	rcpt, data, err := encode("Naevis <noreply@naevis.test>", msg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rcpt) != 1 || rcpt[0] != "ann@example.com" {
+		t.Errorf("envelope recipients = %v", rcpt)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subj, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subj != msg.Subject {
+		t.Errorf("Subject = %q", subj)
+	}
+	_, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, strings.SplitN(p.Header.Get("Content-Type"), ";", 2)[0])
+		if p.FileName() == "t.pdf" && p.Header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Error("attachment is not base64 encoded")
+		}
+	}
+	if strings.Join(types, ",") != "multipart/alternative,application/pdf" {
+		t.Errorf("parts = %v", types)
+	}
+
+	if _, _, err := encode("noreply@naevis.test", &Message{To: []string{"not an address"}}, time.Now()); !permanent(err) {
+		t.Errorf("bad recipient: err = %v, want a permanent error", err)
+	}
+}
+
+func TestMaildir(t *testing.T) {
+	dir := t.TempDir()
+	m := maildirMailer{dir: dir}
+	if err := m.Send(context.Background(), "noreply@naevis.test", &Message{To: []string{"ann@example.com"}, Subject: "hi", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if len(files) != 1 {
+		t.Fatalf("new/ holds %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !bytes.Contains(data, []byte("Subject: hi")) {
+		t.Errorf("message = %s", data)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "tmp", "*")); len(tmp) != 0 {
+		t.Errorf("tmp/ not empty: %v", tmp)
+	}
+}
+
+func TestSMTPStalledServer(t *testing.T) {
+	// The server accepts the connection but never sends its greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	defer func() {
+		if conn := <-accepted; conn != nil {
+			conn.Close()
+		}
+	}()
+	defer ln.Close()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m := smtpMailer{cfg: config.SMTP{Host: host, Port: port}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Send(ctx, "noreply@naevis.test", &Message{To: []string{"ann@example.com"}, Subject: "hi", Text: "hello"})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Send = %v, want a deadline error", err)
+		}
+		if permanent(err) {
+			t.Errorf("a stalled server is reported as permanent: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send is still blocked on a server that never replies")
+	}
+}
+
+// recorder is a Mailer that keeps what it is given.
+type recorder struct {
+	mu   sync.Mutex
+	sent []*Message
+}
+
+func (r *recorder) Send(_ context.Context, _ string, msg *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func TestQueueDeliversThroughWorker(t *testing.T) {
+	db.Use(memdb.NewStore())
+	client := memredis.NewClient()
+	rdx.Use(client)
+	defer client.Close()
+	rec := &recorder{}
+	Use(rec)
+	defer Use(logMailer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mq.StartOutboxRelay(ctx)
+	go StartWorker(ctx)
+
+	pdf := Attachment{Filename: "t.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}
+	if err := Queue(ctx, "ann@example.com", "otp", map[string]any{"Code": "42", "ExpiresIn": "5 minutes"}, pdf); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec.mu.Lock()
+		n := len(rec.sent)
+		rec.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.sent) != 1 {
+		t.Fatalf("delivered %d messages, want 1", len(rec.sent))
+	}
+	got := rec.sent[0]
+	if got.To[0] != "ann@example.com" || !strings.Contains(got.Text, "42") || len(got.Attachments) != 1 || string(got.Attachments[0].Data) != "%PDF" {
+		t.Errorf("delivered %+v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// encode renders msg as an RFC 5322 message from sender. It returns the
+// bare recipient addresses for the SMTP envelope along with the bytes.
+func encode(from string, msg *Message, now time.Time) ([]string, []byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: sender %q: %v", ErrInvalid, from, err)
+	}
+	if len(msg.To) == 0 {
+		return nil, nil, fmt.Errorf("%w: no recipients", ErrInvalid)
+	}
+	rcpt := make([]string, len(msg.To))
+	to := make([]string, len(msg.To))
+	for i, a := range msg.To {
+		addr, err := mail.ParseAddress(a)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: recipient %q: %v", ErrInvalid, a, err)
+		}
+		rcpt[i] = addr.Address
+		to[i] = addr.String()
+	}
+
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", sender.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(sender.Address))
+	header("MIME-Version", "1.0")
+
+	bodyHeader, body, err := encodeBody(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(msg.Attachments) == 0 {
+		writeHeader(&buf, bodyHeader)
+		buf.Write(body)
+		return rcpt, buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	buf.WriteString("\r\n")
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+	part.Write(body)
+	for _, a := range msg.Attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, nil, err
+	}
+	return rcpt, buf.Bytes(), nil
+}
+
+// encodeBody returns the headers and content of the message body: the
+// text alone, or text and HTML as alternatives.
+func encodeBody(msg *Message) (textproto.MIMEHeader, []byte, error) {
+	if msg.HTML == "" {
+		return textHeader("text/plain"), quotedPrintable(msg.Text), nil
+	}
+	var buf bytes.Buffer
+	alt := multipart.NewWriter(&buf)
+	for _, p := range []struct{ typ, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		part, err := alt.CreatePart(textHeader(p.typ))
+		if err != nil {
+			return nil, nil, err
+		}
+		part.Write(quotedPrintable(p.body))
+	}
+	if err := alt.Close(); err != nil {
+		return nil, nil, err
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "multipart/alternative; boundary="+alt.Boundary())
+	return h, buf.Bytes(), nil
+}
+
+func textHeader(typ string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", typ+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return h
+}
+
+func quotedPrintable(s string) []byte {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(s))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// writeHeader ends the message headers with h.
+func writeHeader(w io.Writer, h textproto.MIMEHeader) {
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := h.Get(k); v != "" {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	io.WriteString(w, "\r\n")
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	typ := a.ContentType
+	if typ == "" {
+		typ = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(typ, map[string]string{"name": a.Filename}))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	// Wrap base64 at 76 characters as RFC 2045 requires.
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		if _, err := io.WriteString(part, enc[:76]+"\r\n"); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(part, enc+"\r\n")
+	return err
+}
+
+func messageID(sender string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if _, d, ok := strings.Cut(sender, "@"); ok {
+		domain = d
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each message type is a pair of files in templates/: name.txt holds a
+// "subject" block and the plain-text body, which every message has;
+// name.html, when present, is the HTML body rendered inside layout.html.
+//
+//go:embed templates
+var templateFS embed.FS
+
+type template struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template // nil: text only
+}
+
+var templates = loadTemplates()
+
+func loadTemplates() map[string]template {
+	out := map[string]template{}
+	files, _ := fs.Glob(templateFS, "templates/*.txt")
+	for _, f := range files {
+		name := strings.TrimSuffix(path.Base(f), ".txt")
+		t := template{text: texttemplate.Must(texttemplate.ParseFS(templateFS, f))}
+		html := "templates/" + name + ".html"
+		if _, err := fs.Stat(templateFS, html); err == nil {
+			t.html = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/layout.html", html))
+		}
+		out[name] = t
+	}
+	return out
+}
+
+// Render executes template name with data.
+func Render(name string, data any) (*Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("mail: no template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("mail: render %s subject: %w", name, err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("mail: render %s text: %w", name, err)
+	}
+	msg := &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+	if t.html != nil {
+		if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+			return nil, fmt.Errorf("mail: render %s html: %w", name, err)
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
@@ -2,21 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"naevis/apierr"
+	"naevis/auth"
+	"naevis/config"
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/gateway"
+	"naevis/globals"
+	"naevis/jwtkeys"
+	"naevis/logx"
+	"naevis/mail"
+	"naevis/metrics"
 	"naevis/middleware"
+	"naevis/migrations"
 	"naevis/mq"
 	"naevis/ratelim"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
 	"naevis/routes"
+	"naevis/sessions"
+	"naevis/tickets"
 
-	"github.com/joho/godotenv"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
 )
@@ -29,45 +47,137 @@ func Index(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // setupRouter builds the router with all API routes except chat.
 func setupRouter(rateLimiter *ratelim.RateLimiter) *httprouter.Router {
 	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, http.StatusNotFound, "No route for "+r.URL.Path)
+	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, http.StatusMethodNotAllowed, r.Method+" is not allowed here")
+	})
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, v any) {
+		slog.ErrorContext(r.Context(), "handler panic", "panic", v, "path", r.URL.Path)
+		apierr.Write(w, apierr.Internal(fmt.Errorf("panic: %v", v)))
+	}
 	router.GET("/health", Index)
+	router.GET("/health/ready", Ready)
+	router.Handler(http.MethodGet, "/metrics", metrics.Handler())
 	routes.RoutesWrapper(router, rateLimiter)
 	return router
 }
 
-func parseAllowedOrigins(env string) []string {
-	if env == "" {
-		return []string{"http://localhost:5173", "https://indium.netlify.app"}
-	}
-	parts := strings.Split(env, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, p)
+// runMigrations handles the -migrate flag and reports whether the process
+// should exit instead of serving.
+func runMigrations(mode string) (exit bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch mode {
+	case "off":
+		return false
+	case "status":
+		statuses, err := migrations.StatusOf(ctx, migrations.All)
+		if err != nil {
+			log.Fatalf("❌ migration status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-60s %s\n", st.Version, st.Name, state)
 		}
+		return true
+	case "dry-run":
+		pending, err := migrations.Up(ctx, migrations.All, true)
+		if err != nil {
+			log.Fatalf("❌ migration dry-run: %v", err)
+		}
+		if len(pending) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		for _, m := range pending {
+			fmt.Printf("would apply %4d  %s\n", m.Version, m.Name)
+		}
+		return true
+	case "auto", "only":
+		applied, err := migrations.Up(ctx, migrations.All, false)
+		if errors.Is(err, migrations.ErrLocked) && mode == "auto" {
+			log.Println("⚠️ Migrations are running on another instance; continuing")
+			return false
+		}
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		log.Printf("✅ Migrations up to date (%d applied)", len(applied))
+		return mode == "only"
+	default:
+		log.Fatalf("❌ unknown -migrate mode %q", mode)
+		return true
 	}
-	return out
+}
+
+// openStores connects MongoDB and Redis, or binds the in-memory stand-ins
+// when cfg.Storage is memory, and returns the bound Store.
+func openStores(ctx context.Context, cfg *config.Config) (*db.Store, error) {
+	if cfg.Storage == config.StorageMemory {
+		log.Println("⚠️ Using in-memory MongoDB and Redis; data is lost on exit")
+		store := memdb.NewStore()
+		db.Use(store)
+		rdx.Use(memredis.NewClient())
+		return store, nil
+	}
+
+	store, err := db.Connect(ctx, cfg.Mongo)
+	if err != nil {
+		return nil, err
+	}
+	db.Use(store)
+	if err := rdx.Open(ctx, cfg.Redis); err != nil {
+		return nil, err
+	}
+	return store, nil
 }
 
 func main() {
-	// load .env if present
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found; using system environment")
+	migrateMode := flag.String("migrate", "auto",
+		"schema migrations: auto (apply, then serve), status or dry-run (print and exit), only (apply and exit), off")
+	memMode := flag.Bool("mem", false, "use in-memory MongoDB and Redis stand-ins (same as STORAGE=memory); data is lost on exit")
+	flag.Parse()
+	if *memMode {
+		os.Setenv("STORAGE", config.StorageMemory)
 	}
 
-	// read port
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = ":4000"
-	} else if port[0] != ':' {
-		port = ":" + port
+	// load and validate configuration from env, .env and CONFIG_FILE
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
+	logx.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	globals.Configure(cfg)
+	if err := jwtkeys.Configure(cfg); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	auth.Configure(cfg)
+	middleware.Configure(cfg)
+	sessions.Configure(cfg)
+	tickets.Configure(cfg)
+	mq.Configure(cfg)
+	mail.Configure(cfg)
+	gateway.Configure(cfg)
 
-	// parse allowed origins
-	allowedOrigins := parseAllowedOrigins(os.Getenv("ALLOWED_ORIGINS"))
+	// connect backing stores; they are closed in reverse order on shutdown
+	connectCtx, cancelConnect := context.WithTimeout(context.Background(), 15*time.Second)
+	store, err := openStores(connectCtx, cfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	cancelConnect()
+
+	if runMigrations(*migrateMode) {
+		return
+	}
 
 	// initialize rate limiter
-	rateLimiter := ratelim.NewRateLimiter(1, 6, 10*time.Minute, 10000)
+	rateLimiter := ratelim.NewRateLimiter(cfg.RateLimit)
 
 	// initialize chat hub
 
@@ -75,20 +185,23 @@ func main() {
 	router := setupRouter(rateLimiter)
 	routes.AddStaticRoutes(router)
 
-	// Middleware chain: Logging + SecurityHeaders -> router
-	innerHandler := middleware.LoggingMiddleware(middleware.SecurityHeaders(router))
+	// Middleware chain: RequestID -> Logging -> SecurityHeaders -> router
+	innerHandler := middleware.RequestID(
+		middleware.LoggingMiddleware(router, middleware.SecurityHeaders(router)),
+	)
 
 	// CORS must be applied outermost when using credentials
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   allowedOrigins,
+		AllowedOrigins:   cfg.AllowedOrigins,
 		AllowedMethods:   []string{"HEAD", "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key", "X-Requested-With"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key", "X-Requested-With", middleware.RequestIDHeader},
+		ExposedHeaders:   []string{middleware.RequestIDHeader},
 		AllowCredentials: true,
 	}).Handler(innerHandler)
 
 	// create API HTTP server
 	server := &http.Server{
-		Addr:              port,
+		Addr:              cfg.Port,
 		Handler:           corsHandler,
 		ReadTimeout:       7 * time.Second,
 		WriteTimeout:      15 * time.Second,
@@ -96,9 +209,18 @@ func main() {
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 
-	// start workers
-	go mq.StartIndexingWorker()
-	go mq.StartHashtagWorker()
+	// start workers; they stop when workerCtx is cancelled during shutdown
+	registerJobs()
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	for _, run := range backgroundWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
 
 	// // start static server
 	// startStaticServer()
@@ -110,7 +232,7 @@ func main() {
 
 	// start API server
 	go func() {
-		log.Printf("🚀 API server listening on %s", port)
+		log.Printf("🚀 API server listening on %s", cfg.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("❌ API ListenAndServe error: %v", err)
 		}
@@ -125,8 +247,21 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// 1. stop accepting requests and drain in-flight ones
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("❌ Graceful shutdown failed: %v", err)
+		log.Printf("❌ Graceful shutdown failed: %v", err)
+	}
+
+	// 2. stop workers and wait for their current message to finish
+	stopWorkers()
+	workers.Wait()
+
+	// 3. close connections last, now that nothing uses them
+	if err := rdx.Close(); err != nil {
+		log.Printf("⚠️ Redis close: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		log.Printf("⚠️ MongoDB disconnect: %v", err)
 	}
 
 	log.Println("✅ API server stopped cleanly")
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"sync"
 
+	"naevis/apierr"
+
 	// adjust to real import path for your rate limiter
 
 	"github.com/julienschmidt/httprouter"
@@ -111,7 +113,7 @@ func GetMapConfig(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	entity := ps.ByName("entity")
 	cfg, ok := mapConfigs[entity]
 	if !ok {
-		http.Error(w, "entity not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "entity not found")
 		return
 	}
 
@@ -149,7 +151,7 @@ func GetMapMarkers(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	entity := ps.ByName("entity")
 	markers, ok := mapMarkers[entity]
 	if !ok {
-		http.Error(w, "entity not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "entity not found")
 		return
 	}
 	writeJSON(w, markers)
@@ -159,7 +161,7 @@ func GetMapMarkers(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 // POST /api/v1/player/progress?entity=ls
 func UpdatePlayerProgress(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierr.Respond(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -170,7 +172,7 @@ func UpdatePlayerProgress(w http.ResponseWriter, r *http.Request, _ httprouter.P
 	}
 	// validate entity exists
 	if _, ok := mapConfigs[entity]; !ok {
-		http.Error(w, "entity not found", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "entity not found")
 		return
 	}
 
@@ -193,7 +195,7 @@ func GetPlayerProgress(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 
 	if entity != "" {
 		if _, ok := playerMissionsCompleted[entity]; !ok {
-			http.Error(w, "entity not found", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "entity not found")
 			return
 		}
 		writeJSON(w, map[string]interface{}{"entity": entity, "missionsCompleted": playerMissionsCompleted[entity]})
@@ -1,7 +1,9 @@
 package media
 
 import (
+	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -22,7 +24,7 @@ func EditMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok || requestingUserID == "" {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -33,7 +35,7 @@ func EditMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		Tags        []string `json:"tags,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
 		return
 	}
 
@@ -46,16 +48,16 @@ func EditMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}).Decode(&media)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Media not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Media not found")
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
 	// Authorization: only creator can edit
 	if media.CreatorID != requestingUserID {
-		http.Error(w, "Not authorized to edit this media", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Not authorized to edit this media")
 		return
 	}
 
@@ -76,9 +78,21 @@ func EditMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Apply update to all media in the same group
 	filter := bson.M{"mediaGroupId": media.MediaGroupID}
-	_, err = db.MediaCollection.UpdateMany(ctx, filter, bson.M{"$set": update})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.MediaCollection.UpdateMany(ctx, filter, bson.M{"$set": update}); err != nil {
+			return err
+		}
+		// Emit MQ event for the group
+		return mq.Emit(ctx, "media-edited", models.Index{
+			EntityType: "media",
+			EntityId:   media.MediaGroupID,
+			Method:     "PUT",
+			ItemType:   entityType,
+			ItemId:     entityID,
+		})
+	})
 	if err != nil {
-		http.Error(w, "Failed to update media group", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update media group")
 		return
 	}
 
@@ -88,15 +102,6 @@ func EditMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// 	_ = rdx.RdxDel(cacheKey)
 	// }
 
-	// Emit MQ event for the group
-	go mq.Emit(ctx, "media-edited", models.Index{
-		EntityType: "media",
-		EntityId:   media.MediaGroupID,
-		Method:     "PUT",
-		ItemType:   entityType,
-		ItemId:     entityID,
-	})
-
 	// Return updated media group
 	var updatedMedias []models.Media
 	cur, err := db.MediaCollection.Find(ctx, bson.M{"mediaGroupId": media.MediaGroupID})
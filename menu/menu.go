@@ -3,7 +3,9 @@ package menu
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/mq"
@@ -14,6 +16,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -21,7 +24,7 @@ func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	placeID := ps.ByName("placeid")
 
 	if placeID == "" {
-		http.Error(w, "Place ID is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Place ID is required")
 		return
 	}
 
@@ -33,20 +36,20 @@ func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
 		return
 	}
 
 	if len(body.Name) == 0 || len(body.Name) > 100 {
-		http.Error(w, "Name must be between 1 and 100 characters.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Name must be between 1 and 100 characters.")
 		return
 	}
 	if body.Price < 0 {
-		http.Error(w, "Invalid price value. Must be a non-negative number.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid price value. Must be a non-negative number.")
 		return
 	}
 	if body.Stock < 0 {
-		http.Error(w, "Invalid stock value. Must be a non-negative integer.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid stock value. Must be a non-negative integer.")
 		return
 	}
 
@@ -63,15 +66,19 @@ func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		UpdatedAt: time.Now(),
 	}
 
-	if _, err := db.MenuCollection.InsertOne(ctx, menu); err != nil {
-		http.Error(w, "Failed to insert menu: "+err.Error(), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.MenuCollection.InsertOne(ctx, menu); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "menu-created", models.Index{
+			EntityType: "menu", EntityId: menu.MenuID, Method: "POST", ItemType: "place", ItemId: placeID,
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to insert menu: "+err.Error())
 		return
 	}
 
-	go mq.Emit(ctx, "menu-created", models.Index{
-		EntityType: "menu", EntityId: menu.MenuID, Method: "POST", ItemType: "place", ItemId: placeID,
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"ok":      true,
@@ -99,7 +106,7 @@ func GetMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var menu models.Menu
 	err = db.MenuCollection.FindOne(context.TODO(), bson.M{"placeid": placeID, "menuid": menuID}).Decode(&menu)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Menu not found: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Menu not found: %v", err))
 		return
 	}
 
@@ -120,7 +127,7 @@ func GetMenus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	filter := bson.M{"placeid": ps.ByName("placeid")}
 	menus, err := utils.FindAndDecode[models.Menu](ctx, db.MenuCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch menus")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch menus")
 		return
 	}
 	if len(menus) == 0 {
@@ -139,13 +146,13 @@ func EditMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Parse the request body
 	var menu models.Menu
 	if err := json.NewDecoder(r.Body).Decode(&menu); err != nil {
-		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input data")
 		return
 	}
 
 	// Validate menu data
 	if menu.Name == "" || menu.Price <= 0 || menu.Stock < 0 {
-		http.Error(w, "Invalid menu data: Name, Price, and Stock are required.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid menu data: Name, Price, and Stock are required.")
 		return
 	}
 
@@ -163,28 +170,33 @@ func EditMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Update the menu in MongoDB
 	// collection := client.Database("placedb").Collection("menu")
-	updateResult, err := db.MenuCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"placeid": placeID, "menuid": menuID},
-		bson.M{"$set": updateFields},
-	)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update menu: %v", err), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		updateResult, err := db.MenuCollection.UpdateOne(
+			ctx,
+			bson.M{"placeid": placeID, "menuid": menuID},
+			bson.M{"$set": updateFields},
+		)
+		if err != nil {
+			return err
+		}
+		if updateResult.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		m := models.Index{EntityType: "menu", EntityId: menuID, Method: "PUT", ItemType: "place", ItemId: placeID}
+		return mq.Emit(ctx, "menu-edited", m)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Menu not found")
 		return
 	}
-
-	// Check if update was successful
-	if updateResult.MatchedCount == 0 {
-		http.Error(w, "Menu not found", http.StatusNotFound)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update menu: %v", err))
 		return
 	}
 
 	// Invalidate the specific menu cache
 	rdx.RdxDel(fmt.Sprintf("menu:%s:%s", placeID, menuID))
 
-	m := models.Index{EntityType: "menu", EntityId: menuID, Method: "PUT", ItemType: "place", ItemId: placeID}
-	go mq.Emit(ctx, "menu-edited", m)
-
 	// Send response
 	// w.Header().Set("Content-Type", "application/json")
 	// w.WriteHeader(http.StatusOK)
@@ -206,24 +218,29 @@ func DeleteMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Delete the menu from MongoDB
 	// collection := client.Database("placedb").Collection("menu")
-	deleteResult, err := db.MenuCollection.DeleteOne(context.TODO(), bson.M{"placeid": placeID, "menuid": menuID})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete menu: %v", err), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		deleteResult, err := db.MenuCollection.DeleteOne(ctx, bson.M{"placeid": placeID, "menuid": menuID})
+		if err != nil {
+			return err
+		}
+		if deleteResult.DeletedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		m := models.Index{EntityType: "menu", EntityId: menuID, Method: "DELETE", ItemType: "place", ItemId: placeID}
+		return mq.Emit(ctx, "menu-deleted", m)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Menu not found")
 		return
 	}
-
-	// Check if delete was successful
-	if deleteResult.DeletedCount == 0 {
-		http.Error(w, "Menu not found", http.StatusNotFound)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete menu: %v", err))
 		return
 	}
 
 	// Invalidate the cache
 	rdx.RdxDel(fmt.Sprintf("menu:%s:%s", placeID, menuID))
 
-	m := models.Index{EntityType: "menu", EntityId: menuID, Method: "DELETE", ItemType: "place", ItemId: placeID}
-	go mq.Emit(ctx, "menu-deleted", m)
-
 	// // Send response
 	// w.WriteHeader(http.StatusOK)
 	// w.Write([]byte("Menu deleted successfully"))
@@ -3,19 +3,23 @@ package menu
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
+	"naevis/gateway"
 	"naevis/models"
-	"naevis/mq"
-	"naevis/stripe"
+	"naevis/money"
 	"naevis/tickets"
 	"naevis/userdata"
+	"naevis/utils"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // POST /menu/event/:placeId/:menuId/payment-session
@@ -28,24 +32,55 @@ func CreateMenuPaymentSession(w http.ResponseWriter, r *http.Request, ps httprou
 		Stock int `json:"quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Stock < 1 {
-		http.Error(w, "Invalid request or stock", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or stock")
 		return
 	}
 
-	// Generate a Stripe payment session
-	session, err := stripe.CreateMenuSession(menuId, placeId, body.Stock)
+	var menu models.Menu
+	err := db.MenuCollection.FindOne(r.Context(), bson.M{"placeid": placeId, "menuid": menuId}).Decode(&menu)
 	if err != nil {
-		log.Printf("Error creating payment session: %v", err)
-		http.Error(w, "Failed to create payment session", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusNotFound, "Menu not found")
+		return
+	}
+	if menu.Stock < body.Stock {
+		apierr.Respond(w, http.StatusBadRequest, "Not enough menu available for purchase")
+		return
+	}
+
+	// Menu prices are still kept in rupees as floats
+	price, err := money.FromFloat(menu.Price, money.Default)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Invalid menu price")
+		return
+	}
+	amount, err := price.Mul(int64(body.Stock))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or stock")
+		return
+	}
+
+	// Open a checkout; the order is taken when the provider confirms payment
+	checkout, session, err := gateway.Start(r.Context(), utils.GetUserIDFromRequest(r), gateway.Item{
+		Kind:        gateway.KindMenu,
+		EntityType:  "place",
+		EntityID:    placeId,
+		ItemID:      menuId,
+		Quantity:    body.Stock,
+		Amount:      amount,
+		Description: fmt.Sprintf("%d × %s", body.Stock, menu.Name),
+	})
+	if err != nil {
+		gateway.RespondStartError(w, r, err)
 		return
 	}
 
 	// Respond with the session URL
 	dataResponse := map[string]any{
 		"paymentUrl": session.URL,
-		"placeid":    session.PlaceID,
-		"menuid":     session.MenuID,
-		"stock":      session.Stock,
+		"checkoutId": checkout.ID,
+		"placeid":    placeId,
+		"menuid":     menuId,
+		"stock":      body.Stock,
 	}
 
 	// Respond with the session URL
@@ -74,129 +109,47 @@ func BroadcastMenuUpdate(placeId, menuId string, remainingMenus int) {
 	}
 }
 
-// MenuPurchaseRequest represents the request body for purchasing menus
-type MenuPurchaseRequest struct {
-	MenuID  string `json:"menuId"`
-	PlaceId string `json:"placeId"`
-	Stock   int    `json:"quantity"`
-}
-
-// MenuPurchaseResponse represents the response body for menu purchase confirmation
-type MenuPurchaseResponse struct {
-	Message string `json:"message"`
-	Success bool   `json:"success"`
-}
-
-// ProcessMenuPayment simulates the payment processing logic
-func ProcessMenuPayment(menuID, placeId string, stock int) bool {
-	// Implement actual payment processing logic (e.g., calling a payment gateway)
-	// For the sake of this example, we'll assume payment is always successful.
-	log.Printf("Processing payment for MenuID: %s, PlaceId: %s, Stock: %d", menuID, placeId, stock)
-	return true
-}
-
-// UpdateMenuStatus simulates updating the menu status in the database
-func UpdateMenuStatus(menuID, placeId string, stock int) error {
-	// Implement actual logic to update menu status in the database
-	log.Printf("Updating menu status for MenuID: %s, PlaceId: %s, Stock: %d", menuID, placeId, stock)
-	return nil
-}
-
-// ConfirmPurchase handles the POST request for confirming the menu purchase
-func ConfirmMenuPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var request MenuPurchaseRequest
-	// Parse the incoming JSON request
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+// ConfirmMenuPurchase reports whether the caller's menu checkout has been
+// paid. Stock is only taken by FulfilCheckout once the payment provider's
+// webhook confirms the payment.
+func ConfirmMenuPurchase(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request struct {
+		CheckoutID string `json:"checkoutId"`
 	}
-
-	// Retrieve the ID of the requesting user from the context
-	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CheckoutID == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	gateway.Confirm(w, r, gateway.KindMenu, request.CheckoutID)
+}
 
-	request.PlaceId = ps.ByName("placeid")
-	request.MenuID = ps.ByName("menuid")
-
-	fmt.Println(request)
-	// Process the payment
-	paymentProcessed := ProcessMenuPayment(request.MenuID, request.PlaceId, request.Stock)
-
-	if paymentProcessed {
-		// Update the menu status in the database
-		err = UpdateMenuStatus(request.MenuID, request.PlaceId, request.Stock)
+// FulfilCheckout takes the menu items of a paid checkout out of stock and
+// records them for the buyer.
+func FulfilCheckout(ctx context.Context, c *models.Checkout, done func(context.Context, models.Meta) error) error {
+	var menu models.Menu
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		err := db.MenuCollection.FindOneAndUpdate(ctx,
+			bson.M{"placeid": c.EntityID, "menuid": c.ItemID, "stock": bson.M{"$gte": c.Quantity}},
+			bson.M{
+				"$inc": bson.M{"stock": -c.Quantity},
+				"$set": bson.M{"updated_at": time.Now()},
+			},
+		).Decode(&menu)
 		if err != nil {
-			http.Error(w, "Failed to update menu status", http.StatusInternalServerError)
-			return
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("%w: not enough of menu %s left", gateway.ErrUnavailable, c.ItemID)
+			}
+			return err
 		}
-
-		// // Respond with a success message
-		// response := MenuPurchaseResponse{
-		// 	Message: "Payment successfully processed. Menu purchased.",
-		// }
-		// w.Header().Set("Content-Type", "application/json")
-		// w.WriteHeader(http.StatusOK)
-		// json.NewEncoder(w).Encode(response)
-		buyxMenu(w, request, requestingUserID)
-	} else {
-		// If payment failed, respond with a failure message
-		http.Error(w, "Payment failed", http.StatusBadRequest)
-	}
-}
-
-// Buy Menu
-
-func buyxMenu(w http.ResponseWriter, request MenuPurchaseRequest, requestingUserID string) {
-	placeId := request.PlaceId
-	menuID := request.MenuID
-	stockRequested := request.Stock
-
-	// Find the menu in the database
-	// collection := client.Database("eventdb").Collection("menu")
-	var menu models.Menu // Define the Menu struct based on your schema
-	err := db.MenuCollection.FindOne(context.TODO(), bson.M{"placeid": placeId, "menuid": menuID}).Decode(&menu)
-	if err != nil {
-		http.Error(w, "Menu not found or other error", http.StatusNotFound)
-		return
-	}
-
-	// Check if there are enough menu available for purchase
-	if menu.Stock < stockRequested {
-		http.Error(w, "Not enough menu available for purchase", http.StatusBadRequest)
-		return
-	}
-
-	// Decrease the menu stock by the requested quantity
-	update := bson.M{"$inc": bson.M{"stock": -stockRequested}}
-	_, err = db.MenuCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeId, "menuid": menuID}, update)
+		if err := userdata.SetUserDataTx(ctx, "menu", c.ItemID, c.UserID, "place", c.EntityID); err != nil {
+			return err
+		}
+		return done(ctx, models.Meta{"quantityBought": c.Quantity, "remainingStock": menu.Stock - c.Quantity})
+	})
 	if err != nil {
-		http.Error(w, "Failed to update menu stock", http.StatusInternalServerError)
-		return
-	}
-
-	userdata.SetUserData("menu", menuID, requestingUserID, "place", placeId)
-
-	m := models.Index{}
-	mq.Notify("menu-bought", m)
-
-	// Respond with a success message
-	response := MenuPurchaseResponse{
-		Message: "Payment successfully processed. Menu purchased.",
-		Success: true,
+		return err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
 
-	// // Respond with success
-	// w.Header().Set("Content-Type", "application/json")
-	// w.WriteHeader(http.StatusOK)
-	// json.NewEncoder(w).Encode(map[string]any{
-	// 	"success": true,
-	// 	"message": fmt.Sprintf("Successfully purchased %d of %s", stockRequested, menu.Name),
-	// })
+	BroadcastMenuUpdate(c.EntityID, c.ItemID, menu.Stock-c.Quantity)
+	return nil
 }
@@ -2,6 +2,7 @@ package merch
 
 import (
 	"context"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -30,7 +31,7 @@ func GetMerchs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	filter := bson.M{"entity_type": entityType, "entity_id": eventID}
 	merchList, err := utils.FindAndDecode[models.Merch](ctx, db.MerchCollection, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch merchandise")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch merchandise")
 		return
 	}
 
@@ -3,19 +3,20 @@ package merch
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
 	"naevis/models"
 	"naevis/mq"
 	"naevis/rdx"
-	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func CreateMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -24,7 +25,7 @@ func CreateMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	entityType := ps.ByName("entityType")
 
 	if eventID == "" {
-		http.Error(w, "Event ID is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Event ID is required")
 		return
 	}
 
@@ -36,20 +37,20 @@ func CreateMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
 		return
 	}
 
 	if len(body.Name) == 0 || len(body.Name) > 100 {
-		http.Error(w, "Name must be between 1 and 100 characters.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Name must be between 1 and 100 characters.")
 		return
 	}
 	if body.Price <= 0 {
-		http.Error(w, "Invalid price value. Must be a positive number.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid price value. Must be a positive number.")
 		return
 	}
 	if body.Stock < 0 {
-		http.Error(w, "Invalid stock value. Must be a non-negative integer.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid stock value. Must be a non-negative integer.")
 		return
 	}
 
@@ -67,15 +68,19 @@ func CreateMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		UpdatedAt:  time.Now(),
 	}
 
-	if _, err := db.MerchCollection.InsertOne(ctx, merch); err != nil {
-		http.Error(w, "Failed to insert merchandise: "+err.Error(), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.MerchCollection.InsertOne(ctx, merch); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "merch-created", models.Index{
+			EntityType: "merch", EntityId: merch.MerchID, Method: "POST", ItemType: "event", ItemId: eventID,
+		})
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to insert merchandise: "+err.Error())
 		return
 	}
 
-	go mq.Emit(ctx, "merch-created", models.Index{
-		EntityType: "merch", EntityId: merch.MerchID, Method: "POST", ItemType: "event", ItemId: eventID,
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"ok":      true,
@@ -147,13 +152,13 @@ func EditMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Parse the request body
 	var merch models.Merch
 	if err := json.NewDecoder(r.Body).Decode(&merch); err != nil {
-		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input data")
 		return
 	}
 
 	// Validate merch data
 	if merch.Name == "" || merch.Price <= 0 || merch.Stock < 0 {
-		http.Error(w, "Invalid merchandise data: Name, Price, and Stock are required.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid merchandise data: Name, Price, and Stock are required.")
 		return
 	}
 
@@ -171,28 +176,33 @@ func EditMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Update the merch in MongoDB
 	// collection := client.Database("eventdb").Collection("merch")
-	updateResult, err := db.MerchCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"entity_type": entityType, "entity_id": eventID, "merchid": merchID},
-		bson.M{"$set": updateFields},
-	)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update merchandise: %v", err), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		updateResult, err := db.MerchCollection.UpdateOne(
+			ctx,
+			bson.M{"entity_type": entityType, "entity_id": eventID, "merchid": merchID},
+			bson.M{"$set": updateFields},
+		)
+		if err != nil {
+			return err
+		}
+		if updateResult.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		m := models.Index{EntityType: "merch", EntityId: merchID, Method: "PUT", ItemType: entityType, ItemId: eventID}
+		return mq.Emit(ctx, "merch-edited", m)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Merchandise not found")
 		return
 	}
-
-	// Check if update was successful
-	if updateResult.MatchedCount == 0 {
-		http.Error(w, "Merchandise not found", http.StatusNotFound)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update merchandise: %v", err))
 		return
 	}
 
 	// Invalidate the specific merch cache
 	rdx.RdxDel(fmt.Sprintf("merch:%s:%s", eventID, merchID))
 
-	m := models.Index{EntityType: "merch", EntityId: merchID, Method: "PUT", ItemType: entityType, ItemId: eventID}
-	go mq.Emit(ctx, "merch-edited", m)
-
 	// Send response
 	// w.Header().Set("Content-Type", "application/json")
 	// w.WriteHeader(http.StatusOK)
@@ -215,24 +225,29 @@ func DeleteMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Delete the merch from MongoDB
 	// collection := client.Database("eventdb").Collection("merch")
-	deleteResult, err := db.MerchCollection.DeleteOne(context.TODO(), bson.M{"entity_type": entityType, "entity_id": eventID, "merchid": merchID})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete merchandise: %v", err), http.StatusInternalServerError)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		deleteResult, err := db.MerchCollection.DeleteOne(ctx, bson.M{"entity_type": entityType, "entity_id": eventID, "merchid": merchID})
+		if err != nil {
+			return err
+		}
+		if deleteResult.DeletedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		m := models.Index{EntityType: "merch", EntityId: merchID, Method: "DELETE", ItemType: "event", ItemId: eventID}
+		return mq.Emit(ctx, "merch-deleted", m)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Merchandise not found")
 		return
 	}
-
-	// Check if delete was successful
-	if deleteResult.DeletedCount == 0 {
-		http.Error(w, "Merchandise not found", http.StatusNotFound)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete merchandise: %v", err))
 		return
 	}
 
 	// Invalidate the cache
 	rdx.RdxDel(fmt.Sprintf("merch:%s:%s", eventID, merchID))
 
-	m := models.Index{EntityType: "merch", EntityId: merchID, Method: "DELETE", ItemType: "event", ItemId: eventID}
-	go mq.Emit(ctx, "merch-deleted", m)
-
 	// // Send response
 	// w.WriteHeader(http.StatusOK)
 	// w.Write([]byte("Merchandise deleted successfully"))
@@ -243,61 +258,3 @@ func DeleteMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		"message": "Merch updated successfully",
 	})
 }
-
-func BuyMerch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	eventID := ps.ByName("eventid")
-	merchID := ps.ByName("merchid")
-
-	// Retrieve the ID of the requesting user from the context
-	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
-		return
-	}
-
-	// Parse the request body to extract quantity
-	var requestData struct {
-		Quantity int `json:"quantity"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestData)
-	if err != nil || requestData.Quantity <= 0 {
-		http.Error(w, "Invalid quantity", http.StatusBadRequest)
-		return
-	}
-
-	// Find the merch in the database
-	// collection := client.Database("eventdb").Collection("merch")
-	var merch models.Merch // Define the Merch struct based on your schema
-	err = db.MerchCollection.FindOne(context.TODO(), bson.M{"entity_id": eventID, "merchid": merchID}).Decode(&merch)
-	if err != nil {
-		http.Error(w, "Merch not found or other error", http.StatusNotFound)
-		return
-	}
-
-	// Check if there are enough merch available for purchase
-	if merch.Stock < requestData.Quantity {
-		http.Error(w, "Not enough merch available for purchase", http.StatusBadRequest)
-		return
-	}
-
-	// Decrease the merch stock by the requested quantity
-	update := bson.M{"$inc": bson.M{"stock": -requestData.Quantity}}
-	_, err = db.MerchCollection.UpdateOne(context.TODO(), bson.M{"eventid": eventID, "merchid": merchID}, update)
-	if err != nil {
-		http.Error(w, "Failed to update merch stock", http.StatusInternalServerError)
-		return
-	}
-
-	userdata.SetUserData("merch", merchID, requestingUserID, merch.EntityType, merch.EntityID)
-
-	m := models.Index{}
-	mq.Notify("merch-bought", m)
-
-	// Respond with success
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]any{
-		"success": true,
-		"message": fmt.Sprintf("Successfully purchased %d of %s", requestData.Quantity, merch.Name),
-	})
-}
@@ -3,17 +3,20 @@ package merch
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
+	"naevis/gateway"
 	"naevis/models"
-	"naevis/mq"
-	"naevis/stripe"
+	"naevis/money"
 	"naevis/userdata"
+	"naevis/utils"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // POST /merch/event/:eventId/:merchId/payment-session
@@ -26,23 +29,54 @@ func CreateMerchPaymentSession(w http.ResponseWriter, r *http.Request, ps httpro
 		Stock int `json:"quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Stock < 1 {
-		http.Error(w, "Invalid request or quantity", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or quantity")
 		return
 	}
 
-	// Generate a Stripe payment session
-	session, err := stripe.CreateMerchSession(merchId, eventId, body.Stock)
+	var merch models.Merch
+	err := db.MerchCollection.FindOne(r.Context(), bson.M{"entity_id": eventId, "merchid": merchId}).Decode(&merch)
+	if err != nil {
+		apierr.Respond(w, http.StatusNotFound, "Merch not found")
+		return
+	}
+	if merch.Stock < body.Stock {
+		apierr.Respond(w, http.StatusBadRequest, "Not enough merch available")
+		return
+	}
+
+	// Merch prices are still kept in rupees as floats
+	price, err := money.FromFloat(merch.Price, money.Default)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Invalid merch price")
+		return
+	}
+	amount, err := price.Mul(int64(body.Stock))
 	if err != nil {
-		log.Printf("Error creating payment session: %v", err)
-		http.Error(w, "Failed to create payment session", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or quantity")
+		return
+	}
+
+	// Open a checkout; the merch is handed out when the provider confirms payment
+	checkout, session, err := gateway.Start(r.Context(), utils.GetUserIDFromRequest(r), gateway.Item{
+		Kind:        gateway.KindMerch,
+		EntityType:  merch.EntityType,
+		EntityID:    eventId,
+		ItemID:      merchId,
+		Quantity:    body.Stock,
+		Amount:      amount,
+		Description: fmt.Sprintf("%d × %s", body.Stock, merch.Name),
+	})
+	if err != nil {
+		gateway.RespondStartError(w, r, err)
 		return
 	}
 
 	dataResponse := map[string]any{
 		"paymentUrl": session.URL,
-		"eventId":    session.EventID,
-		"merchId":    session.MerchID,
-		"quantity":   session.Stock,
+		"checkoutId": checkout.ID,
+		"eventId":    eventId,
+		"merchId":    merchId,
+		"quantity":   body.Stock,
 	}
 
 	response := map[string]any{
@@ -55,75 +89,40 @@ func CreateMerchPaymentSession(w http.ResponseWriter, r *http.Request, ps httpro
 }
 
 // POST /merch/event/:eventId/:merchId/confirm-purchase
-func ConfirmMerchPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+//
+// ConfirmMerchPurchase reports whether the caller's merch checkout has
+// been paid. Stock is only taken by FulfilCheckout once the payment
+// provider's webhook confirms the payment.
+func ConfirmMerchPurchase(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var request struct {
-		MerchID  string `json:"merchId"`
-		EventID  string `json:"eventId"`
-		Quantity int    `json:"quantity"`
+		CheckoutID string `json:"checkoutId"`
 	}
-
-	// Parse JSON body
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Quantity < 1 {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Override IDs from URL params to prevent manipulation
-	request.EventID = ps.ByName("eventid")
-	request.MerchID = ps.ByName("merchid")
-
-	// Retrieve requesting user ID from context
-	userID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok || userID == "" {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CheckoutID == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	gateway.Confirm(w, r, gateway.KindMerch, request.CheckoutID)
+}
 
-	// Fetch merch from DB
+// FulfilCheckout takes the merch of a paid checkout out of stock and
+// records it for the buyer.
+func FulfilCheckout(ctx context.Context, c *models.Checkout, done func(context.Context, models.Meta) error) error {
 	var merch models.Merch
-	err := db.MerchCollection.FindOne(context.TODO(), bson.M{
-		"entity_id": request.EventID,
-		"merchid":   request.MerchID,
-	}).Decode(&merch)
-	if err != nil {
-		http.Error(w, "Merch not found", http.StatusNotFound)
-		return
-	}
-
-	if merch.Stock < request.Quantity {
-		http.Error(w, "Not enough merch available", http.StatusBadRequest)
-		return
-	}
-
-	// Deduct the purchased quantity atomically
-	update := bson.M{"$inc": bson.M{"stock": -request.Quantity}}
-	_, err = db.MerchCollection.UpdateOne(context.TODO(), bson.M{
-		"entity_id": request.EventID,
-		"merchid":   request.MerchID,
-	}, update)
-	if err != nil {
-		http.Error(w, "Failed to update merch stock", http.StatusInternalServerError)
-		return
-	}
-
-	// Store user purchase data
-	userdata.SetUserData("merch", request.MerchID, userID, merch.EntityType, merch.EntityID)
-
-	// Notify other services
-	mq.Notify("merch-bought", models.Index{})
-
-	// Respond with JSON success
-	resp := map[string]any{
-		"success": true,
-		"data": map[string]any{
-			"message":        "Merch purchased successfully",
-			"merchId":        request.MerchID,
-			"eventId":        request.EventID,
-			"quantityBought": request.Quantity,
-			"remainingStock": merch.Stock - request.Quantity,
-		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		err := db.MerchCollection.FindOneAndUpdate(ctx,
+			bson.M{"entity_id": c.EntityID, "merchid": c.ItemID, "stock": bson.M{"$gte": c.Quantity}},
+			bson.M{"$inc": bson.M{"stock": -c.Quantity}},
+		).Decode(&merch)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("%w: not enough of merch %s left", gateway.ErrUnavailable, c.ItemID)
+			}
+			return err
+		}
+		if err := userdata.SetUserDataTx(ctx, "merch", c.ItemID, c.UserID, merch.EntityType, merch.EntityID); err != nil {
+			return err
+		}
+		return done(ctx, models.Meta{"quantityBought": c.Quantity, "remainingStock": merch.Stock - c.Quantity})
+	})
+	return err
 }
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"context"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/utils"
 	"net/http"
@@ -20,7 +21,7 @@ func GetUsersMeta(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	idsParam := r.URL.Query().Get("ids")
 	if idsParam == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing ids param")
+		apierr.Respond(w, http.StatusBadRequest, "Missing ids param")
 		return
 	}
 
@@ -38,7 +39,7 @@ func GetUsersMeta(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	cursor, err := db.UserCollection.Find(ctx, filter, findOptions)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "DB query failed")
+		apierr.Respond(w, http.StatusInternalServerError, "DB query failed")
 		return
 	}
 	defer cursor.Close(ctx)
@@ -0,0 +1,318 @@
+// Package metrics is a small Prometheus-compatible instrumentation library.
+// Metrics are registered once at package init by the packages that own
+// them and exposed in the text exposition format by Handler.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are latency buckets in seconds suitable for HTTP and database
+// operations.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is anything the registry can write out.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	regMu    sync.Mutex
+	registry = map[string]collector{}
+)
+
+func register(c collector) {
+	regMu.Lock()
+	defer regMu.Unlock()
+	if _, dup := registry[c.name()]; dup {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry[c.name()] = c
+}
+
+// Handler serves every registered metric in Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// WriteTo writes every registered metric, sorted by name.
+func WriteTo(w io.Writer) {
+	regMu.Lock()
+	cs := make([]collector, 0, len(registry))
+	for _, c := range registry {
+		cs = append(cs, c)
+	}
+	regMu.Unlock()
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// ---- label handling ----
+
+type desc struct {
+	fqName string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) name() string { return d.fqName }
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fqName, escapeHelp(d.help), d.fqName, d.kind)
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.fqName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs renders {a="x",b="y"} plus any extra pair (used for "le").
+func (d desc) labelPairs(values []string, extraName, extraValue string) string {
+	if len(d.labels) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(d.labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ---- counters and gauges ----
+
+// series is one label set's value, guarded by the owning vec's mutex.
+type series struct {
+	values []string
+	v      float64
+}
+
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{desc: desc{fqName: name, help: help, kind: kind, labels: labels}, series: map[string]*series{}}
+}
+
+func (v *vec) add(values []string, delta float64, set bool) {
+	k := v.key(values)
+	v.mu.Lock()
+	s, ok := v.series[k]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[k] = s
+	}
+	if set {
+		s.v = delta
+	} else {
+		s.v += delta
+	}
+	v.mu.Unlock()
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.fqName, v.labelPairs(s.values, "", ""), formatFloat(s.v))
+	}
+}
+
+// CounterVec is a monotonically increasing value per label set.
+type CounterVec struct{ v *vec }
+
+// NewCounterVec registers a counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	register(c.v)
+	return c
+}
+
+// Inc adds one to the series for values.
+func (c *CounterVec) Inc(values ...string) { c.v.add(values, 1, false) }
+
+// Add adds delta (which must not be negative) to the series for values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(values, delta, false)
+}
+
+// GaugeVec is a value that can go up and down per label set.
+type GaugeVec struct{ v *vec }
+
+// NewGaugeVec registers a gauge with the given label names.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	register(g.v)
+	return g
+}
+
+// Set sets the series for values.
+func (g *GaugeVec) Set(f float64, values ...string) { g.v.add(values, f, true) }
+
+// Inc adds one to the series for values.
+func (g *GaugeVec) Inc(values ...string) { g.v.add(values, 1, false) }
+
+// Dec subtracts one from the series for values.
+func (g *GaugeVec) Dec(values ...string) { g.v.add(values, -1, false) }
+
+// gaugeFunc samples a callback at scrape time.
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.fqName, formatFloat(g.fn()))
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on scrape.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&gaugeFunc{desc: desc{fqName: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// ---- histograms ----
+
+type histSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations into fixed buckets per label set.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histSeries
+}
+
+// NewHistogramVec registers a histogram. buckets must be sorted; nil means
+// DefBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{
+		desc:    desc{fqName: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  map[string]*histSeries{},
+	}
+	register(h)
+	return h
+}
+
+// Observe records v in the series for values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, h.labelPairs(s.values, "le", formatFloat(ub)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, h.labelPairs(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fqName, h.labelPairs(s.values, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fqName, h.labelPairs(s.values, "", ""), s.count)
+	}
+}
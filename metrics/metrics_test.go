@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.", "route")
+	c.Inc(`/a"b`)
+	c.Add(2, "/c")
+
+	h := NewHistogramVec("test_duration_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/c")
+	h.Observe(0.5, "/c")
+	h.Observe(3, "/c")
+
+	var b strings.Builder
+	WriteTo(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{route="/a\"b"} 1` + "\n",
+		`test_requests_total{route="/c"} 2` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{route="/c",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{route="/c",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{route="/c",le="+Inf"} 3` + "\n",
+		`test_duration_seconds_sum{route="/c"} 3.55` + "\n",
+		`test_duration_seconds_count{route="/c"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
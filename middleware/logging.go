@@ -1,17 +1,144 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"naevis/metrics"
+
+	"github.com/julienschmidt/httprouter"
 )
 
-// loggingMiddleware logs each request method, path, remote address, and duration.
-func LoggingMiddleware(next http.Handler) http.Handler {
+var httpDuration = metrics.NewHistogramVec("naevis_http_request_duration_seconds",
+	"HTTP request latency by route pattern and status code.", nil, "method", "route", "code")
+
+// requestLog collects fields that inner handlers learn about a request
+// (the authenticated user) so the outer logging middleware can report them.
+type requestLog struct {
+	userID string
+}
+
+type requestLogKey struct{}
+
+// setLogUser records the authenticated user for the access log line.
+func setLogUser(ctx context.Context, userID string) {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		rl.userID = userID
+	}
+}
+
+// LoggingMiddleware writes one structured access log line per request with
+// method, route pattern, status, duration and user. router is used to turn
+// the path back into its registered pattern; it may be nil.
+func LoggingMiddleware(router *httprouter.Router, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		duration := time.Since(start)
-		log.Printf("%s %s from %s – %v", r.Method, r.RequestURI, r.RemoteAddr, duration)
+		rl := &requestLog{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		route := RoutePattern(router, r.Method, r.URL.Path)
+		elapsed := time.Since(start)
+		httpDuration.Observe(elapsed.Seconds(), r.Method, route, strconv.Itoa(rec.status))
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(ctx, level, "http request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", elapsed),
+			slog.String("user_id", rl.userID),
+			slog.String("remote", r.RemoteAddr),
+		)
 	})
 }
+
+// RoutePattern returns the registered httprouter pattern that serves path,
+// e.g. "/api/v1/feed/post/:postid", or "unmatched" when nothing does. Using
+// the pattern instead of the raw path keeps log and metric labels bounded.
+func RoutePattern(router *httprouter.Router, method, path string) string {
+	if router == nil {
+		return path
+	}
+	handle, params, _ := router.Lookup(method, path)
+	if handle == nil {
+		return "unmatched"
+	}
+	if len(params) == 0 {
+		return path
+	}
+
+	segs := strings.Split(path, "/")
+	p := 0
+	for i := 1; i < len(segs) && p < len(params); i++ {
+		// A catch-all value starts with "/" and covers the rest of the path.
+		if strings.HasPrefix(params[p].Value, "/") && "/"+strings.Join(segs[i:], "/") == params[p].Value {
+			segs = append(segs[:i], "*"+params[p].Key)
+			break
+		}
+		if segs[i] == params[p].Value {
+			segs[i] = ":" + params[p].Key
+			p++
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// statusRecorder captures the response status and size. It passes through
+// Hijack and Flush so websockets and streaming keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	s.status = http.StatusSwitchingProtocols
+	s.wroteHeader = true
+	return h.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRoutePattern(t *testing.T) {
+	noop := func(http.ResponseWriter, *http.Request, httprouter.Params) {}
+	router := httprouter.New()
+	router.GET("/api/v1/feed/post/:postid", noop)
+	router.GET("/api/v1/reviews/:entityType/:entityId", noop)
+	router.GET("/static/*filepath", noop)
+	router.GET("/health", noop)
+
+	cases := []struct{ path, want string }{
+		{"/api/v1/feed/post/abc123", "/api/v1/feed/post/:postid"},
+		{"/api/v1/reviews/place/place", "/api/v1/reviews/:entityType/:entityId"},
+		{"/static/css/site.css", "/static/*filepath"},
+		{"/static/", "/static/*filepath"},
+		{"/health", "/health"},
+		{"/nope", "unmatched"},
+	}
+	for _, c := range cases {
+		if got := RoutePattern(router, http.MethodGet, c.path); got != c.want {
+			t.Errorf("RoutePattern(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
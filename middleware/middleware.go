@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"naevis/apierr"
 	"naevis/globals" // adjust this import to your actual path
+	"naevis/jwtkeys"
+	"naevis/sessions"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
@@ -17,10 +21,16 @@ type Claims struct {
 	Username string   `json:"username"`
 	UserID   string   `json:"userId"`
 	Role     []string `json:"role"`
+	// EmailVerified is the user's verification state when the token was
+	// issued; RequireVerified rechecks the database when it is false.
+	EmailVerified bool `json:"email_verified,omitempty"`
+	// MFA is set when the session logged in with a second factor.
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// Authenticate middleware verifies the JWT and stores UserID and Role in context
+// Authenticate middleware verifies the JWT and its session and stores
+// UserID, Role and the session ID in context
 func Authenticate(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if websocket.IsWebSocketUpgrade(r) {
@@ -30,22 +40,24 @@ func Authenticate(next httprouter.Handle) httprouter.Handle {
 
 		tokenString := r.Header.Get("Authorization")
 		if tokenString == "" || len(tokenString) < 8 || tokenString[:7] != "Bearer " {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-			return globals.JwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		ctx := r.Context()
+		claims, err := parseToken(ctx, tokenString[7:])
+		if errors.Is(err, errSessionCheck) {
+			apierr.Respond(w, http.StatusServiceUnavailable, "Unable to verify session")
+			return
+		}
+		if err != nil {
+			apierr.Respond(w, http.StatusUnauthorized, "Invalid token")
 			return
 		}
+		sessions.Touch(ctx, claims.ID)
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, globals.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, globals.RoleKey, claims.Role)
+		ctx = withClaims(ctx, claims)
+		setLogUser(ctx, claims.UserID)
 
 		next(w, r.WithContext(ctx), ps)
 	}
@@ -56,14 +68,9 @@ func OptionalAuth(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		tokenString := r.Header.Get("Authorization")
 		if len(tokenString) >= 8 && tokenString[:7] == "Bearer " {
-			claims := &Claims{}
-			token, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-				return globals.JwtSecret, nil
-			})
-			if err == nil && token.Valid {
-				ctx := r.Context()
-				ctx = context.WithValue(ctx, globals.UserIDKey, claims.UserID)
-				ctx = context.WithValue(ctx, globals.RoleKey, claims.Role)
+			if claims, err := parseToken(r.Context(), tokenString[7:]); err == nil {
+				ctx := withClaims(r.Context(), claims)
+				setLogUser(ctx, claims.UserID)
 				r = r.WithContext(ctx)
 			}
 		}
@@ -71,43 +78,109 @@ func OptionalAuth(next httprouter.Handle) httprouter.Handle {
 	}
 }
 
-// RequireRoles restricts access to users with matching roles
+// RequireRoles restricts access to users with matching roles. A role
+// that requires MFA only counts when the session logged in with one.
 func RequireRoles(allowedRoles ...string) func(httprouter.Handle) httprouter.Handle {
 	return func(next httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			rawRoles := r.Context().Value(globals.RoleKey)
 			roles, ok := rawRoles.([]string)
 			if !ok || roles == nil {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+				apierr.Respond(w, http.StatusForbidden, "Forbidden")
 				return
 			}
+			mfa, _ := r.Context().Value(globals.MFAKey).(bool)
 
+			needsMFA := false
 			for _, role := range roles {
 				for _, allowed := range allowedRoles {
-					if role == allowed {
+					if role != allowed {
+						continue
+					}
+					if mfa || !mfaRoles[role] {
 						next(w, r, ps)
 						return
 					}
+					needsMFA = true
 				}
 			}
+			if needsMFA {
+				apierr.Write(w, apierr.New(http.StatusForbidden, apierr.CodeMFARequired, "Log in with two-factor authentication to continue"))
+				return
+			}
 
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		}
 	}
 }
 
+// HasRole reports whether the request's session holds role, for handlers
+// whose rules depend on it. Like RequireRoles, a role that requires MFA
+// only counts when the session logged in with one.
+func HasRole(r *http.Request, role string) bool {
+	roles, _ := r.Context().Value(globals.RoleKey).([]string)
+	mfa, _ := r.Context().Value(globals.MFAKey).(bool)
+	for _, have := range roles {
+		if have == role && (mfa || !mfaRoles[role]) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateJWT parses and returns claims from a token string
 func ValidateJWT(tokenString string) (*Claims, error) {
 	if tokenString == "" || len(tokenString) < 8 {
 		return nil, fmt.Errorf("invalid token")
 	}
 
-	claims := &Claims{}
-	_, err := jwt.ParseWithClaims(tokenString[7:], claims, func(token *jwt.Token) (any, error) {
-		return globals.JwtSecret, nil
-	})
+	claims, err := parseToken(context.Background(), tokenString[7:])
 	if err != nil {
 		return nil, fmt.Errorf("unauthorized: %w", err)
 	}
 	return claims, nil
 }
+
+var (
+	errNoSession    = errors.New("token has no session")
+	errRevoked      = errors.New("session revoked")
+	errSessionCheck = errors.New("session check failed")
+)
+
+// parseToken verifies a raw JWT's signature, algorithm, issuer,
+// audience and expiry, and checks that its session, named by the jti
+// claim, has not been revoked.
+func parseToken(ctx context.Context, raw string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(raw, claims, jwtkeys.Keyfunc,
+		jwt.WithValidMethods([]string{jwtkeys.Algorithm}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(tokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if claims.ID == "" {
+		return nil, errNoSession
+	}
+	revoked, err := sessions.Revoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSessionCheck, err)
+	}
+	if revoked {
+		return nil, errRevoked
+	}
+	return claims, nil
+}
+
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, globals.UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, globals.RoleKey, claims.Role)
+	ctx = context.WithValue(ctx, globals.EmailVerifiedKey, claims.EmailVerified)
+	ctx = context.WithValue(ctx, globals.MFAKey, claims.MFA)
+	return context.WithValue(ctx, globals.SessionIDKey, claims.ID)
+}
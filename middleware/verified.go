@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"naevis/apierr"
+	"naevis/config"
+	"naevis/db"
+	"naevis/globals"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Set by Configure: requireVerified switches RequireVerified on,
+// mfaRoles are the roles RequireRoles honours only with MFA, and tokens
+// must name tokenIssuer and tokenAudience.
+var (
+	requireVerified = true
+	mfaRoles        = map[string]bool{"admin": true, "moderator": true}
+	tokenIssuer     = "http://localhost:4000"
+	tokenAudience   = "naevis"
+)
+
+// Configure applies the loaded configuration to the middleware package.
+func Configure(cfg *config.Config) {
+	requireVerified = cfg.Verify.Required
+	tokenIssuer = cfg.JWT.Issuer
+	tokenAudience = cfg.JWT.Audience
+	mfaRoles = map[string]bool{}
+	for _, role := range cfg.MFA.RequiredRoles {
+		mfaRoles[role] = true
+	}
+}
+
+// RequireVerified refuses users whose email address is not verified. It
+// must run after Authenticate. Tokens issued before the user verified
+// still say unverified, so a false claim is rechecked against the
+// database rather than forcing the client to refresh first.
+func RequireVerified(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !requireVerified {
+			next(w, r, ps)
+			return
+		}
+		ctx := r.Context()
+		if verified, _ := ctx.Value(globals.EmailVerifiedKey).(bool); verified {
+			next(w, r, ps)
+			return
+		}
+
+		userID, _ := ctx.Value(globals.UserIDKey).(string)
+		err := db.UserCollection.FindOne(ctx,
+			bson.M{"userid": userID, "email_verified": true},
+			options.FindOne().SetProjection(bson.M{"_id": 1}),
+		).Err()
+		switch {
+		case err == nil:
+			next(w, r, ps)
+		case errors.Is(err, mongo.ErrNoDocuments):
+			apierr.Write(w, apierr.New(http.StatusForbidden, apierr.CodeEmailUnverified, "Verify your email address to continue"))
+		default:
+			slog.ErrorContext(ctx, "verified check lookup failed", "user_id", userID, "error", err)
+			apierr.Respond(w, http.StatusServiceUnavailable, "Unable to verify account")
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package migrations applies versioned schema, index and data changes to
+// MongoDB. Applied versions are recorded in the migrations collection so
+// each one runs once per database.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a single, idempotent step. Versions are never reused or
+// reordered once released.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context) error
+}
+
+// Record is what the runner stores for an applied migration.
+type Record struct {
+	Version    int       `bson:"_id" json:"version"`
+	Name       string    `bson:"name" json:"name"`
+	AppliedAt  time.Time `bson:"applied_at" json:"applied_at"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Status describes one known migration.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// lockID is the document that serialises runners across instances. It
+// lives in the migrations collection under a string _id, so it never
+// collides with a version record.
+const (
+	lockID    = "lock"
+	lockLease = 5 * time.Minute
+)
+
+// ErrLocked is returned when another instance is applying migrations.
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// errLockLost stops a run whose lease was taken over by another instance.
+var errLockLost = errors.New("migration lock lost to another instance")
+
+// StatusOf reports every known migration and whether it has been applied.
+func StatusOf(ctx context.Context, all []Migration) ([]Status, error) {
+	applied, err := appliedRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(all))
+	for _, m := range sorted(all) {
+		st := Status{Version: m.Version, Name: m.Name}
+		if rec, ok := applied[m.Version]; ok {
+			at := rec.AppliedAt
+			st.Applied, st.AppliedAt = true, &at
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Pending returns the migrations that have not been applied, in order.
+func Pending(ctx context.Context, all []Migration) ([]Migration, error) {
+	applied, err := appliedRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range sorted(all) {
+		if _, ok := applied[m.Version]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// Up applies pending migrations in version order and stops at the first
+// failure. With dryRun set it only reports what would run.
+func Up(ctx context.Context, all []Migration, dryRun bool) ([]Migration, error) {
+	if err := validate(all); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return Pending(ctx, all)
+	}
+
+	owner := fmt.Sprintf("%d", time.Now().UnixNano())
+	if err := acquireLock(ctx, owner); err != nil {
+		return nil, err
+	}
+	defer releaseLock(owner)
+	ctx, stop := holdLock(ctx, owner)
+	defer stop()
+
+	pending, err := Pending(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		start := time.Now()
+		log.Printf("🔧 Applying migration %d %s", m.Version, m.Name)
+		if err := m.Up(ctx); err != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, errLockLost) {
+				err = cause
+			}
+			return done, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		rec := Record{
+			Version:    m.Version,
+			Name:       m.Name,
+			AppliedAt:  time.Now().UTC(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if _, err := db.MigrationsCollection.InsertOne(ctx, rec); err != nil {
+			return done, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func appliedRecords(ctx context.Context) (map[int]Record, error) {
+	cur, err := db.MigrationsCollection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, fmt.Errorf("read applied migrations: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	out := map[int]Record{}
+	for cur.Next(ctx) {
+		var rec Record
+		if err := cur.Decode(&rec); err != nil {
+			return nil, err
+		}
+		out[rec.Version] = rec
+	}
+	return out, cur.Err()
+}
+
+func acquireLock(ctx context.Context, owner string) error {
+	now := time.Now().UTC()
+	_, err := db.MigrationsCollection.UpdateOne(ctx,
+		bson.M{"_id": lockID, "until": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"owner": owner, "until": now.Add(lockLease)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The lock document exists and has not expired.
+		return ErrLocked
+	}
+	return err
+}
+
+// holdLock renews the lease every third of lockLease until stop is
+// called, so a run longer than the lease keeps it. If another instance
+// has taken the lock over, the returned context is cancelled with
+// errLockLost so the run stops instead of racing it.
+func holdLock(ctx context.Context, owner string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		ticker := time.NewTicker(lockLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			res, err := db.MigrationsCollection.UpdateOne(ctx,
+				bson.M{"_id": lockID, "owner": owner},
+				bson.M{"$set": bson.M{"until": time.Now().UTC().Add(lockLease)}},
+			)
+			if err != nil {
+				// Retry on the next tick; the lease outlasts a couple of misses.
+				slog.WarnContext(ctx, "renewing migration lock failed", "owner", owner, "error", err)
+				continue
+			}
+			if res.MatchedCount == 0 {
+				cancel(errLockLost)
+				return
+			}
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+func releaseLock(owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = db.MigrationsCollection.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+}
+
+func validate(all []Migration) error {
+	seen := map[int]string{}
+	for _, m := range all {
+		if m.Version <= 0 || m.Up == nil {
+			return fmt.Errorf("migration %d %q is incomplete", m.Version, m.Name)
+		}
+		if prev, ok := seen[m.Version]; ok {
+			return fmt.Errorf("migration version %d used by %q and %q", m.Version, prev, m.Name)
+		}
+		seen[m.Version] = m.Name
+	}
+	return nil
+}
+
+func sorted(all []Migration) []Migration {
+	out := append([]Migration(nil), all...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
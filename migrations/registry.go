@@ -0,0 +1,467 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"naevis/db"
+	"naevis/home"
+	"naevis/money"
+	"naevis/pay"
+	"naevis/reports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long delivered outbox rows are kept.
+const outboxRetention = 7 * 24 * 60 * 60 // seconds
+
+// jobRunRetention is how long scheduler run history is kept.
+const jobRunRetention = 30 * 24 * 60 * 60 // seconds
+
+// All lists every migration in release order. Append new ones at the end
+// with the next version number.
+var All = []Migration{
+	{Version: 1, Name: "existing index helpers", Up: func(ctx context.Context) error {
+		if err := pay.InitIdempotencyIndexes(ctx); err != nil {
+			return err
+		}
+		if err := reports.EnsureReportIndexes(db.ReportsCollection); err != nil {
+			return err
+		}
+		return home.EnsureHomeCardsIndexes(ctx)
+	}},
+
+	{Version: 2, Name: "users lookup indexes", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.UserCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetUnique(true).SetName("unique_username"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userid", Value: 1}},
+				Options: options.Index().SetName("userid"),
+			},
+		)
+	}},
+
+	{Version: 3, Name: "likes indexes", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.LikesCollection,
+			mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "user_id", Value: 1},
+					{Key: "entity_type", Value: 1},
+					{Key: "entity_id", Value: 1},
+				},
+				Options: options.Index().SetUnique(true).SetName("unique_user_entity"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}},
+				Options: options.Index().SetName("entity"),
+			},
+		)
+	}},
+
+	{Version: 4, Name: "ticket indexes", Up: func(ctx context.Context) error {
+		if err := db.CreateIndexes(ctx, db.TicketsCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "ticketid", Value: 1}},
+			Options: options.Index().SetName("ticketid"),
+		}); err != nil {
+			return err
+		}
+		// Purchased tickets are stored without explicit tags, so the
+		// uniqueCode field lands in Mongo as "uniquecode".
+		return db.CreateIndexes(ctx, db.PurchasedTicketsCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "eventid", Value: 1}, {Key: "uniquecode", Value: 1}},
+			Options: options.Index().SetName("event_uniquecode"),
+		})
+	}},
+
+	{Version: 5, Name: "outbox relay and retention indexes", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.OutboxCollection,
+			mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "status", Value: 1},
+					{Key: "next_attempt_at", Value: 1},
+					{Key: "created_at", Value: 1},
+				},
+				Options: options.Index().SetName("relay_queue"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(outboxRetention).SetName("ttl_delivered_at"),
+			},
+		)
+	}},
+
+	{Version: 6, Name: "rename refreshtoken/refreshexp to refresh_token/refresh_expiry", Up: func(ctx context.Context) error {
+		renames := map[string]string{
+			"refreshtoken": "refresh_token",
+			"refreshexp":   "refresh_expiry",
+		}
+		for from, to := range renames {
+			// Move the old field where the new one is not set yet...
+			if _, err := db.UserCollection.UpdateMany(ctx,
+				bson.M{from: bson.M{"$exists": true}, to: bson.M{"$exists": false}},
+				bson.M{"$rename": bson.M{from: to}},
+			); err != nil {
+				return err
+			}
+			// ...and drop it where the new one already wins.
+			if _, err := db.UserCollection.UpdateMany(ctx,
+				bson.M{from: bson.M{"$exists": true}},
+				bson.M{"$unset": bson.M{from: ""}},
+			); err != nil {
+				return err
+			}
+		}
+		return db.CreateIndexes(ctx, db.UserCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "refresh_token", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("refresh_token"),
+		})
+	}},
+
+	{Version: 7, Name: "keyset pagination indexes", Up: func(ctx context.Context) error {
+		if err := db.CreateIndexes(ctx, db.PostsCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "timestamp", Value: -1}, {Key: "postid", Value: -1}},
+				Options: options.Index().SetName("feed_page"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "tags", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "postid", Value: -1}},
+				Options: options.Index().SetName("tag_page"),
+			},
+		); err != nil {
+			return err
+		}
+		if err := db.CreateIndexes(ctx, db.CommentsCollection, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "entity_type", Value: 1},
+				{Key: "entity_id", Value: 1},
+				{Key: "created_at", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("entity_page"),
+		}); err != nil {
+			return err
+		}
+		if err := db.CreateIndexes(ctx, db.TransactionCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_page"),
+		}); err != nil {
+			return err
+		}
+		return db.CreateIndexes(ctx, db.MessagesCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "chatId", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("chat_page"),
+		})
+	}},
+
+	{Version: 8, Name: "scheduler run history and job lookup indexes", Up: func(ctx context.Context) error {
+		if err := db.CreateIndexes(ctx, db.JobRunsCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("job_page"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "started_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(jobRunRetention).SetName("ttl_started_at"),
+			},
+		); err != nil {
+			return err
+		}
+		if err := db.CreateIndexes(ctx, db.BaitoCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "lastdate", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"closedAt": bson.M{"$exists": false}}).SetName("open_by_lastdate"),
+		}); err != nil {
+			return err
+		}
+		return db.CreateIndexes(ctx, db.EventsCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "start_date_time", Value: 1}},
+			Options: options.Index().SetName("start_date_time"),
+		})
+	}},
+
+	{Version: 9, Name: "login sessions", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.SessionsCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "last_seen", Value: -1}},
+				Options: options.Index().SetName("user_last_seen"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0).SetName("ttl_expires_at"),
+			},
+		)
+	}},
+
+	{Version: 10, Name: "per-session refresh tokens replace the user refresh_token field", Up: func(ctx context.Context) error {
+		if err := db.CreateIndexes(ctx, db.RefreshTokensCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "session", Value: 1}},
+				Options: options.Index().SetName("session"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0).SetName("ttl_expires_at"),
+			},
+		); err != nil {
+			return err
+		}
+		// Tokens stored on users were never reachable through a route;
+		// their holders simply log in again.
+		if _, err := db.UserCollection.UpdateMany(ctx,
+			bson.M{"$or": bson.A{
+				bson.M{"refresh_token": bson.M{"$exists": true}},
+				bson.M{"refresh_expiry": bson.M{"$exists": true}},
+			}},
+			bson.M{"$unset": bson.M{"refresh_token": "", "refresh_expiry": ""}},
+		); err != nil {
+			return err
+		}
+		return db.DropIndex(ctx, db.UserCollection, "refresh_token")
+	}},
+
+	{Version: 11, Name: "users email index; drop the unused password_hash field", Up: func(ctx context.Context) error {
+		// Verification codes and password resets look users up by email.
+		if err := db.CreateIndexes(ctx, db.UserCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email"),
+			},
+		); err != nil {
+			return err
+		}
+		_, err := db.UserCollection.UpdateMany(ctx,
+			bson.M{"password_hash": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"password_hash": ""}},
+		)
+		return err
+	}},
+
+	{Version: 12, Name: "identities indexes", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.IdentitiesCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "provider", Value: 1}},
+				Options: options.Index().SetUnique(true).SetName("unique_user_provider"),
+			},
+		)
+	}},
+
+	{Version: 13, Name: "ledger reconciliation indexes", Up: func(ctx context.Context) error {
+		if err := db.CreateIndexes(ctx, db.JournalCollection,
+			mongo.IndexModel{Keys: bson.D{{Key: "txn_id", Value: 1}}, Options: options.Index().SetName("txn_id")},
+			mongo.IndexModel{Keys: bson.D{{Key: "debit_account", Value: 1}}, Options: options.Index().SetName("debit_account")},
+			mongo.IndexModel{Keys: bson.D{{Key: "credit_account", Value: 1}}, Options: options.Index().SetName("credit_account")},
+		); err != nil {
+			return err
+		}
+		if err := db.CreateIndexes(ctx, db.ReconciliationsCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("started_at_id"),
+			},
+		); err != nil {
+			return err
+		}
+		return db.CreateIndexes(ctx, db.LedgerAuditCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "account_id", Value: 1}, {Key: "at", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("account_at_id"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("at_id"),
+			},
+		)
+	}},
+
+	{Version: 14, Name: "checkouts indexes", Up: func(ctx context.Context) error {
+		return db.CreateIndexes(ctx, db.CheckoutsCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "session_id", Value: 1}},
+				Options: options.Index().SetUnique(true).SetName("unique_provider_session"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("userid_created_at"),
+			},
+		)
+	}},
+
+	{Version: 15, Name: "money in integer minor units; one wallet account per currency", Up: func(ctx context.Context) error {
+		// Ledger amounts: the currency is on the same document.
+		for _, f := range []struct {
+			coll  db.Collection
+			field string
+		}{
+			{db.AccountsCollection, "cached_balance"},
+			{db.TransactionCollection, "amount"},
+			{db.JournalCollection, "amount"},
+			{db.CheckoutsCollection, "amount"},
+		} {
+			field := f.field
+			err := rewriteEach(ctx, f.coll, bson.M{field: bson.M{"$type": "double"}}, func(doc bson.M) (bson.M, error) {
+				m, err := legacyMoney(doc[field], doc["currency"])
+				if err != nil {
+					return nil, err
+				}
+				return bson.M{"$set": bson.M{field: m.Minor, "currency": m.Currency}}, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err := rewriteEach(ctx, db.LedgerAuditCollection, bson.M{"before": bson.M{"$type": "double"}}, func(doc bson.M) (bson.M, error) {
+			before, err := legacyMoney(doc["before"], nil)
+			if err != nil {
+				return nil, err
+			}
+			after, err := legacyMoney(doc["after"], nil)
+			if err != nil {
+				return nil, err
+			}
+			return bson.M{"$set": bson.M{"before": before.Minor, "after": after.Minor, "currency": before.Currency}}, nil
+		})
+		if err != nil {
+			return err
+		}
+		err = rewriteEach(ctx, db.ReconciliationsCollection, bson.M{"$or": bson.A{
+			bson.M{"account_issues.cached": bson.M{"$type": "double"}},
+			bson.M{"account_issues.journaled": bson.M{"$type": "double"}},
+			bson.M{"txn_issues.amount": bson.M{"$type": "double"}},
+			bson.M{"txn_issues.journaled": bson.M{"$type": "double"}},
+		}}, func(doc bson.M) (bson.M, error) {
+			set := bson.M{}
+			for list, fields := range map[string][]string{
+				"account_issues": {"cached", "journaled"},
+				"txn_issues":     {"amount", "journaled"},
+			} {
+				issues, _ := doc[list].(bson.A)
+				for _, issue := range issues {
+					issue, ok := issue.(bson.M)
+					if !ok {
+						continue
+					}
+					for _, field := range fields {
+						m, err := legacyMoney(issue[field], nil)
+						if err != nil {
+							return nil, err
+						}
+						issue[field] = m.Minor
+					}
+					issue["currency"] = money.Default
+				}
+				set[list] = issues
+			}
+			return bson.M{"$set": set}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Prices: tickets name their currency, the rest were rupees.
+		err = rewriteEach(ctx, db.TicketsCollection, bson.M{"price": bson.M{"$type": "double"}}, func(doc bson.M) (bson.M, error) {
+			m, err := legacyMoney(doc["price"], doc["currency"])
+			if err != nil {
+				return nil, err
+			}
+			return bson.M{"$set": bson.M{"price": m}, "$unset": bson.M{"currency": ""}}, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, coll := range []db.Collection{db.CartCollection, db.CropsCollection} {
+			err := rewriteEach(ctx, coll, bson.M{"price": bson.M{"$type": "double"}}, func(doc bson.M) (bson.M, error) {
+				m, err := legacyMoney(doc["price"], nil)
+				if err != nil {
+					return nil, err
+				}
+				return bson.M{"$set": bson.M{"price": m}}, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = rewriteEach(ctx, db.OrderCollection, bson.M{"total": bson.M{"$type": "double"}}, func(doc bson.M) (bson.M, error) {
+			total, err := legacyMoney(doc["total"], nil)
+			if err != nil {
+				return nil, err
+			}
+			items, _ := doc["items"].(bson.M)
+			for _, group := range items {
+				group, _ := group.(bson.A)
+				for _, item := range group {
+					item, ok := item.(bson.M)
+					if !ok {
+						continue
+					}
+					price, err := legacyMoney(item["price"], nil)
+					if err != nil {
+						return nil, err
+					}
+					item["price"] = price
+				}
+			}
+			return bson.M{"$set": bson.M{"total": total, "items": items}}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Accounts were looked up by user alone; now by user and currency.
+		// This fails if a user has two accounts in one currency, which
+		// the old lookup could leave behind; merge those by hand first.
+		return db.CreateIndexes(ctx, db.AccountsCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "currency", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("unique_userid_currency"),
+		})
+	}},
+}
+
+// rewriteEach updates every document of coll matching filter with the
+// update fix returns for it.
+func rewriteEach(ctx context.Context, coll db.Collection, filter bson.M, fix func(doc bson.M) (bson.M, error)) error {
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		update, err := fix(doc)
+		if err != nil {
+			return fmt.Errorf("%s %v: %w", coll.Name(), doc["_id"], err)
+		}
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, update); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// legacyMoney reads an amount stored as a float in major units. Amounts
+// already in minor units are kept. A currency that is missing or not
+// recognised is taken to be rupees, the only one used before.
+func legacyMoney(amount, currency interface{}) (money.Money, error) {
+	code, err := money.Currency(fmt.Sprint(currency))
+	if currency == nil || err != nil {
+		code = money.Default
+	}
+	switch v := amount.(type) {
+	case float64:
+		return money.FromFloat(v, code)
+	case int32:
+		return money.New(int64(v), code)
+	case int64:
+		return money.New(v, code)
+	case nil:
+		return money.New(0, code)
+	}
+	return money.Money{}, fmt.Errorf("amount %v is not a number", amount)
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"naevis/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -109,8 +111,7 @@ type Ticket struct {
 	TicketID    string             `json:"ticketid" bson:"ticketid"`
 	EventID     string             `json:"eventid" bson:"eventid"`
 	Name        string             `json:"name" bson:"name"`
-	Price       float64            `json:"price" bson:"price"`
-	Currency    string             `json:"currency" bson:"currency"`
+	Price       money.Money        `json:"price" bson:"price"`
 	Color       string             `json:"color" bson:"color"`
 	Quantity    int                `json:"quantity" bson:"quantity"`
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
@@ -29,6 +29,9 @@ type Baito struct {
 	UpdatedAt        time.Time `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
 	OwnerID          string    `bson:"ownerId" json:"ownerId"`
 	ApplicationCount int       `bson:"applicationcount" json:"applicationcount"`
+	// ClosedAt is set once LastDateToApply has passed; closed postings no
+	// longer take applications or show up in listings.
+	ClosedAt *time.Time `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
 }
 
 type BaitoApplication struct {
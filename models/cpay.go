@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"naevis/money"
 )
 
 // Meta is a generic key-value map for transaction metadata
@@ -9,62 +12,72 @@ type Meta map[string]interface{}
 
 // Transaction represents a wallet or payment transaction
 type Transaction struct {
-	ID             string    `bson:"_id,omitempty" json:"id"`
-	UserID         string    `bson:"userid,omitempty" json:"userid,omitempty"`
-	ParentTxn      string    `bson:"parent_txn,omitempty" json:"parent_txn,omitempty"`
-	Type           string    `bson:"type" json:"type"` // credit, debit, topup, payment, transfer, refund
-	Amount         float64   `bson:"amount" json:"amount"`
-	Method         string    `bson:"method" json:"method"` // wallet, card, upi, cod, topup, transfer, refund
-	EntityID       string    `bson:"entity_id,omitempty" json:"entity_id,omitempty"`
-	EntityType     string    `bson:"entity_type,omitempty" json:"entity_type,omitempty"`
-	FromAccount    string    `bson:"from_account,omitempty" json:"from_account,omitempty"`
-	ToAccount      string    `bson:"to_account,omitempty" json:"to_account,omitempty"`
-	Status         string    `bson:"state" json:"state"` // initiated, success, failed, reversed
-	Currency       string    `bson:"currency" json:"currency"`
-	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
-	IdempotencyKey string    `bson:"external_ref,omitempty" json:"external_ref,omitempty"`
-	Meta           Meta      `bson:"meta,omitempty" json:"meta,omitempty"`
+	ID             string      `bson:"_id,omitempty" json:"id"`
+	UserID         string      `bson:"userid,omitempty" json:"userid,omitempty"`
+	ParentTxn      string      `bson:"parent_txn,omitempty" json:"parent_txn,omitempty"`
+	Type           string      `bson:"type" json:"type"` // credit, debit, topup, payment, transfer, refund, convert
+	Amount         money.Money `bson:",inline" json:"amount"`
+	Method         string      `bson:"method" json:"method"` // wallet, card, upi, cod, topup, transfer, refund
+	EntityID       string      `bson:"entity_id,omitempty" json:"entity_id,omitempty"`
+	EntityType     string      `bson:"entity_type,omitempty" json:"entity_type,omitempty"`
+	FromAccount    string      `bson:"from_account,omitempty" json:"from_account,omitempty"`
+	ToAccount      string      `bson:"to_account,omitempty" json:"to_account,omitempty"`
+	Status         string      `bson:"state" json:"state"`          // initiated, success, partially_refunded, reversed, failed
+	Refunded       int64       `bson:"refunded,omitempty" json:"-"` // minor units of Amount refunded so far
+	CreatedAt      time.Time   `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time   `bson:"updated_at" json:"updated_at"`
+	IdempotencyKey string      `bson:"external_ref,omitempty" json:"external_ref,omitempty"`
+	Meta           Meta        `bson:"meta,omitempty" json:"meta,omitempty"`
+}
+
+// RefundedAmount returns how much of the transaction has been refunded.
+func (t Transaction) RefundedAmount() money.Money {
+	return money.Money{Minor: t.Refunded, Currency: t.Amount.Currency}
 }
 
 // JournalEntry represents a ledger double-entry record
 type JournalEntry struct {
-	ID            string    `bson:"_id,omitempty" json:"id"`
-	TxnID         string    `bson:"txn_id" json:"txn_id"`
-	DebitAccount  string    `bson:"debit_account" json:"debit_account"`
-	CreditAccount string    `bson:"credit_account" json:"credit_account"`
-	Amount        float64   `bson:"amount" json:"amount"`
-	Currency      string    `bson:"currency" json:"currency"`
-	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
-	Meta          Meta      `bson:"meta,omitempty" json:"meta,omitempty"`
+	ID            string      `bson:"_id,omitempty" json:"id"`
+	TxnID         string      `bson:"txn_id" json:"txn_id"`
+	DebitAccount  string      `bson:"debit_account" json:"debit_account"`
+	CreditAccount string      `bson:"credit_account" json:"credit_account"`
+	Amount        money.Money `bson:",inline" json:"amount"`
+	CreatedAt     time.Time   `bson:"created_at" json:"created_at"`
+	Meta          Meta        `bson:"meta,omitempty" json:"meta,omitempty"`
 }
 
-// Account represents a user's wallet/account
+// Account represents a user's wallet in one currency. A user has at most
+// one account per currency.
 type Account struct {
 	ID            string    `bson:"_id,omitempty" json:"id"`
 	UserID        string    `bson:"userid" json:"userid"`
 	Currency      string    `bson:"currency" json:"currency"`
-	Status        string    `bson:"status" json:"status"` // active, inactive
-	CachedBalance float64   `bson:"cached_balance" json:"cached_balance"`
+	Status        string    `bson:"status" json:"status"`    // active, inactive
+	CachedBalance int64     `bson:"cached_balance" json:"-"` // minor units of Currency
 	Version       int       `bson:"version" json:"version"`
 	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// Balance returns the account's cached balance.
+func (a Account) Balance() money.Money {
+	return money.Money{Minor: a.CachedBalance, Currency: a.Currency}
+}
+
 // Price represents a resolvable price for an entity
 type Price struct {
-	EntityType string  `bson:"entity_type" json:"entity_type"`
-	EntityID   string  `bson:"entity_id" json:"entity_id"`
-	Amount     float64 `bson:"amount" json:"amount"`
-	Currency   string  `bson:"currency" json:"currency"`
+	EntityType string      `bson:"entity_type" json:"entity_type"`
+	EntityID   string      `bson:"entity_id" json:"entity_id"`
+	Amount     money.Money `bson:",inline" json:"amount"`
 }
 
 // PayRequest is the request payload for a payment
 type PayRequest struct {
-	EntityType string  `bson:"entity_type" json:"entityType"`
-	EntityID   string  `bson:"entity_id" json:"entityId"`
-	Method     string  `bson:"method" json:"method"` // wallet, card, upi, cod
-	Amount     float64 `bson:"amount" json:"amount"` // optional for user input
+	EntityType string      `bson:"entity_type" json:"entityType"`
+	EntityID   string      `bson:"entity_id" json:"entityId"`
+	Method     string      `bson:"method" json:"method"`               // wallet; cards pay through a gateway checkout
+	Amount     json.Number `bson:"amount" json:"amount,omitempty"`     // only for entities without a price
+	Currency   string      `bson:"currency" json:"currency,omitempty"` // for entities without a price
 }
 
 // IdempotencyRecord represents an idempotency key record stored in Mongo.
@@ -78,3 +91,24 @@ type IdempotencyRecord struct {
 	CreatedAt   time.Time              `bson:"created_at" json:"created_at"`
 	ExpiresAt   time.Time              `bson:"expires_at" json:"expires_at"`
 }
+
+// Checkout is a purchase paid through the card payment provider. It is
+// fulfilled only after a verified webhook reports the payment.
+type Checkout struct {
+	ID         string      `bson:"_id" json:"id"`
+	UserID     string      `bson:"userid" json:"userid"`
+	Kind       string      `bson:"kind" json:"kind"`               // ticket, seat, merch, menu
+	EntityType string      `bson:"entity_type" json:"entity_type"` // event or place
+	EntityID   string      `bson:"entity_id" json:"entity_id"`
+	ItemID     string      `bson:"item_id" json:"item_id"`
+	Quantity   int         `bson:"quantity" json:"quantity"`
+	Seats      []string    `bson:"seats,omitempty" json:"seats,omitempty"`
+	Amount     money.Money `bson:",inline" json:"amount"`
+	Provider   string      `bson:"provider" json:"provider"`
+	SessionID  string      `bson:"session_id" json:"-"`
+	PaymentID  string      `bson:"payment_id,omitempty" json:"-"`
+	State      string      `bson:"state" json:"state"` // pending, paid, fulfilled, failed, refunded
+	Result     Meta        `bson:"result,omitempty" json:"result,omitempty"`
+	CreatedAt  time.Time   `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time   `bson:"updated_at" json:"updated_at"`
+}
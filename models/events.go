@@ -1,9 +1,13 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"naevis/money"
+)
 
 type Event struct {
-	EventID          string      `json:"eventid" bson:"eventid"`
+	EventID          string      `bson:"eventid"`
 	Title            string      `json:"title" bson:"title"`
 	Description      string      `json:"description" bson:"description"`
 	Date             time.Time   `json:"date" bson:"date"`
@@ -29,10 +33,12 @@ type Event struct {
 	OrganizerContact string      `json:"organizer_contact" bson:"organizer_contact"`
 	Artists          []string    `json:"artists,omitempty" bson:"artists,omitempty"`
 	Published        string      `json:"published,omitempty" bson:"published,omitempty"`
+	// ReminderSentAt is set once ticket holders have been reminded.
+	ReminderSentAt *time.Time `json:"-" bson:"reminder_sent_at,omitempty"`
 
 	// Computed fields for frontend filters
-	Prices   []float64 `json:"prices,omitempty" bson:"-"`
-	Currency string    `json:"currency,omitempty" bson:"-"`
+	Prices   []money.Money `json:"prices,omitempty" bson:"-"`
+	Currency string        `json:"currency,omitempty" bson:"-"`
 }
 
 // FAQ represents a single FAQ structure
@@ -47,10 +53,11 @@ type SocialMediaLinks struct {
 }
 
 type PurchasedTicket struct {
-	EventID      string
-	TicketID     string
-	UserID       string
-	BuyerName    string
-	UniqueCode   string
-	PurchaseDate time.Time
+	EventID      string    `bson:"eventid"`
+	TicketID     string    `bson:"ticketid"`
+	UserID       string    `bson:"userid"`
+	BuyerName    string    `bson:"buyername"`
+	UniqueCode   string    `bson:"uniquecode"`
+	PurchaseDate time.Time `bson:"purchasedate"`
+	Status       string    `bson:"status,omitempty"` // "" when valid, refunded
 }
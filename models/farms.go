@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	"naevis/money"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -53,7 +55,7 @@ type PricePoint struct {
 type Crop struct {
 	Name         string       `json:"name"`
 	CropId       string       `json:"cropid"`
-	Price        float64      `json:"price"`
+	Price        money.Money  `json:"price"`
 	Quantity     int          `json:"quantity"`
 	Unit         string       `json:"unit"`
 	Banner       string       `bson:"banner" json:"banner"`
@@ -93,16 +95,16 @@ type CropCatalogueItem struct {
 }
 
 type CropListing struct {
-	FarmID         string   `json:"farmId"`
-	CropId         string   `json:"cropid"`
-	FarmName       string   `json:"farmName"`
-	Location       string   `json:"location"`
-	Breed          string   `json:"breed"`
-	PricePerKg     float64  `json:"pricePerKg"`
-	AvailableQtyKg int      `json:"availableQtyKg,omitempty"`
-	HarvestDate    string   `json:"harvestDate,omitempty"` // ISO string
-	Tags           []string `json:"tags,omitempty"`
-	Banner         string   `bson:"banner" json:"banner"`
+	FarmID         string      `json:"farmId"`
+	CropId         string      `json:"cropid"`
+	FarmName       string      `json:"farmName"`
+	Location       string      `json:"location"`
+	Breed          string      `json:"breed"`
+	PricePerKg     money.Money `json:"pricePerKg"`
+	AvailableQtyKg int         `json:"availableQtyKg,omitempty"`
+	HarvestDate    string      `json:"harvestDate,omitempty"` // ISO string
+	Tags           []string    `json:"tags,omitempty"`
+	Banner         string      `bson:"banner" json:"banner"`
 }
 
 type Product struct {
@@ -19,18 +19,19 @@ type PlacesResponse struct {
 /* ---------- MODELS ---------- */
 
 type BaitosResponse struct {
-	BaitoId      string    `bson:"baitoid,omitempty" json:"baitoid"`
-	Title        string    `bson:"title" json:"title"`
-	Description  string    `bson:"description" json:"description"`
-	Category     string    `bson:"category" json:"category"`
-	SubCategory  string    `bson:"subcategory" json:"subcategory"`
-	Location     string    `bson:"location" json:"location"`
-	Wage         string    `bson:"wage" json:"wage"`
-	Requirements string    `bson:"requirements" json:"requirements"`
-	BannerURL    string    `bson:"banner,omitempty" json:"banner,omitempty"`
-	WorkHours    string    `bson:"workHours" json:"workHours"`
-	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
-	OwnerID      string    `bson:"ownerId" json:"ownerId"`
+	BaitoId      string     `bson:"baitoid,omitempty" json:"baitoid"`
+	Title        string     `bson:"title" json:"title"`
+	Description  string     `bson:"description" json:"description"`
+	Category     string     `bson:"category" json:"category"`
+	SubCategory  string     `bson:"subcategory" json:"subcategory"`
+	Location     string     `bson:"location" json:"location"`
+	Wage         string     `bson:"wage" json:"wage"`
+	Requirements string     `bson:"requirements" json:"requirements"`
+	BannerURL    string     `bson:"banner,omitempty" json:"banner,omitempty"`
+	WorkHours    string     `bson:"workHours" json:"workHours"`
+	CreatedAt    time.Time  `bson:"createdAt" json:"createdAt"`
+	OwnerID      string     `bson:"ownerId" json:"ownerId"`
+	ClosedAt     *time.Time `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
 }
 
 type BaitoWorkersResponse struct {
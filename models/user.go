@@ -7,8 +7,7 @@ type User struct {
 	UserID       string    `json:"userid" bson:"userid"`
 	Username     string    `json:"username" bson:"username"`
 	Email        string    `json:"email" bson:"email"`
-	Password     string    `json:"-" bson:"password"`
-	PasswordHash string    `json:"password_hash" bson:"password_hash"`
+	Password     string    `json:"-" bson:"password"` // bcrypt hash
 	Role         []string  `json:"role" bson:"role"`
 	Name         string    `json:"name,omitempty" bson:"name,omitempty"`
 	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
@@ -28,8 +27,6 @@ type User struct {
 	FollowersCount int               `json:"followerscount" bson:"followerscount"`
 	FollowingCount int               `json:"followscount" bson:"followscount"`
 	WalletBalance  float64           `bson:"wallet_balance" json:"wallet_balance"`
-	RefreshToken   string            `json:"-" bson:"refreshtoken,omitempty"`
-	RefreshExpiry  time.Time         `json:"refreshexp" bson:"refreshexp"`
 }
 
 // UserProfileResponse defines the structure for the user profile response
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 
 	"github.com/julienschmidt/httprouter"
@@ -28,7 +29,7 @@ func ApplyModerator(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		Reason string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, `{"error":"Invalid JSON payload"}`, http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -36,7 +37,7 @@ func ApplyModerator(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	payload.Reason = strings.TrimSpace(payload.Reason)
 
 	if payload.UserID == "" || payload.Reason == "" {
-		http.Error(w, `{"error":"Missing required fields"}`, http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
@@ -45,7 +46,7 @@ func ApplyModerator(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	var existing ModeratorApplication
 	err := db.ModeratorApplications.FindOne(context.TODO(), filter).Decode(&existing)
 	if err == nil {
-		http.Error(w, `{"error":"You have already applied to be a moderator"}`, http.StatusConflict)
+		apierr.Respond(w, http.StatusConflict, "You have already applied to be a moderator")
 		return
 	}
 
@@ -59,7 +60,7 @@ func ApplyModerator(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	_, err = db.ModeratorApplications.InsertOne(context.TODO(), app)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to save application"}`, http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save application")
 		return
 	}
 
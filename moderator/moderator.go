@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 
@@ -22,14 +23,14 @@ func GetReports(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	cursor, err := db.ReportsCollection.Find(context.TODO(), filter)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to fetch reports"}`, http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch reports")
 		return
 	}
 	defer cursor.Close(context.TODO())
 
 	var reports []models.Report
 	if err := cursor.All(context.TODO(), &reports); err != nil {
-		http.Error(w, `{"error":"Error processing reports"}`, http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error processing reports")
 		return
 	}
 
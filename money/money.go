@@ -0,0 +1,343 @@
+// Package money holds amounts of money as a whole number of minor units
+// (paise, cents, yen) of an ISO 4217 currency, so sums and comparisons
+// are exact. Arithmetic refuses to mix currencies or to overflow rather
+// than round.
+//
+// In JSON a Money is {"amount":"12.50","currency":"INR"}, the amount
+// being a decimal string in major units. In BSON it is stored as
+// {amount: 1250, currency: "INR"}, so queries and indexes work on the
+// integer amount.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Default is the currency of amounts that do not name one, such as all
+// wallet data recorded before wallets could hold other currencies.
+const Default = "INR"
+
+var (
+	// ErrCurrency is returned for a currency code this package does not
+	// know.
+	ErrCurrency = errors.New("money: unknown currency")
+	// ErrMismatch is returned when combining amounts in different
+	// currencies.
+	ErrMismatch = errors.New("money: currencies differ")
+	// ErrOverflow is returned when a result does not fit in int64 minor
+	// units.
+	ErrOverflow = errors.New("money: amount out of range")
+	// ErrSyntax is returned for an amount that is not a plain decimal.
+	ErrSyntax = errors.New("money: invalid amount")
+	// ErrPrecision is returned for an amount with more decimals than its
+	// currency has minor units.
+	ErrPrecision = errors.New("money: too many decimal places")
+)
+
+// exponents lists the supported currencies and how many decimal places
+// their minor unit has.
+var exponents = map[string]int{
+	"AED": 2, "AUD": 2, "BDT": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CNY": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "IDR": 2, "INR": 2,
+	"JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "LKR": 2, "MXN": 2, "MYR": 2,
+	"NOK": 2, "NPR": 2, "NZD": 2, "OMR": 3, "PHP": 2, "PKR": 2, "SAR": 2,
+	"SEK": 2, "SGD": 2, "THB": 2, "USD": 2, "ZAR": 2,
+}
+
+// Money is an amount in minor units of Currency.
+type Money struct {
+	Minor    int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+// Currency returns the canonical form of the ISO 4217 code, or
+// ErrCurrency if it is not supported.
+func Currency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := exponents[code]; !ok {
+		return "", fmt.Errorf("%w %q", ErrCurrency, code)
+	}
+	return code, nil
+}
+
+// Exponent returns the number of decimal places of the currency's minor
+// unit.
+func Exponent(currency string) (int, error) {
+	e, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrCurrency, currency)
+	}
+	return e, nil
+}
+
+// New returns minor units of currency.
+func New(minor int64, currency string) (Money, error) {
+	c, err := Currency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: minor, Currency: c}, nil
+}
+
+// Zero returns no money in currency.
+func Zero(currency string) (Money, error) {
+	return New(0, currency)
+}
+
+// Parse reads a decimal amount in major units, such as "12.5" or "-3",
+// in currency. It rejects exponents, separators and more decimals than
+// the currency has.
+func Parse(s, currency string) (Money, error) {
+	c, err := Currency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exp := exponents[c]
+
+	digits := strings.TrimSpace(s)
+	sign := ""
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		sign, digits = digits[:1], digits[1:]
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole+frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w %q", ErrSyntax, s)
+	}
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%w: %q has more than %d for %s", ErrPrecision, s, exp, c)
+	}
+	// The minor units are the digits with the point dropped.
+	minor, err := strconv.ParseInt(sign+whole+frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	return Money{Minor: minor, Currency: c}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a float amount in major units, rounding it to the
+// nearest minor unit. It exists for reading prices still kept as floats
+// and for migrating old data; do not do arithmetic in floats first.
+func FromFloat(f float64, currency string) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, fmt.Errorf("%w %v", ErrSyntax, f)
+	}
+	exp, err := Exponent(strings.ToUpper(strings.TrimSpace(currency)))
+	if err != nil {
+		return Money{}, err
+	}
+	return Parse(strconv.FormatFloat(f, 'f', exp, 64), currency)
+}
+
+// IsZero reports whether m is no money.
+func (m Money) IsZero() bool { return m.Minor == 0 }
+
+// IsPositive reports whether m is more than zero.
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+
+// IsNegative reports whether m is less than zero.
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+// same returns the currency shared by a and b. The zero Money has no
+// currency and goes with any, so totals can start from it.
+func same(a, b Money) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a == Money{}:
+		return b.Currency, nil
+	case b == Money{}:
+		return a.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrMismatch, a.Currency, b.Currency)
+}
+
+// Add returns m + o.
+func (m Money) Add(o Money) (Money, error) {
+	c, err := same(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Minor + o.Minor
+	if (o.Minor > 0 && sum < m.Minor) || (o.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: sum, Currency: c}, nil
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) (Money, error) {
+	c, err := same(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	diff := m.Minor - o.Minor
+	if (o.Minor > 0 && diff > m.Minor) || (o.Minor < 0 && diff < m.Minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: diff, Currency: c}, nil
+}
+
+// Mul returns m times n, e.g. a unit price times a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	hi, lo := bits.Mul64(abs(m.Minor), abs(n))
+	if hi != 0 || lo > math.MaxInt64 {
+		return Money{}, ErrOverflow
+	}
+	p := int64(lo)
+	if (m.Minor < 0) != (n < 0) {
+		p = -p
+	}
+	return Money{Minor: p, Currency: m.Currency}, nil
+}
+
+func abs(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// Cmp compares m and o and returns -1, 0 or +1.
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := same(m, o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Minor < o.Minor:
+		return -1, nil
+	case m.Minor > o.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Decimal formats the amount in major units without the currency, such
+// as "12.50". Amounts in unknown currencies are shown in minor units.
+func (m Money) Decimal() string {
+	exp := exponents[m.Currency]
+	s := strconv.FormatUint(abs(m.Minor), 10)
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+		s = s[:len(s)-exp] + "." + s[len(s)-exp:]
+	}
+	if m.Minor < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// String formats m as "12.50 INR".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount":"12.50","currency":"INR"} and the
+// zero Money as null.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m == (Money{}) {
+		return []byte("null"), nil
+	}
+	if _, err := Exponent(m.Currency); err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+// UnmarshalJSON decodes {"amount":"12.50","currency":"INR"}. The amount
+// may also be a JSON number; it is read as written, never through a
+// float, and must not have more decimals than the currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*m = Money{}
+		return nil
+	}
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	amount := string(v.Amount)
+	if len(v.Amount) > 0 && v.Amount[0] == '"' {
+		if err := json.Unmarshal(v.Amount, &amount); err != nil {
+			return err
+		}
+	}
+	parsed, err := Parse(amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ParseRate reads an exchange rate written as a positive decimal, such
+// as "0.0120".
+func ParseRate(s string) (*big.Rat, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if whole+frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("money: invalid rate %q", s)
+	}
+	r, ok := new(big.Rat).SetString(whole + "." + frac + "0")
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("money: invalid rate %q", s)
+	}
+	return r, nil
+}
+
+// Convert returns m in currency to at rate units of to per unit of m's
+// currency, rounded to the nearest minor unit of to, halves away from
+// zero.
+func Convert(m Money, to string, rate *big.Rat) (Money, error) {
+	from, err := Exponent(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	to, err = Currency(to)
+	if err != nil {
+		return Money{}, err
+	}
+	x := new(big.Rat).SetInt64(m.Minor)
+	x.Mul(x, rate)
+	shift := exponents[to] - from
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(shift, -shift))), nil))
+	if shift >= 0 {
+		x.Mul(x, scale)
+	} else {
+		x.Quo(x, scale)
+	}
+
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(x.Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: q.Int64(), Currency: to}, nil
+}
@@ -0,0 +1,179 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         Money
+		wantErr      error
+	}{
+		{"12.5", "INR", Money{1250, "INR"}, nil},
+		{"12.50", "inr", Money{1250, "INR"}, nil},
+		{"-0.07", "USD", Money{-7, "USD"}, nil},
+		{".5", "EUR", Money{50, "EUR"}, nil},
+		{"1500", "JPY", Money{1500, "JPY"}, nil},
+		{"1.234", "KWD", Money{1234, "KWD"}, nil},
+		{"1.5", "JPY", Money{}, ErrPrecision},
+		{"0.001", "INR", Money{}, ErrPrecision},
+		{"1e3", "INR", Money{}, ErrSyntax},
+		{"1,000", "INR", Money{}, ErrSyntax},
+		{".", "INR", Money{}, ErrSyntax},
+		{"", "INR", Money{}, ErrSyntax},
+		{"99999999999999999999", "INR", Money{}, ErrOverflow},
+		{"1", "XYZ", Money{}, ErrCurrency},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Parse(%q, %q) = %v, %v; want %v, %v", tt.in, tt.currency, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{1250, "INR"}, "12.50 INR"},
+		{Money{5, "USD"}, "0.05 USD"},
+		{Money{-105, "EUR"}, "-1.05 EUR"},
+		{Money{1500, "JPY"}, "1500 JPY"},
+		{Money{1, "KWD"}, "0.001 KWD"},
+		{Money{math.MinInt64, "INR"}, "-92233720368547758.08 INR"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	got, err := FromFloat(0.1+0.2, "INR")
+	if err != nil || got != (Money{30, "INR"}) {
+		t.Errorf("FromFloat(0.1+0.2) = %v, %v", got, err)
+	}
+	got, err = FromFloat(19.999, "USD")
+	if err != nil || got != (Money{2000, "USD"}) {
+		t.Errorf("FromFloat(19.999) = %v, %v", got, err)
+	}
+	if _, err := FromFloat(math.NaN(), "INR"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("FromFloat(NaN) err = %v", err)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	inr := func(n int64) Money { return Money{n, "INR"} }
+
+	sum, err := inr(1050).Add(inr(-50))
+	if err != nil || sum != inr(1000) {
+		t.Errorf("Add = %v, %v", sum, err)
+	}
+	total := Money{}
+	for _, m := range []Money{inr(10), inr(20)} {
+		if total, err = total.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total != inr(30) {
+		t.Errorf("total from zero Money = %v", total)
+	}
+	if _, err := inr(1).Add(Money{1, "USD"}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("adding USD to INR err = %v", err)
+	}
+	if _, err := inr(math.MaxInt64).Add(inr(1)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add overflow err = %v", err)
+	}
+	if _, err := inr(math.MinInt64).Sub(inr(1)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sub overflow err = %v", err)
+	}
+	if p, err := inr(-250).Mul(3); err != nil || p != inr(-750) {
+		t.Errorf("Mul = %v, %v", p, err)
+	}
+	if _, err := inr(math.MaxInt64 / 2).Mul(3); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul overflow err = %v", err)
+	}
+	if c, err := inr(5).Cmp(inr(7)); err != nil || c != -1 {
+		t.Errorf("Cmp = %d, %v", c, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(struct {
+		Price Money `json:"price"`
+		None  Money `json:"none"`
+	}{Price: Money{1250, "INR"}})
+	if err != nil || string(b) != `{"price":{"amount":"12.50","currency":"INR"},"none":null}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+
+	for in, want := range map[string]Money{
+		`{"amount":"12.50","currency":"INR"}`: {1250, "INR"},
+		`{"amount":12.5,"currency":"usd"}`:    {1250, "USD"},
+		`{"amount":1e2,"currency":"INR"}`:     {},
+		`{"amount":"1.005","currency":"INR"}`: {},
+		`{"amount":"1","currency":"ABC"}`:     {},
+		`null`:                                {},
+	} {
+		var got Money
+		err := json.Unmarshal([]byte(in), &got)
+		if got != want || (err == nil) != (want != Money{} || in == "null") {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestBSON(t *testing.T) {
+	b, err := bson.Marshal(bson.M{"price": Money{1250, "INR"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Price struct {
+			Amount   int64
+			Currency string
+		}
+	}
+	if err := bson.Unmarshal(b, &doc); err != nil || doc.Price.Amount != 1250 || doc.Price.Currency != "INR" {
+		t.Errorf("stored as %+v, %v", doc, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		m    Money
+		to   string
+		rate string
+		want Money
+	}{
+		{Money{10000, "INR"}, "USD", "0.012", Money{120, "USD"}},
+		{Money{1, "INR"}, "USD", "0.5", Money{1, "USD"}},   // half a cent rounds up
+		{Money{-1, "INR"}, "USD", "0.5", Money{-1, "USD"}}, // and away from zero
+		{Money{1000, "USD"}, "JPY", "151.37", Money{1514, "JPY"}},
+		{Money{1514, "JPY"}, "KWD", "0.00203", Money{3073, "KWD"}},
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Convert(tt.m, tt.to, rate)
+		if err != nil || got != tt.want {
+			t.Errorf("Convert(%v, %s, %s) = %v, %v; want %v", tt.m, tt.to, tt.rate, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"0", "-1", "1/3", "1e2", ""} {
+		if _, err := ParseRate(bad); err == nil {
+			t.Errorf("ParseRate(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package mq
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"naevis/apierr"
+	"naevis/logx"
+	"naevis/models"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/redis/go-redis/v9"
+)
+
+// knownStreams are the streams exposed through the admin endpoints.
+var knownStreams = []string{StreamIndexing, StreamHashtags, StreamImages, StreamMail}
+
+func isKnownStream(name string) bool {
+	for _, s := range knownStreams {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetter is a message that exhausted its retries.
+type DeadLetter struct {
+	ID          string          `json:"id"`
+	OriginalID  string          `json:"original_id"`
+	Group       string          `json:"group"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int64           `json:"attempts"`
+	Error       string          `json:"error"`
+	PublishedAt string          `json:"published_at"`
+	RequestID   string          `json:"request_id,omitempty"`
+	FailedAt    string          `json:"failed_at"`
+}
+
+func toDeadLetter(x redis.XMessage) DeadLetter {
+	str := func(k string) string {
+		v, _ := x.Values[k].(string)
+		return v
+	}
+	attempts, _ := strconv.ParseInt(str("attempts"), 10, 64)
+	return DeadLetter{
+		ID:          x.ID,
+		OriginalID:  str("original_id"),
+		Group:       str("group"),
+		Event:       str("event"),
+		Payload:     json.RawMessage(str("payload")),
+		Attempts:    attempts,
+		Error:       str("error"),
+		PublishedAt: str("published_at"),
+		RequestID:   str("request_id"),
+		FailedAt:    str("failed_at"),
+	}
+}
+
+// StreamStats summarises a stream for the admin overview.
+type StreamStats struct {
+	Stream      string `json:"stream"`
+	Length      int64  `json:"length"`
+	Pending     int64  `json:"pending"`
+	DeadLetters int64  `json:"dead_letters"`
+}
+
+// GetStreams returns length, pending and dead-letter counts for every stream.
+// GET /api/v1/admin/mq/streams
+func GetStreams(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	out := make([]StreamStats, 0, len(knownStreams))
+	for _, s := range knownStreams {
+		st := StreamStats{Stream: s}
+		st.Length, _ = rdx.Conn.XLen(ctx, s).Result()
+		st.DeadLetters, _ = rdx.Conn.XLen(ctx, DeadLetterStream(s)).Result()
+		if groups, err := rdx.Conn.XInfoGroups(ctx, s).Result(); err == nil {
+			for _, g := range groups {
+				st.Pending += g.Pending
+			}
+		}
+		out = append(out, st)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"streams": out})
+}
+
+// GetDeadLetters lists the newest dead letters of a stream.
+// GET /api/v1/admin/mq/dead/:stream?count=50
+func GetDeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	stream := ps.ByName("stream")
+	if !isKnownStream(stream) {
+		apierr.Respond(w, http.StatusNotFound, "unknown stream")
+		return
+	}
+
+	count, _ := strconv.ParseInt(r.URL.Query().Get("count"), 10, 64)
+	if count <= 0 || count > 500 {
+		count = 50
+	}
+
+	msgs, err := rdx.Conn.XRevRangeN(r.Context(), DeadLetterStream(stream), "+", "-", count).Result()
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read dead letters")
+		return
+	}
+
+	out := make([]DeadLetter, 0, len(msgs))
+	for _, x := range msgs {
+		out = append(out, toDeadLetter(x))
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"stream":       stream,
+		"dead_letters": out,
+	})
+}
+
+// ReplayDeadLetter re-publishes a dead letter to its original stream and
+// removes it from the dead-letter stream.
+// POST /api/v1/admin/mq/dead/:stream/:id/replay
+func ReplayDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	stream, id := ps.ByName("stream"), ps.ByName("id")
+	if !isKnownStream(stream) {
+		apierr.Respond(w, http.StatusNotFound, "unknown stream")
+		return
+	}
+
+	msgs, err := rdx.Conn.XRange(ctx, DeadLetterStream(stream), id, id).Result()
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read dead letter")
+		return
+	}
+	if len(msgs) == 0 {
+		apierr.Respond(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+
+	dl := toDeadLetter(msgs[0])
+	newID, err := publishRaw(logx.WithRequestID(ctx, dl.RequestID), stream, dl.Event, dl.Payload)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to replay")
+		return
+	}
+	rdx.Conn.XDel(ctx, DeadLetterStream(stream), id)
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"replayed": id,
+		"new_id":   newID,
+	})
+}
+
+// DiscardDeadLetter drops a dead letter without replaying it.
+// DELETE /api/v1/admin/mq/dead/:stream/:id
+func DiscardDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	stream, id := ps.ByName("stream"), ps.ByName("id")
+	if !isKnownStream(stream) {
+		apierr.Respond(w, http.StatusNotFound, "unknown stream")
+		return
+	}
+
+	n, err := rdx.Conn.XDel(r.Context(), DeadLetterStream(stream), id).Result()
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to discard")
+		return
+	}
+	if n == 0 {
+		apierr.Respond(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"discarded": id})
+}
+
+// EventHandler accepts an indexing event over HTTP and queues it on the
+// indexing stream.
+// POST /api/v1/emitted
+func EventHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var event models.Index
+	if err := json.Unmarshal(body, &event); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if _, err := Publish(r.Context(), StreamIndexing, "external-"+event.Method, event); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to enqueue indexing job")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, map[string]any{"message": "Event queued successfully"})
+}
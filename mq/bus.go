@@ -0,0 +1,374 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"naevis/logx"
+	"naevis/rdx"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream names used by the event bus.
+const (
+	StreamIndexing = "indexing-events"
+	StreamHashtags = "hashtag-events"
+	StreamImages   = "getting-images"
+	StreamMail     = "outgoing-mail"
+)
+
+// deadLetterSuffix is appended to a stream name to form its dead-letter stream.
+const deadLetterSuffix = ":dead"
+
+// streamMaxLen caps every stream (approximately) so Redis memory stays bounded.
+const streamMaxLen = 100000
+
+// Message is a single entry read from a stream.
+type Message struct {
+	ID          string          `json:"id"`
+	Stream      string          `json:"stream"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	PublishedAt time.Time       `json:"published_at"`
+	RequestID   string          `json:"request_id,omitempty"`
+	Attempts    int64           `json:"attempts"`
+}
+
+// Decode unmarshals the message payload into v.
+func (m Message) Decode(v any) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Handler processes a message. Returning an error leaves the message pending
+// so it is retried with backoff and eventually dead-lettered.
+type Handler func(ctx context.Context, msg Message) error
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the consumer dead-letters the message immediately
+// instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// DeadLetterStream returns the name of the dead-letter stream for stream.
+func DeadLetterStream(stream string) string {
+	return stream + deadLetterSuffix
+}
+
+// Publish appends an event to a stream and returns its entry ID. The
+// request ID in ctx, if any, travels with the entry.
+func Publish(ctx context.Context, stream, event string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal %s payload: %w", event, err)
+	}
+	return publishRaw(ctx, stream, event, data)
+}
+
+func publishRaw(ctx context.Context, stream, event string, data []byte) (string, error) {
+	values := map[string]any{
+		"event":        event,
+		"payload":      string(data),
+		"published_at": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if rid := logx.RequestID(ctx); rid != "" {
+		values["request_id"] = rid
+	}
+	id, err := rdx.Conn.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: values,
+	}).Result()
+	if err != nil {
+		publishedTotal.Inc(stream, "error")
+		return "", fmt.Errorf("xadd %s: %w", stream, err)
+	}
+	publishedTotal.Inc(stream, "ok")
+	return id, nil
+}
+
+// toMessage converts a raw stream entry into a Message.
+func toMessage(stream string, x redis.XMessage) Message {
+	msg := Message{ID: x.ID, Stream: stream}
+	if v, ok := x.Values["event"].(string); ok {
+		msg.Event = v
+	}
+	if v, ok := x.Values["payload"].(string); ok {
+		msg.Payload = json.RawMessage(v)
+	}
+	if v, ok := x.Values["published_at"].(string); ok {
+		msg.PublishedAt, _ = time.Parse(time.RFC3339Nano, v)
+	}
+	if v, ok := x.Values["request_id"].(string); ok {
+		msg.RequestID = v
+	}
+	return msg
+}
+
+// Consumer reads a stream as a member of a consumer group. Messages are
+// acknowledged only after Handler succeeds; failures are retried with
+// exponential backoff and moved to the dead-letter stream after MaxRetries.
+type Consumer struct {
+	Stream     string
+	Group      string
+	Name       string
+	Handler    Handler
+	MaxRetries int64
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Batch      int64
+	Block      time.Duration
+	Timeout    time.Duration
+}
+
+// NewConsumer returns a consumer with the default retry policy.
+func NewConsumer(stream, group string, h Handler) *Consumer {
+	return &Consumer{
+		Stream:     stream,
+		Group:      group,
+		Name:       consumerName(),
+		Handler:    h,
+		MaxRetries: 5,
+		MinBackoff: 2 * time.Second,
+		MaxBackoff: 5 * time.Minute,
+		Batch:      16,
+		Block:      5 * time.Second,
+		Timeout:    30 * time.Second,
+	}
+}
+
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "naevis"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// Run blocks until ctx is cancelled, processing new messages and retrying
+// pending ones.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.ensureGroup(ctx); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "mq consumer started", "stream", c.Stream, "group", c.Group, "consumer", c.Name)
+
+	worker := "consumer:" + c.Stream + "/" + c.Group
+	lastRetry := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		heartbeat(worker)
+
+		if time.Since(lastRetry) >= c.MinBackoff {
+			if err := c.retryPending(ctx); err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "mq retry scan failed", "stream", c.Stream, "group", c.Group, "error", err)
+			}
+			lastRetry = time.Now()
+		}
+
+		streams, err := rdx.Conn.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.Group,
+			Consumer: c.Name,
+			Streams:  []string{c.Stream, ">"},
+			Count:    c.Batch,
+			Block:    c.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				if err := c.ensureGroup(ctx); err != nil {
+					slog.ErrorContext(ctx, "mq group recreate failed", "stream", c.Stream, "group", c.Group, "error", err)
+				}
+				continue
+			}
+			slog.WarnContext(ctx, "mq read failed", "stream", c.Stream, "group", c.Group, "error", err)
+			sleepCtx(ctx, time.Second)
+			continue
+		}
+
+		for _, s := range streams {
+			for _, x := range s.Messages {
+				msg := toMessage(c.Stream, x)
+				msg.Attempts = 1
+				c.handle(ctx, msg)
+			}
+		}
+	}
+}
+
+func (c *Consumer) ensureGroup(ctx context.Context) error {
+	err := rdx.Conn.XGroupCreateMkStream(ctx, c.Stream, c.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create group %s on %s: %w", c.Group, c.Stream, err)
+	}
+	return nil
+}
+
+// handle runs the handler and acknowledges on success. On failure the last
+// error is recorded so it can be attached to the dead letter later. The
+// handler context carries the request ID of the HTTP request that caused
+// the event.
+func (c *Consumer) handle(ctx context.Context, msg Message) {
+	ctx = logx.WithRequestID(ctx, msg.RequestID)
+	hctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	err := c.safeHandle(hctx, msg)
+	cancel()
+
+	if err == nil {
+		consumedTotal.Inc(c.Stream, c.Group, "ok")
+		if err := rdx.Conn.XAck(ctx, c.Stream, c.Group, msg.ID).Err(); err != nil {
+			slog.ErrorContext(ctx, "mq ack failed", "stream", c.Stream, "group", c.Group, "id", msg.ID, "error", err)
+		}
+		rdx.Conn.HDel(ctx, c.errorsKey(), msg.ID)
+		return
+	}
+
+	consumedTotal.Inc(c.Stream, c.Group, "error")
+	slog.WarnContext(ctx, "mq handler failed",
+		"stream", c.Stream, "group", c.Group, "id", msg.ID,
+		"event", msg.Event, "attempt", msg.Attempts, "error", err)
+
+	var perm permanentError
+	if errors.As(err, &perm) {
+		c.deadLetter(ctx, msg, msg.Attempts, err.Error())
+		return
+	}
+	rdx.Conn.HSet(ctx, c.errorsKey(), msg.ID, err.Error())
+}
+
+func (c *Consumer) safeHandle(ctx context.Context, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return c.Handler(ctx, msg)
+}
+
+func (c *Consumer) errorsKey() string {
+	return "mq:errors:" + c.Stream + ":" + c.Group
+}
+
+// backoff returns how long a message must sit idle before its next attempt.
+func (c *Consumer) backoff(attempts int64) time.Duration {
+	d := c.MinBackoff
+	for i := int64(1); i < attempts && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+// retryPending claims messages whose backoff has elapsed and either
+// re-runs them or moves them to the dead-letter stream.
+func (c *Consumer) retryPending(ctx context.Context) error {
+	pending, err := rdx.Conn.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.Stream,
+		Group:  c.Group,
+		Idle:   c.MinBackoff,
+		Start:  "-",
+		End:    "+",
+		Count:  c.Batch * 4,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		if p.Idle < c.backoff(p.RetryCount) {
+			continue
+		}
+
+		claimed, err := rdx.Conn.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   c.Stream,
+			Group:    c.Group,
+			Consumer: c.Name,
+			MinIdle:  c.backoff(p.RetryCount),
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(claimed) == 0 {
+			// Another consumer claimed it first, or the entry was trimmed.
+			continue
+		}
+
+		msg := toMessage(c.Stream, claimed[0])
+		msg.Attempts = p.RetryCount + 1
+		if p.RetryCount >= c.MaxRetries {
+			lastErr, _ := rdx.Conn.HGet(ctx, c.errorsKey(), msg.ID).Result()
+			c.deadLetter(ctx, msg, p.RetryCount, lastErr)
+			continue
+		}
+		c.handle(ctx, msg)
+	}
+	return nil
+}
+
+// deadLetter copies msg to the dead-letter stream and acknowledges it.
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, attempts int64, lastErr string) {
+	ctx = logx.WithRequestID(ctx, msg.RequestID)
+	err := rdx.Conn.XAdd(ctx, &redis.XAddArgs{
+		Stream: DeadLetterStream(c.Stream),
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]any{
+			"event":        msg.Event,
+			"payload":      string(msg.Payload),
+			"published_at": msg.PublishedAt.Format(time.RFC3339Nano),
+			"request_id":   msg.RequestID,
+			"original_id":  msg.ID,
+			"group":        c.Group,
+			"attempts":     attempts,
+			"error":        lastErr,
+			"failed_at":    time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}).Err()
+	if err != nil {
+		slog.ErrorContext(ctx, "mq dead-letter failed", "stream", c.Stream, "group", c.Group, "id", msg.ID, "error", err)
+		return
+	}
+
+	rdx.Conn.XAck(ctx, c.Stream, c.Group, msg.ID)
+	rdx.Conn.HDel(ctx, c.errorsKey(), msg.ID)
+	consumedTotal.Inc(c.Stream, c.Group, "dead_letter")
+	slog.ErrorContext(ctx, "mq message dead-lettered",
+		"stream", c.Stream, "group", c.Group, "id", msg.ID,
+		"event", msg.Event, "attempts", attempts, "error", lastErr)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,248 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"naevis/logx"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func useMemRedis(t *testing.T) {
+	t.Helper()
+	client := memredis.NewClient()
+	rdx.Use(client)
+	t.Cleanup(func() { client.Close() })
+}
+
+// runConsumer starts a consumer with short backoffs on stream and stops
+// it when the test ends. Handler calls are recorded in order.
+func runConsumer(t *testing.T, stream string, maxRetries int64, h Handler) *calls {
+	t.Helper()
+	rec := &calls{}
+	c := NewConsumer(stream, "test", func(ctx context.Context, msg Message) error {
+		rec.add(msg)
+		return h(ctx, msg)
+	})
+	c.MaxRetries = maxRetries
+	c.MinBackoff = 20 * time.Millisecond
+	c.MaxBackoff = 80 * time.Millisecond
+	c.Block = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return rec
+}
+
+// calls records the messages a handler was given and when.
+type calls struct {
+	mu   sync.Mutex
+	msgs []Message
+	at   []time.Time
+}
+
+func (c *calls) add(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msg)
+	c.at = append(c.at, time.Now())
+}
+
+func (c *calls) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.msgs)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func pending(t *testing.T, stream string) int64 {
+	t.Helper()
+	p, err := rdx.Conn.XPending(context.Background(), stream, "test").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Count
+}
+
+func deadLetters(t *testing.T, stream string) []DeadLetter {
+	t.Helper()
+	msgs, err := rdx.Conn.XRange(context.Background(), DeadLetterStream(stream), "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]DeadLetter, 0, len(msgs))
+	for _, x := range msgs {
+		out = append(out, toDeadLetter(x))
+	}
+	return out
+}
+
+func TestConsumerAcksOnSuccess(t *testing.T) {
+	useMemRedis(t)
+	ctx := logx.WithRequestID(context.Background(), "req-1")
+	if _, err := Publish(ctx, "s", "thing-created", map[string]string{"id": "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	rec := runConsumer(t, "s", 3, func(context.Context, Message) error { return nil })
+
+	waitFor(t, "the handler", func() bool { return rec.len() == 1 })
+	waitFor(t, "the ack", func() bool { return pending(t, "s") == 0 })
+	got := rec.msgs[0]
+	var payload map[string]string
+	if got.Event != "thing-created" || got.RequestID != "req-1" || got.Attempts != 1 || got.Decode(&payload) != nil || payload["id"] != "t1" {
+		t.Errorf("handled %+v", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := rec.len(); n != 1 {
+		t.Errorf("handled %d times after an ack, want 1", n)
+	}
+}
+
+func TestConsumerRetriesWithBackoff(t *testing.T) {
+	useMemRedis(t)
+	if _, err := Publish(context.Background(), "s", "flaky", nil); err != nil {
+		t.Fatal(err)
+	}
+	rec := runConsumer(t, "s", 5, func(_ context.Context, msg Message) error {
+		if msg.Attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+
+	waitFor(t, "the third attempt", func() bool { return rec.len() == 3 })
+	waitFor(t, "the ack", func() bool { return pending(t, "s") == 0 })
+	for i, msg := range rec.msgs {
+		if msg.Attempts != int64(i+1) {
+			t.Errorf("call %d saw attempt %d", i, msg.Attempts)
+		}
+	}
+	// Each retry waits at least the backoff for its attempt.
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := rec.at[i+1].Sub(rec.at[i]); gap < want {
+			t.Errorf("retry %d after %v, want at least %v", i+1, gap, want)
+		}
+	}
+	if n, _ := rdx.Conn.HLen(context.Background(), "mq:errors:s:test").Result(); n != 0 {
+		t.Errorf("%d errors kept after success", n)
+	}
+	if dl := deadLetters(t, "s"); len(dl) != 0 {
+		t.Errorf("dead letters = %+v", dl)
+	}
+}
+
+func TestConsumerDeadLettersAfterMaxRetries(t *testing.T) {
+	useMemRedis(t)
+	if _, err := Publish(context.Background(), "s", "broken", nil); err != nil {
+		t.Fatal(err)
+	}
+	rec := runConsumer(t, "s", 2, func(context.Context, Message) error { return errors.New("boom") })
+
+	waitFor(t, "the dead letter", func() bool { return len(deadLetters(t, "s")) == 1 })
+	dl := deadLetters(t, "s")[0]
+	if dl.Event != "broken" || dl.Group != "test" || dl.Attempts != 2 || dl.Error != "boom" {
+		t.Errorf("dead letter = %+v", dl)
+	}
+	if n := rec.len(); n != 2 {
+		t.Errorf("handled %d times, want 2", n)
+	}
+	if n := pending(t, "s"); n != 0 {
+		t.Errorf("%d still pending after dead-lettering", n)
+	}
+}
+
+func TestConsumerDeadLettersPermanentAtOnce(t *testing.T) {
+	useMemRedis(t)
+	if _, err := Publish(context.Background(), "s", "malformed", nil); err != nil {
+		t.Fatal(err)
+	}
+	rec := runConsumer(t, "s", 5, func(context.Context, Message) error {
+		return Permanent(errors.New("cannot decode"))
+	})
+
+	waitFor(t, "the dead letter", func() bool { return len(deadLetters(t, "s")) == 1 })
+	if dl := deadLetters(t, "s")[0]; dl.Attempts != 1 || dl.Error != "cannot decode" {
+		t.Errorf("dead letter = %+v", dl)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := rec.len(); n != 1 {
+		t.Errorf("handled %d times, want 1", n)
+	}
+	if n := pending(t, "s"); n != 0 {
+		t.Errorf("%d still pending after dead-lettering", n)
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	useMemRedis(t)
+	ctx := logx.WithRequestID(context.Background(), "req-9")
+	if _, err := Publish(ctx, StreamMail, "mail", map[string]string{"to": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	fail := true
+	var mu sync.Mutex
+	rec := runConsumer(t, StreamMail, 5, func(context.Context, Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return Permanent(errors.New("server down"))
+		}
+		return nil
+	})
+	waitFor(t, "the dead letter", func() bool { return len(deadLetters(t, StreamMail)) == 1 })
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	id := deadLetters(t, StreamMail)[0].ID
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/mq/dead/"+StreamMail+"/"+id+"/replay", nil)
+	ReplayDeadLetter(w, r, httprouter.Params{{Key: "stream", Value: StreamMail}, {Key: "id", Value: id}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay = %d %s", w.Code, w.Body)
+	}
+
+	waitFor(t, "the replayed message", func() bool { return rec.len() == 2 })
+	waitFor(t, "the ack", func() bool { return pending(t, StreamMail) == 0 })
+	got := rec.msgs[1]
+	var payload map[string]string
+	if got.Event != "mail" || got.RequestID != "req-9" || got.Attempts != 1 || got.Decode(&payload) != nil || payload["to"] != "ann" {
+		t.Errorf("replayed %+v", got)
+	}
+	if dl := deadLetters(t, StreamMail); len(dl) != 0 {
+		t.Errorf("dead letters after replay = %+v", dl)
+	}
+
+	// A dead letter can be replayed only once.
+	w = httptest.NewRecorder()
+	ReplayDeadLetter(w, r, httprouter.Params{{Key: "stream", Value: StreamMail}, {Key: "id", Value: id}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second replay = %d, want 404", w.Code)
+	}
+}
@@ -2,11 +2,10 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"naevis/models"
-	"naevis/rdx"
 	"naevis/search"
 )
 
@@ -25,44 +24,29 @@ func Notify(eventName string, content models.Index) error {
 	return nil
 }
 
-// Emit now publishes indexing events to Redis instead of running immediately
-func Emit(ctx context.Context, eventName string, content models.Index) {
-	log.Printf("[Emit] START eventName=%s content=%+v", eventName, content)
-
-	data, err := json.Marshal(content)
-	if err != nil {
-		log.Printf("[Emit] Failed to marshal event content: %v", err)
-		return
-	}
-
-	if err := rdx.Conn.Publish(context.Background(), "indexing-events", data).Err(); err != nil {
-		log.Printf("[Emit] Failed to publish event to Redis: %v", err)
-		return
+// Emit records an indexing event in the outbox; the relay publishes it to
+// the indexing stream. Pass the ctx from db.RunInTransaction so the event
+// commits together with the entity change.
+func Emit(ctx context.Context, eventName string, content models.Index) error {
+	if err := Enqueue(ctx, StreamIndexing, eventName, content); err != nil {
+		slog.ErrorContext(ctx, "emit enqueue failed", "event", eventName, "error", err)
+		return err
 	}
-
-	log.Printf("[Emit] Event published to channel 'indexing-events'")
-	log.Printf("[Emit] END")
+	return nil
 }
 
-func StartIndexingWorker() {
-	ctx := context.Background()
-	sub := rdx.Conn.Subscribe(ctx, "indexing-events")
-	ch := sub.Channel()
-
-	log.Println("[IndexingWorker] Listening for indexing events...")
-
-	for msg := range ch {
+// StartIndexingWorker consumes the indexing stream and keeps the search
+// index in sync. It blocks until ctx is cancelled.
+func StartIndexingWorker(ctx context.Context) {
+	c := NewConsumer(StreamIndexing, "search-indexer", func(ctx context.Context, msg Message) error {
 		var event models.Index
-		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
-			log.Printf("[IndexingWorker] Failed to parse event: %v", err)
-			continue
-		}
-		log.Printf("[IndexingWorker] Processing event=%+v", event)
-
-		if err := search.IndexDatainRedis(ctx, event); err != nil {
-			log.Printf("[IndexingWorker] IndexDatainRedis error: %v", err)
-		} else {
-			log.Println("[IndexingWorker] Indexing complete")
+		if err := msg.Decode(&event); err != nil {
+			// A malformed payload will never succeed; dead-letter it right away.
+			return Permanent(fmt.Errorf("decode indexing event: %w", err))
 		}
+		return search.IndexDatainRedis(ctx, event)
+	})
+	if err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("[IndexingWorker] stopped: %v", err)
 	}
 }
@@ -2,10 +2,10 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
 	"naevis/db"
-	"naevis/rdx"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,9 +22,9 @@ type HashtagEvent struct {
 	HashtagName string `json:"hashtag_name"`
 }
 
-// EmitHashtagEvents publishes one event per hashtag (to a Redis Pub/Sub channel).
-func EmitHashtagEvent(tagType string, postID string, hashtags []string) {
-	ctx := context.Background()
+// EmitHashtagEvent records one outbox event per hashtag. Like Emit, pass the
+// transaction ctx so the events commit with the post.
+func EmitHashtagEvent(ctx context.Context, tagType string, postID string, hashtags []string) error {
 	for _, tag := range hashtags {
 		evt := HashtagEvent{
 			EntityType:  tagType,
@@ -32,69 +32,61 @@ func EmitHashtagEvent(tagType string, postID string, hashtags []string) {
 			HashtagName: tag,
 		}
 
-		data, err := json.Marshal(evt)
-		if err != nil {
-			log.Printf("[EmitHashtagEvent] marshal error for %s: %v", tag, err)
-			continue
-		}
-
-		log.Println(evt)
-
-		if err := rdx.Conn.Publish(ctx, "hashtag-events", data).Err(); err != nil {
-			log.Printf("[EmitHashtagEvent] publish error for %s: %v", tag, err)
-		} else {
-			log.Printf("[EmitHashtagEvent] published hashtag event: %+v", evt)
+		if err := Enqueue(ctx, StreamHashtags, "hashtag-linked", evt); err != nil {
+			slog.ErrorContext(ctx, "hashtag enqueue failed", "hashtag", tag, "error", err)
+			return err
 		}
 	}
+	return nil
 }
 
-func StartHashtagWorker() {
-	ctx := context.Background()
-	sub := rdx.Conn.Subscribe(ctx, "hashtag-events")
-	ch := sub.Channel()
-
-	log.Println("[HashtagWorker] Listening for hashtag events...")
-
-	for msg := range ch {
-		var evt HashtagEvent
-		if err := json.Unmarshal([]byte(msg.Payload), &evt); err != nil {
-			log.Printf("[HashtagWorker] unmarshal error: %v", err)
-			continue
-		}
+// StartHashtagWorker consumes the hashtag stream and maintains hashtag
+// post lists and counts. It blocks until ctx is cancelled.
+func StartHashtagWorker(ctx context.Context) {
+	c := NewConsumer(StreamHashtags, "hashtag-counter", handleHashtagEvent)
+	if err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("[HashtagWorker] stopped: %v", err)
+	}
+}
 
-		filter := bson.M{
-			"name":       evt.HashtagName,
-			"entitytype": evt.EntityType,
-		}
+func handleHashtagEvent(ctx context.Context, msg Message) error {
+	var evt HashtagEvent
+	if err := msg.Decode(&evt); err != nil {
+		return Permanent(fmt.Errorf("unmarshal hashtag event: %w", err))
+	}
 
-		// Check if this post is already linked
-		existsFilter := bson.M{
-			"name":       evt.HashtagName,
-			"entitytype": evt.EntityType,
-			"posts":      evt.EntityID,
-		}
-		count, err := db.HashtagCollection.CountDocuments(ctx, existsFilter)
-		if err != nil {
-			log.Printf("[HashtagWorker] count error: %v", err)
-			continue
-		}
+	filter := bson.M{
+		"name":       evt.HashtagName,
+		"entitytype": evt.EntityType,
+	}
 
-		update := bson.M{
-			"$set": bson.M{"updatedat": time.Now()},
-			"$addToSet": bson.M{
-				"posts": evt.EntityID,
-			},
-		}
-		if count == 0 {
-			update["$inc"] = bson.M{"totalposts": 1}
-		}
+	// Check if this post is already linked
+	existsFilter := bson.M{
+		"name":       evt.HashtagName,
+		"entitytype": evt.EntityType,
+		"posts":      evt.EntityID,
+	}
+	count, err := db.HashtagCollection.CountDocuments(ctx, existsFilter)
+	if err != nil {
+		return fmt.Errorf("count hashtag %s: %w", evt.HashtagName, err)
+	}
 
-		opts := options.Update().SetUpsert(true)
-		if _, err := db.HashtagCollection.UpdateOne(ctx, filter, update, opts); err != nil {
-			log.Printf("[HashtagWorker] update error: %v", err)
-			continue
-		}
+	update := bson.M{
+		"$set": bson.M{"updatedat": time.Now()},
+		"$addToSet": bson.M{
+			"posts": evt.EntityID,
+		},
+	}
+	if count == 0 {
+		update["$inc"] = bson.M{"totalposts": 1}
+	}
 
-		log.Printf("[HashtagWorker] processed hashtag: %s for entity %s (%s)", evt.HashtagName, evt.EntityID, evt.EntityType)
+	opts := options.Update().SetUpsert(true)
+	if _, err := db.HashtagCollection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("update hashtag %s: %w", evt.HashtagName, err)
 	}
+
+	slog.DebugContext(ctx, "hashtag processed",
+		"hashtag", evt.HashtagName, "entity_id", evt.EntityID, "entity_type", evt.EntityType)
+	return nil
 }
@@ -2,14 +2,13 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"naevis/rdx"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
+
+	"naevis/config"
 )
 
 type ImageEvent struct {
@@ -20,18 +19,16 @@ type ImageEvent struct {
 	Userid    string `json:"userid"`
 }
 
-// Config cache so we don't keep re-reading env vars
+// Public URL settings; set by Configure.
 var (
-	publicBaseURL     string
+	publicBaseURL     = "http://localhost:4000"
 	publicStripPrefix string
 )
 
-func init() {
-	publicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
-	if publicBaseURL == "" {
-		publicBaseURL = "http://localhost:4000"
-	}
-	publicStripPrefix = filepath.ToSlash(strings.TrimRight(os.Getenv("PUBLIC_STRIP_PREFIX"), "/"))
+// Configure applies the loaded configuration to the mq package.
+func Configure(cfg *config.Config) {
+	publicBaseURL = strings.TrimRight(cfg.Public.BaseURL, "/")
+	publicStripPrefix = filepath.ToSlash(strings.TrimRight(cfg.Public.StripPrefix, "/"))
 }
 
 // ToPublicURL converts a local path into an accessible HTTP URL.
@@ -60,17 +57,12 @@ func NewImageEvent(localPath, entity, fileName, picType, userid string) ImageEve
 	}
 }
 
-// NotifyImageSaved publishes an ImageEvent to Redis.
+// NotifyImageSaved appends an ImageEvent to the image stream.
 func NotifyImageSaved(localPath, entity, fileName, picType, userid string) error {
 	event := NewImageEvent(localPath, entity, fileName, picType, userid)
 
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("marshal image event: %w", err)
-	}
-
-	if err := rdx.Conn.Publish(context.Background(), "getting-images", data).Err(); err != nil {
-		return fmt.Errorf("publish to redis: %w", err)
+	if _, err := Publish(context.Background(), StreamImages, "image-saved", event); err != nil {
+		return fmt.Errorf("publish image event: %w", err)
 	}
 
 	log.Printf("[NotifyImageSaved] Published image event: %+v", event)
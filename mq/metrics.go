@@ -0,0 +1,53 @@
+package mq
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"naevis/metrics"
+)
+
+var (
+	publishedTotal = metrics.NewCounterVec("naevis_mq_published_total",
+		"Messages published to Redis streams.", "stream", "result")
+	consumedTotal = metrics.NewCounterVec("naevis_mq_consumed_total",
+		"Messages handled by consumer groups. result is ok, error or dead_letter.", "stream", "group", "result")
+)
+
+// Worker heartbeats. Each long-running loop beats once per iteration so the
+// readiness check can tell a stuck or exited worker from an idle one.
+var (
+	beatsMu sync.Mutex
+	beats   = map[string]time.Time{}
+)
+
+func heartbeat(worker string) {
+	beatsMu.Lock()
+	beats[worker] = time.Now()
+	beatsMu.Unlock()
+}
+
+// Heartbeat lets background loops outside this package, such as the
+// scheduler, report progress to the readiness check.
+func Heartbeat(worker string) { heartbeat(worker) }
+
+// WorkerStatus reports when a background worker last made progress.
+type WorkerStatus struct {
+	Name     string    `json:"name"`
+	LastBeat time.Time `json:"last_beat"`
+	Alive    bool      `json:"alive"`
+}
+
+// Workers returns every worker that has started, sorted by name. A worker
+// is alive if it has beaten within maxAge.
+func Workers(maxAge time.Duration) []WorkerStatus {
+	beatsMu.Lock()
+	defer beatsMu.Unlock()
+	out := make([]WorkerStatus, 0, len(beats))
+	for name, t := range beats {
+		out = append(out, WorkerStatus{Name: name, LastBeat: t, Alive: time.Since(t) <= maxAge})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
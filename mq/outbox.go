@@ -0,0 +1,260 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/logx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox row states.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxFailed    = "failed"
+)
+
+const (
+	outboxBatch       = 100
+	outboxPoll        = time.Second
+	outboxLease       = 30 * time.Second
+	outboxMaxAttempts = 20
+)
+
+// OutboxRecord is an event waiting to be relayed to the bus. It is written
+// with the same ctx (and therefore the same transaction) as the entity
+// change that produced it.
+type OutboxRecord struct {
+	ID            string     `bson:"_id" json:"id"`
+	Stream        string     `bson:"stream" json:"stream"`
+	Event         string     `bson:"event" json:"event"`
+	Payload       string     `bson:"payload" json:"payload"`
+	RequestID     string     `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	Status        string     `bson:"status" json:"status"`
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	LastError     string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	StreamID      string     `bson:"stream_id,omitempty" json:"stream_id,omitempty"`
+	CreatedAt     time.Time  `bson:"created_at" json:"created_at"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   time.Time  `bson:"locked_until" json:"locked_until"`
+	LockedBy      string     `bson:"locked_by,omitempty" json:"locked_by,omitempty"`
+	DeliveredAt   *time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+// outboxWake nudges the relay after an enqueue so delivery does not wait
+// for the next poll.
+var outboxWake = make(chan struct{}, 1)
+
+// relay counters, exposed through OutboxStats.
+var (
+	outboxDelivered atomic.Int64
+	outboxErrors    atomic.Int64
+	outboxLastRun   atomic.Int64
+)
+
+// Enqueue writes an event to the outbox. Call it with the ctx handed out by
+// db.RunInTransaction so the row commits or rolls back with the entity write.
+func Enqueue(ctx context.Context, stream, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s payload: %w", event, err)
+	}
+
+	now := time.Now().UTC()
+	rec := OutboxRecord{
+		ID:            utils.GetUUID(),
+		Stream:        stream,
+		Event:         event,
+		Payload:       string(data),
+		RequestID:     logx.RequestID(ctx),
+		Status:        OutboxPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+		LockedUntil:   now,
+	}
+	if _, err := db.OutboxCollection.InsertOne(ctx, rec); err != nil {
+		return fmt.Errorf("outbox insert %s: %w", event, err)
+	}
+
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StartOutboxRelay publishes pending outbox rows to their streams and marks
+// them delivered. Several instances may run it; rows are leased before
+// publishing so each is relayed by one instance at a time. It blocks until
+// ctx is cancelled.
+func StartOutboxRelay(ctx context.Context) {
+	owner := consumerName()
+	log.Printf("[OutboxRelay] started (%s)", owner)
+
+	ticker := time.NewTicker(outboxPoll)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining while full batches come back.
+		n := outboxBatch
+		for n == outboxBatch {
+			n = relayBatch(ctx, owner)
+		}
+		outboxLastRun.Store(time.Now().Unix())
+		heartbeat("outbox-relay")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outboxWake:
+		}
+	}
+}
+
+// relayBatch leases and publishes up to outboxBatch rows, returning how
+// many it processed.
+func relayBatch(ctx context.Context, owner string) int {
+	n := 0
+	for ; n < outboxBatch; n++ {
+		if ctx.Err() != nil {
+			return n
+		}
+		rec, err := leaseNext(ctx, owner)
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+				log.Printf("[OutboxRelay] lease failed: %v", err)
+			}
+			return n
+		}
+		relayOne(ctx, rec)
+	}
+	return n
+}
+
+func leaseNext(ctx context.Context, owner string) (OutboxRecord, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":          OutboxPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"locked_until": now.Add(outboxLease),
+		"locked_by":    owner,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var rec OutboxRecord
+	err := db.OutboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&rec)
+	return rec, err
+}
+
+func relayOne(ctx context.Context, rec OutboxRecord) {
+	streamID, err := publishRaw(logx.WithRequestID(ctx, rec.RequestID), rec.Stream, rec.Event, []byte(rec.Payload))
+	now := time.Now().UTC()
+
+	if err == nil {
+		outboxDelivered.Add(1)
+		_, uerr := db.OutboxCollection.UpdateOne(ctx, bson.M{"_id": rec.ID}, bson.M{
+			"$set": bson.M{
+				"status":       OutboxDelivered,
+				"stream_id":    streamID,
+				"delivered_at": now,
+			},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"locked_by": "", "last_error": ""},
+		})
+		if uerr != nil {
+			// The event is on the bus; a redelivery after the lease expires
+			// is harmless because consumers are idempotent.
+			log.Printf("[OutboxRelay] mark delivered %s failed: %v", rec.ID, uerr)
+		}
+		return
+	}
+
+	outboxErrors.Add(1)
+	attempts := rec.Attempts + 1
+	status := OutboxPending
+	if attempts >= outboxMaxAttempts {
+		status = OutboxFailed
+	}
+	backoff := time.Duration(1<<min(attempts, 10)) * time.Second
+	slog.WarnContext(logx.WithRequestID(ctx, rec.RequestID), "outbox publish failed",
+		"outbox_id", rec.ID, "event", rec.Event, "attempt", attempts, "error", err)
+
+	_, _ = db.OutboxCollection.UpdateOne(ctx, bson.M{"_id": rec.ID}, bson.M{
+		"$set": bson.M{
+			"status":          status,
+			"attempts":        attempts,
+			"last_error":      err.Error(),
+			"next_attempt_at": now.Add(backoff),
+			"locked_until":    now,
+		},
+	})
+}
+
+// OutboxStatus reports relay backlog and throughput.
+type OutboxStatus struct {
+	Pending          int64   `json:"pending"`
+	Failed           int64   `json:"failed"`
+	OldestPendingAge float64 `json:"oldest_pending_age_seconds"`
+	DeliveredTotal   int64   `json:"delivered_total"`
+	PublishErrors    int64   `json:"publish_errors_total"`
+	LastRelayRun     int64   `json:"last_relay_run_unix"`
+}
+
+// OutboxStats returns the current outbox lag.
+func OutboxStats(ctx context.Context) (OutboxStatus, error) {
+	st := OutboxStatus{
+		DeliveredTotal: outboxDelivered.Load(),
+		PublishErrors:  outboxErrors.Load(),
+		LastRelayRun:   outboxLastRun.Load(),
+	}
+
+	var err error
+	if st.Pending, err = db.OutboxCollection.CountDocuments(ctx, bson.M{"status": OutboxPending}); err != nil {
+		return st, err
+	}
+	if st.Failed, err = db.OutboxCollection.CountDocuments(ctx, bson.M{"status": OutboxFailed}); err != nil {
+		return st, err
+	}
+
+	var oldest OutboxRecord
+	err = db.OutboxCollection.FindOne(ctx, bson.M{"status": OutboxPending},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&oldest)
+	if err == nil {
+		st.OldestPendingAge = time.Since(oldest.CreatedAt).Seconds()
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return st, err
+	}
+	return st, nil
+}
+
+// GetOutboxStats exposes the outbox lag to admins.
+// GET /api/v1/admin/mq/outbox
+func GetOutboxStats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	st, err := OutboxStats(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read outbox stats")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"outbox": st})
+}
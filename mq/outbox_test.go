@@ -0,0 +1,95 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/logx"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func outboxRow(t *testing.T) OutboxRecord {
+	t.Helper()
+	var rec OutboxRecord
+	if err := db.OutboxCollection.FindOne(context.Background(), bson.M{}).Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestOutboxRelay(t *testing.T) {
+	db.Use(memdb.NewStore())
+	useMemRedis(t)
+	ctx := logx.WithRequestID(context.Background(), "req-7")
+
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PostsCollection.InsertOne(ctx, bson.M{"postid": "p1"}); err != nil {
+			return err
+		}
+		return Enqueue(ctx, "s", "post-created", map[string]string{"id": "p1"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := outboxRow(t); rec.Status != OutboxPending || rec.RequestID != "req-7" {
+		t.Fatalf("outbox row = %+v", rec)
+	}
+
+	// A publish failure leaves the row pending, unleased, for a later pass.
+	down := memredis.NewClient()
+	down.Close()
+	up := rdx.Conn
+	rdx.Use(down)
+	if n := relayBatch(ctx, "a"); n != 1 {
+		t.Fatalf("relayed %d rows while redis is down, want 1", n)
+	}
+	rdx.Use(up)
+	rec := outboxRow(t)
+	if rec.Status != OutboxPending || rec.Attempts != 1 || rec.LastError == "" || rec.LockedUntil.After(time.Now()) {
+		t.Fatalf("row after a failed publish = %+v", rec)
+	}
+	if n := relayBatch(ctx, "a"); n != 0 {
+		t.Errorf("relayed %d rows before the backoff elapsed", n)
+	}
+	db.OutboxCollection.UpdateOne(ctx, bson.M{"_id": rec.ID}, bson.M{"$set": bson.M{"next_attempt_at": time.Now().UTC()}})
+
+	// A leased row is not handed to a second relay.
+	leased, err := leaseNext(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaseNext(ctx, "b"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("second relay lease = %v, want no documents", err)
+	}
+	if n := relayBatch(ctx, "b"); n != 0 {
+		t.Errorf("second relay processed %d leased rows", n)
+	}
+	relayOne(ctx, leased)
+
+	msgs, err := rdx.Conn.XRange(ctx, "s", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("stream holds %d entries, want 1", len(msgs))
+	}
+	msg := toMessage("s", msgs[0])
+	if msg.Event != "post-created" || string(msg.Payload) != `{"id":"p1"}` || msg.RequestID != "req-7" {
+		t.Errorf("published %+v", msg)
+	}
+	rec = outboxRow(t)
+	if rec.Status != OutboxDelivered || rec.StreamID != msgs[0].ID || rec.DeliveredAt == nil || rec.Attempts != 2 || rec.LastError != "" {
+		t.Errorf("row after delivery = %+v", rec)
+	}
+	if n := relayBatch(ctx, "a"); n != 0 {
+		t.Errorf("relayed %d rows after delivery, want 0", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/middleware"
@@ -38,19 +39,19 @@ func GetChat(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	userID := claims.UserID
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	chatID, err := primitive.ObjectIDFromHex(chatIDHex)
 	if err != nil {
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid chat ID")
 		return
 	}
 
@@ -65,7 +66,7 @@ func GetChat(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}).Decode(&chat)
 
 	if err != nil {
-		http.Error(w, "Chat not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Chat not found")
 		return
 	}
 
@@ -74,14 +75,14 @@ func GetChat(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		"chatid": chatIDHex,
 	}, options.Find().SetSort(bson.M{"createdAt": 1}))
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var messages []models.Message
 	if err := cursor.All(ctx, &messages); err != nil {
-		http.Error(w, "Failed to decode messages", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode messages")
 		return
 	}
 
@@ -96,14 +97,14 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	chatID := ps.ByName("chatid")
 	chatObjID, err := primitive.ObjectIDFromHex(chatID)
 	if err != nil {
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid chat ID")
 		return
 	}
 
@@ -112,7 +113,7 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	var chat models.Chat
 	if err := db.ChatsCollection.FindOne(ctx, bson.M{"_id": chatObjID}).Decode(&chat); err != nil {
-		http.Error(w, "Chat not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Chat not found")
 		return
 	}
 
@@ -124,12 +125,12 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		}
 	}
 	if !isParticipant {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
@@ -139,7 +140,7 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	if v := r.FormValue("replyTo"); v != "" {
 		var rr models.ReplyRef
 		if err := json.Unmarshal([]byte(v), &rr); err != nil {
-			http.Error(w, "Invalid replyTo payload", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "Invalid replyTo payload")
 			return
 		}
 		replyRef = &rr
@@ -161,14 +162,14 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 			case strings.HasPrefix(contentType, "application/"):
 				fileType = "document"
 			default:
-				http.Error(w, "Unsupported file type", http.StatusBadRequest)
+				apierr.Respond(w, http.StatusBadRequest, "Unsupported file type")
 				return
 			}
 
 			// ✅ Save file using filemgr with PicPhoto (instead of PicFile)
 			savedName, err := filemgr.SaveFormFile(r.MultipartForm, "file", filemgr.EntityChat, filemgr.PicPhoto, false)
 			if err != nil {
-				http.Error(w, "Failed to save file", http.StatusInternalServerError)
+				apierr.Respond(w, http.StatusInternalServerError, "Failed to save file")
 				return
 			}
 			fileURL = savedName
@@ -176,7 +177,7 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	}
 
 	if text == "" && fileURL == "" && replyRef == nil {
-		http.Error(w, "No content provided", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "No content provided")
 		return
 	}
 
@@ -199,7 +200,7 @@ func CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	res, err := db.MessagesCollection.InsertOne(ctx, msg)
 	if err != nil {
-		http.Error(w, "Insert failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Insert failed")
 		return
 	}
 
@@ -228,13 +229,13 @@ func UpdateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	msgID, err := primitive.ObjectIDFromHex(ps.ByName("msgid"))
 	if err != nil {
-		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid message ID")
 		return
 	}
 
@@ -245,12 +246,12 @@ func UpdateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var message models.Message
 	err = coll.FindOne(ctx, bson.M{"_id": msgID}).Decode(&message)
 	if err != nil {
-		http.Error(w, "Message not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Message not found")
 		return
 	}
 
 	if message.UserID != claims.UserID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
@@ -258,13 +259,13 @@ func UpdateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		Text string `json:"text"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Text == "" {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
 	_, err = coll.UpdateOne(ctx, bson.M{"_id": msgID}, bson.M{"$set": bson.M{"text": input.Text}})
 	if err != nil {
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Update failed")
 		return
 	}
 
@@ -277,13 +278,13 @@ func DeletesMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	msgID, err := primitive.ObjectIDFromHex(ps.ByName("msgid"))
 	if err != nil {
-		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid message ID")
 		return
 	}
 
@@ -294,18 +295,18 @@ func DeletesMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	var message models.Message
 	err = msgColl.FindOne(ctx, bson.M{"_id": msgID}).Decode(&message)
 	if err != nil {
-		http.Error(w, "Message not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Message not found")
 		return
 	}
 
 	if message.UserID != claims.UserID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	_, err = msgColl.DeleteOne(ctx, bson.M{"_id": msgID})
 	if err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Delete failed")
 		return
 	}
 
@@ -327,7 +328,7 @@ func InitChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		UserB string `json:"userB"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
@@ -346,7 +347,7 @@ func InitChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		json.NewEncoder(w).Encode(bson.M{"chatid": existingChat.ID.Hex()})
 		return
 	} else if err != mongo.ErrNoDocuments {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 
@@ -354,7 +355,7 @@ func InitChat(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	newChat := models.Chat{Users: users}
 	res, err := chatCol.InsertOne(ctx, newChat)
 	if err != nil {
-		http.Error(w, "Failed to create chat", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create chat")
 		return
 	}
 
@@ -367,13 +368,13 @@ func GetUserChats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	userID := claims.UserID
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -389,14 +390,14 @@ func GetUserChats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	)
 
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var chats []models.Chat
 	if err := cursor.All(ctx, &chats); err != nil {
-		http.Error(w, "Decode error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Decode error")
 		return
 	}
 
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 
@@ -70,34 +71,34 @@ func EditMessageHandler(hub *Hub) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		var payload editPayload
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "bad request")
 			return
 		}
 
 		token, err := extractToken(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 		claims, err := middleware.ValidateJWT(token)
 		if err != nil {
 			log.Println("jwt:", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		if err := UpdatexMessage(claims.UserID, payload.ID, payload.Content); err != nil {
 			if strings.Contains(err.Error(), "not found") {
-				http.Error(w, "not found", http.StatusNotFound)
+				apierr.Respond(w, http.StatusNotFound, "not found")
 			} else {
-				http.Error(w, "forbidden", http.StatusForbidden)
+				apierr.Respond(w, http.StatusForbidden, "forbidden")
 			}
 			return
 		}
 
 		room, err := findMessageRoom(payload.ID)
 		if err != nil {
-			http.Error(w, "room not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "room not found")
 			return
 		}
 
@@ -122,33 +123,33 @@ func DeleteMessageHandler(hub *Hub) httprouter.Handle {
 			ID string `json:"id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "bad request")
 			return
 		}
 
 		token, err := extractToken(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 		claims, err := middleware.ValidateJWT(token)
 		if err != nil {
 			log.Println("jwt:", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		room, err := findMessageRoom(payload.ID)
 		if err != nil {
-			http.Error(w, "room not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "room not found")
 			return
 		}
 
 		if err := DeletexMessage(claims.UserID, payload.ID); err != nil {
 			if strings.Contains(err.Error(), "not found") {
-				http.Error(w, "not found", http.StatusNotFound)
+				apierr.Respond(w, http.StatusNotFound, "not found")
 			} else {
-				http.Error(w, "forbidden", http.StatusForbidden)
+				apierr.Respond(w, http.StatusForbidden, "forbidden")
 			}
 			return
 		}
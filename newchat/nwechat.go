@@ -9,7 +9,9 @@ import (
 	"sync"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
+	"naevis/metrics"
 	"naevis/middleware"
 	"naevis/utils"
 
@@ -21,6 +23,9 @@ import (
 
 // ------------------------- Types -------------------------
 
+var wsClients = metrics.NewGaugeVec("naevis_newchat_websocket_clients",
+	"Chat clients currently joined to a room.")
+
 type Hub struct {
 	rooms      map[string]map[*Client]bool
 	register   chan *Client
@@ -155,17 +160,16 @@ func (h *Hub) Run() {
 			if h.stopped {
 				h.mu.Unlock()
 				// ensure the connection is closed
-				_ = c.Conn.WriteMessage(websocket.CloseMessage,
-					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "server shutting down"))
-				c.cancel()
-				c.Conn.Close()
-				closeChanSafe(c.Send)
+				c.shutdown()
 				continue
 			}
 			if h.rooms[c.Room] == nil {
 				h.rooms[c.Room] = make(map[*Client]bool)
 			}
-			h.rooms[c.Room][c] = true
+			if !h.rooms[c.Room][c] {
+				h.rooms[c.Room][c] = true
+				wsClients.Inc()
+			}
 			h.mu.Unlock()
 
 		case c := <-h.unregister:
@@ -173,6 +177,7 @@ func (h *Hub) Run() {
 			if clients := h.rooms[c.Room]; clients != nil {
 				if _, ok := clients[c]; ok {
 					delete(clients, c)
+					wsClients.Dec()
 					closeChanSafe(c.Send)
 				}
 				// if room empty, remove it
@@ -192,6 +197,7 @@ func (h *Hub) Run() {
 						// client send buffer full or closed, drop it
 						closeChanSafe(client.Send)
 						delete(clients, client)
+						wsClients.Dec()
 					}
 				}
 			}
@@ -223,13 +229,8 @@ func (h *Hub) Stop() {
 
 	for room, clients := range roomsCopy {
 		for client := range clients {
-			// notify clients best-effort
-			_ = client.Conn.WriteMessage(websocket.CloseMessage,
-				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "server shutting down"))
-			// cancel client context to stop pumps
-			client.cancel()
-			client.Conn.Close()
-			closeChanSafe(client.Send)
+			client.shutdown()
+			wsClients.Dec()
 		}
 		delete(roomsCopy, room)
 	}
@@ -237,6 +238,22 @@ func (h *Hub) Stop() {
 	log.Println("✅ Hub stopped cleanly")
 }
 
+// shutdown notifies the client best-effort, cancels its pumps and closes the
+// connection. Clients registered without a socket (tests) are tolerated.
+func (c *Client) shutdown() {
+	if c.Conn != nil {
+		_ = c.Conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "server shutting down"))
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.Conn != nil {
+		c.Conn.Close()
+	}
+	closeChanSafe(c.Send)
+}
+
 // ------------------------- WebSocket handlers & pumps -------------------------
 
 // WebSocketHandler: ensure route is /ws/:room (client must connect to /ws/room123)
@@ -245,7 +262,7 @@ func WebSocketHandler(hub *Hub) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		room := strings.TrimSpace(ps.ByName("room"))
 		if room == "" {
-			http.Error(w, "room required", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "room required")
 			return
 		}
 
@@ -256,14 +273,14 @@ func WebSocketHandler(hub *Hub) httprouter.Handle {
 		} else if q := r.URL.Query().Get("token"); q != "" {
 			token = "Bearer " + q
 		} else {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		claims, err := middleware.ValidateJWT(token)
 		if err != nil {
 			log.Println("jwt validate:", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 		userID := claims.UserID
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/middleware"
@@ -21,30 +22,30 @@ func UploadHandler(hub *Hub) httprouter.Handle {
 		// 1) Validate JWT
 		token, err := extractToken(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 		claims, err := middleware.ValidateJWT(token)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		// 2) Parse multipart form
 		if err := r.ParseMultipartForm(32 << 20); err != nil { // allow up to 32MB total
-			http.Error(w, "bad request", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "bad request")
 			return
 		}
 
 		room := strings.TrimSpace(r.FormValue("chat"))
 		if room == "" {
-			http.Error(w, "room missing", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "room missing")
 			return
 		}
 
 		hdrs := r.MultipartForm.File["file"]
 		if len(hdrs) == 0 {
-			http.Error(w, "no files provided", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "no files provided")
 			return
 		}
 
@@ -53,14 +54,14 @@ func UploadHandler(hub *Hub) httprouter.Handle {
 		for _, hdr := range hdrs {
 			file, err := hdr.Open()
 			if err != nil {
-				http.Error(w, "file error", http.StatusBadRequest)
+				apierr.Respond(w, http.StatusBadRequest, "file error")
 				return
 			}
 			savedName, ext, err := filemgr.SaveFileForEntity(file, hdr, filemgr.EntityChat, filemgr.PicPhoto)
 			file.Close()
 			if err != nil {
 				log.Println("save failed:", err)
-				http.Error(w, "save failed", http.StatusInternalServerError)
+				apierr.Respond(w, http.StatusInternalServerError, "save failed")
 				return
 			}
 			_ = ext
@@ -82,7 +83,7 @@ func UploadHandler(hub *Hub) httprouter.Handle {
 		}
 		if _, err := db.MessagesCollection.InsertOne(context.Background(), msg); err != nil {
 			log.Println("db error:", err)
-			http.Error(w, "db error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "db error")
 			return
 		}
 
@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// jwkSet is a JSON Web Key Set (RFC 7517).
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKeys returns the signature keys of the set by kid. Keys that are
+// for encryption or cannot be parsed are skipped.
+func (s jwkSet) publicKeys() map[string]any {
+	keys := map[string]any{}
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub := k.publicKey(); pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys
+}
+
+func (k jwk) publicKey() any {
+	switch k.Kty {
+	case "RSA":
+		n, e := decodeInt(k.N), decodeInt(k.E)
+		if n == nil || e == nil || !e.IsInt64() || n.BitLen() < 2048 {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil
+		}
+		x, y := decodeBytes(k.X), decodeBytes(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil
+		}
+		point := append(append([]byte{4}, x...), y...)
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil
+		}
+		return pub
+	case "OKP":
+		x := decodeBytes(k.X)
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil
+		}
+		return ed25519.PublicKey(x)
+	}
+	return nil
+}
+
+func decodeBytes(s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func decodeInt(s string) *big.Int {
+	b := decodeBytes(s)
+	if len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
@@ -0,0 +1,312 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and ID token verification against
+// the provider's JWKS. It relies only on OpenID Connect Core and
+// Discovery, so any compliant provider works, including oidctest's.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config describes one provider and this application's client there.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string // defaults to openid, email and profile
+}
+
+// Identity is what a verified ID token says about the user.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// ErrInvalidToken wraps every reason an ID token is refused.
+var ErrInvalidToken = errors.New("oidc: invalid ID token")
+
+// signingMethods are the ID token algorithms accepted. "none" and the
+// HMAC family, which would take the client secret as key, are not.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+const (
+	// jwksRefreshInterval bounds how often an unknown key ID refetches
+	// the key set, so forged kids cannot hammer the provider.
+	jwksRefreshInterval = time.Minute
+	// clockSkew is tolerated between this server and the provider.
+	clockSkew = time.Minute
+)
+
+// Provider is a relying party for one provider. Discovery runs on first
+// use, so a provider that is down does not stop the server starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu     sync.Mutex
+	meta   *metadata
+	keys   map[string]any // kid -> public key
+	keysAt time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New returns a Provider for cfg. A nil client uses one with a timeout.
+func New(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Provider{cfg: cfg, client: client}
+}
+
+// RandomString returns a URL-safe random string for state, nonce and
+// PKCE verifier values.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL that sends the user to the provider.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for the user's verified
+// identity. nonce and verifier are the values given to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc: token response %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("oidc: token request refused: %s %s (%s)", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidToken)
+	}
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// idClaims are the ID token claims read by Verify.
+type idClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// flexBool accepts true and "true": some providers send the string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+// Verify checks an ID token's signature, issuer, audience, lifetime and
+// nonce, and returns the identity it asserts.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	var claims idClaims
+	_, err = parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp %q is not this client", ErrInvalidToken, claims.AuthorizedParty)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// discover fetches and caches the provider metadata. Failures are not
+// cached, so the next request tries again.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovery of %s: %w", p.cfg.Issuer, err)
+	}
+	// Discovery section 4.3: the document must name the issuer it was
+	// fetched for, or tokens could be accepted from an impostor.
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery of %s returned issuer %q", p.cfg.Issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery of %s is missing endpoints", p.cfg.Issuer)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the signing key kid, refetching the JWKS when the kid is
+// unknown, as happens after the provider rotates keys. Without a kid
+// the provider's only key is used.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	if time.Since(p.keysAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set jwkSet
+	if err := p.getJSON(ctx, p.meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysAt = time.Now()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,90 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"naevis/oidc"
+	"naevis/oidc/oidctest"
+)
+
+func newProvider(idp *oidctest.Server, clientID string) *oidc.Provider {
+	return oidc.New(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     clientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://app.test/callback",
+	}, idp.Client())
+}
+
+// authorize runs the browser leg and returns the code.
+func authorize(t *testing.T, idp *oidctest.Server, p *oidc.Provider, nonce, verifier string) string {
+	t.Helper()
+	u, err := p.AuthCodeURL(context.Background(), "st", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Authorize(u, oidctest.User{Subject: "42", Email: "ann@example.com", EmailVerified: true})
+	if err != nil || state != "st" {
+		t.Fatalf("authorize: %q, %v", state, err)
+	}
+	return code
+}
+
+func TestCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer("naevis", "s3cret")
+	defer idp.Close()
+	p := newProvider(idp, "naevis")
+	ctx := context.Background()
+
+	verifier, _ := oidc.RandomString()
+	code := authorize(t, idp, p, "n1", verifier)
+	id, err := p.Exchange(ctx, code, verifier, "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "42" || id.Email != "ann@example.com" || !id.EmailVerified {
+		t.Errorf("identity = %+v", id)
+	}
+
+	if _, err := p.Exchange(ctx, code, verifier, "n1"); err == nil {
+		t.Error("code redeemed twice")
+	}
+	code = authorize(t, idp, p, "n2", verifier)
+	if _, err := p.Exchange(ctx, code, "wrong-verifier", "n2"); err == nil {
+		t.Error("wrong PKCE verifier accepted")
+	}
+	code = authorize(t, idp, p, "n3", verifier)
+	if _, err := p.Exchange(ctx, code, verifier, "other"); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("nonce mismatch: err = %v", err)
+	}
+}
+
+func TestVerifyAudience(t *testing.T) {
+	idp := oidctest.NewServer("naevis", "s3cret")
+	defer idp.Close()
+	p := newProvider(idp, "naevis")
+	ctx := context.Background()
+	user := oidctest.User{Subject: "42"}
+
+	raw, _ := idp.IDToken("naevis", "n", user)
+	if _, err := p.Verify(ctx, raw, "n"); err != nil {
+		t.Fatalf("own token: %v", err)
+	}
+	// A token the provider minted for another client must not log anyone
+	// in here.
+	raw, _ = idp.IDToken("someone-else", "n", user)
+	if _, err := p.Verify(ctx, raw, "n"); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("foreign audience: err = %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer("naevis", "")
+	defer idp.Close()
+	p := oidc.New(oidc.Config{Issuer: idp.URL + "/tenant", ClientID: "naevis"}, idp.Client())
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("discovery accepted a document for another issuer")
+	}
+}
@@ -0,0 +1,217 @@
+// Package oidctest runs a minimal OpenID provider for tests and local
+// development. It serves discovery, a JWKS with one RSA key and a token
+// endpoint; Authorize stands in for the user signing in at the provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User is who signs in at the provider.
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Server is a running provider with a single registered client.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is an authorization waiting for its code to be redeemed.
+type grant struct {
+	user        User
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// NewServer starts a provider for clientID and clientSecret. Close it
+// when done.
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		kid:          "test-key",
+		codes:        map[string]grant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Authorize plays the user signing in as u at authURL, which must come
+// from the relying party's AuthCodeURL. It returns the code and state
+// that the provider would redirect back with.
+func (s *Server) Authorize(authURL string, u User) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := parsed.Query()
+	switch {
+	case q.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: response_type is not code")
+	case q.Get("client_id") != s.ClientID:
+		return "", "", errors.New("oidctest: unknown client_id")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("oidctest: missing S256 PKCE challenge")
+	}
+
+	code = randomString()
+	s.mu.Lock()
+	s.codes[code] = grant{
+		user:        u,
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+	}
+	s.mu.Unlock()
+	return code, q.Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": s.kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	// Codes are single use.
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok:
+		tokenError(w, "invalid_grant", "unknown or used code")
+		return
+	case g.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	idToken, err := s.IDToken(s.ClientID, g.nonce, g.user)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// IDToken signs an ID token about u for audience with nonce, as the
+// token endpoint does.
+func (s *Server) IDToken(audience, nonce string, u User) (string, error) {
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                s.URL,
+		"aud":                audience,
+		"sub":                u.Subject,
+		"nonce":              nonce,
+		"email":              u.Email,
+		"email_verified":     u.EmailVerified,
+		"name":               u.Name,
+		"preferred_username": u.PreferredUsername,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+	})
+	tok.Header["kid"] = s.kid
+	return tok.SignedString(s.key)
+}
+
+func tokenError(w http.ResponseWriter, code, desc string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": desc})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+// Package pagination implements opaque keyset cursors for list endpoints.
+//
+// A cursor records the sort key and a unique tiebreaker of the last item a
+// client has seen. The next page is everything strictly after that pair in
+// sort order, so rows inserted while a client pages never cause duplicates
+// or skips, and deep pages cost the same as the first one.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor is returned for a cursor the server did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a sorted list: the sort key of the last item and
+// its unique ID. Values keep their BSON types across the round trip, so a
+// time or ObjectID comes back comparable in a Mongo filter.
+type Cursor struct {
+	Key any `bson:"k"`
+	ID  any `bson:"i"`
+}
+
+// Encode returns the opaque string form handed to clients.
+func (c Cursor) Encode() string {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode parses a cursor produced by Encode.
+func Decode(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := bson.Unmarshal(raw, &c); err != nil || c.ID == nil {
+		return nil, ErrInvalidCursor
+	}
+	// Key and ID end up in query filters, so a client must not be able to
+	// smuggle in documents such as {"$ne": null}.
+	if !scalar(c.Key) || !scalar(c.ID) {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// scalar reports whether v is a BSON value a cursor may hold: one that
+// compares as itself rather than acting as an operator or sub-document.
+func scalar(v any) bool {
+	switch v.(type) {
+	case nil, string, bool, int32, int64, float64,
+		primitive.DateTime, primitive.ObjectID, primitive.Decimal128, primitive.Timestamp:
+		return true
+	}
+	return false
+}
+
+// Params are the page size and starting position of a request.
+type Params struct {
+	Limit int64
+	After *Cursor // nil for the first page
+}
+
+// Parse reads ?limit= and ?cursor= from r. A missing or out-of-range limit
+// falls back to defaultLimit; a malformed cursor is an error.
+func Parse(r *http.Request, defaultLimit, maxLimit int64) (Params, error) {
+	q := r.URL.Query()
+	p := Params{Limit: defaultLimit}
+	if l, err := strconv.ParseInt(q.Get("limit"), 10, 64); err == nil && l > 0 && l <= maxLimit {
+		p.Limit = l
+	}
+	if s := q.Get("cursor"); s != "" {
+		c, err := Decode(s)
+		if err != nil {
+			return p, err
+		}
+		p.After = c
+	}
+	return p, nil
+}
+
+// Sort describes a keyset ordering: Field first, then IDField to break ties.
+// IDField must be unique.
+type Sort struct {
+	Field   string
+	IDField string
+	Desc    bool
+}
+
+// Filter returns base restricted to items after the cursor. base is not
+// modified.
+func (s Sort) Filter(base bson.M, after *Cursor) bson.M {
+	out := bson.M{}
+	for k, v := range base {
+		out[k] = v
+	}
+	if after == nil {
+		return out
+	}
+
+	op := "$gt"
+	if s.Desc {
+		op = "$lt"
+	}
+	seek := bson.A{
+		bson.M{s.Field: bson.M{op: after.Key}},
+		bson.M{s.Field: after.Key, s.IDField: bson.M{op: after.ID}},
+	}
+	if _, ok := out["$or"]; ok {
+		out = bson.M{"$and": bson.A{out, bson.M{"$or": seek}}}
+	} else {
+		out["$or"] = seek
+	}
+	return out
+}
+
+// FindOptions sorts by the keyset and fetches one extra row so Trim can
+// tell whether another page exists.
+func (s Sort) FindOptions(limit int64) *options.FindOptions {
+	dir := 1
+	if s.Desc {
+		dir = -1
+	}
+	return options.Find().
+		SetSort(bson.D{{Key: s.Field, Value: dir}, {Key: s.IDField, Value: dir}}).
+		SetLimit(limit + 1)
+}
+
+// Trim cuts items fetched with FindOptions down to limit and returns the
+// cursor for the next page, or "" when this is the last page.
+func Trim[T any](items []T, limit int64, cursorOf func(T) Cursor) ([]T, string) {
+	if int64(len(items)) <= limit {
+		return items, ""
+	}
+	items = items[:limit]
+	return items, cursorOf(items[len(items)-1]).Encode()
+}
+
+// Page is the response body of list endpoints that have no other envelope.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage builds a Page, turning a nil slice into an empty JSON array.
+func NewPage[T any](items []T, next string) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return Page[T]{Items: items, NextCursor: next}
+}
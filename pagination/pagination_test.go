@@ -0,0 +1,114 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	in := Cursor{Key: "2024-05-01T10:00:00Z", ID: id}
+
+	out, err := Decode(in.Encode())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if out.Key != in.Key || out.ID != id {
+		t.Fatalf("round trip = %+v, want %+v", *out, in)
+	}
+
+	for _, bad := range []string{
+		"not base64!",
+		"AAAA",
+		Cursor{Key: 1}.Encode(),
+		Cursor{Key: bson.M{"$gt": ""}, ID: "x"}.Encode(),
+		Cursor{Key: 1, ID: bson.M{"$ne": nil}}.Encode(),
+		Cursor{Key: bson.A{1, 2}, ID: "x"}.Encode(),
+	} {
+		if _, err := Decode(bad); err != ErrInvalidCursor {
+			t.Errorf("Decode(%q) err = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	next := Cursor{Key: int64(5), ID: "p5"}.Encode()
+	tests := []struct {
+		query     string
+		wantLimit int64
+		wantAfter bool
+		wantErr   bool
+	}{
+		{"", 20, false, false},
+		{"limit=10", 10, false, false},
+		{"limit=0", 20, false, false},
+		{"limit=500", 20, false, false},
+		{"limit=x", 20, false, false},
+		{"cursor=" + next, 20, true, false},
+		{"cursor=garbage", 20, false, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		p, err := Parse(r, 20, 100)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v", tt.query, err)
+			continue
+		}
+		if p.Limit != tt.wantLimit || (p.After != nil) != tt.wantAfter {
+			t.Errorf("%q: got limit %d after %v", tt.query, p.Limit, p.After)
+		}
+	}
+}
+
+func TestSortFilter(t *testing.T) {
+	s := Sort{Field: "created_at", IDField: "_id", Desc: true}
+	after := &Cursor{Key: "k", ID: "i"}
+
+	seek := bson.A{
+		bson.M{"created_at": bson.M{"$lt": "k"}},
+		bson.M{"created_at": "k", "_id": bson.M{"$lt": "i"}},
+	}
+
+	base := bson.M{"userid": "u1"}
+	got := s.Filter(base, after)
+	want := bson.M{"userid": "u1", "$or": seek}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter = %v, want %v", got, want)
+	}
+	if _, ok := base["$or"]; ok {
+		t.Error("Filter modified its base")
+	}
+
+	withOr := bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 1}}}
+	got = s.Filter(withOr, after)
+	want = bson.M{"$and": bson.A{withOr, bson.M{"$or": seek}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter with $or = %v, want %v", got, want)
+	}
+
+	if got := s.Filter(base, nil); !reflect.DeepEqual(got, base) {
+		t.Errorf("Filter without cursor = %v, want %v", got, base)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	cursorOf := func(n int) Cursor { return Cursor{Key: int64(n), ID: n} }
+
+	items, next := Trim([]int{1, 2, 3}, 3, cursorOf)
+	if len(items) != 3 || next != "" {
+		t.Fatalf("last page = %v %q, want 3 items and no cursor", items, next)
+	}
+
+	items, next = Trim([]int{1, 2, 3, 4}, 3, cursorOf)
+	if len(items) != 3 || next == "" {
+		t.Fatalf("full page = %v %q, want 3 items and a cursor", items, next)
+	}
+	c, err := Decode(next)
+	if err != nil || c.Key != int64(3) {
+		t.Fatalf("next cursor = %+v, %v; want key 3", c, err)
+	}
+}
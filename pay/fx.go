@@ -0,0 +1,311 @@
+package pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/models"
+	"naevis/money"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Conversions between a user's wallets go through the external fx
+// account at the rates admins keep in exchange_rates. Each side is its
+// own transaction in its own currency: one debits the source wallet, the
+// other, its child, credits the target wallet.
+
+// fxAccount is the counterparty of every conversion.
+const fxAccount = externalPrefix + "fx"
+
+// errNoRate is returned when no rate is set for a currency pair.
+var errNoRate = errors.New("pay: no exchange rate")
+
+// ExchangeRate says how many units of Quote one unit of Base buys. The
+// rate is kept as the decimal an admin entered so it converts exactly.
+type ExchangeRate struct {
+	ID        string    `bson:"_id" json:"-"` // "BASE/QUOTE"
+	Base      string    `bson:"base" json:"base"`
+	Quote     string    `bson:"quote" json:"quote"`
+	Rate      string    `bson:"rate" json:"rate"`
+	UpdatedBy string    `bson:"updated_by" json:"updated_by"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func rateID(base, quote string) string { return base + "/" + quote }
+
+// rateFor returns the rate from one currency to another: the pair's own
+// rate if one is set, else the inverse of the opposite pair's.
+func rateFor(ctx context.Context, from, to string) (*big.Rat, error) {
+	var rate ExchangeRate
+	err := db.ExchangeRatesCollection.FindOne(ctx, bson.M{"_id": rateID(from, to)}).Decode(&rate)
+	if err == nil {
+		return money.ParseRate(rate.Rate)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	err = db.ExchangeRatesCollection.FindOne(ctx, bson.M{"_id": rateID(to, from)}).Decode(&rate)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w for %s to %s", errNoRate, from, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := money.ParseRate(rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return r.Inv(r), nil
+}
+
+// --- Convert ---
+
+// Convert moves money from one of the caller's wallets to their wallet in
+// another currency at the current rate.
+// POST /api/v1/wallet/convert {"amount":"10.00","from":"INR","to":"USD"}
+func (p *PaymentService) Convert(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	userID := utils.GetUserIDFromRequest(r)
+
+	var body struct {
+		Amount json.Number `json:"amount"`
+		From   string      `json:"from"`
+		To     string      `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	amount, err := parseAmount(body.Amount, body.From)
+	if err != nil {
+		respondAmountError(w, err)
+		return
+	}
+	to, err := money.Currency(body.To)
+	if err != nil {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "to", Message: "is not a supported currency"}))
+		return
+	}
+	if to == amount.Currency {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "to", Message: "must differ from the source currency"}))
+		return
+	}
+
+	rate, err := rateFor(ctx, amount.Currency, to)
+	if errors.Is(err, errNoRate) {
+		apierr.Respond(w, http.StatusUnprocessableEntity, "no exchange rate for "+amount.Currency+" to "+to)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "exchange rate lookup failed", "from", amount.Currency, "to", to, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "convert failed")
+		return
+	}
+	converted, err := money.Convert(amount, to, rate)
+	if err != nil || !converted.IsPositive() {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "amount", Message: "is too small or too large to convert"}))
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		var existing models.Transaction
+		if err := db.TransactionCollection.FindOne(ctx, bson.M{"external_ref": idempotencyKey, "type": "convert"}).Decode(&existing); err == nil {
+			utils.RespondWithJSON(w, http.StatusOK, existing)
+			return
+		}
+	}
+
+	acquired, err := rdx.RdxSetNX("wallet_lock:"+userID, "1", lockTTL)
+	if err != nil || !acquired {
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
+		return
+	}
+	defer rdx.RdxDel("wallet_lock:" + userID)
+
+	fromAccID, err := getOrCreateAccount(ctx, userID, amount.Currency)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
+		return
+	}
+	toAccID, err := getOrCreateAccount(ctx, userID, to)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
+		return
+	}
+
+	now := time.Now()
+	rateText := rate.FloatString(10)
+	outTxn := models.Transaction{
+		ID:             utils.GetUUID(),
+		UserID:         userID,
+		Type:           "convert",
+		Method:         "convert",
+		FromAccount:    fromAccID,
+		ToAccount:      fxAccount,
+		Amount:         amount,
+		Status:         "success",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		IdempotencyKey: idempotencyKey,
+		Meta:           models.Meta{"note": "convert", "to": to, "rate": rateText},
+	}
+	inTxn := models.Transaction{
+		ID:          utils.GetUUID(),
+		ParentTxn:   outTxn.ID,
+		UserID:      userID,
+		Type:        "convert",
+		Method:      "convert",
+		FromAccount: fxAccount,
+		ToAccount:   toAccID,
+		Amount:      converted,
+		Status:      "success",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Meta:        models.Meta{"note": "convert", "from": amount.Currency, "rate": rateText},
+	}
+
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := transfer(ctx, outTxn.ID, fromAccID, fxAccount, amount, models.Meta{"note": "convert"}); err != nil {
+			return err
+		}
+		if err := transfer(ctx, inTxn.ID, fxAccount, toAccID, converted, models.Meta{"note": "convert"}); err != nil {
+			return err
+		}
+		_, err := db.TransactionCollection.InsertMany(ctx, []interface{}{outTxn, inTxn})
+		return err
+	})
+	if err != nil {
+		respondWalletError(w, r, "Convert", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"transaction_id": outTxn.ID,
+		"debited":        amount,
+		"credited":       converted,
+		"rate":           rateText,
+	})
+}
+
+// --- Exchange rates (admin) ---
+
+// ListRates returns every exchange rate.
+// GET /api/v1/admin/wallet/rates
+func ListRates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	cur, err := db.ExchangeRatesCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read rates")
+		return
+	}
+	rates := []ExchangeRate{}
+	if err := cur.All(ctx, &rates); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read rates")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"rates": rates})
+}
+
+// SetRate sets how many units of :quote one unit of :base buys.
+// PUT /api/v1/admin/wallet/rates/:base/:quote {"rate":"0.0120"}
+func SetRate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body struct {
+		Rate json.Number `json:"rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	base, quote, ok := ratePair(w, ps)
+	if !ok {
+		return
+	}
+	if _, err := money.ParseRate(body.Rate.String()); err != nil {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "rate", Message: "must be a positive decimal"}))
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := ctx.Value(globals.UserIDKey).(string)
+	rate := ExchangeRate{
+		ID:        rateID(base, quote),
+		Base:      base,
+		Quote:     quote,
+		Rate:      body.Rate.String(),
+		UpdatedBy: adminID,
+		UpdatedAt: time.Now().UTC(),
+	}
+	_, err := db.ExchangeRatesCollection.UpdateOne(ctx, bson.M{"_id": rate.ID}, bson.M{"$set": bson.M{
+		"base":       rate.Base,
+		"quote":      rate.Quote,
+		"rate":       rate.Rate,
+		"updated_by": rate.UpdatedBy,
+		"updated_at": rate.UpdatedAt,
+	}}, options.Update().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "setting exchange rate failed", "rate_id", rate.ID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "failed to set rate")
+		return
+	}
+	slog.InfoContext(ctx, "exchange rate set", "admin_id", adminID, "rate_id", rate.ID, "rate", rate.Rate)
+	utils.RespondWithJSON(w, http.StatusOK, rate)
+}
+
+// DeleteRate removes the rate for a pair; conversions between them stop
+// unless the opposite pair has a rate.
+// DELETE /api/v1/admin/wallet/rates/:base/:quote
+func DeleteRate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	base, quote, ok := ratePair(w, ps)
+	if !ok {
+		return
+	}
+	res, err := db.ExchangeRatesCollection.DeleteOne(r.Context(), bson.M{"_id": rateID(base, quote)})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to delete rate")
+		return
+	}
+	if res.DeletedCount == 0 {
+		apierr.Respond(w, http.StatusNotFound, "rate not found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// ratePair reads the :base and :quote currencies, answering 422 if they
+// are not a valid pair.
+func ratePair(w http.ResponseWriter, ps httprouter.Params) (string, string, bool) {
+	var errs []apierr.FieldError
+	base, err := money.Currency(ps.ByName("base"))
+	if err != nil {
+		errs = append(errs, apierr.FieldError{Field: "base", Message: "is not a supported currency"})
+	}
+	quote, err := money.Currency(ps.ByName("quote"))
+	if err != nil {
+		errs = append(errs, apierr.FieldError{Field: "quote", Message: "is not a supported currency"})
+	}
+	if len(errs) == 0 && base == quote {
+		errs = append(errs, apierr.FieldError{Field: "quote", Message: "must differ from base"})
+	}
+	if len(errs) > 0 {
+		apierr.Write(w, apierr.Validation(errs...))
+		return "", "", false
+	}
+	return base, quote, true
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/rdx"
@@ -20,15 +21,21 @@ const lockTTL = 5 * time.Second
 
 // --- TopUp ---
 func (p *PaymentService) TopUp(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	ctx := context.Background()
+	ctx := r.Context()
 	userID := utils.GetUserIDFromRequest(r)
 
 	var body struct {
-		Amount float64 `json:"amount"`
-		Method string  `json:"method"`
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currency"`
+		Method   string      `json:"method"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Amount <= 0 {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	amount, err := parseAmount(body.Amount, body.Currency)
+	if err != nil {
+		respondAmountError(w, err)
 		return
 	}
 
@@ -44,17 +51,18 @@ func (p *PaymentService) TopUp(w http.ResponseWriter, r *http.Request, _ httprou
 	// Acquire Redis lock per user
 	acquired, err := rdx.RdxSetNX("wallet_lock:"+userID, "1", lockTTL)
 	if err != nil || !acquired {
-		http.Error(w, "please retry", http.StatusTooManyRequests)
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
 		return
 	}
 	defer rdx.RdxDel("wallet_lock:" + userID)
 
-	userAccID, err := getOrCreateAccount(ctx, userID)
+	userAccID, err := getOrCreateAccount(ctx, userID, amount.Currency)
 	if err != nil {
-		http.Error(w, "account error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
 		return
 	}
 
+	now := time.Now()
 	txn := models.Transaction{
 		ID:             utils.GetUUID(),
 		UserID:         userID,
@@ -62,57 +70,26 @@ func (p *PaymentService) TopUp(w http.ResponseWriter, r *http.Request, _ httprou
 		Method:         body.Method,
 		FromAccount:    "external:bank",
 		ToAccount:      userAccID,
-		Amount:         body.Amount,
-		Currency:       "INR",
-		Status:         "initiated",
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		Amount:         amount,
+		Status:         "success",
+		CreatedAt:      now,
+		UpdatedAt:      now,
 		IdempotencyKey: idempotencyKey,
 		Meta:           models.Meta{"note": "topup"},
 	}
 
-	// Insert transaction record first
-	if _, err := db.TransactionCollection.InsertOne(ctx, txn); err != nil {
-		http.Error(w, "topup failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Insert journal entry
-	journal := models.JournalEntry{
-		ID:            utils.GetUUID(),
-		TxnID:         txn.ID,
-		DebitAccount:  "external:bank",
-		CreditAccount: userAccID,
-		Amount:        body.Amount,
-		Currency:      "INR",
-		CreatedAt:     time.Now(),
-		Meta:          models.Meta{"note": "topup"},
-	}
-	if _, err := db.JournalCollection.InsertOne(ctx, journal); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "topup failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Update account balance
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": userAccID}, bson.M{
-		"$inc": bson.M{"cached_balance": body.Amount, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "topup failed", http.StatusInternalServerError)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := transfer(ctx, txn.ID, txn.FromAccount, txn.ToAccount, txn.Amount, models.Meta{"note": "topup"}); err != nil {
+			return err
+		}
+		_, err := db.TransactionCollection.InsertOne(ctx, txn)
+		return err
+	})
+	if err != nil {
+		respondWalletError(w, r, "TopUp", err)
 		return
 	}
 
-	// Mark success
-	txn.Status = "success"
-	txn.UpdatedAt = time.Now()
-	_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success":        true,
 		"transaction_id": txn.ID,
@@ -126,27 +103,46 @@ func (p *PaymentService) Pay(w http.ResponseWriter, r *http.Request, _ httproute
 
 	var req models.PayRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
 		return
 	}
 	if req.EntityType == "user" {
-		utils.RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Use /wallet/transfer"})
+		apierr.Respond(w, http.StatusBadRequest, "Use /wallet/transfer")
+		return
+	}
+	// Only wallet money is taken here. Card and other payments go
+	// through a gateway checkout and are recorded from its webhook.
+	if req.Method == "" {
+		req.Method = "wallet"
+	}
+	if req.Method != "wallet" {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "method", Message: "must be wallet; pay by card through checkout"}))
 		return
 	}
 
 	resolver, err := p.GetResolver(req.EntityType)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Unsupported entity type"})
+		apierr.Respond(w, http.StatusBadRequest, "Unsupported entity type")
 		return
 	}
 
 	price, err := resolver(ctx, req.EntityID)
 	if err != nil {
-		http.Error(w, "entity not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "entity not found")
 		return
 	}
-	if req.Amount > 0 {
-		price = req.Amount
+	// A resolved price is what the entity costs, whatever the client
+	// sends. Only entities without one, such as donations, take the
+	// payer's amount and currency.
+	if price.IsZero() && req.Amount != "" {
+		if price, err = parseAmount(req.Amount, req.Currency); err != nil {
+			respondAmountError(w, err)
+			return
+		}
+	}
+	if !price.IsPositive() {
+		apierr.Respond(w, http.StatusBadRequest, "invalid amount")
+		return
 	}
 
 	idempotencyKey := r.Header.Get("Idempotency-Key")
@@ -164,32 +160,37 @@ func (p *PaymentService) Pay(w http.ResponseWriter, r *http.Request, _ httproute
 	// Lock payer
 	acquired, err := rdx.RdxSetNX("wallet_lock:"+userID, "1", lockTTL)
 	if err != nil || !acquired {
-		http.Error(w, "please retry", http.StatusTooManyRequests)
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
 		return
 	}
 	defer rdx.RdxDel("wallet_lock:" + userID)
 
-	userAccID, err := getOrCreateAccount(ctx, userID)
+	payerAccID, err := getOrCreateAccount(ctx, userID, price.Currency)
 	if err != nil {
-		http.Error(w, "account error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
 		return
 	}
 
-	merchantAccID := "merchant:default"
-	_, _ = getOrCreateAccount(ctx, merchantAccID)
+	merchantAccID, err := getOrCreateAccount(ctx, "merchant:default", price.Currency)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
+		return
+	}
 
+	now := time.Now()
 	txn := models.Transaction{
 		ID:             utils.GetUUID(),
-		UserID:         userID, // fix: populate userID
+		UserID:         userID,
 		Type:           "payment",
 		Method:         req.Method,
-		FromAccount:    userAccID,
+		EntityID:       req.EntityID,
+		EntityType:     req.EntityType,
+		FromAccount:    payerAccID,
 		ToAccount:      merchantAccID,
 		Amount:         price,
-		Currency:       "INR",
-		Status:         "initiated", // initial state
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		Status:         "success",
+		CreatedAt:      now,
+		UpdatedAt:      now,
 		IdempotencyKey: idempotencyKey,
 		Meta: models.Meta{
 			"entity_id":   req.EntityID,
@@ -198,74 +199,18 @@ func (p *PaymentService) Pay(w http.ResponseWriter, r *http.Request, _ httproute
 		},
 	}
 
-	// Insert txn
-	if _, err := db.TransactionCollection.InsertOne(ctx, txn); err != nil {
-		http.Error(w, "payment failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Verify balance
-	var payerAcc struct {
-		CachedBalance float64 `bson:"cached_balance"`
-	}
-	if err := db.AccountsCollection.FindOne(ctx, bson.M{"_id": userAccID}).Decode(&payerAcc); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "payment failed", http.StatusInternalServerError)
-		return
-	}
-	if req.Method == "wallet" && payerAcc.CachedBalance < price {
-		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": false, "message": "Insufficient wallet balance"})
-		return
-	}
-
-	// Insert journal
-	j := models.JournalEntry{
-		ID:            utils.GetUUID(),
-		TxnID:         txn.ID,
-		DebitAccount:  userAccID,
-		CreditAccount: merchantAccID,
-		Amount:        price,
-		Currency:      "INR",
-		CreatedAt:     time.Now(),
-		Meta:          models.Meta{"note": "payment"},
-	}
-	if _, err := db.JournalCollection.InsertOne(ctx, j); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "payment failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Update balances
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": userAccID}, bson.M{
-		"$inc": bson.M{"cached_balance": -price, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "payment failed", http.StatusInternalServerError)
-		return
-	}
-
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": merchantAccID}, bson.M{
-		"$inc": bson.M{"cached_balance": price, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		txn.Status = "failed"
-		txn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-		http.Error(w, "payment failed", http.StatusInternalServerError)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := transfer(ctx, txn.ID, txn.FromAccount, txn.ToAccount, price, models.Meta{"note": "payment"}); err != nil {
+			return err
+		}
+		_, err := db.TransactionCollection.InsertOne(ctx, txn)
+		return err
+	})
+	if err != nil {
+		respondWalletError(w, r, "Payment", err)
 		return
 	}
 
-	txn.Status = "success"
-	txn.UpdatedAt = time.Now()
-	_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": txn.ID}, bson.M{"$set": txn})
-
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true, "transaction_id": txn.ID})
 }
 
@@ -275,11 +220,21 @@ func (p *PaymentService) Transfer(w http.ResponseWriter, r *http.Request, _ http
 	senderID := utils.GetUserIDFromRequest(r)
 
 	var body struct {
-		Recipient string  `json:"recipient"`
-		Amount    float64 `json:"amount"`
+		Recipient string      `json:"recipient"`
+		Amount    json.Number `json:"amount"`
+		Currency  string      `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Recipient == "" {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Recipient == "" || body.Amount <= 0 {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	amount, err := parseAmount(body.Amount, body.Currency)
+	if err != nil {
+		respondAmountError(w, err)
+		return
+	}
+	if body.Recipient == senderID {
+		apierr.Respond(w, http.StatusBadRequest, "cannot transfer to yourself")
 		return
 	}
 
@@ -293,14 +248,14 @@ func (p *PaymentService) Transfer(w http.ResponseWriter, r *http.Request, _ http
 		}
 	}
 
-	senderAccID, err := getOrCreateAccount(ctx, senderID)
+	senderAccID, err := getOrCreateAccount(ctx, senderID, amount.Currency)
 	if err != nil {
-		http.Error(w, "account error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "account error")
 		return
 	}
-	recipientAccID, err := getOrCreateAccount(ctx, body.Recipient)
+	recipientAccID, err := getOrCreateAccount(ctx, body.Recipient, amount.Currency)
 	if err != nil {
-		http.Error(w, "recipient account error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "recipient account error")
 		return
 	}
 
@@ -312,100 +267,34 @@ func (p *PaymentService) Transfer(w http.ResponseWriter, r *http.Request, _ http
 	}
 	ok, err := rdx.RdxSetNX(lockA, "1", lockTTL)
 	if err != nil || !ok {
-		http.Error(w, "please retry", http.StatusTooManyRequests)
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
 		return
 	}
 	defer rdx.RdxDel(lockA)
 
 	ok2, err := rdx.RdxSetNX(lockB, "1", lockTTL)
 	if err != nil || !ok2 {
-		rdx.RdxDel(lockA)
-		http.Error(w, "please retry", http.StatusTooManyRequests)
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
 		return
 	}
 	defer rdx.RdxDel(lockB)
 
+	now := time.Now()
 	masterTxn := models.Transaction{
 		ID:             utils.GetUUID(),
 		Type:           "transfer",
 		Method:         "transfer",
 		FromAccount:    senderAccID,
 		ToAccount:      recipientAccID,
-		Amount:         body.Amount,
-		Currency:       "INR",
-		Status:         "initiated",
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		Amount:         amount,
+		Status:         "success",
+		CreatedAt:      now,
+		UpdatedAt:      now,
 		IdempotencyKey: idempotencyKey,
 		Meta:           models.Meta{"note": "transfer"},
 	}
 
-	// Insert master transaction
-	if _, err := db.TransactionCollection.InsertOne(ctx, masterTxn); err != nil {
-		http.Error(w, "transfer failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Check sender balance while locks are held
-	var senderAcc struct {
-		CachedBalance float64 `bson:"cached_balance"`
-	}
-	if err := db.AccountsCollection.FindOne(ctx, bson.M{"_id": senderAccID}).Decode(&senderAcc); err != nil {
-		masterTxn.Status = "failed"
-		masterTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": masterTxn.ID}, bson.M{"$set": masterTxn})
-		http.Error(w, "transfer failed", http.StatusInternalServerError)
-		return
-	}
-	if senderAcc.CachedBalance < body.Amount {
-		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": false, "message": "insufficient balance"})
-		return
-	}
-
-	// Insert journal entry
-	j := models.JournalEntry{
-		ID:            utils.GetUUID(),
-		TxnID:         masterTxn.ID,
-		DebitAccount:  senderAccID,
-		CreditAccount: recipientAccID,
-		Amount:        body.Amount,
-		Currency:      "INR",
-		CreatedAt:     time.Now(),
-		Meta:          models.Meta{"note": "transfer"},
-	}
-	if _, err := db.JournalCollection.InsertOne(ctx, j); err != nil {
-		masterTxn.Status = "failed"
-		masterTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": masterTxn.ID}, bson.M{"$set": masterTxn})
-		http.Error(w, "transfer failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Update balances
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": senderAccID}, bson.M{
-		"$inc": bson.M{"cached_balance": -body.Amount, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		masterTxn.Status = "failed"
-		masterTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": masterTxn.ID}, bson.M{"$set": masterTxn})
-		http.Error(w, "transfer failed", http.StatusInternalServerError)
-		return
-	}
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": recipientAccID}, bson.M{
-		"$inc": bson.M{"cached_balance": body.Amount, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		// In standalone mongo we cannot atomically rollback sender decrement.
-		// Mark txn failed and surface to be reconciled via journals.
-		masterTxn.Status = "failed"
-		masterTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": masterTxn.ID}, bson.M{"$set": masterTxn})
-		http.Error(w, "transfer failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Insert per-user debit/credit transactions (best-effort)
+	// Per-user debit/credit records for each side's history
 	debitTxn := models.Transaction{
 		ID:         utils.GetUUID(),
 		ParentTxn:  masterTxn.ID,
@@ -414,9 +303,10 @@ func (p *PaymentService) Transfer(w http.ResponseWriter, r *http.Request, _ http
 		Method:     "transfer",
 		EntityType: "user",
 		EntityID:   body.Recipient,
-		Amount:     body.Amount,
+		Amount:     amount,
 		Status:     "success",
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
 		Meta:       models.Meta{"note": "transfer"},
 	}
 	creditTxn := models.Transaction{
@@ -427,163 +317,36 @@ func (p *PaymentService) Transfer(w http.ResponseWriter, r *http.Request, _ http
 		Method:     "transfer",
 		EntityType: "user",
 		EntityID:   senderID,
-		Amount:     body.Amount,
+		Amount:     amount,
 		Status:     "success",
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
 		Meta:       models.Meta{"note": "transfer"},
 	}
-	_, _ = db.TransactionCollection.InsertMany(ctx, []interface{}{debitTxn, creditTxn})
-
-	// Mark master txn success
-	masterTxn.Status = "success"
-	masterTxn.UpdatedAt = time.Now()
-	_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": masterTxn.ID}, bson.M{"$set": masterTxn})
-
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true, "transaction_id": masterTxn.ID})
-}
-
-// --- Refund ---
-func (p *PaymentService) Refund(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	ctx := r.Context()
-	requester := utils.GetUserIDFromRequest(r)
-	_ = requester
-
-	var body struct {
-		TransactionID string `json:"transaction_id"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TransactionID == "" {
-		http.Error(w, "invalid request", http.StatusBadRequest)
-		return
-	}
 
-	idempotencyKey := r.Header.Get("Idempotency-Key")
-	if idempotencyKey != "" {
-		var existing models.Transaction
-		if err := db.TransactionCollection.FindOne(ctx, bson.M{"external_ref": idempotencyKey, "type": "refund"}).Decode(&existing); err == nil {
-			utils.RespondWithJSON(w, http.StatusOK, existing)
-			return
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := transfer(ctx, masterTxn.ID, senderAccID, recipientAccID, amount, models.Meta{"note": "transfer"}); err != nil {
+			return err
 		}
-	}
-
-	var origTxn models.Transaction
-	if err := db.TransactionCollection.FindOne(ctx, bson.M{"_id": body.TransactionID}).Decode(&origTxn); err != nil {
-		http.Error(w, "transaction not found", http.StatusNotFound)
-		return
-	}
-	if origTxn.Status != "success" {
-		http.Error(w, "cannot refund non-success transaction", http.StatusBadRequest)
-		return
-	}
-
-	// money flows back from origTxn.ToAccount to origTxn.FromAccount
-	fromAcc := origTxn.ToAccount
-	toAcc := origTxn.FromAccount
-	if fromAcc == "" || toAcc == "" {
-		http.Error(w, "invalid original transaction accounts", http.StatusBadRequest)
-		return
-	}
-
-	// Acquire locks in deterministic order
-	lockA := "wallet_lock:" + fromAcc
-	lockB := "wallet_lock:" + toAcc
-	if lockB < lockA {
-		lockA, lockB = lockB, lockA
-	}
-	ok, err := rdx.RdxSetNX(lockA, "1", lockTTL)
-	if err != nil || !ok {
-		http.Error(w, "please retry", http.StatusTooManyRequests)
-		return
-	}
-	defer rdx.RdxDel(lockA)
-
-	ok2, err := rdx.RdxSetNX(lockB, "1", lockTTL)
-	if err != nil || !ok2 {
-		rdx.RdxDel(lockA)
-		http.Error(w, "please retry", http.StatusTooManyRequests)
-		return
-	}
-	defer rdx.RdxDel(lockB)
-
-	refundTxn := models.Transaction{
-		ID:             utils.GetUUID(),
-		Type:           "refund",
-		Method:         "refund",
-		FromAccount:    fromAcc,
-		ToAccount:      toAcc,
-		Amount:         origTxn.Amount,
-		Currency:       origTxn.Currency,
-		Status:         "initiated",
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
-		IdempotencyKey: idempotencyKey,
-		Meta:           models.Meta{"original_txn": origTxn.ID},
-	}
-
-	// Insert refund txn
-	if _, err := db.TransactionCollection.InsertOne(ctx, refundTxn); err != nil {
-		http.Error(w, "refund failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Insert reversing journal
-	j := models.JournalEntry{
-		ID:            utils.GetUUID(),
-		TxnID:         refundTxn.ID,
-		DebitAccount:  refundTxn.FromAccount,
-		CreditAccount: refundTxn.ToAccount,
-		Amount:        refundTxn.Amount,
-		Currency:      refundTxn.Currency,
-		CreatedAt:     time.Now(),
-		Meta:          models.Meta{"note": "refund", "original_txn": origTxn.ID},
-	}
-	if _, err := db.JournalCollection.InsertOne(ctx, j); err != nil {
-		refundTxn.Status = "failed"
-		refundTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.ID}, bson.M{"$set": refundTxn})
-		http.Error(w, "refund failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Decrement original recipient (fromAcc)
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.FromAccount}, bson.M{
-		"$inc": bson.M{"cached_balance": -refundTxn.Amount, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		refundTxn.Status = "failed"
-		refundTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.ID}, bson.M{"$set": refundTxn})
-		http.Error(w, "refund failed", http.StatusInternalServerError)
-		return
-	}
-
-	// Credit original payer (toAcc)
-	if _, err := db.AccountsCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.ToAccount}, bson.M{
-		"$inc": bson.M{"cached_balance": refundTxn.Amount, "version": 1},
-		"$set": bson.M{"updated_at": time.Now()},
-	}); err != nil {
-		// Cannot rollback the decrement on standalone mongo. Mark failed and surface for reconciliation.
-		refundTxn.Status = "failed"
-		refundTxn.UpdatedAt = time.Now()
-		_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.ID}, bson.M{"$set": refundTxn})
-		http.Error(w, "refund failed", http.StatusInternalServerError)
+		_, err := db.TransactionCollection.InsertMany(ctx, []interface{}{masterTxn, debitTxn, creditTxn})
+		return err
+	})
+	if err != nil {
+		respondWalletError(w, r, "Transfer", err)
 		return
 	}
 
-	// Mark refund success
-	refundTxn.Status = "success"
-	refundTxn.UpdatedAt = time.Now()
-	_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": refundTxn.ID}, bson.M{"$set": refundTxn})
-
-	// Best-effort mark original txn reversed
-	_, _ = db.TransactionCollection.UpdateOne(ctx, bson.M{"_id": origTxn.ID}, bson.M{"$set": bson.M{"status": "reversed", "updated_at": time.Now()}})
-
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true, "transaction_id": refundTxn.ID})
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true, "transaction_id": masterTxn.ID})
 }
 
 // --- Helper: fetch or create account ---
-func getOrCreateAccount(ctx context.Context, userID string) (string, error) {
+
+// getOrCreateAccount returns the ID of userID's account in currency,
+// opening it on first use.
+func getOrCreateAccount(ctx context.Context, userID, currency string) (string, error) {
+	filter := bson.M{"userid": userID, "currency": currency}
 	var acc models.Account
-	err := db.AccountsCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&acc)
+	err := db.AccountsCollection.FindOne(ctx, filter).Decode(&acc)
 	if err == nil {
 		return acc.ID, nil
 	}
@@ -591,7 +354,7 @@ func getOrCreateAccount(ctx context.Context, userID string) (string, error) {
 	newAcc := models.Account{
 		ID:            utils.GetUUID(),
 		UserID:        userID,
-		Currency:      "INR",
+		Currency:      currency,
 		Status:        "active",
 		CachedBalance: 0,
 		Version:       1,
@@ -602,7 +365,7 @@ func getOrCreateAccount(ctx context.Context, userID string) (string, error) {
 	_, err = db.AccountsCollection.InsertOne(ctx, newAcc)
 	if err != nil {
 		// If concurrent create happened, try to read again
-		if err := db.AccountsCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&acc); err == nil {
+		if err := db.AccountsCollection.FindOne(ctx, filter).Decode(&acc); err == nil {
 			return acc.ID, nil
 		}
 		return "", err
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -31,8 +32,7 @@ func InitIdempotencyIndexes(ctx context.Context) error {
 			Options: options.Index().SetExpireAfterSeconds(0).SetName("ttl_expires_at"),
 		},
 	}
-	_, err := db.IdempotencyCollection.Indexes().CreateMany(ctx, idxs)
-	return err
+	return db.CreateIndexes(ctx, db.IdempotencyCollection, idxs...)
 }
 
 func computeRequestHash(r *http.Request, bodyBytes []byte, userID string) string {
@@ -121,7 +121,7 @@ func IdempotencyMiddleware(next http.Handler) http.Handler {
 		// Limit body size to 1 MB to prevent memory issues
 		bodyBytes, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 		if err != nil {
-			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			apierr.Respond(w, http.StatusBadRequest, "failed to read request body")
 			return
 		}
 		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -164,20 +164,20 @@ func IdempotencyMiddleware(next http.Handler) http.Handler {
 
 		// Check for duplicate key
 		if !isDuplicateKeyError(err) {
-			http.Error(w, "idempotency lookup error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "idempotency lookup error")
 			return
 		}
 
 		// Fetch existing record
 		var existing models.IdempotencyRecord
 		if err := db.IdempotencyCollection.FindOne(ctx, bson.M{"key": key}).Decode(&existing); err != nil {
-			http.Error(w, "idempotency lookup error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "idempotency lookup error")
 			return
 		}
 
 		// Request hash mismatch -> conflict
 		if existing.RequestHash != reqHash {
-			http.Error(w, "idempotency-key conflict", http.StatusConflict)
+			apierr.Respond(w, http.StatusConflict, "idempotency-key conflict")
 			return
 		}
 
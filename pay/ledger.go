@@ -0,0 +1,131 @@
+package pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/models"
+	"naevis/money"
+	"naevis/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Every wallet mutation runs in one db.RunInTransaction, so a
+// transaction record, its journal entry and both balance updates commit
+// together or not at all. The Redis wallet locks only keep concurrent
+// requests from fighting over the same documents; correctness does not
+// depend on them. Balances move only through conditional updates: a
+// debit matches only while the balance covers it, and a refund first
+// claims its share of the original transaction's unrefunded amount, so an
+// expired lock or a repeated request cannot overdraw a wallet or refund
+// more than was paid.
+
+var (
+	// errInsufficientFunds is returned when a debit would overdraw an
+	// account.
+	errInsufficientFunds = errors.New("pay: insufficient funds")
+	// errNotRefundable is returned when the transaction to refund has
+	// nothing left to refund, e.g. because it was refunded in full, or
+	// another refund changed it first.
+	errNotRefundable = errors.New("pay: transaction is not refundable")
+)
+
+// externalPrefix marks accounts outside the wallets, such as the bank
+// behind a top-up. They have no account document and no balance.
+const externalPrefix = "external:"
+
+// transfer moves amount from the debit account to the credit account and
+// journals it under txnID. Both accounts must hold amount's currency.
+// ctx must be a transaction's.
+func transfer(ctx context.Context, txnID, debitAcc, creditAcc string, amount money.Money, meta models.Meta) error {
+	now := time.Now()
+	if !strings.HasPrefix(debitAcc, externalPrefix) {
+		res, err := db.AccountsCollection.UpdateOne(ctx,
+			bson.M{"_id": debitAcc, "currency": amount.Currency, "cached_balance": bson.M{"$gte": amount.Minor}},
+			bson.M{
+				"$inc": bson.M{"cached_balance": -amount.Minor, "version": 1},
+				"$set": bson.M{"updated_at": now},
+			})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errInsufficientFunds
+		}
+	}
+	if !strings.HasPrefix(creditAcc, externalPrefix) {
+		res, err := db.AccountsCollection.UpdateOne(ctx,
+			bson.M{"_id": creditAcc, "currency": amount.Currency},
+			bson.M{
+				"$inc": bson.M{"cached_balance": amount.Minor, "version": 1},
+				"$set": bson.M{"updated_at": now},
+			})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return fmt.Errorf("pay: no %s account %s", amount.Currency, creditAcc)
+		}
+	}
+
+	_, err := db.JournalCollection.InsertOne(ctx, models.JournalEntry{
+		ID:            utils.GetUUID(),
+		TxnID:         txnID,
+		DebitAccount:  debitAcc,
+		CreditAccount: creditAcc,
+		Amount:        amount,
+		CreatedAt:     now,
+		Meta:          meta,
+	})
+	return err
+}
+
+// parseAmount reads a positive amount in major units, sent as a JSON
+// number or string, in currency or else in money.Default.
+func parseAmount(amount json.Number, currency string) (money.Money, error) {
+	if currency == "" {
+		currency = money.Default
+	}
+	m, err := money.Parse(amount.String(), currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if !m.IsPositive() {
+		return money.Money{}, fmt.Errorf("%w: not positive", money.ErrSyntax)
+	}
+	return m, nil
+}
+
+// respondAmountError answers a request whose amount parseAmount refused.
+func respondAmountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, money.ErrCurrency):
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "currency", Message: "is not a supported currency"}))
+	case errors.Is(err, money.ErrPrecision):
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "amount", Message: "has more decimal places than the currency"}))
+	default:
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "amount", Message: "must be a positive decimal amount"}))
+	}
+}
+
+// respondWalletError answers a failed wallet mutation named op.
+func respondWalletError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, errInsufficientFunds):
+		apierr.Write(w, apierr.New(http.StatusPaymentRequired, apierr.CodeInsufficientFunds, "Insufficient wallet balance"))
+	case errors.Is(err, errNotRefundable):
+		apierr.Respond(w, http.StatusConflict, "transaction is not refundable")
+	default:
+		slog.ErrorContext(r.Context(), "wallet mutation failed", "op", op, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, strings.ToLower(op)+" failed")
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"log"
+	"log/slog"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
+	"naevis/money"
+	"naevis/pagination"
 	"naevis/rdx"
 	"naevis/utils"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
@@ -19,12 +22,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// PriceResolver resolves entityID -> price
-type PriceResolver func(ctx context.Context, entityID string) (float64, error)
+// PriceResolver resolves entityID -> price. Entities without a fixed
+// price resolve to the zero Money and the payer names the amount.
+type PriceResolver func(ctx context.Context, entityID string) (money.Money, error)
 
 // PaymentService handles all wallet/payment ops
 type PaymentService struct {
 	resolvers map[string]PriceResolver
+	policies  map[string]RefundPolicy
 	rLock     sync.RWMutex
 	rdx       *redis.Client
 }
@@ -33,6 +38,7 @@ type PaymentService struct {
 func NewPaymentService() *PaymentService {
 	return &PaymentService{
 		resolvers: make(map[string]PriceResolver),
+		policies:  make(map[string]RefundPolicy),
 		rdx:       rdx.Conn,
 	}
 }
@@ -58,101 +64,134 @@ func (p *PaymentService) GetResolver(entityType string) (PriceResolver, error) {
 
 // RegisterDefaultResolvers adds built-in resolvers
 func (p *PaymentService) RegisterDefaultResolvers() {
-	p.RegisterResolver("ticket", func(ctx context.Context, entityID string) (float64, error) {
+	p.RegisterResolver("ticket", func(ctx context.Context, entityID string) (money.Money, error) {
 		var ticket struct {
-			Price float64 `bson:"price"`
+			Price money.Money `bson:"price"`
 		}
 		if err := db.TicketsCollection.FindOne(ctx, bson.M{"ticketid": entityID}).Decode(&ticket); err != nil {
-			return 0, err
+			return money.Money{}, err
 		}
 		return ticket.Price, nil
 	})
 
-	p.RegisterResolver("restaurant", func(ctx context.Context, entityID string) (float64, error) {
+	// Menu and service prices are still kept in rupees as floats.
+	p.RegisterResolver("restaurant", func(ctx context.Context, entityID string) (money.Money, error) {
 		var menu struct {
 			Price float64 `bson:"price"`
 		}
 		if err := db.MenuCollection.FindOne(ctx, bson.M{"menuid": entityID}).Decode(&menu); err != nil {
-			return 0, err
+			return money.Money{}, err
 		}
-		return menu.Price, nil
+		return money.FromFloat(menu.Price, money.Default)
 	})
 
-	p.RegisterResolver("barber", func(ctx context.Context, entityID string) (float64, error) {
+	p.RegisterResolver("barber", func(ctx context.Context, entityID string) (money.Money, error) {
 		var service struct {
 			Price float64 `bson:"price"`
 		}
 		if err := db.ServiceCollection.FindOne(ctx, bson.M{"serviceid": entityID}).Decode(&service); err != nil {
-			return 0, err
+			return money.Money{}, err
+		}
+		return money.FromFloat(service.Price, money.Default)
+	})
+
+	// Booking prices are kept in rupees as floats too.
+	p.RegisterResolver("booking", func(ctx context.Context, entityID string) (money.Money, error) {
+		var booking struct {
+			PricePaid float64 `bson:"pricePaid"`
+		}
+		if err := db.BookingsCollection.FindOne(ctx, bson.M{"id": entityID}).Decode(&booking); err != nil {
+			return money.Money{}, err
 		}
-		return service.Price, nil
+		return money.FromFloat(booking.PricePaid, money.Default)
 	})
 
-	p.RegisterResolver("post", func(ctx context.Context, entityID string) (float64, error) {
+	p.RegisterResolver("post", func(ctx context.Context, entityID string) (money.Money, error) {
 		// posts have no fixed price; user chooses donation
 		var post struct {
 			PostID string `bson:"postid"`
 		}
 		if err := db.BlogPostsCollection.FindOne(ctx, bson.M{"postid": entityID}).Decode(&post); err != nil {
-			return 0, err
+			return money.Money{}, err
 		}
-		return 0, nil
+		return money.Money{}, nil
 	})
-	p.RegisterResolver("order", func(ctx context.Context, entityID string) (float64, error) {
+	p.RegisterResolver("order", func(ctx context.Context, entityID string) (money.Money, error) {
 		// var order struct {
 		// 	OrderID string `bson:"orderid"`
 		// }
 		// if err := db.OrderCollection.FindOne(ctx, bson.M{"orderid": entityID}).Decode(&order); err != nil {
-		// 	return 0, err
+		// 	return money.Money{}, err
 		// }
-		return 0, nil
+		return money.Money{}, nil
 	})
 }
 
 // ===== Handlers =====
 
-// GetBalance returns user's wallet balance (from AccountsCollection)
+// GetBalance returns the user's balance in every currency they hold, and
+// as "balance" the one in ?currency= (rupees by default).
 func (p *PaymentService) GetBalance(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	userID := utils.GetUserIDFromRequest(r)
 
-	var acc struct {
-		CachedBalance float64 `bson:"cached_balance"`
+	currency := money.Default
+	if c := r.URL.Query().Get("currency"); c != "" {
+		var err error
+		if currency, err = money.Currency(c); err != nil {
+			apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "currency", Message: "is not a supported currency"}))
+			return
+		}
 	}
-	err := db.AccountsCollection.FindOne(ctx, bson.M{"userid": userID}).Decode(&acc)
+
+	cur, err := db.AccountsCollection.Find(ctx, bson.M{"userid": userID}, options.Find().SetSort(bson.M{"currency": 1}))
 	if err != nil {
-		log.Printf("GetBalance: account not found for user %s, err=%v\n", userID, err)
-		http.Error(w, "account not found", http.StatusNotFound)
+		slog.ErrorContext(ctx, "balance lookup failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	var accounts []models.Account
+	if err := cur.All(ctx, &accounts); err != nil {
+		slog.ErrorContext(ctx, "balance decode failed", "user_id", userID, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if len(accounts) == 0 {
+		apierr.Respond(w, http.StatusNotFound, "account not found")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"balance": acc.CachedBalance})
+	balance := money.Money{Currency: currency}
+	balances := make([]money.Money, 0, len(accounts))
+	for _, acc := range accounts {
+		if acc.Currency == currency {
+			balance = acc.Balance()
+		}
+		balances = append(balances, acc.Balance())
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"balance": balance, "balances": balances})
 }
 
-// ListTransactions returns paginated wallet transactions for the logged-in user
+// txnSort lists a wallet's transactions newest first; _id breaks ties.
+var txnSort = pagination.Sort{Field: "created_at", IDField: "_id", Desc: true}
+
+// ListTransactions returns one page of wallet transactions for the logged-in
+// user. Pass next_cursor back as ?cursor= for the following page.
 func (p *PaymentService) ListTransactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	userID := utils.GetUserIDFromRequest(r)
 
-	// Parse query parameters
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit <= 0 || limit > 50 {
-		limit = 20
-	}
-	skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
-	if skip < 0 {
-		skip = 0
+	page, err := pagination.Parse(r, 20, 50)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
 	}
 
-	findOptions := options.Find().
-		SetSort(bson.M{"created_at": -1}).
-		SetLimit(int64(limit)).
-		SetSkip(int64(skip))
-
-	cur, err := db.TransactionCollection.Find(ctx, bson.M{"userid": userID}, findOptions)
+	filter := txnSort.Filter(bson.M{"userid": userID}, page.After)
+	cur, err := db.TransactionCollection.Find(ctx, filter, txnSort.FindOptions(page.Limit))
 	if err != nil {
 		log.Printf("ListTransactions: DB error for user %s, err=%v\n", userID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 	defer cur.Close(ctx)
@@ -160,12 +199,16 @@ func (p *PaymentService) ListTransactions(w http.ResponseWriter, r *http.Request
 	var txns []models.Transaction
 	if err = cur.All(ctx, &txns); err != nil {
 		log.Printf("ListTransactions: decode error for user %s, err=%v\n", userID, err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 
+	txns, next := pagination.Trim(txns, page.Limit, func(t models.Transaction) pagination.Cursor {
+		return pagination.Cursor{Key: t.CreatedAt, ID: t.ID}
+	})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"transactions": txns,
+		"next_cursor":  next,
 	})
 }
 
@@ -0,0 +1,219 @@
+package pay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"naevis/db"
+	"naevis/db/memdb"
+	"naevis/globals"
+	"naevis/models"
+	"naevis/money"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// newTestService points db and rdx at fresh in-memory backends and
+// returns a service that sells "thing" entities for 30 rupees. User "mo"
+// is the merchant of every thing.
+func newTestService(t *testing.T) *PaymentService {
+	t.Helper()
+	db.Use(memdb.NewStore())
+	client := memredis.NewClient()
+	rdx.Use(client)
+	t.Cleanup(func() { client.Close() })
+
+	p := NewPaymentService()
+	p.RegisterResolver("thing", func(context.Context, string) (money.Money, error) {
+		return money.Money{Minor: 3000, Currency: "INR"}, nil
+	})
+	p.RegisterRefundPolicy("thing", RefundPolicy{
+		Merchant: func(context.Context, string) (string, error) { return "mo", nil },
+	})
+	return p
+}
+
+// do calls h as userID with body and decodes the JSON answer.
+func do(h httprouter.Handle, userID, body string) (int, map[string]any) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), globals.UserIDKey, userID))
+	rec := httptest.NewRecorder()
+	h(rec, req, nil)
+	var out map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+// asAdmin runs h as an admin who logged in with MFA.
+func asAdmin(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := context.WithValue(r.Context(), globals.RoleKey, []string{"user", "admin"})
+		ctx = context.WithValue(ctx, globals.MFAKey, true)
+		h(w, r.WithContext(ctx), ps)
+	}
+}
+
+// balance returns the cached balance of userID's rupee wallet in paise.
+func balance(t *testing.T, userID string) int64 {
+	t.Helper()
+	return balanceIn(t, userID, "INR")
+}
+
+func balanceIn(t *testing.T, userID, currency string) int64 {
+	t.Helper()
+	var acc models.Account
+	filter := bson.M{"userid": userID, "currency": currency}
+	if err := db.AccountsCollection.FindOne(context.Background(), filter).Decode(&acc); err != nil {
+		t.Fatalf("%s account of %s: %v", currency, userID, err)
+	}
+	return acc.CachedBalance
+}
+
+func TestWalletPayments(t *testing.T) {
+	p := newTestService(t)
+
+	if code, _ := do(p.TopUp, "ann", `{"amount":50,"method":"upi"}`); code != http.StatusOK {
+		t.Fatalf("topup = %d", code)
+	}
+	// The payer's amount does not override the thing's price.
+	if code, _ := do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"wallet","amount":"0.01"}`); code != http.StatusOK {
+		t.Fatalf("pay = %d", code)
+	}
+
+	// The second purchase would overdraw the wallet and changes nothing.
+	if code, _ := do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"wallet"}`); code != http.StatusPaymentRequired {
+		t.Errorf("overdrawing pay = %d, want 402", code)
+	}
+	if got := balance(t, "ann"); got != 2000 {
+		t.Errorf("balance = %v, want 2000", got)
+	}
+	if got := balance(t, "merchant:default"); got != 3000 {
+		t.Errorf("merchant balance = %v, want 3000", got)
+	}
+
+	// Card payments are refused: no money would be collected.
+	if code, _ := do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"card"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("card pay = %d, want 422", code)
+	}
+	if got := balance(t, "merchant:default"); got != 3000 {
+		t.Errorf("merchant balance after card attempt = %v, want 3000", got)
+	}
+
+	n, _ := db.JournalCollection.CountDocuments(context.Background(), bson.M{})
+	if n != 2 {
+		t.Errorf("journal entries = %d, want 2", n)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	p := newTestService(t)
+	do(p.TopUp, "ann", `{"amount":50}`)
+
+	if code, _ := do(p.Transfer, "ann", `{"recipient":"bob","amount":80}`); code != http.StatusPaymentRequired {
+		t.Errorf("overdrawing transfer = %d, want 402", code)
+	}
+	if code, _ := do(p.Transfer, "ann", `{"recipient":"bob","amount":20}`); code != http.StatusOK {
+		t.Fatalf("transfer = %d", code)
+	}
+	if a, b := balance(t, "ann"), balance(t, "bob"); a != 3000 || b != 2000 {
+		t.Errorf("balances = %v, %v, want 3000, 2000", a, b)
+	}
+	n, _ := db.TransactionCollection.CountDocuments(context.Background(), bson.M{"type": bson.M{"$in": bson.A{"debit", "credit"}}})
+	if n != 2 {
+		t.Errorf("per-user transfer records = %d, want 2", n)
+	}
+}
+
+func TestRefundOnlyOnce(t *testing.T) {
+	p := newTestService(t)
+	do(p.TopUp, "ann", `{"amount":50}`)
+	_, paid := do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"wallet"}`)
+	body := `{"transaction_id":"` + paid["transaction_id"].(string) + `"}`
+
+	if code, out := do(p.Refund, "mo", body); code != http.StatusOK {
+		t.Fatalf("refund = %d %v", code, out)
+	}
+	if code, _ := do(p.Refund, "mo", body); code == http.StatusOK {
+		t.Error("second refund succeeded")
+	}
+	if a, m := balance(t, "ann"), balance(t, "merchant:default"); a != 5000 || m != 0 {
+		t.Errorf("balances = %v, %v, want 5000, 0", a, m)
+	}
+}
+
+func TestAmountsAreExact(t *testing.T) {
+	p := newTestService(t)
+
+	for i := 0; i < 3; i++ {
+		if code, out := do(p.TopUp, "ann", `{"amount":"0.10"}`); code != http.StatusOK {
+			t.Fatalf("topup = %d %v", code, out)
+		}
+	}
+	if got := balance(t, "ann"); got != 30 {
+		t.Errorf("three topups of 0.10 = %d paise, want 30", got)
+	}
+	if code, _ := do(p.TopUp, "ann", `{"amount":0.001}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("topup of a tenth of a paisa = %d, want 422", code)
+	}
+	if code, _ := do(p.TopUp, "ann", `{"amount":"5","currency":"XXX"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("topup in an unknown currency = %d, want 422", code)
+	}
+}
+
+func TestWalletPerCurrencyAndConvert(t *testing.T) {
+	p := newTestService(t)
+	do(p.TopUp, "ann", `{"amount":100}`)
+	do(p.TopUp, "ann", `{"amount":"2.50","currency":"usd"}`)
+	if got := balanceIn(t, "ann", "USD"); got != 250 {
+		t.Errorf("USD balance = %d cents, want 250", got)
+	}
+
+	// Money in one currency does not pay for things priced in another.
+	if code, _ := do(p.Transfer, "ann", `{"recipient":"bob","amount":"3","currency":"USD"}`); code != http.StatusPaymentRequired {
+		t.Errorf("transfer beyond USD balance = %d, want 402", code)
+	}
+
+	convert := `{"amount":"100","from":"INR","to":"USD"}`
+	if code, _ := do(p.Convert, "ann", convert); code != http.StatusUnprocessableEntity {
+		t.Errorf("convert without a rate = %d, want 422", code)
+	}
+	setRate := func(base, quote, body string) int {
+		code, _ := do(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			SetRate(w, r, httprouter.Params{{Key: "base", Value: base}, {Key: "quote", Value: quote}})
+		}, "admin-1", body)
+		return code
+	}
+	if code := setRate("USD", "USD", `{"rate":"1"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("rate for a pair with itself = %d, want 422", code)
+	}
+	if code := setRate("USD", "INR", `{"rate":"83.50"}`); code != http.StatusOK {
+		t.Fatalf("set rate = %d", code)
+	}
+
+	// 100 rupees at 83.50 to the dollar is 1.1976 dollars.
+	code, out := do(p.Convert, "ann", convert)
+	if code != http.StatusOK {
+		t.Fatalf("convert = %d %v", code, out)
+	}
+	if got := out["credited"]; got.(map[string]any)["amount"] != "1.20" {
+		t.Errorf("credited %v, want 1.20 USD", got)
+	}
+	if inr, usd := balance(t, "ann"), balanceIn(t, "ann", "USD"); inr != 0 || usd != 370 {
+		t.Errorf("balances = %d paise, %d cents; want 0, 370", inr, usd)
+	}
+
+	_, out = do(p.GetBalance, "ann", "")
+	if balances, _ := out["balances"].([]any); len(balances) != 2 {
+		t.Errorf("GetBalance = %v", out)
+	}
+	if report, err := Reconcile(context.Background()); err != nil || !report.Balanced {
+		t.Errorf("ledger after conversion: %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,535 @@
+package pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/models"
+	"naevis/pagination"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reconciliation checks the journal against the cached balances. An
+// account's balance is the sum of its journal credits less its debits;
+// every posted transaction must be journaled for exactly its amount, and
+// nothing else may be journaled. Repairs only ever move a cached balance
+// to what the journal says, and each one is kept in ledger_audit.
+//
+// Amounts are compared exactly, in minor units. An account and the
+// transactions journaled against it are all in one currency, so sums
+// never mix currencies.
+
+// JobReconcile is the scheduler job that reconciles the ledger.
+const JobReconcile = "pay.reconcile"
+
+// Problems recorded for transactions.
+const (
+	ProblemUnjournaled = "posted transaction has no journal entries"
+	ProblemMismatch    = "journaled amount differs from the transaction"
+	ProblemUnposted    = "journal entries for a transaction that was not posted"
+	ProblemOrphan      = "journal entries for a missing transaction"
+	ProblemBadAmount   = "journal entry amount is not positive"
+)
+
+// postedStates are the transaction states whose money has moved.
+var postedStates = map[string]bool{"success": true, statePartiallyRefunded: true, stateReversed: true}
+
+// maxIssues caps each issue list in a stored report; the counts are exact.
+const maxIssues = 500
+
+// ReconcileReport is the stored result of one reconciliation.
+type ReconcileReport struct {
+	ID                string         `bson:"_id" json:"id"`
+	StartedAt         time.Time      `bson:"started_at" json:"started_at"`
+	FinishedAt        time.Time      `bson:"finished_at" json:"finished_at"`
+	Accounts          int            `bson:"accounts" json:"accounts"`
+	Transactions      int            `bson:"transactions" json:"transactions"`
+	Balanced          bool           `bson:"balanced" json:"balanced"`
+	AccountIssueCount int            `bson:"account_issue_count" json:"account_issue_count"`
+	TxnIssueCount     int            `bson:"txn_issue_count" json:"txn_issue_count"`
+	AccountIssues     []AccountIssue `bson:"account_issues" json:"account_issues,omitempty"`
+	TxnIssues         []TxnIssue     `bson:"txn_issues" json:"txn_issues,omitempty"`
+}
+
+// AccountIssue is an account whose cached balance disagrees with the
+// journal. Amounts are in minor units of Currency.
+type AccountIssue struct {
+	AccountID string `bson:"account_id" json:"account_id"`
+	UserID    string `bson:"userid,omitempty" json:"userid,omitempty"`
+	Currency  string `bson:"currency,omitempty" json:"currency,omitempty"`
+	Cached    int64  `bson:"cached" json:"cached"`
+	Journaled int64  `bson:"journaled" json:"journaled"`
+	// Missing is set when the journal names an account that does not
+	// exist; it cannot be repaired.
+	Missing bool `bson:"missing,omitempty" json:"missing,omitempty"`
+}
+
+// TxnIssue is a transaction whose journal entries do not account for it.
+// Amounts are in minor units of Currency.
+type TxnIssue struct {
+	TxnID     string `bson:"txn_id" json:"txn_id"`
+	Problem   string `bson:"problem" json:"problem"`
+	Currency  string `bson:"currency,omitempty" json:"currency,omitempty"`
+	Amount    int64  `bson:"amount" json:"amount"`
+	Journaled int64  `bson:"journaled" json:"journaled"`
+}
+
+// BalanceRepair is the audit record of one cached balance repair.
+// Balances are in minor units of Currency.
+type BalanceRepair struct {
+	ID        string    `bson:"_id" json:"id"`
+	AccountID string    `bson:"account_id" json:"account_id"`
+	ReportID  string    `bson:"report_id" json:"report_id"`
+	Currency  string    `bson:"currency" json:"currency"`
+	Before    int64     `bson:"before" json:"before"`
+	After     int64     `bson:"after" json:"after"`
+	Reason    string    `bson:"reason" json:"reason"`
+	By        string    `bson:"by" json:"by"`
+	At        time.Time `bson:"at" json:"at"`
+}
+
+// ReconcileJob is the JobReconcile job.
+func ReconcileJob(ctx context.Context, _ json.RawMessage) error {
+	report, err := Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	if !report.Balanced {
+		slog.WarnContext(ctx, "ledger out of balance", "report_id", report.ID,
+			"account_issues", report.AccountIssueCount, "txn_issues", report.TxnIssueCount)
+	}
+	return nil
+}
+
+// Reconcile checks the whole ledger and stores the report.
+func Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	report := &ReconcileReport{ID: utils.GetUUID(), StartedAt: time.Now().UTC()}
+
+	if err := checkTransactions(ctx, report); err != nil {
+		return nil, fmt.Errorf("check transactions: %w", err)
+	}
+	if err := checkAccounts(ctx, report); err != nil {
+		return nil, fmt.Errorf("check accounts: %w", err)
+	}
+
+	report.Balanced = report.AccountIssueCount == 0 && report.TxnIssueCount == 0
+	report.FinishedAt = time.Now().UTC()
+	if _, err := db.ReconciliationsCollection.InsertOne(ctx, report); err != nil {
+		return nil, fmt.Errorf("store report: %w", err)
+	}
+	return report, nil
+}
+
+func (r *ReconcileReport) addTxnIssue(issue TxnIssue) {
+	r.TxnIssueCount++
+	if len(r.TxnIssues) < maxIssues {
+		r.TxnIssues = append(r.TxnIssues, issue)
+	}
+}
+
+func (r *ReconcileReport) addAccountIssue(issue AccountIssue) {
+	r.AccountIssueCount++
+	if len(r.AccountIssues) < maxIssues {
+		r.AccountIssues = append(r.AccountIssues, issue)
+	}
+}
+
+// checkTransactions compares each transaction that moves money between
+// accounts with the journal entries filed under it.
+func checkTransactions(ctx context.Context, report *ReconcileReport) error {
+	journaled, err := sumJournal(ctx, "$txn_id", nil)
+	if err != nil {
+		return err
+	}
+
+	cur, err := db.TransactionCollection.Find(ctx,
+		bson.M{"from_account": bson.M{"$exists": true}, "to_account": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "amount": 1, "currency": 1, "state": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var txn models.Transaction
+		if err := cur.Decode(&txn); err != nil {
+			return err
+		}
+		report.Transactions++
+		sum, has := journaled[txn.ID]
+		delete(journaled, txn.ID)
+		issue := TxnIssue{TxnID: txn.ID, Currency: txn.Amount.Currency, Amount: txn.Amount.Minor, Journaled: sum}
+		switch {
+		case !postedStates[txn.Status] && has:
+			issue.Problem = ProblemUnposted
+			report.addTxnIssue(issue)
+		case postedStates[txn.Status] && !has:
+			issue.Problem = ProblemUnjournaled
+			report.addTxnIssue(issue)
+		case has && sum != txn.Amount.Minor:
+			issue.Problem = ProblemMismatch
+			report.addTxnIssue(issue)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	// Whatever is left was journaled under no known transaction.
+	for _, id := range sortedKeys(journaled) {
+		report.addTxnIssue(TxnIssue{TxnID: id, Problem: ProblemOrphan, Journaled: journaled[id]})
+	}
+
+	bad, err := sumJournal(ctx, "$txn_id", bson.M{"amount": bson.M{"$lte": 0}})
+	if err != nil {
+		return err
+	}
+	for _, id := range sortedKeys(bad) {
+		report.addTxnIssue(TxnIssue{TxnID: id, Problem: ProblemBadAmount, Journaled: bad[id]})
+	}
+	return nil
+}
+
+// checkAccounts compares every cached balance with the journal. Money
+// can move while the ledger is scanned, so each suspect account is
+// checked again on its own before it is reported.
+func checkAccounts(ctx context.Context, report *ReconcileReport) error {
+	credits, err := sumJournal(ctx, "$credit_account", nil)
+	if err != nil {
+		return err
+	}
+	debits, err := sumJournal(ctx, "$debit_account", nil)
+	if err != nil {
+		return err
+	}
+	journaled := map[string]int64{}
+	for id, v := range credits {
+		journaled[id] += v
+	}
+	for id, v := range debits {
+		journaled[id] -= v
+	}
+
+	cur, err := db.AccountsCollection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"_id": 1, "cached_balance": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	var suspects []string
+	for cur.Next(ctx) {
+		var acc models.Account
+		if err := cur.Decode(&acc); err != nil {
+			return err
+		}
+		report.Accounts++
+		if acc.CachedBalance != journaled[acc.ID] {
+			suspects = append(suspects, acc.ID)
+		}
+		delete(journaled, acc.ID)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range suspects {
+		acc, balance, err := accountBalance(ctx, id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue // deleted since the scan
+		}
+		if err != nil {
+			return err
+		}
+		if acc.CachedBalance != balance {
+			report.addAccountIssue(AccountIssue{
+				AccountID: id,
+				UserID:    acc.UserID,
+				Currency:  acc.Currency,
+				Cached:    acc.CachedBalance,
+				Journaled: balance,
+			})
+		}
+	}
+	for _, id := range sortedKeys(journaled) {
+		if strings.HasPrefix(id, externalPrefix) {
+			continue
+		}
+		report.addAccountIssue(AccountIssue{AccountID: id, Journaled: journaled[id], Missing: true})
+	}
+	return nil
+}
+
+// sumJournal totals journal amounts grouped by the field expression key,
+// over the entries matching match.
+func sumJournal(ctx context.Context, key string, match bson.M) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{}
+	if match != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: key},
+		{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+	}}})
+	cur, err := db.JournalCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID    string `bson:"_id"`
+		Total int64  `bson:"total"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		sums[row.ID] = row.Total
+	}
+	return sums, nil
+}
+
+// accountBalance returns an account and its balance according to the
+// journal, read so that no posting landed in between: the account's
+// version must be the same before and after the journal is summed.
+func accountBalance(ctx context.Context, accID string) (models.Account, int64, error) {
+	var acc models.Account
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := db.AccountsCollection.FindOne(ctx, bson.M{"_id": accID}).Decode(&acc); err != nil {
+			return acc, 0, err
+		}
+		credits, err := sumJournal(ctx, "$credit_account", bson.M{"credit_account": accID})
+		if err != nil {
+			return acc, 0, err
+		}
+		debits, err := sumJournal(ctx, "$debit_account", bson.M{"debit_account": accID})
+		if err != nil {
+			return acc, 0, err
+		}
+		var after models.Account
+		if err := db.AccountsCollection.FindOne(ctx, bson.M{"_id": accID}).Decode(&after); err != nil {
+			return acc, 0, err
+		}
+		if after.Version == acc.Version {
+			return acc, credits[accID] - debits[accID], nil
+		}
+	}
+	return acc, 0, fmt.Errorf("account %s kept changing", accID)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// errBalanceMoved is returned when an account changes during its repair.
+var errBalanceMoved = errors.New("pay: balance changed during repair")
+
+// repairBalance sets the cached balance of accID to its journal balance
+// and records the change. It reports nil, nil when there was nothing to
+// repair.
+func repairBalance(ctx context.Context, accID, reportID, reason, by string) (*BalanceRepair, error) {
+	var repair *BalanceRepair
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		repair = nil
+		acc, balance, err := accountBalance(ctx, accID)
+		if err != nil {
+			return err
+		}
+		if acc.CachedBalance == balance {
+			return nil
+		}
+		now := time.Now().UTC()
+		res, err := db.AccountsCollection.UpdateOne(ctx,
+			bson.M{"_id": accID, "version": acc.Version},
+			bson.M{
+				"$set": bson.M{"cached_balance": balance, "updated_at": now},
+				"$inc": bson.M{"version": 1},
+			})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errBalanceMoved
+		}
+		repair = &BalanceRepair{
+			ID:        utils.GetUUID(),
+			AccountID: accID,
+			ReportID:  reportID,
+			Currency:  acc.Currency,
+			Before:    acc.CachedBalance,
+			After:     balance,
+			Reason:    reason,
+			By:        by,
+			At:        now,
+		}
+		_, err = db.LedgerAuditCollection.InsertOne(ctx, repair)
+		return err
+	})
+	return repair, err
+}
+
+// reconcileSort lists reports newest first; _id breaks ties.
+var reconcileSort = pagination.Sort{Field: "started_at", IDField: "_id", Desc: true}
+
+// ListReconciliations pages through stored reports without their issue
+// lists.
+// GET /api/v1/admin/wallet/reconciliations?limit=&cursor=
+func ListReconciliations(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	page, err := pagination.Parse(r, 20, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	ctx := r.Context()
+	opts := reconcileSort.FindOptions(page.Limit).SetProjection(bson.M{"account_issues": 0, "txn_issues": 0})
+	cur, err := db.ReconciliationsCollection.Find(ctx, reconcileSort.Filter(bson.M{}, page.After), opts)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+	var reports []ReconcileReport
+	if err := cur.All(ctx, &reports); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read reports")
+		return
+	}
+	reports, next := pagination.Trim(reports, page.Limit, func(rep ReconcileReport) pagination.Cursor {
+		return pagination.Cursor{Key: rep.StartedAt, ID: rep.ID}
+	})
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(reports, next))
+}
+
+// GetReconciliation returns one report with its issues.
+// GET /api/v1/admin/wallet/reconciliations/:id
+func GetReconciliation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var report ReconcileReport
+	err := db.ReconciliationsCollection.FindOne(r.Context(), bson.M{"_id": ps.ByName("id")}).Decode(&report)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "report not found")
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read report")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// RunReconciliation reconciles the ledger now and returns the report.
+// POST /api/v1/admin/wallet/reconciliations
+func RunReconciliation(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	report, err := Reconcile(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "reconciliation failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "reconciliation failed")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, report)
+}
+
+// RepairBalances resets the cached balances of accounts flagged by a
+// report to their journal balance. Accounts limits the repair to some of
+// them; a reason is required for the audit trail.
+// POST /api/v1/admin/wallet/reconciliations/:id/repair
+func RepairBalances(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body struct {
+		Reason   string   `json:"reason"`
+		Accounts []string `json:"accounts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if strings.TrimSpace(body.Reason) == "" {
+		apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "reason", Message: "is required"}))
+		return
+	}
+
+	ctx := r.Context()
+	var report ReconcileReport
+	err := db.ReconciliationsCollection.FindOne(ctx, bson.M{"_id": ps.ByName("id")}).Decode(&report)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "report not found")
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read report")
+		return
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range body.Accounts {
+		wanted[id] = true
+	}
+	adminID, _ := ctx.Value(globals.UserIDKey).(string)
+	repairs := []*BalanceRepair{}
+	var failed []string
+	for _, issue := range report.AccountIssues {
+		if issue.Missing || (len(wanted) > 0 && !wanted[issue.AccountID]) {
+			continue
+		}
+		repair, err := repairBalance(ctx, issue.AccountID, report.ID, body.Reason, adminID)
+		if err != nil {
+			slog.ErrorContext(ctx, "balance repair failed", "account_id", issue.AccountID, "error", err)
+			failed = append(failed, issue.AccountID)
+			continue
+		}
+		if repair != nil {
+			slog.InfoContext(ctx, "balance repaired", "admin_id", adminID, "account_id", repair.AccountID,
+				"before", repair.Before, "after", repair.After, "currency", repair.Currency)
+			repairs = append(repairs, repair)
+		}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"repairs": repairs, "failed": failed})
+}
+
+// auditSort lists repairs newest first; _id breaks ties.
+var auditSort = pagination.Sort{Field: "at", IDField: "_id", Desc: true}
+
+// ListBalanceRepairs pages through the repair audit trail, optionally for
+// one account.
+// GET /api/v1/admin/wallet/repairs?account=&limit=&cursor=
+func ListBalanceRepairs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	page, err := pagination.Parse(r, 20, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	filter := bson.M{}
+	if acc := r.URL.Query().Get("account"); acc != "" {
+		filter["account_id"] = acc
+	}
+	ctx := r.Context()
+	cur, err := db.LedgerAuditCollection.Find(ctx, auditSort.Filter(filter, page.After), auditSort.FindOptions(page.Limit))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read repairs")
+		return
+	}
+	var repairs []BalanceRepair
+	if err := cur.All(ctx, &repairs); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read repairs")
+		return
+	}
+	repairs, next := pagination.Trim(repairs, page.Limit, func(b BalanceRepair) pagination.Cursor {
+		return pagination.Cursor{Key: b.At, ID: b.ID}
+	})
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(repairs, next))
+}
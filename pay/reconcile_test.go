@@ -0,0 +1,77 @@
+package pay
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"naevis/db"
+	"naevis/models"
+	"naevis/money"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReconcileAndRepair(t *testing.T) {
+	p := newTestService(t)
+	ctx := context.Background()
+	do(p.TopUp, "ann", `{"amount":50}`)
+	do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"wallet"}`)
+
+	report, err := Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Balanced || report.Accounts != 2 || report.Transactions != 2 {
+		t.Fatalf("clean ledger report = %+v", report)
+	}
+
+	// Drift a cached balance and journal money under no transaction.
+	db.AccountsCollection.UpdateOne(ctx, bson.M{"userid": "ann"}, bson.M{"$inc": bson.M{"cached_balance": 500}})
+	db.JournalCollection.InsertOne(ctx, models.JournalEntry{ID: "j-orphan", TxnID: "nope",
+		DebitAccount: "external:bank", CreditAccount: "external:card", Amount: money.Money{Minor: 100, Currency: "INR"}})
+
+	report, err = Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Balanced || len(report.AccountIssues) != 1 || len(report.TxnIssues) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := report.AccountIssues[0]; got.Cached != 2500 || got.Journaled != 2000 {
+		t.Errorf("account issue = %+v", got)
+	}
+	if got := report.TxnIssues[0]; got.TxnID != "nope" || got.Problem != ProblemOrphan {
+		t.Errorf("txn issue = %+v", got)
+	}
+
+	repair := func(body string) (int, map[string]any) {
+		return do(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			RepairBalances(w, r, httprouter.Params{{Key: "id", Value: report.ID}})
+		}, "admin-1", body)
+	}
+	if code, _ := repair(`{}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("repair without reason = %d, want 422", code)
+	}
+	code, out := repair(`{"reason":"drift found in nightly run"}`)
+	if repairs, _ := out["repairs"].([]any); code != http.StatusOK || len(repairs) != 1 {
+		t.Fatalf("repair = %d %v", code, out)
+	}
+	if got := balance(t, "ann"); got != 2000 {
+		t.Errorf("repaired balance = %v, want 2000", got)
+	}
+
+	var audit BalanceRepair
+	if err := db.LedgerAuditCollection.FindOne(ctx, bson.M{"report_id": report.ID}).Decode(&audit); err != nil {
+		t.Fatal(err)
+	}
+	if audit.Before != 2500 || audit.After != 2000 || audit.By != "admin-1" {
+		t.Errorf("audit = %+v", audit)
+	}
+
+	// Repairing again finds nothing left to change.
+	if _, out := repair(`{"reason":"again"}`); len(out["repairs"].([]any)) != 0 {
+		t.Errorf("second repair = %v", out)
+	}
+}
@@ -0,0 +1,433 @@
+package pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/middleware"
+	"naevis/models"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A payment can be refunded in parts that together never exceed it. The
+// original transaction keeps the running total in refunded and moves
+// from success to partially_refunded to reversed. Each refund claims its
+// share with an update conditional on the total it read, so refunds that
+// race cannot add up to more than was paid.
+//
+// Who may refund, until when, and what else changes when they do depend
+// on what was paid for, and are set per entity type by a RefundPolicy.
+// Admins may refund any payment at any time.
+
+// Payment states after a refund.
+const (
+	statePartiallyRefunded = "partially_refunded"
+	stateReversed          = "reversed"
+)
+
+// refundCutoff is how long before an event or booking starts its
+// payments stop being refundable.
+const refundCutoff = 24 * time.Hour
+
+// ErrRefundClosed is returned by a RefundPolicy's Check when the payment
+// may no longer be refunded.
+var ErrRefundClosed = errors.New("pay: refunds are closed")
+
+// RefundPolicy says how payments for one entity type are refunded. Any
+// of its funcs may be nil. Payments for entity types without a policy
+// can only be refunded by admins.
+type RefundPolicy struct {
+	// Merchant returns the user who sold the entity, who may refund its
+	// payments. "" means only admins may.
+	Merchant func(ctx context.Context, entityID string) (string, error)
+	// Check returns an error wrapping ErrRefundClosed if txn may not be
+	// refunded at now. Admins are not held to it.
+	Check func(ctx context.Context, txn *models.Transaction, now time.Time) error
+	// Apply updates what was paid for after a refund of txn; full says
+	// the payment is now refunded in full. It runs in the refund's
+	// database transaction, so an error undoes the refund.
+	Apply func(ctx context.Context, txn *models.Transaction, full bool) error
+}
+
+// RegisterRefundPolicy sets the refund policy for an entity type
+// (thread-safe)
+func (p *PaymentService) RegisterRefundPolicy(entityType string, policy RefundPolicy) {
+	p.rLock.Lock()
+	defer p.rLock.Unlock()
+	p.policies[entityType] = policy
+}
+
+// refundPolicy returns the policy for an entity type, or the empty one.
+func (p *PaymentService) refundPolicy(entityType string) RefundPolicy {
+	p.rLock.RLock()
+	defer p.rLock.RUnlock()
+	return p.policies[entityType]
+}
+
+// RegisterDefaultRefundPolicies adds the built-in refund policies. Ticket
+// and booking payments close for refunds refundCutoff before the start.
+func (p *PaymentService) RegisterDefaultRefundPolicies() {
+	p.RegisterRefundPolicy("ticket", RefundPolicy{
+		Merchant: func(ctx context.Context, ticketID string) (string, error) {
+			hostType, hostID, err := ticketHost(ctx, ticketID)
+			if err != nil {
+				return "", err
+			}
+			return ownerOf(ctx, hostType, hostID)
+		},
+		Check: func(ctx context.Context, txn *models.Transaction, now time.Time) error {
+			hostType, hostID, err := ticketHost(ctx, txn.EntityID)
+			if err != nil || hostType != "event" {
+				return err
+			}
+			var event struct {
+				Start time.Time `bson:"start_date_time"`
+			}
+			if err := db.EventsCollection.FindOne(ctx, bson.M{"eventid": hostID}).Decode(&event); err != nil {
+				return err
+			}
+			return beforeCutoff(event.Start, now)
+		},
+		Apply: refundTicket,
+	})
+
+	p.RegisterRefundPolicy("booking", RefundPolicy{
+		Merchant: func(ctx context.Context, bookingID string) (string, error) {
+			b, err := findBooking(ctx, bookingID)
+			if err != nil {
+				return "", err
+			}
+			return ownerOf(ctx, b.EntityType, b.EntityID)
+		},
+		Check: func(ctx context.Context, txn *models.Transaction, now time.Time) error {
+			b, err := findBooking(ctx, txn.EntityID)
+			if err != nil {
+				return err
+			}
+			start, err := time.ParseInLocation("2006-01-02 15:04", b.Date+" "+b.Start, time.Local)
+			if err != nil {
+				return nil // no usable start time to close refunds at
+			}
+			return beforeCutoff(start, now)
+		},
+		// A booking refunded in full is cancelled, which frees its place.
+		Apply: func(ctx context.Context, txn *models.Transaction, full bool) error {
+			if !full {
+				return nil
+			}
+			_, err := db.BookingsCollection.UpdateOne(ctx, bson.M{"id": txn.EntityID},
+				bson.M{"$set": bson.M{"status": "cancelled"}})
+			return err
+		},
+	})
+
+	// Orders have no single seller, so only admins refund them.
+	p.RegisterRefundPolicy("order", RefundPolicy{
+		Apply: func(ctx context.Context, txn *models.Transaction, full bool) error {
+			status := statePartiallyRefunded
+			if full {
+				status = "refunded"
+			}
+			_, err := db.OrderCollection.UpdateOne(ctx, bson.M{"orderId": txn.EntityID},
+				bson.M{"$set": bson.M{"status": status}})
+			return err
+		},
+	})
+
+	p.RegisterRefundPolicy("restaurant", RefundPolicy{
+		Merchant: func(ctx context.Context, menuID string) (string, error) {
+			var menu struct {
+				PlaceID string `bson:"placeid"`
+			}
+			if err := db.MenuCollection.FindOne(ctx, bson.M{"menuid": menuID}).Decode(&menu); err != nil {
+				return "", err
+			}
+			return ownerOf(ctx, "place", menu.PlaceID)
+		},
+	})
+}
+
+// beforeCutoff allows refunds until refundCutoff before start.
+func beforeCutoff(start, now time.Time) error {
+	if start.IsZero() || now.Before(start.Add(-refundCutoff)) {
+		return nil
+	}
+	return ErrRefundClosed
+}
+
+// ticketHost returns the event or place a ticket type is sold for.
+func ticketHost(ctx context.Context, ticketID string) (string, string, error) {
+	var ticket struct {
+		EventID    string `bson:"eventid"`
+		EntityType string `bson:"entity_type"`
+		EntityID   string `bson:"entity_id"`
+	}
+	if err := db.TicketsCollection.FindOne(ctx, bson.M{"ticketid": ticketID}).Decode(&ticket); err != nil {
+		return "", "", err
+	}
+	if ticket.EntityType == "" || ticket.EntityID == "" {
+		return "event", ticket.EventID, nil
+	}
+	return ticket.EntityType, ticket.EntityID, nil
+}
+
+type bookingRef struct {
+	EntityType string `bson:"entityType"`
+	EntityID   string `bson:"entityId"`
+	Date       string `bson:"date"`
+	Start      string `bson:"start"`
+}
+
+func findBooking(ctx context.Context, bookingID string) (bookingRef, error) {
+	var b bookingRef
+	err := db.BookingsCollection.FindOne(ctx, bson.M{"id": bookingID}).Decode(&b)
+	return b, err
+}
+
+// ownerOf returns the user who created an event or place, or "" for
+// other entities.
+func ownerOf(ctx context.Context, entityType, entityID string) (string, error) {
+	switch entityType {
+	case "event":
+		var event struct {
+			CreatorID string `bson:"creatorid"`
+		}
+		err := db.EventsCollection.FindOne(ctx, bson.M{"eventid": entityID}).Decode(&event)
+		return event.CreatorID, err
+	case "place":
+		var place struct {
+			CreatedBy string `bson:"createdBy"`
+		}
+		err := db.PlacesCollection.FindOne(ctx, bson.M{"placeid": entityID}).Decode(&place)
+		return place.CreatedBy, err
+	}
+	return "", nil
+}
+
+// refundTicket marks one of the payer's tickets of the paid type
+// refunded, oldest first, once the payment is refunded in full, and puts
+// it back on sale.
+func refundTicket(ctx context.Context, txn *models.Transaction, full bool) error {
+	if !full {
+		return nil
+	}
+	var held models.PurchasedTicket
+	err := db.PurchasedTicketsCollection.FindOneAndUpdate(ctx,
+		bson.M{"ticketid": txn.EntityID, "userid": txn.UserID, "status": bson.M{"$ne": "refunded"}},
+		bson.M{"$set": bson.M{"status": "refunded"}},
+		options.FindOneAndUpdate().SetSort(bson.M{"purchasedate": 1}),
+	).Decode(&held)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil // paid for, but no ticket was issued
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.TicketsCollection.UpdateOne(ctx, bson.M{"ticketid": txn.EntityID},
+		bson.M{"$inc": bson.M{"quantity": 1, "sold": -1}})
+	return err
+}
+
+// --- Refund ---
+
+// Refund sends all or part of a payment back to the payer. The merchant
+// of what was paid for and admins may refund; amount defaults to all
+// that has not been refunded yet.
+// POST /api/v1/wallet/refund {"transaction_id":"...","amount":"10.00","reason":"..."}
+func (p *PaymentService) Refund(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	requester := utils.GetUserIDFromRequest(r)
+
+	var body struct {
+		TransactionID string      `json:"transaction_id"`
+		Amount        json.Number `json:"amount"`
+		Reason        string      `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TransactionID == "" {
+		apierr.Respond(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		var existing models.Transaction
+		if err := db.TransactionCollection.FindOne(ctx, bson.M{"external_ref": idempotencyKey, "type": "refund"}).Decode(&existing); err == nil {
+			utils.RespondWithJSON(w, http.StatusOK, existing)
+			return
+		}
+	}
+
+	var origTxn models.Transaction
+	if err := db.TransactionCollection.FindOne(ctx, bson.M{"_id": body.TransactionID}).Decode(&origTxn); err != nil {
+		apierr.Respond(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	if origTxn.Type != "payment" {
+		apierr.Respond(w, http.StatusBadRequest, "only payments can be refunded")
+		return
+	}
+	if origTxn.Status != "success" && origTxn.Status != statePartiallyRefunded {
+		respondWalletError(w, r, "Refund", errNotRefundable)
+		return
+	}
+
+	// money flows back from origTxn.ToAccount to origTxn.FromAccount
+	fromAcc := origTxn.ToAccount
+	toAcc := origTxn.FromAccount
+	if fromAcc == "" || toAcc == "" {
+		apierr.Respond(w, http.StatusBadRequest, "invalid original transaction accounts")
+		return
+	}
+
+	policy := p.refundPolicy(origTxn.EntityType)
+	if !middleware.HasRole(r, "admin") {
+		merchant := ""
+		if policy.Merchant != nil {
+			var err error
+			merchant, err = policy.Merchant(ctx, origTxn.EntityID)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				slog.ErrorContext(ctx, "refund merchant lookup failed",
+					"entity_type", origTxn.EntityType, "entity_id", origTxn.EntityID, "error", err)
+				apierr.Respond(w, http.StatusInternalServerError, "refund failed")
+				return
+			}
+		}
+		if merchant == "" || merchant != requester {
+			apierr.Respond(w, http.StatusForbidden, "only the merchant or an admin can refund this payment")
+			return
+		}
+		if policy.Check != nil {
+			err := policy.Check(ctx, &origTxn, time.Now())
+			if errors.Is(err, ErrRefundClosed) {
+				apierr.Respond(w, http.StatusUnprocessableEntity, "refunds for this payment are closed")
+				return
+			}
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				slog.ErrorContext(ctx, "refund policy check failed",
+					"entity_type", origTxn.EntityType, "entity_id", origTxn.EntityID, "error", err)
+				apierr.Respond(w, http.StatusInternalServerError, "refund failed")
+				return
+			}
+		}
+	}
+
+	remaining, err := origTxn.Amount.Sub(origTxn.RefundedAmount())
+	if err != nil || !remaining.IsPositive() {
+		respondWalletError(w, r, "Refund", errNotRefundable)
+		return
+	}
+	amount := remaining
+	if body.Amount != "" {
+		if amount, err = parseAmount(body.Amount, origTxn.Amount.Currency); err != nil {
+			respondAmountError(w, err)
+			return
+		}
+		if c, err := amount.Cmp(remaining); err != nil || c > 0 {
+			apierr.Write(w, apierr.Validation(apierr.FieldError{Field: "amount", Message: "is more than the " + remaining.String() + " left to refund"}))
+			return
+		}
+	}
+	left, _ := remaining.Sub(amount)
+
+	// Acquire locks in deterministic order
+	lockA := "wallet_lock:" + fromAcc
+	lockB := "wallet_lock:" + toAcc
+	if lockB < lockA {
+		lockA, lockB = lockB, lockA
+	}
+	ok, err := rdx.RdxSetNX(lockA, "1", lockTTL)
+	if err != nil || !ok {
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
+		return
+	}
+	defer rdx.RdxDel(lockA)
+
+	ok2, err := rdx.RdxSetNX(lockB, "1", lockTTL)
+	if err != nil || !ok2 {
+		apierr.Respond(w, http.StatusTooManyRequests, "please retry")
+		return
+	}
+	defer rdx.RdxDel(lockB)
+
+	now := time.Now()
+	state := statePartiallyRefunded
+	if left.IsZero() {
+		state = stateReversed
+	}
+	meta := models.Meta{"original_txn": origTxn.ID, "refunded_by": requester}
+	if body.Reason != "" {
+		meta["reason"] = body.Reason
+	}
+	refundTxn := models.Transaction{
+		ID:             utils.GetUUID(),
+		UserID:         origTxn.UserID,
+		Type:           "refund",
+		Method:         "refund",
+		EntityID:       origTxn.EntityID,
+		EntityType:     origTxn.EntityType,
+		FromAccount:    fromAcc,
+		ToAccount:      toAcc,
+		Amount:         amount,
+		Status:         "success",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		IdempotencyKey: idempotencyKey,
+		Meta:           meta,
+	}
+
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		// Claim this share against the refunded total read above. A refund
+		// that got in first changed it, and this one then matches nothing.
+		claim := bson.M{"_id": origTxn.ID, "state": origTxn.Status, "refunded": origTxn.Refunded}
+		if origTxn.Refunded == 0 {
+			claim["refunded"] = bson.M{"$in": bson.A{nil, int64(0)}}
+		}
+		res, err := db.TransactionCollection.UpdateOne(ctx, claim, bson.M{"$set": bson.M{
+			"state":      state,
+			"refunded":   origTxn.Refunded + amount.Minor,
+			"updated_at": now,
+		}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errNotRefundable
+		}
+		if err := transfer(ctx, refundTxn.ID, fromAcc, toAcc, amount, models.Meta{"note": "refund", "original_txn": origTxn.ID}); err != nil {
+			return err
+		}
+		if _, err := db.TransactionCollection.InsertOne(ctx, refundTxn); err != nil {
+			return err
+		}
+		if policy.Apply == nil {
+			return nil
+		}
+		origTxn.Status = state
+		origTxn.Refunded += amount.Minor
+		return policy.Apply(ctx, &origTxn, left.IsZero())
+	})
+	if err != nil {
+		respondWalletError(w, r, "Refund", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"transaction_id": refundTxn.ID,
+		"refunded":       amount,
+		"remaining":      left,
+		"state":          state,
+	})
+}
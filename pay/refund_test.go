@@ -0,0 +1,105 @@
+package pay
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"naevis/db"
+	"naevis/models"
+	"naevis/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPartialRefunds(t *testing.T) {
+	p := newTestService(t)
+	var applied []bool
+	p.RegisterRefundPolicy("thing", RefundPolicy{
+		Merchant: func(context.Context, string) (string, error) { return "mo", nil },
+		Apply: func(_ context.Context, _ *models.Transaction, full bool) error {
+			applied = append(applied, full)
+			return nil
+		},
+	})
+	do(p.TopUp, "ann", `{"amount":50}`)
+	_, paid := do(p.Pay, "ann", `{"entityType":"thing","entityId":"t1","method":"wallet"}`)
+	txnID := paid["transaction_id"].(string)
+	refund := func(userID, amount string) (int, map[string]any) {
+		return do(p.Refund, userID, `{"transaction_id":"`+txnID+`","amount":"`+amount+`"}`)
+	}
+
+	// Neither the payer nor a stranger may refund.
+	for _, user := range []string{"ann", "bob"} {
+		if code, _ := refund(user, "10"); code != http.StatusForbidden {
+			t.Errorf("refund by %s = %d, want 403", user, code)
+		}
+	}
+
+	code, out := refund("mo", "10")
+	if code != http.StatusOK || out["state"] != statePartiallyRefunded {
+		t.Fatalf("first part = %d %v", code, out)
+	}
+	if left := out["remaining"].(map[string]any); left["amount"] != "20.00" {
+		t.Errorf("remaining = %v, want 20.00", left)
+	}
+	if code, _ := refund("mo", "25"); code != http.StatusUnprocessableEntity {
+		t.Errorf("refunding more than is left = %d, want 422", code)
+	}
+	if code, out := refund("mo", "20.00"); code != http.StatusOK || out["state"] != stateReversed {
+		t.Fatalf("second part = %d %v", code, out)
+	}
+	if code, _ := refund("mo", "0.01"); code != http.StatusConflict {
+		t.Errorf("refund after a full refund = %d, want 409", code)
+	}
+
+	if a, m := balance(t, "ann"), balance(t, "merchant:default"); a != 5000 || m != 0 {
+		t.Errorf("balances = %v, %v, want 5000, 0", a, m)
+	}
+	if len(applied) != 2 || applied[0] || !applied[1] {
+		t.Errorf("policy applied with full = %v, want [false true]", applied)
+	}
+	report, err := Reconcile(context.Background())
+	if err != nil || !report.Balanced || report.Transactions != 4 {
+		t.Errorf("reconcile after refunds = %+v, %v", report, err)
+	}
+}
+
+func TestTicketRefundPolicy(t *testing.T) {
+	p := newTestService(t)
+	p.RegisterDefaultResolvers()
+	p.RegisterDefaultRefundPolicies()
+	ctx := context.Background()
+	db.EventsCollection.InsertOne(ctx, bson.M{"eventid": "ev1", "creatorid": "org", "start_date_time": time.Now().Add(12 * time.Hour)})
+	db.TicketsCollection.InsertOne(ctx, bson.M{"ticketid": "tk1", "eventid": "ev1",
+		"price": money.Money{Minor: 3000, Currency: "INR"}, "quantity": 4, "sold": 1})
+	db.PurchasedTicketsCollection.InsertOne(ctx, models.PurchasedTicket{EventID: "ev1", TicketID: "tk1",
+		UserID: "ann", UniqueCode: "c1", PurchaseDate: time.Now()})
+
+	do(p.TopUp, "ann", `{"amount":50}`)
+	_, paid := do(p.Pay, "ann", `{"entityType":"ticket","entityId":"tk1","method":"wallet"}`)
+	body := `{"transaction_id":"` + paid["transaction_id"].(string) + `"}`
+
+	// The event starts within a day, so its organiser can no longer refund.
+	if code, _ := do(p.Refund, "org", body); code != http.StatusUnprocessableEntity {
+		t.Errorf("refund by organiser = %d, want 422", code)
+	}
+	if code, out := do(asAdmin(p.Refund), "admin-1", body); code != http.StatusOK {
+		t.Fatalf("refund by admin = %d %v", code, out)
+	}
+
+	var held models.PurchasedTicket
+	db.PurchasedTicketsCollection.FindOne(ctx, bson.M{"uniquecode": "c1"}).Decode(&held)
+	if held.Status != "refunded" {
+		t.Errorf("purchased ticket status = %q, want refunded", held.Status)
+	}
+	var ticket struct {
+		Quantity int `bson:"quantity"`
+		Sold     int `bson:"sold"`
+	}
+	db.TicketsCollection.FindOne(ctx, bson.M{"ticketid": "tk1"}).Decode(&ticket)
+	if ticket.Quantity != 5 || ticket.Sold != 0 {
+		t.Errorf("ticket stock = %+v, want 5 left and 0 sold", ticket)
+	}
+}
@@ -3,6 +3,7 @@ package places
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -20,7 +21,7 @@ func GetPlaces(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	places, err := utils.FindAndDecode[models.Place](ctx, db.PlacesCollection, bson.M{})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch places")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch places")
 		return
 	}
 
@@ -51,7 +52,7 @@ func GetPlaces(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	data, err := json.Marshal(result)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to encode places")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode places")
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -20,10 +21,15 @@ import (
 )
 
 // Inserts or updates a place in the database
-func updatePlaceBannerInDB(w http.ResponseWriter, placeID string, updateFields bson.M) error {
-	_, err := db.PlacesCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeID}, bson.M{"$set": updateFields})
+func updatePlaceBannerInDB(ctx context.Context, w http.ResponseWriter, placeID string, updateFields bson.M) error {
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PlacesCollection.UpdateOne(ctx, bson.M{"placeid": placeID}, bson.M{"$set": updateFields}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "place-edited", models.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
+	})
 	if err != nil {
-		http.Error(w, "Error updating place", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error updating place")
 		return err
 	}
 
@@ -43,7 +49,7 @@ func EditPlaceBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	// Validate user
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -52,33 +58,33 @@ func EditPlaceBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&place)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Place not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Place not found")
 		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		}
 		return
 	}
 
 	// Authorization
 	if place.CreatedBy != requestingUserID {
-		http.Error(w, "You are not authorized to edit this place", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "You are not authorized to edit this place")
 		return
 	}
 
 	// Parse multipart form for banner file
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
 	// Save banner file from form
 	banner, err := filemgr.SaveFormFile(r.MultipartForm, "banner", filemgr.EntityPlace, filemgr.PicBanner, false)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Banner upload failed: %v", err), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, fmt.Sprintf("Banner upload failed: %v", err))
 		return
 	}
 	if banner == "" {
-		http.Error(w, "No banner file uploaded", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "No banner file uploaded")
 		return
 	}
 
@@ -87,11 +93,9 @@ func EditPlaceBanner(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		"updated_at": time.Now(),
 	}
 
-	if err := updatePlaceBannerInDB(w, placeID, updateFields); err != nil {
+	if err := updatePlaceBannerInDB(r.Context(), w, placeID, updateFields); err != nil {
 		return
 	}
 
-	go mq.Emit(r.Context(), "place-edited", models.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
-
 	utils.RespondWithJSON(w, http.StatusOK, updateFields)
 }
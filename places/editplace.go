@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -19,10 +20,15 @@ import (
 )
 
 // Inserts or updates a place in the database
-func updatePlaceInDB(w http.ResponseWriter, placeID string, updateFields bson.M) error {
-	_, err := db.PlacesCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeID}, bson.M{"$set": updateFields})
+func updatePlaceInDB(ctx context.Context, w http.ResponseWriter, placeID string, updateFields bson.M) error {
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PlacesCollection.UpdateOne(ctx, bson.M{"placeid": placeID}, bson.M{"$set": updateFields}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "place-edited", models.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
+	})
 	if err != nil {
-		http.Error(w, "Error updating place", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error updating place")
 		return err
 	}
 
@@ -43,7 +49,7 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -52,34 +58,32 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&existing)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Place not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Place not found")
 		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		}
 		return
 	}
 	if existing.CreatedBy != requestingUserID {
-		http.Error(w, "You are not authorized to edit this place", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "You are not authorized to edit this place")
 		return
 	}
 
 	_, updateFields, err := parseAndBuildPlace(r, "update")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "No fields to update")
 		return
 	}
 
-	if err := updatePlaceInDB(w, placeID, updateFields); err != nil {
+	if err := updatePlaceInDB(ctx, w, placeID, updateFields); err != nil {
 		return
 	}
 
-	go mq.Emit(ctx, "place-edited", models.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
-
 	utils.RespondWithJSON(w, http.StatusOK, updateFields)
 }
 
@@ -95,7 +99,7 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Get the ID of the requesting user from the context
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 	// log.Println("Requesting User ID:", requestingUserID)
@@ -104,32 +108,36 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&place)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Place not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Place not found")
 		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
 
 	// Check if the place was created by the requesting user
 	if place.CreatedBy != requestingUserID {
-		http.Error(w, "You are not authorized to delete this place", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "You are not authorized to delete this place")
 		return
 	}
 
-	// Delete the place from MongoDB
-	_, err = db.PlacesCollection.DeleteOne(context.TODO(), bson.M{"placeid": placeID})
+	// Delete the place, its user data and the index event together
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PlacesCollection.DeleteOne(ctx, bson.M{"placeid": placeID}); err != nil {
+			return err
+		}
+		if err := userdata.DelUserDataTx(ctx, "place", placeID, requestingUserID); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "place", EntityId: placeID, Method: "DELETE"}
+		return mq.Emit(ctx, "place-deleted", m)
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	rdx.RdxDel("place:" + placeID) // Invalidate the cache for the deleted place
 
-	userdata.DelUserData("place", placeID, requestingUserID)
-
-	m := models.Index{EntityType: "place", EntityId: placeID, Method: "DELETE"}
-	go mq.Emit(ctx, "place-deleted", m)
-
 	// Respond with success
 	w.WriteHeader(http.StatusOK)
 	response := map[string]any{
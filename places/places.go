@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"naevis/apierr"
 	"naevis/autocom"
 	"naevis/db"
 	"naevis/filemgr"
@@ -37,7 +38,7 @@ func GetPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Execute the aggregation query
 	cursor, err := db.PlacesCollection.Aggregate(context.TODO(), pipeline)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(context.TODO())
@@ -45,25 +46,18 @@ func GetPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var place models.Place
 	if cursor.Next(context.TODO()) {
 		if err := cursor.Decode(&place); err != nil {
-			http.Error(w, "Failed to decode place data", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to decode place data")
 			return
 		}
 	} else {
-		// http.Error(w, "Place not found", http.StatusNotFound)
-		// Respond with success
-		w.WriteHeader(http.StatusNotFound)
-		response := map[string]any{
-			"status":  http.StatusNoContent,
-			"message": "Place not found",
-		}
-		json.NewEncoder(w).Encode(response)
+		apierr.Respond(w, http.StatusNotFound, "Place not found")
 		return
 	}
 
 	// Encode the place as JSON and write to response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(place); err != nil {
-		http.Error(w, "Failed to encode place data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode place data")
 	}
 }
 
@@ -78,7 +72,7 @@ func GetPlaceQ(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// Execute the aggregation query
 	cursor, err := db.PlacesCollection.Aggregate(context.TODO(), pipeline)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(context.TODO())
@@ -86,25 +80,18 @@ func GetPlaceQ(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var place models.Place
 	if cursor.Next(context.TODO()) {
 		if err := cursor.Decode(&place); err != nil {
-			http.Error(w, "Failed to decode place data", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to decode place data")
 			return
 		}
 	} else {
-		// http.Error(w, "Place not found", http.StatusNotFound)
-		// Respond with success
-		w.WriteHeader(http.StatusNotFound)
-		response := map[string]any{
-			"status":  http.StatusNoContent,
-			"message": "Place not found",
-		}
-		json.NewEncoder(w).Encode(response)
+		apierr.Respond(w, http.StatusNotFound, "Place not found")
 		return
 	}
 
 	// Encode the place as JSON and write to response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(place); err != nil {
-		http.Error(w, "Failed to encode place data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode place data")
 	}
 }
 
@@ -212,26 +199,32 @@ func CreatePlace(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	place, _, err := parseAndBuildPlace(r, "create")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid user")
 		return
 	}
 	place.CreatedBy = requestingUserID
 
-	_, err = db.PlacesCollection.InsertOne(context.TODO(), place)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.PlacesCollection.InsertOne(ctx, place); err != nil {
+			return err
+		}
+		if err := userdata.SetUserDataTx(ctx, "place", place.PlaceID, requestingUserID, "", ""); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "place-created", models.Index{EntityType: "place", EntityId: place.PlaceID, Method: "POST"})
+	})
 	if err != nil {
-		http.Error(w, "Error creating place", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error creating place")
 		return
 	}
 
 	autocom.AddPlaceToAutocorrect(rdx.Conn, place.PlaceID, place.Name)
-	userdata.SetUserData("place", place.PlaceID, requestingUserID, "", "")
-	go mq.Emit(ctx, "place-created", models.Index{EntityType: "place", EntityId: place.PlaceID, Method: "POST"})
 
 	utils.RespondWithJSON(w, http.StatusCreated, place)
 }
@@ -3,6 +3,7 @@ package places
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"net/http"
@@ -16,28 +17,23 @@ import (
 
 // 🏟️ Events
 func GetEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetEvent not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetEvent not implemented yet")
 }
 
 func PostEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostEvent not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostEvent not implemented yet")
 }
 
 func PutEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PutEvent not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PutEvent not implemented yet")
 }
 
 func DeleteEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("DeleteEvent not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "DeleteEvent not implemented yet")
 }
 
 func PostViewEventDetails(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostViewEventDetails not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostViewEventDetails not implemented yet")
 }
 
 func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -49,7 +45,7 @@ func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	placeID := ps.ByName("placeid")
 
 	if placeID == "" {
-		http.Error(w, "missing required path parameter: placeid", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "missing required path parameter: placeid")
 		return
 	}
 
@@ -96,14 +92,14 @@ func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Count total events for pagination
 	totalCount, err := db.EventsCollection.CountDocuments(context.TODO(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Fetch paginated events
 	cursor, err := db.EventsCollection.Find(context.TODO(), filter, findOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(context.TODO())
@@ -111,7 +107,7 @@ func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// var events []bson.M
 	var events []models.Event
 	if err := cursor.All(context.TODO(), &events); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -125,7 +121,7 @@ func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Send response
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
@@ -3,21 +3,20 @@ package places
 import (
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 func notImplemented(w http.ResponseWriter, methodName string) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte(methodName + " not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, methodName+" not implemented yet")
 }
 
 // ❓ Fallback
 func GetPlaceDetailsFallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetPlaceDetailsFallback not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetPlaceDetailsFallback not implemented yet")
 }
 
 func GetDetailsFallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetDetailsFallback not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetDetailsFallback not implemented yet")
 }
@@ -3,6 +3,8 @@ package places
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
+	"naevis/db"
 	"net/http"
 	"time"
 
@@ -21,13 +23,13 @@ type Membership struct {
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 }
 
-var membershipColl *mongo.Collection // set this from your DB init
+var membershipColl db.Collection // set this from your DB init
 
 // GET /place/:placeId/membership/:id
 func GetMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
 	if err != nil {
-		http.Error(w, "Invalid membership ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid membership ID")
 		return
 	}
 
@@ -35,10 +37,10 @@ func GetMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	err = membershipColl.FindOne(r.Context(), bson.M{"_id": id}).Decode(&membership)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Membership not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Membership not found")
 			return
 		}
-		http.Error(w, "Failed to fetch membership", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch membership")
 		return
 	}
 
@@ -49,13 +51,13 @@ func GetMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func PostMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	placeID, err := primitive.ObjectIDFromHex(ps.ByName("placeId"))
 	if err != nil {
-		http.Error(w, "Invalid place ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid place ID")
 		return
 	}
 
 	var membership Membership
 	if err := json.NewDecoder(r.Body).Decode(&membership); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 	membership.PlaceID = placeID
@@ -63,7 +65,7 @@ func PostMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	res, err := membershipColl.InsertOne(r.Context(), membership)
 	if err != nil {
-		http.Error(w, "Failed to create membership", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create membership")
 		return
 	}
 
@@ -75,13 +77,13 @@ func PostMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 func PutMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
 	if err != nil {
-		http.Error(w, "Invalid membership ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid membership ID")
 		return
 	}
 
 	var update Membership
 	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
@@ -95,7 +97,7 @@ func PutMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		}},
 	)
 	if err != nil {
-		http.Error(w, "Failed to update membership", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update membership")
 		return
 	}
 
@@ -106,13 +108,13 @@ func PutMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func DeleteMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
 	if err != nil {
-		http.Error(w, "Invalid membership ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid membership ID")
 		return
 	}
 
 	_, err = membershipColl.DeleteOne(r.Context(), bson.M{"_id": id})
 	if err != nil {
-		http.Error(w, "Failed to delete membership", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete membership")
 		return
 	}
 
@@ -122,27 +124,27 @@ func DeleteMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 // POST /place/:placeId/membership/:id/join
 func PostJoinMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// This could insert into a `membership_users` collection
-	http.Error(w, "Join membership not implemented", http.StatusNotImplemented)
+	apierr.Respond(w, http.StatusNotImplemented, "Join membership not implemented")
 }
 
 // GET /place/:placeId/memberships
 func GetMemberships(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	placeID, err := primitive.ObjectIDFromHex(ps.ByName("placeId"))
 	if err != nil {
-		http.Error(w, "Invalid place ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid place ID")
 		return
 	}
 
 	cur, err := membershipColl.Find(r.Context(), bson.M{"placeId": placeID})
 	if err != nil {
-		http.Error(w, "Failed to fetch memberships", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch memberships")
 		return
 	}
 	defer cur.Close(context.Background())
 
 	var memberships []Membership
 	if err := cur.All(r.Context(), &memberships); err != nil {
-		http.Error(w, "Failed to parse memberships", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to parse memberships")
 		return
 	}
 
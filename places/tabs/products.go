@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"mime"
+	"naevis/apierr"
 	"naevis/db"
 	"net/http"
 	"time"
@@ -71,19 +72,19 @@ func validateProduct(p Product) error {
 func parseJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if ct != "application/json" {
-		http.Error(w, "Expected application/json", http.StatusUnsupportedMediaType)
+		apierr.Respond(w, http.StatusUnsupportedMediaType, "Expected application/json")
 		return errors.New("unsupported content type")
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to read body")
 		return err
 	}
 	defer r.Body.Close()
 
 	if err := json.Unmarshal(body, dst); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
 		return err
 	}
 	return nil
@@ -97,14 +98,14 @@ func GetProducts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	cursor, err := db.ProductCollection.Find(ctx, bson.M{"placeid": placeIDStr})
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var products []Product
 	if err := cursor.All(ctx, &products); err != nil {
-		http.Error(w, "Failed to decode", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode")
 		return
 	}
 
@@ -128,7 +129,7 @@ func PostProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	product.ID = primitive.NewObjectID()
 
 	if err := validateProduct(product); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -137,7 +138,7 @@ func PostProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	_, err := db.ProductCollection.InsertOne(ctx, product)
 	if err != nil {
-		http.Error(w, "Insert failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Insert failed")
 		return
 	}
 
@@ -149,7 +150,7 @@ func PostProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func PutProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := primitive.ObjectIDFromHex(ps.ByName("productId"))
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
@@ -159,7 +160,7 @@ func PutProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err := validateProduct(updateData); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -175,7 +176,7 @@ func PutProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	_, err = db.ProductCollection.UpdateByID(ctx, id, update)
 	if err != nil {
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Update failed")
 		return
 	}
 
@@ -185,7 +186,7 @@ func PutProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func DeleteProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := primitive.ObjectIDFromHex(ps.ByName("productId"))
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
@@ -194,7 +195,7 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	_, err = db.ProductCollection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Delete failed")
 		return
 	}
 
@@ -204,7 +205,7 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func PostPlaceProductPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	productId, err := primitive.ObjectIDFromHex(ps.ByName("productId"))
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
@@ -217,9 +218,9 @@ func PostPlaceProductPurchase(w http.ResponseWriter, r *http.Request, ps httprou
 
 // Optional: fallback
 func GetProduct(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
+	apierr.Respond(w, http.StatusNotImplemented, "Not implemented")
 }
 
 func PostProductPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
+	apierr.Respond(w, http.StatusNotImplemented, "Not implemented")
 }
@@ -3,30 +3,27 @@ package places
 import (
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 func GetSaloonSlots(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetSaloonSlots not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetSaloonSlots not implemented yet")
 }
 
 func PostSaloonSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostSaloonSlot not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostSaloonSlot not implemented yet")
 }
 
 func PutSaloonSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PutSaloonSlot not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PutSaloonSlot not implemented yet")
 }
 
 func DeleteSaloonSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("DeleteSaloonSlot not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "DeleteSaloonSlot not implemented yet")
 }
 
 func BookSaloonSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("BookSaloonSlot not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "BookSaloonSlot not implemented yet")
 }
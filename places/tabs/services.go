@@ -3,31 +3,28 @@ package places
 import (
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 // 🏢 Services
 func GetService(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetService not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetService not implemented yet")
 }
 
 func PostService(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostService not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostService not implemented yet")
 }
 
 func PutService(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PutService not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PutService not implemented yet")
 }
 
 func DeleteService(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("DeleteService not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "DeleteService not implemented yet")
 }
 
 func GetServices(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetServices not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetServices not implemented yet")
 }
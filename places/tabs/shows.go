@@ -3,36 +3,32 @@ package places
 import (
 	"net/http"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 // 🎭 Shows
 func GetShow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetShow not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetShow not implemented yet")
 }
 
 func PostShow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostShow not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostShow not implemented yet")
 }
 
 func PutShow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PutShow not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PutShow not implemented yet")
 }
 
 func DeleteShow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("DeleteShow not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "DeleteShow not implemented yet")
 }
 
 func PostBookShow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("PostBookShow not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "PostBookShow not implemented yet")
 }
 
 func GetShows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("GetShows not implemented yet"))
+	apierr.Respond(w, http.StatusNotImplemented, "GetShows not implemented yet")
 }
@@ -1,9 +1,12 @@
 package posts
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/globals"
@@ -17,6 +20,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -32,24 +36,24 @@ func pickThumb(blocks []models.Block) string {
 // image upload endpoint
 func UploadImage(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	if err := r.ParseMultipartForm(20 << 20); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 	fileHeader := r.MultipartForm.File["image"]
 	if len(fileHeader) == 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "No image uploaded")
+		apierr.Respond(w, http.StatusBadRequest, "No image uploaded")
 		return
 	}
 	file, err := fileHeader[0].Open()
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to open image")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to open image")
 		return
 	}
 	defer file.Close()
 
 	path, ext, err := filemgr.SaveFileForEntity(file, fileHeader[0], filemgr.EntityPost, filemgr.PicPhoto)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Image save failed")
+		apierr.Respond(w, http.StatusInternalServerError, "Image save failed")
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"url": path, "ext": ext})
@@ -59,7 +63,7 @@ func CreateOrUpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	ctx := r.Context()
 	userID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid user")
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 
@@ -67,13 +71,13 @@ func CreateOrUpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	if isEdit {
 		postid = ps.ByName("id")
 		if postid == "" {
-			utils.RespondWithError(w, http.StatusBadRequest, "Post ID required for update")
+			apierr.Respond(w, http.StatusBadRequest, "Post ID required for update")
 			return
 		}
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid form data")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -84,20 +88,20 @@ func CreateOrUpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	blocksRaw := r.FormValue("blocks")
 
 	if title == "" || category == "" || subcategory == "" || blocksRaw == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Missing required fields")
+		apierr.Respond(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
 	var blocks []models.Block
 	if err := json.Unmarshal([]byte(blocksRaw), &blocks); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid blocks JSON")
+		apierr.Respond(w, http.StatusBadRequest, "Invalid blocks JSON")
 		return
 	}
 
 	var refPtr *string
 	if category == "Review" && (subcategory == "Product" || subcategory == "Place" || subcategory == "Event") {
 		if referenceID == "" {
-			utils.RespondWithError(w, http.StatusBadRequest, "Reference ID required")
+			apierr.Respond(w, http.StatusBadRequest, "Reference ID required")
 			return
 		}
 		refPtr = &referenceID
@@ -115,13 +119,17 @@ func CreateOrUpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 			"updatedAt":   time.Now(),
 		}
 
-		_, err := db.BlogPostsCollection.UpdateOne(ctx, filter, bson.M{"$set": update})
+		err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+			if _, err := db.BlogPostsCollection.UpdateOne(ctx, filter, bson.M{"$set": update}); err != nil {
+				return err
+			}
+			return mq.Emit(ctx, "post-updated", models.Index{EntityType: "blogpost", EntityId: postid, Method: "PATCH"})
+		})
 		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update post")
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to update post")
 			return
 		}
 
-		go mq.Emit(ctx, "post-updated", models.Index{EntityType: "blogpost", EntityId: postid, Method: "PATCH"})
 		utils.RespondWithJSON(w, http.StatusOK, map[string]any{"postid": postid})
 		return
 	}
@@ -138,13 +146,17 @@ func CreateOrUpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
-	_, err := db.BlogPostsCollection.InsertOne(ctx, newPost)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.BlogPostsCollection.InsertOne(ctx, newPost); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "post-created", models.Index{EntityType: "blogpost", EntityId: newPost.PostID, Method: "POST"})
+	})
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create post")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create post")
 		return
 	}
 
-	go mq.Emit(ctx, "post-created", models.Index{EntityType: "blogpost", EntityId: newPost.PostID, Method: "POST"})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"postid": newPost.PostID})
 }
 
@@ -161,24 +173,32 @@ func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	userID, ok := ctx.Value(globals.UserIDKey).(string)
 	if !ok {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid user")
+		apierr.Respond(w, http.StatusUnauthorized, "Invalid user")
 		return
 	}
 	postid := ps.ByName("id")
 	if postid == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Post ID required")
+		apierr.Respond(w, http.StatusBadRequest, "Post ID required")
 		return
 	}
-	res, err := db.BlogPostsCollection.DeleteOne(ctx, bson.M{"postid": postid, "createdBy": userID})
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete post")
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		res, err := db.BlogPostsCollection.DeleteOne(ctx, bson.M{"postid": postid, "createdBy": userID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return mq.Emit(ctx, "post-deleted", models.Index{EntityType: "blogpost", EntityId: postid, Method: "DELETE"})
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusNotFound, "Post not found or unauthorized")
 		return
 	}
-	if res.DeletedCount == 0 {
-		utils.RespondWithError(w, http.StatusNotFound, "Post not found or unauthorized")
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete post")
 		return
 	}
-	go mq.Emit(ctx, "post-deleted", models.Index{EntityType: "blogpost", EntityId: postid, Method: "DELETE"})
 	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"postid": postid, "deleted": true})
 }
 
@@ -188,7 +208,7 @@ func GetPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	postid := ps.ByName("id")
 	var post models.BlogPost
 	if err := db.BlogPostsCollection.FindOne(ctx, bson.M{"postid": postid}).Decode(&post); err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Post not found")
+		apierr.Respond(w, http.StatusNotFound, "Post not found")
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"post": post})
@@ -217,7 +237,7 @@ func GetAllPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	findOpts := options.Find().SetLimit(int64(limit)).SetSkip(int64(skip)).SetSort(bson.M{"createdAt": -1})
 	cur, err := db.BlogPostsCollection.Find(ctx, bson.M{}, findOpts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch posts")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch posts")
 		return
 	}
 	defer cur.Close(ctx)
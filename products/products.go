@@ -2,6 +2,7 @@ package products
 
 import (
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/models"
 	"net/http"
 
@@ -29,7 +30,7 @@ func GetProductDetails(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	case "art":
 		product = getArtEntity(entityId)
 	default:
-		http.Error(w, "Invalid entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid entity type")
 		return
 	}
 
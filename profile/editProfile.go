@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -13,7 +14,6 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // EditProfile allows a user to update their own profile fields.
@@ -22,7 +22,7 @@ func EditProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 1. Extract and validate the JWT from the Authorization header (strip "Bearer " if present).
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	tokenString := authHeader
@@ -32,13 +32,13 @@ func EditProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// 2. Parse multipart form data (e.g., for profile picture upload). Limit to ~10 MiB.
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
@@ -48,7 +48,7 @@ func EditProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 4. Build a bson.M of all fields user wants to update.
 	updates, err := UpdateProfileFields(r, claims)
 	if err != nil {
-		http.Error(w, "Failed to update profile fields", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update profile fields")
 		return
 	}
 
@@ -58,24 +58,28 @@ func EditProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 	return
 	// }
 
-	// 5. Persist those updates into MongoDB.
-	if err := ApplyProfileUpdates(claims.UserID, updates); err != nil {
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+	// 5. Persist those updates into MongoDB, together with the
+	//    “profile-edited” event.
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := ApplyProfileUpdates(ctx, claims.UserID, updates); err != nil {
+			return err
+		}
+		m := models.Index{
+			EntityType: "profile",
+			EntityId:   claims.UserID,
+			Method:     "PUT",
+		}
+		return mq.Emit(ctx, "profile-edited", m)
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update profile")
 		return
 	}
 
-	// 6. Emit a “profile-edited” event asynchronously.
-	m := models.Index{
-		EntityType: "profile",
-		EntityId:   claims.UserID,
-		Method:     "PUT",
-	}
-	go mq.Emit(ctx, "profile-edited", m)
-
-	// 7. Respond with the newly updated profile.
+	// 6. Respond with the newly updated profile.
 	if err := RespondWithUserProfile(w, claims.UserID); err != nil {
 		// If RespondWithUserProfile fails, return a generic 500.
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 	}
 }
 
@@ -85,7 +89,7 @@ func DeleteProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	// 1. Extract and validate the JWT from the Authorization header (strip "Bearer " if present).
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	tokenString := authHeader
@@ -94,28 +98,32 @@ func DeleteProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	// }
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// 2. Invalidate the cached profile JSON in Redis.
 	_ = InvalidateCachedProfile(claims.Username)
 
-	// 3. Remove the user document from MongoDB by userID.
-	if err := DeleteUserByID(claims.UserID); err != nil {
-		http.Error(w, "Failed to delete profile", http.StatusInternalServerError)
+	// 3. Remove the user document from MongoDB by userID, together with
+	//    the “profile-deleted” event.
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := DeleteUserByID(ctx, claims.UserID); err != nil {
+			return err
+		}
+		m := models.Index{
+			EntityType: "profile",
+			EntityId:   claims.UserID,
+			Method:     "DELETE",
+		}
+		return mq.Emit(ctx, "profile-deleted", m)
+	})
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to delete profile")
 		return
 	}
 
-	// 4. Emit a “profile-deleted” event asynchronously.
-	m := models.Index{
-		EntityType: "profile",
-		EntityId:   claims.UserID,
-		Method:     "DELETE",
-	}
-	go mq.Emit(ctx, "profile-deleted", m)
-
-	// 5. Return a simple JSON success message.
+	// 4. Return a simple JSON success message.
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]string{
@@ -157,14 +165,8 @@ func UpdateProfileFields(r *http.Request, claims *middleware.Claims) (bson.M, er
 		update["phone_number"] = newPhone
 	}
 
-	// Optional: password change
-	if newPassword := r.FormValue("password"); newPassword != "" {
-		hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-		if err != nil {
-			return nil, err
-		}
-		update["password"] = string(hashed)
-	}
+	// Passwords are changed through /api/v1/auth/password/change, which
+	// checks the current one and ends other sessions.
 
 	// (If you handle file uploads for Avatar or bannerPicture,
 	//  you would process r.MultipartForm here and store the new file, then
@@ -180,7 +182,7 @@ func UpdateProfileFields(r *http.Request, claims *middleware.Claims) (bson.M, er
 
 // ApplyProfileUpdates merges multiple bson.M maps into a single update map.
 // (Not currently used if you’re only calling UpdateUserByUsername directly.)
-func ApplyProfileUpdates(userid string, updates ...bson.M) error {
+func ApplyProfileUpdates(ctx context.Context, userid string, updates ...bson.M) error {
 	finalUpdate := bson.M{}
 	for _, u := range updates {
 		for k, v := range u {
@@ -189,7 +191,7 @@ func ApplyProfileUpdates(userid string, updates ...bson.M) error {
 	}
 
 	_, err := db.UserCollection.UpdateOne(
-		context.TODO(),
+		ctx,
 		bson.M{"userid": userid},
 		bson.M{"$set": finalUpdate},
 	)
@@ -207,9 +209,9 @@ func UpdateUserByUsername(username string, update bson.M) error {
 }
 
 // DeleteUserByID removes a user document by its userID field.
-func DeleteUserByID(userID string) error {
+func DeleteUserByID(ctx context.Context, userID string) error {
 	_, err := db.UserCollection.DeleteOne(
-		context.TODO(),
+		ctx,
 		bson.M{"userid": userID},
 	)
 	return err
@@ -3,6 +3,7 @@ package profile
 import (
 	"encoding/json"
 	"fmt"
+	"naevis/apierr"
 	"naevis/filemgr"
 	"naevis/middleware"
 	"naevis/models"
@@ -17,23 +18,23 @@ import (
 func EditProfilePic(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	claims, err := middleware.ValidateJWT(r.Header.Get("Authorization"))
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
 	pictureUpdates, err := updateAvatars(w, r, claims)
 	if err != nil {
-		http.Error(w, "Failed to update profile picture", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update profile picture")
 		return
 	}
 
-	if err := ApplyProfileUpdates(claims.UserID, pictureUpdates); err != nil {
-		http.Error(w, "Failed to update profile picture", http.StatusInternalServerError)
+	if err := ApplyProfileUpdates(r.Context(), claims.UserID, pictureUpdates); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update profile picture")
 		return
 	}
 
@@ -43,7 +44,7 @@ func EditProfilePic(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	// Return only the new image name as JSON
 	origName, ok := pictureUpdates["avatar"].(string)
 	if !ok {
-		http.Error(w, "Failed to get updated image name", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to get updated image name")
 		return
 	}
 
@@ -55,23 +56,23 @@ func EditProfilePic(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 func EditProfileBanner(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	claims, err := middleware.ValidateJWT(r.Header.Get("Authorization"))
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
 	bannerUpdates, err := uploadBannerHandler(w, r, claims)
 	if err != nil {
-		http.Error(w, "Failed to update banner picture", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update banner picture")
 		return
 	}
 
-	if err := ApplyProfileUpdates(claims.UserID, bannerUpdates); err != nil {
-		http.Error(w, "Failed to update banner picture", http.StatusInternalServerError)
+	if err := ApplyProfileUpdates(r.Context(), claims.UserID, bannerUpdates); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update banner picture")
 		return
 	}
 
@@ -81,7 +82,7 @@ func EditProfileBanner(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	// Return only the new image name as JSON
 	origName, ok := bannerUpdates["banner"].(string)
 	if !ok {
-		http.Error(w, "Failed to get updated banner image name", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to get updated banner image name")
 		return
 	}
 
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -23,7 +24,7 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	// 1. Extract and validate the JWT from the Authorization header (strip "Bearer " if present).
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	tokenString := authHeader
@@ -33,7 +34,7 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -45,24 +46,24 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	err = db.UserCollection.FindOne(r.Context(), bson.M{"username": username}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "User not found")
 			return
 		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	// 4. Fetch follow data for that user.
 	userFollow, err := GetUserFollowData(user.UserID)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	// 5. Check online status in Redis.
 	user.Online = rdx.Exists("online:" + user.UserID)
 
-	// 6. Build a trimmed-down response DTO so we don’t accidentally expose fields like PasswordHash.
+	// 6. Build a trimmed-down response DTO so we don’t accidentally expose fields like Password.
 	userProfile := models.UserProfileResponse{
 		UserID:         user.UserID,
 		Username:       user.Username,
@@ -89,7 +90,7 @@ func GetProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 1. Extract and validate the JWT from the Authorization header (strip "Bearer " if present).
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	tokenString := authHeader
@@ -99,7 +100,7 @@ func GetProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -113,7 +114,7 @@ func GetProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 3. Fetch follow data for this user.
 	userFollow, err := GetUserFollowData(claims.UserID)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -122,10 +123,10 @@ func GetProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	err = db.UserCollection.FindOne(r.Context(), bson.M{"userid": claims.UserID}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "User not found")
 			return
 		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -140,7 +141,7 @@ func GetProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// 7. Marshal to JSON and cache the result.
 	profileJSON, err := json.Marshal(user)
 	if err != nil {
-		http.Error(w, "Failed to encode profile", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode profile")
 		return
 	}
 
@@ -158,7 +159,7 @@ func RespondWithUserProfile(w http.ResponseWriter, userid string) error {
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			// 404 is already written; caller should not write anything else.
-			http.Error(w, "User not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "User not found")
 			return nil
 		}
 		return err
@@ -1,93 +1,191 @@
+// Package ratelim limits request rates across all instances using Redis.
+// Each route is assigned a named policy; clients are keyed on their user ID
+// when the request carries a valid token and on their address otherwise.
 package ratelim
 
 import (
-	"net"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
+	"naevis/apierr"
+	"naevis/clientip"
+	"naevis/config"
+	"naevis/globals"
+	"naevis/metrics"
+	"naevis/middleware"
+	"naevis/rdx"
+
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/time/rate"
+	"github.com/redis/go-redis/v9"
 )
 
-// RateLimiter is a middleware struct with configuration and visitor state
+// Policy allows Limit requests per sliding Window.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Built-in policies. RATE_LIMITS overrides them by name.
+var DefaultPolicies = []Policy{
+	{Name: "default", Limit: 120, Window: time.Minute},
+	{Name: "auth", Limit: 10, Window: time.Minute},
+	{Name: "upload", Limit: 20, Window: time.Minute},
+	{Name: "payments", Limit: 30, Window: time.Minute},
+	{Name: "search", Limit: 60, Window: time.Minute},
+}
+
+var rejectedTotal = metrics.NewCounterVec("naevis_ratelimit_rejected_total",
+	"Requests rejected by the rate limiter, by policy.", "policy")
+
+// RateLimiter enforces named policies with counters shared through Redis.
 type RateLimiter struct {
-	visitors     map[string]*rate.Limiter
-	mu           sync.Mutex
-	rate         rate.Limit
-	burst        int
-	cleanupAfter time.Duration
-	maxEntries   int
+	policies map[string]Policy
+	trusted  *clientip.Resolver
+	now      func() time.Time
 }
 
-// NewRateLimiter initializes a new RateLimiter
-func NewRateLimiter(r rate.Limit, b int, cleanupAfter time.Duration, maxEntries int) *RateLimiter {
-	return &RateLimiter{
-		visitors:     make(map[string]*rate.Limiter),
-		rate:         r,
-		burst:        b,
-		cleanupAfter: cleanupAfter,
-		maxEntries:   maxEntries,
+// NewRateLimiter builds a limiter from the built-in policies with cfg's
+// overrides applied.
+func NewRateLimiter(cfg config.RateLimit) *RateLimiter {
+	rl := &RateLimiter{
+		policies: make(map[string]Policy, len(DefaultPolicies)),
+		trusted:  clientip.New(cfg.TrustedProxies),
+		now:      time.Now,
+	}
+	for _, p := range DefaultPolicies {
+		rl.policies[p.Name] = p
 	}
+	for name, p := range cfg.Policies {
+		rl.policies[name] = Policy{Name: name, Limit: p.Limit, Window: p.Window}
+	}
+	return rl
 }
 
-// getLimiter returns an existing limiter or creates a new one
-func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// Limit is the httprouter middleware for the default policy.
+func (rl *RateLimiter) Limit(next httprouter.Handle) httprouter.Handle {
+	return rl.Policy("default")(next)
+}
 
-	if limiter, exists := rl.visitors[ip]; exists {
-		return limiter
+// Policy returns middleware enforcing the named policy. It panics on an
+// unknown name so a typo fails at startup rather than leaving a route open.
+func (rl *RateLimiter) Policy(name string) func(httprouter.Handle) httprouter.Handle {
+	p, ok := rl.policies[name]
+	if !ok {
+		panic("ratelim: unknown policy " + strconv.Quote(name))
 	}
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			d, err := rl.Allow(r.Context(), p, rl.clientKey(r))
+			if err != nil {
+				// Fail open: an unreachable Redis must not take the API down.
+				slog.WarnContext(r.Context(), "rate limiter unavailable", "policy", p.Name, "error", err)
+				next(w, r, ps)
+				return
+			}
 
-	// Optional: Enforce max entries to avoid memory abuse
-	if len(rl.visitors) >= rl.maxEntries {
-		// Reject new IPs silently, or fallback to a shared limiter
-		return rate.NewLimiter(rate.Limit(0.1), 1) // harsh fallback
-	}
+			h := w.Header()
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, int(p.Window.Seconds())))
+			h.Set("RateLimit-Limit", strconv.Itoa(p.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
 
-	limiter := rate.NewLimiter(rl.rate, rl.burst)
-	rl.visitors[ip] = limiter
+			if !d.Allowed {
+				rejectedTotal.Inc(p.Name)
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+				apierr.Respond(w, http.StatusTooManyRequests, "Too many requests. Please try again later.")
+				return
+			}
 
-	// Cleanup this IP entry after a fixed TTL
-	go func() {
-		time.Sleep(rl.cleanupAfter)
-		rl.mu.Lock()
-		delete(rl.visitors, ip)
-		rl.mu.Unlock()
-	}()
+			next(w, r, ps)
+		}
+	}
+}
 
-	return limiter
+// Decision is the outcome of one Allow call.
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the current window ends
+	RetryAfter time.Duration // set when !Allowed
 }
 
-// extractClientIP tries to determine the client's real IP address
-func extractClientIP(r *http.Request) string {
-	// Respect reverse proxy headers
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
+// Allow counts one request for key under p using a sliding window
+// counter: the previous fixed window's count is weighted by how much of it
+// still overlaps the sliding window. Rejected requests are not counted.
+func (rl *RateLimiter) Allow(ctx context.Context, p Policy, key string) (Decision, error) {
+	if rdx.Conn == nil {
+		return Decision{Allowed: true, Remaining: p.Limit}, nil
 	}
-	// Otherwise use RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+
+	window := p.Window.Milliseconds()
+	now := rl.now().UnixMilli()
+	slot := now / window
+	elapsed := now % window
+
+	curKey := fmt.Sprintf("rl:%s:%s:%d", p.Name, key, slot)
+	prevKey := fmt.Sprintf("rl:%s:%s:%d", p.Name, key, slot-1)
+
+	pipe := rdx.Conn.TxPipeline()
+	incr := pipe.Incr(ctx, curKey)
+	pipe.PExpire(ctx, curKey, 2*p.Window)
+	prevCmd := pipe.Get(ctx, prevKey)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return Decision{}, err
+	}
+
+	prev, _ := prevCmd.Int64()
+	cur := incr.Val()
+	weight := float64(window-elapsed) / float64(window)
+	estimate := float64(prev)*weight + float64(cur)
+
+	d := Decision{Reset: time.Duration(window-elapsed) * time.Millisecond}
+	if estimate <= float64(p.Limit) {
+		d.Allowed = true
+		d.Remaining = int(math.Floor(float64(p.Limit) - estimate))
+		return d, nil
+	}
+
+	if err := rdx.Conn.Decr(ctx, curKey).Err(); err != nil {
+		slog.WarnContext(ctx, "rate limiter decrement failed", "key", curKey, "error", err)
+	}
+	cur--
+
+	// Wait until the previous window's weight has decayed enough for one
+	// more request, or until the next window if this one alone is full.
+	retry := window - elapsed
+	if cur < int64(p.Limit) && prev > 0 {
+		need := float64(window-elapsed) - float64(int64(p.Limit)-cur-1)*float64(window)/float64(prev)
+		retry = int64(math.Max(need, 0))
 	}
-	return ip
+	d.RetryAfter = time.Duration(retry) * time.Millisecond
+	return d, nil
 }
 
-// Limit is the httprouter middleware for rate limiting
-func (rl *RateLimiter) Limit(next httprouter.Handle) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		ip := extractClientIP(r)
-		limiter := rl.getLimiter(ip)
-
-		if !limiter.Allow() {
-			// Optional logging could go here
-			http.Error(w, "Too many requests. Please try again later.", http.StatusTooManyRequests)
-			return
+// clientKey identifies who a request counts against: the user when the
+// request is (or can be) authenticated, otherwise the client address.
+func (rl *RateLimiter) clientKey(r *http.Request) string {
+	if id, ok := r.Context().Value(globals.UserIDKey).(string); ok && id != "" {
+		return "u:" + id
+	}
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && auth[:7] == "Bearer " {
+		if claims, err := middleware.ValidateJWT(auth); err == nil && claims.UserID != "" {
+			return "u:" + claims.UserID
 		}
+	}
+	return "ip:" + rl.trusted.IP(r)
+}
 
-		next(w, r, ps)
+func ceilSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
 	}
+	return s
 }
@@ -0,0 +1,43 @@
+package ratelim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"naevis/config"
+	"naevis/rdx"
+	"naevis/rdx/memredis"
+)
+
+func TestAllowSlidingWindow(t *testing.T) {
+	client := memredis.NewClient()
+	rdx.Use(client)
+	defer client.Close()
+
+	ctx := context.Background()
+	now := time.UnixMilli(60_000 * 1000) // start of a window
+	rl := NewRateLimiter(config.RateLimit{})
+	rl.now = func() time.Time { return now }
+	p := Policy{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if d, err := rl.Allow(ctx, p, "k"); err != nil || !d.Allowed {
+			t.Fatalf("request %d = %+v, %v", i, d, err)
+		}
+	}
+	d, err := rl.Allow(ctx, p, "k")
+	if err != nil || d.Allowed || d.RetryAfter <= 0 {
+		t.Fatalf("over limit = %+v, %v", d, err)
+	}
+
+	// Halfway into the next window the previous three weigh 1.5, leaving
+	// room for exactly one more request.
+	now = now.Add(90 * time.Second)
+	if d, _ := rl.Allow(ctx, p, "k"); !d.Allowed {
+		t.Errorf("after half a window = %+v, want allowed", d)
+	}
+	if d, _ := rl.Allow(ctx, p, "k"); d.Allowed {
+		t.Errorf("second after half a window = %+v, want rejected", d)
+	}
+}
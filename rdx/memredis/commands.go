@@ -0,0 +1,1030 @@
+package memredis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type handler func(s *Server, args []string) interface{}
+
+// commands maps lower-case command names to handlers. Handlers run with
+// s.mu held.
+var commands map[string]handler
+
+func init() {
+	commands = map[string]handler{
+		"ping":     cmdPing,
+		"hello":    func(*Server, []string) interface{} { return errReply("ERR unknown command 'HELLO'") },
+		"client":   func(*Server, []string) interface{} { return ok },
+		"select":   cmdSelect,
+		"flushdb":  cmdFlush,
+		"flushall": cmdFlush,
+		"dbsize":   func(s *Server, _ []string) interface{} { return len(s.liveKeys()) },
+
+		"get":    cmdGet,
+		"set":    cmdSet,
+		"setnx":  cmdSetNX,
+		"append": cmdAppend,
+		"incr":   func(s *Server, a []string) interface{} { return incrBy(s, "incr", a, 1, 1) },
+		"decr":   func(s *Server, a []string) interface{} { return incrBy(s, "decr", a, 1, -1) },
+		"incrby": func(s *Server, a []string) interface{} { return incrBy(s, "incrby", a, 2, 1) },
+		"decrby": func(s *Server, a []string) interface{} { return incrBy(s, "decrby", a, 2, -1) },
+		"del":    cmdDel,
+		"unlink": cmdDel,
+		"exists": cmdExists,
+		"expire": func(s *Server, a []string) interface{} { return cmdExpire(s, a, time.Second) },
+		"pexpire": func(s *Server, a []string) interface{} {
+			return cmdExpire(s, a, time.Millisecond)
+		},
+		"ttl":  func(s *Server, a []string) interface{} { return cmdTTL(s, a, time.Second) },
+		"pttl": func(s *Server, a []string) interface{} { return cmdTTL(s, a, time.Millisecond) },
+		"keys": cmdKeys,
+		"scan": cmdScan,
+		"type": cmdType,
+
+		"hset":    cmdHSet,
+		"hget":    cmdHGet,
+		"hdel":    cmdHDel,
+		"hgetall": cmdHGetAll,
+		"hincrby": cmdHIncrBy,
+
+		"sadd":      cmdSAdd,
+		"srem":      cmdSRem,
+		"smembers":  cmdSMembers,
+		"sismember": cmdSIsMember,
+		"scard":     cmdSCard,
+
+		"zadd":          cmdZAdd,
+		"zrem":          cmdZRem,
+		"zscore":        cmdZScore,
+		"zcard":         cmdZCard,
+		"zincrby":       cmdZIncrBy,
+		"zrange":        func(s *Server, a []string) interface{} { return zrangeByRank(s, "zrange", a, false) },
+		"zrevrange":     func(s *Server, a []string) interface{} { return zrangeByRank(s, "zrevrange", a, true) },
+		"zrangebyscore": cmdZRangeByScore,
+		"zrangebylex":   cmdZRangeByLex,
+
+		"lpush":  func(s *Server, a []string) interface{} { return push(s, "lpush", a, true) },
+		"rpush":  func(s *Server, a []string) interface{} { return push(s, "rpush", a, false) },
+		"lrange": cmdLRange,
+		"ltrim":  cmdLTrim,
+		"llen":   cmdLLen,
+
+		"publish": cmdPublish,
+
+		"xadd":       cmdXAdd,
+		"xlen":       cmdXLen,
+		"xdel":       cmdXDel,
+		"xrange":     func(s *Server, a []string) interface{} { return xrange(s, "xrange", a, false) },
+		"xrevrange":  func(s *Server, a []string) interface{} { return xrange(s, "xrevrange", a, true) },
+		"xtrim":      cmdXTrim,
+		"xgroup":     cmdXGroup,
+		"xreadgroup": cmdXReadGroup,
+		"xack":       cmdXAck,
+		"xpending":   cmdXPending,
+		"xclaim":     cmdXClaim,
+		"xinfo":      cmdXInfo,
+	}
+}
+
+func cmdPing(_ *Server, args []string) interface{} {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func cmdSelect(_ *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("select")
+	}
+	if args[0] != "0" {
+		return errReply("ERR DB index is out of range")
+	}
+	return ok
+}
+
+func cmdFlush(s *Server, _ []string) interface{} {
+	for k := range s.keys {
+		s.touch(k)
+	}
+	s.keys = map[string]*entry{}
+	return ok
+}
+
+// liveKeys returns the unexpired keys in sorted order.
+func (s *Server) liveKeys() []string {
+	out := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		if s.lookup(k) != nil {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ---- strings ----
+
+func cmdGet(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("get")
+	}
+	e, err := s.typed(args[0], kindString, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	return e.str
+}
+
+// cmdSet supports SET key value [NX|XX] [GET] [EX s|PX ms|KEEPTTL].
+func cmdSet(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("set")
+	}
+	key, val := args[0], args[1]
+	var nx, xx, keepTTL, get bool
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+			get = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errReply("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToLower(args[i]) == "px" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+
+	old := s.lookup(key)
+	var prev interface{}
+	if get && old != nil {
+		if old.kind != kindString {
+			return errType
+		}
+		prev = old.str
+	}
+	if (nx && old != nil) || (xx && old == nil) {
+		if get {
+			return prev
+		}
+		return nil
+	}
+	e := &entry{kind: kindString, str: val}
+	switch {
+	case ttl > 0:
+		e.expireAt = s.now().Add(ttl)
+	case keepTTL && old != nil:
+		e.expireAt = old.expireAt
+	}
+	s.keys[key] = e
+	s.touch(key)
+	if get {
+		return prev
+	}
+	return ok
+}
+
+func cmdSetNX(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("setnx")
+	}
+	if s.lookup(args[0]) != nil {
+		return 0
+	}
+	s.keys[args[0]] = &entry{kind: kindString, str: args[1]}
+	s.touch(args[0])
+	return 1
+}
+
+func cmdAppend(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("append")
+	}
+	e, err := s.typed(args[0], kindString, true)
+	if err != nil {
+		return err
+	}
+	e.str += args[1]
+	s.touch(args[0])
+	return len(e.str)
+}
+
+// incrBy implements INCR, DECR, INCRBY and DECRBY; nargs is the expected
+// argument count and sign negates the increment.
+func incrBy(s *Server, name string, args []string, nargs int, sign int64) interface{} {
+	if len(args) != nargs {
+		return errArgs(name)
+	}
+	by := int64(1)
+	if nargs == 2 {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errInt
+		}
+		by = n
+	}
+	e, rerr := s.typed(args[0], kindString, true)
+	if rerr != nil {
+		return rerr
+	}
+	cur := int64(0)
+	if e.str != "" {
+		n, err := strconv.ParseInt(e.str, 10, 64)
+		if err != nil {
+			return errInt
+		}
+		cur = n
+	}
+	cur += sign * by
+	e.str = strconv.FormatInt(cur, 10)
+	s.touch(args[0])
+	return cur
+}
+
+// ---- keyspace ----
+
+func cmdDel(s *Server, args []string) interface{} {
+	n := 0
+	for _, k := range args {
+		if s.lookup(k) != nil {
+			delete(s.keys, k)
+			s.touch(k)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *Server, args []string) interface{} {
+	n := 0
+	for _, k := range args {
+		if s.lookup(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExpire(s *Server, args []string, unit time.Duration) interface{} {
+	if len(args) < 2 {
+		return errArgs("expire")
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errInt
+	}
+	e := s.lookup(args[0])
+	if e == nil {
+		return 0
+	}
+	e.expireAt = s.now().Add(time.Duration(n) * unit)
+	s.touch(args[0])
+	s.expire(args[0])
+	return 1
+}
+
+func cmdTTL(s *Server, args []string, unit time.Duration) interface{} {
+	if len(args) != 1 {
+		return errArgs("ttl")
+	}
+	e := s.lookup(args[0])
+	switch {
+	case e == nil:
+		return -2
+	case e.expireAt.IsZero():
+		return -1
+	}
+	left := e.expireAt.Sub(s.now())
+	return int64((left + unit - 1) / unit)
+}
+
+func cmdKeys(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("keys")
+	}
+	out := []string{}
+	for _, k := range s.liveKeys() {
+		if globMatch(args[0], k) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// cmdScan pages through the sorted key list; the cursor is an offset into
+// it, which is stable enough for the single-pass scans the code does.
+func cmdScan(s *Server, args []string) interface{} {
+	if len(args) < 1 {
+		return errArgs("scan")
+	}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return errReply("ERR invalid cursor")
+	}
+	match, count, typ := "*", 10, ""
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "match":
+			match = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errSyntax
+			}
+		case "type":
+			typ = strings.ToLower(args[i+1])
+		default:
+			return errSyntax
+		}
+	}
+	keys := s.liveKeys()
+	end := cursor + count
+	if end >= len(keys) {
+		end = len(keys)
+	}
+	found := []string{}
+	for _, k := range keys[min(cursor, len(keys)):end] {
+		if globMatch(match, k) && (typ == "" || typeName(s.keys[k]) == typ) {
+			found = append(found, k)
+		}
+	}
+	next := end
+	if end >= len(keys) {
+		next = 0
+	}
+	return []interface{}{strconv.Itoa(next), found}
+}
+
+func cmdType(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("type")
+	}
+	return status(typeName(s.lookup(args[0])))
+}
+
+func typeName(e *entry) string {
+	if e == nil {
+		return "none"
+	}
+	return [...]string{"string", "hash", "set", "zset", "list", "stream"}[e.kind]
+}
+
+// ---- hashes ----
+
+func cmdHSet(s *Server, args []string) interface{} {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return errArgs("hset")
+	}
+	e, err := s.typed(args[0], kindHash, true)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for i := 1; i < len(args); i += 2 {
+		if _, exists := e.hash[args[i]]; !exists {
+			n++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	s.touch(args[0])
+	return n
+}
+
+func cmdHGet(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("hget")
+	}
+	e, err := s.typed(args[0], kindHash, false)
+	if err != nil || e == nil {
+		return err
+	}
+	v, found := e.hash[args[1]]
+	if !found {
+		return nil
+	}
+	return v
+}
+
+func cmdHDel(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("hdel")
+	}
+	e, err := s.typed(args[0], kindHash, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return 0
+	}
+	n := 0
+	for _, f := range args[1:] {
+		if _, found := e.hash[f]; found {
+			delete(e.hash, f)
+			n++
+		}
+	}
+	if n > 0 {
+		s.touch(args[0])
+		s.dropIfEmpty(args[0])
+	}
+	return n
+}
+
+func cmdHGetAll(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("hgetall")
+	}
+	e, err := s.typed(args[0], kindHash, false)
+	if err != nil {
+		return err
+	}
+	out := []string{}
+	if e == nil {
+		return out
+	}
+	fields := make([]string, 0, len(e.hash))
+	for f := range e.hash {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		out = append(out, f, e.hash[f])
+	}
+	return out
+}
+
+func cmdHIncrBy(s *Server, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs("hincrby")
+	}
+	by, perr := strconv.ParseInt(args[2], 10, 64)
+	if perr != nil {
+		return errInt
+	}
+	e, err := s.typed(args[0], kindHash, true)
+	if err != nil {
+		return err
+	}
+	cur := int64(0)
+	if v, found := e.hash[args[1]]; found {
+		if cur, perr = strconv.ParseInt(v, 10, 64); perr != nil {
+			return errReply("ERR hash value is not an integer")
+		}
+	}
+	cur += by
+	e.hash[args[1]] = strconv.FormatInt(cur, 10)
+	s.touch(args[0])
+	return cur
+}
+
+// ---- sets ----
+
+func cmdSAdd(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("sadd")
+	}
+	e, err := s.typed(args[0], kindSet, true)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if !e.set[m] {
+			e.set[m] = true
+			n++
+		}
+	}
+	s.touch(args[0])
+	return n
+}
+
+func cmdSRem(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("srem")
+	}
+	e, err := s.typed(args[0], kindSet, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return 0
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if e.set[m] {
+			delete(e.set, m)
+			n++
+		}
+	}
+	if n > 0 {
+		s.touch(args[0])
+		s.dropIfEmpty(args[0])
+	}
+	return n
+}
+
+func cmdSMembers(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("smembers")
+	}
+	e, err := s.typed(args[0], kindSet, false)
+	if err != nil {
+		return err
+	}
+	out := []string{}
+	if e != nil {
+		for m := range e.set {
+			out = append(out, m)
+		}
+		sort.Strings(out)
+	}
+	return out
+}
+
+func cmdSIsMember(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("sismember")
+	}
+	e, err := s.typed(args[0], kindSet, false)
+	if err != nil {
+		return err
+	}
+	return e != nil && e.set[args[1]]
+}
+
+func cmdSCard(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("scard")
+	}
+	e, err := s.typed(args[0], kindSet, false)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.set)
+}
+
+func orZero(err interface{}) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
+
+// ---- sorted sets ----
+
+type scored struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members of a sorted set by (score, member).
+func (e *entry) sorted() []scored {
+	out := make([]scored, 0, len(e.zset))
+	for m, sc := range e.zset {
+		out = append(out, scored{m, sc})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score < out[j].score
+		}
+		return out[i].member < out[j].member
+	})
+	return out
+}
+
+func parseScore(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "+inf", "inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// cmdZAdd supports ZADD key [NX|XX] [GT|LT] [CH] score member ...
+func cmdZAdd(s *Server, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs("zadd")
+	}
+	key := args[0]
+	var nx, xx, gt, lt, ch bool
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+			ch = true
+		default:
+			break flags
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) {
+		return errSyntax
+	}
+	e, err := s.typed(key, kindZSet, true)
+	if err != nil {
+		return err
+	}
+	added, changed := 0, 0
+	for j := 0; j < len(pairs); j += 2 {
+		sc, valid := parseScore(pairs[j])
+		if !valid {
+			s.dropIfEmpty(key)
+			return errFloat
+		}
+		m := pairs[j+1]
+		old, exists := e.zset[m]
+		switch {
+		case exists && nx, !exists && xx:
+			continue
+		case exists && gt && sc <= old, exists && lt && sc >= old:
+			continue
+		}
+		e.zset[m] = sc
+		if !exists {
+			added++
+		} else if old != sc {
+			changed++
+		}
+	}
+	s.dropIfEmpty(key)
+	s.touch(key)
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZRem(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("zrem")
+	}
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, found := e.zset[m]; found {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	if n > 0 {
+		s.touch(args[0])
+		s.dropIfEmpty(args[0])
+	}
+	return n
+}
+
+func cmdZScore(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("zscore")
+	}
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil || e == nil {
+		return err
+	}
+	sc, found := e.zset[args[1]]
+	if !found {
+		return nil
+	}
+	return sc
+}
+
+func cmdZCard(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("zcard")
+	}
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.zset)
+}
+
+func cmdZIncrBy(s *Server, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs("zincrby")
+	}
+	by, valid := parseScore(args[1])
+	if !valid {
+		return errFloat
+	}
+	e, err := s.typed(args[0], kindZSet, true)
+	if err != nil {
+		return err
+	}
+	e.zset[args[2]] += by
+	s.touch(args[0])
+	return e.zset[args[2]]
+}
+
+// rankRange clamps Redis start/stop ranks (negative from the end) to
+// slice bounds.
+func rankRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+func withScores(items []scored, scores bool) []interface{} {
+	out := []interface{}{}
+	for _, it := range items {
+		out = append(out, it.member)
+		if scores {
+			out = append(out, it.score)
+		}
+	}
+	return out
+}
+
+func zrangeByRank(s *Server, name string, args []string, rev bool) interface{} {
+	if len(args) < 3 {
+		return errArgs(name)
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return errInt
+	}
+	scores := len(args) > 3 && strings.ToLower(args[3]) == "withscores"
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []interface{}{}
+	}
+	items := e.sorted()
+	if rev {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	lo, hi, any := rankRange(start, stop, len(items))
+	if !any {
+		return []interface{}{}
+	}
+	return withScores(items[lo:hi], scores)
+}
+
+// limitArgs parses trailing [WITHSCORES] [LIMIT offset count].
+func limitArgs(args []string) (scores bool, offset, count int, errr interface{}) {
+	count = -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "withscores":
+			scores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return false, 0, 0, errSyntax
+			}
+			var e1, e2 error
+			offset, e1 = strconv.Atoi(args[i+1])
+			count, e2 = strconv.Atoi(args[i+2])
+			if e1 != nil || e2 != nil {
+				return false, 0, 0, errInt
+			}
+			i += 2
+		default:
+			return false, 0, 0, errSyntax
+		}
+	}
+	return scores, offset, count, nil
+}
+
+func applyLimit(items []scored, offset, count int) []scored {
+	if offset >= len(items) || offset < 0 {
+		return nil
+	}
+	items = items[offset:]
+	if count >= 0 && count < len(items) {
+		items = items[:count]
+	}
+	return items
+}
+
+func scoreBound(s string) (float64, bool, bool) {
+	excl := strings.HasPrefix(s, "(")
+	f, valid := parseScore(strings.TrimPrefix(s, "("))
+	return f, excl, valid
+}
+
+func cmdZRangeByScore(s *Server, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs("zrangebyscore")
+	}
+	lo, loEx, ok1 := scoreBound(args[1])
+	hi, hiEx, ok2 := scoreBound(args[2])
+	if !ok1 || !ok2 {
+		return errReply("ERR min or max is not a float")
+	}
+	scores, offset, count, lerr := limitArgs(args[3:])
+	if lerr != nil {
+		return lerr
+	}
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []interface{}{}
+	}
+	var items []scored
+	for _, it := range e.sorted() {
+		if (it.score > lo || (!loEx && it.score == lo)) && (it.score < hi || (!hiEx && it.score == hi)) {
+			items = append(items, it)
+		}
+	}
+	return withScores(applyLimit(items, offset, count), scores)
+}
+
+// lexBound parses "-", "+", "[x" and "(x".
+func lexBound(s string, member string, lower bool) (bool, bool) {
+	switch {
+	case s == "-":
+		return lower, true
+	case s == "+":
+		return !lower, true
+	case strings.HasPrefix(s, "["):
+		v := s[1:]
+		if lower {
+			return member >= v, true
+		}
+		return member <= v, true
+	case strings.HasPrefix(s, "("):
+		v := s[1:]
+		if lower {
+			return member > v, true
+		}
+		return member < v, true
+	}
+	return false, false
+}
+
+func cmdZRangeByLex(s *Server, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs("zrangebylex")
+	}
+	if _, valid := lexBound(args[1], "", true); !valid {
+		return errReply("ERR min or max not valid string range item")
+	}
+	if _, valid := lexBound(args[2], "", false); !valid {
+		return errReply("ERR min or max not valid string range item")
+	}
+	_, offset, count, lerr := limitArgs(args[3:])
+	if lerr != nil {
+		return lerr
+	}
+	e, err := s.typed(args[0], kindZSet, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []interface{}{}
+	}
+	var items []scored
+	for _, it := range e.sorted() {
+		above, _ := lexBound(args[1], it.member, true)
+		below, _ := lexBound(args[2], it.member, false)
+		if above && below {
+			items = append(items, it)
+		}
+	}
+	return withScores(applyLimit(items, offset, count), false)
+}
+
+// ---- lists ----
+
+func push(s *Server, name string, args []string, left bool) interface{} {
+	if len(args) < 2 {
+		return errArgs(name)
+	}
+	e, err := s.typed(args[0], kindList, true)
+	if err != nil {
+		return err
+	}
+	for _, v := range args[1:] {
+		if left {
+			e.list = append([]string{v}, e.list...)
+		} else {
+			e.list = append(e.list, v)
+		}
+	}
+	s.touch(args[0])
+	return len(e.list)
+}
+
+func cmdLRange(s *Server, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs("lrange")
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return errInt
+	}
+	e, err := s.typed(args[0], kindList, false)
+	if err != nil {
+		return err
+	}
+	out := []string{}
+	if e == nil {
+		return out
+	}
+	lo, hi, any := rankRange(start, stop, len(e.list))
+	if !any {
+		return out
+	}
+	return append(out, e.list[lo:hi]...)
+}
+
+func cmdLTrim(s *Server, args []string) interface{} {
+	if len(args) != 3 {
+		return errArgs("ltrim")
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return errInt
+	}
+	e, err := s.typed(args[0], kindList, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return ok
+	}
+	lo, hi, any := rankRange(start, stop, len(e.list))
+	if !any {
+		e.list = nil
+	} else {
+		e.list = append([]string(nil), e.list[lo:hi]...)
+	}
+	s.touch(args[0])
+	s.dropIfEmpty(args[0])
+	return ok
+}
+
+func cmdLLen(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("llen")
+	}
+	e, err := s.typed(args[0], kindList, false)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.list)
+}
@@ -0,0 +1,442 @@
+// Package memredis is an in-process Redis for running the server and its
+// tests without a Redis instance. It speaks RESP2 over in-memory pipes, so
+// the ordinary go-redis client is used unchanged; only the commands the
+// code base issues are implemented.
+package memredis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Server holds the keyspace. A single lock serializes commands, which
+// also makes MULTI/EXEC atomic.
+type Server struct {
+	mu       sync.Mutex
+	keys     map[string]*entry
+	versions map[string]uint64 // bumped on every write, for WATCH
+	subs     map[string]map[*conn]bool
+	psubs    map[string]map[*conn]bool
+	wake     chan struct{} // closed and replaced when a stream grows
+	now      func() time.Time
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindHash
+	kindSet
+	kindZSet
+	kindList
+	kindStream
+)
+
+type entry struct {
+	kind     kind
+	str      string
+	hash     map[string]string
+	set      map[string]bool
+	zset     map[string]float64
+	list     []string
+	stream   *stream
+	expireAt time.Time // zero: no expiry
+}
+
+// NewServer returns an empty server.
+func NewServer() *Server {
+	return &Server{
+		keys:     map[string]*entry{},
+		versions: map[string]uint64{},
+		subs:     map[string]map[*conn]bool{},
+		psubs:    map[string]map[*conn]bool{},
+		wake:     make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// NewClient returns a go-redis client connected to a fresh server.
+func NewClient() *redis.Client {
+	return NewServer().Client()
+}
+
+// Client returns a go-redis client connected to s.
+func (s *Server) Client() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:            "memredis",
+		Protocol:        2,
+		DisableIdentity: true,
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go s.serve(server)
+			return client, nil
+		},
+	})
+}
+
+// Reply values. Strings are bulk strings; nil is the null bulk string.
+type (
+	status   string
+	errReply string
+	nilArray struct{}
+)
+
+var (
+	ok        = status("OK")
+	errSyntax = errReply("ERR syntax error")
+	errType   = errReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errInt    = errReply("ERR value is not an integer or out of range")
+	errFloat  = errReply("ERR value is not a valid float")
+)
+
+func errArgs(cmd string) errReply {
+	return errReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd))
+}
+
+// conn is one client connection.
+type conn struct {
+	srv *Server
+	nc  net.Conn
+	out chan []byte
+
+	// transaction state
+	multi   bool
+	aborted bool
+	queued  [][]string
+	watched map[string]uint64
+
+	// pub/sub state
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+func (s *Server) serve(nc net.Conn) {
+	c := &conn{srv: s, nc: nc, out: make(chan []byte, 1024)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for b := range c.out {
+			if _, err := nc.Write(b); err != nil {
+				// Keep draining so senders never block on a dead client.
+				for range c.out {
+				}
+				return
+			}
+		}
+	}()
+
+	rd := bufio.NewReader(nc)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			break
+		}
+		if len(args) == 0 {
+			continue
+		}
+		r := c.handle(args)
+		if _, skip := r.(noReply); !skip {
+			c.send(r)
+		}
+	}
+
+	s.mu.Lock()
+	c.unsubscribeAll()
+	s.mu.Unlock()
+	close(c.out)
+	<-done
+	nc.Close()
+}
+
+// send encodes v and queues it for the writer.
+func (c *conn) send(v interface{}) {
+	var b strings.Builder
+	encode(&b, v)
+	select {
+	case c.out <- []byte(b.String()):
+	default:
+		// A subscriber that stopped reading; drop like a full output buffer.
+	}
+}
+
+// handle runs one command and returns its reply.
+func (c *conn) handle(args []string) interface{} {
+	name := strings.ToLower(args[0])
+	s := c.srv
+
+	if len(c.channels)+len(c.patterns) > 0 {
+		switch name {
+		case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping", "quit":
+		default:
+			return errReply("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+		}
+	}
+
+	switch name {
+	case "multi":
+		if c.multi {
+			return errReply("ERR MULTI calls can not be nested")
+		}
+		c.multi, c.aborted, c.queued = true, false, nil
+		return ok
+	case "discard":
+		if !c.multi {
+			return errReply("ERR DISCARD without MULTI")
+		}
+		c.multi, c.queued, c.watched = false, nil, nil
+		return ok
+	case "exec":
+		return c.exec()
+	case "watch":
+		if c.multi {
+			return errReply("ERR WATCH inside MULTI is not allowed")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if c.watched == nil {
+			c.watched = map[string]uint64{}
+		}
+		for _, k := range args[1:] {
+			s.expire(k)
+			c.watched[k] = s.versions[k]
+		}
+		return ok
+	case "unwatch":
+		c.watched = nil
+		return ok
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return c.pubsub(name, args[1:])
+	case "ping":
+		if len(c.channels)+len(c.patterns) > 0 {
+			msg := ""
+			if len(args) > 1 {
+				msg = args[1]
+			}
+			return []interface{}{"pong", msg}
+		}
+	case "xreadgroup":
+		if !c.multi {
+			return c.xreadgroupBlocking(args[1:])
+		}
+	}
+
+	fn, known := commands[name]
+	if c.multi {
+		if !known {
+			c.aborted = true
+			return errReply(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		}
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+	if !known {
+		return errReply(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s, args[1:])
+}
+
+func (c *conn) exec() interface{} {
+	if !c.multi {
+		return errReply("ERR EXEC without MULTI")
+	}
+	queued, watched, aborted := c.queued, c.watched, c.aborted
+	c.multi, c.queued, c.watched, c.aborted = false, nil, nil, false
+	if aborted {
+		return errReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range watched {
+		s.expire(k)
+		if s.versions[k] != v {
+			return nilArray{}
+		}
+	}
+	out := make([]interface{}, len(queued))
+	for i, args := range queued {
+		out[i] = commands[strings.ToLower(args[0])](s, args[1:])
+	}
+	return out
+}
+
+// FlushAll empties the keyspace; subscriptions are kept.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.keys {
+		s.touch(k)
+	}
+	s.keys = map[string]*entry{}
+}
+
+// expire drops key if its TTL has passed.
+func (s *Server) expire(key string) {
+	e, found := s.keys[key]
+	if found && !e.expireAt.IsZero() && !s.now().Before(e.expireAt) {
+		delete(s.keys, key)
+		s.touch(key)
+	}
+}
+
+// lookup returns the live entry for key, or nil.
+func (s *Server) lookup(key string) *entry {
+	s.expire(key)
+	return s.keys[key]
+}
+
+// touch records a write to key for WATCH.
+func (s *Server) touch(key string) {
+	s.versions[key]++
+}
+
+// typed returns the entry for key if it has kind k. With create set a
+// missing key is created. A key of another kind yields errType.
+func (s *Server) typed(key string, k kind, create bool) (*entry, interface{}) {
+	e := s.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &entry{kind: k}
+		switch k {
+		case kindHash:
+			e.hash = map[string]string{}
+		case kindSet:
+			e.set = map[string]bool{}
+		case kindZSet:
+			e.zset = map[string]float64{}
+		case kindStream:
+			e.stream = newStream()
+		}
+		s.keys[key] = e
+		return e, nil
+	}
+	if e.kind != k {
+		return nil, errType
+	}
+	return e, nil
+}
+
+// dropIfEmpty deletes container keys that have no members left, as Redis
+// does. Streams survive being emptied.
+func (s *Server) dropIfEmpty(key string) {
+	e := s.keys[key]
+	if e == nil {
+		return
+	}
+	empty := false
+	switch e.kind {
+	case kindHash:
+		empty = len(e.hash) == 0
+	case kindSet:
+		empty = len(e.set) == 0
+	case kindZSet:
+		empty = len(e.zset) == 0
+	case kindList:
+		empty = len(e.list) == 0
+	}
+	if empty {
+		delete(s.keys, key)
+	}
+}
+
+// readCommand reads one RESP array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil // inline command
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("memredis: bad array header %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		h, err := readLine(rd)
+		if err != nil {
+			return nil, err
+		}
+		if len(h) == 0 || h[0] != '$' {
+			return nil, fmt.Errorf("memredis: bad bulk header %q", h)
+		}
+		size, err := strconv.Atoi(h[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("memredis: bad bulk length %q", h)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func encode(b *strings.Builder, v interface{}) {
+	switch t := v.(type) {
+	case status:
+		b.WriteString("+" + string(t) + "\r\n")
+	case errReply:
+		b.WriteString("-" + string(t) + "\r\n")
+	case int:
+		b.WriteString(":" + strconv.Itoa(t) + "\r\n")
+	case int64:
+		b.WriteString(":" + strconv.FormatInt(t, 10) + "\r\n")
+	case bool:
+		if t {
+			b.WriteString(":1\r\n")
+		} else {
+			b.WriteString(":0\r\n")
+		}
+	case string:
+		b.WriteString("$" + strconv.Itoa(len(t)) + "\r\n" + t + "\r\n")
+	case float64:
+		encode(b, formatFloat(t))
+	case nil:
+		b.WriteString("$-1\r\n")
+	case nilArray:
+		b.WriteString("*-1\r\n")
+	case []string:
+		b.WriteString("*" + strconv.Itoa(len(t)) + "\r\n")
+		for _, e := range t {
+			encode(b, e)
+		}
+	case []interface{}:
+		b.WriteString("*" + strconv.Itoa(len(t)) + "\r\n")
+		for _, e := range t {
+			encode(b, e)
+		}
+	default:
+		encode(b, errReply(fmt.Sprintf("ERR memredis cannot encode %T", v)))
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
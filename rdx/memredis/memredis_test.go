@@ -0,0 +1,158 @@
+package memredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStringsAndKeys(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	defer c.Close()
+
+	if err := c.Set(ctx, "a", "1", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c.SetNX(ctx, "a", "2", time.Minute).Result(); ok {
+		t.Error("SetNX on an existing key succeeded")
+	}
+	if ok, _ := c.SetNX(ctx, "b", "2", time.Minute).Result(); !ok {
+		t.Error("SetNX on a new key failed")
+	}
+	if n, _ := c.Incr(ctx, "a").Result(); n != 2 {
+		t.Errorf("Incr = %d, want 2", n)
+	}
+	if ttl, _ := c.TTL(ctx, "b").Result(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL = %v", ttl)
+	}
+	if _, err := c.Get(ctx, "missing").Result(); !errors.Is(err, redis.Nil) {
+		t.Errorf("Get missing = %v, want redis.Nil", err)
+	}
+
+	var keys []string
+	iter := c.Scan(ctx, 0, "*", 1).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if iter.Err() != nil || len(keys) != 2 {
+		t.Errorf("Scan = %v, %v", keys, iter.Err())
+	}
+}
+
+func TestSortedSets(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	defer c.Close()
+
+	c.ZAdd(ctx, "z", redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"})
+	got, err := c.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "-inf", Max: "2", Count: 10}).Result()
+	if err != nil || len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("ZRangeByScore = %v, %v", got, err)
+	}
+	if rev, _ := c.ZRevRange(ctx, "z", 0, 0).Result(); len(rev) != 1 || rev[0] != "c" {
+		t.Errorf("ZRevRange = %v", rev)
+	}
+	if n, _ := c.ZRem(ctx, "z", "a", "nope").Result(); n != 1 {
+		t.Errorf("ZRem = %d, want 1", n)
+	}
+}
+
+func TestWatchDetectsConflicts(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	defer c.Close()
+	c.Set(ctx, "k", "v", 0)
+
+	err := c.Watch(ctx, func(tx *redis.Tx) error {
+		// Another client writes between WATCH and EXEC.
+		c.Set(ctx, "k", "other", 0)
+		_, err := tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, "k")
+			return nil
+		})
+		return err
+	}, "k")
+	if !errors.Is(err, redis.TxFailedErr) {
+		t.Errorf("Watch = %v, want TxFailedErr", err)
+	}
+	if v, _ := c.Get(ctx, "k").Result(); v != "other" {
+		t.Errorf("k = %q, want the concurrent write kept", v)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.Subscribe(ctx, "news")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.Publish(ctx, "news", "hello").Result(); n != 1 {
+		t.Fatalf("Publish reached %d subscribers, want 1", n)
+	}
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != "hello" {
+			t.Errorf("payload = %q", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestStreamConsumerGroups(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	defer c.Close()
+
+	if err := c.XGroupCreateMkStream(ctx, "s", "g", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.XGroupCreateMkStream(ctx, "s", "g", "0").Err(); err == nil {
+		t.Error("second group create succeeded, want BUSYGROUP")
+	}
+
+	// A blocked reader is woken by XADD.
+	got := make(chan []redis.XStream, 1)
+	go func() {
+		res, _ := c.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group: "g", Consumer: "c1", Streams: []string{"s", ">"}, Count: 10, Block: 2 * time.Second,
+		}).Result()
+		got <- res
+	}()
+	time.Sleep(50 * time.Millisecond)
+	id := c.XAdd(ctx, &redis.XAddArgs{Stream: "s", MaxLen: 100, Approx: true, Values: map[string]interface{}{"k": "v"}}).Val()
+
+	res := <-got
+	if len(res) != 1 || len(res[0].Messages) != 1 || res[0].Messages[0].ID != id {
+		t.Fatalf("XReadGroup = %+v", res)
+	}
+
+	pending, _ := c.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: "s", Group: "g", Start: "-", End: "+", Count: 10}).Result()
+	if len(pending) != 1 || pending[0].Consumer != "c1" {
+		t.Fatalf("XPendingExt = %+v", pending)
+	}
+	claimed, _ := c.XClaim(ctx, &redis.XClaimArgs{Stream: "s", Group: "g", Consumer: "c2", Messages: []string{id}}).Result()
+	if len(claimed) != 1 {
+		t.Fatalf("XClaim = %+v", claimed)
+	}
+	if n, _ := c.XAck(ctx, "s", "g", id).Result(); n != 1 {
+		t.Errorf("XAck = %d, want 1", n)
+	}
+	groups, err := c.XInfoGroups(ctx, "s").Result()
+	if err != nil || len(groups) != 1 || groups[0].Pending != 0 {
+		t.Errorf("XInfoGroups = %+v, %v", groups, err)
+	}
+
+	_, err = c.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: "c1", Streams: []string{"s", ">"}, Block: 10 * time.Millisecond}).Result()
+	if !errors.Is(err, redis.Nil) {
+		t.Errorf("empty XReadGroup = %v, want redis.Nil", err)
+	}
+}
@@ -0,0 +1,164 @@
+package memredis
+
+// noReply tells serve that the handler already sent its replies.
+type noReply struct{}
+
+// pubsub handles (P)SUBSCRIBE and (P)UNSUBSCRIBE. Each channel gets its
+// own confirmation, so replies are sent directly. The caller holds s.mu.
+func (c *conn) pubsub(name string, args []string) interface{} {
+	s := c.srv
+	if c.channels == nil {
+		c.channels, c.patterns = map[string]bool{}, map[string]bool{}
+	}
+	count := func() int { return len(c.channels) + len(c.patterns) }
+
+	switch name {
+	case "subscribe", "psubscribe":
+		if len(args) == 0 {
+			return errArgs(name)
+		}
+		mine, all := c.channels, s.subs
+		if name == "psubscribe" {
+			mine, all = c.patterns, s.psubs
+		}
+		for _, ch := range args {
+			mine[ch] = true
+			if all[ch] == nil {
+				all[ch] = map[*conn]bool{}
+			}
+			all[ch][c] = true
+			c.send([]interface{}{name, ch, count()})
+		}
+	case "unsubscribe", "punsubscribe":
+		mine, all := c.channels, s.subs
+		if name == "punsubscribe" {
+			mine, all = c.patterns, s.psubs
+		}
+		if len(args) == 0 {
+			for ch := range mine {
+				args = append(args, ch)
+			}
+			if len(args) == 0 {
+				c.send([]interface{}{name, nil, count()})
+			}
+		}
+		for _, ch := range args {
+			delete(mine, ch)
+			delete(all[ch], c)
+			if len(all[ch]) == 0 {
+				delete(all, ch)
+			}
+			c.send([]interface{}{name, ch, count()})
+		}
+	}
+	return noReply{}
+}
+
+// unsubscribeAll drops every subscription of a closing connection. The
+// caller holds s.mu.
+func (c *conn) unsubscribeAll() {
+	for ch := range c.channels {
+		delete(c.srv.subs[ch], c)
+		if len(c.srv.subs[ch]) == 0 {
+			delete(c.srv.subs, ch)
+		}
+	}
+	for p := range c.patterns {
+		delete(c.srv.psubs[p], c)
+		if len(c.srv.psubs[p]) == 0 {
+			delete(c.srv.psubs, p)
+		}
+	}
+}
+
+func cmdPublish(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errArgs("publish")
+	}
+	ch, msg := args[0], args[1]
+	n := 0
+	for c := range s.subs[ch] {
+		c.send([]interface{}{"message", ch, msg})
+		n++
+	}
+	for p, conns := range s.psubs {
+		if !globMatch(p, ch) {
+			continue
+		}
+		for c := range conns {
+			c.send([]interface{}{"pmessage", p, ch, msg})
+			n++
+		}
+	}
+	return n
+}
+
+// globMatch implements Redis glob patterns: *, ?, [abc], [^a-z] and \x.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			end := 1
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end == len(pattern) {
+				return false
+			}
+			class := pattern[1:end]
+			negate := len(class) > 0 && class[0] == '^'
+			if negate {
+				class = class[1:]
+			}
+			hit := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if s[0] >= class[i] && s[0] <= class[i+2] {
+						hit = true
+					}
+					i += 2
+					continue
+				}
+				if class[i] == s[0] {
+					hit = true
+				}
+			}
+			if hit == negate {
+				return false
+			}
+			pattern, s = pattern[end+1:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
@@ -0,0 +1,706 @@
+package memredis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type streamID struct{ ms, seq uint64 }
+
+func (id streamID) String() string { return fmt.Sprintf("%d-%d", id.ms, id.seq) }
+
+func (id streamID) less(o streamID) bool {
+	return id.ms < o.ms || (id.ms == o.ms && id.seq < o.seq)
+}
+
+var maxID = streamID{math.MaxUint64, math.MaxUint64}
+
+// parseID parses "ms-seq" or "ms"; a bare ms takes seq as the low or high
+// end depending on high. "-" and "+" are the extremes.
+func parseID(s string, high bool) (streamID, bool) {
+	switch s {
+	case "-":
+		return streamID{}, true
+	case "+":
+		return maxID, true
+	}
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	id := streamID{ms: ms}
+	if !hasSeq {
+		if high {
+			id.seq = math.MaxUint64
+		}
+		return id, true
+	}
+	if id.seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+		return streamID{}, false
+	}
+	return id, true
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+type pendingEntry struct {
+	consumer  string
+	delivered time.Time
+	count     int
+}
+
+type group struct {
+	last      streamID
+	read      int // entries delivered through ">"
+	pending   map[streamID]*pendingEntry
+	consumers map[string]bool
+}
+
+type stream struct {
+	entries []streamEntry
+	last    streamID
+	added   int
+	groups  map[string]*group
+}
+
+func newStream() *stream {
+	return &stream{groups: map[string]*group{}}
+}
+
+func (st *stream) find(id streamID) (int, bool) {
+	i := sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].id.less(id) })
+	return i, i < len(st.entries) && st.entries[i].id == id
+}
+
+func entryReply(e streamEntry) []interface{} {
+	return []interface{}{e.id.String(), e.fields}
+}
+
+func (st *stream) trim(maxLen int) int {
+	if maxLen < 0 || len(st.entries) <= maxLen {
+		return 0
+	}
+	n := len(st.entries) - maxLen
+	st.entries = append([]streamEntry(nil), st.entries[n:]...)
+	return n
+}
+
+// notify wakes blocked XREADGROUP callers. The caller holds s.mu.
+func (s *Server) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func (s *Server) stream(key string, create bool) (*stream, interface{}) {
+	e, err := s.typed(key, kindStream, create)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.stream, nil
+}
+
+// cmdXAdd supports XADD key [NOMKSTREAM] [MAXLEN [=|~] n] [LIMIT n] *|id field value ...
+func cmdXAdd(s *Server, args []string) interface{} {
+	if len(args) < 4 {
+		return errArgs("xadd")
+	}
+	key := args[0]
+	maxLen, noMk := -1, false
+	i := 1
+opts:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nomkstream":
+			noMk = true
+		case "maxlen":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				i++
+			}
+			if i >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return errInt
+			}
+			maxLen = n
+		case "limit":
+			i++
+		default:
+			break opts
+		}
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return errArgs("xadd")
+	}
+	if noMk && s.lookup(key) == nil {
+		return nil
+	}
+	st, err := s.stream(key, true)
+	if err != nil {
+		return err
+	}
+
+	var id streamID
+	if args[i] == "*" {
+		now := uint64(s.now().UnixMilli())
+		id = streamID{ms: now}
+		if !st.last.less(id) {
+			id = streamID{ms: st.last.ms, seq: st.last.seq + 1}
+		}
+	} else {
+		var valid bool
+		if id, valid = parseID(args[i], false); !valid {
+			return errReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		if !st.last.less(id) {
+			return errReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+	st.entries = append(st.entries, streamEntry{id: id, fields: append([]string(nil), args[i+1:]...)})
+	st.last = id
+	st.added++
+	st.trim(maxLen)
+	s.touch(key)
+	s.notify()
+	return id.String()
+}
+
+func cmdXLen(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errArgs("xlen")
+	}
+	st, err := s.stream(args[0], false)
+	if err != nil || st == nil {
+		return orZero(err)
+	}
+	return len(st.entries)
+}
+
+func cmdXDel(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("xdel")
+	}
+	st, err := s.stream(args[0], false)
+	if err != nil || st == nil {
+		return orZero(err)
+	}
+	n := 0
+	for _, raw := range args[1:] {
+		id, valid := parseID(raw, false)
+		if !valid {
+			return errReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		if i, found := st.find(id); found {
+			st.entries = append(st.entries[:i:i], st.entries[i+1:]...)
+			n++
+		}
+	}
+	if n > 0 {
+		s.touch(args[0])
+	}
+	return n
+}
+
+func cmdXTrim(s *Server, args []string) interface{} {
+	if len(args) < 3 || strings.ToLower(args[1]) != "maxlen" {
+		return errSyntax
+	}
+	raw := args[2]
+	if (raw == "~" || raw == "=") && len(args) > 3 {
+		raw = args[3]
+	}
+	n, perr := strconv.Atoi(raw)
+	if perr != nil {
+		return errInt
+	}
+	st, err := s.stream(args[0], false)
+	if err != nil || st == nil {
+		return orZero(err)
+	}
+	removed := st.trim(n)
+	if removed > 0 {
+		s.touch(args[0])
+	}
+	return removed
+}
+
+// xrange implements XRANGE key start end [COUNT n] and XREVRANGE key end
+// start [COUNT n].
+func xrange(s *Server, name string, args []string, rev bool) interface{} {
+	if len(args) != 3 && len(args) != 5 {
+		return errArgs(name)
+	}
+	loRaw, hiRaw := args[1], args[2]
+	if rev {
+		loRaw, hiRaw = hiRaw, loRaw
+	}
+	lo, ok1 := parseID(loRaw, false)
+	hi, ok2 := parseID(hiRaw, true)
+	if !ok1 || !ok2 {
+		return errReply("ERR Invalid stream ID specified as stream command argument")
+	}
+	count := -1
+	if len(args) == 5 {
+		if strings.ToLower(args[3]) != "count" {
+			return errSyntax
+		}
+		n, err := strconv.Atoi(args[4])
+		if err != nil {
+			return errInt
+		}
+		count = n
+	}
+	st, err := s.stream(args[0], false)
+	if err != nil {
+		return err
+	}
+	out := []interface{}{}
+	if st == nil {
+		return out
+	}
+	var hits []streamEntry
+	for _, e := range st.entries {
+		if !e.id.less(lo) && !hi.less(e.id) {
+			hits = append(hits, e)
+		}
+	}
+	if rev {
+		for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 {
+			hits[i], hits[j] = hits[j], hits[i]
+		}
+	}
+	for _, e := range hits {
+		if count >= 0 && len(out) >= count {
+			break
+		}
+		out = append(out, entryReply(e))
+	}
+	return out
+}
+
+func cmdXGroup(s *Server, args []string) interface{} {
+	if len(args) < 1 {
+		return errArgs("xgroup")
+	}
+	sub := strings.ToLower(args[0])
+	switch sub {
+	case "create":
+		if len(args) < 4 {
+			return errArgs("xgroup|create")
+		}
+		key, name, rawID := args[1], args[2], args[3]
+		mk := len(args) > 4 && strings.ToLower(args[4]) == "mkstream"
+		if !mk && s.lookup(key) == nil {
+			return errReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		st, err := s.stream(key, true)
+		if err != nil {
+			return err
+		}
+		if _, exists := st.groups[name]; exists {
+			return errReply("BUSYGROUP Consumer Group name already exists")
+		}
+		start := st.last
+		if rawID != "$" {
+			var valid bool
+			if start, valid = parseID(rawID, false); !valid {
+				return errReply("ERR Invalid stream ID specified as stream command argument")
+			}
+		}
+		st.groups[name] = &group{last: start, pending: map[streamID]*pendingEntry{}, consumers: map[string]bool{}}
+		s.touch(key)
+		return ok
+	case "destroy":
+		if len(args) != 3 {
+			return errArgs("xgroup|destroy")
+		}
+		st, err := s.stream(args[1], false)
+		if err != nil || st == nil {
+			return orZero(err)
+		}
+		if _, exists := st.groups[args[2]]; !exists {
+			return 0
+		}
+		delete(st.groups, args[2])
+		s.touch(args[1])
+		return 1
+	}
+	return errReply(fmt.Sprintf("ERR unknown subcommand '%s'", args[0]))
+}
+
+type readGroupArgs struct {
+	group, consumer string
+	count           int
+	block           time.Duration // <0: do not block; 0: block forever
+	noAck           bool
+	keys, ids       []string
+}
+
+func parseReadGroup(args []string) (*readGroupArgs, interface{}) {
+	if len(args) < 6 || strings.ToLower(args[0]) != "group" {
+		return nil, errSyntax
+	}
+	a := &readGroupArgs{group: args[1], consumer: args[2], count: -1, block: -1}
+	i := 3
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "count", "block":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				return nil, errInt
+			}
+			if strings.ToLower(args[i]) == "count" {
+				a.count = n
+			} else {
+				a.block = time.Duration(n) * time.Millisecond
+			}
+			i++
+			continue
+		case "noack":
+			a.noAck = true
+			continue
+		case "streams":
+		default:
+			return nil, errSyntax
+		}
+		break
+	}
+	rest := args[i+1:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, errReply("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+	}
+	a.keys, a.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+	return a, nil
+}
+
+func cmdXReadGroup(s *Server, args []string) interface{} {
+	a, err := parseReadGroup(args)
+	if err != nil {
+		return err
+	}
+	return s.readGroup(a)
+}
+
+// readGroup serves one XREADGROUP attempt. It returns nilArray when there
+// is nothing new to deliver. The caller holds s.mu.
+func (s *Server) readGroup(a *readGroupArgs) interface{} {
+	var out []interface{}
+	for i, key := range a.keys {
+		st, err := s.stream(key, false)
+		if err != nil {
+			return err
+		}
+		var g *group
+		if st != nil {
+			g = st.groups[a.group]
+		}
+		if g == nil {
+			return errReply(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, a.group))
+		}
+		g.consumers[a.consumer] = true
+
+		var msgs []interface{}
+		if a.ids[i] == ">" {
+			for _, e := range st.entries {
+				if a.count > 0 && len(msgs) >= a.count {
+					break
+				}
+				if !g.last.less(e.id) {
+					continue
+				}
+				g.last = e.id
+				g.read++
+				if !a.noAck {
+					g.pending[e.id] = &pendingEntry{consumer: a.consumer, delivered: s.now(), count: 1}
+				}
+				msgs = append(msgs, entryReply(e))
+			}
+			if len(msgs) == 0 {
+				continue
+			}
+		} else {
+			// History: this consumer's pending entries after the given ID.
+			after, valid := parseID(a.ids[i], false)
+			if !valid {
+				return errReply("ERR Invalid stream ID specified as stream command argument")
+			}
+			msgs = []interface{}{}
+			for _, id := range g.sortedPending() {
+				p := g.pending[id]
+				if p.consumer != a.consumer || !after.less(id) {
+					continue
+				}
+				if a.count > 0 && len(msgs) >= a.count {
+					break
+				}
+				if j, found := st.find(id); found {
+					msgs = append(msgs, entryReply(st.entries[j]))
+				} else {
+					msgs = append(msgs, []interface{}{id.String(), nilArray{}})
+				}
+			}
+		}
+		out = append(out, []interface{}{key, msgs})
+		s.touch(key)
+	}
+	if len(out) == 0 {
+		return nilArray{}
+	}
+	return out
+}
+
+// xreadgroupBlocking runs XREADGROUP, waiting for new entries when BLOCK
+// was given and nothing is available yet.
+func (c *conn) xreadgroupBlocking(args []string) interface{} {
+	a, perr := parseReadGroup(args)
+	if perr != nil {
+		return perr
+	}
+	s := c.srv
+	var deadline <-chan time.Time
+	if a.block > 0 {
+		t := time.NewTimer(a.block)
+		defer t.Stop()
+		deadline = t.C
+	}
+	for {
+		s.mu.Lock()
+		r := s.readGroup(a)
+		wake := s.wake
+		s.mu.Unlock()
+		if _, empty := r.(nilArray); !empty || a.block < 0 {
+			return r
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			return nilArray{}
+		}
+	}
+}
+
+func (g *group) sortedPending() []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+func (s *Server) group(key, name string) (*stream, *group, interface{}) {
+	st, err := s.stream(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[name] == nil {
+		return nil, nil, errReply(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, name))
+	}
+	return st, st.groups[name], nil
+}
+
+func cmdXAck(s *Server, args []string) interface{} {
+	if len(args) < 3 {
+		return errArgs("xack")
+	}
+	st, err := s.stream(args[0], false)
+	if err != nil || st == nil || st.groups[args[1]] == nil {
+		return orZero(err)
+	}
+	g := st.groups[args[1]]
+	n := 0
+	for _, raw := range args[2:] {
+		id, valid := parseID(raw, false)
+		if !valid {
+			return errReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		if _, found := g.pending[id]; found {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	if n > 0 {
+		s.touch(args[0])
+	}
+	return n
+}
+
+// cmdXPending supports the summary form XPENDING key group and the
+// extended form XPENDING key group [IDLE ms] start end count [consumer].
+func cmdXPending(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errArgs("xpending")
+	}
+	_, g, err := s.group(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	ids := g.sortedPending()
+	now := s.now()
+
+	if len(args) == 2 {
+		if len(ids) == 0 {
+			return []interface{}{0, nil, nil, nilArray{}}
+		}
+		per := map[string]int{}
+		for _, id := range ids {
+			per[g.pending[id].consumer]++
+		}
+		names := make([]string, 0, len(per))
+		for n := range per {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		consumers := []interface{}{}
+		for _, n := range names {
+			consumers = append(consumers, []interface{}{n, strconv.Itoa(per[n])})
+		}
+		return []interface{}{len(ids), ids[0].String(), ids[len(ids)-1].String(), consumers}
+	}
+
+	rest := args[2:]
+	var minIdle time.Duration
+	if strings.ToLower(rest[0]) == "idle" {
+		if len(rest) < 2 {
+			return errSyntax
+		}
+		n, perr := strconv.ParseInt(rest[1], 10, 64)
+		if perr != nil {
+			return errInt
+		}
+		minIdle = time.Duration(n) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) < 3 {
+		return errSyntax
+	}
+	lo, ok1 := parseID(rest[0], false)
+	hi, ok2 := parseID(rest[1], true)
+	count, cerr := strconv.Atoi(rest[2])
+	if !ok1 || !ok2 || cerr != nil {
+		return errSyntax
+	}
+	consumer := ""
+	if len(rest) > 3 {
+		consumer = rest[3]
+	}
+	out := []interface{}{}
+	for _, id := range ids {
+		if len(out) >= count {
+			break
+		}
+		p := g.pending[id]
+		idle := now.Sub(p.delivered)
+		if id.less(lo) || hi.less(id) || idle < minIdle || (consumer != "" && p.consumer != consumer) {
+			continue
+		}
+		out = append(out, []interface{}{id.String(), p.consumer, idle.Milliseconds(), p.count})
+	}
+	return out
+}
+
+// cmdXClaim supports XCLAIM key group consumer min-idle id ... [JUSTID].
+// Other options are accepted and ignored.
+func cmdXClaim(s *Server, args []string) interface{} {
+	if len(args) < 5 {
+		return errArgs("xclaim")
+	}
+	st, g, err := s.group(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	consumer := args[2]
+	minMs, perr := strconv.ParseInt(args[3], 10, 64)
+	if perr != nil {
+		return errInt
+	}
+	minIdle := time.Duration(minMs) * time.Millisecond
+
+	var ids []streamID
+	justID := false
+	for _, raw := range args[4:] {
+		if strings.ToLower(raw) == "justid" {
+			justID = true
+			continue
+		}
+		if id, valid := parseID(raw, false); valid {
+			ids = append(ids, id)
+		}
+	}
+
+	now := s.now()
+	out := []interface{}{}
+	for _, id := range ids {
+		p, found := g.pending[id]
+		if !found || now.Sub(p.delivered) < minIdle {
+			continue
+		}
+		j, exists := st.find(id)
+		if !exists {
+			delete(g.pending, id)
+			continue
+		}
+		p.consumer, p.delivered = consumer, now
+		if !justID {
+			p.count++
+			out = append(out, entryReply(st.entries[j]))
+		} else {
+			out = append(out, id.String())
+		}
+		g.consumers[consumer] = true
+	}
+	if len(out) > 0 {
+		s.touch(args[0])
+	}
+	return out
+}
+
+func cmdXInfo(s *Server, args []string) interface{} {
+	if len(args) != 2 || strings.ToLower(args[0]) != "groups" {
+		return errReply("ERR memredis supports only XINFO GROUPS key")
+	}
+	st, err := s.stream(args[1], false)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return errReply("ERR no such key")
+	}
+	names := make([]string, 0, len(st.groups))
+	for n := range st.groups {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	out := []interface{}{}
+	for _, n := range names {
+		g := st.groups[n]
+		lag := 0
+		for _, e := range st.entries {
+			if g.last.less(e.id) {
+				lag++
+			}
+		}
+		out = append(out, []interface{}{
+			"name", n,
+			"consumers", len(g.consumers),
+			"pending", len(g.pending),
+			"last-delivered-id", g.last.String(),
+			"entries-read", g.read,
+			"lag", lag,
+		})
+	}
+	return out
+}
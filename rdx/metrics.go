@@ -0,0 +1,53 @@
+package rdx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"naevis/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var redisErrors = metrics.NewCounterVec("naevis_redis_errors_total",
+	"Redis commands that failed, by command. Cache misses (redis.Nil) are not errors.", "command")
+
+// metricsHook counts failed commands on the shared client.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			redisErrors.Inc("dial")
+		}
+		return conn, err
+	}
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		countErr(cmd, err)
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			countErr(cmd, cmd.Err())
+		}
+		return err
+	}
+}
+
+func countErr(cmd redis.Cmder, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	redisErrors.Inc(strings.ToLower(cmd.Name()))
+}
@@ -3,21 +3,47 @@ package rdx
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
-	"github.com/joho/godotenv"
+	"naevis/config"
+
 	"github.com/redis/go-redis/v9"
 )
 
-var redis_url = os.Getenv("REDIS_URL")
-var Conn = redis.NewClient(&redis.Options{
-	Addr:     redis_url,
-	Password: os.Getenv("REDIS_PASSWORD"), // no password set
-	DB:       0,                           // use default DB
-})
+// Conn is the shared Redis client; it is nil until Open or Use runs.
+var Conn *redis.Client
+
+// Open creates the shared client from the loaded configuration and checks
+// that Redis answers. Call Close during shutdown.
+func Open(ctx context.Context, cfg config.Redis) error {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return fmt.Errorf("redis ping %s: %w", cfg.Addr, err)
+	}
+	Use(client)
+	return nil
+}
+
+// Use binds an existing client as the shared client and instruments it.
+func Use(client *redis.Client) {
+	if client != nil {
+		client.AddHook(metricsHook{})
+	}
+	Conn = client
+}
 
-func InitRedis() { godotenv.Load() }
+// Close closes the shared client.
+func Close() error {
+	if Conn == nil {
+		return nil
+	}
+	return Conn.Close()
+}
 
 func RdxSet(key, value string) error {
 
@@ -3,6 +3,7 @@ package recipes
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -49,7 +50,7 @@ func GetRecipes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	opts := options.Find().SetSort(sort).SetSkip(skip).SetLimit(limit)
 	recipes, err := utils.FindAndDecode[models.Recipe](ctx, db.RecipeCollection, filter, opts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch recipes")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch recipes")
 		return
 	}
 
@@ -60,7 +61,7 @@ func GetRecipes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	totalCount, err := db.RecipeCollection.CountDocuments(ctx, filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to count recipes")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to count recipes")
 		return
 	}
 
@@ -84,7 +85,7 @@ func GetRecipeTags(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	cursor, err := db.RecipeCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(ctx)
@@ -93,7 +94,7 @@ func GetRecipeTags(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		Tags []string `bson:"tags"`
 	}
 	if err := cursor.All(ctx, &result); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -3,6 +3,7 @@ package recipes
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/filemgr"
 	"naevis/models"
@@ -82,7 +83,7 @@ func GetRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var recipe models.Recipe
 	err := db.RecipeCollection.FindOne(context.TODO(), bson.M{"recipeid": id}).Decode(&recipe)
 	if err != nil {
-		http.Error(w, "Recipe not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Recipe not found")
 		return
 	}
 
@@ -95,7 +96,7 @@ func GetRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 func CreateRecipe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
@@ -163,7 +164,7 @@ func CreateRecipe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	imagePaths, err := filemgr.SaveFormFiles(r.MultipartForm, "imageUrls", filemgr.EntityType("recipe"), filemgr.PicPhoto, false)
 	if err != nil {
-		http.Error(w, "Image upload failed: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Image upload failed: "+err.Error())
 		return
 	}
 
@@ -192,18 +193,21 @@ func CreateRecipe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	normalizeRecipeSlices(&recipe)
 
-	_, err = db.RecipeCollection.InsertOne(context.TODO(), recipe)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.RecipeCollection.InsertOne(ctx, recipe); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "recipe-created", models.Index{
+			EntityType: "recipe",
+			EntityId:   recipe.RecipeId,
+			Method:     "POST",
+		})
+	})
 	if err != nil {
-		http.Error(w, "DB insert failed", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "DB insert failed")
 		return
 	}
 
-	go mq.Emit(ctx, "recipe-created", models.Index{
-		EntityType: "recipe",
-		EntityId:   recipe.RecipeId,
-		Method:     "POST",
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(recipe)
 }
@@ -213,7 +217,7 @@ func UpdateRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	id := ps.ByName("id")
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
@@ -280,28 +284,32 @@ func UpdateRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	if len(files) > 0 {
 		imagePaths, err := filemgr.SaveFormFiles(r.MultipartForm, "imageUrls", filemgr.EntityType("recipe"), filemgr.PicPhoto, false)
 		if err != nil {
-			http.Error(w, "Image upload failed: "+err.Error(), http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Image upload failed: "+err.Error())
 			return
 		}
 		updates["imageUrls"] = imagePaths
 	}
 
-	_, err := db.RecipeCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"recipeid": id},
-		bson.M{"$set": updates},
-	)
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := db.RecipeCollection.UpdateOne(
+			ctx,
+			bson.M{"recipeid": id},
+			bson.M{"$set": updates},
+		)
+		if err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "recipe-updated", models.Index{
+			EntityType: "recipe",
+			EntityId:   id,
+			Method:     "PUT",
+		})
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	go mq.Emit(ctx, "recipe-updated", models.Index{
-		EntityType: "recipe",
-		EntityId:   id,
-		Method:     "PUT",
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status":"updated"}`))
 }
@@ -309,17 +317,20 @@ func UpdateRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func DeleteRecipe(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	id := ps.ByName("id")
-	_, err := db.RecipeCollection.DeleteOne(context.TODO(), bson.M{"recipeid": id})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.RecipeCollection.DeleteOne(ctx, bson.M{"recipeid": id}); err != nil {
+			return err
+		}
+		return mq.Emit(ctx, "recipe-deleted", models.Index{
+			EntityType: "recipe",
+			EntityId:   id,
+			Method:     "DELETE",
+		})
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	go mq.Emit(ctx, "recipe-deleted", models.Index{
-		EntityType: "recipe",
-		EntityId:   id,
-		Method:     "DELETE",
-	})
-
 	w.Write([]byte(`{"status":"deleted"}`))
 }
@@ -2,13 +2,14 @@ package reports
 
 import (
 	"context"
+	"naevis/db"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func EnsureReportIndexes(coll *mongo.Collection) error {
+func EnsureReportIndexes(coll db.Collection) error {
 	indexModel := mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "reportedBy", Value: 1},
@@ -17,12 +18,9 @@ func EnsureReportIndexes(coll *mongo.Collection) error {
 		},
 		Options: options.Index().SetUnique(true),
 	}
-	_, err := coll.Indexes().CreateOne(context.Background(), indexModel)
-	return err
+	return db.CreateIndexes(context.Background(), coll, indexModel)
 }
 
-// Call this once at startup, e.g.:
-// err := ensureReportIndexes(db.ReportsCollection)
-// if err != nil { log.Fatal(err) }
+// Applied at startup by the migrations package (version 1).
 
 // This way, even if two requests slip through nearly concurrently, MongoDB itself will prevent a duplicate.\
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"naevis/utils"
@@ -35,10 +36,6 @@ func writeJSON(w http.ResponseWriter, v interface{}, status int) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func writeError(w http.ResponseWriter, msg string, status int) {
-	writeJSON(w, map[string]string{"error": msg}, status)
-}
-
 // -------------------------
 // 1) Submit a Report
 // -------------------------
@@ -47,7 +44,7 @@ func ReportContent(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	var payload models.Report
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeError(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -60,7 +57,7 @@ func ReportContent(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	payload.ParentID = stringTrim(payload.ParentID)
 
 	if payload.ReportedBy == "" || payload.TargetID == "" || payload.TargetType == "" || payload.Reason == "" {
-		writeError(w, "Missing required field", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing required field")
 		return
 	}
 
@@ -73,11 +70,11 @@ func ReportContent(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	var existing models.Report
 	err := db.ReportsCollection.FindOne(ctx, filter).Decode(&existing)
 	if err == nil {
-		writeError(w, "You have already reported this item", http.StatusConflict)
+		apierr.Respond(w, http.StatusConflict, "You have already reported this item")
 		return
 	}
 	if !errors.Is(err, mongo.ErrNoDocuments) {
-		writeError(w, "Error checking existing reports", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error checking existing reports")
 		return
 	}
 
@@ -89,7 +86,7 @@ func ReportContent(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 
 	res, err := db.ReportsCollection.InsertOne(ctx, payload)
 	if err != nil {
-		writeError(w, "Failed to save report", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to save report")
 		return
 	}
 
@@ -179,14 +176,14 @@ func GetReports(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	cursor, err := db.ReportsCollection.Find(ctx, filter, findOpts)
 	if err != nil {
-		writeError(w, "Failed to fetch reports", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch reports")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var reports []models.Report
 	if err := cursor.All(ctx, &reports); err != nil {
-		writeError(w, "Error processing reports", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error processing reports")
 		return
 	}
 	if reports == nil {
@@ -214,12 +211,12 @@ func UpdateReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	ctx := r.Context()
 	idParam := ps.ByName("id")
 	if idParam == "" {
-		writeError(w, "Missing report ID in URL", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing report ID in URL")
 		return
 	}
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
-		writeError(w, "Invalid report ID format", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid report ID format")
 		return
 	}
 
@@ -229,7 +226,7 @@ func UpdateReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		ReviewNotes string `json:"reviewNotes,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeError(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -237,7 +234,7 @@ func UpdateReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	payload.ReviewedBy = utils.GetUserIDFromRequest(r)
 	payload.ReviewNotes = stringTrim(payload.ReviewNotes)
 	if payload.Status == "" {
-		writeError(w, "Missing required field: status", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing required field: status")
 		return
 	}
 
@@ -260,11 +257,11 @@ func UpdateReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	resUpdate, err := db.ReportsCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		writeError(w, "Failed to update report", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update report")
 		return
 	}
 	if resUpdate.MatchedCount == 0 {
-		writeError(w, "Report not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Report not found")
 		return
 	}
 
@@ -282,22 +279,22 @@ func SoftDeleteEntity(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	entityType := stringTrim(ps.ByName("type"))
 	idParam := stringTrim(ps.ByName("id"))
 	if entityType == "" || idParam == "" {
-		writeError(w, "Missing type or id", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing type or id")
 		return
 	}
 
 	moderatorID := getActorID(r)
 	if moderatorID == "" {
-		writeError(w, "Missing moderator id in context", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Missing moderator id in context")
 		return
 	}
 
 	if err := setEntityDeletedFlag(ctx, entityType, idParam, true, moderatorID); err != nil {
 		if errors.Is(err, errEntityNotFound) {
-			writeError(w, "Entity not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Entity not found")
 			return
 		}
-		writeError(w, "Failed to soft-delete entity", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to soft-delete entity")
 		return
 	}
 
@@ -317,7 +314,7 @@ func CreateAppeal(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		Reason     string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeError(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -327,7 +324,7 @@ func CreateAppeal(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	payload.Reason = stringTrim(payload.Reason)
 
 	if payload.UserID == "" || payload.TargetType == "" || payload.TargetID == "" || payload.Reason == "" {
-		writeError(w, "Missing required field", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing required field")
 		return
 	}
 
@@ -341,11 +338,11 @@ func CreateAppeal(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var existing bson.M
 	err := db.AppealsCollection.FindOne(ctx, filter).Decode(&existing)
 	if err == nil {
-		writeError(w, "You already have a pending appeal for this content", http.StatusConflict)
+		apierr.Respond(w, http.StatusConflict, "You already have a pending appeal for this content")
 		return
 	}
 	if !errors.Is(err, mongo.ErrNoDocuments) {
-		writeError(w, "Failed checking existing appeals", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed checking existing appeals")
 		return
 	}
 
@@ -365,7 +362,7 @@ func CreateAppeal(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	res, err := db.AppealsCollection.InsertOne(ctx, appeal)
 	if err != nil {
-		writeError(w, "Failed to create appeal", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create appeal")
 		return
 	}
 
@@ -405,14 +402,14 @@ func GetAppeals(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	findOpts := options.Find().SetLimit(limit).SetSkip(offset).SetSort(bson.D{{Key: "createdAt", Value: -1}})
 	cursor, err := db.AppealsCollection.Find(ctx, filter, findOpts)
 	if err != nil {
-		writeError(w, "Failed to fetch appeals", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch appeals")
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var appeals []bson.M
 	if err := cursor.All(ctx, &appeals); err != nil {
-		writeError(w, "Error processing appeals", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error processing appeals")
 		return
 	}
 	if appeals == nil {
@@ -426,12 +423,12 @@ func UpdateAppeal(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	ctx := r.Context()
 	idParam := ps.ByName("id")
 	if idParam == "" {
-		writeError(w, "Missing appeal ID in URL", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing appeal ID in URL")
 		return
 	}
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
-		writeError(w, "Invalid appeal ID format", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid appeal ID format")
 		return
 	}
 
@@ -441,28 +438,28 @@ func UpdateAppeal(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		ReviewNotes string `json:"reviewNotes,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeError(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 	payload.Status = stringTrim(payload.Status)
 	payload.ReviewedBy = utils.GetUserIDFromRequest(r)
 	payload.ReviewNotes = stringTrim(payload.ReviewNotes)
 	if payload.Status == "" {
-		writeError(w, "Missing required field: status", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing required field: status")
 		return
 	}
 	if payload.Status != "approved" && payload.Status != "denied" {
-		writeError(w, "Invalid status; must be 'approved' or 'denied'", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid status; must be 'approved' or 'denied'")
 		return
 	}
 
 	var appeal bson.M
 	if err := db.AppealsCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&appeal); err != nil {
 		if err == mongo.ErrNoDocuments {
-			writeError(w, "Appeal not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Appeal not found")
 			return
 		}
-		writeError(w, "Failed fetching appeal", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed fetching appeal")
 		return
 	}
 
@@ -473,7 +470,7 @@ func UpdateAppeal(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		"updatedAt":   time.Now().UTC(),
 	}
 	if _, err := db.AppealsCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": updateFields}); err != nil {
-		writeError(w, "Failed to update appeal", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update appeal")
 		return
 	}
 
@@ -494,7 +491,7 @@ func UpdateAppeal(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func setEntityDeletedFlag(ctx context.Context, entityType, id string, deleted bool, by string) error {
 	now := time.Now().UTC()
 
-	var coll *mongo.Collection
+	var coll db.Collection
 	var idField string
 	var useObjectID bool
 
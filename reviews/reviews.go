@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -19,7 +20,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// var db.ReviewsCollection *mongo.Collection
+// var db.ReviewsCollection db.Collection
 
 // Reviews
 func GetReviews(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -37,7 +38,7 @@ func GetReviews(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	reviews, err := utils.FindAndDecode[models.Review](ctx, db.ReviewsCollection, filter, opts)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve reviews")
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to retrieve reviews")
 		return
 	}
 
@@ -51,7 +52,7 @@ func GetReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var review models.Review
 	err := db.ReviewsCollection.FindOne(context.TODO(), bson.M{"reviewid": reviewId}).Decode(&review)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Review not found: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Review not found: %v", err))
 		return
 	}
 	log.Println("get review : ", review)
@@ -65,7 +66,7 @@ func AddReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	userId, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok || userId == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	log.Println("dfdj")
@@ -81,18 +82,18 @@ func AddReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	})
 	if err != nil {
 		log.Printf("Error checking for existing review: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	if count > 0 {
-		http.Error(w, "You have already reviewed this entity", http.StatusConflict)
+		apierr.Respond(w, http.StatusConflict, "You have already reviewed this entity")
 		return
 	}
 
 	var review models.Review
 	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Rating < 1 || review.Rating > 5 || review.Comment == "" {
-		http.Error(w, "Invalid review data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid review data")
 		return
 	}
 
@@ -103,19 +104,22 @@ func AddReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// review.Date = time.Now().Format(time.RFC3339)
 	review.Date = time.Now()
 
-	inserted, err := db.ReviewsCollection.InsertOne(context.TODO(), review)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ReviewsCollection.InsertOne(ctx, review); err != nil {
+			return err
+		}
+		if err := userdata.SetUserDataTx(ctx, "review", review.ReviewID, userId, entityType, entityId); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "review", EntityId: review.ReviewID, Method: "POST", ItemId: entityId, ItemType: entityType}
+		return mq.Emit(ctx, "review-added", m)
+	})
 	if err != nil {
-		http.Error(w, "Failed to insert review: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to insert review: "+err.Error())
 		return
 	}
 
-	userdata.SetUserData("review", review.ReviewID, userId, entityType, entityId)
-
-	m := models.Index{EntityType: "review", EntityId: review.ReviewID, Method: "POST", ItemId: entityId, ItemType: entityType}
-	go mq.Emit(ctx, "review-added", m)
-
 	log.Println("review : ", review.ReviewID)
-	log.Println("inserted review : ", inserted)
 
 	w.WriteHeader(http.StatusCreated)
 }
@@ -129,34 +133,38 @@ func EditReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var review models.Review
 	err := db.ReviewsCollection.FindOne(context.TODO(), bson.M{"reviewid": reviewId}).Decode(&review)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Review not found: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Review not found: %v", err))
 		return
 	}
 
 	if review.UserID != userId && !isAdmin(r.Context()) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
 	var updatedFields map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&updatedFields); err != nil {
-		http.Error(w, "Invalid update data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid update data")
 		return
 	}
 
-	_, err = db.ReviewsCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"reviewid": reviewId},
-		bson.M{"$set": updatedFields},
-	)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := db.ReviewsCollection.UpdateOne(
+			ctx,
+			bson.M{"reviewid": reviewId},
+			bson.M{"$set": updatedFields},
+		)
+		if err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "review", EntityId: reviewId, Method: "PUT", ItemId: review.EntityID, ItemType: review.EntityType}
+		return mq.Emit(ctx, "review-edited", m)
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update Review: %v", err), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update Review: %v", err))
 		return
 	}
 
-	m := models.Index{EntityType: "review", EntityId: reviewId, Method: "PUT", ItemId: review.EntityID, ItemType: review.EntityType}
-	go mq.Emit(ctx, "review-edited", m)
-
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -169,26 +177,31 @@ func DeleteReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	var review models.Review
 	err := db.ReviewsCollection.FindOne(context.TODO(), bson.M{"reviewid": reviewId}).Decode(&review)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Review not found: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Review not found: %v", err))
 		return
 	}
 
 	if review.UserID != userId && !isAdmin(r.Context()) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		apierr.Respond(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
-	_, err = db.ReviewsCollection.DeleteOne(context.TODO(), bson.M{"reviewid": reviewId})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.ReviewsCollection.DeleteOne(ctx, bson.M{"reviewid": reviewId}); err != nil {
+			return err
+		}
+		// The user data belongs to the review's author, not necessarily the caller.
+		if err := userdata.DelUserDataTx(ctx, "review", reviewId, review.UserID); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "review", EntityId: reviewId, Method: "DELETE", ItemId: review.EntityID, ItemType: review.EntityType}
+		return mq.Emit(ctx, "review-deleted", m)
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete review: %v", err), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete review: %v", err))
 		return
 	}
 
-	userdata.DelUserData("review", reviewId, userId)
-
-	m := models.Index{EntityType: "review", EntityId: reviewId, Method: "DELETE", ItemId: review.EntityID, ItemType: review.EntityType}
-	go mq.Emit(ctx, "review-deleted", m)
-
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -1,9 +1,13 @@
 package routes
 
 import (
+	"naevis/gateway"
+	"naevis/menu"
+	"naevis/merch"
 	"naevis/middleware"
 	"naevis/pay"
 	"naevis/ratelim"
+	"naevis/tickets"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -15,6 +19,7 @@ func AddPayRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 
 	// Register resolvers (if using DI for repositories/services)
 	payService.RegisterDefaultResolvers()
+	payService.RegisterDefaultRefundPolicies()
 
 	// Wallet routes
 	router.GET("/api/v1/wallet/balance",
@@ -27,42 +32,48 @@ func AddPayRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 
 	router.POST("/api/v1/wallet/topup",
 		middleware.Chain(
-			rateLimiter.Limit,
+			rateLimiter.Policy("payments"),
 			middleware.Authenticate,
 			middleware.RequireRoles("user"),
-			middleware.WithTxn, // ensures transaction is started
 		)(payService.TopUp),
 	)
 
 	router.POST("/api/v1/wallet/pay",
 		middleware.Chain(
-			rateLimiter.Limit,
+			rateLimiter.Policy("payments"),
 			middleware.Authenticate,
 			middleware.RequireRoles("user"),
-			middleware.WithTxn,
 		)(payService.Pay),
 	)
 
-	// Transfer & Refund
+	// Transfer & Refund. Refunds are for the merchant of what was paid
+	// for or an admin; Refund checks which.
 	router.POST("/api/v1/wallet/transfer",
 		middleware.Chain(
-			rateLimiter.Limit,
+			rateLimiter.Policy("payments"),
 			middleware.Authenticate,
 			middleware.RequireRoles("user"),
-			middleware.WithTxn,
 		)(payService.Transfer),
 	)
 
 	router.POST("/api/v1/wallet/refund",
 		middleware.Chain(
-			rateLimiter.Limit,
+			rateLimiter.Policy("payments"),
 			middleware.Authenticate,
-			middleware.RequireRoles("user"),
-			middleware.WithTxn,
+			middleware.RequireRoles("user", "admin"),
 		)(payService.Refund),
 	)
 
-	// List transactions (no txn wrapper needed, only reads)
+	// Move money between the caller's wallets in different currencies
+	router.POST("/api/v1/wallet/convert",
+		middleware.Chain(
+			rateLimiter.Policy("payments"),
+			middleware.Authenticate,
+			middleware.RequireRoles("user"),
+		)(payService.Convert),
+	)
+
+	// List transactions
 	router.GET("/api/v1/wallet/transactions",
 		middleware.Chain(
 			rateLimiter.Limit,
@@ -70,4 +81,36 @@ func AddPayRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 			middleware.RequireRoles("user"),
 		)(payService.ListTransactions),
 	)
+
+	// Admin-only: ledger reconciliation and balance repairs
+	router.GET("/api/v1/admin/wallet/reconciliations",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.ListReconciliations)))
+	router.POST("/api/v1/admin/wallet/reconciliations",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.RunReconciliation)))
+	router.GET("/api/v1/admin/wallet/reconciliations/:id",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.GetReconciliation)))
+	router.POST("/api/v1/admin/wallet/reconciliations/:id/repair",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.RepairBalances)))
+	router.GET("/api/v1/admin/wallet/repairs",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.ListBalanceRepairs)))
+
+	// Admin-only: exchange rates used by wallet conversions
+	router.GET("/api/v1/admin/wallet/rates",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.ListRates)))
+	router.PUT("/api/v1/admin/wallet/rates/:base/:quote",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.SetRate)))
+	router.DELETE("/api/v1/admin/wallet/rates/:base/:quote",
+		middleware.Authenticate(middleware.RequireRoles("admin")(pay.DeleteRate)))
+
+	// Card checkouts: fulfilment once the provider's webhook confirms
+	// payment, and the fake provider's hosted pages when it is enabled
+	gateway.RegisterFulfiller(gateway.KindTicket, tickets.FulfilCheckout)
+	gateway.RegisterFulfiller(gateway.KindSeat, tickets.FulfilSeatCheckout)
+	gateway.RegisterFulfiller(gateway.KindMerch, merch.FulfilCheckout)
+	gateway.RegisterFulfiller(gateway.KindMenu, menu.FulfilCheckout)
+	router.POST("/api/v1/payments/webhook/:provider", rateLimiter.Limit(gateway.Webhook))
+	router.GET("/api/v1/checkouts/:id", rateLimiter.Limit(middleware.Authenticate(gateway.GetCheckout)))
+	router.GET("/api/v1/payments/fake/checkout/:session", rateLimiter.Limit(gateway.FakeCheckoutPage))
+	router.POST("/api/v1/payments/fake/checkout/:session/pay", rateLimiter.Policy("payments")(gateway.FakePay))
+	router.POST("/api/v1/payments/fake/checkout/:session/cancel", rateLimiter.Policy("payments")(gateway.FakeCancel))
 }
@@ -30,6 +30,7 @@ import (
 	"naevis/metadata"
 	"naevis/middleware"
 	"naevis/moderator"
+	"naevis/mq"
 	"naevis/places"
 	"naevis/posts"
 	"naevis/products"
@@ -38,6 +39,7 @@ import (
 	"naevis/recipes"
 	"naevis/reports"
 	"naevis/reviews"
+	"naevis/scheduler"
 	"naevis/search"
 	"naevis/settings"
 	"naevis/suggestions"
@@ -124,6 +126,80 @@ func AddAdminRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 			),
 		),
 	)
+
+	// Admin-only: event bus inspection and dead-letter replay
+	router.GET("/api/v1/admin/mq/streams",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				mq.GetStreams,
+			),
+		),
+	)
+	router.GET("/api/v1/admin/mq/dead/:stream",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				mq.GetDeadLetters,
+			),
+		),
+	)
+	router.POST("/api/v1/admin/mq/dead/:stream/:id/replay",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				mq.ReplayDeadLetter,
+			),
+		),
+	)
+	router.DELETE("/api/v1/admin/mq/dead/:stream/:id",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				mq.DiscardDeadLetter,
+			),
+		),
+	)
+	router.GET("/api/v1/admin/mq/outbox",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				mq.GetOutboxStats,
+			),
+		),
+	)
+
+	// Admin-only: background job scheduler
+	router.GET("/api/v1/admin/jobs",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				scheduler.GetJobs,
+			),
+		),
+	)
+	router.GET("/api/v1/admin/jobs/:name/runs",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				scheduler.GetJobRuns,
+			),
+		),
+	)
+	router.POST("/api/v1/admin/jobs/:name/trigger",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				scheduler.TriggerJob,
+			),
+		),
+	)
+	router.POST("/api/v1/admin/jobs/:name/pause",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				scheduler.PauseJob,
+			),
+		),
+	)
+	router.POST("/api/v1/admin/jobs/:name/resume",
+		middleware.Authenticate(
+			middleware.RequireRoles("admin")(
+				scheduler.ResumeJob,
+			),
+		),
+	)
 }
 
 func AddJobRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -273,7 +349,7 @@ func AddReportRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter
 
 func AddCommentsRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 	// Create comment
-	router.POST("/api/v1/comments/:entitytype/:entityid", rateLimiter.Limit(middleware.Authenticate(comments.CreateComment)))
+	router.POST("/api/v1/comments/:entitytype/:entityid", rateLimiter.Limit(middleware.Authenticate(middleware.RequireVerified(comments.CreateComment))))
 
 	// Get comments for an entity (supports pagination/sorting via query params)
 	router.GET("/api/v1/comments/:entitytype/:entityid", comments.GetComments) // Public
@@ -286,12 +362,36 @@ func AddCommentsRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimit
 }
 
 func AddAuthRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
-	router.POST("/api/v1/auth/register", rateLimiter.Limit(auth.Register))
-	router.POST("/api/v1/auth/login", rateLimiter.Limit(auth.Login))
+	router.GET("/.well-known/jwks.json", rateLimiter.Limit(auth.JWKS))
+	router.POST("/api/v1/auth/register", rateLimiter.Policy("auth")(auth.Register))
+	router.POST("/api/v1/auth/login", rateLimiter.Policy("auth")(auth.Login))
+	router.POST("/api/v1/auth/refresh", rateLimiter.Policy("auth")(auth.RefreshToken))
 	router.POST("/api/v1/auth/logout", middleware.Authenticate(auth.LogoutUser))
 
-	router.POST("/api/v1/auth/verify-otp", rateLimiter.Limit(auth.VerifyOTPHandler))
-	// router.POST("/api/v1/auth/request-otp", rateLimiter.Limit(auth.RequestOTPHandler)) // FIX: Should request OTP, not verify
+	router.GET("/api/v1/auth/sessions", rateLimiter.Limit(middleware.Authenticate(auth.ListSessions)))
+	router.DELETE("/api/v1/auth/sessions", rateLimiter.Policy("auth")(middleware.Authenticate(auth.RevokeAllSessions)))
+	router.DELETE("/api/v1/auth/sessions/:id", rateLimiter.Policy("auth")(middleware.Authenticate(auth.RevokeSession)))
+
+	router.POST("/api/v1/auth/verify-otp", rateLimiter.Policy("auth")(auth.VerifyOTPHandler))
+	router.POST("/api/v1/auth/request-otp", rateLimiter.Policy("auth")(auth.RequestOTPHandler))
+
+	router.POST("/api/v1/auth/password/forgot", rateLimiter.Policy("auth")(auth.ForgotPasswordHandler))
+	router.POST("/api/v1/auth/password/reset", rateLimiter.Policy("auth")(auth.ResetPasswordHandler))
+	router.POST("/api/v1/auth/password/change", rateLimiter.Policy("auth")(middleware.Authenticate(auth.ChangePasswordHandler)))
+
+	router.POST("/api/v1/auth/mfa/challenge/enroll", rateLimiter.Policy("auth")(auth.EnrollChallengeHandler))
+	router.POST("/api/v1/auth/mfa/challenge/verify", rateLimiter.Policy("auth")(auth.VerifyChallengeHandler))
+	router.GET("/api/v1/auth/mfa", rateLimiter.Limit(middleware.Authenticate(auth.MFAStatus)))
+	router.POST("/api/v1/auth/mfa/totp/setup", rateLimiter.Policy("auth")(middleware.Authenticate(auth.SetupTOTP)))
+	router.POST("/api/v1/auth/mfa/totp/enable", rateLimiter.Policy("auth")(middleware.Authenticate(auth.EnableTOTP)))
+	router.POST("/api/v1/auth/mfa/disable", rateLimiter.Policy("auth")(middleware.Authenticate(auth.DisableMFA)))
+	router.POST("/api/v1/auth/mfa/recovery-codes", rateLimiter.Policy("auth")(middleware.Authenticate(auth.RegenerateRecoveryCodes)))
+
+	router.POST("/api/v1/auth/oidc/:provider/start", rateLimiter.Policy("auth")(auth.OIDCStart))
+	router.POST("/api/v1/auth/oidc/:provider/link", rateLimiter.Policy("auth")(middleware.Authenticate(auth.OIDCLinkStart)))
+	router.POST("/api/v1/auth/oidc/:provider/callback", rateLimiter.Policy("auth")(auth.OIDCCallback))
+	router.GET("/api/v1/auth/identities", rateLimiter.Limit(middleware.Authenticate(auth.ListIdentities)))
+	router.DELETE("/api/v1/auth/identities/:provider", rateLimiter.Policy("auth")(middleware.Authenticate(auth.UnlinkIdentity)))
 }
 
 func AddBookingRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -334,13 +434,13 @@ func AddCartRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	router.POST("/api/v1/cart", rateLimiter.Limit(middleware.Authenticate(cart.AddToCart)))
 	router.GET("/api/v1/cart", middleware.Authenticate(cart.GetCart))
 	router.POST("/api/v1/cart/update", rateLimiter.Limit(middleware.Authenticate(cart.UpdateCart)))
-	router.POST("/api/v1/cart/checkout", rateLimiter.Limit(middleware.Authenticate(cart.InitiateCheckout)))
+	router.POST("/api/v1/cart/checkout", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(cart.InitiateCheckout))))
 
 	// Checkout session creation
-	router.POST("/api/v1/checkout/session", rateLimiter.Limit(middleware.Authenticate(cart.CreateCheckoutSession)))
+	router.POST("/api/v1/checkout/session", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(cart.CreateCheckoutSession))))
 
 	// Order placement
-	router.POST("/api/v1/order", rateLimiter.Limit(middleware.Authenticate(cart.PlaceOrder)))
+	router.POST("/api/v1/order", rateLimiter.Limit(middleware.Authenticate(middleware.RequireVerified(cart.PlaceOrder))))
 
 	router.POST("/api/v1/coupon/validate", rateLimiter.Limit(middleware.Authenticate(cart.ValidateCouponHandler)))
 
@@ -358,7 +458,7 @@ func RegisterFarmRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimi
 	router.POST("/api/v1/farms/:id/crops", rateLimiter.Limit(middleware.Authenticate(farms.AddCrop)))
 	router.PUT("/api/v1/farms/:id/crops/:cropid", rateLimiter.Limit(middleware.Authenticate(farms.EditCrop)))
 	router.DELETE("/api/v1/farms/:id/crops/:cropid", rateLimiter.Limit(middleware.Authenticate(dels.DeleteCrop)))
-	router.PUT("/api/v1/farms/:id/crops/:cropid/buy", rateLimiter.Limit(middleware.Authenticate(farms.BuyCrop)))
+	router.PUT("/api/v1/farms/:id/crops/:cropid/buy", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(farms.BuyCrop))))
 
 	// 📊 Dashboard
 	router.GET("/api/v1/dash/farms", middleware.Authenticate(farms.GetFarmDash))
@@ -395,16 +495,13 @@ func RegisterFarmRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimi
 	router.DELETE("/api/v1/farm/tool/:id", rateLimiter.Limit(middleware.Authenticate(dels.DeleteTool)))
 
 	// 🖼 Upload
-	router.POST("/api/v1/upload/images", rateLimiter.Limit(middleware.Authenticate(utils.UploadImages)))
+	router.POST("/api/v1/upload/images", rateLimiter.Policy("upload")(middleware.Authenticate(utils.UploadImages)))
 }
 
 func AddMerchRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 	// Create merch
 	router.POST("/api/v1/merch/:entityType/:eventid", rateLimiter.Limit(middleware.Authenticate(merch.CreateMerch)))
 
-	// Buy merch
-	router.POST("/api/v1/merch/:entityType/:eventid/:merchid/buy", rateLimiter.Limit(middleware.Authenticate(merch.BuyMerch)))
-
 	// Public view
 	router.GET("/api/v1/merch/:entityType/:eventid", merch.GetMerchs)
 	router.GET("/api/v1/merch/:entityType/:eventid/:merchid", merch.GetMerch)
@@ -415,8 +512,8 @@ func AddMerchRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	router.DELETE("/api/v1/merch/:entityType/:eventid/:merchid", rateLimiter.Limit(middleware.Authenticate(dels.DeleteMerch)))
 
 	// Payment flows
-	router.POST("/api/v1/merch/:entityType/:eventid/:merchid/payment-session", rateLimiter.Limit(middleware.Authenticate(merch.CreateMerchPaymentSession)))
-	router.POST("/api/v1/merch/:entityType/:eventid/:merchid/confirm-purchase", rateLimiter.Limit(middleware.Authenticate(merch.ConfirmMerchPurchase)))
+	router.POST("/api/v1/merch/:entityType/:eventid/:merchid/payment-session", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(merch.CreateMerchPaymentSession))))
+	router.POST("/api/v1/merch/:entityType/:eventid/:merchid/confirm-purchase", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(merch.ConfirmMerchPurchase))))
 }
 
 func AddTicketRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -427,13 +524,9 @@ func AddTicketRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter
 	router.PUT("/api/v1/ticket/event/:eventid/:ticketid", rateLimiter.Limit(middleware.Authenticate(tickets.EditTicket)))
 	router.DELETE("/api/v1/ticket/event/:eventid/:ticketid", rateLimiter.Limit(middleware.Authenticate(dels.DeleteTicket)))
 
-	// Buying
-	router.POST("/api/v1/ticket/event/:eventid/:ticketid/buy", rateLimiter.Limit(middleware.Authenticate(tickets.BuyTicket)))
-	router.POST("/api/v1/tickets/book", rateLimiter.Limit(middleware.Authenticate(tickets.BuysTicket)))
-
 	// Payment flows
-	router.POST("/api/v1/ticket/event/:eventid/:ticketid/payment-session", rateLimiter.Limit(middleware.Authenticate(tickets.CreateTicketPaymentSession)))
-	router.POST("/api/v1/ticket/event/:eventid/:ticketid/confirm-purchase", rateLimiter.Limit(middleware.Authenticate(tickets.ConfirmTicketPurchase)))
+	router.POST("/api/v1/ticket/event/:eventid/:ticketid/payment-session", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(tickets.CreateTicketPaymentSession))))
+	router.POST("/api/v1/ticket/event/:eventid/:ticketid/confirm-purchase", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(tickets.ConfirmTicketPurchase))))
 
 	// Verification/printing
 	router.GET("/api/v1/ticket/verify/:eventid", rateLimiter.Limit(tickets.VerifyTicket))
@@ -446,7 +539,8 @@ func AddTicketRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter
 	router.GET("/api/v1/seats/:eventid/available-seats", rateLimiter.Limit(tickets.GetAvailableSeats))
 	router.POST("/api/v1/seats/:eventid/lock-seats", rateLimiter.Limit(middleware.Authenticate(tickets.LockSeats)))
 	router.POST("/api/v1/seats/:eventid/unlock-seats", rateLimiter.Limit(middleware.Authenticate(tickets.UnlockSeats)))
-	router.POST("/api/v1/seats/:eventid/ticket/:ticketid/confirm-purchase", rateLimiter.Limit(middleware.Authenticate(tickets.ConfirmSeatPurchase)))
+	router.POST("/api/v1/seats/:eventid/ticket/:ticketid/payment-session", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(tickets.CreateSeatPaymentSession))))
+	router.POST("/api/v1/seats/:eventid/ticket/:ticketid/confirm-purchase", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(tickets.ConfirmSeatPurchase))))
 	router.GET("/api/v1/ticket/event/:eventid/:ticketid/seats", rateLimiter.Limit(tickets.GetTicketSeats))
 }
 
@@ -491,7 +585,7 @@ func AddPostRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	// Public read
 	router.GET("/api/v1/posts/post/:id", rateLimiter.Limit(posts.GetPost))
 	router.GET("/api/v1/posts", rateLimiter.Limit(posts.GetAllPosts))
-	router.POST("/api/v1/posts/upload", rateLimiter.Limit(posts.UploadImage))
+	router.POST("/api/v1/posts/upload", rateLimiter.Policy("upload")(posts.UploadImage))
 
 	// Authenticated write
 	router.POST("/api/v1/posts/post", rateLimiter.Limit(middleware.Authenticate(posts.CreatePost)))
@@ -519,10 +613,9 @@ func AddPlaceRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	router.PUT("/api/v1/places/menu/:placeid/:menuid", rateLimiter.Limit(middleware.Authenticate(menu.EditMenu)))
 	router.DELETE("/api/v1/places/menu/:placeid/:menuid", rateLimiter.Limit(middleware.Authenticate(dels.DeleteMenu)))
 
-	// Buying & payment flows
-	router.POST("/api/v1/places/menu/:placeid/:menuid/buy", rateLimiter.Limit(middleware.Authenticate(menu.BuyMenu)))
-	router.POST("/api/v1/places/menu/:placeid/:menuid/payment-session", rateLimiter.Limit(middleware.Authenticate(menu.CreateMenuPaymentSession)))
-	router.POST("/api/v1/places/menu/:placeid/:menuid/confirm-purchase", rateLimiter.Limit(middleware.Authenticate(menu.ConfirmMenuPurchase)))
+	// Payment flows
+	router.POST("/api/v1/places/menu/:placeid/:menuid/payment-session", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(menu.CreateMenuPaymentSession))))
+	router.POST("/api/v1/places/menu/:placeid/:menuid/confirm-purchase", rateLimiter.Policy("payments")(middleware.Authenticate(middleware.RequireVerified(menu.ConfirmMenuPurchase))))
 }
 
 func AddProfileRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -593,7 +686,7 @@ func AddItineraryRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimi
 	// Public
 	router.GET("/api/v1/itineraries", rateLimiter.Limit(itinerary.GetItineraries))
 	router.GET("/api/v1/itineraries/all/:id", rateLimiter.Limit(itinerary.GetItinerary))
-	router.GET("/api/v1/itineraries/search", rateLimiter.Limit(itinerary.SearchItineraries))
+	router.GET("/api/v1/itineraries/search", rateLimiter.Policy("search")(itinerary.SearchItineraries))
 
 	// Authenticated write
 	router.POST("/api/v1/itineraries", rateLimiter.Limit(middleware.Authenticate(itinerary.CreateItinerary)))
@@ -615,12 +708,12 @@ func AddFeedRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	router.GET("/api/v1/feed/feed", rateLimiter.Limit(middleware.Authenticate(feed.GetPosts)))
 	router.GET("/api/v1/feed/media/:entityType/:entityId", rateLimiter.Limit(middleware.Authenticate(feed.GetPosts)))
 
-	router.POST("/api/v1/feed/post", rateLimiter.Limit(middleware.Authenticate(feed.CreateFeedPost)))
+	router.POST("/api/v1/feed/post", rateLimiter.Limit(middleware.Authenticate(middleware.RequireVerified(feed.CreateFeedPost))))
 	router.DELETE("/api/v1/feed/post/:postid", rateLimiter.Limit(middleware.Authenticate(dels.DeletePost)))
 
 	// NEW
 	router.PATCH("/api/v1/feed/post/:postid", rateLimiter.Limit(middleware.Authenticate(feed.EditPost)))
-	router.POST("/api/v1/feed/post/:postid/subtitles/:lang", rateLimiter.Limit(middleware.Authenticate(filedrop.UploadSubtitle)))
+	router.POST("/api/v1/feed/post/:postid/subtitles/:lang", rateLimiter.Policy("upload")(middleware.Authenticate(filedrop.UploadSubtitle)))
 }
 
 // func AddFeedRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -646,8 +739,8 @@ func AddAdsRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 
 func AddSearchRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
 	router.GET("/api/v1/ac", rateLimiter.Limit(search.Autocompleter))
-	router.GET("/api/v1/search/:entityType", rateLimiter.Limit(search.SearchHandler))
-	router.POST("/api/v1/emitted", rateLimiter.Limit(search.EventHandler))
+	router.GET("/api/v1/search/:entityType", rateLimiter.Policy("search")(search.SearchHandler))
+	router.POST("/api/v1/emitted", rateLimiter.Limit(mq.EventHandler))
 }
 
 func AddBannerRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
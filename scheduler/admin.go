@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+
+	"naevis/apierr"
+	"naevis/db"
+	"naevis/pagination"
+	"naevis/utils"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetJobs lists registered jobs with their schedule and state.
+// GET /api/v1/admin/jobs
+func GetJobs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	list, err := Jobs(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read job state")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"jobs": list})
+}
+
+// runSort lists runs newest first; _id breaks ties.
+var runSort = pagination.Sort{Field: "started_at", IDField: "_id", Desc: true}
+
+// GetJobRuns pages through the run history of a job.
+// GET /api/v1/admin/jobs/:name/runs?limit=&cursor=
+func GetJobRuns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if _, ok := lookup(name); !ok {
+		apierr.Respond(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	page, err := pagination.Parse(r, 20, 100)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	ctx := r.Context()
+	cur, err := db.JobRunsCollection.Find(ctx, runSort.Filter(bson.M{"job": name}, page.After), runSort.FindOptions(page.Limit))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read job runs")
+		return
+	}
+	var runs []RunRecord
+	if err := cur.All(ctx, &runs); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "failed to read job runs")
+		return
+	}
+
+	runs, next := pagination.Trim(runs, page.Limit, func(run RunRecord) pagination.Cursor {
+		return pagination.Cursor{Key: run.StartedAt, ID: run.ID}
+	})
+	utils.RespondWithJSON(w, http.StatusOK, pagination.NewPage(runs, next))
+}
+
+// TriggerJob queues an immediate run of a job.
+// POST /api/v1/admin/jobs/:name/trigger
+func TriggerJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if !respondJobError(w, Trigger(r.Context(), name)) {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusAccepted, map[string]any{"triggered": name})
+}
+
+// PauseJob stops a job's schedule until it is resumed.
+// POST /api/v1/admin/jobs/:name/pause
+func PauseJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if !respondJobError(w, Pause(r.Context(), name)) {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"paused": name})
+}
+
+// ResumeJob restarts a paused job's schedule.
+// POST /api/v1/admin/jobs/:name/resume
+func ResumeJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if !respondJobError(w, Resume(r.Context(), name)) {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{"resumed": name})
+}
+
+// respondJobError writes err, if any, and reports whether the handler
+// should go on.
+func respondJobError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnknownJob):
+		apierr.Respond(w, http.StatusNotFound, "unknown job")
+	default:
+		apierr.Write(w, apierr.Internal(err))
+	}
+	return false
+}
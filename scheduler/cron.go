@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule yields the activation times of a recurring job.
+type Schedule interface {
+	// Next returns the first activation strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule accepts a standard five-field cron expression
+// ("minute hour day-of-month month day-of-week", evaluated in UTC), one of
+// the shorthands @hourly, @daily, @weekly and @monthly, or "@every <dur>"
+// for sub-minute intervals.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("scheduler: bad interval in %q", spec)
+		}
+		return every(d.Truncate(time.Second)), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduler: %q needs 5 fields, got %d", spec, len(fields))
+	}
+	var c cron
+	var err error
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	sets := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		if *sets[i], err = parseField(f, bounds[i][0], bounds[i][1]); err != nil {
+			return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+		}
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return c, nil
+}
+
+// every fires on whole multiples of d (as time.Truncate rounds), so all
+// instances agree on the activation times without coordinating.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// cron holds one bit per allowed value of each field.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func (c cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Five years covers every valid expression, including Feb 29.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, either
+// one matching is enough.
+func (c cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func has(set uint64, v int) bool { return set&(1<<uint(v)) != 0 }
+
+// parseField parses a comma-separated list of "*", "n", "a-b", each with
+// an optional "/step".
+func parseField(f string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			step = n
+		}
+
+		from, to := lo, hi
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err1, err2 error
+			from, err1 = strconv.Atoi(a)
+			to, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			from, to = n, n
+			if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
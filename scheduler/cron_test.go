@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 8-17/3 * * *", time.Date(2024, 1, 31, 11, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1,5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either may match.
+		{"0 0 15 * 4", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 30s", time.Date(2024, 1, 31, 10, 8, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextIsStrictlyAfter(t *testing.T) {
+	s, _ := ParseSchedule("0 * * * *")
+	at := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	if got := s.Next(at); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("Next(%v) = %v, want an hour later", at, got)
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "@every 10ms", "@every soon",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+// Package scheduler runs periodic and delayed background jobs.
+//
+// Recurring jobs fire on a cron schedule; one-shot jobs are queued with
+// After and fire at a given time. Every instance runs the scheduler loop,
+// and Redis decides which one executes each activation: a recurring
+// activation is claimed with SET NX, a delayed entry by whoever removes it
+// from the queue, and non-concurrent jobs additionally hold a per-job lock
+// while they run. Every execution is recorded in the job_runs collection.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"naevis/db"
+	"naevis/metrics"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys.
+const (
+	delayedKey = "sched:delayed" // zset of queued entries scored by due time (ms)
+	pausedKey  = "sched:paused"  // set of paused job names
+	lockPrefix = "sched:lock:"   // per-job run lock, value is the holder
+	slotPrefix = "sched:slot:"   // per-activation claim of recurring jobs
+)
+
+const (
+	pollInterval   = time.Second
+	delayedBatch   = 50
+	defaultTimeout = 5 * time.Minute
+	// slotTTL only has to outlast clock skew between instances.
+	slotTTL = 10 * time.Minute
+)
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerDelayed  = "delayed"
+	TriggerManual   = "manual"
+)
+
+// Run outcomes.
+const (
+	StatusOK      = "ok"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// Func is the body of a job. payload is what After was given, or nil for
+// scheduled and manual runs.
+type Func func(ctx context.Context, payload json.RawMessage) error
+
+// Job describes a registered job.
+type Job struct {
+	Name string
+	// Schedule is a cron spec (see ParseSchedule). Jobs without one only
+	// run when queued with After or triggered by an admin.
+	Schedule string
+	// Timeout bounds a run and is the lifetime of its lock. Default 5m.
+	Timeout time.Duration
+	// Concurrent jobs skip the per-job lock. Use it for one-shot jobs whose
+	// runs act on distinct payloads and may overlap.
+	Concurrent bool
+	Run        Func
+
+	schedule Schedule
+	next     time.Time
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+)
+
+var (
+	runsTotal = metrics.NewCounterVec("naevis_scheduler_runs_total",
+		"Job executions by job and status.", "job", "status")
+	runDuration = metrics.NewHistogramVec("naevis_scheduler_run_duration_seconds",
+		"Job execution time.", nil, "job")
+)
+
+// Register adds a job. It panics on a duplicate name or a bad schedule so
+// mistakes surface at startup.
+func Register(j Job) {
+	if j.Name == "" || j.Run == nil {
+		panic("scheduler: job needs a name and a Run func")
+	}
+	if j.Timeout <= 0 {
+		j.Timeout = defaultTimeout
+	}
+	if j.Schedule != "" {
+		s, err := ParseSchedule(j.Schedule)
+		if err != nil {
+			panic(err)
+		}
+		j.schedule = s
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if _, dup := jobs[j.Name]; dup {
+		panic("scheduler: duplicate job " + strconv.Quote(j.Name))
+	}
+	jobs[j.Name] = &j
+}
+
+func lookup(name string) (*Job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j, ok := jobs[name]
+	return j, ok
+}
+
+// entry is a queued one-shot run.
+type entry struct {
+	ID      string          `json:"id"`
+	Job     string          `json:"job"`
+	Trigger string          `json:"trigger"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// After queues a one-shot run of the named job at the given time with
+// payload marshalled to JSON. The job must be registered by the time the
+// entry comes due, on whichever instance picks it up.
+func After(ctx context.Context, name string, at time.Time, payload any) error {
+	var raw json.RawMessage
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("scheduler: marshal %s payload: %w", name, err)
+		}
+		raw = b
+	}
+	return enqueue(ctx, entry{ID: utils.GetUUID(), Job: name, Trigger: TriggerDelayed, Payload: raw}, at)
+}
+
+// Trigger queues an immediate run of the named job. Paused jobs run too;
+// pausing only stops the schedule.
+func Trigger(ctx context.Context, name string) error {
+	if _, ok := lookup(name); !ok {
+		return ErrUnknownJob
+	}
+	return enqueue(ctx, entry{ID: utils.GetUUID(), Job: name, Trigger: TriggerManual}, time.Now())
+}
+
+// ErrUnknownJob is returned for a job name that was never registered.
+var ErrUnknownJob = errors.New("scheduler: unknown job")
+
+func enqueue(ctx context.Context, e entry, at time.Time) error {
+	member, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return rdx.Conn.ZAdd(ctx, delayedKey, redis.Z{Score: float64(at.UnixMilli()), Member: member}).Err()
+}
+
+// Pause stops scheduled activations of a job on every instance.
+func Pause(ctx context.Context, name string) error {
+	if _, ok := lookup(name); !ok {
+		return ErrUnknownJob
+	}
+	return rdx.Conn.SAdd(ctx, pausedKey, name).Err()
+}
+
+// Resume undoes Pause.
+func Resume(ctx context.Context, name string) error {
+	if _, ok := lookup(name); !ok {
+		return ErrUnknownJob
+	}
+	return rdx.Conn.SRem(ctx, pausedKey, name).Err()
+}
+
+// Run drives the scheduler until ctx is cancelled, then waits for the jobs
+// it started to finish.
+func Run(ctx context.Context) {
+	s := &runner{owner: instanceName()}
+	log.Printf("[Scheduler] started (%s)", s.owner)
+
+	now := time.Now()
+	jobsMu.Lock()
+	for _, j := range jobs {
+		if j.schedule != nil {
+			j.next = j.schedule.Next(now)
+		}
+	}
+	jobsMu.Unlock()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		mq.Heartbeat("scheduler")
+		s.fireDue(ctx, time.Now())
+		s.drainDelayed(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type runner struct {
+	owner string
+	wg    sync.WaitGroup
+}
+
+// fireDue starts every recurring job whose activation time has passed.
+func (s *runner) fireDue(ctx context.Context, now time.Time) {
+	var due []*Job
+	var slots []time.Time
+	jobsMu.Lock()
+	for _, j := range jobs {
+		if j.schedule == nil || j.next.After(now) {
+			continue
+		}
+		due = append(due, j)
+		slots = append(slots, j.next)
+		j.next = j.schedule.Next(now)
+	}
+	jobsMu.Unlock()
+
+	for i, j := range due {
+		paused, err := rdx.Conn.SIsMember(ctx, pausedKey, j.Name).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[Scheduler] %s: paused check failed: %v", j.Name, err)
+			}
+			continue
+		}
+		if paused {
+			continue
+		}
+		slot := slotPrefix + j.Name + ":" + strconv.FormatInt(slots[i].Unix(), 10)
+		claimed, err := rdx.Conn.SetNX(ctx, slot, s.owner, slotTTL).Result()
+		if err != nil || !claimed {
+			continue
+		}
+		s.start(ctx, j, TriggerSchedule, nil)
+	}
+}
+
+// drainDelayed claims due entries from the queue. ZREM succeeds on exactly
+// one instance, which then owns the entry.
+func (s *runner) drainDelayed(ctx context.Context, now time.Time) {
+	members, err := rdx.Conn.ZRangeByScore(ctx, delayedKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: delayedBatch,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[Scheduler] reading delayed queue: %v", err)
+		}
+		return
+	}
+
+	for _, m := range members {
+		removed, err := rdx.Conn.ZRem(ctx, delayedKey, m).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal([]byte(m), &e); err != nil {
+			log.Printf("[Scheduler] dropping malformed entry %q: %v", m, err)
+			continue
+		}
+		j, ok := lookup(e.Job)
+		if !ok {
+			log.Printf("[Scheduler] dropping entry %s for unknown job %q", e.ID, e.Job)
+			continue
+		}
+		s.start(ctx, j, e.Trigger, e.Payload)
+	}
+}
+
+func (s *runner) start(ctx context.Context, j *Job, trigger string, payload json.RawMessage) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(ctx, j, trigger, payload)
+	}()
+}
+
+// execute runs one activation under the job lock and records it.
+func (s *runner) execute(ctx context.Context, j *Job, trigger string, payload json.RawMessage) {
+	run := RunRecord{
+		ID:        utils.GetUUID(),
+		Job:       j.Name,
+		Trigger:   trigger,
+		Instance:  s.owner,
+		StartedAt: time.Now().UTC(),
+	}
+
+	token := s.owner + "/" + run.ID
+	if !j.Concurrent {
+		ok, err := rdx.Conn.SetNX(ctx, lockPrefix+j.Name, token, j.Timeout).Result()
+		if err != nil || !ok {
+			run.Status = StatusSkipped
+			run.Error = "previous run still in progress"
+			if err != nil {
+				run.Error = err.Error()
+			}
+			s.record(run)
+			return
+		}
+		defer s.unlock(j.Name, token)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, j.Timeout)
+	err := safeRun(runCtx, j.Run, payload)
+	cancel()
+
+	run.FinishedAt = time.Now().UTC()
+	run.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Status = StatusOK
+	if err != nil {
+		run.Status = StatusError
+		run.Error = err.Error()
+		log.Printf("[Scheduler] %s (%s) failed: %v", j.Name, trigger, err)
+	}
+	runDuration.ObserveSince(run.StartedAt, j.Name)
+	s.record(run)
+}
+
+func safeRun(ctx context.Context, fn Func, payload json.RawMessage) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return fn(ctx, payload)
+}
+
+// unlock releases the job lock if this run still holds it. WATCH makes the
+// check and delete atomic against another instance taking the lock after
+// it expired.
+func (s *runner) unlock(name, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := lockPrefix + name
+	err := rdx.Conn.Watch(ctx, func(tx *redis.Tx) error {
+		holder, err := tx.Get(ctx, key).Result()
+		if err != nil || holder != token {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("[Scheduler] %s: releasing lock: %v", name, err)
+	}
+}
+
+// record stores a run in the history. It uses its own context so runs
+// interrupted by shutdown are still recorded.
+func (s *runner) record(run RunRecord) {
+	runsTotal.Inc(run.Job, run.Status)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := db.JobRunsCollection.InsertOne(ctx, run); err != nil {
+		log.Printf("[Scheduler] recording %s run: %v", run.Job, err)
+	}
+}
+
+// RunRecord is one execution in the job history.
+type RunRecord struct {
+	ID         string    `bson:"_id" json:"id"`
+	Job        string    `bson:"job" json:"job"`
+	Trigger    string    `bson:"trigger" json:"trigger"`
+	Instance   string    `bson:"instance" json:"instance"`
+	Status     string    `bson:"status" json:"status"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// JobInfo is the admin view of a registered job.
+type JobInfo struct {
+	Name       string     `json:"name"`
+	Schedule   string     `json:"schedule,omitempty"`
+	Timeout    string     `json:"timeout"`
+	Concurrent bool       `json:"concurrent"`
+	Paused     bool       `json:"paused"`
+	Running    bool       `json:"running"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+// Jobs lists the registered jobs, sorted by name.
+func Jobs(ctx context.Context) ([]JobInfo, error) {
+	paused, err := rdx.Conn.SMembers(ctx, pausedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	isPaused := make(map[string]bool, len(paused))
+	for _, p := range paused {
+		isPaused[p] = true
+	}
+
+	jobsMu.Lock()
+	out := make([]JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		info := JobInfo{
+			Name:       j.Name,
+			Schedule:   j.Schedule,
+			Timeout:    j.Timeout.String(),
+			Concurrent: j.Concurrent,
+			Paused:     isPaused[j.Name],
+		}
+		if !j.next.IsZero() {
+			next := j.next
+			info.NextRun = &next
+		}
+		out = append(out, info)
+	}
+	jobsMu.Unlock()
+
+	for i := range out {
+		n, err := rdx.Conn.Exists(ctx, lockPrefix+out[i].Name).Result()
+		if err != nil {
+			return nil, err
+		}
+		out[i].Running = n > 0
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out, nil
+}
+
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "naevis"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
@@ -3,7 +3,8 @@ package search
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"naevis/apierr"
 	"naevis/rdx"
 	"net/http"
 	"strings"
@@ -76,20 +77,20 @@ func GetAutocompleteSuggestions(ctx context.Context, prefix string, limit int, t
 func Autocompleter(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
 	if prefix == "" {
-		http.Error(w, "Search prefix is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Search prefix is required")
 		return
 	}
 
 	results, err := GetAutocompleteSuggestions(r.Context(), strings.ToLower(prefix), 20, time.Minute)
 	if err != nil {
-		log.Printf("Autocompleter error: %v", err)
-		http.Error(w, "Error retrieving autocomplete suggestions", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "autocomplete failed", "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Error retrieving autocomplete suggestions")
 		return
 	}
 
 	data, err := json.Marshal(results)
 	if err != nil {
-		http.Error(w, "Error encoding autocomplete results", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error encoding autocomplete results")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4,9 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"naevis/db"
 	"naevis/models"
+	"naevis/pagination"
 	"reflect"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -19,36 +20,29 @@ import (
 // -------------------------
 
 func SaveEntityToDB(ctx context.Context, entity Entity) error {
-	log.Printf("[SaveEntityToDB] START entity=%+v", entity)
-	coll := db.Client.Database("naevis").Collection("search")
+	coll := db.SearchIndexCollection
 	_, err := coll.UpdateOne(ctx,
 		bson.M{"entityid": entity.EntityID, "entitytype": entity.EntityType},
 		bson.M{"$set": entity},
 		options.Update().SetUpsert(true),
 	)
-	log.Printf("[SaveEntityToDB] END err=%v", err)
 	return err
 }
 
 func FetchEntityFromSearchDB(ctx context.Context, id string) (Entity, error) {
-	log.Printf("[FetchEntityFromSearchDB] START id=%q", id)
 	var ent Entity
-	err := db.Client.Database("naevis").Collection("search").
+	err := db.SearchIndexCollection.
 		FindOne(ctx, bson.M{"entityid": id}).Decode(&ent)
-	log.Printf("[FetchEntityFromSearchDB] END entity=%+v err=%v", ent, err)
 	return ent, err
 }
 
 func FetchAndDecode(ctx context.Context, collectionName string, filter bson.M, out interface{}) error {
-	log.Printf("[FetchAndDecode] START collection=%q filter=%v", collectionName, filter)
 	projection, exists := Projections[collectionName]
 	if !exists {
 		projection = bson.M{}
 	}
-	log.Printf("[FetchAndDecode] projection=%v", projection)
 	opts := options.FindOne().SetProjection(projection)
-	err := db.Client.Database("eventdb").Collection(collectionName).FindOne(ctx, filter, opts).Decode(out)
-	log.Printf("[FetchAndDecode] END err=%v", err)
+	err := db.CollectionByName(collectionName).FindOne(ctx, filter, opts).Decode(out)
 	return err
 }
 
@@ -56,23 +50,21 @@ func FetchAndDecode(ctx context.Context, collectionName string, filter bson.M, o
 // Search fetching
 // -------------------------
 
-func fetchOne[T any](ctx context.Context, coll *mongo.Collection, idField string, id string) (T, error) {
+func fetchOne[T any](ctx context.Context, coll db.Collection, idField string, id string) (T, error) {
 	var doc T
 	err := coll.FindOne(ctx, bson.M{idField: id}).Decode(&doc)
 	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
-		log.Printf("[fetchOne] Error fetching ID=%v: %v", id, err)
+		slog.WarnContext(ctx, "search fetch failed", "id", id, "error", err)
 	}
 	return doc, err
 }
 
-func fetchResults[T any](ctx context.Context, query string, limit int, coll *mongo.Collection, entityType string) ([]T, error) {
+func fetchResults[T any](ctx context.Context, query string, limit int, coll db.Collection, entityType string) ([]T, error) {
 	ids, err := GetIndexResults(ctx, query, limit)
 	if err != nil || len(ids) == 0 {
 		return nil, err
 	}
 
-	log.Println("[fetchResults] ids:", ids)
-
 	// Filter by both entityid and entitytype
 	filter := bson.M{
 		"entityid":   bson.M{"$in": ids},
@@ -83,20 +75,17 @@ func fetchResults[T any](ctx context.Context, query string, limit int, coll *mon
 		return nil, err
 	}
 	defer cur.Close(ctx)
-	log.Println("[fetchResults] cursor:", cur)
 
 	var results []T
 	if err := cur.All(ctx, &results); err != nil {
 		return nil, err
 	}
-	log.Println("[fetchResults] results:", results)
 
 	// Preserve Redis order
 	idIndex := make(map[string]int, len(ids))
 	for i, id := range ids {
 		idIndex[fmt.Sprint(id)] = i
 	}
-	log.Println("[fetchResults] idIndex:", idIndex)
 
 	ordered := make([]T, len(results))
 	count := 0
@@ -111,7 +100,6 @@ func fetchResults[T any](ctx context.Context, query string, limit int, coll *mon
 			}
 		}
 	}
-	log.Println("[fetchResults] ordered:", ordered)
 
 	final := make([]T, 0, count)
 	for _, doc := range ordered {
@@ -119,7 +107,6 @@ func fetchResults[T any](ctx context.Context, query string, limit int, coll *mon
 			final = append(final, doc)
 		}
 	}
-	log.Println("[fetchResults] final:", final)
 	return final, nil
 }
 
@@ -127,17 +114,60 @@ func isZero[T any](v T) bool {
 	return reflect.ValueOf(v).IsZero()
 }
 
-func GetResultsOfType(ctx context.Context, entityType, query string, limit int) (interface{}, error) {
-	log.Printf("entityType: %s, query: %s, limit: %d", entityType, query, limit)
+// maxRankedResults bounds how many ranked matches a query considers; pages
+// are cut from this list.
+const maxRankedResults = 1000
+
+// GetResultsOfType returns one page of ranked matches of entityType for
+// query, starting after the cursor, plus the cursor for the next page.
+func GetResultsOfType(ctx context.Context, entityType, query string, after *pagination.Cursor, limit int) ([]Entity, string, error) {
 	allowedTypes := []string{
 		"songs", "users", "recipes", "products", "blogposts", "feedposts",
 		"places", "merch", "menu", "media", "farms", "events", "crops",
 		"baitoworkers", "baitos", "artists",
 	}
 	if !contains(allowedTypes, entityType) {
-		return nil, nil
+		return nil, "", nil
+	}
+	ranked, err := fetchResults[Entity](ctx, query, maxRankedResults, db.SearchIndexCollection, entityType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := resumeAt(ranked, after)
+	if start >= len(ranked) {
+		return nil, "", nil
+	}
+	end := min(start+limit, len(ranked))
+	page := ranked[start:end]
+
+	next := ""
+	if end < len(ranked) {
+		next = pagination.Cursor{Key: int64(end), ID: page[len(page)-1].EntityID}.Encode()
+	}
+	return page, next, nil
+}
+
+// resumeAt finds where the next page starts. Search cursors hold the rank
+// offset and the last entity returned; resuming after that entity keeps
+// pages aligned when results ahead of it were added or removed.
+func resumeAt(ranked []Entity, after *pagination.Cursor) int {
+	if after == nil {
+		return 0
+	}
+	for i, e := range ranked {
+		if e.EntityID == after.ID {
+			return i + 1
+		}
+	}
+	var off int
+	switch k := after.Key.(type) {
+	case int64:
+		off = int(k)
+	case int32:
+		off = int(k)
 	}
-	return fetchResults[Entity](ctx, query, limit, db.Client.Database("naevis").Collection("search"), entityType)
+	return max(off, 0)
 }
 
 func contains(slice []string, s string) bool {
@@ -150,7 +180,6 @@ func contains(slice []string, s string) bool {
 }
 
 func GetResultsByTypeRaw(ctx context.Context, entityType, id string) (interface{}, error) {
-	log.Printf("[GetResultsByTypeRaw] START entityType=%q id=%q", entityType, id)
 
 	switch entityType {
 	case "song":
@@ -187,7 +216,6 @@ func GetResultsByTypeRaw(ctx context.Context, entityType, id string) (interface{
 		return fetchOne[models.FeedPost](ctx, db.PostsCollection, "postid", id)
 	default:
 		err := fmt.Errorf("unsupported entity type: %s", entityType)
-		log.Printf("[GetResultsByTypeRaw] ERROR %v", err)
 		return nil, err
 	}
 }
@@ -2,52 +2,18 @@ package search
 
 import (
 	"encoding/json"
-	"io"
-	"log"
 	"net/http"
 	"strings"
 
-	"naevis/models"
-	"naevis/rdx"
+	"naevis/apierr"
+	"naevis/pagination"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func EventHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	log.Printf("[EventHandler] START method=%s", r.Method)
-
-	if r.Method != http.MethodPost && r.Method != http.MethodPut &&
-		r.Method != http.MethodDelete && r.Method != http.MethodPatch {
-		http.Error(w, "Only POST, PUT, PATCH, and DELETE requests are allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	var event models.Index
-	if err := json.Unmarshal(body, &event); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	if err := rdx.Conn.Publish(r.Context(), "indexing-events", string(body)).Err(); err != nil {
-		http.Error(w, "Failed to enqueue indexing job", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_, _ = w.Write([]byte(`{"message":"Event queued successfully"}`))
-}
-
 func SearchHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		apierr.Respond(w, http.StatusMethodNotAllowed, "Only GET allowed")
 		return
 	}
 
@@ -57,19 +23,25 @@ func SearchHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		query = strings.TrimSpace(r.URL.Query().Get("query"))
 	}
 	if query == "" {
-		http.Error(w, "Search query is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	page, err := pagination.Parse(r, 20, 50)
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid cursor")
 		return
 	}
 
-	res, err := GetResultsOfType(r.Context(), entityType, query, 50)
+	res, next, err := GetResultsOfType(r.Context(), entityType, query, page.After, int(page.Limit))
 	if err != nil {
-		http.Error(w, "Error fetching search results", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error fetching search results")
 		return
 	}
 
-	payload, err := json.Marshal(res)
+	payload, err := json.Marshal(pagination.NewPage(res, next))
 	if err != nil {
-		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Error encoding JSON")
 		return
 	}
 
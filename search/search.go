@@ -3,7 +3,7 @@ package search
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
@@ -35,7 +35,6 @@ type Entity struct {
 // -------------------------
 
 func IndexEntity(ctx context.Context, entity Entity) error {
-	log.Printf("[IndexEntity] START entity=%+v", entity)
 
 	if err := SaveEntityToDB(ctx, entity); err != nil {
 		return fmt.Errorf("[IndexEntity] save entity to db: %w", err)
@@ -43,10 +42,8 @@ func IndexEntity(ctx context.Context, entity Entity) error {
 
 	text := strings.TrimSpace(entity.Title + " " + entity.Description)
 	tokens := Tokenize(text)
-	log.Printf("[IndexEntity] tokens=%v", tokens)
 
 	if len(tokens) == 0 {
-		log.Println("[IndexEntity] No tokens, skipping indexing")
 		return nil
 	}
 
@@ -57,24 +54,19 @@ func IndexEntity(ctx context.Context, entity Entity) error {
 			addToIndexPipeline(ctx, pipe, hashtagKey(token), entity.EntityID, float64(entity.CreatedAt.UnixNano()))
 		}
 		pipe.ZAdd(ctx, autocompleteZSet(), redis.Z{Score: 0, Member: token})
-		log.Printf("[IndexEntity] Added token=%q to autocomplete zset", token)
 	}
 
 	_, err := pipe.Exec(ctx)
-	log.Printf("[IndexEntity] END err=%v", err)
 	return err
 }
 
 func DeleteEntity(ctx context.Context, id string) error {
-	log.Printf("[DeleteEntity] START id=%q", id)
 	ent, err := FetchEntityFromSearchDB(ctx, id)
 	if err != nil {
-		log.Printf("[DeleteEntity] entity not found err=%v", err)
 		return err
 	}
 
 	tokens := Tokenize(ent.Title + " " + ent.Description)
-	log.Printf("[DeleteEntity] tokens=%v", tokens)
 
 	pipe := rdx.Conn.Pipeline()
 	for _, token := range tokens {
@@ -84,27 +76,23 @@ func DeleteEntity(ctx context.Context, id string) error {
 		}
 	}
 	if _, err := pipe.Exec(ctx); err != nil {
-		log.Printf("[DeleteEntity] Redis pipeline error=%v", err)
+		slog.WarnContext(ctx, "search delete pipeline failed", "entity_id", id, "error", err)
 		return err
 	}
 
-	_, err = db.Client.Database("naevis").Collection("search").DeleteOne(ctx, bson.M{"entityid": id})
-	log.Printf("[DeleteEntity] END err=%v", err)
+	_, err = db.SearchIndexCollection.DeleteOne(ctx, bson.M{"entityid": id})
 	return err
 }
 
 func UpdateEntityIndexes(ctx context.Context, newEntity Entity) error {
-	log.Printf("[UpdateEntityIndexes] START newEntity=%+v", newEntity)
 
 	oldEnt, err := FetchEntityFromSearchDB(ctx, newEntity.EntityID)
 	if err != nil {
-		log.Printf("[UpdateEntityIndexes] old entity not found, indexing new entity")
 		return IndexEntity(ctx, newEntity)
 	}
 
 	oldTokens := Tokenize(oldEnt.Title + " " + oldEnt.Description)
 	newTokens := Tokenize(newEntity.Title + " " + newEntity.Description)
-	log.Printf("[UpdateEntityIndexes] oldTokens=%v newTokens=%v", oldTokens, newTokens)
 
 	oldSet := make(map[string]struct{}, len(oldTokens))
 	newSet := make(map[string]struct{}, len(newTokens))
@@ -126,10 +114,8 @@ func UpdateEntityIndexes(ctx context.Context, newEntity Entity) error {
 			toAdd = append(toAdd, t)
 		}
 	}
-	log.Printf("[UpdateEntityIndexes] toAdd=%v toRemove=%v", toAdd, toRemove)
 
 	if len(toAdd) == 0 && len(toRemove) == 0 {
-		log.Printf("[UpdateEntityIndexes] No changes, only updating DB")
 		return SaveEntityToDB(ctx, newEntity)
 	}
 
@@ -148,12 +134,11 @@ func UpdateEntityIndexes(ctx context.Context, newEntity Entity) error {
 		pipe.ZAdd(ctx, autocompleteZSet(), redis.Z{Score: 0, Member: token})
 	}
 	if _, err := pipe.Exec(ctx); err != nil {
-		log.Printf("[UpdateEntityIndexes] Redis pipeline error=%v", err)
+		slog.WarnContext(ctx, "search update pipeline failed", "entity_id", newEntity.EntityID, "error", err)
 		return err
 	}
 
 	err = SaveEntityToDB(ctx, newEntity)
-	log.Printf("[UpdateEntityIndexes] END err=%v", err)
 	return err
 }
 
@@ -162,15 +147,13 @@ func UpdateEntityIndexes(ctx context.Context, newEntity Entity) error {
 // -------------------------
 
 func IndexDatainRedis(ctx context.Context, event models.Index) error {
-	log.Printf("[IndexDatainRedis] START event=%+v", event)
+	slog.DebugContext(ctx, "search index event", "method", event.Method, "entity_type", event.EntityType, "entity_id", event.EntityId)
 
 	switch strings.ToUpper(event.Method) {
 	case "DELETE":
-		log.Println("[IndexDatainRedis] Method=DELETE")
 		return DeleteEntity(ctx, event.EntityId)
 
 	case "PATCH", "PUT":
-		log.Printf("[IndexDatainRedis] Method=%s", event.Method)
 		data, err := GetResultsByTypeRaw(ctx, event.EntityType, event.EntityId)
 		if err != nil {
 			return err
@@ -182,7 +165,6 @@ func IndexDatainRedis(ctx context.Context, event models.Index) error {
 		return UpdateEntityIndexes(ctx, newEntity)
 
 	case "POST":
-		log.Println("[IndexDatainRedis] Method=POST")
 		data, err := GetResultsByTypeRaw(ctx, event.EntityType, event.EntityId)
 		if err != nil {
 			return err
@@ -2,7 +2,7 @@ package search
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"naevis/rdx"
 	"sort"
 	"strings"
@@ -14,10 +14,8 @@ import (
 // -------------------------
 
 func GetIndexedResults(ctx context.Context, query string, limit int) ([]string, error) {
-	log.Printf("[GetIndexedResults] START query=%q limit=%d", query, limit)
 	tokens := Tokenize(query)
 	if len(tokens) == 0 {
-		log.Println("[GetIndexedResults] No tokens, returning nil")
 		return nil, nil
 	}
 
@@ -40,18 +38,16 @@ func GetIndexedResults(ctx context.Context, query string, limit int) ([]string,
 
 	for i, t := range tl {
 		if t.err != nil {
-			log.Printf("[GetIndexedResults] Token %q error: %v", tokens[i], t.err)
+			slog.WarnContext(ctx, "search token lookup failed", "token", tokens[i], "error", t.err)
 			return nil, t.err
 		}
 		if len(t.ids) == 0 {
-			log.Printf("[GetIndexedResults] Token %q returned no IDs", tokens[i])
 			return nil, nil
 		}
 	}
 
 	sort.Slice(tl, func(i, j int) bool { return len(tl[i].ids) < len(tl[j].ids) })
 	base := tl[0].ids
-	log.Printf("[GetIndexedResults] Base token IDs=%v", base)
 
 	otherSets := make([]map[string]struct{}, len(tl)-1)
 	for i := 1; i < len(tl); i++ {
@@ -73,22 +69,18 @@ func GetIndexedResults(ctx context.Context, query string, limit int) ([]string,
 		}
 		if match {
 			out = append(out, id)
-			log.Printf("[GetIndexedResults] Matched ID=%q", id)
 			if limit > 0 && len(out) >= limit {
 				break
 			}
 		}
 	}
 
-	log.Printf("[GetIndexedResults] END matchedIDs=%v", out)
 	return out, nil
 }
 
 func SearchWithHashtagBoost(ctx context.Context, query string, limit int) ([]string, error) {
-	log.Printf("[SearchWithHashtagBoost] START query=%q limit=%d", query, limit)
 	query = strings.ToLower(strings.TrimSpace(query))
 	if query == "" {
-		log.Println("[SearchWithHashtagBoost] Empty query, returning nil")
 		return nil, nil
 	}
 
@@ -99,7 +91,6 @@ func SearchWithHashtagBoost(ctx context.Context, query string, limit int) ([]str
 	hashtags := ExtractHashtags(query)
 
 	scoreMap := make(map[string]int)
-	log.Printf("[SearchWithHashtagBoost] Tokens=%v Hashtags=%v", tokens, hashtags)
 
 	for _, t := range tokens {
 		ids, err := GetIndexIDsForToken(ctx, t)
@@ -108,7 +99,6 @@ func SearchWithHashtagBoost(ctx context.Context, query string, limit int) ([]str
 		}
 		for _, id := range ids {
 			scoreMap[id] += 3
-			log.Printf("[SearchWithHashtagBoost] Token %q added ID=%q score=+3 total=%d", t, id, scoreMap[id])
 		}
 	}
 
@@ -119,12 +109,10 @@ func SearchWithHashtagBoost(ctx context.Context, query string, limit int) ([]str
 		}
 		for _, id := range ids {
 			scoreMap[id] += 7
-			log.Printf("[SearchWithHashtagBoost] Hashtag %q added ID=%q score=+7 total=%d", h, id, scoreMap[id])
 		}
 	}
 
 	if len(scoreMap) == 0 {
-		log.Println("[SearchWithHashtagBoost] No matches, returning nil")
 		return nil, nil
 	}
 
@@ -157,16 +145,13 @@ func SearchWithHashtagBoost(ctx context.Context, query string, limit int) ([]str
 		}
 		ids = append(ids, p.id)
 	}
-	log.Printf("[SearchWithHashtagBoost] END IDs=%v", ids)
 	return ids, nil
 }
 
 func GetIndexResults(ctx context.Context, query string, limit int) ([]string, error) {
-	log.Printf("[GetIndexResults] query=%q limit=%d", query, limit)
+	slog.DebugContext(ctx, "search query", "query", query, "limit", limit)
 	if strings.Contains(query, "#") {
-		log.Println("[GetIndexResults] Detected hashtag, using SearchWithHashtagBoost")
 		return SearchWithHashtagBoost(ctx, query, limit)
 	}
-	log.Println("[GetIndexResults] No hashtag, using GetIndexedResults")
 	return GetIndexedResults(ctx, query, limit)
 }
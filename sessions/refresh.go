@@ -0,0 +1,147 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Refresh tokens form one family per session: every rotation marks the
+// presented token used and issues its successor. A used token presented
+// again means it was copied, so the whole family is revoked.
+
+var (
+	// ErrRefreshInvalid is returned for unknown, expired or already
+	// rotated tokens and for tokens of ended sessions.
+	ErrRefreshInvalid = errors.New("sessions: invalid refresh token")
+	// ErrRefreshReused is returned when a rotated token is presented
+	// again; its session has been revoked.
+	ErrRefreshReused = errors.New("sessions: refresh token reused")
+)
+
+// reuseGrace tolerates a client that sends the same token twice at once,
+// e.g. from two tabs: a repeat this soon after rotation is rejected
+// without revoking the family.
+const reuseGrace = 10 * time.Second
+
+// refreshToken is stored by hash; the raw token only ever lives in the
+// client's cookie.
+type refreshToken struct {
+	Hash      string     `bson:"_id"`
+	SessionID string     `bson:"session"`
+	UserID    string     `bson:"userid"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+// IssueRefresh creates the first refresh token of s, valid until the
+// session expires.
+func IssueRefresh(ctx context.Context, s *Session) (string, error) {
+	return issueRefresh(ctx, s.ID, s.UserID, s.ExpiresAt)
+}
+
+// Rotate exchanges a refresh token for its successor and extends the
+// session to ttl from now. It returns the session and the new token.
+func Rotate(ctx context.Context, raw string, ttl time.Duration) (*Session, string, error) {
+	now := time.Now().UTC()
+	hash := hashToken(raw)
+
+	var old refreshToken
+	err := db.RefreshTokensCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": hash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&old)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, "", reused(ctx, hash, now)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !now.Before(old.ExpiresAt) {
+		return nil, "", ErrRefreshInvalid
+	}
+
+	var s Session
+	err = db.SessionsCollection.FindOneAndUpdate(ctx,
+		activeFilter(bson.M{"_id": old.SessionID}),
+		bson.M{"$set": bson.M{"expires_at": now.Add(ttl), "last_seen": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, "", ErrRefreshInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	next, err := issueRefresh(ctx, s.ID, s.UserID, s.ExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return &s, next, nil
+}
+
+// reused handles a token that could not be claimed: unknown tokens are
+// invalid, and a used one revokes its family unless it falls within the
+// grace period.
+func reused(ctx context.Context, hash string, now time.Time) error {
+	var t refreshToken
+	err := db.RefreshTokensCollection.FindOne(ctx, bson.M{"_id": hash}).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrRefreshInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if t.UsedAt == nil || now.Sub(*t.UsedAt) < reuseGrace {
+		return ErrRefreshInvalid
+	}
+
+	slog.WarnContext(ctx, "refresh token reuse", "user_id", t.UserID, "session_id", t.SessionID)
+	if _, err := revoke(ctx, activeFilter(bson.M{"_id": t.SessionID})); err != nil {
+		return err
+	}
+	return ErrRefreshReused
+}
+
+func issueRefresh(ctx context.Context, sessionID, userID string, expires time.Time) (string, error) {
+	raw, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.RefreshTokensCollection.InsertOne(ctx, refreshToken{
+		Hash:      hashToken(raw),
+		SessionID: sessionID,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expires,
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,220 @@
+// Package sessions keeps a server-side record of every login.
+//
+// Each login starts a session whose ID is carried in the access token as
+// its jti claim. Sessions are stored in the sessions collection with the
+// device, address and last activity of the client. Revoking a session
+// marks it in Mongo and adds its ID to a Redis denylist that
+// middleware.Authenticate consults on every request; denylist entries
+// expire once no token carrying the ID can still be valid.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"naevis/clientip"
+	"naevis/config"
+	"naevis/db"
+	"naevis/rdx"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Redis keys.
+const (
+	revokedPrefix = "auth:revoked:" // denylisted session IDs
+	seenPrefix    = "auth:seen:"    // throttles last_seen writes
+)
+
+// seenInterval is how often a session's last_seen is written at most.
+const seenInterval = time.Minute
+
+// ErrNotFound is returned when a session does not exist, belongs to
+// another user or is no longer active.
+var ErrNotFound = errors.New("sessions: session not found")
+
+// proxies resolves the address recorded for a new session.
+var proxies = clientip.New(nil)
+
+// Configure applies the loaded configuration to the sessions package.
+func Configure(cfg *config.Config) {
+	proxies = clientip.New(cfg.RateLimit.TrustedProxies)
+}
+
+// Session is one login of a user on one device. ExpiresAt is never
+// earlier than the expiry of any token issued for the session.
+type Session struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserID    string     `json:"-" bson:"userid"`
+	Device    string     `json:"device" bson:"device"`
+	IP        string     `json:"ip" bson:"ip"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	LastSeen  time.Time  `json:"last_seen" bson:"last_seen"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	MFA       bool       `json:"mfa" bson:"mfa"` // the login passed a second factor
+	Current   bool       `json:"current" bson:"-"`
+}
+
+// Start records a new session for userID made by request r that lasts
+// for ttl unless extended; mfa records whether the login passed a second
+// factor.
+func Start(ctx context.Context, userID string, r *http.Request, ttl time.Duration, mfa bool) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	s := &Session{
+		ID:        id,
+		UserID:    userID,
+		Device:    r.UserAgent(),
+		IP:        proxies.IP(r),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ttl),
+		MFA:       mfa,
+	}
+	if _, err := db.SessionsCollection.InsertOne(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Revoked reports whether the session id has been revoked. Redis answers
+// normally; when it is unavailable the session record is consulted.
+func Revoked(ctx context.Context, id string) (bool, error) {
+	if rdx.Conn != nil {
+		n, err := rdx.Conn.Exists(ctx, revokedPrefix+id).Result()
+		if err == nil {
+			return n > 0, nil
+		}
+		slog.WarnContext(ctx, "session denylist lookup failed; falling back to mongo", "session_id", id, "error", err)
+	}
+	var s Session
+	err := db.SessionsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return s.RevokedAt != nil, nil
+}
+
+// Touch updates the session's last_seen, at most once per seenInterval.
+// Failures are logged; they never fail the request.
+func Touch(ctx context.Context, id string) {
+	if rdx.Conn == nil {
+		return
+	}
+	first, err := rdx.Conn.SetNX(ctx, seenPrefix+id, 1, seenInterval).Result()
+	if err != nil || !first {
+		return
+	}
+	_, err = db.SessionsCollection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"last_seen": time.Now().UTC()}},
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "session last_seen update failed", "session_id", id, "error", err)
+	}
+}
+
+// List returns the active sessions of userID, most recently used first.
+func List(ctx context.Context, userID string) ([]Session, error) {
+	cur, err := db.SessionsCollection.Find(ctx, activeFilter(bson.M{"userid": userID}),
+		options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	list := []Session{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Revoke ends one active session of userID.
+func Revoke(ctx context.Context, userID, id string) error {
+	n, err := revoke(ctx, activeFilter(bson.M{"_id": id, "userid": userID}))
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// RevokeAll ends every active session of userID and reports how many
+// there were.
+func RevokeAll(ctx context.Context, userID string) (int, error) {
+	return revoke(ctx, activeFilter(bson.M{"userid": userID}))
+}
+
+// revoke marks the sessions matching filter revoked, denylists them
+// until they would have expired and deletes their refresh tokens.
+func revoke(ctx context.Context, filter bson.M) (int, error) {
+	cur, err := db.SessionsCollection.Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"_id": 1, "expires_at": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var list []Session
+	if err := cur.All(ctx, &list); err != nil || len(list) == 0 {
+		return 0, err
+	}
+
+	// Denylist first: once the IDs are there the tokens stop working even
+	// if the Mongo update below fails.
+	ids := make([]string, len(list))
+	for i, s := range list {
+		ids[i] = s.ID
+	}
+	if rdx.Conn != nil {
+		pipe := rdx.Conn.Pipeline()
+		for _, s := range list {
+			if ttl := time.Until(s.ExpiresAt); ttl > 0 {
+				pipe.Set(ctx, revokedPrefix+s.ID, 1, ttl)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = db.SessionsCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	// Rotate already refuses tokens of revoked sessions; this just stops
+	// them lingering until they expire.
+	if _, err := db.RefreshTokensCollection.DeleteMany(ctx, bson.M{"session": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// activeFilter restricts filter to sessions that are neither revoked nor
+// expired.
+func activeFilter(filter bson.M) bson.M {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	filter["expires_at"] = bson.M{"$gt": time.Now().UTC()}
+	return filter
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
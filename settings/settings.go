@@ -3,6 +3,7 @@ package settings
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/models"
@@ -52,7 +53,7 @@ func GetUserSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		userSettings = getDefaultSettings(userID)
 		_, _ = db.SettingsCollection.InsertOne(context.TODO(), userSettings)
 	} else if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
@@ -86,7 +87,7 @@ func UpdateUserSetting(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		"daily_reminder": true,
 	}
 	if !validSettings[settingType] {
-		http.Error(w, "Invalid setting type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid setting type")
 		return
 	}
 
@@ -94,7 +95,7 @@ func UpdateUserSetting(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		Value any `json:"value"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
@@ -105,7 +106,7 @@ func UpdateUserSetting(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	opts := options.Update().SetUpsert(true)
 	_, err := db.SettingsCollection.UpdateOne(context.TODO(), filter, updateDoc, opts)
 	if err != nil {
-		http.Error(w, "Failed to update setting", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update setting")
 		return
 	}
 
@@ -135,13 +136,13 @@ func InitUserSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		newSettings := getDefaultSettings(userID)
 		_, err := db.SettingsCollection.InsertOne(context.TODO(), newSettings)
 		if err != nil {
-			http.Error(w, "Failed to initialize settings", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to initialize settings")
 			return
 		}
 		json.NewEncoder(w).Encode(true) // Successfully initialized
 		return
 	} else if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
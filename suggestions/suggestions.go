@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"naevis/apierr"
 	"naevis/autocom"
 	"naevis/db"
 	"naevis/globals"
@@ -21,13 +22,13 @@ import (
 func SuggestFollowers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	currentUserID := r.URL.Query().Get("userid")
 	if currentUserID == "" {
-		http.Error(w, "Missing userid", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing userid")
 		return
 	}
 
 	userID, ok := r.Context().Value(globals.UserIDKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -48,7 +49,7 @@ func SuggestFollowers(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	var followData models.UserFollow
 	err = db.FollowingsCollection.FindOne(context.TODO(), bson.M{"userid": currentUserID}).Decode(&followData)
 	if err != nil && err != mongo.ErrNoDocuments {
-		http.Error(w, "Failed to fetch follow data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch follow data")
 		return
 	}
 
@@ -68,7 +69,7 @@ func SuggestFollowers(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 
 	cursor, err := db.UserCollection.Find(context.TODO(), filter, options)
 	if err != nil {
-		http.Error(w, "Failed to fetch suggestions", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch suggestions")
 		return
 	}
 	defer cursor.Close(context.TODO())
@@ -92,7 +93,7 @@ func SuggestFollowers(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	// Send JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(suggestedUsers); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
@@ -123,7 +124,7 @@ func GetPlaceSuggestions(ctx context.Context, query string) ([]models.Suggestion
 func SuggestionsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	query := r.URL.Query().Get("query")
 	if query == "" {
-		http.Error(w, "Query is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Query is required")
 		return
 	}
 
@@ -131,7 +132,7 @@ func SuggestionsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	// suggestions, err := GetPlaceSuggestions(ctx, query)
 	suggestions, err := autocom.SearchPlaceAutocorrect(rdx.Conn, query, 10)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching suggestions: %v", err), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Error fetching suggestions: %v", err))
 		return
 	}
 
@@ -154,14 +155,14 @@ func GetNearbyPlaces(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 
 	cursor, err := db.PlacesCollection.Find(context.TODO(), bson.M{})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer cursor.Close(context.TODO())
 
 	var places []models.Place
 	if err = cursor.All(context.TODO(), &places); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -0,0 +1,55 @@
+package tickets
+
+import (
+	"context"
+	"log/slog"
+
+	"naevis/db"
+	"naevis/mail"
+	"naevis/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// emailTickets queues the buyer's tickets as PDF attachments. Failures
+// are only logged: the purchase has succeeded and the tickets can still
+// be printed from the account.
+func emailTickets(ctx context.Context, eventID, userID string, codes []string) {
+	var buyer models.User
+	err := db.UserCollection.FindOne(ctx, bson.M{"userid": userID},
+		options.FindOne().SetProjection(bson.M{"email": 1, "username": 1})).Decode(&buyer)
+	if err != nil || buyer.Email == "" {
+		slog.WarnContext(ctx, "tickets not sent; buyer has no email", "user_id", userID, "error", err)
+		return
+	}
+
+	title := eventID
+	var ev models.Event
+	if err := db.EventsCollection.FindOne(ctx, bson.M{"eventid": eventID},
+		options.FindOne().SetProjection(bson.M{"title": 1})).Decode(&ev); err == nil && ev.Title != "" {
+		title = ev.Title
+	}
+
+	attachments := make([]mail.Attachment, 0, len(codes))
+	for _, code := range codes {
+		pdf, err := TicketPDF(eventID, code, buyer.Username)
+		if err != nil {
+			slog.ErrorContext(ctx, "rendering ticket failed", "ticket_code", code, "error", err)
+			return
+		}
+		attachments = append(attachments, mail.Attachment{
+			Filename:    "ticket-" + code + ".pdf",
+			ContentType: "application/pdf",
+			Data:        pdf,
+		})
+	}
+
+	err = mail.Queue(ctx, buyer.Email, "tickets", map[string]any{
+		"EventTitle": title,
+		"Codes":      codes,
+	}, attachments...)
+	if err != nil {
+		slog.ErrorContext(ctx, "queueing tickets email failed", "user_id", userID, "error", err)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"log/slog"
+	"naevis/apierr"
+	"naevis/config"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -21,14 +24,20 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-const hmacSecret = "your-very-secret-key" // keep secure
+// hmacSecret signs ticket QR payloads; set from config by Configure.
+var hmacSecret []byte
+
+// Configure applies the loaded configuration to the tickets package.
+func Configure(cfg *config.Config) {
+	hmacSecret = []byte(cfg.TicketHMACSecret)
+}
 
 // GenerateQRPayload returns a secure payload string: eventID|ticketID|uniqueCode|timestamp|signature
 func GenerateQRPayload(eventID, ticketID, uniqueCode string) string {
 	timestamp := time.Now().Unix() // current UNIX timestamp
 	data := fmt.Sprintf("%s|%s|%s|%d", eventID, ticketID, uniqueCode, timestamp)
 
-	h := hmac.New(sha256.New, []byte(hmacSecret))
+	h := hmac.New(sha256.New, hmacSecret)
 	h.Write([]byte(data))
 	sig := base64.StdEncoding.EncodeToString(h.Sum(nil))
 
@@ -43,12 +52,12 @@ func PrintTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
 		log.Printf("JWT validation error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	if uniqueCode == "" {
-		http.Error(w, "Unique code is required for verification", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unique code is required for verification")
 		return
 	}
 
@@ -58,28 +67,39 @@ func PrintTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		"uniquecode": uniqueCode,
 	}).Decode(&purchasedTicket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ticket verification failed: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Ticket verification failed: %v", err))
 		return
 	}
 
 	purchasedTicket.BuyerName = claims.Username
 
-	// Construct ticket payload
+	pdf, err := TicketPDF(eventID, uniqueCode, purchasedTicket.BuyerName)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rendering ticket failed", "ticket_code", uniqueCode, "error", err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to generate PDF")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=ticket-"+uniqueCode+".pdf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// TicketPDF renders the printable ticket for one purchased ticket: its
+// details and a QR code carrying the signed eventID|uniqueCode payload.
+func TicketPDF(eventID, uniqueCode, buyerName string) ([]byte, error) {
 	ticketData := fmt.Sprintf("%s|%s", eventID, uniqueCode)
-	h := hmac.New(sha256.New, []byte(hmacSecret))
+	h := hmac.New(sha256.New, hmacSecret)
 	h.Write([]byte(ticketData))
 	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
-
 	qrPayload := fmt.Sprintf("%s|%s", ticketData, signature)
 
-	// Generate QR code
 	qrPNG, err := qrcode.Encode(qrPayload, qrcode.Medium, 256)
 	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("generate QR code: %w", err)
 	}
 
-	// Create PDF
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.AddPage()
 	pdf.SetFont("Arial", "B", 16)
@@ -89,12 +109,11 @@ func PrintTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	pdf.SetFont("Arial", "", 12)
 	pdf.Cell(0, 10, fmt.Sprintf("Event ID: %s", eventID))
 	pdf.Ln(8)
-	pdf.Cell(0, 10, fmt.Sprintf("Name: %s", purchasedTicket.BuyerName))
+	pdf.Cell(0, 10, fmt.Sprintf("Name: %s", buyerName))
 	pdf.Ln(8)
 	pdf.Cell(0, 10, fmt.Sprintf("Unique Code: %s", uniqueCode))
 	pdf.Ln(12)
 
-	// Add QR image
 	imageOpts := gofpdf.ImageOptions{
 		ImageType: "PNG",
 	}
@@ -103,12 +122,7 @@ func PrintTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	var buf bytes.Buffer
 	if err := pdf.Output(&buf); err != nil {
-		http.Error(w, "Failed to generate PDF", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", "attachment; filename=ticket-"+uniqueCode+".pdf")
-	w.WriteHeader(http.StatusOK)
-	w.Write(buf.Bytes())
+	return buf.Bytes(), nil
 }
@@ -44,7 +44,7 @@ func VerifyTicketQR(payload string) (eventID, ticketID, uniqueCode string, err e
 
 	// Recompute signature
 	data := fmt.Sprintf("%s|%s|%s|%s", eventID, ticketID, uniqueCode, timestampStr)
-	h := hmac.New(sha256.New, []byte(hmacSecret))
+	h := hmac.New(sha256.New, hmacSecret)
 	h.Write([]byte(data))
 	expectedSig := base64.StdEncoding.EncodeToString(h.Sum(nil))
 
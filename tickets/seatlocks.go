@@ -0,0 +1,207 @@
+package tickets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"naevis/db"
+	"naevis/scheduler"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Seat states within a ticket document's seats array.
+const (
+	seatAvailable = "available"
+	seatLocked    = "locked"
+	seatBooked    = "booked"
+)
+
+// seatLockTTL is how long a checkout may hold seats before they return to
+// sale.
+const seatLockTTL = 10 * time.Minute
+
+// Scheduler jobs that expire seat locks.
+const (
+	JobReleaseSeats = "tickets.release-seats"
+	JobExpireLocks  = "tickets.expire-seat-locks"
+)
+
+var errSeatsTaken = errors.New("seats not available")
+
+// seatRelease is the payload of a JobReleaseSeats run.
+type seatRelease struct {
+	EventID string   `json:"event_id"`
+	UserID  string   `json:"user_id"`
+	Seats   []string `json:"seats"`
+}
+
+// everySeat matches a ticket document only if each listed seat satisfies
+// cond, so a single update applies to all of the seats or none.
+func everySeat(seats []string, cond bson.M) bson.M {
+	all := make(bson.A, 0, len(seats))
+	for _, id := range seats {
+		m := bson.M{"seat_id": id}
+		for k, v := range cond {
+			m[k] = v
+		}
+		all = append(all, bson.M{"$elemMatch": m})
+	}
+	return bson.M{"$all": all}
+}
+
+// seatFilter limits an update to the listed seats through arrayFilters.
+func seatFilter(seats []string) *options.UpdateOptions {
+	return options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"s.seat_id": bson.M{"$in": seats}}},
+	})
+}
+
+// lockSeats holds every listed seat for userID, taking over locks that have
+// expired, and queues their release for when the hold runs out.
+func lockSeats(ctx context.Context, eventID, userID string, seats []string) (time.Time, error) {
+	now := time.Now().UTC()
+	until := now.Add(seatLockTTL)
+
+	filter := bson.M{
+		"event_id": eventID,
+		"seats": everySeat(seats, bson.M{"$or": bson.A{
+			bson.M{"status": seatAvailable},
+			bson.M{"status": seatLocked, "locked_until": bson.M{"$lte": now}},
+		}}),
+	}
+	update := bson.M{"$set": bson.M{
+		"seats.$[s].status":       seatLocked,
+		"seats.$[s].user_id":      userID,
+		"seats.$[s].locked_until": until,
+	}}
+	res, err := db.TicketsCollection.UpdateOne(ctx, filter, update, seatFilter(seats))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if res.MatchedCount == 0 {
+		return time.Time{}, errSeatsTaken
+	}
+
+	// The sweep job catches the lock too if this fails; it only runs less
+	// often.
+	release := seatRelease{EventID: eventID, UserID: userID, Seats: seats}
+	if err := scheduler.After(ctx, JobReleaseSeats, until, release); err != nil {
+		log.Printf("schedule seat release for event %s: %v", eventID, err)
+	}
+	return until, nil
+}
+
+// unlockSeats returns the listed seats held by userID to sale.
+func unlockSeats(ctx context.Context, eventID, userID string, seats []string) error {
+	filter := bson.M{"event_id": eventID}
+	update := bson.M{
+		"$set":   bson.M{"seats.$[s].status": seatAvailable, "seats.$[s].user_id": nil},
+		"$unset": bson.M{"seats.$[s].locked_until": ""},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{
+			"s.seat_id": bson.M{"$in": seats},
+			"s.status":  seatLocked,
+			"s.user_id": userID,
+		}},
+	})
+	_, err := db.TicketsCollection.UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+// heldSeats matches the ticket document if userID holds an unexpired
+// lock on every listed seat.
+func heldSeats(eventID, ticketID, userID string, seats []string) bson.M {
+	return bson.M{
+		"_id":      ticketID,
+		"event_id": eventID,
+		"seats": everySeat(seats, bson.M{
+			"status":       seatLocked,
+			"user_id":      userID,
+			"locked_until": bson.M{"$gt": time.Now().UTC()},
+		}),
+	}
+}
+
+// bookSeats marks the listed seats booked if userID holds an unexpired lock
+// on all of them.
+func bookSeats(ctx context.Context, eventID, ticketID, userID string, seats []string) error {
+	filter := heldSeats(eventID, ticketID, userID, seats)
+	update := bson.M{
+		"$set":   bson.M{"seats.$[s].status": seatBooked},
+		"$unset": bson.M{"seats.$[s].locked_until": ""},
+	}
+	res, err := db.TicketsCollection.UpdateOne(ctx, filter, update, seatFilter(seats))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errSeatsTaken
+	}
+	return nil
+}
+
+// ReleaseSeats is the JobReleaseSeats job: it frees the seats of one lock
+// once its hold has run out. Seats that were booked or re-locked since are
+// left alone.
+func ReleaseSeats(ctx context.Context, payload json.RawMessage) error {
+	var p seatRelease
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	filter := bson.M{"event_id": p.EventID}
+	update := bson.M{
+		"$set":   bson.M{"seats.$[s].status": seatAvailable, "seats.$[s].user_id": nil},
+		"$unset": bson.M{"seats.$[s].locked_until": ""},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{
+			"s.seat_id":      bson.M{"$in": p.Seats},
+			"s.status":       seatLocked,
+			"s.user_id":      p.UserID,
+			"s.locked_until": bson.M{"$lte": time.Now().UTC()},
+		}},
+	})
+	_, err := db.TicketsCollection.UpdateMany(ctx, filter, update, opts)
+	return err
+}
+
+// ExpireSeatLocks is the JobExpireLocks sweep: it frees every seat whose
+// hold has run out, including locks taken before holds expired and locks
+// whose release job was lost.
+func ExpireSeatLocks(ctx context.Context, _ json.RawMessage) error {
+	now := time.Now().UTC()
+	filter := bson.M{"seats": bson.M{"$elemMatch": bson.M{
+		"status": seatLocked,
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$lte": now}},
+			bson.M{"locked_until": bson.M{"$exists": false}},
+		},
+	}}}
+	update := bson.M{
+		"$set":   bson.M{"seats.$[s].status": seatAvailable, "seats.$[s].user_id": nil},
+		"$unset": bson.M{"seats.$[s].locked_until": ""},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{
+			"s.status": seatLocked,
+			"$or": bson.A{
+				bson.M{"s.locked_until": bson.M{"$lte": now}},
+				bson.M{"s.locked_until": bson.M{"$exists": false}},
+			},
+		}},
+	})
+	res, err := db.TicketsCollection.UpdateMany(ctx, filter, update, opts)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("[SeatLocks] released expired locks in %d ticket documents", res.ModifiedCount)
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson"
 
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -27,12 +28,12 @@ func PrintStyledTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	// Validate JWT
 	claims, err := middleware.ValidateJWT(token)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	if uniqueCode == "" {
-		http.Error(w, "Missing unique code", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Missing unique code")
 		return
 	}
 
@@ -44,7 +45,7 @@ func PrintStyledTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		"uniquecode": uniqueCode,
 	}).Decode(&ticket)
 	if err != nil {
-		http.Error(w, "Ticket not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Ticket not found")
 		return
 	}
 
@@ -89,7 +90,7 @@ func PrintStyledTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	var buf bytes.Buffer
 	err = pdf.Output(&buf)
 	if err != nil {
-		http.Error(w, "Failed to generate ticket", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to generate ticket")
 		return
 	}
 
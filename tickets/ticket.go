@@ -4,11 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
 	"naevis/models"
+	"naevis/money"
 	"naevis/mq"
-	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
 	_ "net/http/pprof"
@@ -35,31 +35,31 @@ func CreateTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	// Validate inputs
 	if name == "" || priceStr == "" || currencyStr == "" || quantityStr == "" || color == "" || seatStartStr == "" || seatEndStr == "" {
-		http.Error(w, "All fields including seatStart and seatEnd are required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "All fields including seatStart and seatEnd are required")
 		return
 	}
 
-	price, err := strconv.ParseFloat(priceStr, 64)
-	if err != nil || price <= 0 {
-		http.Error(w, "Invalid price value", http.StatusBadRequest)
+	price, err := money.Parse(priceStr, currencyStr)
+	if err != nil || !price.IsPositive() {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid price value")
 		return
 	}
 
 	quantity, err := strconv.Atoi(quantityStr)
 	if err != nil || quantity < 0 {
-		http.Error(w, "Invalid quantity value", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid quantity value")
 		return
 	}
 
 	seatStart, err := strconv.Atoi(seatStartStr)
 	if err != nil || seatStart < 0 {
-		http.Error(w, "Invalid seatStart value", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid seatStart value")
 		return
 	}
 
 	seatEnd, err := strconv.Atoi(seatEndStr)
 	if err != nil || seatEnd < seatStart {
-		http.Error(w, "Invalid seatEnd value", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid seatEnd value")
 		return
 	}
 	// seats := GenerateSeatLabels(seatStart, seatEnd, "A") // You can use "B", "C" if you want multiple rows
@@ -71,7 +71,6 @@ func CreateTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		EntityType: "event",
 		Name:       name,
 		Price:      price,
-		Currency:   currencyStr,
 		Color:      color,
 		Quantity:   quantity,
 		Available:  quantity,
@@ -84,19 +83,22 @@ func CreateTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		UpdatedAt: time.Now(),
 	}
 
-	_, err = db.TicketsCollection.InsertOne(context.TODO(), tick)
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.TicketsCollection.InsertOne(ctx, tick); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "ticket", EntityId: tick.TicketID, Method: "POST", ItemType: "event", ItemId: eventID}
+		return mq.Emit(ctx, "ticket-created", m)
+	})
 	if err != nil {
-		http.Error(w, "Failed to create ticket: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create ticket: "+err.Error())
 		return
 	}
 
-	m := models.Index{EntityType: "ticket", EntityId: tick.TicketID, Method: "POST", ItemType: "event", ItemId: eventID}
-	go mq.Emit(ctx, "ticket-created", m)
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(tick); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
@@ -119,21 +121,21 @@ func GetTickets(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	filter := bson.M{"eventid": eventID}
 	cursor, err := db.TicketsCollection.Find(context.Background(), filter)
 	if err != nil {
-		http.Error(w, "Failed to fetch tickets", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch tickets")
 		return
 	}
 	defer cursor.Close(context.Background())
 	for cursor.Next(context.Background()) {
 		var tick models.Ticket
 		if err := cursor.Decode(&tick); err != nil {
-			http.Error(w, "Failed to decode ticket", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Failed to decode ticket")
 			return
 		}
 		tickList = append(tickList, tick)
 	}
 
 	if err := cursor.Err(); err != nil {
-		http.Error(w, "Cursor error", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Cursor error")
 		return
 	}
 
@@ -169,7 +171,7 @@ func GetTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var ticket models.Ticket
 	err := db.TicketsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": ticketID}).Decode(&ticket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ticket not found: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Ticket not found: %v", err))
 		return
 	}
 
@@ -189,7 +191,7 @@ func EditTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	var tick models.Ticket
 	if err := json.NewDecoder(r.Body).Decode(&tick); err != nil {
-		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid input data")
 		return
 	}
 
@@ -197,9 +199,9 @@ func EditTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := db.TicketsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": tickID}).Decode(&existingTicket)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Ticket not found", http.StatusNotFound)
+			apierr.Respond(w, http.StatusNotFound, "Ticket not found")
 		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Database error")
 		}
 		return
 	}
@@ -208,12 +210,9 @@ func EditTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	if tick.Name != "" && tick.Name != existingTicket.Name {
 		updateFields["name"] = tick.Name
 	}
-	if tick.Price > 0 && tick.Price != existingTicket.Price {
+	if tick.Price.IsPositive() && tick.Price != existingTicket.Price {
 		updateFields["price"] = tick.Price
 	}
-	if tick.Currency != "" && tick.Currency != existingTicket.Currency {
-		updateFields["currency"] = tick.Currency
-	}
 	if tick.Quantity >= 0 && tick.Quantity != existingTicket.Quantity {
 		updateFields["quantity"] = tick.Quantity
 		updateFields["available"] = tick.Quantity
@@ -248,15 +247,18 @@ func EditTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	updateFields["updated_at"] = time.Now()
 
-	_, err = db.TicketsCollection.UpdateOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": tickID}, bson.M{"$set": updateFields})
+	err = db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.TicketsCollection.UpdateOne(ctx, bson.M{"eventid": eventID, "ticketid": tickID}, bson.M{"$set": updateFields}); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "ticket", EntityId: tickID, Method: "PUT", ItemType: "event", ItemId: eventID}
+		return mq.Emit(ctx, "ticket-edited", m)
+	})
 	if err != nil {
-		http.Error(w, "Failed to update ticket: "+err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to update ticket: "+err.Error())
 		return
 	}
 
-	m := models.Index{EntityType: "ticket", EntityId: tickID, Method: "PUT", ItemType: "event", ItemId: eventID}
-	go mq.Emit(ctx, "ticket-edited", m)
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]any{
@@ -274,9 +276,15 @@ func DeleteTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	// Delete the ticket from MongoDB
 	// collection := client.Database("eventdb").Collection("ticks")
-	_, err := db.TicketsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": tickID})
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.TicketsCollection.DeleteOne(ctx, bson.M{"eventid": eventID, "ticketid": tickID}); err != nil {
+			return err
+		}
+		m := models.Index{EntityType: "ticket", EntityId: tickID, Method: "DELETE", ItemType: "event", ItemId: eventID}
+		return mq.Emit(ctx, "ticket-deleted", m)
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	// w.WriteHeader(http.StatusNoContent)
@@ -288,96 +296,6 @@ func DeleteTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		"message": "Ticket deleted successfully",
 	})
 	// RdxDel("event:" + eventID + ":tickets") // Invalidate cache after deletion
-
-	m := models.Index{EntityType: "ticket", EntityId: tickID, Method: "DELETE", ItemType: "event", ItemId: eventID}
-	go mq.Emit(ctx, "ticket-deleted", m)
-}
-
-// Buy Ticket
-func BuyTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	eventID := ps.ByName("eventid")
-	ticketID := ps.ByName("ticketid")
-
-	// Retrieve the ID of the requesting user from the context
-	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
-		return
-	}
-	userID := requestingUserID
-
-	// Decode the JSON body to get the quantity
-	var requestBody struct {
-		Quantity int `json:"quantity"`
-	}
-
-	// Parse the request body
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil || requestBody.Quantity <= 0 {
-		http.Error(w, "Invalid quantity in the request", http.StatusBadRequest)
-		return
-	}
-	quantityRequested := requestBody.Quantity
-
-	// Find the ticket in the database
-	// collection := client.Database("eventdb").Collection("ticks")
-	var ticket models.Ticket
-	err = db.TicketsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": ticketID}).Decode(&ticket)
-	if err != nil {
-		http.Error(w, "Ticket not found or other error", http.StatusNotFound)
-		return
-	}
-
-	// Check if there are tickets available
-	if ticket.Quantity <= 0 {
-		http.Error(w, "No tickets available for purchase", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the requested quantity is available
-	if ticket.Quantity < quantityRequested {
-		http.Error(w, "Not enough tickets available for purchase", http.StatusBadRequest)
-		return
-	}
-
-	// Decrease the ticket quantity
-	update := bson.M{"$inc": bson.M{"quantity": -quantityRequested}}
-	_, err = db.TicketsCollection.UpdateOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": ticketID}, update)
-	if err != nil {
-		http.Error(w, "Failed to update ticket quantity", http.StatusInternalServerError)
-		return
-	}
-
-	m := models.Index{}
-	mq.Notify("ticket-bought", m)
-
-	userdata.SetUserData("ticket", ticketID, userID, m.EntityType, m.EntityId)
-
-	// // Broadcast WebSocket message
-	// message := map[string]any{
-	// 	"event":              "ticket-updated",
-	// 	"eventid":            eventID,
-	// 	"ticketid":           ticketID,
-	// 	"quantity_remaining": ticket.Quantity - quantityRequested,
-	// }
-	// broadcastUpdate(message)
-	// broadcastWebSocketMessage(message)
-
-	// // After successfully decreasing the ticket quantity
-	// broadcastUpdate(map[string]interface{}{
-	// 	"event":              "ticket-updated",
-	// 	"eventid":            eventID,
-	// 	"ticketid":           ticketID,
-	// 	"quantity_remaining": ticket.Quantity - quantityRequested,
-	// })
-
-	// Respond with success
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]any{
-		"success": true,
-		"message": "Ticket purchased successfully",
-	})
 }
 
 func GenerateSeatLabels(start, end int, rowPrefix string) []string {
@@ -394,7 +312,7 @@ func VerifyTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	// Check if the unique code is provided
 	if uniqueCode == "" {
-		http.Error(w, "Unique code is required for verification", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Unique code is required for verification")
 		return
 	}
 
@@ -403,10 +321,11 @@ func VerifyTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	err := db.PurchasedTicketsCollection.FindOne(context.TODO(), bson.M{
 		"eventid":    eventID,
 		"uniquecode": uniqueCode, // Match the unique code
+		"status":     bson.M{"$ne": "refunded"},
 	}).Decode(&purchasedTicket)
 	if err != nil {
 		// Ticket not found or verification failed
-		http.Error(w, fmt.Sprintf("Ticket verification failed: %v", err), http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, fmt.Sprintf("Ticket verification failed: %v", err))
 		return
 	}
 
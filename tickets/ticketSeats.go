@@ -3,6 +3,7 @@ package tickets
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/models"
 	"net/http"
@@ -23,7 +24,7 @@ func GetTicketSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	}).Decode(&ticket)
 
 	if err != nil {
-		http.Error(w, "Ticket not found", http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "Ticket not found")
 		return
 	}
 
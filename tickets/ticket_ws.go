@@ -3,6 +3,7 @@ package tickets
 import (
 	"context"
 	"encoding/json"
+	"naevis/apierr"
 	"naevis/db"
 	"net/http"
 	_ "net/http/pprof"
@@ -18,7 +19,7 @@ func ResellTicketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
@@ -29,7 +30,7 @@ func ResellTicketHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		http.Error(w, "Failed to list ticket for resale", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to list ticket for resale")
 		return
 	}
 
@@ -3,22 +3,24 @@ package tickets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
-	"naevis/globals"
+	"naevis/gateway"
 	"naevis/models"
-	"naevis/mq"
-	"naevis/stripe"
-	"naevis/userdata"
+	"naevis/money"
 	"naevis/utils"
 	"net/http"
 	_ "net/http/pprof"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // A global map to manage event-specific update channels
@@ -56,23 +58,47 @@ func CreateTicketPaymentSession(w http.ResponseWriter, r *http.Request, ps httpr
 		Quantity int `json:"quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Quantity < 1 {
-		http.Error(w, "Invalid request or quantity", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or quantity")
 		return
 	}
 
-	// Generate a Stripe payment session
-	session, err := stripe.CreateTicketSession(ticketId, eventId, body.Quantity)
+	var ticket models.Ticket
+	err := db.TicketsCollection.FindOne(r.Context(), bson.M{"eventid": eventId, "ticketid": ticketId}).Decode(&ticket)
+	if err != nil {
+		apierr.Respond(w, http.StatusNotFound, "Ticket not found")
+		return
+	}
+	if ticket.Quantity < body.Quantity {
+		apierr.Respond(w, http.StatusBadRequest, "Not enough tickets available")
+		return
+	}
+	amount, err := ticket.Price.Mul(int64(body.Quantity))
 	if err != nil {
-		log.Printf("Error creating payment session: %v", err)
-		http.Error(w, "Failed to create payment session", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request or quantity")
+		return
+	}
+
+	// Open a checkout; the tickets are issued when the provider confirms payment
+	checkout, session, err := gateway.Start(r.Context(), utils.GetUserIDFromRequest(r), gateway.Item{
+		Kind:        gateway.KindTicket,
+		EntityType:  "event",
+		EntityID:    eventId,
+		ItemID:      ticketId,
+		Quantity:    body.Quantity,
+		Amount:      amount,
+		Description: fmt.Sprintf("%d × %s", body.Quantity, ticket.Name),
+	})
+	if err != nil {
+		gateway.RespondStartError(w, r, err)
 		return
 	}
 
 	dataResponse := map[string]any{
 		"paymentUrl": session.URL,
-		"eventId":    session.EventID,
-		"ticketId":   session.TicketID,
-		"stock":      session.Quantity,
+		"checkoutId": checkout.ID,
+		"eventId":    eventId,
+		"ticketId":   ticketId,
+		"stock":      body.Quantity,
 	}
 
 	response := map[string]any{
@@ -90,7 +116,7 @@ func EventUpdates(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Streaming unsupported")
 		return
 	}
 
@@ -135,94 +161,66 @@ func BroadcastTicketUpdate(eventId, ticketId string, remainingTickets int) {
 	}
 }
 
-// TicketPurchaseRequest represents the request body for purchasing tickets
-type TicketPurchaseRequest struct {
-	TicketID string `json:"ticketId"`
-	EventID  string `json:"eventId"`
-	Quantity int    `json:"quantity"`
-}
-
-// TicketPurchaseResponse represents the response body for ticket purchase confirmation
-type TicketPurchaseResponse struct {
-	Message    string `json:"message"`
-	Success    string `json:"success"`
-	UniqueCode string `json:"uniquecode"`
-}
-
-// ProcessTicketPayment simulates the payment processing logic
-func ProcessTicketPayment(ticketID, eventID string, quantity int) bool {
-	// Implement actual payment processing logic (e.g., calling a payment gateway)
-	// For the sake of this example, we'll assume payment is always successful.
-	log.Printf("Processing payment for TicketID: %s, EventID: %s, Quantity: %d", ticketID, eventID, quantity)
-	return true
-}
-
-// UpdateTicketStatus simulates updating the ticket status in the database
-func UpdateTicketStatus(ticketID, eventID string, quantity int) error {
-	// Implement actual logic to update ticket status in the database
-	log.Printf("Updating ticket status for TicketID: %s, EventID: %s, Quantity: %d", ticketID, eventID, quantity)
-	return nil
-}
-
-// ConfirmTicketPurchase handles the POST request for confirming the ticket purchase
+// ConfirmTicketPurchase reports whether the caller's ticket checkout has
+// been paid. Tickets are issued by FulfilCheckout once the payment
+// provider's webhook confirms the payment, never on the client's word.
 func ConfirmTicketPurchase(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	var request TicketPurchaseRequest
-
-	// Parse JSON body
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Process payment
-	if !ProcessTicketPayment(request.TicketID, request.EventID, request.Quantity) {
-		http.Error(w, "Payment failed", http.StatusBadRequest)
-		return
+	var request struct {
+		CheckoutID string `json:"checkoutId"`
 	}
-
-	// Update ticket status and store purchase
-	if err := UpdateTicketStatus(request.TicketID, request.EventID, request.Quantity); err != nil {
-		http.Error(w, "Failed to update ticket status", http.StatusInternalServerError)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CheckoutID == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	// Complete ticket purchase
-	buyTicket(w, r, request)
+	gateway.Confirm(w, r, gateway.KindTicket, request.CheckoutID)
 }
 
-// PurchaseTicket validates and deducts ticket quantity, returns generated ticket codes
-func PurchaseTicket(eventID, ticketID, userID string, quantity int) ([]string, error) {
-	var ticket models.Ticket
-	err := db.TicketsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": ticketID}).Decode(&ticket)
+// FulfilCheckout issues the tickets of a paid checkout and emails them to
+// the buyer.
+func FulfilCheckout(ctx context.Context, c *models.Checkout, done func(context.Context, models.Meta) error) error {
+	var codes []string
+	err := db.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if codes, err = PurchaseTicket(ctx, c.EntityID, c.ItemID, c.Quantity); err != nil {
+			return err
+		}
+		if err := StorePurchasedTickets(ctx, c.EntityID, c.ItemID, c.UserID, codes); err != nil {
+			return err
+		}
+		return done(ctx, models.Meta{"uniqueCodes": codes})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ticket not found")
-	}
-
-	if ticket.Quantity < quantity {
-		return nil, fmt.Errorf("not enough tickets available")
+		return err
 	}
+	emailTickets(ctx, c.EntityID, c.UserID, codes)
+	return nil
+}
 
-	// Deduct quantity
-	_, err = db.TicketsCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"eventid": eventID, "ticketid": ticketID},
+// PurchaseTicket deducts quantity tickets while enough are left and
+// returns generated ticket codes. It fails with gateway.ErrUnavailable
+// when they are not.
+func PurchaseTicket(ctx context.Context, eventID, ticketID string, quantity int) ([]string, error) {
+	res, err := db.TicketsCollection.UpdateOne(ctx,
+		bson.M{"eventid": eventID, "ticketid": ticketID, "quantity": bson.M{"$gte": quantity}},
 		bson.M{"$inc": bson.M{"quantity": -quantity, "sold": quantity}},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update ticket quantity")
+		return nil, fmt.Errorf("failed to update ticket quantity: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: not enough tickets of %s left", gateway.ErrUnavailable, ticketID)
 	}
 
 	// Generate unique codes
-	var codes []string
-	for i := 0; i < quantity; i++ {
-		codes = append(codes, utils.GetUUID())
+	codes := make([]string, quantity)
+	for i := range codes {
+		codes[i] = utils.GetUUID()
 	}
-
 	return codes, nil
 }
 
 // StorePurchasedTickets inserts purchased tickets and user data into DB
-func StorePurchasedTickets(eventID, ticketID, userID string, codes []string) error {
+func StorePurchasedTickets(ctx context.Context, eventID, ticketID, userID string, codes []string) error {
 	if len(codes) == 0 {
 		return fmt.Errorf("no tickets to store")
 	}
@@ -231,7 +229,7 @@ func StorePurchasedTickets(eventID, ticketID, userID string, codes []string) err
 	createdAt := now.Format(time.RFC3339)
 
 	var purchasedDocs []interface{}
-	var userDataDocs []models.UserData
+	var userDataDocs []interface{}
 
 	for _, code := range codes {
 		purchasedDocs = append(purchasedDocs, models.PurchasedTicket{
@@ -252,48 +250,13 @@ func StorePurchasedTickets(eventID, ticketID, userID string, codes []string) err
 		})
 	}
 
-	_, err := db.PurchasedTicketsCollection.InsertMany(context.TODO(), purchasedDocs)
-	if err != nil {
-		return fmt.Errorf("failed to store purchased tickets: %v", err)
-	}
-
-	userdata.AddUserDataBatch(userDataDocs)
-	mq.Notify("ticket-bought", models.Index{})
-	return nil
-}
-
-// Handler
-func buyTicket(w http.ResponseWriter, r *http.Request, request TicketPurchaseRequest) {
-	userID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok || userID == "" {
-		http.Error(w, "invalid user", http.StatusBadRequest)
-		return
-	}
-
-	codes, err := PurchaseTicket(request.EventID, request.TicketID, userID, request.Quantity)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if err := StorePurchasedTickets(request.EventID, request.TicketID, userID, codes); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if _, err := db.PurchasedTicketsCollection.InsertMany(ctx, purchasedDocs); err != nil {
+		return fmt.Errorf("failed to store purchased tickets: %w", err)
 	}
-
-	resp := struct {
-		Message     string   `json:"message"`
-		Success     string   `json:"success"`
-		UniqueCodes []string `json:"uniqueCodes"`
-	}{
-		Message:     "Payment successfully processed. Tickets purchased.",
-		Success:     "true",
-		UniqueCodes: codes,
+	if _, err := db.UserDataCollection.InsertMany(ctx, userDataDocs); err != nil {
+		return fmt.Errorf("failed to store user data: %w", err)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	return nil
 }
 
 // Get Available Seats
@@ -310,7 +273,7 @@ func GetAvailableSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	err := db.TicketsCollection.FindOne(context.Background(), filter).Decode(&ticket)
 	if err != nil {
-		http.Error(w, `{"error": "No tickets found for this event"}`, http.StatusNotFound)
+		apierr.Respond(w, http.StatusNotFound, "No tickets found for this event")
 		return
 	}
 
@@ -329,49 +292,53 @@ func GetAvailableSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	json.NewEncoder(w).Encode(map[string]any{"seats": availableSeats})
 }
 
-// Lock Seats
+// Lock Seats holds the requested seats for the caller for seatLockTTL. It
+// locks all of them or none; seats already held by someone else make it
+// fail with 409.
 func LockSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
 	eventID := ps.ByName("eventid")
 	var request struct {
-		UserID string   `json:"user_id"`
-		Seats  []string `json:"seats"`
+		Seats []string `json:"seats"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Seats) == 0 {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
+	userID := utils.GetUserIDFromRequest(r)
 
-	filter := bson.M{"event_id": eventID, "seats.seat_id": bson.M{"$in": request.Seats}}
-	update := bson.M{"$set": bson.M{"seats.$[].status": "locked", "seats.$[].user_id": request.UserID}}
-
-	_, err := db.TicketsCollection.UpdateOne(context.Background(), filter, update)
+	until, err := lockSeats(ctx, eventID, userID, request.Seats)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to lock seats"}`, http.StatusInternalServerError)
+		if err == errSeatsTaken {
+			apierr.Respond(w, http.StatusConflict, "Some seats are no longer available")
+			return
+		}
+		log.Printf("lock seats for event %s: %v", eventID, err)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to lock seats")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "Seats locked successfully"})
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":      true,
+		"message":      "Seats locked successfully",
+		"locked_until": until,
+	})
 }
 
-// Unlock Seats
+// Unlock Seats releases seats the caller holds.
 func UnlockSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	eventID := ps.ByName("eventid")
 	var request struct {
-		UserID string   `json:"user_id"`
-		Seats  []string `json:"seats"`
+		Seats []string `json:"seats"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	filter := bson.M{"event_id": eventID, "seats.seat_id": bson.M{"$in": request.Seats}, "seats.user_id": request.UserID}
-	update := bson.M{"$set": bson.M{"seats.$[].status": "available", "seats.$[].user_id": nil}}
-
-	_, err := db.TicketsCollection.UpdateOne(context.Background(), filter, update)
-	if err != nil {
-		http.Error(w, `{"error": "Failed to unlock seats"}`, http.StatusInternalServerError)
+	if err := unlockSeats(r.Context(), eventID, utils.GetUserIDFromRequest(r), request.Seats); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to unlock seats")
 		return
 	}
 
@@ -379,50 +346,95 @@ func UnlockSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "Seats unlocked successfully"})
 }
 
-// Confirm Seat Purchase
-func ConfirmSeatPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// CreateSeatPaymentSession opens a checkout for seats the caller holds
+// an unexpired lock on. The seats are booked once the payment provider
+// confirms the payment, not before.
+// POST /seats/:eventid/ticket/:ticketid/payment-session {"seats":[...]}
+func CreateSeatPaymentSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
 	eventID := ps.ByName("eventid")
 	ticketID := ps.ByName("ticketid")
+	userID := utils.GetUserIDFromRequest(r)
 
 	var request struct {
-		UserID string   `json:"user_id"`
-		Seats  []string `json:"seats"`
+		Seats []string `json:"seats"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Seats) == 0 {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	filter := bson.M{"_id": ticketID, "event_id": eventID, "seats.seat_id": bson.M{"$in": request.Seats}}
 	var ticket struct {
-		Seats []struct {
-			SeatID string `bson:"seat_id"`
-			Status string `bson:"status"`
-			UserID string `bson:"user_id"`
-		} `bson:"seats"`
+		Name  string      `bson:"name"`
+		Price money.Money `bson:"price"`
+	}
+	err := db.TicketsCollection.FindOne(ctx, heldSeats(eventID, ticketID, userID, request.Seats)).Decode(&ticket)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		apierr.Respond(w, http.StatusConflict, "Some seats are not properly locked or have been taken")
+		return
 	}
-
-	err := db.TicketsCollection.FindOne(context.Background(), filter).Decode(&ticket)
 	if err != nil {
-		http.Error(w, `{"error": "Ticket or seats not found"}`, http.StatusNotFound)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to create payment session")
 		return
 	}
-
-	for _, seat := range ticket.Seats {
-		if seat.Status != "locked" || seat.UserID != request.UserID {
-			http.Error(w, `{"error": "Some seats are not properly locked or have been taken"}`, http.StatusConflict)
-			return
-		}
+	amount, err := ticket.Price.Mul(int64(len(request.Seats)))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request")
+		return
 	}
 
-	update := bson.M{"$set": bson.M{"seats.$[].status": "booked"}}
-
-	_, err = db.TicketsCollection.UpdateOne(context.Background(), filter, update)
+	checkout, session, err := gateway.Start(ctx, userID, gateway.Item{
+		Kind:        gateway.KindSeat,
+		EntityType:  "event",
+		EntityID:    eventID,
+		ItemID:      ticketID,
+		Quantity:    len(request.Seats),
+		Seats:       request.Seats,
+		Amount:      amount,
+		Description: fmt.Sprintf("%s, seats %s", ticket.Name, strings.Join(request.Seats, ", ")),
+	})
 	if err != nil {
-		http.Error(w, `{"error": "Failed to confirm purchase"}`, http.StatusInternalServerError)
+		gateway.RespondStartError(w, r, err)
 		return
 	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"data": map[string]any{
+			"paymentUrl": session.URL,
+			"checkoutId": checkout.ID,
+			"eventId":    eventID,
+			"ticketId":   ticketID,
+			"seats":      request.Seats,
+		},
+	})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "Ticket purchased successfully"})
+// ConfirmSeatPurchase reports whether the caller's seat checkout has been
+// paid. Seats are booked by FulfilSeatCheckout once the payment
+// provider's webhook confirms the payment, never on the client's word.
+func ConfirmSeatPurchase(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request struct {
+		CheckoutID string `json:"checkoutId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CheckoutID == "" {
+		apierr.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	gateway.Confirm(w, r, gateway.KindSeat, request.CheckoutID)
+}
+
+// FulfilSeatCheckout books the seats of a paid checkout. Seats whose lock
+// ran out while the buyer was paying may have been taken; the payment is
+// then refunded.
+func FulfilSeatCheckout(ctx context.Context, c *models.Checkout, done func(context.Context, models.Meta) error) error {
+	return db.RunInTransaction(ctx, func(ctx context.Context) error {
+		err := bookSeats(ctx, c.EntityID, c.ItemID, c.UserID, c.Seats)
+		if errors.Is(err, errSeatsTaken) {
+			return fmt.Errorf("%w: %v", gateway.ErrUnavailable, err)
+		}
+		if err != nil {
+			return err
+		}
+		return done(ctx, models.Meta{"seats": c.Seats})
+	})
 }
@@ -0,0 +1,98 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters authenticator apps assume: HMAC-SHA1, six digits and a
+// 30-second step.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	modulus = 1_000_000 // 10^Digits
+)
+
+// encoding is the base32 form of secrets in provisioning URIs.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random 160-bit secret in base32, as RFC 4226
+// recommends.
+func NewSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth:// provisioning URI that authenticator apps
+// read from a QR code.
+func URI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Step returns the time step that t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code of secret for time step step.
+func Code(secret string, step int64) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, step), nil
+}
+
+// Validate checks code against secret at t, accepting skew steps either
+// side for clock drift. It returns the matching step so callers can
+// refuse a code that was already used.
+func Validate(secret, code string, t time.Time, skew int) (int64, bool) {
+	key, err := decode(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for d := -int64(skew); d <= int64(skew); d++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, now+d)), []byte(code)) == 1 {
+			return now + d, true
+		}
+	}
+	return 0, false
+}
+
+func decode(secret string) ([]byte, error) {
+	return encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
+
+// hotp is the HOTP value of RFC 4226 section 5.3 for counter step.
+func hotp(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, bin%modulus)
+}
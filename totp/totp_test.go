@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 vectors of RFC 6238 appendix B, cut to six digits.
+func TestRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Errorf("Code at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	prev, _ := Code(secret, Step(now)-1)
+	if step, ok := Validate(secret, prev, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("previous step: %d, %v", step, ok)
+	}
+	if _, ok := Validate(secret, prev, now, 0); ok {
+		t.Error("previous step accepted without skew")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Naevis", "ann@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Naevis:ann@example.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("URI = %s", uri)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"naevis/apierr"
 	"naevis/db"
 	"naevis/middleware"
 	"naevis/models"
@@ -49,6 +50,27 @@ func DelUserData(dataType string, dataId string, userId string) {
 	RemUserData(dataType, dataId, userId)
 }
 
+// SetUserDataTx records user data with ctx, so it joins the caller's
+// db.RunInTransaction, and reports failures instead of logging them.
+func SetUserDataTx(ctx context.Context, dataType, dataId, userId, itemType, itemId string) error {
+	content := models.UserData{
+		EntityID:   dataId,
+		EntityType: dataType,
+		ItemID:     itemId,
+		ItemType:   itemType,
+		UserID:     userId,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+	_, err := db.UserDataCollection.InsertOne(ctx, content)
+	return err
+}
+
+// DelUserDataTx is the transactional counterpart of DelUserData.
+func DelUserDataTx(ctx context.Context, dataType, dataId, userId string) error {
+	_, err := db.UserDataCollection.DeleteOne(ctx, bson.M{"entity_id": dataId, "entity_type": dataType, "userid": userId})
+	return err
+}
+
 func AddUserData(entityType, entityId, userId, itemType, itemId string) {
 	var content models.UserData
 	content.EntityID = entityId
@@ -80,23 +102,23 @@ func GetUserProfileData(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	tokenString := r.Header.Get("Authorization")
 	claims, err := middleware.ValidateJWT(tokenString)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	if username != claims.UserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierr.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 	// Parse the query parameter for the entity type
 	entityType := r.URL.Query().Get("entity_type")
 	if entityType == "" {
-		http.Error(w, "Entity type is required", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Entity type is required")
 		return
 	}
 
 	// Validate the entity type
 	if !IsValidEntityType(entityType) {
-		http.Error(w, "Invalid entity type", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid entity type")
 		return
 	}
 
@@ -104,7 +126,7 @@ func GetUserProfileData(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	filter := bson.M{"entity_type": entityType, "userid": username}
 	cursor, err := db.UserDataCollection.Find(context.TODO(), filter)
 	if err != nil {
-		http.Error(w, "Failed to fetch user data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to fetch user data")
 		log.Printf("Error fetching user data: %v", err)
 		return
 	}
@@ -112,7 +134,7 @@ func GetUserProfileData(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 
 	var results []models.UserData
 	if err := cursor.All(context.TODO(), &results); err != nil {
-		http.Error(w, "Failed to decode user data", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to decode user data")
 		log.Printf("Error decoding user data: %v", err)
 		return
 	}
@@ -124,7 +146,7 @@ func GetUserProfileData(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	// Respond with the results
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(results); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 		log.Printf("Error encoding response: %v", err)
 		return
 	}
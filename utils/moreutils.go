@@ -19,9 +19,10 @@ import (
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"naevis/apierr"
+	"naevis/db"
 	"naevis/globals"
 	"naevis/middleware"
 )
@@ -97,7 +98,7 @@ func SanitizeText(s string) string {
 
 // --- MongoDB Helpers ---
 
-func FindAndDecode[T any](ctx context.Context, col *mongo.Collection, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+func FindAndDecode[T any](ctx context.Context, col db.Collection, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
 	cursor, err := col.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, err
@@ -157,14 +158,10 @@ func RespondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
 
-func RespondWithError(w http.ResponseWriter, code int, msg string) {
-	RespondWithJSON(w, code, map[string]string{"error": msg})
-}
-
 type M map[string]interface{}
 
 func ToJSON(v interface{}) []byte {
@@ -9,19 +9,21 @@ import (
 	"path/filepath"
 	"time"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 func UploadImages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	err := r.ParseMultipartForm(10 << 20) // 10MB max
 	if err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
 	files := r.MultipartForm.File["images"]
 	if len(files) == 0 {
-		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "No files uploaded")
 		return
 	}
 
@@ -29,7 +31,7 @@ func UploadImages(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	for _, fileHeader := range files {
 		file, err := fileHeader.Open()
 		if err != nil {
-			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Error reading file")
 			return
 		}
 		defer file.Close()
@@ -39,13 +41,13 @@ func UploadImages(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		path := filepath.Join("public/uploads", filename)
 		out, err := os.Create(path)
 		if err != nil {
-			http.Error(w, "Error saving file", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Error saving file")
 			return
 		}
 		defer out.Close()
 
 		if _, err := io.Copy(out, file); err != nil {
-			http.Error(w, "Error writing file", http.StatusInternalServerError)
+			apierr.Respond(w, http.StatusInternalServerError, "Error writing file")
 			return
 		}
 
@@ -12,6 +12,8 @@ import (
 	"slices"
 	"strings"
 
+	"naevis/apierr"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -88,7 +90,7 @@ var SupportedImageTypes = map[string]bool{
 func ValidateImageFileType(w http.ResponseWriter, header *multipart.FileHeader) bool {
 	mimeType := header.Header.Get("Content-Type")
 	if !SupportedImageTypes[mimeType] {
-		http.Error(w, "Invalid file type. Supported formats: JPEG, PNG, WebP, GIF, BMP, TIFF.", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, "Invalid file type. Supported formats: JPEG, PNG, WebP, GIF, BMP, TIFF.")
 		return false
 	}
 	return true